@@ -0,0 +1,63 @@
+package quic
+
+import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A packetReader reads packets from a net.PacketConn.
+// On Linux, it reads multiple packets using a single recvmmsg syscall.
+type packetReader interface {
+	// ReadPacket reads the next packet.
+	// The packet is read into a buffer taken from the packet buffer pool.
+	// The caller is responsible for returning it to the pool.
+	// If the ECN codepoint of the packet can't be read, it returns ECNNon.
+	ReadPacket() ([]byte, net.Addr, protocol.ECN, error)
+}
+
+// A packetWriter writes packets to a net.PacketConn.
+// On Linux, it writes multiple packets using a single sendmmsg syscall.
+type packetWriter interface {
+	// WritePackets writes the packets, setting the ECN codepoint if supported.
+	WritePackets(packets [][]byte, addr net.Addr, ecn protocol.ECN) error
+}
+
+// The basicPacketReader reads one packet at a time.
+// It is used on platforms that don't support batch reads, and for connections that are not UDP connections.
+type basicPacketReader struct {
+	conn net.PacketConn
+}
+
+var _ packetReader = &basicPacketReader{}
+
+func (r *basicPacketReader) ReadPacket() ([]byte, net.Addr, protocol.ECN, error) {
+	data := *getPacketBuffer()
+	data = data[:protocol.MaxReceiveBufferSize]
+	// The packet size should not exceed protocol.MaxReceivePacketSize bytes
+	// If it does, we only read a truncated packet, which is then rejected as oversized
+	n, addr, err := r.conn.ReadFrom(data)
+	if err != nil {
+		putPacketBuffer(&data)
+		return nil, nil, protocol.ECNNon, err
+	}
+	return data[:n], addr, protocol.ECNNon, nil
+}
+
+// The basicPacketWriter writes one packet at a time.
+// It is used on platforms that don't support batch writes, and for connections that are not UDP connections.
+// It doesn't set the ECN codepoint.
+type basicPacketWriter struct {
+	conn net.PacketConn
+}
+
+var _ packetWriter = &basicPacketWriter{}
+
+func (w *basicPacketWriter) WritePackets(packets [][]byte, addr net.Addr, _ protocol.ECN) error {
+	for _, p := range packets {
+		if _, err := w.conn.WriteTo(p, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
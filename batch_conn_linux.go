@@ -0,0 +1,211 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// A batchConn reads and writes multiple packets using a single syscall.
+// It is implemented by ipv4.PacketConn and ipv6.PacketConn.
+// ipv4.Message and ipv6.Message are the same type.
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// newBatchConn returns a batchConn for UDP connections.
+// isIPv4 is set for connections bound to an IPv4 address.
+func newBatchConn(c net.PacketConn) (bc batchConn, isIPv4 bool, ok bool) {
+	udpConn, ok := c.(*net.UDPConn)
+	if !ok {
+		return nil, false, false
+	}
+	addr, ok := udpConn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, false, false
+	}
+	if addr.IP.To4() != nil {
+		return ipv4.NewPacketConn(udpConn), true, true
+	}
+	return ipv6.NewPacketConn(udpConn), false, true
+}
+
+func newPacketReader(c net.PacketConn) packetReader {
+	bc, isIPv4, ok := newBatchConn(c)
+	if !ok {
+		return &basicPacketReader{conn: c}
+	}
+	r := newBatchPacketReader(bc)
+	r.ecn = enableECNReceive(c.(*net.UDPConn), isIPv4)
+	return r
+}
+
+func newPacketWriter(c net.PacketConn) packetWriter {
+	bc, isIPv4, ok := newBatchConn(c)
+	if !ok {
+		return &basicPacketWriter{conn: c}
+	}
+	return newBatchPacketWriter(bc, isIPv4, c)
+}
+
+// The batchPacketReader reads up to protocol.PacketBatchSize packets using a single recvmmsg syscall.
+type batchPacketReader struct {
+	conn     batchConn
+	messages []ipv4.Message
+	next     int // the index of the next message returned by ReadPacket
+	num      int // the number of messages read by the last ReadBatch call
+
+	// ecn is set if the kernel passes the TOS / Traffic Class byte of received packets
+	ecn bool
+}
+
+var _ packetReader = &batchPacketReader{}
+
+func newBatchPacketReader(c batchConn) *batchPacketReader {
+	messages := make([]ipv4.Message, protocol.PacketBatchSize)
+	for i := range messages {
+		messages[i].Buffers = make([][]byte, 1)
+		messages[i].OOB = make([]byte, ecnReceiveOOBLen)
+	}
+	return &batchPacketReader{
+		conn:     c,
+		messages: messages,
+		next:     len(messages),
+		num:      len(messages),
+	}
+}
+
+func (r *batchPacketReader) ReadPacket() ([]byte, net.Addr, protocol.ECN, error) {
+	for r.next == r.num {
+		// The buffers of the messages returned by ReadPacket are now owned by the caller.
+		for i := 0; i < r.num; i++ {
+			r.messages[i].Buffers[0] = (*getPacketBuffer())[:protocol.MaxReceiveBufferSize]
+		}
+		// If reading fails, the buffers are used for the next ReadBatch call.
+		r.next, r.num = 0, 0
+		n, err := r.conn.ReadBatch(r.messages, 0)
+		if err != nil {
+			return nil, nil, protocol.ECNNon, err
+		}
+		r.num = n
+	}
+	msg := r.messages[r.next]
+	r.next++
+	ecn := protocol.ECNNon
+	if r.ecn {
+		ecn = parseECN(msg.OOB[:msg.NN])
+	}
+	// The packet size should not exceed protocol.MaxReceivePacketSize bytes
+	// If it does, we only read a truncated packet, which is then rejected as oversized
+	return msg.Buffers[0][:msg.N], msg.Addr, ecn, nil
+}
+
+// The batchPacketWriter writes up to protocol.PacketBatchSize messages using a single sendmmsg syscall.
+// If the kernel supports UDP generic segmentation offload (GSO), multiple packets are sent in a single message.
+// The ECN codepoint is set using an IP_TOS / IPV6_TCLASS control message.
+type batchPacketWriter struct {
+	conn     batchConn
+	isIPv4   bool
+	messages []ipv4.Message
+
+	// gso is set if the socket supports GSO.
+	// It is unset when a GSO write fails, e.g. because the network interface doesn't support checksum offloading.
+	gso bool
+	// oobs contains the control messages with the ECN codepoint and the segment size for every message
+	oobs [][]byte
+
+	// IPv4 addresses can't be passed to sendmmsg on an IPv6 socket.
+	// Packets sent to IPv4 addresses on a dual-stack socket are written one at a time.
+	fallback *basicPacketWriter
+}
+
+var _ packetWriter = &batchPacketWriter{}
+
+func newBatchPacketWriter(c batchConn, isIPv4 bool, pconn net.PacketConn) *batchPacketWriter {
+	w := &batchPacketWriter{
+		conn:     c,
+		isIPv4:   isIPv4,
+		messages: make([]ipv4.Message, protocol.PacketBatchSize),
+		fallback: &basicPacketWriter{conn: pconn},
+		oobs:     make([][]byte, protocol.PacketBatchSize),
+	}
+	for i := range w.oobs {
+		w.oobs[i] = make([]byte, ecnMsgLen+udpSegmentMsgLen)
+	}
+	if udpConn, ok := pconn.(*net.UDPConn); ok && isGSOSupported(udpConn) {
+		w.gso = true
+	}
+	return w
+}
+
+func (w *batchPacketWriter) WritePackets(packets [][]byte, addr net.Addr, ecn protocol.ECN) error {
+	if udpAddr, ok := addr.(*net.UDPAddr); !ok || (!w.isIPv4 && udpAddr.IP.To4() != nil) {
+		return w.fallback.WritePackets(packets, addr, ecn)
+	}
+	for len(packets) > 0 {
+		n, err := w.writeBatch(packets, addr, ecn)
+		packets = packets[n:]
+		if err != nil {
+			if !w.gso || !isGSOError(err) {
+				return err
+			}
+			// The remaining packets weren't sent. Send them without using GSO.
+			w.gso = false
+		}
+	}
+	return nil
+}
+
+// writeBatch writes up to protocol.PacketBatchSize messages.
+// It returns the number of packets written.
+func (w *batchPacketWriter) writeBatch(packets [][]byte, addr net.Addr, ecn protocol.ECN) (int, error) {
+	var numMessages, numPackets int
+	for numMessages < len(w.messages) && numPackets < len(packets) {
+		msg := &w.messages[numMessages]
+		oob := w.oobs[numMessages]
+		var oobLen int
+		if ecn != protocol.ECNNon {
+			oobLen += len(setECNMsg(oob, ecn, w.isIPv4))
+		}
+		n := 1
+		if w.gso {
+			n = numGSOSegments(packets[numPackets:])
+			if n > 1 {
+				oobLen += len(setUDPSegmentSizeMsg(oob[oobLen:], uint16(len(packets[numPackets]))))
+			}
+		}
+		msg.OOB = nil
+		if oobLen > 0 {
+			msg.OOB = oob[:oobLen]
+		}
+		msg.Buffers = packets[numPackets : numPackets+n]
+		msg.Addr = addr
+		numMessages++
+		numPackets += n
+	}
+	ms := w.messages[:numMessages]
+	defer func() {
+		for i := range ms {
+			ms[i].Buffers = nil
+		}
+	}()
+
+	var sent int // the number of packets sent
+	for i := 0; i < len(ms); {
+		n, err := w.conn.WriteBatch(ms[i:], 0)
+		for _, msg := range ms[i : i+n] {
+			sent += len(msg.Buffers)
+		}
+		if err != nil {
+			return sent, err
+		}
+		i += n
+	}
+	return sent, nil
+}
@@ -0,0 +1,259 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/net/ipv4"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batch Packet Reader and Writer", func() {
+	var server, client *net.UDPConn
+
+	BeforeEach(func() {
+		addr, err := net.ResolveUDPAddr("udp4", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		server, err = net.ListenUDP("udp4", addr)
+		Expect(err).ToNot(HaveOccurred())
+		client, err = net.ListenUDP("udp4", addr)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		client.Close()
+	})
+
+	getPackets := func(num int) [][]byte {
+		packets := make([][]byte, num)
+		for i := range packets {
+			packets[i] = []byte(fmt.Sprintf("packet %d", i))
+		}
+		return packets
+	}
+
+	It("uses batch reads and writes for UDP connections", func() {
+		Expect(newPacketReader(server)).To(BeAssignableToTypeOf(&batchPacketReader{}))
+		Expect(newPacketWriter(client)).To(BeAssignableToTypeOf(&batchPacketWriter{}))
+	})
+
+	It("writes and reads more packets than fit into a single batch", func() {
+		packets := getPackets(3*protocol.PacketBatchSize + 1)
+		Expect(newPacketWriter(client).WritePackets(packets, server.LocalAddr(), protocol.ECNNon)).To(Succeed())
+		r := newPacketReader(server)
+		for _, p := range packets {
+			data, addr, _, err := r.ReadPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(p))
+			Expect(cap(data)).To(Equal(int(protocol.MaxReceiveBufferSize)))
+			Expect(addr.String()).To(Equal(client.LocalAddr().String()))
+		}
+	})
+
+	It("doesn't reuse the buffers of packets that were already returned", func() {
+		w := newPacketWriter(client)
+		r := newPacketReader(server)
+		Expect(w.WritePackets([][]byte{[]byte("foo")}, server.LocalAddr(), protocol.ECNNon)).To(Succeed())
+		data1, _, _, err := r.ReadPacket()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.WritePackets([][]byte{[]byte("bar")}, server.LocalAddr(), protocol.ECNNon)).To(Succeed())
+		data2, _, _, err := r.ReadPacket()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data1).To(Equal([]byte("foo")))
+		Expect(data2).To(Equal([]byte("bar")))
+	})
+
+	It("returns read errors", func() {
+		r := newPacketReader(server)
+		server.Close()
+		_, _, _, err := r.ReadPacket()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("writes packets to IPv4 addresses on IPv6 sockets one by one", func() {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6unspecified})
+		if err != nil {
+			Skip("IPv6 not available")
+		}
+		defer conn.Close()
+		w := newPacketWriter(conn)
+		Expect(w).To(BeAssignableToTypeOf(&batchPacketWriter{}))
+		Expect(w.(*batchPacketWriter).isIPv4).To(BeFalse())
+		packets := getPackets(2)
+		Expect(w.WritePackets(packets, server.LocalAddr(), protocol.ECNNon)).To(Succeed())
+		r := newPacketReader(server)
+		for _, p := range packets {
+			data, _, _, err := r.ReadPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(p))
+		}
+	})
+
+	Context("ECN", func() {
+		It("sets and reads the ECN codepoint", func() {
+			r := newPacketReader(server)
+			if !r.(*batchPacketReader).ecn {
+				Skip("reading the TOS byte not supported")
+			}
+			w := newPacketWriter(client)
+			Expect(w.WritePackets([][]byte{[]byte("foo")}, server.LocalAddr(), protocol.ECT0)).To(Succeed())
+			Expect(w.WritePackets([][]byte{[]byte("bar")}, server.LocalAddr(), protocol.ECNNon)).To(Succeed())
+			Expect(w.WritePackets([][]byte{[]byte("baz")}, server.LocalAddr(), protocol.ECNCE)).To(Succeed())
+			for _, ecn := range []protocol.ECN{protocol.ECT0, protocol.ECNNon, protocol.ECNCE} {
+				_, _, e, err := r.ReadPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(e).To(Equal(ecn))
+			}
+		})
+
+		It("sets the ECN codepoint on IPv6 sockets", func() {
+			addr := &net.UDPAddr{IP: net.IPv6loopback}
+			s, err := net.ListenUDP("udp6", addr)
+			if err != nil {
+				Skip("IPv6 not available")
+			}
+			defer s.Close()
+			c, err := net.ListenUDP("udp6", addr)
+			Expect(err).ToNot(HaveOccurred())
+			defer c.Close()
+			r := newPacketReader(s)
+			Expect(r.(*batchPacketReader).ecn).To(BeTrue())
+			Expect(newPacketWriter(c).WritePackets(getPackets(2), s.LocalAddr(), protocol.ECT0)).To(Succeed())
+			for i := 0; i < 2; i++ {
+				_, _, ecn, err := r.ReadPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ecn).To(Equal(protocol.ECT0))
+			}
+		})
+
+		It("parses IP_TOS and IPV6_TCLASS control messages", func() {
+			b := make([]byte, ecnMsgLen)
+			Expect(parseECN(setECNMsg(b, protocol.ECT1, true))).To(Equal(protocol.ECT1))
+			Expect(parseECN(setECNMsg(b, protocol.ECNCE, false))).To(Equal(protocol.ECNCE))
+			Expect(parseECN(nil)).To(Equal(protocol.ECNNon))
+		})
+
+		It("sets the ECN codepoint when using GSO", func() {
+			w := newPacketWriter(client).(*batchPacketWriter)
+			if !w.gso {
+				Skip("GSO not supported")
+			}
+			r := newPacketReader(server)
+			packets := [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}
+			Expect(w.WritePackets(packets, server.LocalAddr(), protocol.ECT0)).To(Succeed())
+			for _, p := range packets {
+				data, _, ecn, err := r.ReadPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(p))
+				Expect(ecn).To(Equal(protocol.ECT0))
+			}
+		})
+	})
+
+	Context("GSO", func() {
+		It("detects GSO support", func() {
+			if !isGSOSupported(client) {
+				Skip("GSO not supported")
+			}
+			Expect(newPacketWriter(client).(*batchPacketWriter).gso).To(BeTrue())
+		})
+
+		It("sends packets using GSO", func() {
+			w := newPacketWriter(client).(*batchPacketWriter)
+			if !w.gso {
+				Skip("GSO not supported")
+			}
+			packets := [][]byte{[]byte("foo"), []byte("bar"), []byte("baz"), []byte("0")}
+			Expect(w.WritePackets(packets, server.LocalAddr(), protocol.ECNNon)).To(Succeed())
+			r := newPacketReader(server)
+			// the kernel splits the data into separate UDP datagrams
+			for _, p := range packets {
+				data, _, _, err := r.ReadPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(p))
+			}
+		})
+
+		It("sends packets that have the same size in a single message", func() {
+			Expect(numGSOSegments([][]byte{make([]byte, 10), make([]byte, 10), make([]byte, 10)})).To(Equal(3))
+			Expect(numGSOSegments([][]byte{make([]byte, 10)})).To(Equal(1))
+		})
+
+		It("only sends a smaller packet at the end of a message", func() {
+			Expect(numGSOSegments([][]byte{make([]byte, 10), make([]byte, 5), make([]byte, 5)})).To(Equal(2))
+		})
+
+		It("doesn't send larger packets in the same message", func() {
+			Expect(numGSOSegments([][]byte{make([]byte, 10), make([]byte, 11)})).To(Equal(1))
+		})
+
+		It("limits the number of segments", func() {
+			packets := make([][]byte, 2*maxGSOSegments)
+			for i := range packets {
+				packets[i] = make([]byte, 10)
+			}
+			Expect(numGSOSegments(packets)).To(Equal(maxGSOSegments))
+		})
+
+		It("limits the size of a message", func() {
+			packets := make([][]byte, maxGSOSegments)
+			for i := range packets {
+				packets[i] = make([]byte, 1400)
+			}
+			Expect(numGSOSegments(packets)).To(Equal(maxGSOSize / 1400))
+		})
+
+		It("stops using GSO when a write fails", func() {
+			bc := &mockBatchConn{gsoErr: &net.OpError{Op: "write", Err: os.NewSyscallError("sendmmsg", syscall.EIO)}}
+			w := newBatchPacketWriter(bc, true, client)
+			w.gso = true
+			w.oobs = [][]byte{make([]byte, udpSegmentMsgLen), make([]byte, udpSegmentMsgLen)}
+			w.messages = w.messages[:2]
+			packets := [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}
+			Expect(w.WritePackets(packets, server.LocalAddr(), protocol.ECNNon)).To(Succeed())
+			Expect(w.gso).To(BeFalse())
+			Expect(bc.written).To(Equal(packets))
+		})
+
+		It("returns other errors", func() {
+			bc := &mockBatchConn{gsoErr: &net.OpError{Op: "write", Err: os.NewSyscallError("sendmmsg", syscall.EPERM)}}
+			w := newBatchPacketWriter(bc, true, client)
+			w.gso = true
+			w.oobs = make([][]byte, len(w.messages))
+			for i := range w.oobs {
+				w.oobs[i] = make([]byte, udpSegmentMsgLen)
+			}
+			Expect(w.WritePackets([][]byte{[]byte("foo"), []byte("bar")}, server.LocalAddr(), protocol.ECNNon)).To(MatchError(bc.gsoErr))
+			Expect(w.gso).To(BeTrue())
+		})
+	})
+})
+
+// The mockBatchConn fails writes of messages that use GSO with gsoErr.
+// It writes at most one message at a time.
+type mockBatchConn struct {
+	gsoErr  error
+	written [][]byte
+}
+
+var _ batchConn = &mockBatchConn{}
+
+func (c *mockBatchConn) ReadBatch([]ipv4.Message, int) (int, error) { panic("not implemented") }
+
+func (c *mockBatchConn) WriteBatch(ms []ipv4.Message, _ int) (int, error) {
+	if len(ms[0].OOB) > 0 {
+		return 0, c.gsoErr
+	}
+	c.written = append(c.written, ms[0].Buffers...)
+	return 1, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package quic
+
+import "net"
+
+func newPacketReader(c net.PacketConn) packetReader {
+	return &basicPacketReader{conn: c}
+}
+
+func newPacketWriter(c net.PacketConn) packetWriter {
+	return &basicPacketWriter{conn: c}
+}
@@ -0,0 +1,88 @@
+package quic
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Packet Reader and Writer", func() {
+	var packetConn *mockPacketConn
+
+	BeforeEach(func() {
+		packetConn = newMockPacketConn()
+		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(192, 168, 100, 200), Port: 1337}
+	})
+
+	Context("reading", func() {
+		It("reads packets one by one", func() {
+			packetConn.dataToRead <- []byte("foo")
+			packetConn.dataToRead <- []byte("bar")
+			r := &basicPacketReader{conn: packetConn}
+			data, addr, _, err := r.ReadPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foo")))
+			Expect(cap(data)).To(Equal(int(protocol.MaxReceiveBufferSize)))
+			Expect(addr).To(Equal(packetConn.dataReadFrom))
+			data, _, _, err = r.ReadPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("bar")))
+		})
+
+		It("returns read errors", func() {
+			packetConn.readErr = errors.New("read failed")
+			_, _, _, err := (&basicPacketReader{conn: packetConn}).ReadPacket()
+			Expect(err).To(MatchError("read failed"))
+		})
+
+		It("only uses batch reads for UDP connections", func() {
+			Expect(newPacketReader(packetConn)).To(BeAssignableToTypeOf(&basicPacketReader{}))
+		})
+	})
+
+	Context("writing", func() {
+		It("writes packets one by one", func() {
+			addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}
+			w := &basicPacketWriter{conn: packetConn}
+			Expect(w.WritePackets([][]byte{[]byte("foo"), []byte("bar")}, addr, protocol.ECNNon)).To(Succeed())
+			Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+			Expect(packetConn.dataWrittenTo).To(Equal(addr))
+		})
+
+		It("only uses batch writes for UDP connections", func() {
+			Expect(newPacketWriter(packetConn)).To(BeAssignableToTypeOf(&basicPacketWriter{}))
+		})
+	})
+})
+
+// BenchmarkPacketReading reads packets the way the read loops of the client and the server do.
+// When the packet buffers are returned to the pool, only the slice headers are allocated for every packet,
+// instead of a new packet buffer.
+func BenchmarkPacketReading(b *testing.B) {
+	packet := make([]byte, protocol.MaxReceivePacketSize)
+
+	run := func(b *testing.B, returnBuffer bool) {
+		packetConn := newMockPacketConn()
+		r := &basicPacketReader{conn: packetConn}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			packetConn.dataToRead <- packet
+			data, _, _, err := r.ReadPacket()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if returnBuffer {
+				putPacketBuffer(&data)
+			}
+		}
+	}
+
+	b.Run("returning buffers to the pool", func(b *testing.B) { run(b, true) })
+	b.Run("without returning buffers", func(b *testing.B) { run(b, false) })
+}
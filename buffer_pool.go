@@ -13,15 +13,21 @@ func getPacketBuffer() *[]byte {
 }
 
 func putPacketBuffer(buf *[]byte) {
-	if cap(*buf) != int(protocol.MaxReceivePacketSize) {
+	if cap(*buf) != int(protocol.MaxReceiveBufferSize) {
 		panic("putPacketBuffer called with packet of wrong size!")
 	}
 	bufferPool.Put(buf)
 }
 
+// copyToPacketBuffer copies data to a buffer from the buffer pool.
+// It is used for packets that were coalesced into a single UDP datagram, such that every packet can be returned to the buffer pool on its own.
+func copyToPacketBuffer(data []byte) []byte {
+	return append((*getPacketBuffer())[:0], data...)
+}
+
 func init() {
 	bufferPool.New = func() interface{} {
-		b := make([]byte, 0, protocol.MaxReceivePacketSize)
+		b := make([]byte, 0, protocol.MaxReceiveBufferSize)
 		return &b
 	}
 }
@@ -10,7 +10,7 @@ import (
 var _ = Describe("Buffer Pool", func() {
 	It("returns buffers of cap", func() {
 		buf := *getPacketBuffer()
-		Expect(buf).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+		Expect(buf).To(HaveCap(int(protocol.MaxReceiveBufferSize)))
 	})
 
 	It("panics if wrong-sized buffers are passed", func() {
@@ -2,6 +2,8 @@ package quic
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -34,12 +36,23 @@ type client struct {
 
 	srcConnID  protocol.ConnectionID
 	destConnID protocol.ConnectionID
+	// connIDs are the connection IDs that the session issued to the server, in addition to the srcConnID.
+	// They are added and retired by the session's run loop, and read when a packet is received.
+	connIDsMutex sync.Mutex
+	connIDs      map[string] /* string(ConnectionID)*/ struct{}
 
 	initialVersion protocol.VersionNumber
 	version        protocol.VersionNumber
 
+	// early is set when dialing using DialEarly.
+	// The session is then returned as soon as it can be used to send data.
+	early   bool
 	session packetHandler
 
+	// transport is set when dialing using a Transport.
+	// The Transport then reads packets from the connection and passes them to the client.
+	transport *Transport
+
 	logger utils.Logger
 }
 
@@ -47,20 +60,214 @@ var (
 	// make it possible to mock connection ID generation in the tests
 	generateConnectionID         = protocol.GenerateConnectionID
 	errCloseSessionForNewVersion = errors.New("closing session in order to recreate it with a new version")
+
+	// make it possible to mock DNS resolution and dialing in the Happy Eyeballs tests
+	lookupIPAddr             = net.DefaultResolver.LookupIPAddr
+	dialHappyEyeballsAttempt = DialContext
 )
 
 // DialAddr establishes a new QUIC connection to a server.
 // The hostname for SNI is taken from the given address.
 func DialAddr(addr string, tlsConf *tls.Config, config *Config) (Session, error) {
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	return DialAddrContext(context.Background(), addr, tlsConf, config)
+}
+
+// DialAddrContext establishes a new QUIC connection to a server using the provided context.
+// If the context is canceled before the handshake completes, the connection attempt is aborted.
+// The hostname for SNI is taken from the given address.
+func DialAddrContext(ctx context.Context, addr string, tlsConf *tls.Config, config *Config) (Session, error) {
+	if config != nil && config.HappyEyeballs {
+		return dialAddrHappyEyeballs(ctx, addr, tlsConf, config)
+	}
+	udpAddr, err := resolveUDPAddr(ctx, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := listenPacketConn("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0}, config)
+	if err != nil {
+		return nil, err
+	}
+	return DialContext(ctx, udpConn, udpAddr, addr, tlsConf, config)
+}
+
+// DialAddrEarly establishes a new QUIC connection to a server, see DialEarly.
+// The hostname for SNI is taken from the given address.
+// Config.HappyEyeballs is not supported.
+func DialAddrEarly(addr string, tlsConf *tls.Config, config *Config) (EarlySession, error) {
+	udpAddr, err := resolveUDPAddr(context.Background(), addr, config)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := listenPacketConn("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0}, config)
+	if err != nil {
+		return nil, err
+	}
+	return DialEarly(udpConn, udpAddr, addr, tlsConf, config)
+}
+
+// resolveUDPAddr resolves the address using the Config.Resolver.
+// Like net.ResolveUDPAddr, it prefers IPv4 addresses.
+func resolveUDPAddr(ctx context.Context, addr string, config *Config) (*net.UDPAddr, error) {
+	if config == nil || config.Resolver == nil {
+		return net.ResolveUDPAddr("udp", addr)
+	}
+	host, port, err := splitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := config.Resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP addresses found for %s", host)
+	}
+	ip := ips[0]
+	for _, a := range ips {
+		if a.IP.To4() != nil {
+			ip = a
+			break
+		}
+	}
+	return &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}, nil
+}
+
+func splitHostPort(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := net.LookupPort("udp", portStr)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, port, nil
+}
+
+// listenPacketConn creates the net.PacketConn used by DialAddr, using the Config.DialPacketConn.
+func listenPacketConn(network string, laddr *net.UDPAddr, config *Config) (net.PacketConn, error) {
+	if config != nil && config.DialPacketConn != nil {
+		return config.DialPacketConn(network, laddr.String())
+	}
+	conn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+type happyEyeballsResult struct {
+	conn net.PacketConn
+	sess Session
+	err  error
+}
+
+// dialAddrHappyEyeballs resolves the address, and races connection attempts to the IPv6 and the IPv4 address.
+// The IPv6 attempt is started first, and given a head start of Config.PreferIPv6Delay.
+func dialAddrHappyEyeballs(ctx context.Context, addr string, tlsConf *tls.Config, config *Config) (Session, error) {
+	host, port, err := splitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
-	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	lookup := lookupIPAddr
+	if config.Resolver != nil {
+		lookup = config.Resolver.LookupIPAddr
+	}
+	ips, err := lookup(ctx, host)
 	if err != nil {
 		return nil, err
 	}
-	return Dial(udpConn, udpAddr, addr, tlsConf, config)
+	var ipv6Addr, ipv4Addr *net.UDPAddr
+	for _, ip := range ips {
+		if ip.IP.To4() != nil {
+			if ipv4Addr == nil {
+				ipv4Addr = &net.UDPAddr{IP: ip.IP, Port: port}
+			}
+		} else if ipv6Addr == nil {
+			ipv6Addr = &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}
+		}
+	}
+	if ipv6Addr == nil && ipv4Addr == nil {
+		return nil, fmt.Errorf("no IP addresses found for %s", host)
+	}
+
+	results := make(chan happyEyeballsResult, 2)
+	var conns []net.PacketConn
+	dial := func(remoteAddr *net.UDPAddr) {
+		network, localIP := "udp4", net.IPv4zero
+		if remoteAddr.IP.To4() == nil {
+			network, localIP = "udp6", net.IPv6zero
+		}
+		udpConn, err := listenPacketConn(network, &net.UDPAddr{IP: localIP, Port: 0}, config)
+		if err != nil {
+			results <- happyEyeballsResult{err: err}
+			return
+		}
+		conns = append(conns, udpConn)
+		go func() {
+			sess, err := dialHappyEyeballsAttempt(ctx, udpConn, remoteAddr, addr, tlsConf, config)
+			results <- happyEyeballsResult{conn: udpConn, sess: sess, err: err}
+		}()
+	}
+
+	// if the hostname only resolves to addresses of one family, there's nothing to race
+	if ipv6Addr == nil || ipv4Addr == nil {
+		remoteAddr := ipv6Addr
+		if remoteAddr == nil {
+			remoteAddr = ipv4Addr
+		}
+		dial(remoteAddr)
+		res := <-results
+		return res.sess, res.err
+	}
+
+	dial(ipv6Addr)
+	timer := time.NewTimer(populateClientConfig(config).PreferIPv6Delay)
+	defer timer.Stop()
+	var ipv4Started bool
+	numAttempts := 1
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if !ipv4Started {
+				ipv4Started = true
+				numAttempts++
+				dial(ipv4Addr)
+			}
+		case res := <-results:
+			numAttempts--
+			if res.err == nil {
+				if numAttempts > 0 {
+					// abort the other connection attempt
+					for _, c := range conns {
+						if c != res.conn {
+							c.Close()
+						}
+					}
+					go func() {
+						if res := <-results; res.err == nil {
+							res.sess.Close(nil)
+						}
+					}()
+				}
+				return res.sess, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			// the IPv6 attempt failed. Don't wait for the timer to start the IPv4 attempt.
+			if !ipv4Started {
+				ipv4Started = true
+				numAttempts++
+				dial(ipv4Addr)
+				continue
+			}
+			if numAttempts == 0 {
+				return nil, firstErr
+			}
+		}
+	}
 }
 
 // Dial establishes a new QUIC connection to a server using a net.PacketConn.
@@ -72,15 +279,93 @@ func Dial(
 	tlsConf *tls.Config,
 	config *Config,
 ) (Session, error) {
+	return DialContext(context.Background(), pconn, remoteAddr, host, tlsConf, config)
+}
+
+// DialContext establishes a new QUIC connection to a server using a net.PacketConn using the provided context.
+// If the context is canceled before the handshake completes, the connection attempt is aborted,
+// and the context's error is returned.
+// The host parameter is used for SNI.
+func DialContext(
+	ctx context.Context,
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+) (Session, error) {
+	sess, err := dialContext(ctx, pconn, remoteAddr, host, tlsConf, config, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// DialEarly establishes a new QUIC connection to a server using a net.PacketConn.
+// If the Config.ClientSessionCache contains the state of a previous connection to this server,
+// the session is returned right away, and data can be sent using 0-RTT.
+// The state is cached for the host and the port of the server.
+// Otherwise, the session is returned when the handshake completes, just like with Dial.
+// If the server rejects the 0-RTT data, it is retransmitted after the handshake completed.
+// 0-RTT requires that the server supports the first QUIC version in Config.Versions.
+// If it doesn't, the session is closed when the server sends a Version Negotiation packet.
+// The host parameter is used for SNI.
+func DialEarly(
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+) (EarlySession, error) {
+	sess, err := dialContext(context.Background(), pconn, remoteAddr, host, tlsConf, config, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func dialContext(
+	ctx context.Context,
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+	early bool,
+	transport *Transport,
+) (packetHandler, error) {
 	clientConfig := populateClientConfig(config)
+	if transport != nil {
+		if clientConfig.RequestConnectionIDOmission {
+			return nil, errors.New("connection ID omission can't be requested when using a Transport")
+		}
+		if err := transport.configureConnectionIDs(clientConfig, config != nil && config.ConnectionIDGenerator != nil); err != nil {
+			return nil, err
+		}
+	}
+	// clients can use zero-length connection IDs
+	if clientConfig.ConnectionIDLength != 0 {
+		if err := validateConnectionIDLength(clientConfig.ConnectionIDLength); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateStreamScheduler(clientConfig.StreamScheduler); err != nil {
+		return nil, err
+	}
+	if err := validateCongestionControl(clientConfig.CongestionControl); err != nil {
+		return nil, err
+	}
+	if err := validateTLSStack(clientConfig.TLSStack); err != nil {
+		return nil, err
+	}
 	version := clientConfig.Versions[0]
-	srcConnID, err := generateConnectionID()
+	srcConnID, err := generateSrcConnectionID(clientConfig, version)
 	if err != nil {
 		return nil, err
 	}
 	destConnID := srcConnID
 	if version.UsesTLS() {
-		destConnID, err = generateConnectionID()
+		destConnID, err = generateConnectionID(getInitialDestConnectionIDLength(clientConfig))
 		if err != nil {
 			return nil, err
 		}
@@ -114,12 +399,14 @@ func Dial(
 		config:                 clientConfig,
 		version:                version,
 		versionNegotiationChan: make(chan struct{}),
-		logger:                 utils.DefaultLogger,
+		early:                  early,
+		transport:              transport,
+		logger:                 newLogger(clientConfig, protocol.PerspectiveClient),
 	}
 
 	c.logger.Infof("Starting new connection to %s (%s -> %s), source connection ID %s, destination connection ID %s, version %s", hostname, c.conn.LocalAddr(), c.conn.RemoteAddr(), c.srcConnID, c.destConnID, c.version)
 
-	if err := c.dial(); err != nil {
+	if err := c.dial(ctx); err != nil {
 		return nil, err
 	}
 	return c.session, nil
@@ -144,15 +431,40 @@ func populateClientConfig(config *Config) *Config {
 	if config.IdleTimeout != 0 {
 		idleTimeout = config.IdleTimeout
 	}
+	maxHandshakePackets := protocol.DefaultMaxHandshakePackets
+	if config.MaxHandshakePackets > 0 {
+		maxHandshakePackets = config.MaxHandshakePackets
+	}
+	connIDLen := config.ConnectionIDLength
+	if connIDLen == 0 {
+		connIDLen = protocol.DefaultConnectionIDLength
+	}
+	connIDGenerator := config.ConnectionIDGenerator
+	if connIDGenerator != nil {
+		connIDLen = connIDGenerator.ConnectionIDLen()
+	} else {
+		connIDGenerator = &randomConnIDGenerator{connIDLen: connIDLen}
+	}
 
-	maxReceiveStreamFlowControlWindow := config.MaxReceiveStreamFlowControlWindow
-	if maxReceiveStreamFlowControlWindow == 0 {
-		maxReceiveStreamFlowControlWindow = protocol.DefaultMaxReceiveStreamFlowControlWindowClient
+	initialStreamReceiveWindow := config.InitialStreamReceiveWindow
+	if initialStreamReceiveWindow == 0 {
+		initialStreamReceiveWindow = protocol.ReceiveStreamFlowControlWindow
+	}
+	maxStreamReceiveWindow := config.MaxStreamReceiveWindow
+	if maxStreamReceiveWindow == 0 {
+		maxStreamReceiveWindow = protocol.DefaultMaxReceiveStreamFlowControlWindowClient
 	}
-	maxReceiveConnectionFlowControlWindow := config.MaxReceiveConnectionFlowControlWindow
-	if maxReceiveConnectionFlowControlWindow == 0 {
-		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindowClient
+	// the window can't be auto-tuned below its initial size
+	maxStreamReceiveWindow = utils.MaxUint64(maxStreamReceiveWindow, initialStreamReceiveWindow)
+	initialConnectionReceiveWindow := config.InitialConnectionReceiveWindow
+	if initialConnectionReceiveWindow == 0 {
+		initialConnectionReceiveWindow = protocol.ReceiveConnectionFlowControlWindow
 	}
+	maxConnectionReceiveWindow := config.MaxConnectionReceiveWindow
+	if maxConnectionReceiveWindow == 0 {
+		maxConnectionReceiveWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindowClient
+	}
+	maxConnectionReceiveWindow = utils.MaxUint64(maxConnectionReceiveWindow, initialConnectionReceiveWindow)
 	maxIncomingStreams := config.MaxIncomingStreams
 	if maxIncomingStreams == 0 {
 		maxIncomingStreams = protocol.DefaultMaxIncomingStreams
@@ -165,73 +477,185 @@ func populateClientConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	maxUndecryptablePackets := config.MaxUndecryptablePackets
+	if maxUndecryptablePackets == 0 {
+		maxUndecryptablePackets = protocol.MaxUndecryptablePackets
+	}
+	undecryptablePacketTimeout := config.UndecryptablePacketTimeout
+	if undecryptablePacketTimeout == 0 {
+		undecryptablePacketTimeout = protocol.DefaultUndecryptablePacketTimeout
+	}
+
+	maxPacketSize := config.MaxPacketSize
+	if maxPacketSize == 0 || maxPacketSize > uint64(protocol.MaxReceivePacketSize) {
+		maxPacketSize = uint64(protocol.MaxReceivePacketSize)
+	} else if maxPacketSize < protocol.MinInitialPacketSize {
+		maxPacketSize = protocol.MinInitialPacketSize
+	}
+
+	keyUpdateInterval := config.KeyUpdateInterval
+	if keyUpdateInterval == 0 {
+		keyUpdateInterval = protocol.DefaultKeyUpdateInterval
+	}
+	maxAckDelay := config.MaxAckDelay
+	if maxAckDelay == 0 {
+		maxAckDelay = protocol.DefaultMaxAckDelay
+	} else if maxAckDelay > protocol.MaxMaxAckDelay {
+		maxAckDelay = protocol.MaxMaxAckDelay
+	}
+	preferIPv6Delay := config.PreferIPv6Delay
+	if preferIPv6Delay == 0 {
+		preferIPv6Delay = protocol.HappyEyeballsDelay
+	}
 
 	return &Config{
-		Versions:                              versions,
-		HandshakeTimeout:                      handshakeTimeout,
-		IdleTimeout:                           idleTimeout,
-		RequestConnectionIDOmission:           config.RequestConnectionIDOmission,
-		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
-		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
-		MaxIncomingStreams:                    maxIncomingStreams,
-		MaxIncomingUniStreams:                 maxIncomingUniStreams,
-		KeepAlive:                             config.KeepAlive,
+		Versions:                       versions,
+		HandshakeTimeout:               handshakeTimeout,
+		IdleTimeout:                    idleTimeout,
+		MaxHandshakePackets:            maxHandshakePackets,
+		ConnectionIDLength:             connIDLen,
+		ConnectionIDGenerator:          connIDGenerator,
+		RequestConnectionIDOmission:    config.RequestConnectionIDOmission,
+		InitialStreamReceiveWindow:     initialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         maxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: initialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     maxConnectionReceiveWindow,
+		ManualFlowControlCreditRelease: config.ManualFlowControlCreditRelease,
+		MaxIncomingStreams:             maxIncomingStreams,
+		MaxIncomingUniStreams:          maxIncomingUniStreams,
+		MaxUndecryptablePackets:        maxUndecryptablePackets,
+		UndecryptablePacketTimeout:     undecryptablePacketTimeout,
+		KeepAlive:                      config.KeepAlive,
+		KeepAlivePeriod:                config.KeepAlivePeriod,
+		CloseOnOversizedPackets:        config.CloseOnOversizedPackets,
+		HappyEyeballs:                  config.HappyEyeballs,
+		PreferIPv6Delay:                preferIPv6Delay,
+		Resolver:                       config.Resolver,
+		DialPacketConn:                 config.DialPacketConn,
+		SessionContext:                 config.SessionContext,
+		OnCongestionEvent:              config.OnCongestionEvent,
+		StreamScheduler:                config.StreamScheduler,
+		StreamWeight:                   config.StreamWeight,
+		CongestionControl:              config.CongestionControl,
+		CongestionControllerFactory:    config.CongestionControllerFactory,
+		InitialPacingRate:              config.InitialPacingRate,
+		MaxPacingBurst:                 config.MaxPacingBurst,
+		MaxAckDelay:                    maxAckDelay,
+		PacketsPerAck:                  config.PacketsPerAck,
+		ImmediateAckOnReordering:       config.ImmediateAckOnReordering,
+		EnableDatagrams:                config.EnableDatagrams,
+		DisableECN:                     config.DisableECN,
+		MaxPacketSize:                  maxPacketSize,
+		DisablePathMTUDiscovery:        config.DisablePathMTUDiscovery,
+		KeyUpdateInterval:              keyUpdateInterval,
+		TLSStack:                       config.TLSStack,
+		GetLogWriter:                   config.GetLogWriter,
+		Tracer:                         config.Tracer,
+		Logger:                         config.Logger,
+		ClientSessionCache:             config.ClientSessionCache,
+		TokenStore:                     config.TokenStore,
+	}
+}
+
+// generateSrcConnectionID generates the connection ID that the client uses for itself.
+// For IETF QUIC, it is generated by the ConnectionIDGenerator.
+func generateSrcConnectionID(config *Config, v protocol.VersionNumber) (protocol.ConnectionID, error) {
+	if !v.UsesTLS() {
+		return generateConnectionID(protocol.ConnectionIDLenGQUIC)
+	}
+	c, err := config.ConnectionIDGenerator.GenerateConnectionID()
+	if err != nil {
+		return nil, err
+	}
+	if c.Len() != config.ConnectionIDLength {
+		return nil, fmt.Errorf("connection ID generator returned a %d byte connection ID (expected %d bytes)", c.Len(), config.ConnectionIDLength)
+	}
+	return c, nil
+}
+
+// getInitialDestConnectionIDLength returns the length of the destination connection ID of the first IETF QUIC packet.
+// The server uses this connection ID for the session, so it must match the server's connection ID length.
+// Clients that use zero-length connection IDs for themselves use the default length.
+func getInitialDestConnectionIDLength(config *Config) int {
+	if config.ConnectionIDLength == 0 {
+		return protocol.DefaultConnectionIDLength
 	}
+	return config.ConnectionIDLength
 }
 
-func (c *client) dial() error {
+func (c *client) dial(ctx context.Context) error {
 	var err error
 	if c.version.UsesTLS() {
-		err = c.dialTLS()
+		err = c.dialTLS(ctx)
 	} else {
-		err = c.dialGQUIC()
+		err = c.dialGQUIC(ctx)
 	}
 	if err == errCloseSessionForNewVersion {
-		return c.dial()
+		return c.dial(ctx)
 	}
 	return err
 }
 
-func (c *client) dialGQUIC() error {
+func (c *client) dialGQUIC(ctx context.Context) error {
 	if err := c.createNewGQUICSession(); err != nil {
 		return err
 	}
-	go c.listen()
-	return c.establishSecureConnection()
+	c.startListening()
+	return c.establishSecureConnection(ctx)
 }
 
-func (c *client) dialTLS() error {
+func (c *client) dialTLS(ctx context.Context) error {
 	params := &handshake.TransportParameters{
-		StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
+		StreamFlowControlWindow:     protocol.ByteCount(c.config.InitialStreamReceiveWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(c.config.InitialConnectionReceiveWindow),
 		IdleTimeout:                 c.config.IdleTimeout,
 		OmitConnectionID:            c.config.RequestConnectionIDOmission,
 		MaxBidiStreams:              uint16(c.config.MaxIncomingStreams),
 		MaxUniStreams:               uint16(c.config.MaxIncomingUniStreams),
+		MaxAckDelay:                 c.config.MaxAckDelay,
+	}
+	if c.config.EnableDatagrams {
+		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
 	}
 	csc := handshake.NewCryptoStreamConn(nil)
 	extHandler := handshake.NewExtensionHandlerClient(params, c.initialVersion, c.config.Versions, c.version, c.logger)
-	mintConf, err := tlsToMintConfig(c.tlsConf, protocol.PerspectiveClient)
-	if err != nil {
-		return err
+	if c.config.TLSStack == TLSStackStandardLibrary {
+		var tlsConf *tls.Config
+		if c.tlsConf != nil {
+			tlsConf = c.tlsConf.Clone()
+		} else {
+			tlsConf = &tls.Config{}
+		}
+		tlsConf.ServerName = c.hostname
+		if tlsConf.ClientSessionCache == nil && c.config.ClientSessionCache != nil {
+			tlsConf.ClientSessionCache = &tlsSessionCache{cache: newServerSessionCache(c.config.ClientSessionCache, c.conn.RemoteAddr())}
+		}
+		c.tls = newStdlibTLSController(csc, tlsConf, extHandler, protocol.PerspectiveClient, c.logger)
+	} else {
+		mintConf, err := tlsToMintConfig(c.tlsConf, protocol.PerspectiveClient)
+		if err != nil {
+			return err
+		}
+		mintConf.ExtensionHandler = extHandler
+		mintConf.ServerName = c.hostname
+		c.tls = newMintController(csc, mintConf, c.tlsConf, protocol.PerspectiveClient)
 	}
-	mintConf.ExtensionHandler = extHandler
-	mintConf.ServerName = c.hostname
-	c.tls = newMintController(csc, mintConf, protocol.PerspectiveClient)
 
 	if err := c.createNewTLSSession(extHandler.GetPeerParams(), c.version); err != nil {
 		return err
 	}
-	go c.listen()
-	if err := c.establishSecureConnection(); err != nil {
+	c.startListening()
+	if err := c.establishSecureConnection(ctx); err != nil {
 		if err != handshake.ErrCloseSessionForRetry {
 			return err
 		}
+		// The session is only returned to the application after the handshake completes,
+		// so no application data was sent on the old session. There's no 0-RTT data to retransmit.
 		c.logger.Infof("Received a Retry packet. Recreating session.")
 		if err := c.createNewTLSSession(extHandler.GetPeerParams(), c.version); err != nil {
 			return err
 		}
-		if err := c.establishSecureConnection(); err != nil {
+		if err := c.establishSecureConnection(ctx); err != nil {
 			return err
 		}
 	}
@@ -242,9 +666,11 @@ func (c *client) dialTLS() error {
 // It returns:
 // - errCloseSessionForNewVersion when the server sends a version negotiation packet
 // - handshake.ErrCloseSessionForRetry when the server performs a stateless retry (for IETF QUIC)
+// - the context's error, if the context is canceled. The session is closed in that case.
 // - any other error that might occur
 // - when the connection is secure (for gQUIC), or forward-secure (for IETF QUIC)
-func (c *client) establishSecureConnection() error {
+// - when dialing using DialEarly: as soon as the session can be used to send data
+func (c *client) establishSecureConnection(ctx context.Context) error {
 	var runErr error
 	errorChan := make(chan struct{})
 	go func() {
@@ -252,66 +678,135 @@ func (c *client) establishSecureConnection() error {
 		close(errorChan)
 		c.logger.Infof("Connection %s closed.", c.srcConnID)
 		if runErr != handshake.ErrCloseSessionForRetry && runErr != errCloseSessionForNewVersion {
-			c.conn.Close()
+			c.closeConn()
 		}
 	}()
 
-	// wait until the server accepts the QUIC version (or an error occurs)
-	select {
-	case <-errorChan:
-		return runErr
-	case <-c.versionNegotiationChan:
+	var earlySessionReady <-chan struct{}
+	if c.early {
+		// Waiting for the server to accept the QUIC version would take a round trip.
+		earlySessionReady = c.session.earlySessionReadyStatus()
+	} else {
+		// wait until the server accepts the QUIC version (or an error occurs)
+		select {
+		case <-errorChan:
+			return runErr
+		case <-ctx.Done():
+			return c.abortSecureConnection(ctx.Err(), errorChan)
+		case <-c.versionNegotiationChan:
+		}
 	}
 
 	select {
 	case <-errorChan:
 		return runErr
+	case <-ctx.Done():
+		return c.abortSecureConnection(ctx.Err(), errorChan)
 	case err := <-c.session.handshakeStatus():
 		return err
+	case <-earlySessionReady:
+		return nil
 	}
 }
 
-// Listen listens on the underlying connection and passes packets on for handling.
-// It returns when the connection is closed.
-func (c *client) listen() {
-	var err error
+// abortSecureConnection closes the session, and waits until the run loop returned
+func (c *client) abortSecureConnection(err error, runLoopDone <-chan struct{}) error {
+	c.logger.Infof("Aborting connection attempt: %s", err)
+	c.session.Close(err)
+	<-runLoopDone
+	return err
+}
+
+// startListening starts passing packets received on the connection to the client.
+// When using a Transport, the Transport's read loop passes packets for our connection ID to the client.
+func (c *client) startListening() {
+	if c.transport != nil {
+		c.transport.addClient(c.srcConnID, c)
+		return
+	}
+	go c.listen(c.conn)
+}
+
+// closeConn closes the connection after the session was closed.
+// The connection of a Transport is shared with other sessions, so it is not closed.
+func (c *client) closeConn() {
+	if c.transport != nil {
+		c.transport.removeClient(c.srcConnID)
+		return
+	}
+	c.conn.Close()
+}
+
+// closeSession closes the session when reading from the connection failed
+func (c *client) closeSession(err error) {
+	c.mutex.Lock()
+	if c.session != nil {
+		c.session.Close(err)
+	}
+	c.mutex.Unlock()
+}
 
+// handleStatelessReset checks if a packet that was received for an unknown connection ID is a stateless reset for this session.
+// It is used by the Transport, since stateless resets use a random connection ID.
+func (c *client) handleStatelessReset(packet []byte) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.version.UsesTLS() || c.session == nil || !c.session.handleStatelessReset(packet) {
+		return false
+	}
+	c.logger.Infof("Received a stateless reset")
+	return true
+}
+
+// Listen listens on a connection and passes packets on for handling.
+// It returns when the connection is closed.
+// When migrating to a new connection, the session starts listening on the new connection.
+func (c *client) listen(conn connection) {
+	r := newPacketReader(conn.PacketConn())
 	for {
-		var n int
-		var addr net.Addr
-		data := *getPacketBuffer()
-		data = data[:protocol.MaxReceivePacketSize]
-		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
-		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, addr, err = c.conn.Read(data)
+		data, addr, ecn, err := r.ReadPacket()
 		if err != nil {
 			if !strings.HasSuffix(err.Error(), "use of closed network connection") {
-				c.mutex.Lock()
-				if c.session != nil {
-					c.session.Close(err)
-				}
-				c.mutex.Unlock()
+				c.closeSession(err)
 			}
 			break
 		}
-		if err := c.handlePacket(addr, data[:n]); err != nil {
+		passedOn, err := c.handlePacket(addr, data, ecn)
+		if err != nil {
 			c.logger.Errorf("error handling packet: %s", err.Error())
 		}
+		if !passedOn {
+			putPacketBuffer(&data)
+		}
+	}
+}
+
+// handleCoalescedPacket handles a packet that was coalesced with the preceding packets into a single UDP datagram.
+func (c *client) handleCoalescedPacket(remoteAddr net.Addr, data []byte, ecn protocol.ECN) {
+	passedOn, err := c.handlePacket(remoteAddr, data, ecn)
+	if err != nil {
+		c.logger.Debugf("error handling coalesced packet: %s", err.Error())
+	}
+	if !passedOn {
+		putPacketBuffer(&data)
 	}
 }
 
-func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) error {
+// handlePacket handles a packet received from the server.
+// If the packet was passed on to the session, the session takes over the packet buffer.
+// Otherwise, the caller is responsible for returning it to the buffer pool.
+func (c *client) handlePacket(remoteAddr net.Addr, packet []byte, ecn protocol.ECN) (bool /* passed on to the session */, error) {
 	rcvTime := time.Now()
 
 	r := bytes.NewReader(packet)
-	hdr, err := wire.ParseHeaderSentByServer(r, c.version)
+	hdr, err := wire.ParseHeaderSentByServer(r, c.version, c.srcConnID.Len())
 	// drop the packet if we can't parse the header
 	if err != nil {
-		return fmt.Errorf("error parsing packet from %s: %s", remoteAddr.String(), err.Error())
+		return false, fmt.Errorf("error parsing packet from %s: %s", remoteAddr.String(), err.Error())
 	}
 	// reject packets with truncated connection id if we didn't request truncation
 	if hdr.OmitConnectionID && !c.config.RequestConnectionIDOmission {
-		return errors.New("received packet with truncated connection ID, but didn't request truncation")
+		return false, errors.New("received packet with truncated connection ID, but didn't request truncation")
 	}
 	hdr.Raw = packet[:len(packet)-r.Len()]
 	packetData := packet[len(packet)-r.Len():]
@@ -319,19 +814,37 @@ func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) error {
 	if hdr.IsLongHeader {
 		c.logger.Debugf("len(packet data): %d, payloadLen: %d", len(packetData), hdr.PayloadLen)
 		if protocol.ByteCount(len(packetData)) < hdr.PayloadLen {
-			return fmt.Errorf("packet payload (%d bytes) is smaller than the expected payload length (%d bytes)", len(packetData), hdr.PayloadLen)
+			return false, fmt.Errorf("packet payload (%d bytes) is smaller than the expected payload length (%d bytes)", len(packetData), hdr.PayloadLen)
+		}
+		// The UDP datagram might contain more packets after this one.
+		// They are handled after this packet, when the mutex was released.
+		if coalesced := packetData[hdr.PayloadLen:]; len(coalesced) > 0 {
+			data := copyToPacketBuffer(coalesced)
+			defer c.handleCoalescedPacket(remoteAddr, data, ecn)
 		}
 		packetData = packetData[:int(hdr.PayloadLen)]
-		// TODO(#1312): implement parsing of compound packets
 	}
 
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	// Stateless resets use a random connection ID, so they have to be detected before checking the connection ID.
+	if !hdr.IsLongHeader && c.version.UsesTLS() && c.session.handleStatelessReset(packet) {
+		c.logger.Infof("Received a stateless reset")
+		return false, nil
+	}
+
 	// reject packets with the wrong connection ID
-	// TODO(#1003): add support for server-chosen connection IDs
-	if !hdr.OmitConnectionID && !hdr.DestConnectionID.Equal(c.srcConnID) {
-		return fmt.Errorf("received a packet with an unexpected connection ID (%s, expected %s)", hdr.DestConnectionID, c.srcConnID)
+	if !hdr.OmitConnectionID && !c.isOwnConnectionID(hdr.DestConnectionID) {
+		return false, fmt.Errorf("received a packet with an unexpected connection ID (%s, expected %s)", hdr.DestConnectionID, c.srcConnID)
+	}
+
+	if protocol.ByteCount(len(packet)) > protocol.MaxReceivePacketSize {
+		err := qerr.Error(qerr.PacketTooLarge, fmt.Sprintf("received a packet larger than %d bytes", protocol.MaxReceivePacketSize))
+		if c.config.CloseOnOversizedPackets {
+			c.session.Close(err)
+		}
+		return false, err
 	}
 
 	if hdr.ResetFlag {
@@ -339,29 +852,37 @@ func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) error {
 		// check if the remote address and the connection ID match
 		// otherwise this might be an attacker trying to inject a PUBLIC_RESET to kill the connection
 		if cr.Network() != remoteAddr.Network() || cr.String() != remoteAddr.String() || !hdr.DestConnectionID.Equal(c.srcConnID) {
-			return errors.New("Received a spoofed Public Reset")
+			return false, errors.New("Received a spoofed Public Reset")
 		}
 		pr, err := wire.ParsePublicReset(r)
 		if err != nil {
-			return fmt.Errorf("Received a Public Reset. An error occurred parsing the packet: %s", err)
+			return false, fmt.Errorf("Received a Public Reset. An error occurred parsing the packet: %s", err)
 		}
 		c.session.closeRemote(qerr.Error(qerr.PublicReset, fmt.Sprintf("Received a Public Reset for packet number %#x", pr.RejectedPacketNumber)))
 		c.logger.Infof("Received Public Reset, rejected packet number: %#x", pr.RejectedPacketNumber)
-		return nil
+		return false, nil
 	}
 
 	// handle Version Negotiation Packets
 	if hdr.IsVersionNegotiation {
 		// ignore delayed / duplicated version negotiation packets
-		if c.receivedVersionNegotiationPacket || c.versionNegotiated {
-			return errors.New("received a delayed Version Negotiation Packet")
+		if c.receivedVersionNegotiationPacket {
+			c.traceIgnoredVersionNegotiation()
+			return false, errors.New("received a delayed Version Negotiation Packet")
+		}
+		// We already received a packet from the server, so it supports the version we offered.
+		// This Version Negotiation Packet was either reordered, or it was spoofed.
+		// Acting on it would allow an off-path attacker to tear down the connection.
+		if c.versionNegotiated {
+			c.traceIgnoredVersionNegotiation()
+			return false, errors.New("received a Version Negotiation Packet after the server accepted our version")
 		}
 
 		// version negotiation packets have no payload
 		if err := c.handleVersionNegotiationPacket(hdr); err != nil {
 			c.session.Close(err)
 		}
-		return nil
+		return false, nil
 	}
 
 	// this is the first packet we are receiving
@@ -378,8 +899,9 @@ func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) error {
 		header:     hdr,
 		data:       packetData,
 		rcvTime:    rcvTime,
+		ecn:        ecn,
 	})
-	return nil
+	return true, nil
 }
 
 func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
@@ -388,6 +910,7 @@ func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
 			// the version negotiation packet contains the version that we offered
 			// this might be a packet sent by an attacker (or by a terribly broken server implementation)
 			// ignore it
+			c.traceIgnoredVersionNegotiation()
 			return nil
 		}
 	}
@@ -396,7 +919,10 @@ func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
 
 	newVersion, ok := protocol.ChooseSupportedVersion(c.config.Versions, hdr.SupportedVersions)
 	if !ok {
-		return qerr.InvalidVersion
+		return &qerr.VersionNegotiationError{
+			Ours:   c.config.Versions,
+			Theirs: hdr.SupportedVersions,
+		}
 	}
 	c.receivedVersionNegotiationPacket = true
 	c.negotiatedVersions = hdr.SupportedVersions
@@ -404,20 +930,45 @@ func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
 	// switch to negotiated version
 	c.initialVersion = c.version
 	c.version = newVersion
+	oldSrcConnID := c.srcConnID
 	var err error
-	c.destConnID, err = generateConnectionID()
-	if err != nil {
-		return err
-	}
 	// in gQUIC, there's only one connection ID
 	if !c.version.UsesTLS() {
+		c.destConnID, err = generateConnectionID(protocol.ConnectionIDLenGQUIC)
+		if err != nil {
+			return err
+		}
 		c.srcConnID = c.destConnID
+	} else {
+		c.destConnID, err = generateConnectionID(getInitialDestConnectionIDLength(c.config))
+		if err != nil {
+			return err
+		}
+		// only generate a new source connection ID if we're switching from gQUIC to IETF QUIC
+		if !c.initialVersion.UsesTLS() {
+			c.srcConnID, err = generateSrcConnectionID(c.config, c.version)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// the new connection ID is registered with the Transport when the new session is created
+	if c.transport != nil && !c.srcConnID.Equal(oldSrcConnID) {
+		c.transport.removeClient(oldSrcConnID)
 	}
 	c.logger.Infof("Switching to QUIC version %s. New connection ID: %s", newVersion, c.destConnID)
 	c.session.Close(errCloseSessionForNewVersion)
 	return nil
 }
 
+// traceIgnoredVersionNegotiation reports a Version Negotiation Packet that was ignored to the Tracer.
+// The connID is the connection ID that the session uses for the Tracer.
+func (c *client) traceIgnoredVersionNegotiation() {
+	if c.config.Tracer != nil {
+		c.config.Tracer.DroppedPacket(c.destConnID, PacketDropUnexpectedPacket)
+	}
+}
+
 func (c *client) createNewGQUICSession() (err error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -441,6 +992,11 @@ func (c *client) createNewTLSSession(
 ) (err error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	// Migrating a session would close the connection shared by the Transport.
+	listen := c.listen
+	if c.transport != nil {
+		listen = nil
+	}
 	c.session, err = newTLSClientSession(
 		c.conn,
 		c.hostname,
@@ -451,7 +1007,49 @@ func (c *client) createNewTLSSession(
 		c.tls,
 		paramsChan,
 		1,
+		listen,
+		c,
 		c.logger,
 	)
 	return err
 }
+
+func (c *client) addConnectionID(id protocol.ConnectionID, _ packetHandler) {
+	c.connIDsMutex.Lock()
+	if c.connIDs == nil {
+		c.connIDs = make(map[string]struct{})
+	}
+	c.connIDs[string(id)] = struct{}{}
+	c.connIDsMutex.Unlock()
+	if c.transport != nil {
+		c.transport.addClient(id, c)
+	}
+}
+
+func (c *client) retireConnectionID(id protocol.ConnectionID) {
+	c.connIDsMutex.Lock()
+	delete(c.connIDs, string(id))
+	c.connIDsMutex.Unlock()
+	if c.transport != nil {
+		c.transport.removeClient(id)
+	}
+}
+
+// getStatelessResetToken returns a random token.
+// The client never sends stateless resets, so the token doesn't need to be derived from the connection ID.
+func (c *client) getStatelessResetToken(protocol.ConnectionID) protocol.StatelessResetToken {
+	var token protocol.StatelessResetToken
+	_, _ = rand.Read(token[:])
+	return token
+}
+
+// isOwnConnectionID says if a connection ID identifies this connection
+func (c *client) isOwnConnectionID(id protocol.ConnectionID) bool {
+	if id.Equal(c.srcConnID) {
+		return true
+	}
+	c.connIDsMutex.Lock()
+	_, ok := c.connIDs[string(id)]
+	c.connIDsMutex.Unlock()
+	return ok
+}
@@ -0,0 +1,121 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// defaultClientSessionCacheCapacity is the capacity of a cache created by NewLRUClientSessionCache with a capacity < 1
+const defaultClientSessionCacheCapacity = 64
+
+// lruSessionCache is a ClientSessionCache that evicts the least recently used entry when it runs full.
+type lruSessionCache struct {
+	*lruCache
+}
+
+var _ ClientSessionCache = &lruSessionCache{}
+
+// NewLRUClientSessionCache returns a ClientSessionCache with the given capacity, that uses an LRU strategy.
+// If capacity is < 1, a default capacity is used instead.
+func NewLRUClientSessionCache(capacity int) ClientSessionCache {
+	if capacity < 1 {
+		capacity = defaultClientSessionCacheCapacity
+	}
+	return &lruSessionCache{lruCache: newLRUCache(capacity)}
+}
+
+// A serverSessionCache stores the state of the connections to a single server in a ClientSessionCache.
+// The hostname is used as the key by the crypto setup. Since multiple servers can run on the same host,
+// the port of the server is appended to it.
+type serverSessionCache struct {
+	cache ClientSessionCache
+	port  string
+}
+
+func newServerSessionCache(cache ClientSessionCache, remoteAddr net.Addr) *serverSessionCache {
+	_, port, err := net.SplitHostPort(remoteAddr.String())
+	if err != nil {
+		port = ""
+	}
+	return &serverSessionCache{cache: cache, port: port}
+}
+
+func (c *serverSessionCache) Get(host string) ([]byte, bool) {
+	return c.cache.Get(net.JoinHostPort(host, c.port))
+}
+
+func (c *serverSessionCache) Put(host string, state []byte) {
+	c.cache.Put(net.JoinHostPort(host, c.port), state)
+}
+
+// tlsSessionCachePrefix is prepended to the keys of the session tickets stored by the tlsSessionCache,
+// such that they don't collide with the gQUIC state cached for the same host.
+const tlsSessionCachePrefix = "tls|"
+
+// tlsSessionCache stores the session tickets that crypto/tls receives in a ClientSessionCache.
+// The tickets are serialized, such that the ClientSessionCache can persist them.
+type tlsSessionCache struct {
+	cache ClientSessionCache
+}
+
+var _ tls.ClientSessionCache = &tlsSessionCache{}
+
+func (c *tlsSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	data, ok := c.cache.Get(tlsSessionCachePrefix + sessionKey)
+	if !ok || len(data) == 0 {
+		return nil, false
+	}
+	ticket, state, err := parseTLSSessionState(data)
+	if err != nil {
+		return nil, false
+	}
+	cs, err := tls.NewResumptionState(ticket, state)
+	if err != nil {
+		return nil, false
+	}
+	return cs, true
+}
+
+// Put stores the session ticket.
+// crypto/tls puts a nil state to remove an entry. Since a ClientSessionCache can't remove entries, an empty state is stored instead.
+func (c *tlsSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if cs == nil {
+		c.cache.Put(tlsSessionCachePrefix+sessionKey, nil)
+		return
+	}
+	ticket, state, err := cs.ResumptionState()
+	if err != nil || state == nil {
+		return
+	}
+	stateData, err := state.Bytes()
+	if err != nil {
+		return
+	}
+	b := &bytes.Buffer{}
+	utils.WriteVarInt(b, uint64(len(ticket)))
+	b.Write(ticket)
+	b.Write(stateData)
+	c.cache.Put(tlsSessionCachePrefix+sessionKey, b.Bytes())
+}
+
+func parseTLSSessionState(data []byte) ([]byte, *tls.SessionState, error) {
+	r := bytes.NewReader(data)
+	l, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l > uint64(r.Len()) {
+		return nil, nil, errors.New("invalid session ticket length")
+	}
+	ticket := make([]byte, l)
+	r.Read(ticket)
+	state, err := tls.ParseSessionState(data[len(data)-r.Len():])
+	if err != nil {
+		return nil, nil, err
+	}
+	return ticket, state, nil
+}
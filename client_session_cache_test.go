@@ -0,0 +1,146 @@
+package quic
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client Session Cache", func() {
+	var cache ClientSessionCache
+
+	BeforeEach(func() {
+		cache = NewLRUClientSessionCache(2)
+	})
+
+	It("returns cached states", func() {
+		_, ok := cache.Get("foo")
+		Expect(ok).To(BeFalse())
+		cache.Put("foo", []byte("foobar"))
+		state, ok := cache.Get("foo")
+		Expect(ok).To(BeTrue())
+		Expect(state).To(Equal([]byte("foobar")))
+	})
+
+	It("replaces states", func() {
+		cache.Put("foo", []byte("foo"))
+		cache.Put("foo", []byte("bar"))
+		state, ok := cache.Get("foo")
+		Expect(ok).To(BeTrue())
+		Expect(state).To(Equal([]byte("bar")))
+	})
+
+	It("evicts the least recently used state", func() {
+		cache.Put("foo", []byte("foo"))
+		cache.Put("bar", []byte("bar"))
+		_, ok := cache.Get("foo")
+		Expect(ok).To(BeTrue())
+		cache.Put("baz", []byte("baz"))
+		_, ok = cache.Get("bar")
+		Expect(ok).To(BeFalse())
+		_, ok = cache.Get("foo")
+		Expect(ok).To(BeTrue())
+		_, ok = cache.Get("baz")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("uses a default capacity", func() {
+		cache = NewLRUClientSessionCache(0)
+		Expect(cache.(*lruSessionCache).capacity).To(Equal(defaultClientSessionCacheCapacity))
+	})
+})
+
+var _ = Describe("Server Session Cache", func() {
+	It("uses the host and the port of the server as the key", func() {
+		cache := NewLRUClientSessionCache(10)
+		c1 := newServerSessionCache(cache, &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 443})
+		c2 := newServerSessionCache(cache, &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 4433})
+		c1.Put("quic.clemente.io", []byte("foo"))
+		c2.Put("quic.clemente.io", []byte("bar"))
+		state, ok := cache.Get("quic.clemente.io:443")
+		Expect(ok).To(BeTrue())
+		Expect(state).To(Equal([]byte("foo")))
+		state, ok = c2.Get("quic.clemente.io")
+		Expect(ok).To(BeTrue())
+		Expect(state).To(Equal([]byte("bar")))
+		_, ok = c1.Get("quic.clemente.io:443")
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("TLS Session Cache", func() {
+	var (
+		cache      ClientSessionCache
+		tlsCache   *tlsSessionCache
+		serverConf *tls.Config
+	)
+
+	BeforeEach(func() {
+		cache = NewLRUClientSessionCache(2)
+		tlsCache = &tlsSessionCache{cache: cache}
+		// the server needs to use the same session ticket keys for all connections
+		serverConf = testdata.GetTLSConfig()
+	})
+
+	// handshake performs a TLS handshake, and waits for the session ticket sent by the server
+	handshake := func(clientConf *tls.Config) tls.ConnectionState {
+		cconn, sconn := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			server := tls.Server(sconn, serverConf)
+			Expect(server.Handshake()).To(Succeed())
+			_, err := server.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		client := tls.Client(cconn, clientConf)
+		Expect(client.Handshake()).To(Succeed())
+		// reading processes the session ticket, which is sent before the data
+		_, err := client.Read(make([]byte, 6))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(done).Should(BeClosed())
+		state := client.ConnectionState()
+		cconn.Close()
+		sconn.Close()
+		return state
+	}
+
+	It("stores session tickets, and uses them to resume sessions", func() {
+		conf := &tls.Config{
+			ServerName:         "quic.clemente.io",
+			InsecureSkipVerify: true,
+			ClientSessionCache: tlsCache,
+			// crypto/tls doesn't resume sessions if the certificate expired, which the test certificate did
+			Time: func() time.Time { return time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC) },
+		}
+		Expect(handshake(conf).DidResume).To(BeFalse())
+		data, ok := cache.Get("tls|quic.clemente.io")
+		Expect(ok).To(BeTrue())
+		Expect(data).ToNot(BeEmpty())
+		Expect(handshake(conf).DidResume).To(BeTrue())
+	})
+
+	It("doesn't return invalid states", func() {
+		cache.Put("tls|foo", []byte("foobar"))
+		_, ok := tlsCache.Get("foo")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("doesn't use the gQUIC state cached for the same host", func() {
+		cache.Put("foo", []byte("foobar"))
+		_, ok := tlsCache.Get("foo")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("removes states", func() {
+		cache.Put("tls|foo", []byte("foobar"))
+		tlsCache.Put("foo", nil)
+		_, ok := tlsCache.Get("foo")
+		Expect(ok).To(BeFalse())
+	})
+})
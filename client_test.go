@@ -2,9 +2,11 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"sync/atomic"
@@ -20,6 +22,12 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+type resolverFunc func(context.Context, string) ([]net.IPAddr, error)
+
+func (f resolverFunc) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return f(ctx, host)
+}
+
 var _ = Describe("Client", func() {
 	var (
 		cl         *client
@@ -77,11 +85,11 @@ var _ = Describe("Client", func() {
 	})
 
 	Context("Dialing", func() {
-		var origGenerateConnectionID func() (protocol.ConnectionID, error)
+		var origGenerateConnectionID func(int) (protocol.ConnectionID, error)
 
 		BeforeEach(func() {
 			origGenerateConnectionID = generateConnectionID
-			generateConnectionID = func() (protocol.ConnectionID, error) {
+			generateConnectionID = func(int) (protocol.ConnectionID, error) {
 				return connID, nil
 			}
 		})
@@ -122,6 +130,73 @@ var _ = Describe("Client", func() {
 			Eventually(dialed).Should(BeClosed())
 		})
 
+		It("uses the Config.Resolver and the Config.DialPacketConn", func() {
+			closeErr := errors.New("peer doesn't reply")
+			resolver := resolverFunc(func(_ context.Context, host string) ([]net.IPAddr, error) {
+				Expect(host).To(Equal("quic.clemente.io"))
+				return []net.IPAddr{{IP: net.IPv6loopback}, {IP: net.IPv4(127, 0, 0, 2)}}, nil
+			})
+			type listenParams struct{ network, laddr string }
+			listenChan := make(chan listenParams, 1)
+			config := &Config{
+				Resolver: resolver,
+				DialPacketConn: func(network, laddr string) (net.PacketConn, error) {
+					listenChan <- listenParams{network: network, laddr: laddr}
+					return packetConn, nil
+				},
+			}
+			remoteAddrChan := make(chan string)
+			newClientSession = func(
+				conn connection,
+				_ string,
+				_ protocol.VersionNumber,
+				_ protocol.ConnectionID,
+				_ *tls.Config,
+				_ *Config,
+				_ protocol.VersionNumber,
+				_ []protocol.VersionNumber,
+				_ utils.Logger,
+			) (packetHandler, error) {
+				Expect(conn.LocalAddr()).To(Equal(packetConn.addr))
+				remoteAddrChan <- conn.RemoteAddr().String()
+				return sess, nil
+			}
+			dialed := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := DialAddr("quic.clemente.io:1337", nil, config)
+				Expect(err).To(MatchError(closeErr))
+				close(dialed)
+			}()
+			Eventually(listenChan).Should(Receive(Equal(listenParams{network: "udp", laddr: "0.0.0.0:0"})))
+			// IPv4 addresses are preferred
+			Eventually(remoteAddrChan).Should(Receive(Equal("127.0.0.2:1337")))
+			sess.Close(closeErr)
+			Eventually(dialed).Should(BeClosed())
+		})
+
+		It("errors when the Config.Resolver doesn't return any addresses", func() {
+			resolver := resolverFunc(func(context.Context, string) ([]net.IPAddr, error) { return nil, nil })
+			_, err := DialAddr("quic.clemente.io:1337", nil, &Config{Resolver: resolver})
+			Expect(err).To(MatchError("no IP addresses found for quic.clemente.io"))
+		})
+
+		It("errors when the Config.Resolver fails", func() {
+			testErr := errors.New("no such host")
+			resolver := resolverFunc(func(context.Context, string) ([]net.IPAddr, error) { return nil, testErr })
+			_, err := DialAddrEarly("quic.clemente.io:1337", nil, &Config{Resolver: resolver})
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("errors when the Config.DialPacketConn fails", func() {
+			testErr := errors.New("cannot bind")
+			config := &Config{
+				DialPacketConn: func(string, string) (net.PacketConn, error) { return nil, testErr },
+			}
+			_, err := DialAddr("localhost:1337", nil, config)
+			Expect(err).To(MatchError(testErr))
+		})
+
 		It("uses the tls.Config.ServerName as the hostname, if present", func() {
 			closeErr := errors.New("peer doesn't reply")
 			hostnameChan := make(chan string)
@@ -151,6 +226,225 @@ var _ = Describe("Client", func() {
 			Eventually(dialed).Should(BeClosed())
 		})
 
+		Context("Happy Eyeballs", func() {
+			var (
+				origLookupIPAddr   func(context.Context, string) ([]net.IPAddr, error)
+				origDialAttempt    func(context.Context, net.PacketConn, net.Addr, string, *tls.Config, *Config) (Session, error)
+				ipv6Addr, ipv4Addr net.IPAddr
+			)
+
+			BeforeEach(func() {
+				origLookupIPAddr = lookupIPAddr
+				origDialAttempt = dialHappyEyeballsAttempt
+				ipv6Addr = net.IPAddr{IP: net.IPv6loopback}
+				ipv4Addr = net.IPAddr{IP: net.IPv4(127, 0, 0, 1)}
+				lookupIPAddr = func(_ context.Context, host string) ([]net.IPAddr, error) {
+					Expect(host).To(Equal("quic.clemente.io"))
+					return []net.IPAddr{ipv4Addr, ipv6Addr}, nil
+				}
+			})
+
+			AfterEach(func() {
+				lookupIPAddr = origLookupIPAddr
+				dialHappyEyeballsAttempt = origDialAttempt
+			})
+
+			// stall blocks until the connection is closed
+			stall := func(pconn net.PacketConn) error {
+				_, _, err := pconn.ReadFrom(make([]byte, 1))
+				return err
+			}
+
+			isIPv6 := func(addr net.Addr) bool {
+				return addr.(*net.UDPAddr).IP.To4() == nil
+			}
+
+			It("uses the IPv6 connection, if it completes the handshake first", func() {
+				remoteAddrs := make(chan net.Addr, 2)
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, host string, _ *tls.Config, _ *Config) (Session, error) {
+					Expect(host).To(Equal("quic.clemente.io:1337"))
+					remoteAddrs <- remoteAddr
+					return sess, nil
+				}
+				s, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Expect(remoteAddrs).To(Receive(Equal(&net.UDPAddr{IP: net.IPv6loopback, Port: 1337})))
+				Consistently(remoteAddrs, protocol.HappyEyeballsDelay+50*time.Millisecond).ShouldNot(Receive())
+			})
+
+			It("uses the IPv4 connection, if the IPv6 handshake stalls", func() {
+				ipv6Aborted := make(chan struct{})
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					if isIPv6(remoteAddr) {
+						err := stall(pconn)
+						close(ipv6Aborted)
+						return nil, err
+					}
+					return sess, nil
+				}
+				start := time.Now()
+				s, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Expect(time.Since(start)).To(BeNumerically(">=", protocol.HappyEyeballsDelay))
+				Eventually(ipv6Aborted).Should(BeClosed())
+			})
+
+			It("uses the IPv6 connection, if the IPv4 handshake stalls", func() {
+				ipv4Aborted := make(chan struct{})
+				ipv6Done := make(chan struct{})
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					if isIPv6(remoteAddr) {
+						<-ipv6Done
+						return sess, nil
+					}
+					close(ipv6Done) // complete the IPv6 handshake once the IPv4 attempt started
+					err := stall(pconn)
+					close(ipv4Aborted)
+					return nil, err
+				}
+				s, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Eventually(ipv4Aborted).Should(BeClosed())
+			})
+
+			It("uses the configured head start for the IPv6 connection attempt", func() {
+				delay := protocol.HappyEyeballsDelay / 5
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					if isIPv6(remoteAddr) {
+						return nil, stall(pconn)
+					}
+					return sess, nil
+				}
+				start := time.Now()
+				s, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true, PreferIPv6Delay: delay})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Expect(time.Since(start)).To(And(
+					BeNumerically(">=", delay),
+					BeNumerically("<", protocol.HappyEyeballsDelay),
+				))
+			})
+
+			It("closes the session of the slower connection attempt", func() {
+				msess, _ := newMockSession(nil, 0, connID, nil, nil, nil, nil)
+				ipv4Sess := msess.(*mockSession)
+				ipv4Started := make(chan struct{})
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					if isIPv6(remoteAddr) {
+						<-ipv4Started
+						return sess, nil
+					}
+					close(ipv4Started)
+					time.Sleep(10 * time.Millisecond) // make sure the IPv6 attempt wins
+					return ipv4Sess, nil
+				}
+				s, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Eventually(ipv4Sess.stopRunLoop).Should(BeClosed())
+				Expect(sess.closed).To(BeFalse())
+			})
+
+			It("starts the IPv4 connection attempt immediately, if the IPv6 attempt fails", func() {
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					if isIPv6(remoteAddr) {
+						return nil, errors.New("network unreachable")
+					}
+					return sess, nil
+				}
+				start := time.Now()
+				s, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Expect(time.Since(start)).To(BeNumerically("<", protocol.HappyEyeballsDelay))
+			})
+
+			It("returns the error of the IPv6 attempt, if both attempts fail", func() {
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					if isIPv6(remoteAddr) {
+						return nil, errors.New("IPv6 error")
+					}
+					return nil, errors.New("IPv4 error")
+				}
+				_, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).To(MatchError("IPv6 error"))
+			})
+
+			It("only dials IPv4, if the hostname doesn't resolve to an IPv6 address", func() {
+				lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+					return []net.IPAddr{ipv4Addr}, nil
+				}
+				remoteAddrs := make(chan net.Addr, 2)
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					remoteAddrs <- remoteAddr
+					return sess, nil
+				}
+				s, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Expect(remoteAddrs).To(Receive(Equal(&net.UDPAddr{IP: ipv4Addr.IP, Port: 1337})))
+				Expect(remoteAddrs).ToNot(Receive())
+			})
+
+			It("passes the context to the connection attempts", func() {
+				type ctxKey struct{}
+				ctx := context.WithValue(context.Background(), ctxKey{}, "foobar")
+				lookupIPAddr = func(c context.Context, _ string) ([]net.IPAddr, error) {
+					Expect(c.Value(ctxKey{})).To(Equal("foobar"))
+					return []net.IPAddr{ipv6Addr}, nil
+				}
+				dialHappyEyeballsAttempt = func(c context.Context, _ net.PacketConn, _ net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					Expect(c.Value(ctxKey{})).To(Equal("foobar"))
+					return sess, nil
+				}
+				s, err := DialAddrContext(ctx, "quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+			})
+
+			It("uses the Config.Resolver and the Config.DialPacketConn", func() {
+				lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+					Fail("didn't expect the default resolver to be used")
+					return nil, nil
+				}
+				resolver := resolverFunc(func(_ context.Context, host string) ([]net.IPAddr, error) {
+					Expect(host).To(Equal("quic.clemente.io"))
+					return []net.IPAddr{ipv4Addr, ipv6Addr}, nil
+				})
+				laddrs := make(chan string, 2)
+				config := &Config{
+					HappyEyeballs:   true,
+					PreferIPv6Delay: time.Millisecond,
+					Resolver:        resolver,
+					DialPacketConn: func(network, laddr string) (net.PacketConn, error) {
+						laddrs <- network + " " + laddr
+						return net.ListenUDP(network, nil)
+					},
+				}
+				dialHappyEyeballsAttempt = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+					if isIPv6(remoteAddr) {
+						return nil, stall(pconn)
+					}
+					return sess, nil
+				}
+				s, err := DialAddr("quic.clemente.io:1337", nil, config)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Expect(laddrs).To(Receive(Equal("udp6 [::]:0")))
+				Expect(laddrs).To(Receive(Equal("udp4 0.0.0.0:0")))
+			})
+
+			It("errors when the hostname can't be resolved", func() {
+				testErr := errors.New("no such host")
+				lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) { return nil, testErr }
+				_, err := DialAddr("quic.clemente.io:1337", nil, &Config{HappyEyeballs: true})
+				Expect(err).To(MatchError(testErr))
+			})
+		})
+
 		It("errors when receiving an error from the connection", func() {
 			testErr := errors.New("connection error")
 			packetConn.readErr = testErr
@@ -185,6 +479,63 @@ var _ = Describe("Client", func() {
 			Eventually(dialed).Should(BeClosed())
 		})
 
+		Context("dialing early sessions", func() {
+			BeforeEach(func() {
+				newClientSession = func(
+					_ connection,
+					_ string,
+					_ protocol.VersionNumber,
+					_ protocol.ConnectionID,
+					_ *tls.Config,
+					_ *Config,
+					_ protocol.VersionNumber,
+					_ []protocol.VersionNumber,
+					_ utils.Logger,
+				) (packetHandler, error) {
+					return sess, nil
+				}
+			})
+
+			It("returns as soon as the session can be used to send data, without waiting for the version negotiation", func() {
+				dialed := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					s, err := DialEarly(packetConn, addr, "quic.clemente.io:1337", nil, nil)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(s).To(Equal(sess))
+					close(dialed)
+				}()
+				Consistently(dialed).ShouldNot(BeClosed())
+				close(sess.earlyReadyChan)
+				Eventually(dialed).Should(BeClosed())
+			})
+
+			It("returns when the handshake completes", func() {
+				dialed := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := DialEarly(packetConn, addr, "quic.clemente.io:1337", nil, nil)
+					Expect(err).ToNot(HaveOccurred())
+					close(dialed)
+				}()
+				close(sess.handshakeChan)
+				Eventually(dialed).Should(BeClosed())
+			})
+
+			It("returns an error that occurs before the session can be used", func() {
+				testErr := errors.New("early handshake error")
+				dialed := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := DialEarly(packetConn, addr, "quic.clemente.io:1337", nil, nil)
+					Expect(err).To(MatchError(testErr))
+					close(dialed)
+				}()
+				sess.handshakeChan <- testErr
+				Eventually(dialed).Should(BeClosed())
+			})
+		})
+
 		It("returns an error that occurs while waiting for the connection to become secure", func() {
 			testErr := errors.New("early handshake error")
 			newClientSession = func(
@@ -213,21 +564,126 @@ var _ = Describe("Client", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		Context("using a context", func() {
+			BeforeEach(func() {
+				newClientSession = func(
+					_ connection,
+					_ string,
+					_ protocol.VersionNumber,
+					_ protocol.ConnectionID,
+					_ *tls.Config,
+					_ *Config,
+					_ protocol.VersionNumber,
+					_ []protocol.VersionNumber,
+					_ utils.Logger,
+				) (packetHandler, error) {
+					return sess, nil
+				}
+			})
+
+			It("aborts the handshake when the context is canceled", func() {
+				packetConn.dataToRead <- acceptClientVersionPacket(cl.srcConnID)
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", nil, nil)
+					Expect(err).To(MatchError(context.Canceled))
+					close(done)
+				}()
+				Consistently(done).ShouldNot(BeClosed())
+				cancel()
+				Eventually(done).Should(BeClosed())
+				Expect(sess.closed).To(BeTrue())
+				Expect(sess.closeReason).To(MatchError(context.Canceled))
+			})
+
+			It("aborts the handshake when the context is canceled before the server accepted the version", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", nil, nil)
+					Expect(err).To(MatchError(context.Canceled))
+					close(done)
+				}()
+				Consistently(done).ShouldNot(BeClosed())
+				cancel()
+				Eventually(done).Should(BeClosed())
+				Expect(sess.closed).To(BeTrue())
+			})
+
+			It("returns the context's error, if the deadline expires", func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", nil, nil)
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+				Expect(sess.closed).To(BeTrue())
+			})
+
+			It("returns after the handshake is complete, if the context is not canceled", func() {
+				packetConn.dataToRead <- acceptClientVersionPacket(cl.srcConnID)
+				close(sess.handshakeChan)
+				s, err := DialContext(context.Background(), packetConn, addr, "quic.clemente.io:1337", nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Expect(sess.closed).To(BeFalse())
+			})
+		})
+
 		Context("quic.Config", func() {
 			It("setups with the right values", func() {
 				config := &Config{
 					HandshakeTimeout:            1337 * time.Minute,
 					IdleTimeout:                 42 * time.Hour,
+					MaxHandshakePackets:         1234,
+					ConnectionIDLength:          13,
 					RequestConnectionIDOmission: true,
 					MaxIncomingStreams:          1234,
 					MaxIncomingUniStreams:       4321,
+					StreamScheduler:             StreamSchedulerWeightedFair,
+					CongestionControl:           CongestionBBR,
+					EnableDatagrams:             true,
+					DisableECN:                  true,
+					MaxPacketSize:               1300,
+					DisablePathMTUDiscovery:     true,
+					KeyUpdateInterval:           1000,
+					PreferIPv6Delay:             100 * time.Millisecond,
+					TLSStack:                    TLSStackStandardLibrary,
+					GetLogWriter:                func([]byte) io.WriteCloser { return nil },
+					Tracer:                      &recordingTracer{},
+					Logger:                      &recordingLogger{},
+					InitialPacingRate:           1 << 20,
+					MaxPacingBurst:              5,
+					MaxAckDelay:                 50 * time.Millisecond,
+					PacketsPerAck:               4,
+					ImmediateAckOnReordering:    true,
 				}
 				c := populateClientConfig(config)
 				Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
 				Expect(c.IdleTimeout).To(Equal(42 * time.Hour))
+				Expect(c.MaxHandshakePackets).To(Equal(1234))
+				Expect(c.ConnectionIDLength).To(Equal(13))
 				Expect(c.RequestConnectionIDOmission).To(BeTrue())
 				Expect(c.MaxIncomingStreams).To(Equal(1234))
 				Expect(c.MaxIncomingUniStreams).To(Equal(4321))
+				Expect(c.StreamScheduler).To(Equal(StreamSchedulerWeightedFair))
+				Expect(c.CongestionControl).To(Equal(CongestionBBR))
+				Expect(c.EnableDatagrams).To(BeTrue())
+				Expect(c.DisableECN).To(BeTrue())
+				Expect(c.MaxPacketSize).To(Equal(uint64(1300)))
+				Expect(c.DisablePathMTUDiscovery).To(BeTrue())
+				Expect(c.KeyUpdateInterval).To(Equal(uint64(1000)))
+				Expect(c.PreferIPv6Delay).To(Equal(100 * time.Millisecond))
+				Expect(c.TLSStack).To(Equal(TLSStackStandardLibrary))
+				Expect(c.GetLogWriter).ToNot(BeNil())
+				Expect(c.Tracer).To(Equal(config.Tracer))
+				Expect(c.Logger).To(Equal(config.Logger))
+				Expect(c.InitialPacingRate).To(Equal(uint64(1 << 20)))
+				Expect(c.MaxPacingBurst).To(Equal(5))
+				Expect(c.MaxAckDelay).To(Equal(50 * time.Millisecond))
+				Expect(c.PacketsPerAck).To(Equal(4))
+				Expect(c.ImmediateAckOnReordering).To(BeTrue())
 			})
 
 			It("errors when the Config contains an invalid version", func() {
@@ -236,6 +692,28 @@ var _ = Describe("Client", func() {
 				Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 			})
 
+			It("errors when the Config contains an invalid connection ID length", func() {
+				_, err := Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{ConnectionIDLength: 3})
+				Expect(err).To(MatchError("invalid connection ID length: 3 bytes (must be between 4 and 18 bytes)"))
+				_, err = Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{ConnectionIDLength: 19})
+				Expect(err).To(MatchError("invalid connection ID length: 19 bytes (must be between 4 and 18 bytes)"))
+			})
+
+			It("errors when the Config contains an invalid stream scheduler", func() {
+				_, err := Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{StreamScheduler: 42})
+				Expect(err).To(MatchError("invalid stream scheduler: 42"))
+			})
+
+			It("errors when the Config contains an invalid congestion control algorithm", func() {
+				_, err := Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{CongestionControl: 42})
+				Expect(err).To(MatchError("invalid congestion control algorithm: 42"))
+			})
+
+			It("errors when the Config contains an invalid TLS stack", func() {
+				_, err := Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{TLSStack: 42})
+				Expect(err).To(MatchError("invalid TLS stack: 42"))
+			})
+
 			It("disables bidirectional streams", func() {
 				config := &Config{
 					MaxIncomingStreams:    -1,
@@ -256,12 +734,66 @@ var _ = Describe("Client", func() {
 				Expect(c.MaxIncomingUniStreams).To(BeZero())
 			})
 
+			It("limits the max packet size", func() {
+				Expect(populateClientConfig(&Config{MaxPacketSize: 1000}).MaxPacketSize).To(BeEquivalentTo(protocol.MinInitialPacketSize))
+				Expect(populateClientConfig(&Config{MaxPacketSize: 9000}).MaxPacketSize).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+			})
+
 			It("fills in default values if options are not set in the Config", func() {
 				c := populateClientConfig(&Config{})
 				Expect(c.Versions).To(Equal(protocol.SupportedVersions))
 				Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 				Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+				Expect(c.MaxHandshakePackets).To(Equal(protocol.DefaultMaxHandshakePackets))
+				Expect(c.ConnectionIDLength).To(Equal(protocol.DefaultConnectionIDLength))
 				Expect(c.RequestConnectionIDOmission).To(BeFalse())
+				Expect(c.MaxUndecryptablePackets).To(Equal(protocol.MaxUndecryptablePackets))
+				Expect(c.UndecryptablePacketTimeout).To(Equal(protocol.DefaultUndecryptablePacketTimeout))
+				Expect(c.MaxPacketSize).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+				Expect(c.KeyUpdateInterval).To(BeEquivalentTo(protocol.DefaultKeyUpdateInterval))
+				Expect(c.PreferIPv6Delay).To(Equal(protocol.HappyEyeballsDelay))
+				Expect(c.TLSStack).To(Equal(TLSStackMint))
+				Expect(c.ConnectionIDGenerator).To(Equal(&randomConnIDGenerator{connIDLen: protocol.DefaultConnectionIDLength}))
+				Expect(c.InitialStreamReceiveWindow).To(BeEquivalentTo(protocol.ReceiveStreamFlowControlWindow))
+				Expect(c.MaxStreamReceiveWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveStreamFlowControlWindowClient))
+				Expect(c.InitialConnectionReceiveWindow).To(BeEquivalentTo(protocol.ReceiveConnectionFlowControlWindow))
+				Expect(c.MaxConnectionReceiveWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveConnectionFlowControlWindowClient))
+				Expect(c.MaxAckDelay).To(Equal(protocol.DefaultMaxAckDelay))
+			})
+
+			It("limits the max ACK delay", func() {
+				c := populateClientConfig(&Config{MaxAckDelay: time.Second})
+				Expect(c.MaxAckDelay).To(Equal(protocol.MaxMaxAckDelay))
+			})
+
+			It("uses the configured flow control windows", func() {
+				c := populateClientConfig(&Config{
+					InitialStreamReceiveWindow:     1000,
+					MaxStreamReceiveWindow:         2000,
+					InitialConnectionReceiveWindow: 3000,
+					MaxConnectionReceiveWindow:     4000,
+				})
+				Expect(c.InitialStreamReceiveWindow).To(BeEquivalentTo(1000))
+				Expect(c.MaxStreamReceiveWindow).To(BeEquivalentTo(2000))
+				Expect(c.InitialConnectionReceiveWindow).To(BeEquivalentTo(3000))
+				Expect(c.MaxConnectionReceiveWindow).To(BeEquivalentTo(4000))
+			})
+
+			It("doesn't use maximum flow control windows smaller than the initial windows", func() {
+				c := populateClientConfig(&Config{
+					InitialStreamReceiveWindow:     10 * (1 << 20),
+					MaxStreamReceiveWindow:         1 << 20,
+					InitialConnectionReceiveWindow: 20 * (1 << 20),
+				})
+				Expect(c.MaxStreamReceiveWindow).To(BeEquivalentTo(10 * (1 << 20)))
+				Expect(c.MaxConnectionReceiveWindow).To(BeEquivalentTo(20 * (1 << 20)))
+			})
+
+			It("uses the connection ID length of the ConnectionIDGenerator", func() {
+				generator := &mockConnIDGenerator{prefix: []byte{1, 2, 3, 4, 5}, connIDLen: 6}
+				c := populateClientConfig(&Config{ConnectionIDLength: 13, ConnectionIDGenerator: generator})
+				Expect(c.ConnectionIDLength).To(Equal(6))
+				Expect(c.ConnectionIDGenerator).To(Equal(generator))
 			})
 		})
 
@@ -304,6 +836,8 @@ var _ = Describe("Client", func() {
 					tls handshake.MintTLS,
 					paramsChan <-chan handshake.TransportParameters,
 					_ protocol.PacketNumber,
+					_ func(connection),
+					_ connIDRunner,
 					_ utils.Logger,
 				) (packetHandler, error) {
 					cconn = connP
@@ -328,6 +862,116 @@ var _ = Describe("Client", func() {
 				sess.Close(errors.New("peer doesn't reply"))
 				Eventually(dialed).Should(BeClosed())
 			})
+
+			It("uses connection IDs of the configured length", func() {
+				generateConnectionID = protocol.GenerateConnectionID
+				config := &Config{
+					Versions:           []protocol.VersionNumber{protocol.VersionTLS},
+					ConnectionIDLength: 5,
+				}
+				var srcConnID, destConnID protocol.ConnectionID
+				c := make(chan struct{})
+				newTLSClientSession = func(
+					_ connection,
+					_ string,
+					_ protocol.VersionNumber,
+					destConnIDP protocol.ConnectionID,
+					srcConnIDP protocol.ConnectionID,
+					_ *Config,
+					_ handshake.MintTLS,
+					_ <-chan handshake.TransportParameters,
+					_ protocol.PacketNumber,
+					_ func(connection),
+					_ connIDRunner,
+					_ utils.Logger,
+				) (packetHandler, error) {
+					destConnID = destConnIDP
+					srcConnID = srcConnIDP
+					close(c)
+					return sess, nil
+				}
+				dialed := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					Dial(packetConn, addr, "quic.clemente.io:1337", nil, config)
+					close(dialed)
+				}()
+				Eventually(c).Should(BeClosed())
+				Expect(srcConnID).To(HaveLen(5))
+				Expect(destConnID).To(HaveLen(5))
+				sess.Close(errors.New("peer doesn't reply"))
+				Eventually(dialed).Should(BeClosed())
+			})
+
+			Context("using a ConnectionIDGenerator", func() {
+				var srcConnID, destConnID protocol.ConnectionID
+
+				BeforeEach(func() {
+					generateConnectionID = protocol.GenerateConnectionID
+					newTLSClientSession = func(
+						_ connection,
+						_ string,
+						_ protocol.VersionNumber,
+						destConnIDP protocol.ConnectionID,
+						srcConnIDP protocol.ConnectionID,
+						_ *Config,
+						_ handshake.MintTLS,
+						_ <-chan handshake.TransportParameters,
+						_ protocol.PacketNumber,
+						_ func(connection),
+						_ connIDRunner,
+						_ utils.Logger,
+					) (packetHandler, error) {
+						destConnID = destConnIDP
+						srcConnID = srcConnIDP
+						return sess, nil
+					}
+				})
+
+				dial := func(generator ConnectionIDGenerator) error {
+					errChan := make(chan error, 1)
+					go func() {
+						defer GinkgoRecover()
+						_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, &Config{
+							Versions:              []protocol.VersionNumber{protocol.VersionTLS},
+							ConnectionIDGenerator: generator,
+						})
+						errChan <- err
+					}()
+					var err error
+					Consistently(errChan).ShouldNot(Receive())
+					sess.Close(errors.New("peer doesn't reply"))
+					Eventually(errChan).Should(Receive(&err))
+					return err
+				}
+
+				It("uses the generated connection ID", func() {
+					Expect(dial(&mockConnIDGenerator{prefix: []byte{0xde, 0xad, 0xbe, 0xef}, connIDLen: 5})).To(MatchError("peer doesn't reply"))
+					Expect(srcConnID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 1}))
+					Expect(destConnID).To(HaveLen(5))
+				})
+
+				It("uses a zero-length connection ID", func() {
+					Expect(dial(&randomConnIDGenerator{})).To(MatchError("peer doesn't reply"))
+					Expect(srcConnID).To(BeEmpty())
+					Expect(destConnID).To(HaveLen(protocol.DefaultConnectionIDLength))
+				})
+
+				It("errors if the generated connection ID has the wrong length", func() {
+					_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, &Config{
+						Versions:              []protocol.VersionNumber{protocol.VersionTLS},
+						ConnectionIDGenerator: &mockConnIDGenerator{prefix: []byte{0xde, 0xad, 0xbe, 0xef}, connIDLen: 6},
+					})
+					Expect(err).To(MatchError("connection ID generator returned a 6 byte connection ID (expected 5 bytes)"))
+				})
+
+				It("errors if the connection ID length is invalid", func() {
+					_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, &Config{
+						ConnectionIDGenerator: &randomConnIDGenerator{connIDLen: 3},
+					})
+					Expect(err).To(MatchError("invalid connection ID length: 3 bytes (must be between 4 and 18 bytes)"))
+				})
+			})
 		})
 
 		Context("version negotiation", func() {
@@ -379,7 +1023,7 @@ var _ = Describe("Client", func() {
 				b := &bytes.Buffer{}
 				err := ph.Write(b, protocol.PerspectiveServer, protocol.VersionWhatever)
 				Expect(err).ToNot(HaveOccurred())
-				err = cl.handlePacket(nil, b.Bytes())
+				_, err = cl.handlePacket(nil, b.Bytes(), protocol.ECNNon)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.versionNegotiated).To(BeTrue())
 				Expect(cl.versionNegotiationChan).To(BeClosed())
@@ -419,11 +1063,11 @@ var _ = Describe("Client", func() {
 				established := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					err := cl.dial()
+					err := cl.dial(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					close(established)
 				}()
-				go cl.listen()
+				go cl.listen(cl.conn)
 
 				actualInitialVersion := cl.version
 				var firstSession, secondSession *mockSession
@@ -466,30 +1110,63 @@ var _ = Describe("Client", func() {
 						stopRunLoop:  make(chan struct{}),
 					}, nil
 				}
-				go cl.dial()
+				go cl.dial(context.Background())
 				Eventually(func() uint32 { return atomic.LoadUint32(&sessionCounter) }).Should(BeEquivalentTo(1))
 				cl.config = &Config{Versions: []protocol.VersionNumber{77, 78}}
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{77}))
+				_, err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{77}), protocol.ECNNon)
 				Expect(err).ToNot(HaveOccurred())
 				Eventually(func() uint32 { return atomic.LoadUint32(&sessionCounter) }).Should(BeEquivalentTo(2))
-				err = cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{78}))
+				_, err = cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{78}), protocol.ECNNon)
 				Expect(err).To(MatchError("received a delayed Version Negotiation Packet"))
 				Consistently(func() uint32 { return atomic.LoadUint32(&sessionCounter) }).Should(BeEquivalentTo(2))
 			})
 
+			It("ignores version negotiation packets that arrive after a packet from the server", func() {
+				cl.config = &Config{Versions: []protocol.VersionNumber{77, cl.version}}
+				_, err := cl.handlePacket(nil, acceptClientVersionPacket(connID), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess.handledPackets).To(HaveLen(1))
+				ver := cl.version
+				_, err = cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{77}), protocol.ECNNon)
+				Expect(err).To(MatchError("received a Version Negotiation Packet after the server accepted our version"))
+				Expect(cl.version).To(Equal(ver))
+				Expect(cl.receivedVersionNegotiationPacket).To(BeFalse())
+				Expect(sess.closed).To(BeFalse())
+				Expect(sess.handledPackets).To(HaveLen(1))
+			})
+
+			It("reports ignored version negotiation packets to the tracer", func() {
+				tracer := &recordingTracer{}
+				cl.config = &Config{Versions: []protocol.VersionNumber{77, cl.version}, Tracer: tracer}
+				_, err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{cl.version}), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tracer.getDropped()).To(Equal([]tracedDrop{{connID: cl.destConnID, reason: PacketDropUnexpectedPacket}}))
+				_, err = cl.handlePacket(nil, acceptClientVersionPacket(connID), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{77}), protocol.ECNNon)
+				Expect(err).To(HaveOccurred())
+				Expect(tracer.getDropped()).To(HaveLen(2))
+				Expect(tracer.getDropped()[1]).To(Equal(tracedDrop{connID: cl.destConnID, reason: PacketDropUnexpectedPacket}))
+				Expect(sess.closed).To(BeFalse())
+			})
+
 			It("errors if no matching version is found", func() {
 				cl.config = &Config{Versions: protocol.SupportedVersions}
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{1}))
+				_, err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{1}), protocol.ECNNon)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.session.(*mockSession).closed).To(BeTrue())
 				Expect(cl.session.(*mockSession).closeReason).To(MatchError(qerr.InvalidVersion))
+				Expect(cl.session.(*mockSession).closeReason).To(Equal(&qerr.VersionNegotiationError{
+					Ours:   protocol.SupportedVersions,
+					Theirs: []protocol.VersionNumber{1},
+				}))
 			})
 
 			It("errors if the version is supported by quic-go, but disabled by the quic.Config", func() {
 				v := protocol.VersionNumber(1234)
 				Expect(v).ToNot(Equal(cl.version))
 				cl.config = &Config{Versions: protocol.SupportedVersions}
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{v}))
+				_, err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{v}), protocol.ECNNon)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.session.(*mockSession).closed).To(BeTrue())
 				Expect(cl.session.(*mockSession).closeReason).To(MatchError(qerr.InvalidVersion))
@@ -498,14 +1175,15 @@ var _ = Describe("Client", func() {
 			It("changes to the version preferred by the quic.Config", func() {
 				config := &Config{Versions: []protocol.VersionNumber{1234, 4321}}
 				cl.config = config
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{4321, 1234}))
+				_, err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{4321, 1234}), protocol.ECNNon)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.version).To(Equal(protocol.VersionNumber(1234)))
 			})
 
 			It("drops version negotiation packets that contain the offered version", func() {
+				cl.config = &Config{}
 				ver := cl.version
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{ver}))
+				_, err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{ver}), protocol.ECNNon)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.version).To(Equal(ver))
 			})
@@ -513,7 +1191,7 @@ var _ = Describe("Client", func() {
 	})
 
 	It("ignores packets with an invalid public header", func() {
-		err := cl.handlePacket(addr, []byte("invalid packet"))
+		_, err := cl.handlePacket(addr, []byte("invalid packet"), protocol.ECNNon)
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("error parsing packet from"))
 		Expect(sess.handledPackets).To(BeEmpty())
@@ -531,12 +1209,14 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}
 		Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-		cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...))
+		cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...), protocol.ECNNon)
 		Expect(sess.handledPackets).To(BeEmpty())
 		Expect(sess.closed).To(BeFalse())
 	})
 
 	It("cuts packets at the payload length", func() {
+		// the data after the packet is handled as a coalesced packet
+		cl.config = &Config{}
 		b := &bytes.Buffer{}
 		hdr := &wire.Header{
 			IsLongHeader:     true,
@@ -547,11 +1227,37 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}
 		Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-		cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...))
+		cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...), protocol.ECNNon)
 		Expect(sess.handledPackets).To(HaveLen(1))
 		Expect(sess.handledPackets[0].data).To(HaveLen(123))
 	})
 
+	It("handles packets coalesced into a single datagram", func() {
+		cl.config = &Config{}
+		b := &bytes.Buffer{}
+		for _, l := range []protocol.ByteCount{123, 45} {
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				PayloadLen:       l,
+				SrcConnectionID:  connID,
+				DestConnectionID: connID,
+				Version:          versionIETFFrames,
+			}
+			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+			b.Write(make([]byte, l))
+		}
+		data := append((*getPacketBuffer())[:0], b.Bytes()...)
+		passedOn, err := cl.handlePacket(addr, data, protocol.ECNNon)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(passedOn).To(BeTrue())
+		Expect(sess.handledPackets).To(HaveLen(2))
+		Expect(sess.handledPackets[0].data).To(HaveLen(123))
+		Expect(sess.handledPackets[1].data).To(HaveLen(45))
+		// the coalesced packet is copied to a separate buffer
+		Expect(cap(sess.handledPackets[1].header.Raw)).To(Equal(int(protocol.MaxReceiveBufferSize)))
+	})
+
 	It("ignores packets without connection id, if it didn't request connection id trunctation", func() {
 		cl.config = &Config{RequestConnectionIDOmission: false}
 		buf := &bytes.Buffer{}
@@ -563,12 +1269,64 @@ var _ = Describe("Client", func() {
 			PacketNumberLen:  1,
 		}).Write(buf, protocol.PerspectiveServer, versionGQUICFrames)
 		Expect(err).ToNot(HaveOccurred())
-		err = cl.handlePacket(addr, buf.Bytes())
+		_, err = cl.handlePacket(addr, buf.Bytes(), protocol.ECNNon)
 		Expect(err).To(MatchError("received packet with truncated connection ID, but didn't request truncation"))
 		Expect(sess.handledPackets).To(BeEmpty())
 		Expect(sess.closed).To(BeFalse())
 	})
 
+	It("accepts packets without connection ID, if it requested connection ID omission", func() {
+		cl.config = &Config{RequestConnectionIDOmission: true}
+		buf := &bytes.Buffer{}
+		err := (&wire.Header{
+			OmitConnectionID: true,
+			SrcConnectionID:  connID,
+			DestConnectionID: connID,
+			PacketNumber:     1,
+			PacketNumberLen:  1,
+		}).Write(buf, protocol.PerspectiveServer, versionGQUICFrames)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cl.handlePacket(addr, buf.Bytes(), protocol.ECNNon)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess.handledPackets).To(HaveLen(1))
+		Expect(sess.handledPackets[0].header.OmitConnectionID).To(BeTrue())
+		Expect(sess.closed).To(BeFalse())
+	})
+
+	It("accepts packets with and without connection ID, if it requested connection ID omission", func() {
+		// the server only omits the connection ID on forward-secure packets
+		cl.config = &Config{RequestConnectionIDOmission: true}
+		for i, omit := range []bool{false, true, false} {
+			buf := &bytes.Buffer{}
+			err := (&wire.Header{
+				OmitConnectionID: omit,
+				SrcConnectionID:  connID,
+				DestConnectionID: connID,
+				PacketNumber:     protocol.PacketNumber(i + 1),
+				PacketNumberLen:  1,
+			}).Write(buf, protocol.PerspectiveServer, versionGQUICFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cl.handlePacket(addr, buf.Bytes(), protocol.ECNNon)).To(BeTrue())
+		}
+		Expect(sess.handledPackets).To(HaveLen(3))
+		Expect(sess.closed).To(BeFalse())
+	})
+
+	It("ignores packets with the wrong destination connection ID, if it requested connection ID omission", func() {
+		cl.config = &Config{RequestConnectionIDOmission: true}
+		buf := &bytes.Buffer{}
+		err := (&wire.Header{
+			SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			DestConnectionID: protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			PacketNumber:     1,
+			PacketNumberLen:  1,
+		}).Write(buf, protocol.PerspectiveServer, versionGQUICFrames)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cl.handlePacket(addr, buf.Bytes(), protocol.ECNNon)
+		Expect(err).To(MatchError(ContainSubstring("received a packet with an unexpected connection ID")))
+		Expect(sess.handledPackets).To(BeEmpty())
+	})
+
 	It("ignores packets with the wrong destination connection ID", func() {
 		buf := &bytes.Buffer{}
 		cl.version = versionIETFFrames
@@ -582,12 +1340,77 @@ var _ = Describe("Client", func() {
 			PacketNumberLen:  1,
 		}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
 		Expect(err).ToNot(HaveOccurred())
-		err = cl.handlePacket(addr, buf.Bytes())
+		_, err = cl.handlePacket(addr, buf.Bytes(), protocol.ECNNon)
 		Expect(err).To(MatchError(fmt.Sprintf("received a packet with an unexpected connection ID (0x0807060504030201, expected %s)", connID)))
 		Expect(sess.handledPackets).To(BeEmpty())
 		Expect(sess.closed).To(BeFalse())
 	})
 
+	It("parses short headers using the length of its connection ID", func() {
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		cl.srcConnID = protocol.ConnectionID{1, 2, 3, 4, 5}
+		buf := &bytes.Buffer{}
+		err := (&wire.Header{
+			DestConnectionID: cl.srcConnID,
+			PacketNumber:     1,
+			PacketNumberLen:  1,
+		}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		buf.Write([]byte("foobar"))
+		_, err = cl.handlePacket(addr, buf.Bytes(), protocol.ECNNon)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess.handledPackets).To(HaveLen(1))
+		Expect(sess.handledPackets[0].header.DestConnectionID).To(Equal(cl.srcConnID))
+		Expect(sess.handledPackets[0].data).To(Equal([]byte("foobar")))
+	})
+
+	It("closes the session when receiving a stateless reset", func() {
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		sess.isStatelessReset = true
+		b, err := wire.WriteStatelessReset(protocol.StatelessResetToken{1, 2, 3, 4})
+		Expect(err).ToNot(HaveOccurred())
+		// the stateless reset uses a random connection ID
+		Expect(cl.handlePacket(addr, b, protocol.ECNNon)).To(BeFalse())
+		Expect(sess.handledPackets).To(BeEmpty())
+		Expect(sess.closedRemote).To(BeTrue())
+		Expect(sess.closeReason).To(BeAssignableToTypeOf(StatelessResetError{}))
+	})
+
+	Context("oversized packets", func() {
+		var packet []byte
+
+		BeforeEach(func() {
+			cl.version = versionIETFFrames
+			buf := &bytes.Buffer{}
+			err := (&wire.Header{
+				DestConnectionID: connID,
+				PacketNumber:     1,
+				PacketNumberLen:  1,
+			}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			packet = append(buf.Bytes(), make([]byte, int(protocol.MaxReceiveBufferSize)-buf.Len())...)
+		})
+
+		It("drops packets larger than the maximum packet size", func() {
+			cl.config = &Config{}
+			_, err := cl.handlePacket(addr, packet, protocol.ECNNon)
+			Expect(err).To(MatchError("PacketTooLarge: received a packet larger than 1452 bytes"))
+			Expect(sess.handledPackets).To(BeEmpty())
+			Expect(sess.closed).To(BeFalse())
+		})
+
+		It("closes the session, if configured", func() {
+			cl.config = &Config{CloseOnOversizedPackets: true}
+			_, err := cl.handlePacket(addr, packet, protocol.ECNNon)
+			Expect(err).To(MatchError("PacketTooLarge: received a packet larger than 1452 bytes"))
+			Expect(sess.handledPackets).To(BeEmpty())
+			Expect(sess.closed).To(BeTrue())
+			Expect(sess.closeReason).To(MatchError(err))
+		})
+	})
+
 	It("creates new GQUIC sessions with the right parameters", func() {
 		config := &Config{Versions: protocol.SupportedVersions}
 		closeErr := errors.New("peer doesn't reply")
@@ -644,6 +1467,8 @@ var _ = Describe("Client", func() {
 			tls handshake.MintTLS,
 			paramsChan <-chan handshake.TransportParameters,
 			_ protocol.PacketNumber,
+			_ func(connection),
+			_ connIDRunner,
 			_ utils.Logger,
 		) (packetHandler, error) {
 			sess := &mockSession{
@@ -682,7 +1507,7 @@ var _ = Describe("Client", func() {
 			Expect(sess.handledPackets).To(BeEmpty())
 			stoppedListening := make(chan struct{})
 			go func() {
-				cl.listen()
+				cl.listen(cl.conn)
 				// it should continue listening when receiving valid packets
 				close(stoppedListening)
 			}()
@@ -692,10 +1517,33 @@ var _ = Describe("Client", func() {
 			Consistently(stoppedListening).ShouldNot(BeClosed())
 		})
 
+		It("handles packets received on a new connection, when migrating", func() {
+			ph := wire.Header{
+				PacketNumber:     1,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+				DestConnectionID: connID,
+				SrcConnectionID:  connID,
+			}
+			b := &bytes.Buffer{}
+			Expect(ph.Write(b, protocol.PerspectiveServer, cl.version)).To(Succeed())
+			newPacketConn := newMockPacketConn()
+			newPacketConn.dataReadFrom = addr
+			newPacketConn.dataToRead <- b.Bytes()
+
+			stoppedListening := make(chan struct{})
+			go func() {
+				cl.listen(&conn{pconn: newPacketConn, currentAddr: addr})
+				close(stoppedListening)
+			}()
+			Eventually(func() []*receivedPacket { return sess.handledPackets }).Should(HaveLen(1))
+			Expect(sess.closed).To(BeFalse())
+			Consistently(stoppedListening).ShouldNot(BeClosed())
+		})
+
 		It("closes the session when encountering an error while reading from the connection", func() {
 			testErr := errors.New("test error")
 			packetConn.readErr = testErr
-			cl.listen()
+			cl.listen(cl.conn)
 			Expect(sess.closed).To(BeTrue())
 			Expect(sess.closeReason).To(MatchError(testErr))
 		})
@@ -703,7 +1551,7 @@ var _ = Describe("Client", func() {
 
 	Context("Public Reset handling", func() {
 		It("closes the session when receiving a Public Reset", func() {
-			err := cl.handlePacket(addr, wire.WritePublicReset(cl.destConnID, 1, 0))
+			_, err := cl.handlePacket(addr, wire.WritePublicReset(cl.destConnID, 1, 0), protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(cl.session.(*mockSession).closed).To(BeTrue())
 			Expect(cl.session.(*mockSession).closedRemote).To(BeTrue())
@@ -712,7 +1560,7 @@ var _ = Describe("Client", func() {
 
 		It("ignores Public Resets from the wrong remote address", func() {
 			spoofedAddr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 5678}
-			err := cl.handlePacket(spoofedAddr, wire.WritePublicReset(cl.destConnID, 1, 0))
+			_, err := cl.handlePacket(spoofedAddr, wire.WritePublicReset(cl.destConnID, 1, 0), protocol.ECNNon)
 			Expect(err).To(MatchError("Received a spoofed Public Reset"))
 			Expect(cl.session.(*mockSession).closed).To(BeFalse())
 			Expect(cl.session.(*mockSession).closedRemote).To(BeFalse())
@@ -720,7 +1568,7 @@ var _ = Describe("Client", func() {
 
 		It("ignores unparseable Public Resets", func() {
 			pr := wire.WritePublicReset(cl.destConnID, 1, 0)
-			err := cl.handlePacket(addr, pr[:len(pr)-5])
+			_, err := cl.handlePacket(addr, pr[:len(pr)-5], protocol.ECNNon)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("Received a Public Reset. An error occurred parsing the packet"))
 			Expect(cl.session.(*mockSession).closed).To(BeFalse())
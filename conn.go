@@ -3,15 +3,30 @@ package quic
 import (
 	"net"
 	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
 type connection interface {
 	Write([]byte) error
+	// WriteBatch writes multiple packets to the current remote address.
+	// On Linux, the packets are written using a single sendmmsg syscall.
+	WriteBatch([][]byte) error
+	// WriteTo writes a packet to an address other than the current remote address.
+	// It is used by the server to validate a new address of the client.
+	WriteTo([]byte, net.Addr) error
 	Read([]byte) (int, net.Addr, error)
 	Close() error
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 	SetCurrentRemoteAddr(net.Addr)
+	// SetPacketConn replaces the underlying net.PacketConn, and returns the old one.
+	SetPacketConn(net.PacketConn) net.PacketConn
+	// PacketConn returns the underlying net.PacketConn.
+	PacketConn() net.PacketConn
+	// SetECN sets the ECN codepoint of packets written using Write and WriteBatch.
+	// On platforms that don't support setting the ECN codepoint, it has no effect.
+	SetECN(protocol.ECN)
 }
 
 type conn struct {
@@ -19,17 +34,48 @@ type conn struct {
 
 	pconn       net.PacketConn
 	currentAddr net.Addr
+	ecn         protocol.ECN
+	// writer is used for Write and WriteBatch. It is created when a packet is first written.
+	writer packetWriter
 }
 
 var _ connection = &conn{}
 
 func (c *conn) Write(p []byte) error {
-	_, err := c.pconn.WriteTo(p, c.currentAddr)
+	return c.WriteBatch([][]byte{p})
+}
+
+func (c *conn) WriteTo(p []byte, addr net.Addr) error {
+	c.mutex.RLock()
+	pconn := c.pconn
+	c.mutex.RUnlock()
+	_, err := pconn.WriteTo(p, addr)
 	return err
 }
 
+func (c *conn) WriteBatch(packets [][]byte) error {
+	c.mutex.Lock()
+	if c.writer == nil {
+		c.writer = newPacketWriter(c.pconn)
+	}
+	writer := c.writer
+	addr := c.currentAddr
+	ecn := c.ecn
+	c.mutex.Unlock()
+	return writer.WritePackets(packets, addr, ecn)
+}
+
+func (c *conn) SetECN(ecn protocol.ECN) {
+	c.mutex.Lock()
+	c.ecn = ecn
+	c.mutex.Unlock()
+}
+
 func (c *conn) Read(p []byte) (int, net.Addr, error) {
-	return c.pconn.ReadFrom(p)
+	c.mutex.RLock()
+	pconn := c.pconn
+	c.mutex.RUnlock()
+	return pconn.ReadFrom(p)
 }
 
 func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
@@ -38,8 +84,26 @@ func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
 	c.mutex.Unlock()
 }
 
+func (c *conn) SetPacketConn(pconn net.PacketConn) net.PacketConn {
+	c.mutex.Lock()
+	oldPconn := c.pconn
+	c.pconn = pconn
+	c.writer = nil
+	c.mutex.Unlock()
+	return oldPconn
+}
+
+func (c *conn) PacketConn() net.PacketConn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.pconn
+}
+
 func (c *conn) LocalAddr() net.Addr {
-	return c.pconn.LocalAddr()
+	c.mutex.RLock()
+	pconn := c.pconn
+	c.mutex.RUnlock()
+	return pconn.LocalAddr()
 }
 
 func (c *conn) RemoteAddr() net.Addr {
@@ -50,5 +114,8 @@ func (c *conn) RemoteAddr() net.Addr {
 }
 
 func (c *conn) Close() error {
-	return c.pconn.Close()
+	c.mutex.RLock()
+	pconn := c.pconn
+	c.mutex.RUnlock()
+	return pconn.Close()
 }
@@ -0,0 +1,116 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// The randomConnIDGenerator generates random connection IDs.
+// It is used if no ConnectionIDGenerator is configured.
+type randomConnIDGenerator struct {
+	connIDLen int
+}
+
+var _ ConnectionIDGenerator = &randomConnIDGenerator{}
+
+func (g *randomConnIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	return generateConnectionID(g.connIDLen)
+}
+
+func (g *randomConnIDGenerator) ConnectionIDLen() int {
+	return g.connIDLen
+}
+
+// The connIDGenerator issues connection IDs to the peer, using NEW_CONNECTION_ID frames.
+// When the peer retires a connection ID, a new one is issued.
+// The connection ID used during the handshake has sequence number 0.
+type connIDGenerator struct {
+	generator   ConnectionIDGenerator
+	highestSeq  uint64
+	activeConns map[uint64]protocol.ConnectionID
+
+	// addConnectionID and retireConnectionID are used to route packets sent to these connection IDs to the session
+	addConnectionID        func(protocol.ConnectionID)
+	retireConnectionID     func(protocol.ConnectionID)
+	getStatelessResetToken func(protocol.ConnectionID) protocol.StatelessResetToken
+	queueControlFrame      func(wire.Frame)
+}
+
+func newConnIDGenerator(
+	initialConnID protocol.ConnectionID,
+	generator ConnectionIDGenerator,
+	addConnectionID func(protocol.ConnectionID),
+	retireConnectionID func(protocol.ConnectionID),
+	getStatelessResetToken func(protocol.ConnectionID) protocol.StatelessResetToken,
+	queueControlFrame func(wire.Frame),
+) *connIDGenerator {
+	return &connIDGenerator{
+		generator:              generator,
+		activeConns:            map[uint64]protocol.ConnectionID{0: initialConnID},
+		addConnectionID:        addConnectionID,
+		retireConnectionID:     retireConnectionID,
+		getStatelessResetToken: getStatelessResetToken,
+		queueControlFrame:      queueControlFrame,
+	}
+}
+
+// IssueConnectionIDs issues protocol.NumIssuedConnectionIDs connection IDs.
+// It is called when the handshake completes.
+// An endpoint that uses zero-length connection IDs doesn't issue any connection IDs.
+func (g *connIDGenerator) IssueConnectionIDs() error {
+	if g.generator.ConnectionIDLen() == 0 {
+		return nil
+	}
+	for i := 0; i < protocol.NumIssuedConnectionIDs; i++ {
+		if err := g.issueConnectionID(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *connIDGenerator) issueConnectionID() error {
+	connID, err := g.generator.GenerateConnectionID()
+	if err != nil {
+		return err
+	}
+	if connID.Len() != g.generator.ConnectionIDLen() {
+		return fmt.Errorf("connection ID generator returned a %d byte connection ID (expected %d bytes)", connID.Len(), g.generator.ConnectionIDLen())
+	}
+	g.highestSeq++
+	g.activeConns[g.highestSeq] = connID
+	g.addConnectionID(connID)
+	g.queueControlFrame(&wire.NewConnectionIDFrame{
+		SequenceNumber:      g.highestSeq,
+		ConnectionID:        connID,
+		StatelessResetToken: g.getStatelessResetToken(connID),
+	})
+	return nil
+}
+
+// Retire retires a connection ID, when the peer sent a RETIRE_CONNECTION_ID frame.
+// A new connection ID is issued to replace it.
+func (g *connIDGenerator) Retire(seq uint64) error {
+	if seq > g.highestSeq {
+		return qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("tried to retire connection ID %d, highest issued: %d", seq, g.highestSeq))
+	}
+	connID, ok := g.activeConns[seq]
+	// the connection ID was already retired
+	if !ok {
+		return nil
+	}
+	delete(g.activeConns, seq)
+	g.retireConnectionID(connID)
+	return g.issueConnectionID()
+}
+
+// RemoveAll removes all connection IDs. It is called when the session is closed.
+func (g *connIDGenerator) RemoveAll() {
+	for seq, connID := range g.activeConns {
+		g.retireConnectionID(connID)
+		delete(g.activeConns, seq)
+	}
+}
@@ -0,0 +1,139 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// mockConnIDGenerator generates connection IDs that start with a fixed prefix, followed by a counter
+type mockConnIDGenerator struct {
+	prefix []byte
+	// connIDLen is the length of the generated connection IDs.
+	// Setting it to a value other than len(prefix)+1 simulates a misbehaving generator.
+	connIDLen int
+	counter   byte
+}
+
+var _ ConnectionIDGenerator = &mockConnIDGenerator{}
+
+func (g *mockConnIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	g.counter++
+	c := make(ConnectionID, g.connIDLen)
+	copy(c, g.prefix)
+	c[len(c)-1] = g.counter
+	return c, nil
+}
+
+func (g *mockConnIDGenerator) ConnectionIDLen() int { return len(g.prefix) + 1 }
+
+var _ = Describe("Connection ID Generator", func() {
+	var (
+		g             *connIDGenerator
+		added         []protocol.ConnectionID
+		retired       []protocol.ConnectionID
+		queuedFrames  []wire.Frame
+		initialConnID = protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7}
+	)
+
+	BeforeEach(func() {
+		added = nil
+		retired = nil
+		queuedFrames = nil
+		g = newConnIDGenerator(
+			initialConnID,
+			&randomConnIDGenerator{connIDLen: initialConnID.Len()},
+			func(c protocol.ConnectionID) { added = append(added, c) },
+			func(c protocol.ConnectionID) { retired = append(retired, c) },
+			func(c protocol.ConnectionID) protocol.StatelessResetToken {
+				var token protocol.StatelessResetToken
+				copy(token[:], c)
+				return token
+			},
+			func(f wire.Frame) { queuedFrames = append(queuedFrames, f) },
+		)
+	})
+
+	It("issues connection IDs", func() {
+		Expect(g.IssueConnectionIDs()).To(Succeed())
+		Expect(added).To(HaveLen(protocol.NumIssuedConnectionIDs))
+		Expect(queuedFrames).To(HaveLen(protocol.NumIssuedConnectionIDs))
+		for i, f := range queuedFrames {
+			Expect(f).To(BeAssignableToTypeOf(&wire.NewConnectionIDFrame{}))
+			nf := f.(*wire.NewConnectionIDFrame)
+			Expect(nf.SequenceNumber).To(BeEquivalentTo(i + 1))
+			Expect(nf.ConnectionID).To(Equal(added[i]))
+			Expect(nf.ConnectionID.Len()).To(Equal(7))
+			Expect(nf.StatelessResetToken[:7]).To(Equal(nf.ConnectionID.Bytes()))
+		}
+	})
+
+	It("issues a new connection ID when one is retired", func() {
+		Expect(g.IssueConnectionIDs()).To(Succeed())
+		queuedFrames = nil
+		Expect(g.Retire(2)).To(Succeed())
+		Expect(retired).To(Equal([]protocol.ConnectionID{added[1]}))
+		Expect(queuedFrames).To(HaveLen(1))
+		nf := queuedFrames[0].(*wire.NewConnectionIDFrame)
+		Expect(nf.SequenceNumber).To(BeEquivalentTo(protocol.NumIssuedConnectionIDs + 1))
+		Expect(added).To(ContainElement(nf.ConnectionID))
+	})
+
+	It("retires the initial connection ID", func() {
+		Expect(g.Retire(0)).To(Succeed())
+		Expect(retired).To(Equal([]protocol.ConnectionID{initialConnID}))
+		Expect(added).To(HaveLen(1))
+	})
+
+	It("ignores duplicate retirements", func() {
+		Expect(g.IssueConnectionIDs()).To(Succeed())
+		Expect(g.Retire(1)).To(Succeed())
+		queuedFrames = nil
+		Expect(g.Retire(1)).To(Succeed())
+		Expect(retired).To(HaveLen(1))
+		Expect(queuedFrames).To(BeEmpty())
+	})
+
+	It("errors when a connection ID that wasn't issued yet is retired", func() {
+		Expect(g.IssueConnectionIDs()).To(Succeed())
+		err := g.Retire(protocol.NumIssuedConnectionIDs + 1)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidFrameData))
+	})
+
+	It("removes all connection IDs", func() {
+		Expect(g.IssueConnectionIDs()).To(Succeed())
+		g.RemoveAll()
+		Expect(retired).To(HaveLen(protocol.NumIssuedConnectionIDs + 1))
+		Expect(retired).To(ContainElement(initialConnID))
+		for _, c := range added {
+			Expect(retired).To(ContainElement(c))
+		}
+	})
+
+	It("uses the configured connection ID generator", func() {
+		g.generator = &mockConnIDGenerator{prefix: []byte{0xde, 0xad, 0xbe, 0xef}, connIDLen: 5}
+		Expect(g.IssueConnectionIDs()).To(Succeed())
+		Expect(added).To(Equal([]protocol.ConnectionID{
+			{0xde, 0xad, 0xbe, 0xef, 1},
+			{0xde, 0xad, 0xbe, 0xef, 2},
+			{0xde, 0xad, 0xbe, 0xef, 3},
+		}))
+	})
+
+	It("errors if the connection ID generator returns connection IDs of the wrong length", func() {
+		g.generator = &mockConnIDGenerator{prefix: []byte{0xde, 0xad, 0xbe, 0xef}, connIDLen: 6}
+		Expect(g.IssueConnectionIDs()).To(MatchError("connection ID generator returned a 6 byte connection ID (expected 5 bytes)"))
+		Expect(added).To(BeEmpty())
+	})
+
+	It("doesn't issue connection IDs when using zero-length connection IDs", func() {
+		g.generator = &randomConnIDGenerator{}
+		Expect(g.IssueConnectionIDs()).To(Succeed())
+		Expect(added).To(BeEmpty())
+		Expect(queuedFrames).To(BeEmpty())
+	})
+})
@@ -0,0 +1,98 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// A newConnID is a connection ID issued by the peer in a NEW_CONNECTION_ID frame
+type newConnID struct {
+	SequenceNumber      uint64
+	ConnectionID        protocol.ConnectionID
+	StatelessResetToken protocol.StatelessResetToken
+}
+
+// The connIDManager manages the connection IDs issued by the peer.
+// A new connection ID is used when migrating to a new path, such that the paths can't be linked by an observer.
+// Connection IDs that won't be used any more are retired using RETIRE_CONNECTION_ID frames.
+type connIDManager struct {
+	// the connection IDs that haven't been used yet, sorted by sequence number
+	queue []newConnID
+	// the highest sequence number of a connection ID that was taken from the queue.
+	// NEW_CONNECTION_ID frames with lower sequence numbers are retransmissions, and can be ignored.
+	highestUsed uint64
+
+	activeSequenceNumber uint64
+	activeConnectionID   protocol.ConnectionID
+
+	queueControlFrame func(wire.Frame)
+}
+
+func newConnIDManager(initialDestConnID protocol.ConnectionID, queueControlFrame func(wire.Frame)) *connIDManager {
+	return &connIDManager{
+		activeConnectionID: initialDestConnID,
+		queueControlFrame:  queueControlFrame,
+	}
+}
+
+// Add adds a connection ID received in a NEW_CONNECTION_ID frame
+func (h *connIDManager) Add(f *wire.NewConnectionIDFrame) error {
+	if f.SequenceNumber <= h.highestUsed {
+		return nil
+	}
+	// insert the connection ID at the right position, ignoring duplicates
+	i := 0
+	for ; i < len(h.queue); i++ {
+		if h.queue[i].SequenceNumber == f.SequenceNumber {
+			if !h.queue[i].ConnectionID.Equal(f.ConnectionID) {
+				return qerr.Error(qerr.InvalidFrameData, "received conflicting connection IDs for the same sequence number")
+			}
+			return nil
+		}
+		if h.queue[i].SequenceNumber > f.SequenceNumber {
+			break
+		}
+	}
+	if len(h.queue) >= protocol.MaxActiveConnectionIDs {
+		return qerr.Error(qerr.InvalidFrameData, "too many connection IDs issued")
+	}
+	h.queue = append(h.queue, newConnID{})
+	copy(h.queue[i+1:], h.queue[i:])
+	h.queue[i] = newConnID{
+		SequenceNumber:      f.SequenceNumber,
+		ConnectionID:        f.ConnectionID,
+		StatelessResetToken: f.StatelessResetToken,
+	}
+	return nil
+}
+
+// Get returns the connection ID that is currently used
+func (h *connIDManager) Get() protocol.ConnectionID {
+	return h.activeConnectionID
+}
+
+// Next takes the next unused connection ID from the queue.
+// It returns false if the peer didn't issue any unused connection IDs.
+// The connection ID must then either be passed to Use or to Retire.
+func (h *connIDManager) Next() (newConnID, bool) {
+	if len(h.queue) == 0 {
+		return newConnID{}, false
+	}
+	c := h.queue[0]
+	h.queue = h.queue[1:]
+	h.highestUsed = c.SequenceNumber
+	return c, true
+}
+
+// Use switches to a connection ID returned by Next, and retires the connection ID that was used before
+func (h *connIDManager) Use(c newConnID) {
+	h.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: h.activeSequenceNumber})
+	h.activeSequenceNumber = c.SequenceNumber
+	h.activeConnectionID = c.ConnectionID
+}
+
+// Retire retires a connection ID returned by Next, e.g. when the validation of the path it was used on failed
+func (h *connIDManager) Retire(c newConnID) {
+	h.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: c.SequenceNumber})
+}
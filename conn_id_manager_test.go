@@ -0,0 +1,105 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection ID Manager", func() {
+	var (
+		m             *connIDManager
+		queuedFrames  []wire.Frame
+		initialConnID = protocol.ConnectionID{1, 1, 1, 1}
+	)
+
+	BeforeEach(func() {
+		queuedFrames = nil
+		m = newConnIDManager(initialConnID, func(f wire.Frame) { queuedFrames = append(queuedFrames, f) })
+	})
+
+	It("returns the initial connection ID", func() {
+		Expect(m.Get()).To(Equal(initialConnID))
+		_, ok := m.Next()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("returns new connection IDs in order", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{
+			SequenceNumber:      1,
+			ConnectionID:        protocol.ConnectionID{1, 2, 3, 4},
+			StatelessResetToken: protocol.StatelessResetToken{0xde, 0xad, 0xbe, 0xef},
+		})).To(Succeed())
+		c, ok := m.Next()
+		Expect(ok).To(BeTrue())
+		Expect(c.SequenceNumber).To(BeEquivalentTo(1))
+		Expect(c.ConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4}))
+		Expect(c.StatelessResetToken).To(Equal(protocol.StatelessResetToken{0xde, 0xad, 0xbe, 0xef}))
+		c, ok = m.Next()
+		Expect(ok).To(BeTrue())
+		Expect(c.SequenceNumber).To(BeEquivalentTo(2))
+		_, ok = m.Next()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("ignores duplicates", func() {
+		f := &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4}}
+		Expect(m.Add(f)).To(Succeed())
+		Expect(m.Add(f)).To(Succeed())
+		_, ok := m.Next()
+		Expect(ok).To(BeTrue())
+		_, ok = m.Next()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("ignores retransmissions of connection IDs that were already used", func() {
+		f := &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4}}
+		Expect(m.Add(f)).To(Succeed())
+		c, _ := m.Next()
+		m.Use(c)
+		Expect(m.Add(f)).To(Succeed())
+		_, ok := m.Next()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("errors when the peer issues different connection IDs for the same sequence number", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4}})).To(Succeed())
+		err := m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{4, 3, 2, 1}})
+		Expect(err).To(MatchError("InvalidFrameData: received conflicting connection IDs for the same sequence number"))
+	})
+
+	It("errors when the peer issues too many connection IDs", func() {
+		for i := 1; i <= protocol.MaxActiveConnectionIDs; i++ {
+			Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: uint64(i), ConnectionID: protocol.ConnectionID{byte(i), 0, 0, 0}})).To(Succeed())
+		}
+		err := m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1000, ConnectionID: protocol.ConnectionID{1, 0, 0, 0}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidFrameData))
+	})
+
+	It("switches to a new connection ID, and retires the old one", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}})).To(Succeed())
+		c, _ := m.Next()
+		m.Use(c)
+		Expect(m.Get()).To(Equal(protocol.ConnectionID{1, 2, 3, 4}))
+		Expect(queuedFrames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}))
+		c, _ = m.Next()
+		m.Use(c)
+		Expect(m.Get()).To(Equal(protocol.ConnectionID{2, 2, 2, 2}))
+		Expect(queuedFrames).To(HaveLen(2))
+		Expect(queuedFrames[1]).To(Equal(&wire.RetireConnectionIDFrame{SequenceNumber: 1}))
+	})
+
+	It("retires connection IDs that weren't used", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4}})).To(Succeed())
+		c, _ := m.Next()
+		m.Retire(c)
+		Expect(m.Get()).To(Equal(initialConnID))
+		Expect(queuedFrames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}))
+	})
+})
@@ -6,6 +6,8 @@ import (
 	"net"
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -78,6 +80,30 @@ var _ = Describe("Connection", func() {
 		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
 	})
 
+	It("writes to a different address", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}
+		Expect(c.WriteTo([]byte("foobar"), addr)).To(Succeed())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		Expect(packetConn.dataWrittenTo).To(Equal(addr))
+		// the current remote address doesn't change
+		Expect(c.RemoteAddr().String()).To(Equal("192.168.100.200:1337"))
+	})
+
+	It("writes batches", func() {
+		Expect(c.WriteBatch([][]byte{[]byte("foo"), []byte("bar")})).To(Succeed())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
+	})
+
+	It("sets the ECN codepoint", func() {
+		Expect(c.ecn).To(Equal(protocol.ECNNon))
+		c.SetECN(protocol.ECT0)
+		Expect(c.ecn).To(Equal(protocol.ECT0))
+		// the ECN codepoint can't be set on a mockPacketConn
+		Expect(c.Write([]byte("foobar"))).To(Succeed())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+	})
+
 	It("reads", func() {
 		packetConn.dataToRead <- []byte("foo")
 		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1336}
@@ -111,6 +137,23 @@ var _ = Describe("Connection", func() {
 		Expect(c.RemoteAddr().String()).To(Equal(addr.String()))
 	})
 
+	It("replaces the packet conn", func() {
+		newPacketConn := newMockPacketConn()
+		newPacketConn.addr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 4321}
+		Expect(c.WriteBatch([][]byte{[]byte("foo")})).To(Succeed())
+		Expect(c.SetPacketConn(newPacketConn)).To(Equal(packetConn))
+		Expect(c.PacketConn()).To(Equal(newPacketConn))
+		Expect(c.LocalAddr()).To(Equal(newPacketConn.addr))
+		Expect(c.Write([]byte("foobar"))).To(Succeed())
+		Expect(c.WriteBatch([][]byte{[]byte("baz")})).To(Succeed())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foo")))
+		Expect(newPacketConn.dataWritten.Bytes()).To(Equal([]byte("foobarbaz")))
+		Expect(newPacketConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
+		Expect(c.Close()).To(Succeed())
+		Expect(newPacketConn.closed).To(BeTrue())
+		Expect(packetConn.closed).To(BeFalse())
+	})
+
 	It("closes", func() {
 		err := c.Close()
 		Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,155 @@
+package quic
+
+import (
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qlog"
+)
+
+// The connectionTracer passes the events of a connection to the qlog tracer, and to the Tracer set in the Config.
+// The qlog tracer is nil if qlog is disabled.
+type connectionTracer struct {
+	qlog   qlog.Tracer
+	tracer Tracer
+	connID protocol.ConnectionID
+}
+
+var _ qlog.Tracer = &connectionTracer{}
+
+// newConnectionTracer creates the tracer used by a session.
+// It returns nil if neither qlog nor a Tracer is used.
+func newConnectionTracer(qlogTracer qlog.Tracer, tracer Tracer, connID protocol.ConnectionID) qlog.Tracer {
+	if tracer == nil {
+		return qlogTracer
+	}
+	return &connectionTracer{
+		qlog:   qlogTracer,
+		tracer: tracer,
+		connID: connID,
+	}
+}
+
+func (t *connectionTracer) Export() error {
+	if t.qlog == nil {
+		return nil
+	}
+	return t.qlog.Export()
+}
+
+func (t *connectionTracer) StartedConnection(eventTime time.Time, local, remote net.Addr, version protocol.VersionNumber, srcConnID, destConnID protocol.ConnectionID) {
+	if t.qlog != nil {
+		t.qlog.StartedConnection(eventTime, local, remote, version, srcConnID, destConnID)
+	}
+	t.tracer.StartedConnection(t.connID)
+}
+
+func (t *connectionTracer) ReceivedTransportParameters(eventTime time.Time, params *handshake.TransportParameters) {
+	if t.qlog != nil {
+		t.qlog.ReceivedTransportParameters(eventTime, params)
+	}
+}
+
+func (t *connectionTracer) CompletedHandshake(eventTime time.Time) {
+	if t.qlog != nil {
+		t.qlog.CompletedHandshake(eventTime)
+	}
+	t.tracer.CompletedHandshake(t.connID)
+}
+
+func (t *connectionTracer) SentPacket(eventTime time.Time, hdr *wire.Header, packetSize protocol.ByteCount, encLevel protocol.EncryptionLevel, frames []wire.Frame) {
+	if t.qlog != nil {
+		t.qlog.SentPacket(eventTime, hdr, packetSize, encLevel, frames)
+	}
+	t.tracer.SentPacket(t.connID, newPacketHeader(hdr, packetSize, encLevel), newFrameInfos(frames))
+}
+
+func (t *connectionTracer) ReceivedPacket(eventTime time.Time, hdr *wire.Header, packetSize protocol.ByteCount, encLevel protocol.EncryptionLevel, frames []wire.Frame) {
+	if t.qlog != nil {
+		t.qlog.ReceivedPacket(eventTime, hdr, packetSize, encLevel, frames)
+	}
+	t.tracer.ReceivedPacket(t.connID, newPacketHeader(hdr, packetSize, encLevel), newFrameInfos(frames))
+}
+
+func (t *connectionTracer) DroppedPacket(eventTime time.Time, hdr *wire.Header, packetSize protocol.ByteCount, reason qlog.PacketDropReason) {
+	if t.qlog != nil {
+		t.qlog.DroppedPacket(eventTime, hdr, packetSize, reason)
+	}
+	t.tracer.DroppedPacket(t.connID, reason)
+}
+
+func (t *connectionTracer) LostPacket(eventTime time.Time, packetType protocol.PacketType, encLevel protocol.EncryptionLevel, pn protocol.PacketNumber) {
+	if t.qlog != nil {
+		t.qlog.LostPacket(eventTime, packetType, encLevel, pn)
+	}
+	t.tracer.LostPacket(t.connID, pn)
+}
+
+func (t *connectionTracer) UpdatedMetrics(eventTime time.Time, rttStats *congestion.RTTStats, cwnd, bytesInFlight protocol.ByteCount) {
+	if t.qlog != nil {
+		t.qlog.UpdatedMetrics(eventTime, rttStats, cwnd, bytesInFlight)
+	}
+	t.tracer.UpdatedCongestion(t.connID, cwnd, bytesInFlight)
+	t.tracer.UpdatedRTT(t.connID, rttStats)
+}
+
+func (t *connectionTracer) UpdatedStreamState(eventTime time.Time, id protocol.StreamID, state qlog.StreamState) {
+	if t.qlog != nil {
+		t.qlog.UpdatedStreamState(eventTime, id, state)
+	}
+}
+
+func (t *connectionTracer) ClosedConnection(eventTime time.Time, reason error) {
+	if t.qlog != nil {
+		t.qlog.ClosedConnection(eventTime, reason)
+	}
+	t.tracer.ClosedConnection(t.connID, reason)
+}
+
+func (t *connectionTracer) RetransmittedPacket(eventTime time.Time, pn protocol.PacketNumber) {
+	if t.qlog != nil {
+		t.qlog.RetransmittedPacket(eventTime, pn)
+	}
+	t.tracer.RetransmittedPacket(t.connID, pn)
+}
+
+func newPacketHeader(hdr *wire.Header, packetSize protocol.ByteCount, encLevel protocol.EncryptionLevel) *PacketHeader {
+	h := &PacketHeader{
+		Type:             qlog.PacketTypeName(hdr, encLevel),
+		PacketNumber:     hdr.PacketNumber,
+		Size:             packetSize,
+		SrcConnectionID:  hdr.SrcConnectionID,
+		DestConnectionID: hdr.DestConnectionID,
+	}
+	if hdr.IsLongHeader || hdr.VersionFlag {
+		h.Version = hdr.Version
+	}
+	return h
+}
+
+func newFrameInfos(frames []wire.Frame) []FrameInfo {
+	infos := make([]FrameInfo, len(frames))
+	for i, f := range frames {
+		infos[i].Type = wire.FrameName(f)
+		switch frame := f.(type) {
+		case *wire.StreamFrame:
+			infos[i].StreamID = frame.StreamID
+			infos[i].Length = protocol.ByteCount(len(frame.Data))
+		case *wire.RstStreamFrame:
+			infos[i].StreamID = frame.StreamID
+		case *wire.StopSendingFrame:
+			infos[i].StreamID = frame.StreamID
+		case *wire.MaxStreamDataFrame:
+			infos[i].StreamID = frame.StreamID
+		case *wire.StreamBlockedFrame:
+			infos[i].StreamID = frame.StreamID
+		case *wire.DatagramFrame:
+			infos[i].Length = protocol.ByteCount(len(frame.Data))
+		}
+	}
+	return infos
+}
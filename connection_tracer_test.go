@@ -0,0 +1,249 @@
+package quic
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/mocks"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qlog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type tracedPacket struct {
+	connID ConnectionID
+	hdr    *PacketHeader
+	frames []FrameInfo
+}
+
+type tracedDrop struct {
+	connID ConnectionID
+	reason PacketDropReason
+}
+
+// The recordingTracer records the events passed to a Tracer.
+type recordingTracer struct {
+	mutex           sync.Mutex
+	started         []ConnectionID
+	closed          []error
+	handshakes      int
+	retransmitted   []PacketNumber
+	vnSent          []ConnectionID
+	resetsSent      []ConnectionID
+	sent, received  []tracedPacket
+	lost            []PacketNumber
+	cwnd, inFlight  ByteCount
+	smoothedRTT     time.Duration
+	dropped         []tracedDrop
+	updatedRTTCalls int
+}
+
+var _ Tracer = &recordingTracer{}
+
+func (t *recordingTracer) StartedConnection(connID ConnectionID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.started = append(t.started, connID)
+}
+
+func (t *recordingTracer) ClosedConnection(_ ConnectionID, reason error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.closed = append(t.closed, reason)
+}
+
+func (t *recordingTracer) CompletedHandshake(ConnectionID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.handshakes++
+}
+
+func (t *recordingTracer) RetransmittedPacket(_ ConnectionID, pn PacketNumber) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.retransmitted = append(t.retransmitted, pn)
+}
+
+func (t *recordingTracer) SentVersionNegotiation(connID ConnectionID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.vnSent = append(t.vnSent, connID)
+}
+
+func (t *recordingTracer) SentStatelessReset(connID ConnectionID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.resetsSent = append(t.resetsSent, connID)
+}
+
+func (t *recordingTracer) SentPacket(connID ConnectionID, hdr *PacketHeader, frames []FrameInfo) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sent = append(t.sent, tracedPacket{connID: connID, hdr: hdr, frames: frames})
+}
+
+func (t *recordingTracer) ReceivedPacket(connID ConnectionID, hdr *PacketHeader, frames []FrameInfo) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.received = append(t.received, tracedPacket{connID: connID, hdr: hdr, frames: frames})
+}
+
+func (t *recordingTracer) LostPacket(_ ConnectionID, pn PacketNumber) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lost = append(t.lost, pn)
+}
+
+func (t *recordingTracer) UpdatedCongestion(_ ConnectionID, cwnd, bytesInFlight ByteCount) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.cwnd = cwnd
+	t.inFlight = bytesInFlight
+}
+
+func (t *recordingTracer) UpdatedRTT(_ ConnectionID, rttStats RTTStats) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.smoothedRTT = rttStats.SmoothedRTT()
+	t.updatedRTTCalls++
+}
+
+func (t *recordingTracer) DroppedPacket(connID ConnectionID, reason PacketDropReason) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.dropped = append(t.dropped, tracedDrop{connID: connID, reason: reason})
+}
+
+func (t *recordingTracer) getDropped() []tracedDrop {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.dropped
+}
+
+var _ = Describe("Connection Tracer", func() {
+	var (
+		qlogTracer *mocks.MockTracer
+		tracer     *recordingTracer
+		connID     protocol.ConnectionID
+	)
+
+	BeforeEach(func() {
+		qlogTracer = mocks.NewMockTracer(mockCtrl)
+		tracer = &recordingTracer{}
+		connID = protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+	})
+
+	It("returns the qlog tracer, if no Tracer is used", func() {
+		Expect(newConnectionTracer(qlogTracer, nil, connID)).To(Equal(qlogTracer))
+		Expect(newConnectionTracer(nil, nil, connID)).To(BeNil())
+	})
+
+	It("passes sent packets to both tracers", func() {
+		t := newConnectionTracer(qlogTracer, tracer, connID)
+		hdr := &wire.Header{
+			IsLongHeader:     true,
+			Type:             protocol.PacketTypeHandshake,
+			PacketNumber:     42,
+			SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+			DestConnectionID: protocol.ConnectionID{5, 6, 7, 8},
+			Version:          protocol.VersionTLS,
+		}
+		frames := []wire.Frame{
+			&wire.StreamFrame{StreamID: 5, Data: []byte("foobar")},
+			&wire.RstStreamFrame{StreamID: 7},
+			&wire.PingFrame{},
+		}
+		now := time.Now()
+		qlogTracer.EXPECT().SentPacket(now, hdr, protocol.ByteCount(1234), protocol.EncryptionUnencrypted, frames)
+		t.SentPacket(now, hdr, 1234, protocol.EncryptionUnencrypted, frames)
+		Expect(tracer.sent).To(HaveLen(1))
+		Expect(tracer.sent[0].connID).To(Equal(connID))
+		Expect(tracer.sent[0].hdr).To(Equal(&PacketHeader{
+			Type:             "handshake",
+			PacketNumber:     42,
+			Size:             1234,
+			SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+			DestConnectionID: protocol.ConnectionID{5, 6, 7, 8},
+			Version:          protocol.VersionTLS,
+		}))
+		Expect(tracer.sent[0].frames).To(Equal([]FrameInfo{
+			{Type: "STREAM", StreamID: 5, Length: 6},
+			{Type: "RST_STREAM", StreamID: 7},
+			{Type: "PING"},
+		}))
+	})
+
+	It("passes received packets to the Tracer, if qlog is disabled", func() {
+		t := newConnectionTracer(nil, tracer, connID)
+		hdr := &wire.Header{PacketNumber: 1337, DestConnectionID: connID, Version: protocol.VersionTLS}
+		t.ReceivedPacket(time.Now(), hdr, 100, protocol.EncryptionForwardSecure, []wire.Frame{&wire.DatagramFrame{Data: []byte("foo")}})
+		Expect(tracer.received).To(HaveLen(1))
+		Expect(tracer.received[0].hdr.Type).To(Equal("1RTT"))
+		// packets with a Short Header don't carry a version
+		Expect(tracer.received[0].hdr.Version).To(BeZero())
+		Expect(tracer.received[0].frames).To(Equal([]FrameInfo{{Type: "DATAGRAM", Length: 3}}))
+	})
+
+	It("passes lost and dropped packets to both tracers", func() {
+		t := newConnectionTracer(qlogTracer, tracer, connID)
+		qlogTracer.EXPECT().LostPacket(gomock.Any(), protocol.PacketType(0), protocol.EncryptionForwardSecure, protocol.PacketNumber(42))
+		t.LostPacket(time.Now(), 0, protocol.EncryptionForwardSecure, 42)
+		Expect(tracer.lost).To(Equal([]PacketNumber{42}))
+		hdr := &wire.Header{PacketNumber: 10}
+		qlogTracer.EXPECT().DroppedPacket(gomock.Any(), hdr, protocol.ByteCount(123), qlog.PacketDropKeyUnavailable)
+		t.DroppedPacket(time.Now(), hdr, 123, qlog.PacketDropKeyUnavailable)
+		Expect(tracer.getDropped()).To(Equal([]tracedDrop{{connID: connID, reason: PacketDropKeyUnavailable}}))
+	})
+
+	It("reports congestion and RTT updates", func() {
+		t := newConnectionTracer(qlogTracer, tracer, connID)
+		rttStats := &congestion.RTTStats{}
+		rttStats.UpdateRTT(25*time.Millisecond, 0, time.Now())
+		qlogTracer.EXPECT().UpdatedMetrics(gomock.Any(), rttStats, protocol.ByteCount(4321), protocol.ByteCount(1234))
+		t.UpdatedMetrics(time.Now(), rttStats, 4321, 1234)
+		Expect(tracer.cwnd).To(Equal(ByteCount(4321)))
+		Expect(tracer.inFlight).To(Equal(ByteCount(1234)))
+		Expect(tracer.smoothedRTT).To(Equal(25 * time.Millisecond))
+		Expect(tracer.updatedRTTCalls).To(Equal(1))
+	})
+
+	It("passes connection events to both tracers", func() {
+		t := newConnectionTracer(qlogTracer, tracer, connID)
+		qlogTracer.EXPECT().StartedConnection(gomock.Any(), nil, nil, protocol.VersionTLS, connID, connID)
+		t.StartedConnection(time.Now(), nil, nil, protocol.VersionTLS, connID, connID)
+		Expect(tracer.started).To(Equal([]ConnectionID{connID}))
+		qlogTracer.EXPECT().CompletedHandshake(gomock.Any())
+		t.CompletedHandshake(time.Now())
+		Expect(tracer.handshakes).To(Equal(1))
+		testErr := errors.New("test error")
+		qlogTracer.EXPECT().ClosedConnection(gomock.Any(), testErr)
+		t.ClosedConnection(time.Now(), testErr)
+		Expect(tracer.closed).To(Equal([]error{testErr}))
+	})
+
+	It("passes retransmissions to the Tracer", func() {
+		t := newConnectionTracer(qlogTracer, tracer, connID)
+		qlogTracer.EXPECT().RetransmittedPacket(gomock.Any(), protocol.PacketNumber(42))
+		t.RetransmittedPacket(time.Now(), 42)
+		Expect(tracer.retransmitted).To(Equal([]PacketNumber{42}))
+	})
+
+	It("only passes stream events and the export to the qlog tracer", func() {
+		t := newConnectionTracer(qlogTracer, tracer, connID)
+		qlogTracer.EXPECT().UpdatedStreamState(gomock.Any(), protocol.StreamID(5), qlog.StreamStateOpen)
+		t.UpdatedStreamState(time.Now(), 5, qlog.StreamStateOpen)
+		qlogTracer.EXPECT().Export()
+		Expect(t.Export()).To(Succeed())
+		// without qlog, these are no-ops
+		t = newConnectionTracer(nil, tracer, connID)
+		t.UpdatedStreamState(time.Now(), 5, qlog.StreamStateOpen)
+		t.ClosedConnection(time.Now(), nil)
+		Expect(t.Export()).To(Succeed())
+	})
+})
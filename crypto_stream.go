@@ -18,6 +18,7 @@ type cryptoStreamI interface {
 	setReadOffset(protocol.ByteCount)
 	// methods needed for flow control
 	getWindowUpdate() protocol.ByteCount
+	getReceiveWindow() protocol.ByteCount
 	handleMaxStreamDataFrame(*wire.MaxStreamDataFrame)
 }
 
@@ -0,0 +1,121 @@
+package quic
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+var (
+	errDatagramsNotEnabled   = errors.New("DATAGRAM frames are not enabled")
+	errDatagramsNotSupported = errors.New("the peer doesn't support DATAGRAM frames")
+)
+
+// The datagramQueue queues DATAGRAM frames for sending, and received DATAGRAM frames until they are read by the application.
+type datagramQueue struct {
+	sendQueue chan *wire.DatagramFrame
+	// nextFrame is the frame returned by Peek. It is only accessed from the session's run loop.
+	nextFrame *wire.DatagramFrame
+	rcvQueue  chan []byte
+
+	mutex sync.Mutex
+	// maxFrameSize is the maximum size of a DATAGRAM frame that can be sent.
+	// It is 0 until the peer's transport parameters are received, and if the peer doesn't support DATAGRAM frames.
+	maxFrameSize protocol.ByteCount
+
+	closeErr error
+	closed   chan struct{}
+
+	hasData func()
+	version protocol.VersionNumber
+	logger  utils.Logger
+}
+
+func newDatagramQueue(hasData func(), version protocol.VersionNumber, logger utils.Logger) *datagramQueue {
+	return &datagramQueue{
+		sendQueue: make(chan *wire.DatagramFrame, protocol.DatagramSendQueueLen),
+		rcvQueue:  make(chan []byte, protocol.DatagramRcvQueueLen),
+		closed:    make(chan struct{}),
+		hasData:   hasData,
+		version:   version,
+		logger:    logger,
+	}
+}
+
+// SetMaxFrameSize sets the maximum size of DATAGRAM frames that the peer accepts
+func (h *datagramQueue) SetMaxFrameSize(size protocol.ByteCount) {
+	h.mutex.Lock()
+	h.maxFrameSize = utils.MinByteCount(size, protocol.MaxDatagramFrameSize)
+	h.mutex.Unlock()
+}
+
+// AddAndWait queues a new DATAGRAM frame for sending.
+// It blocks until the frame could be queued, or the session is closed.
+func (h *datagramQueue) AddAndWait(data []byte) error {
+	f := &wire.DatagramFrame{DataLenPresent: true, Data: data}
+	h.mutex.Lock()
+	maxFrameSize := h.maxFrameSize
+	h.mutex.Unlock()
+	if maxFrameSize == 0 {
+		return errDatagramsNotSupported
+	}
+	if l := f.Length(h.version); l > maxFrameSize {
+		return fmt.Errorf("message too large: DATAGRAM frame would be %d bytes (maximum %d bytes)", l, maxFrameSize)
+	}
+
+	select {
+	case h.sendQueue <- f:
+		h.hasData()
+		return nil
+	case <-h.closed:
+		return h.closeErr
+	}
+}
+
+// Peek returns the next DATAGRAM frame that should be sent, without removing it from the queue.
+// It returns nil if there's no frame queued.
+func (h *datagramQueue) Peek() *wire.DatagramFrame {
+	if h.nextFrame != nil {
+		return h.nextFrame
+	}
+	select {
+	case h.nextFrame = <-h.sendQueue:
+	default:
+	}
+	return h.nextFrame
+}
+
+// Pop removes the frame returned by Peek from the queue
+func (h *datagramQueue) Pop() {
+	h.nextFrame = nil
+}
+
+// HandleDatagramFrame handles a received DATAGRAM frame
+func (h *datagramQueue) HandleDatagramFrame(f *wire.DatagramFrame) {
+	select {
+	case h.rcvQueue <- f.Data:
+	default:
+		h.logger.Debugf("Discarding DATAGRAM frame (%d bytes payload), since the receive queue is full", len(f.Data))
+	}
+}
+
+// Receive blocks until a DATAGRAM frame is received, or the session is closed
+func (h *datagramQueue) Receive() ([]byte, error) {
+	select {
+	case data := <-h.rcvQueue:
+		return data, nil
+	case <-h.closed:
+		return nil, h.closeErr
+	}
+}
+
+// CloseWithError closes the queue.
+// All pending and future calls to AddAndWait and Receive return the error.
+func (h *datagramQueue) CloseWithError(e error) {
+	h.closeErr = e
+	close(h.closed)
+}
@@ -0,0 +1,156 @@
+package quic
+
+import (
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Datagram Queue", func() {
+	var (
+		queue         *datagramQueue
+		queued        chan struct{}
+		maxDataLength int
+	)
+
+	BeforeEach(func() {
+		queued = make(chan struct{}, 100)
+		queue = newDatagramQueue(func() { queued <- struct{}{} }, versionIETFFrames, utils.DefaultLogger)
+		queue.SetMaxFrameSize(100)
+		// the DATAGRAM frame has a 1 byte type and a 2 byte length
+		maxDataLength = 100 - 3
+	})
+
+	Context("sending", func() {
+		It("returns nil when there's no frame queued", func() {
+			Expect(queue.Peek()).To(BeNil())
+		})
+
+		It("queues a DATAGRAM frame", func() {
+			Expect(queue.AddAndWait([]byte("foobar"))).To(Succeed())
+			Expect(queued).To(Receive())
+			f := queue.Peek()
+			Expect(f).To(Equal(&wire.DatagramFrame{DataLenPresent: true, Data: []byte("foobar")}))
+			// peeking again returns the same frame
+			Expect(queue.Peek()).To(Equal(f))
+			queue.Pop()
+			Expect(queue.Peek()).To(BeNil())
+		})
+
+		It("returns frames in the order they were queued", func() {
+			Expect(queue.AddAndWait([]byte("foo"))).To(Succeed())
+			Expect(queue.AddAndWait([]byte("bar"))).To(Succeed())
+			Expect(queue.Peek().Data).To(Equal([]byte("foo")))
+			queue.Pop()
+			Expect(queue.Peek().Data).To(Equal([]byte("bar")))
+		})
+
+		It("errors if the peer doesn't support DATAGRAM frames", func() {
+			queue = newDatagramQueue(func() {}, versionIETFFrames, utils.DefaultLogger)
+			Expect(queue.AddAndWait([]byte("foobar"))).To(MatchError(errDatagramsNotSupported))
+		})
+
+		It("errors when the message is too large", func() {
+			Expect(queue.AddAndWait(make([]byte, maxDataLength))).To(Succeed())
+			Expect(queue.AddAndWait(make([]byte, maxDataLength+1))).To(MatchError("message too large: DATAGRAM frame would be 101 bytes (maximum 100 bytes)"))
+		})
+
+		It("doesn't allow frames larger than what we support", func() {
+			queue.SetMaxFrameSize(10 * protocol.MaxDatagramFrameSize)
+			Expect(queue.maxFrameSize).To(Equal(protocol.MaxDatagramFrameSize))
+		})
+
+		It("blocks until there's space in the queue", func() {
+			for i := 0; i < protocol.DatagramSendQueueLen; i++ {
+				Expect(queue.AddAndWait([]byte("foobar"))).To(Succeed())
+			}
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(queue.AddAndWait([]byte("foobar"))).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(queue.Peek()).ToNot(BeNil())
+			queue.Pop()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns the error when the queue is closed", func() {
+			for i := 0; i < protocol.DatagramSendQueueLen; i++ {
+				Expect(queue.AddAndWait([]byte("foobar"))).To(Succeed())
+			}
+			testErr := errors.New("test error")
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(queue.AddAndWait([]byte("foobar"))).To(MatchError(testErr))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			queue.CloseWithError(testErr)
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("receiving", func() {
+		It("receives DATAGRAM frames", func() {
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foo")})
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("bar")})
+			data, err := queue.Receive()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foo")))
+			data, err = queue.Receive()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("bar")))
+		})
+
+		It("blocks until a DATAGRAM frame is received", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				data, err := queue.Receive()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foobar")})
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("drops DATAGRAM frames when the receive queue is full", func() {
+			for i := 0; i < protocol.DatagramRcvQueueLen+1; i++ {
+				queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte{byte(i)}})
+			}
+			for i := 0; i < protocol.DatagramRcvQueueLen; i++ {
+				data, err := queue.Receive()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte{byte(i)}))
+			}
+			testErr := errors.New("test error")
+			queue.CloseWithError(testErr)
+			_, err := queue.Receive()
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("returns the error when the queue is closed", func() {
+			testErr := errors.New("test error")
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := queue.Receive()
+				Expect(err).To(MatchError(testErr))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			queue.CloseWithError(testErr)
+			Eventually(done).Should(BeClosed())
+		})
+	})
+})
@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+var (
+	// ecnMsgLen is the length of the control message containing the TOS / Traffic Class byte
+	ecnMsgLen = syscall.CmsgSpace(4)
+	// ecnReceiveOOBLen is the size of the buffer used for the control messages of received packets.
+	// On a dual-stack socket, packets can either carry an IP_TOS or an IPV6_TCLASS control message.
+	ecnReceiveOOBLen = 2 * ecnMsgLen
+)
+
+// enableECNReceive asks the kernel to pass the TOS / Traffic Class byte of received packets.
+// On IPv6 sockets, IPv4 packets are received with an IP_TOS control message.
+func enableECNReceive(c *net.UDPConn, isIPv4 bool) bool {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		if isIPv4 {
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1)
+			return
+		}
+		// this fails for IPv6-only sockets
+		_ = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1)
+		serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVTCLASS, 1)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
+
+// parseECN reads the ECN codepoint from the control messages of a received packet.
+func parseECN(oob []byte) protocol.ECN {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return protocol.ECNNon
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_TOS && len(msg.Data) >= 1:
+			return protocol.ECN(msg.Data[0] & 0x3)
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_TCLASS && len(msg.Data) >= 4:
+			// the Traffic Class is passed as an int
+			return protocol.ECN(*(*int32)(unsafe.Pointer(&msg.Data[0])) & 0x3)
+		}
+	}
+	return protocol.ECNNon
+}
+
+// setECNMsg writes the control message that sets the ECN codepoint of a sent packet.
+// b must be at least ecnMsgLen bytes long.
+func setECNMsg(b []byte, ecn protocol.ECN, isIPv4 bool) []byte {
+	b = b[:ecnMsgLen]
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0]))
+	if isIPv4 {
+		h.Level = syscall.IPPROTO_IP
+		h.Type = syscall.IP_TOS
+	} else {
+		h.Level = syscall.IPPROTO_IPV6
+		h.Type = syscall.IPV6_TCLASS
+	}
+	h.SetLen(syscall.CmsgLen(4))
+	// the TOS / Traffic Class follows the (aligned) header
+	*(*int32)(unsafe.Pointer(&b[syscall.CmsgSpace(0)])) = int32(ecn)
+	return b
+}
@@ -0,0 +1,203 @@
+package quic
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// An eventLoopHandler is a session that runs on an event loop.
+type eventLoopHandler interface {
+	// handleEvents handles up to maxEvents pending events, without blocking.
+	// It returns true if events might still be pending, and if the run loop stopped.
+	handleEvents(maxEvents int) (pending, stopped bool)
+	// finishRunLoop is called after the run loop stopped.
+	finishRunLoop() error
+}
+
+// An eventLoopSession is a session that can be handed over to an event loop once its handshake completed.
+// It calls onClose after its run loop stopped.
+type eventLoopSession interface {
+	runOnEventLoop(l *eventLoop, onClose func())
+}
+
+// An eventLoopEntry is a session registered with an event loop.
+type eventLoopEntry struct {
+	loop    *eventLoop
+	handler eventLoopHandler
+	onClose func()
+	// timer is the timer of the session's run loop, set on the event loop's timer wheel
+	timer *wheelTimer
+
+	// Both are protected by the loop's mutex.
+	// queued is set by schedule, which is called from any goroutine, and cleared by the loop goroutine.
+	// removed is only set by the loop goroutine, so the loop goroutine may read it without holding the mutex.
+	queued  bool
+	removed bool
+}
+
+// schedule makes the event loop handle the session's pending events.
+// It can be called from any goroutine.
+func (e *eventLoopEntry) schedule() {
+	e.loop.schedule(e)
+}
+
+// An eventLoop runs the run loops of many sessions on a single goroutine.
+// Sessions are handed over to the event loop when their handshake completed.
+// The event loop then only handles a session when an event is pending:
+// a packet was received, data was queued for sending, the session was closed or going away,
+// or the timer of its run loop, which is set on the event loop's timer wheel, fired.
+type eventLoop struct {
+	mutex  sync.Mutex
+	ready  []*eventLoopEntry
+	wakeup chan struct{}
+
+	// only used by the loop goroutine
+	batch []*eventLoopEntry
+	wheel *timerWheel
+	timer *utils.Timer
+
+	closeChan chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// newEventLoop creates a new event loop, and starts its goroutine.
+func newEventLoop() *eventLoop {
+	l := &eventLoop{
+		wakeup:    make(chan struct{}, 1),
+		wheel:     newTimerWheel(time.Now(), protocol.TimerWheelGranularity, protocol.TimerWheelSlots),
+		timer:     utils.NewTimer(),
+		closeChan: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// newEntry registers a session with the event loop.
+// The session has to use the timer of the entry for its run loop, and call schedule on the entry to start running on the event loop.
+func (l *eventLoop) newEntry(h eventLoopHandler, onClose func()) *eventLoopEntry {
+	e := &eventLoopEntry{
+		loop:    l,
+		handler: h,
+		onClose: onClose,
+	}
+	e.timer = newWheelTimer(l.wheel, e.schedule)
+	return e
+}
+
+func (l *eventLoop) schedule(e *eventLoopEntry) {
+	l.mutex.Lock()
+	if e.queued || e.removed {
+		l.mutex.Unlock()
+		return
+	}
+	e.queued = true
+	wasEmpty := len(l.ready) == 0
+	l.ready = append(l.ready, e)
+	l.mutex.Unlock()
+
+	if wasEmpty {
+		select {
+		case l.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (l *eventLoop) run() {
+	defer close(l.done)
+
+	for {
+		l.wheel.Advance(time.Now())
+
+		l.mutex.Lock()
+		batch := l.ready
+		l.ready = l.batch[:0]
+		for _, e := range batch {
+			e.queued = false
+		}
+		l.mutex.Unlock()
+
+		if len(batch) == 0 {
+			deadline, ok := l.wheel.NextExpiry()
+			if !ok {
+				deadline = time.Now().Add(protocol.TimerWheelSlots * protocol.TimerWheelGranularity)
+			}
+			l.timer.Reset(deadline)
+			select {
+			case <-l.closeChan:
+				return
+			case <-l.wakeup:
+			case <-l.timer.Chan():
+				l.timer.SetRead()
+			}
+		}
+
+		for i, e := range batch {
+			l.handle(e)
+			batch[i] = nil
+		}
+		l.batch = batch
+	}
+}
+
+func (l *eventLoop) handle(e *eventLoopEntry) {
+	// The session might have been scheduled again while the event loop handled the events that closed it.
+	// removed is only written by the loop goroutine (holding the mutex), so it can be read here without the mutex.
+	if e.removed {
+		return
+	}
+	pending, stopped := e.handler.handleEvents(protocol.MaxEventLoopIterations)
+	if !stopped {
+		if pending {
+			l.schedule(e)
+		}
+		return
+	}
+	l.mutex.Lock()
+	e.removed = true
+	l.mutex.Unlock()
+	e.timer.Stop()
+	// Closing the session sends a CONNECTION_CLOSE, which shouldn't block the other sessions.
+	go func() {
+		_ = e.handler.finishRunLoop()
+		e.onClose()
+	}()
+}
+
+// close stops the event loop.
+// The sessions running on it must be closed before.
+func (l *eventLoop) close() {
+	l.closeOnce.Do(func() { close(l.closeChan) })
+	<-l.done
+}
+
+// An eventLoopGroup distributes sessions over multiple event loops.
+type eventLoopGroup struct {
+	loops []*eventLoop
+	next  uint32
+}
+
+func newEventLoopGroup(numLoops int) *eventLoopGroup {
+	g := &eventLoopGroup{loops: make([]*eventLoop, numLoops)}
+	for i := range g.loops {
+		g.loops[i] = newEventLoop()
+	}
+	return g
+}
+
+// get returns the event loop for the next session
+func (g *eventLoopGroup) get() *eventLoop {
+	return g.loops[atomic.AddUint32(&g.next, 1)%uint32(len(g.loops))]
+}
+
+func (g *eventLoopGroup) close() {
+	for _, l := range g.loops {
+		l.close()
+	}
+}
@@ -0,0 +1,136 @@
+package quic
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a mockEventLoopHandler handles one event every time handleEvents is called
+type mockEventLoopHandler struct {
+	pendingEvents int32
+	stop          int32
+	handledEvents chan int // receives the number of calls to handleEvents
+	numCalls      int
+	finished      chan struct{}
+}
+
+func newMockEventLoopHandler() *mockEventLoopHandler {
+	return &mockEventLoopHandler{
+		handledEvents: make(chan int, 100),
+		finished:      make(chan struct{}),
+	}
+}
+
+func (h *mockEventLoopHandler) handleEvents(maxEvents int) (bool, bool) {
+	h.numCalls++
+	h.handledEvents <- h.numCalls
+	if atomic.LoadInt32(&h.stop) == 1 {
+		return false, true
+	}
+	pending := atomic.AddInt32(&h.pendingEvents, -int32(maxEvents))
+	if pending < 0 {
+		atomic.StoreInt32(&h.pendingEvents, 0)
+	}
+	return pending > 0, false
+}
+
+func (h *mockEventLoopHandler) finishRunLoop() error {
+	close(h.finished)
+	return nil
+}
+
+var _ = Describe("Event Loop", func() {
+	var loop *eventLoop
+
+	BeforeEach(func() {
+		loop = newEventLoop()
+	})
+
+	AfterEach(func() {
+		loop.close()
+	})
+
+	It("handles the events of scheduled sessions", func() {
+		h := newMockEventLoopHandler()
+		e := loop.newEntry(h, func() {})
+		e.schedule()
+		Eventually(h.handledEvents).Should(Receive(Equal(1)))
+		Consistently(h.handledEvents).ShouldNot(Receive())
+		e.schedule()
+		Eventually(h.handledEvents).Should(Receive(Equal(2)))
+	})
+
+	It("schedules sessions again, if events are still pending", func() {
+		h := newMockEventLoopHandler()
+		atomic.StoreInt32(&h.pendingEvents, 3*protocol.MaxEventLoopIterations)
+		e := loop.newEntry(h, func() {})
+		e.schedule()
+		Eventually(h.handledEvents).Should(Receive(Equal(1)))
+		Eventually(h.handledEvents).Should(Receive(Equal(2)))
+		Eventually(h.handledEvents).Should(Receive(Equal(3)))
+		Consistently(h.handledEvents).ShouldNot(Receive())
+	})
+
+	It("handles multiple sessions", func() {
+		h1 := newMockEventLoopHandler()
+		h2 := newMockEventLoopHandler()
+		e1 := loop.newEntry(h1, func() {})
+		e2 := loop.newEntry(h2, func() {})
+		e1.schedule()
+		e2.schedule()
+		Eventually(h1.handledEvents).Should(Receive())
+		Eventually(h2.handledEvents).Should(Receive())
+	})
+
+	It("schedules sessions when their timer fires", func() {
+		h := newMockEventLoopHandler()
+		e := loop.newEntry(h, func() {})
+		deadline := time.Now().Add(20 * time.Millisecond)
+		// the timer must only be set from the loop goroutine
+		loop.newEntry(handlerFunc(func() { e.timer.Reset(deadline) }), func() {}).schedule()
+		Eventually(h.handledEvents).Should(Receive(Equal(1)))
+		Expect(time.Now()).To(BeTemporally(">=", deadline))
+		Expect(e.timer.Chan()).To(Receive(Equal(deadline)))
+	})
+
+	It("finishes the run loop of sessions that stopped, and removes them", func() {
+		h := newMockEventLoopHandler()
+		closed := make(chan struct{})
+		e := loop.newEntry(h, func() { close(closed) })
+		atomic.StoreInt32(&h.stop, 1)
+		e.schedule()
+		Eventually(h.handledEvents).Should(Receive(Equal(1)))
+		Eventually(h.finished).Should(BeClosed())
+		Eventually(closed).Should(BeClosed())
+		e.schedule()
+		Consistently(h.handledEvents).ShouldNot(Receive())
+	})
+
+	It("distributes sessions over the event loops of a group", func() {
+		g := newEventLoopGroup(3)
+		defer g.close()
+		loops := make(map[*eventLoop]int)
+		for i := 0; i < 6; i++ {
+			loops[g.get()]++
+		}
+		Expect(loops).To(HaveLen(3))
+		for _, l := range g.loops {
+			Expect(loops[l]).To(Equal(2))
+		}
+	})
+})
+
+// handlerFunc is an eventLoopHandler that calls a function when handling events
+type handlerFunc func()
+
+func (f handlerFunc) handleEvents(int) (bool, bool) {
+	f()
+	return false, false
+}
+
+func (handlerFunc) finishRunLoop() error { return nil }
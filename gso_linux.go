@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// udpSegment is the UDP_SEGMENT socket option, see linux/udp.h
+	udpSegment = 103
+	// maxGSOSegments is the maximum number of segments the kernel accepts for a single GSO write (UDP_MAX_SEGMENTS)
+	maxGSOSegments = 64
+	// maxGSOSize is the maximum size of a UDP datagram passed to the kernel
+	maxGSOSize = 65507
+)
+
+// udpSegmentMsgLen is the length of the control message containing the segment size
+var udpSegmentMsgLen = syscall.CmsgSpace(2)
+
+// isGSOSupported checks if the kernel supports UDP generic segmentation offload (GSO) for this socket
+func isGSOSupported(c *net.UDPConn) bool {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		_, serr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpSegment)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
+
+// isGSOError checks if a write failed because GSO couldn't be used.
+// This happens if the network interface doesn't support checksum offloading.
+func isGSOError(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	sysErr, ok := opErr.Err.(*os.SyscallError)
+	return ok && sysErr.Err == syscall.EIO
+}
+
+// numGSOSegments returns the number of packets that can be sent in a single GSO write.
+// The kernel splits the data into segments of the size of the first packet.
+// Therefore, all packets must have the same size, except for the last one, which may be smaller.
+func numGSOSegments(packets [][]byte) int {
+	segmentSize := len(packets[0])
+	var n, size int
+	for n < len(packets) && n < maxGSOSegments {
+		l := len(packets[n])
+		if l > segmentSize || size+l > maxGSOSize {
+			break
+		}
+		size += l
+		n++
+		if l < segmentSize {
+			break
+		}
+	}
+	return n
+}
+
+// setUDPSegmentSizeMsg writes the control message that sets the GSO segment size.
+// b must be at least udpSegmentMsgLen bytes long.
+func setUDPSegmentSizeMsg(b []byte, size uint16) []byte {
+	b = b[:udpSegmentMsgLen]
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = syscall.IPPROTO_UDP
+	h.Type = udpSegment
+	h.SetLen(syscall.CmsgLen(2))
+	// the segment size follows the (aligned) header
+	*(*uint16)(unsafe.Pointer(&b[syscall.CmsgSpace(0)])) = size
+	return b
+}
@@ -1,6 +1,7 @@
 package h2quic
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -22,10 +23,22 @@ import (
 
 type roundTripperOpts struct {
 	DisableCompression bool
+	PushHandler        func(*http.Request, *http.Response)
 }
 
 var dialAddr = quic.DialAddr
 
+// errorCodeStreamCancelled is the error code used to reset a stream when a request is canceled
+const errorCodeStreamCancelled quic.ErrorCode = 6
+
+// errorCodeStreamRefused is the error code used to reset the stream of a request that the server refused, since it is going away.
+// The QUIC layer uses the same error code for the streams that it refuses.
+const errorCodeStreamRefused quic.ErrorCode = 8
+
+// errGoAway is returned for requests that the server refused, since it is going away.
+// These requests were not processed, so they can be retried on a new connection.
+var errGoAway = errors.New("h2quic: server sent GOAWAY and refused the request")
+
 // client is a HTTP2 client doing QUIC requests
 type client struct {
 	mutex sync.RWMutex
@@ -36,6 +49,7 @@ type client struct {
 
 	hostname     string
 	handshakeErr error
+	dialErr      error // set if the QUIC handshake failed
 	dialOnce     sync.Once
 	dialer       func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
@@ -46,6 +60,14 @@ type client struct {
 	requestWriter *requestWriter
 
 	responses map[protocol.StreamID]chan *http.Response
+	// Once the response was received, the trailers are delivered on these channels.
+	// The channel is removed when the response body was read or closed.
+	trailers map[protocol.StreamID]chan http.Header
+
+	closed         bool // set when dialing failed, or the session was closed
+	activeRequests int  // the number of requests that are using a stream
+
+	goingAway bool // set when the server refused a request, since it is going away
 
 	logger utils.Logger
 }
@@ -72,6 +94,7 @@ func newClient(
 	return &client{
 		hostname:      authorityAddr("https", hostname),
 		responses:     make(map[protocol.StreamID]chan *http.Response),
+		trailers:      make(map[protocol.StreamID]chan http.Header),
 		tlsConf:       tlsConfig,
 		config:        config,
 		opts:          opts,
@@ -83,15 +106,20 @@ func newClient(
 
 // dial dials the connection
 func (c *client) dial() error {
+	var sess quic.Session
 	var err error
 	if c.dialer != nil {
-		c.session, err = c.dialer("udp", c.hostname, c.tlsConf, c.config)
+		sess, err = c.dialer("udp", c.hostname, c.tlsConf, c.config)
 	} else {
-		c.session, err = dialAddr(c.hostname, c.tlsConf, c.config)
+		sess, err = dialAddr(c.hostname, c.tlsConf, c.config)
 	}
 	if err != nil {
+		c.dialErr = err
 		return err
 	}
+	c.mutex.Lock()
+	c.session = sess
+	c.mutex.Unlock()
 
 	// once the version has been negotiated, open the header stream
 	c.headerStream, err = c.session.OpenStream()
@@ -111,7 +139,7 @@ func (c *client) handleHeaderStream() {
 	for err == nil {
 		err = c.readResponse(h2framer, decoder)
 	}
-	if quicErr, ok := err.(*qerr.QuicError); !ok || quicErr.ErrorCode != qerr.PeerGoingAway {
+	if !errors.Is(err, qerr.PeerGoingAway) {
 		c.logger.Debugf("Error handling header stream: %s", err)
 	}
 	c.headerErr = qerr.Error(qerr.InvalidHeadersStreamData, err.Error())
@@ -124,6 +152,9 @@ func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) er
 	if err != nil {
 		return err
 	}
+	if ppframe, ok := frame.(*http2.PushPromiseFrame); ok {
+		return c.handlePushPromise(ppframe, decoder)
+	}
 	hframe, ok := frame.(*http2.HeadersFrame)
 	if !ok {
 		return errors.New("not a headers frame")
@@ -134,10 +165,22 @@ func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) er
 		return fmt.Errorf("cannot read header fields: %s", err.Error())
 	}
 
+	id := protocol.StreamID(hframe.StreamID)
 	c.mutex.RLock()
-	responseChan, ok := c.responses[protocol.StreamID(hframe.StreamID)]
+	trailerChan, isTrailer := c.trailers[id]
+	responseChan, isResponse := c.responses[id]
 	c.mutex.RUnlock()
-	if !ok {
+	// a HEADERS frame received after the response are the trailers
+	if isTrailer {
+		c.handleTrailers(id, trailerChan, mhframe)
+		return nil
+	}
+	if !isResponse {
+		// Trailers that were not declared in the Trailer header might arrive after the response body was closed.
+		if hframe.StreamEnded() {
+			c.logger.Debugf("Ignoring trailers for stream %d", id)
+			return nil
+		}
 		return fmt.Errorf("response channel for stream %d not found", hframe.StreamID)
 	}
 
@@ -145,10 +188,121 @@ func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) er
 	if err != nil {
 		return err
 	}
+	c.mutex.Lock()
+	c.trailers[id] = make(chan http.Header, 1)
+	c.mutex.Unlock()
 	responseChan <- rsp
 	return nil
 }
 
+func (c *client) handleTrailers(id protocol.StreamID, trailerChan chan<- http.Header, frame *http2.MetaHeadersFrame) {
+	trailer := make(http.Header)
+	for _, hf := range frame.RegularFields() {
+		key := http.CanonicalHeaderKey(hf.Name)
+		trailer[key] = append(trailer[key], hf.Value)
+	}
+	select {
+	case trailerChan <- trailer:
+	default:
+		c.logger.Debugf("Ignoring duplicate trailers for stream %d", id)
+	}
+}
+
+// handleRefusedRequest is called when the server refused a request, since it is going away.
+// The client stops using the session, and closes it as soon as the remaining requests are done.
+func (c *client) handleRefusedRequest() {
+	c.logger.Debugf("Server is going away, and refused a request")
+	c.mutex.Lock()
+	c.goingAway = true
+	c.mutex.Unlock()
+}
+
+// isRefusedError says if the error was returned for a stream that the server reset to refuse the request.
+func isRefusedError(err error) bool {
+	serr, ok := err.(quic.StreamError)
+	return ok && serr.ErrorCode() == errorCodeStreamRefused
+}
+
+func (c *client) handlePushPromise(frame *http2.PushPromiseFrame, decoder *hpack.Decoder) error {
+	if !frame.HeadersEnded() {
+		return errors.New("http2 header continuation not implemented")
+	}
+	promisedStreamID := protocol.StreamID(frame.PromiseID)
+	// pushed streams are opened by the server, and therefore have even stream IDs
+	if promisedStreamID%2 != 0 {
+		return fmt.Errorf("invalid promised stream ID %d", promisedStreamID)
+	}
+	fields, err := decoder.DecodeFull(frame.HeaderBlockFragment())
+	if err != nil {
+		return fmt.Errorf("cannot read header fields: %s", err.Error())
+	}
+	req, err := requestFromHeaders(fields)
+	if err != nil {
+		return err
+	}
+	// requestFromHeaders populates the fields of a server request
+	req.URL.Scheme = "https"
+	req.URL.Host = req.Host
+	req.RequestURI = ""
+	req.TLS = nil
+
+	responseChan := make(chan *http.Response)
+	c.mutex.Lock()
+	if _, ok := c.responses[promisedStreamID]; ok {
+		c.mutex.Unlock()
+		return fmt.Errorf("received a duplicate PUSH_PROMISE for stream %d", promisedStreamID)
+	}
+	c.responses[promisedStreamID] = responseChan
+	c.mutex.Unlock()
+
+	go c.handlePushedResponse(req, promisedStreamID, responseChan)
+	return nil
+}
+
+// handlePushedResponse waits for the response headers of a pushed stream, and passes the response to the PushHandler.
+func (c *client) handlePushedResponse(req *http.Request, id protocol.StreamID, responseChan <-chan *http.Response) {
+	var res *http.Response
+	select {
+	case res = <-responseChan:
+	case <-c.headerErrored:
+		return
+	}
+	c.mutex.Lock()
+	delete(c.responses, id)
+	// trailers are not supported for pushed responses
+	delete(c.trailers, id)
+	c.mutex.Unlock()
+
+	sess, ok := c.session.(streamCreator)
+	if !ok {
+		c.logger.Debugf("Ignoring pushed stream %d", id)
+		return
+	}
+	dataStream, err := sess.GetOrOpenStream(id)
+	if err != nil || dataStream == nil {
+		c.logger.Debugf("Couldn't open pushed stream %d: %v", id, err)
+		return
+	}
+	// we never send any data on a pushed stream
+	if c.opts.PushHandler == nil {
+		// in gQUIC, the error code doesn't matter, so just use 0 here
+		dataStream.CancelRead(0)
+		dataStream.Close()
+		return
+	}
+	dataStream.Close()
+
+	isHead := (req.Method == "HEAD")
+	res = setLength(res, isHead, false)
+	if isHead {
+		res.Body = noBody
+	} else {
+		res.Body = dataStream
+	}
+	res.Request = req
+	c.opts.PushHandler(req, res)
+}
+
 // Roundtrip executes a request and returns a response
 func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	// TODO: add port to address, if it doesn't have one
@@ -160,17 +314,39 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	c.dialOnce.Do(func() {
-		c.handshakeErr = c.dial()
+		if c.handshakeErr = c.dial(); c.handshakeErr != nil {
+			c.mutex.Lock()
+			c.closed = true
+			c.mutex.Unlock()
+		}
 	})
 
 	if c.handshakeErr != nil {
 		return nil, c.handshakeErr
 	}
 
-	hasBody := (req.Body != nil)
+	c.mutex.Lock()
+	if c.goingAway {
+		c.mutex.Unlock()
+		return nil, errGoAway
+	}
+	c.activeRequests++
+	c.mutex.Unlock()
+	// The request uses a stream until the response body was read or closed.
+	var dataStream quic.Stream
+	requestDone := func() { c.requestDone(dataStream) }
+	var bodyReturned bool
+	defer func() {
+		if !bodyReturned {
+			requestDone()
+		}
+	}()
+
+	hasBody := req.Body != nil && req.Body != http.NoBody
 
 	responseChan := make(chan *http.Response)
-	dataStream, err := c.session.OpenStreamSync()
+	var err error
+	dataStream, err = c.session.OpenStreamSync()
 	if err != nil {
 		_ = c.CloseWithError(err)
 		return nil, err
@@ -180,7 +356,7 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	c.mutex.Unlock()
 
 	var requestedGzip bool
-	if !c.opts.DisableCompression && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != "HEAD" {
+	if !c.opts.DisableCompression && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != "HEAD" && req.Method != "CONNECT" {
 		requestedGzip = true
 	}
 	// TODO: add support for trailers
@@ -192,23 +368,30 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	resc := make(chan error, 1)
+	// bodySent is closed once the request body was sent (or sending it failed)
+	bodySent := make(chan struct{})
 	if hasBody {
 		go func() {
-			resc <- c.writeRequestBody(dataStream, req.Body)
+			defer close(bodySent)
+			resc <- c.writeRequestBody(dataStream, req.Body, actualContentLength(req))
 		}()
+	} else {
+		close(bodySent)
 	}
+	// The response body is read from the peekingStream, which notices when the server refuses the request.
+	peekingStream := newPeekingStream(dataStream)
 
 	var res *http.Response
 
 	var receivedResponse bool
-	var bodySent bool
-
-	if !hasBody {
-		bodySent = true
-	}
 
+	// The body is streamed while waiting for the response, and for as long as the server reads it afterwards.
+	// This allows uploads of unknown length, and request bodies that are sent for as long as the response is used
+	// (e.g. for CONNECT tunnels).
+	// Errors that occur while sending the body are only returned if they happen before the response arrived.
 	ctx := req.Context()
-	for !(bodySent && receivedResponse) {
+	peeked := peekingStream.peeked
+	for !receivedResponse {
 		select {
 		case res = <-responseChan:
 			receivedResponse = true
@@ -216,18 +399,33 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 			delete(c.responses, dataStream.StreamID())
 			c.mutex.Unlock()
 		case err := <-resc:
-			bodySent = true
+			resc = nil
 			if err != nil {
+				c.mutex.Lock()
+				delete(c.responses, dataStream.StreamID())
+				c.mutex.Unlock()
+				if isRefusedError(err) {
+					c.handleRefusedRequest()
+					return nil, errGoAway
+				}
 				return nil, err
 			}
 		case <-ctx.Done():
-			// error code 6 signals that stream was canceled
-			dataStream.CancelRead(6)
-			dataStream.CancelWrite(6)
+			cancelStream(dataStream)
 			c.mutex.Lock()
 			delete(c.responses, dataStream.StreamID())
 			c.mutex.Unlock()
 			return nil, ctx.Err()
+		case <-peeked:
+			peeked = nil
+			if peekingStream.refused() {
+				cancelStream(dataStream)
+				c.mutex.Lock()
+				delete(c.responses, dataStream.StreamID())
+				c.mutex.Unlock()
+				c.handleRefusedRequest()
+				return nil, errGoAway
+			}
 		case <-c.headerErrored:
 			// an error occurred on the header stream
 			_ = c.CloseWithError(c.headerErr)
@@ -244,7 +442,7 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	if streamEnded || isHead {
 		res.Body = noBody
 	} else {
-		res.Body = dataStream
+		res.Body = peekingStream
 		if requestedGzip && res.Header.Get("Content-Encoding") == "gzip" {
 			res.Header.Del("Content-Encoding")
 			res.Header.Del("Content-Length")
@@ -252,41 +450,269 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 			res.Body = &gzipReader{body: res.Body}
 			res.Uncompressed = true
 		}
+		body := newResponseBody(ctx, res.Body, dataStream, bodySent, requestDone)
+		if res.Trailer != nil {
+			c.mutex.RLock()
+			trailerChan := c.trailers[dataStream.StreamID()]
+			c.mutex.RUnlock()
+			body.readTrailers = func() error { return c.readTrailers(ctx, res, trailerChan) }
+		}
+		res.Body = body
+		bodyReturned = true
 	}
 
 	res.Request = req
 	return res, nil
 }
 
-func (c *client) writeRequestBody(dataStream quic.Stream, body io.ReadCloser) (err error) {
+// readTrailers waits for the trailers, and sets them on the response.
+// It is called when the response body was read completely.
+func (c *client) readTrailers(ctx context.Context, res *http.Response, trailerChan <-chan http.Header) error {
+	select {
+	case trailer := <-trailerChan:
+		for k, v := range trailer {
+			res.Trailer[k] = v
+		}
+		return nil
+	case <-c.headerErrored:
+		return c.headerErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeRequestBody sends the request body on the stream, as data becomes available.
+// Writing blocks while flow control doesn't allow sending more data.
+// The contentLength is -1 if the length of the body is unknown.
+// If reading the body fails, or the body doesn't match the contentLength, the stream is reset.
+func (c *client) writeRequestBody(dataStream quic.Stream, body io.ReadCloser, contentLength int64) (err error) {
 	defer func() {
 		cerr := body.Close()
 		if err == nil {
-			// TODO: what to do with dataStream here? Maybe reset it?
 			err = cerr
 		}
 	}()
 
-	_, err = io.Copy(dataStream, body)
+	var r io.Reader = body
+	if contentLength >= 0 {
+		// read one byte more than announced, to detect bodies that are too long
+		r = io.LimitReader(body, contentLength+1)
+	}
+	n, err := io.Copy(dataStream, r)
+	if err == nil && contentLength >= 0 && n != contentLength {
+		err = fmt.Errorf("h2quic: request body has length %d, but Content-Length is %d", n, contentLength)
+	}
 	if err != nil {
-		// TODO: what to do with dataStream here? Maybe reset it?
+		dataStream.CancelWrite(errorCodeStreamCancelled)
 		return err
 	}
 	return dataStream.Close()
 }
 
+// requestDone is called when a request doesn't use its stream any more.
+// The stream is nil if opening the stream failed.
+// If the server is going away, the session is closed after the last request.
+func (c *client) requestDone(str quic.Stream) {
+	c.mutex.Lock()
+	if str != nil {
+		delete(c.trailers, str.StreamID())
+	}
+	c.activeRequests--
+	closeSession := c.goingAway && c.activeRequests == 0
+	c.mutex.Unlock()
+	if closeSession {
+		c.session.Close(nil)
+	}
+}
+
+// canTakeNewRequest says if a new request can be sent without waiting for the server's stream limit.
+func (c *client) canTakeNewRequest() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.isClosedLocked() {
+		return false
+	}
+	// The server's stream limit is only known after the handshake completed.
+	if c.session == nil {
+		return true
+	}
+	params := c.session.ConnectionState().PeerTransportParameters
+	if params == nil {
+		return true
+	}
+	// the header stream counts towards the stream limit
+	return uint64(c.activeRequests)+1 < params.MaxBidiStreams
+}
+
+// handshakeFailed says if the QUIC handshake failed.
+// It must only be called after RoundTrip returned.
+func (c *client) handshakeFailed() bool {
+	return c.dialErr != nil
+}
+
+// isClosed says if dialing failed, if the session was closed, or if the server is going away
+func (c *client) isClosed() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.isClosedLocked()
+}
+
+func (c *client) isClosedLocked() bool {
+	if c.closed || c.goingAway {
+		return true
+	}
+	if c.session == nil {
+		return false
+	}
+	select {
+	case <-c.session.Context().Done():
+		return true
+	default:
+		return false
+	}
+}
+
 // Close closes the client
 func (c *client) CloseWithError(e error) error {
-	if c.session == nil {
+	c.mutex.Lock()
+	c.closed = true
+	sess := c.session
+	c.mutex.Unlock()
+	if sess == nil {
 		return nil
 	}
-	return c.session.Close(e)
+	return sess.Close(e)
 }
 
 func (c *client) Close() error {
 	return c.CloseWithError(nil)
 }
 
+// cancelStream resets a stream in both directions
+func cancelStream(str quic.Stream) {
+	str.CancelRead(errorCodeStreamCancelled)
+	str.CancelWrite(errorCodeStreamCancelled)
+}
+
+// A peekingStream is a data stream, whose first byte is read while waiting for the response.
+// This way, the client notices when the server resets the stream to refuse the request.
+type peekingStream struct {
+	quic.Stream
+
+	peeked chan struct{} // closed when the first Read returned
+	b      [1]byte
+	n      int
+	err    error
+}
+
+func newPeekingStream(str quic.Stream) *peekingStream {
+	s := &peekingStream{
+		Stream: str,
+		peeked: make(chan struct{}),
+	}
+	go func() {
+		s.n, s.err = str.Read(s.b[:])
+		close(s.peeked)
+	}()
+	return s
+}
+
+// refused says if the server reset the stream to refuse the request.
+// It must only be called after peeked was closed.
+func (s *peekingStream) refused() bool {
+	return s.n == 0 && isRefusedError(s.err)
+}
+
+func (s *peekingStream) Read(p []byte) (int, error) {
+	<-s.peeked
+	if s.n == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		return s.Stream.Read(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = s.b[0]
+	s.n = 0
+	return 1, s.err
+}
+
+// A responseBody is the body of a response.
+// It calls onDone once, as soon as the body was read completely or closed.
+// When the request context is canceled, the stream is reset, and Read returns the context's error.
+// If the request body is still being sent when the response body is closed, the sending side of the stream is reset.
+type responseBody struct {
+	io.ReadCloser
+
+	str      quic.Stream
+	bodySent <-chan struct{} // closed once the request body was sent
+	ctx      context.Context
+	once     sync.Once
+	done     chan struct{} // closed when onDone is called
+	onDone   func()
+	// readTrailers is called when the body was read completely, if the response declared trailers
+	readTrailers func() error
+}
+
+func newResponseBody(ctx context.Context, body io.ReadCloser, str quic.Stream, bodySent <-chan struct{}, onDone func()) *responseBody {
+	b := &responseBody{
+		ReadCloser: body,
+		str:        str,
+		bodySent:   bodySent,
+		ctx:        ctx,
+		done:       make(chan struct{}),
+		onDone:     onDone,
+	}
+	// the context of requests created without a context is never canceled
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				cancelStream(str)
+			case <-b.done:
+			}
+		}()
+	}
+	return b
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		if ctxErr := b.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		} else if err == io.EOF && b.readTrailers != nil {
+			if terr := b.readTrailers(); terr != nil {
+				err = terr
+			}
+			b.readTrailers = nil
+		}
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	b.finish()
+	select {
+	case <-b.bodySent:
+		return b.ReadCloser.Close()
+	default:
+		// Closing the stream would end the request body, although it wasn't sent completely.
+		// Resetting the stream makes the go routine sending the body return.
+		return b.str.CancelWrite(errorCodeStreamCancelled)
+	}
+}
+
+func (b *responseBody) finish() {
+	b.once.Do(func() {
+		close(b.done)
+		b.onDone()
+	})
+}
+
 // copied from net/transport.go
 
 // authorityAddr returns a given authority (a host/IP, or host:port / ip:port)
@@ -7,6 +7,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 
 	"golang.org/x/net/http2"
@@ -220,7 +221,7 @@ var _ = Describe("Client", func() {
 				rsp, err := client.RoundTrip(request)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(rsp).To(Equal(teapot))
-				Expect(rsp.Body).To(Equal(dataStream))
+				Expect(rsp.Body.(*responseBody).ReadCloser.(*peekingStream).Stream).To(Equal(dataStream))
 				Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
 				Expect(rsp.Request).To(Equal(request))
 				close(done)
@@ -232,6 +233,229 @@ var _ = Describe("Client", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("counts the request as active until the response body is closed", func() {
+			session.connectionState.PeerTransportParameters = &quic.PeerTransportParameters{MaxBidiStreams: 2}
+			Expect(client.canTakeNewRequest()).To(BeTrue())
+			rspChan := make(chan *http.Response)
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				rspChan <- rsp
+			}()
+			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+			// the header stream and the request stream are open
+			Expect(client.canTakeNewRequest()).To(BeFalse())
+			injectResponse(5, &http.Response{})
+			var rsp *http.Response
+			Eventually(rspChan).Should(Receive(&rsp))
+			Expect(client.canTakeNewRequest()).To(BeFalse())
+			Expect(rsp.Body.Close()).To(Succeed())
+			Expect(client.canTakeNewRequest()).To(BeTrue())
+			// closing the body again doesn't change the count
+			Expect(rsp.Body.Close()).To(Succeed())
+			Expect(client.activeRequests).To(BeZero())
+		})
+
+		It("says when the session was closed", func() {
+			Expect(client.isClosed()).To(BeFalse())
+			session.ctxCancel()
+			Expect(client.isClosed()).To(BeTrue())
+			Expect(client.canTakeNewRequest()).To(BeFalse())
+		})
+
+		It("is closed if dialing fails", func() {
+			testErr := errors.New("handshake error")
+			client.session = nil
+			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				return nil, testErr
+			}
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError(testErr))
+			Expect(client.isClosed()).To(BeTrue())
+			Expect(client.handshakeFailed()).To(BeTrue())
+		})
+
+		It("doesn't report a handshake failure if opening the header stream fails", func() {
+			testErr := errors.New("stream open error")
+			client.session = nil
+			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				return &mockSession{streamOpenErr: testErr}, nil
+			}
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError(testErr))
+			Expect(client.handshakeFailed()).To(BeFalse())
+		})
+
+		It("resets the stream when the request is canceled while the response body is read", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			request = request.WithContext(ctx)
+			rspChan := make(chan *http.Response)
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				rspChan <- rsp
+			}()
+			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+			injectResponse(5, &http.Response{})
+			var rsp *http.Response
+			Eventually(rspChan).Should(Receive(&rsp))
+			readErr := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				_, err := rsp.Body.Read(make([]byte, 10))
+				readErr <- err
+			}()
+			Consistently(readErr).ShouldNot(Receive())
+			cancel()
+			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
+			Expect(dataStream.canceledWrite).To(BeTrue())
+			// the canceled stream makes Read return
+			close(dataStream.unblockRead)
+			Eventually(readErr).Should(Receive(MatchError(context.Canceled)))
+			Expect(client.activeRequests).To(BeZero())
+		})
+
+		It("doesn't reset the stream when the request is canceled after the response body was closed", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			request = request.WithContext(ctx)
+			rspChan := make(chan *http.Response)
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				rspChan <- rsp
+			}()
+			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+			injectResponse(5, &http.Response{})
+			var rsp *http.Response
+			Eventually(rspChan).Should(Receive(&rsp))
+			Expect(rsp.Body.Close()).To(Succeed())
+			cancel()
+			Consistently(func() bool { return dataStream.reset }).Should(BeFalse())
+		})
+
+		Context("refused requests", func() {
+			It("returns an error when the server refuses the request", func() {
+				dataStream.readErr = &streamError{errorCode: errorCodeStreamRefused}
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(errGoAway))
+				Expect(dataStream.reset).To(BeTrue())
+				Expect(client.isClosed()).To(BeTrue())
+				Expect(session.closed).To(BeTrue())
+				Expect(session.closedWithError).ToNot(HaveOccurred())
+			})
+
+			It("returns an error when the server refuses the request while the request body is sent", func() {
+				dataStream.writeErr = &streamError{errorCode: errorCodeStreamRefused}
+				request.Body = ioutil.NopCloser(bytes.NewReader([]byte("foobar")))
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(errGoAway))
+				Expect(client.isClosed()).To(BeTrue())
+			})
+
+			It("doesn't treat other stream errors as refused requests", func() {
+				dataStream.readErr = &streamError{errorCode: errorCodeStreamCancelled}
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+				Consistently(rspChan).ShouldNot(Receive())
+				injectResponse(5, &http.Response{})
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				_, err := rsp.Body.Read(make([]byte, 10))
+				Expect(err).To(MatchError(dataStream.readErr))
+				Expect(client.isClosed()).To(BeFalse())
+			})
+
+			It("finishes the active requests, and closes the session afterwards", func() {
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+				client.handleRefusedRequest()
+				Expect(client.isClosed()).To(BeTrue())
+				injectResponse(5, &http.Response{})
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				Expect(session.closed).To(BeFalse())
+				Expect(rsp.Body.Close()).To(Succeed())
+				Expect(session.closed).To(BeTrue())
+			})
+
+			It("doesn't send new requests", func() {
+				client.handleRefusedRequest()
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(errGoAway))
+				Expect(client.canTakeNewRequest()).To(BeFalse())
+			})
+		})
+
+		It("does CONNECT requests, without waiting for the request body to be sent", func() {
+			pr, pw := io.Pipe()
+			req, err := http.NewRequest("CONNECT", "https://quic.clemente.io:1337", pr)
+			Expect(err).ToNot(HaveOccurred())
+			req.Host = "www.example.com:443"
+			rspChan := make(chan *http.Response)
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				rspChan <- rsp
+			}()
+			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+			injectResponse(5, &http.Response{StatusCode: 200})
+			var rsp *http.Response
+			Eventually(rspChan).Should(Receive(&rsp))
+			Expect(rsp.Body.(*responseBody).ReadCloser.(*peekingStream).Stream).To(Equal(dataStream))
+			headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
+			Expect(headers).To(HaveKeyWithValue(":method", "CONNECT"))
+			Expect(headers).To(HaveKeyWithValue(":authority", "www.example.com:443"))
+			Expect(headers).ToNot(HaveKey(":path"))
+			Expect(headers).ToNot(HaveKey("accept-encoding"))
+			// the request body is sent on the stream
+			_, err = pw.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() []byte { return dataStream.dataWritten.Bytes() }).Should(Equal([]byte("foobar")))
+			Expect(pw.Close()).To(Succeed())
+		})
+
+		It("sets the trailers when the response body was read", func() {
+			close(dataStream.unblockRead)
+			dataStream.dataToRead.Write([]byte("foobar"))
+			rspChan := make(chan *http.Response)
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				rspChan <- rsp
+			}()
+			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+			trailerChan := make(chan http.Header, 1)
+			client.mutex.Lock()
+			client.trailers[5] = trailerChan
+			client.mutex.Unlock()
+			injectResponse(5, &http.Response{Trailer: http.Header{"Foo": nil}})
+			var rsp *http.Response
+			Eventually(rspChan).Should(Receive(&rsp))
+			trailerChan <- http.Header{"Foo": []string{"bar"}}
+			data, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+			Expect(rsp.Trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+			Expect(client.trailers).To(BeEmpty())
+		})
+
 		It("errors if a request without a body is canceled", func() {
 			done := make(chan struct{})
 			ctx, cancel := context.WithCancel(context.Background())
@@ -433,8 +657,104 @@ var _ = Describe("Client", func() {
 				}()
 				injectResponse(5, response)
 				Eventually(rspChan).Should(Receive(Equal(response)))
+				Eventually(func() bool { return request.Body.(*mockBody).closed }).Should(BeTrue())
 				Expect(dataStream.dataWritten.Bytes()).To(Equal(requestBody))
 				Expect(dataStream.closed).To(BeTrue())
+			})
+
+			It("returns the response before the body was sent completely", func() {
+				pr, pw := io.Pipe()
+				request.Body = pr
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				_, err := pw.Write([]byte("foo"))
+				Expect(err).ToNot(HaveOccurred())
+				injectResponse(5, response)
+				Eventually(rspChan).Should(Receive(Equal(response)))
+				Expect(dataStream.closed).To(BeFalse())
+				_, err = pw.Write([]byte("bar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pw.Close()).To(Succeed())
+				Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+				Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+				Expect(dataStream.canceledWrite).To(BeFalse())
+			})
+
+			It("resets the stream when the response body is closed while a body of unknown length is sent", func() {
+				pr, pw := io.Pipe()
+				request.Body = pr
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				_, err := pw.Write([]byte("foo"))
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(func() []byte { return dataStream.dataWritten.Bytes() }).Should(Equal([]byte("foo")))
+				injectResponse(5, response)
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				Expect(rsp.Body.Close()).To(Succeed())
+				Expect(dataStream.canceledWrite).To(BeTrue())
+				Expect(dataStream.cancelWriteCode).To(Equal(errorCodeStreamCancelled))
+				// the go routine sending the body returns on the next write
+				_, err = pw.Write([]byte("bar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pw.Close()).To(Succeed())
+				Consistently(func() bool { return dataStream.closed }).Should(BeFalse())
+				Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foo")))
+			})
+
+			It("resets the stream when reading the body fails after the response was received", func() {
+				pr, pw := io.Pipe()
+				request.Body = pr
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				injectResponse(5, response)
+				Eventually(rspChan).Should(Receive(Equal(response)))
+				pw.CloseWithError(errors.New("testErr"))
+				Eventually(func() bool { return dataStream.canceledWrite }).Should(BeTrue())
+				Expect(dataStream.closed).To(BeFalse())
+			})
+
+			It("resets the stream when the body is shorter than the Content-Length", func() {
+				request.ContentLength = int64(len(requestBody)) + 1
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).To(MatchError(ContainSubstring("Content-Length")))
+					Expect(rsp).To(BeNil())
+					close(done)
+				}()
+				Eventually(done).Should(BeClosed())
+				Expect(dataStream.canceledWrite).To(BeTrue())
+				Expect(dataStream.closed).To(BeFalse())
+			})
+
+			It("resets the stream when the body is longer than the Content-Length", func() {
+				request.ContentLength = int64(len(requestBody)) - 1
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := client.RoundTrip(request)
+					Expect(err).To(MatchError(ContainSubstring("Content-Length")))
+					close(done)
+				}()
+				Eventually(done).Should(BeClosed())
+				Expect(dataStream.canceledWrite).To(BeTrue())
 				Expect(request.Body.(*mockBody).closed).To(BeTrue())
 			})
 
@@ -539,7 +859,8 @@ var _ = Describe("Client", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Expect(rsp).ToNot(BeNil())
 					data := make([]byte, 11)
-					rsp.Body.Read(data)
+					_, err = io.ReadFull(rsp.Body, data)
+					Expect(err).ToNot(HaveOccurred())
 					Expect(rsp.ContentLength).ToNot(BeEquivalentTo(-1))
 					Expect(data).To(Equal([]byte("not gzipped")))
 					close(done)
@@ -560,7 +881,7 @@ var _ = Describe("Client", func() {
 					rsp, err := client.RoundTrip(request)
 					Expect(err).ToNot(HaveOccurred())
 					data := make([]byte, 12)
-					_, err = rsp.Body.Read(data)
+					_, err = io.ReadFull(rsp.Body, data)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(rsp.ContentLength).ToNot(BeEquivalentTo(-1))
 					Expect(data).To(Equal([]byte("gzipped data")))
@@ -600,6 +921,50 @@ var _ = Describe("Client", func() {
 				Expect(rsp.Header).To(HaveKeyWithValue("Cache-Control", []string{"private"}))
 			})
 
+			It("reads trailers", func() {
+				var headers bytes.Buffer
+				enc := hpack.NewEncoder(&headers)
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				enc.WriteField(hpack.HeaderField{Name: "trailer", Value: "foo"})
+				Expect(h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      23,
+					EndHeaders:    true,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				headers.Reset()
+				enc.WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+				Expect(h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      23,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				responseChan := client.responses[23]
+				go client.handleHeaderStream()
+				var rsp *http.Response
+				Eventually(responseChan).Should(Receive(&rsp))
+				Expect(rsp.Trailer).To(HaveKey("Foo"))
+				client.mutex.RLock()
+				trailerChan := client.trailers[23]
+				client.mutex.RUnlock()
+				Eventually(trailerChan).Should(Receive(Equal(http.Header{"Foo": []string{"bar"}})))
+				Expect(client.headerErrored).ToNot(BeClosed())
+			})
+
+			It("ignores trailers for responses that were already handled", func() {
+				var headers bytes.Buffer
+				enc := hpack.NewEncoder(&headers)
+				enc.WriteField(hpack.HeaderField{Name: "foo", Value: "bar"})
+				Expect(h2framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      1337,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: headers.Bytes(),
+				})).To(Succeed())
+				go client.handleHeaderStream()
+				Consistently(client.headerErrored).ShouldNot(BeClosed())
+			})
+
 			It("errors if the H2 frame is not a HeadersFrame", func() {
 				h2framer.WritePing(true, [8]byte{0, 0, 0, 0, 0, 0, 0, 0})
 				client.handleHeaderStream()
@@ -634,6 +999,125 @@ var _ = Describe("Client", func() {
 				Expect(client.headerErr.ErrorCode).To(Equal(qerr.InvalidHeadersStreamData))
 				Expect(client.headerErr.ErrorMessage).To(ContainSubstring("response channel for stream 1337 not found"))
 			})
+
+			Context("server push", func() {
+				var pushStream *mockStream
+
+				writePushPromise := func(promiseID uint32) {
+					var headers bytes.Buffer
+					enc := hpack.NewEncoder(&headers)
+					enc.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})
+					enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "https"})
+					enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "quic.clemente.io"})
+					enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/style.css"})
+					enc.WriteField(hpack.HeaderField{Name: "cache-control", Value: "no-cache"})
+					err := h2framer.WritePushPromise(http2.PushPromiseParam{
+						StreamID:      23,
+						PromiseID:     promiseID,
+						EndHeaders:    true,
+						BlockFragment: headers.Bytes(),
+					})
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				writeResponseHeaders := func(id uint32) {
+					var headers bytes.Buffer
+					enc := hpack.NewEncoder(&headers)
+					enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+					enc.WriteField(hpack.HeaderField{Name: "content-length", Value: "7"})
+					err := h2framer.WriteHeaders(http2.HeadersFrameParam{
+						StreamID:      id,
+						EndHeaders:    true,
+						BlockFragment: headers.Bytes(),
+					})
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				BeforeEach(func() {
+					pushStream = newMockStream(2)
+					session.dataStream = pushStream
+				})
+
+				It("passes pushed responses to the PushHandler", func() {
+					type push struct {
+						req *http.Request
+						rsp *http.Response
+					}
+					pushChan := make(chan push, 1)
+					client.opts.PushHandler = func(req *http.Request, rsp *http.Response) {
+						pushChan <- push{req: req, rsp: rsp}
+					}
+					writePushPromise(2)
+					writeResponseHeaders(2)
+					go client.handleHeaderStream()
+					var p push
+					Eventually(pushChan).Should(Receive(&p))
+					Expect(p.req.Method).To(Equal("GET"))
+					Expect(p.req.URL.String()).To(Equal("https://quic.clemente.io/style.css"))
+					Expect(p.req.Host).To(Equal("quic.clemente.io"))
+					Expect(p.req.Header).To(HaveKeyWithValue("Cache-Control", []string{"no-cache"}))
+					Expect(p.req.RequestURI).To(BeEmpty())
+					Expect(p.rsp.StatusCode).To(Equal(200))
+					Expect(p.rsp.ContentLength).To(BeEquivalentTo(7))
+					Expect(p.rsp.Request).To(Equal(p.req))
+					Expect(p.rsp.Body).To(Equal(pushStream))
+					Expect(pushStream.closed).To(BeTrue())
+					Expect(pushStream.reset).To(BeFalse())
+					client.mutex.RLock()
+					defer client.mutex.RUnlock()
+					Expect(client.responses).ToNot(HaveKey(protocol.StreamID(2)))
+				})
+
+				It("cancels pushed streams if no PushHandler is set", func() {
+					writePushPromise(2)
+					writeResponseHeaders(2)
+					go client.handleHeaderStream()
+					Eventually(func() bool { return pushStream.closed }).Should(BeTrue())
+					Expect(pushStream.reset).To(BeTrue())
+					Consistently(client.headerErrored).ShouldNot(BeClosed())
+				})
+
+				It("errors if the promised stream ID is not a server-initiated stream", func() {
+					writePushPromise(3)
+					client.handleHeaderStream()
+					Eventually(client.headerErrored).Should(BeClosed())
+					Expect(client.headerErr.ErrorCode).To(Equal(qerr.InvalidHeadersStreamData))
+					Expect(client.headerErr.ErrorMessage).To(ContainSubstring("invalid promised stream ID 3"))
+				})
+
+				It("errors on duplicate PUSH_PROMISEs", func() {
+					writePushPromise(2)
+					writePushPromise(2)
+					client.handleHeaderStream()
+					Eventually(client.headerErrored).Should(BeClosed())
+					Expect(client.headerErr.ErrorCode).To(Equal(qerr.InvalidHeadersStreamData))
+					Expect(client.headerErr.ErrorMessage).To(ContainSubstring("received a duplicate PUSH_PROMISE for stream 2"))
+				})
+			})
 		})
 	})
 })
+
+var _ = Describe("peeking stream", func() {
+	It("returns the peeked byte, and then reads from the stream", func() {
+		str := newMockStream(5)
+		str.dataToRead.Write([]byte("foobar"))
+		s := newPeekingStream(str)
+		Eventually(s.peeked).Should(BeClosed())
+		Expect(s.refused()).To(BeFalse())
+		Expect(str.dataToRead.Len()).To(Equal(5))
+		data, err := ioutil.ReadAll(io.LimitReader(s, 6))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("returns the error of the first read", func() {
+		str := newMockStream(5)
+		str.readErr = &streamError{errorCode: errorCodeStreamRefused}
+		s := newPeekingStream(str)
+		Eventually(s.peeked).Should(BeClosed())
+		Expect(s.refused()).To(BeTrue())
+		_, err := s.Read(make([]byte, 10))
+		Expect(err).To(MatchError(str.readErr))
+	})
+})
@@ -37,17 +37,29 @@ func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
 		httpHeaders.Set("Cookie", strings.Join(httpHeaders["Cookie"], "; "))
 	}
 
-	if len(path) == 0 || len(authority) == 0 || len(method) == 0 {
-		return nil, errors.New(":path, :authority and :method must not be empty")
-	}
-
-	u, err := url.Parse(path)
-	if err != nil {
-		return nil, err
+	var u *url.URL
+	requestURI := path
+	if method == "CONNECT" {
+		// CONNECT requests don't have a :path, and the :authority is the target of the tunnel
+		if len(path) != 0 || len(authority) == 0 {
+			return nil, errors.New(":path must be empty and :authority must not be empty for CONNECT requests")
+		}
+		u = &url.URL{Host: authority}
+		requestURI = authority
+	} else {
+		if len(path) == 0 || len(authority) == 0 || len(method) == 0 {
+			return nil, errors.New(":path, :authority and :method must not be empty")
+		}
+		var err error
+		u, err = url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var contentLength int64
 	if len(contentLengthStr) > 0 {
+		var err error
 		contentLength, err = strconv.ParseInt(contentLengthStr, 10, 64)
 		if err != nil {
 			return nil, err
@@ -64,12 +76,17 @@ func requestFromHeaders(headers []hpack.HeaderField) (*http.Request, error) {
 		Body:          nil,
 		ContentLength: contentLength,
 		Host:          authority,
-		RequestURI:    path,
+		RequestURI:    requestURI,
 		TLS:           &tls.ConnectionState{},
 	}, nil
 }
 
+// hostnameFromRequest returns the host that the request is sent to.
+// For CONNECT requests, this is the host of the URL, since the Host is the target of the tunnel.
 func hostnameFromRequest(req *http.Request) string {
+	if req.Method == "CONNECT" && req.URL != nil && len(req.URL.Host) > 0 {
+		return req.URL.Host
+	}
 	if len(req.Host) > 0 {
 		return req.Host
 	}
@@ -2,6 +2,7 @@ package h2quic
 
 import (
 	"io"
+	"net"
 
 	quic "github.com/lucas-clemente/quic-go"
 )
@@ -9,18 +10,31 @@ import (
 type requestBody struct {
 	requestRead bool
 	dataStream  quic.Stream
+	// onReset is called when the client reset the stream
+	onReset func()
+	// onTimeout is called when the read deadline of the stream expired
+	onTimeout func()
 }
 
 // make sure the requestBody can be used as a http.Request.Body
 var _ io.ReadCloser = &requestBody{}
 
-func newRequestBody(stream quic.Stream) *requestBody {
-	return &requestBody{dataStream: stream}
+func newRequestBody(stream quic.Stream, onReset, onTimeout func()) *requestBody {
+	return &requestBody{dataStream: stream, onReset: onReset, onTimeout: onTimeout}
 }
 
 func (b *requestBody) Read(p []byte) (int, error) {
 	b.requestRead = true
-	return b.dataStream.Read(p)
+	n, err := b.dataStream.Read(p)
+	if err == nil {
+		return n, nil
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		b.onTimeout()
+	} else if b.dataStream.ReadTerminationReason() == quic.StreamResetByPeer {
+		b.onReset()
+	}
+	return n, err
 }
 
 func (b *requestBody) Close() error {
@@ -1,20 +1,28 @@
 package h2quic
 
 import (
+	"errors"
+	"os"
+
+	quic "github.com/lucas-clemente/quic-go"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Request body", func() {
 	var (
-		stream *mockStream
-		rb     *requestBody
+		stream          *mockStream
+		rb              *requestBody
+		resetReported   bool
+		timeoutReported bool
 	)
 
 	BeforeEach(func() {
 		stream = &mockStream{}
 		stream.dataToRead.Write([]byte("foobar")) // provides data to be read
-		rb = newRequestBody(stream)
+		resetReported = false
+		timeoutReported = false
+		rb = newRequestBody(stream, func() { resetReported = true }, func() { timeoutReported = true })
 	})
 
 	It("reads from the stream", func() {
@@ -30,6 +38,30 @@ var _ = Describe("Request body", func() {
 		Expect(rb.requestRead).To(BeTrue())
 	})
 
+	It("reports when the client reset the stream", func() {
+		stream.readErr = errors.New("stream reset")
+		stream.terminationReason = quic.StreamResetByPeer
+		_, err := rb.Read(make([]byte, 1))
+		Expect(err).To(MatchError("stream reset"))
+		Expect(resetReported).To(BeTrue())
+	})
+
+	It("doesn't report a reset if the stream was canceled locally", func() {
+		stream.readErr = errors.New("stream canceled")
+		stream.terminationReason = quic.StreamCanceledLocally
+		_, err := rb.Read(make([]byte, 1))
+		Expect(err).To(MatchError("stream canceled"))
+		Expect(resetReported).To(BeFalse())
+	})
+
+	It("reports when the read deadline expired", func() {
+		stream.readErr = os.ErrDeadlineExceeded
+		_, err := rb.Read(make([]byte, 1))
+		Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+		Expect(timeoutReported).To(BeTrue())
+		Expect(resetReported).To(BeFalse())
+	})
+
 	It("doesn't close the stream when closing the request body", func() {
 		Expect(stream.closed).To(BeFalse())
 		err := rb.Close()
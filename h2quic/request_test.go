@@ -92,6 +92,29 @@ var _ = Describe("Request", func() {
 		Expect(err).To(MatchError(":path, :authority and :method must not be empty"))
 	})
 
+	It("populates CONNECT requests", func() {
+		headers := []hpack.HeaderField{
+			{Name: ":authority", Value: "quic.clemente.io:443"},
+			{Name: ":method", Value: "CONNECT"},
+		}
+		req, err := requestFromHeaders(headers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.Method).To(Equal("CONNECT"))
+		Expect(req.URL.Host).To(Equal("quic.clemente.io:443"))
+		Expect(req.Host).To(Equal("quic.clemente.io:443"))
+		Expect(req.RequestURI).To(Equal("quic.clemente.io:443"))
+	})
+
+	It("errors for CONNECT requests with a path", func() {
+		headers := []hpack.HeaderField{
+			{Name: ":path", Value: "/foo"},
+			{Name: ":authority", Value: "quic.clemente.io:443"},
+			{Name: ":method", Value: "CONNECT"},
+		}
+		_, err := requestFromHeaders(headers)
+		Expect(err).To(MatchError(":path must be empty and :authority must not be empty for CONNECT requests"))
+	})
+
 	Context("extracting the hostname from a request", func() {
 		var url *url.URL
 
@@ -114,6 +137,15 @@ var _ = Describe("Request", func() {
 			Expect(hostnameFromRequest(req)).To(Equal("quic.clemente.io:1337"))
 		})
 
+		It("uses req.URL.Host for CONNECT requests", func() {
+			req := &http.Request{
+				Method: "CONNECT",
+				Host:   "www.example.org:443",
+				URL:    url,
+			}
+			Expect(hostnameFromRequest(req)).To(Equal("quic.clemente.io:1337"))
+		})
+
 		It("returns an empty hostname if nothing is set", func() {
 			Expect(hostnameFromRequest(&http.Request{})).To(BeEmpty())
 		})
@@ -1,8 +1,12 @@
 package h2quic
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,9 +18,23 @@ import (
 	"golang.org/x/net/http2/hpack"
 )
 
+// The StreamHijacker is implemented by the http.ResponseWriter passed to handlers.
+// It allows a handler to take over the QUIC stream of a request,
+// e.g. to use it as a bidirectional byte pipe for a CONNECT request.
+type StreamHijacker interface {
+	// HijackStream returns the stream of the request.
+	// After that, the server doesn't use the stream any more, and the handler is responsible for closing it.
+	HijackStream() (quic.Stream, error)
+}
+
+// responseBufferSize is the size of the buffer used for the response body, if write buffering is enabled.
+const responseBufferSize = 4 << 10
+
 type responseWriter struct {
 	dataStreamID protocol.StreamID
 	dataStream   quic.Stream
+	// buf buffers small writes to the data stream, it is nil if write buffering is disabled
+	buf *bufio.Writer
 
 	headerStream      quic.Stream
 	headerStreamMutex *sync.Mutex
@@ -24,6 +42,14 @@ type responseWriter struct {
 	header        http.Header
 	status        int // status code passed to WriteHeader
 	headerWritten bool
+	// trailers are the trailers declared in the Trailer header
+	trailers     []string
+	bytesWritten int
+
+	// req is the request this response is written for
+	req *http.Request
+	// push is used to push a request, it is nil for pushed responses
+	push func(*http.Request) error
 
 	logger utils.Logger
 }
@@ -61,6 +87,17 @@ func (w *responseWriter) WriteHeader(status int) {
 	enc.WriteField(hpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})
 
 	for k, v := range w.header {
+		// trailers set using the http.TrailerPrefix are sent after the body
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		if k == "Trailer" {
+			for _, t := range v {
+				foreachHeaderElement(t, func(name string) {
+					w.trailers = append(w.trailers, http.CanonicalHeaderKey(name))
+				})
+			}
+		}
 		for index := range v {
 			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
 		}
@@ -81,19 +118,195 @@ func (w *responseWriter) WriteHeader(status int) {
 }
 
 func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.dataStream == nil {
+		return 0, http.ErrHijacked
+	}
 	if !w.headerWritten {
 		w.WriteHeader(200)
 	}
 	if !bodyAllowedForStatus(w.status) {
 		return 0, http.ErrBodyNotAllowed
 	}
-	return w.dataStream.Write(p)
+	var n int
+	var err error
+	if w.buf != nil {
+		n, err = w.buf.Write(p)
+	} else {
+		n, err = w.dataStream.Write(p)
+	}
+	w.bytesWritten += n
+	return n, err
+}
+
+// enableBuffering buffers the data written to the response,
+// such that small writes are sent together, instead of in a STREAM frame each.
+func (w *responseWriter) enableBuffering(size int) {
+	w.buf = bufio.NewWriterSize(w.dataStream, size)
+}
+
+// Flush sends the response headers, if they were not sent yet, and all buffered data.
+// It returns once the data was handed to QUIC, so it is sent immediately,
+// e.g. for server-sent events.
+func (w *responseWriter) Flush() {
+	if w.dataStream == nil {
+		return
+	}
+	if !w.headerWritten {
+		w.WriteHeader(200)
+	}
+	w.flushBuffer()
+}
+
+// flushBuffer writes the buffered data to the data stream.
+func (w *responseWriter) flushBuffer() {
+	if w.buf == nil {
+		return
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.logger.Debugf("could not write response body: %s", err.Error())
+	}
+}
+
+// writeTrailers sends the trailers in a HEADERS frame after the body.
+// The frame is sent if trailers were declared in the Trailer header, even if the handler didn't set any values,
+// since the client waits for the trailers in that case.
+// Trailers that were not declared can be set using the http.TrailerPrefix.
+// As in gQUIC, the frame carries the length of the body in the :final-offset pseudo header field.
+func (w *responseWriter) writeTrailers() {
+	// the handler is responsible for the stream, once it was hijacked
+	if w.dataStream == nil {
+		return
+	}
+	fields := []hpack.HeaderField{{Name: ":final-offset", Value: strconv.Itoa(w.bytesWritten)}}
+	for _, k := range w.trailers {
+		for _, v := range w.header[k] {
+			fields = append(fields, hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	for k, vv := range w.header {
+		if !strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(k, http.TrailerPrefix))
+		for _, v := range vv {
+			fields = append(fields, hpack.HeaderField{Name: name, Value: v})
+		}
+	}
+	if len(w.trailers) == 0 && len(fields) == 1 {
+		return
+	}
+
+	var headers bytes.Buffer
+	enc := hpack.NewEncoder(&headers)
+	for _, f := range fields {
+		enc.WriteField(f)
+	}
+	w.headerStreamMutex.Lock()
+	defer w.headerStreamMutex.Unlock()
+	h2framer := http2.NewFramer(w.headerStream, nil)
+	err := h2framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      uint32(w.dataStreamID),
+		EndHeaders:    true,
+		EndStream:     true,
+		BlockFragment: headers.Bytes(),
+	})
+	if err != nil {
+		w.logger.Errorf("could not write h2 trailers: %s", err.Error())
+	}
 }
 
-func (w *responseWriter) Flush() {}
+// Push sends a PUSH_PROMISE for target, and serves the pushed request using the server's handler.
+// Pushed responses are not allowed to push themselves, in that case http.ErrNotSupported is returned.
+// The checks are mostly copied from http2/server.go.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if w.push == nil || w.req == nil {
+		return http.ErrNotSupported
+	}
+	if opts == nil {
+		opts = &http.PushOptions{}
+	}
+	if opts.Method == "" {
+		opts.Method = "GET"
+	}
+	if opts.Method != "GET" && opts.Method != "HEAD" {
+		return fmt.Errorf("method %q must be GET or HEAD", opts.Method)
+	}
 
-// This is a NOP. Use http.Request.Context
-func (w *responseWriter) CloseNotify() <-chan bool { return make(<-chan bool) }
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		if !strings.HasPrefix(target, "/") {
+			return fmt.Errorf("target must be an absolute URL or an absolute path: %q", target)
+		}
+		u.Scheme = "https"
+		u.Host = w.req.Host
+	} else {
+		if u.Scheme != "https" {
+			return fmt.Errorf("cannot push URL with unknown scheme %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return errors.New("URL must have a host")
+		}
+	}
+	for k := range opts.Header {
+		if strings.HasPrefix(k, ":") {
+			return fmt.Errorf("promised request headers cannot include pseudo header %q", k)
+		}
+		switch strings.ToLower(k) {
+		case "content-length", "content-encoding", "trailer", "te", "expect", "host", "proxy-authorization":
+			return fmt.Errorf("promised request headers cannot include %q", k)
+		}
+	}
+
+	header := http.Header{}
+	for k, v := range opts.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	return w.push(&http.Request{
+		Method:     opts.Method,
+		URL:        u,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     header,
+		Body:       http.NoBody,
+		Host:       u.Host,
+		RequestURI: u.RequestURI(),
+		RemoteAddr: w.req.RemoteAddr,
+		TLS:        w.req.TLS,
+	})
+}
+
+// HijackStream lets the handler take over the stream of the request.
+// The response headers are sent first, if the handler didn't send them yet.
+func (w *responseWriter) HijackStream() (quic.Stream, error) {
+	if w.dataStream == nil {
+		return nil, errors.New("h2quic: the stream was already hijacked")
+	}
+	if !w.headerWritten {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.flushBuffer()
+	str := w.dataStream
+	w.dataStream = nil
+	return str, nil
+}
+
+// CloseNotify returns a channel that receives a value when the request context is canceled,
+// i.e. when the client resets the stream, or the session is closed.
+// New code should use http.Request.Context instead.
+func (w *responseWriter) CloseNotify() <-chan bool {
+	c := make(chan bool, 1)
+	if w.req == nil {
+		return c
+	}
+	go func() {
+		<-w.req.Context().Done()
+		c <- true
+	}()
+	return c
+}
 
 // test that we implement http.Flusher
 var _ http.Flusher = &responseWriter{}
@@ -101,6 +314,12 @@ var _ http.Flusher = &responseWriter{}
 // test that we implement http.CloseNotifier
 var _ http.CloseNotifier = &responseWriter{}
 
+// test that we implement http.Pusher
+var _ http.Pusher = &responseWriter{}
+
+// test that we implement the StreamHijacker
+var _ StreamHijacker = &responseWriter{}
+
 // copied from http2/http2.go
 // bodyAllowedForStatus reports whether a given response status code
 // permits a body. See RFC 2616, section 4.4.
@@ -3,8 +3,10 @@ package h2quic
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,6 +29,12 @@ type mockStream struct {
 	closed        bool
 	remoteClosed  bool
 
+	readErr           error
+	writeErr          error
+	cancelWriteCode   quic.ErrorCode // the error code passed to CancelWrite
+	terminationReason quic.StreamTerminationReason
+	readDeadline      time.Time
+
 	unblockRead chan struct{}
 	ctx         context.Context
 	ctxCancel   context.CancelFunc
@@ -34,6 +42,17 @@ type mockStream struct {
 
 var _ quic.Stream = &mockStream{}
 
+// a streamError is returned by a mockStream that was reset
+type streamError struct {
+	errorCode quic.ErrorCode
+}
+
+var _ quic.StreamError = &streamError{}
+
+func (e *streamError) Error() string             { return "stream reset" }
+func (e *streamError) Canceled() bool            { return true }
+func (e *streamError) ErrorCode() quic.ErrorCode { return e.errorCode }
+
 func newMockStream(id protocol.StreamID) *mockStream {
 	s := &mockStream{
 		id:          id,
@@ -45,15 +64,33 @@ func newMockStream(id protocol.StreamID) *mockStream {
 
 func (s *mockStream) Close() error                          { s.closed = true; s.ctxCancel(); return nil }
 func (s *mockStream) CancelRead(quic.ErrorCode) error       { s.reset = true; return nil }
-func (s *mockStream) CancelWrite(quic.ErrorCode) error      { s.canceledWrite = true; return nil }
 func (s *mockStream) CloseRemote(offset protocol.ByteCount) { s.remoteClosed = true; s.ctxCancel() }
 func (s mockStream) StreamID() protocol.StreamID            { return s.id }
 func (s *mockStream) Context() context.Context              { return s.ctx }
 func (s *mockStream) SetDeadline(time.Time) error           { panic("not implemented") }
-func (s *mockStream) SetReadDeadline(time.Time) error       { panic("not implemented") }
+func (s *mockStream) SetReadDeadline(t time.Time) error     { s.readDeadline = t; return nil }
 func (s *mockStream) SetWriteDeadline(time.Time) error      { panic("not implemented") }
+func (s *mockStream) SetPriority(int)                       { panic("not implemented") }
+func (s *mockStream) ReadFrom(r io.Reader) (int64, error)   { return io.Copy(struct{ io.Writer }{s}, r) }
+
+func (s *mockStream) CancelWrite(code quic.ErrorCode) error {
+	s.canceledWrite = true
+	s.cancelWriteCode = code
+	return nil
+}
+
+func (s *mockStream) ReadTerminationReason() quic.StreamTerminationReason {
+	return s.terminationReason
+}
+
+func (s *mockStream) ReleaseCredit(int) {
+	panic("not implemented")
+}
 
 func (s *mockStream) Read(p []byte) (int, error) {
+	if s.readErr != nil {
+		return 0, s.readErr
+	}
 	n, _ := s.dataToRead.Read(p)
 	if n == 0 { // block if there's no data
 		<-s.unblockRead
@@ -61,7 +98,15 @@ func (s *mockStream) Read(p []byte) (int, error) {
 	}
 	return n, nil // never return an EOF
 }
-func (s *mockStream) Write(p []byte) (int, error) { return s.dataWritten.Write(p) }
+func (s *mockStream) Write(p []byte) (int, error) {
+	if s.writeErr != nil {
+		return 0, s.writeErr
+	}
+	if s.canceledWrite {
+		return 0, errors.New("write on canceled stream")
+	}
+	return s.dataWritten.Write(p)
+}
 
 var _ = Describe("Response Writer", func() {
 	var (
@@ -153,6 +198,135 @@ var _ = Describe("Response Writer", func() {
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
 	})
 
+	Context("buffering writes", func() {
+		BeforeEach(func() {
+			w.enableBuffering(10)
+		})
+
+		It("buffers small writes", func() {
+			_, err := w.Write([]byte("foo"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = w.Write([]byte("bar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dataStream.dataWritten.Len()).To(BeZero())
+			// data is sent when the buffer is full
+			_, err = w.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobarfoob")))
+		})
+
+		It("sends the buffered data when flushing", func() {
+			_, err := w.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			w.Flush()
+			Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		})
+
+		It("sends the buffered data before hijacking the stream", func() {
+			_, err := w.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = w.HijackStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		})
+
+		It("counts buffered data for the final offset", func() {
+			_, err := w.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.bytesWritten).To(Equal(6))
+		})
+	})
+
+	It("sends the headers when flushing", func() {
+		w.Flush()
+		fields := decodeHeaderFields()
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(dataStream.dataWritten.Len()).To(BeZero())
+	})
+
+	It("doesn't do anything when flushing after the stream was hijacked", func() {
+		_, err := w.HijackStream()
+		Expect(err).ToNot(HaveOccurred())
+		headerLen := headerStream.dataWritten.Len()
+		w.Flush()
+		Expect(headerStream.dataWritten.Len()).To(Equal(headerLen))
+	})
+
+	Context("pushing", func() {
+		var pushed []*http.Request
+
+		BeforeEach(func() {
+			pushed = nil
+			w.req = &http.Request{Host: "www.example.com", RemoteAddr: "127.0.0.1:42"}
+			w.push = func(req *http.Request) error {
+				pushed = append(pushed, req)
+				return nil
+			}
+		})
+
+		It("pushes an absolute path", func() {
+			hdr := http.Header{}
+			hdr.Set("Cache-Control", "no-cache")
+			Expect(w.Push("/style.css?v=1", &http.PushOptions{Header: hdr})).To(Succeed())
+			Expect(pushed).To(HaveLen(1))
+			req := pushed[0]
+			Expect(req.Method).To(Equal("GET"))
+			Expect(req.URL.String()).To(Equal("https://www.example.com/style.css?v=1"))
+			Expect(req.Host).To(Equal("www.example.com"))
+			Expect(req.RequestURI).To(Equal("/style.css?v=1"))
+			Expect(req.RemoteAddr).To(Equal("127.0.0.1:42"))
+			Expect(req.Header).To(Equal(hdr))
+			Expect(req.Body).To(Equal(http.NoBody))
+		})
+
+		It("pushes an absolute URL", func() {
+			Expect(w.Push("https://quic.clemente.io/script.js", &http.PushOptions{Method: "HEAD"})).To(Succeed())
+			Expect(pushed).To(HaveLen(1))
+			Expect(pushed[0].Method).To(Equal("HEAD"))
+			Expect(pushed[0].Host).To(Equal("quic.clemente.io"))
+			Expect(pushed[0].URL.Path).To(Equal("/script.js"))
+		})
+
+		It("doesn't push from pushed responses", func() {
+			w.push = nil
+			Expect(w.Push("/style.css", nil)).To(MatchError(http.ErrNotSupported))
+		})
+
+		It("returns the error that occurred when pushing", func() {
+			testErr := errors.New("push failed")
+			w.push = func(*http.Request) error { return testErr }
+			Expect(w.Push("/style.css", nil)).To(MatchError(testErr))
+		})
+
+		It("rejects methods other than GET and HEAD", func() {
+			Expect(w.Push("/style.css", &http.PushOptions{Method: "POST"})).To(MatchError("method \"POST\" must be GET or HEAD"))
+			Expect(pushed).To(BeEmpty())
+		})
+
+		It("rejects relative paths", func() {
+			Expect(w.Push("style.css", nil)).To(MatchError("target must be an absolute URL or an absolute path: \"style.css\""))
+			Expect(pushed).To(BeEmpty())
+		})
+
+		It("rejects URLs with an unknown scheme", func() {
+			Expect(w.Push("http://www.example.com/style.css", nil)).To(MatchError("cannot push URL with unknown scheme \"http\""))
+			Expect(pushed).To(BeEmpty())
+		})
+
+		It("rejects pseudo headers", func() {
+			hdr := http.Header{":path": []string{"/foo"}}
+			Expect(w.Push("/style.css", &http.PushOptions{Header: hdr})).To(MatchError("promised request headers cannot include pseudo header \":path\""))
+			Expect(pushed).To(BeEmpty())
+		})
+
+		It("rejects headers that don't make sense for a promised request", func() {
+			hdr := http.Header{}
+			hdr.Set("Content-Length", "42")
+			Expect(w.Push("/style.css", &http.PushOptions{Header: hdr})).To(MatchError("promised request headers cannot include \"Content-Length\""))
+			Expect(pushed).To(BeEmpty())
+		})
+	})
+
 	It("doesn't allow writes if the status code doesn't allow a body", func() {
 		w.WriteHeader(304)
 		n, err := w.Write([]byte("foobar"))
@@ -160,4 +334,116 @@ var _ = Describe("Response Writer", func() {
 		Expect(err).To(MatchError(http.ErrBodyNotAllowed))
 		Expect(dataStream.dataWritten.Bytes()).To(HaveLen(0))
 	})
+
+	Context("hijacking the stream", func() {
+		It("returns the stream, after writing the headers", func() {
+			str, err := w.HijackStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str).To(Equal(dataStream))
+			fields := decodeHeaderFields()
+			Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		})
+
+		It("doesn't allow writes after the stream was hijacked", func() {
+			_, err := w.HijackStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = w.Write([]byte("foobar"))
+			Expect(err).To(MatchError(http.ErrHijacked))
+			Expect(dataStream.dataWritten.Len()).To(BeZero())
+		})
+
+		It("only hijacks the stream once", func() {
+			_, err := w.HijackStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = w.HijackStream()
+			Expect(err).To(MatchError("h2quic: the stream was already hijacked"))
+		})
+
+		It("doesn't send trailers after the stream was hijacked", func() {
+			w.Header().Set("Trailer", "Foo")
+			_, err := w.HijackStream()
+			Expect(err).ToNot(HaveOccurred())
+			headerLen := headerStream.dataWritten.Len()
+			w.writeTrailers()
+			Expect(headerStream.dataWritten.Len()).To(Equal(headerLen))
+		})
+	})
+
+	Context("trailers", func() {
+		type headersFrame struct {
+			fields    map[string][]string
+			endStream bool
+		}
+
+		decodeHeaderFrames := func() []headersFrame {
+			var frames []headersFrame
+			decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
+			h2framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
+			for {
+				frame, err := h2framer.ReadFrame()
+				if err == io.EOF {
+					return frames
+				}
+				Expect(err).ToNot(HaveOccurred())
+				hframe := frame.(*http2.HeadersFrame)
+				Expect(hframe.StreamID).To(BeEquivalentTo(5))
+				hfields, err := decoder.DecodeFull(hframe.HeaderBlockFragment())
+				Expect(err).ToNot(HaveOccurred())
+				fields := make(map[string][]string)
+				for _, p := range hfields {
+					fields[p.Name] = append(fields[p.Name], p.Value)
+				}
+				frames = append(frames, headersFrame{fields: fields, endStream: hframe.StreamEnded()})
+			}
+		}
+
+		It("sends the trailers declared in the Trailer header", func() {
+			w.Header().Set("Trailer", "Foo, Bar")
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Foo", "foo")
+			w.Header().Add("Bar", "bar1")
+			w.Header().Add("Bar", "bar2")
+			w.writeTrailers()
+			frames := decodeHeaderFrames()
+			Expect(frames).To(HaveLen(2))
+			Expect(frames[0].fields).To(HaveKeyWithValue("trailer", []string{"Foo, Bar"}))
+			Expect(frames[0].endStream).To(BeFalse())
+			Expect(frames[1].fields).To(Equal(map[string][]string{
+				":final-offset": {"0"},
+				"foo":           {"foo"},
+				"bar":           {"bar1", "bar2"},
+			}))
+			Expect(frames[1].endStream).To(BeTrue())
+		})
+
+		It("sends trailers set using the http.TrailerPrefix", func() {
+			w.Header().Set(http.TrailerPrefix+"Foo", "foo")
+			_, err := w.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			w.writeTrailers()
+			frames := decodeHeaderFrames()
+			Expect(frames).To(HaveLen(2))
+			Expect(frames[0].fields).ToNot(HaveKey(strings.ToLower(http.TrailerPrefix + "Foo")))
+			Expect(frames[1].fields).To(Equal(map[string][]string{
+				":final-offset": {"6"},
+				"foo":           {"foo"},
+			}))
+		})
+
+		It("sends empty trailers, if trailers were declared, but not set", func() {
+			w.Header().Set("Trailer", "Foo")
+			w.WriteHeader(http.StatusOK)
+			w.writeTrailers()
+			frames := decodeHeaderFrames()
+			Expect(frames).To(HaveLen(2))
+			Expect(frames[1].fields).To(Equal(map[string][]string{":final-offset": {"0"}}))
+			Expect(frames[1].endStream).To(BeTrue())
+		})
+
+		It("doesn't send trailers, if no trailers were set", func() {
+			w.WriteHeader(http.StatusOK)
+			w.writeTrailers()
+			Expect(decodeHeaderFrames()).To(HaveLen(1))
+		})
+	})
 })
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 
@@ -19,6 +20,20 @@ type roundTripCloser interface {
 	io.Closer
 }
 
+// A pooledClient is a client that is kept in the RoundTripper's connection pool.
+type pooledClient interface {
+	roundTripCloser
+	// canTakeNewRequest says if a new request can be sent without waiting for the server's stream limit
+	canTakeNewRequest() bool
+	// isClosed says if dialing failed, or if the session was closed
+	isClosed() bool
+	// handshakeFailed says if the QUIC handshake failed, once RoundTrip returned
+	handshakeFailed() bool
+}
+
+// defaultQUICBrokenDuration is the time that QUIC isn't used for a host after the handshake failed
+const defaultQUICBrokenDuration = 5 * time.Minute
+
 // RoundTripper implements the http.RoundTripper interface
 type RoundTripper struct {
 	mutex sync.Mutex
@@ -46,7 +61,35 @@ type RoundTripper struct {
 	// If Dial is nil, quic.DialAddr will be used.
 	Dial func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
-	clients map[string]roundTripCloser
+	// PushHandler is called for every response pushed by the server.
+	// The request is reconstructed from the PUSH_PROMISE sent by the server.
+	// It is the handler's responsibility to read and close the response body.
+	// If nil, pushed streams are canceled.
+	PushHandler func(*http.Request, *http.Response)
+
+	// MaxConnsPerHost limits the number of QUIC connections to a single host.
+	// A new connection is opened when all connections to the host have as many requests in flight
+	// as the server allows concurrent streams. Once the limit is reached, requests are queued
+	// until the server allows a new stream to be opened.
+	// If zero, a single connection is used per host.
+	MaxConnsPerHost int
+
+	// FallbackRoundTripper is used for requests to hosts that can't be reached using QUIC,
+	// e.g. because UDP is blocked, or a middlebox interferes with the handshake.
+	// It is typically an http.Transport, sending the requests using HTTP/2 over TCP.
+	// When the QUIC handshake fails (or times out), the request is sent using the FallbackRoundTripper,
+	// and so are all requests to this host for the QUICBrokenDuration.
+	// If nil, requests fail if the QUIC handshake fails.
+	FallbackRoundTripper http.RoundTripper
+
+	// QUICBrokenDuration is the time that QUIC isn't used for a host after the handshake failed,
+	// if a FallbackRoundTripper is set.
+	// If zero, a default value of 5 minutes is used.
+	QUICBrokenDuration time.Duration
+
+	clients map[string][]pooledClient
+	// brokenHosts are the hosts for which the QUIC handshake failed, and the time when QUIC will be tried again
+	brokenHosts map[string]time.Time
 }
 
 // RoundTripOpt are options for the Transport.RoundTripOpt method.
@@ -100,10 +143,34 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 	}
 
 	hostname := authorityAddr("https", hostnameFromRequest(req))
-	cl, err := r.getClient(hostname, opt.OnlyCachedConn)
+	if r.FallbackRoundTripper != nil && !opt.OnlyCachedConn && r.isQUICBroken(hostname) {
+		return r.FallbackRoundTripper.RoundTrip(req)
+	}
+	cl, isReused, err := r.getClient(hostname, opt.OnlyCachedConn)
 	if err != nil {
 		return nil, err
 	}
+	rsp, err := cl.RoundTrip(req)
+	if err == nil {
+		return rsp, nil
+	}
+	// The request wasn't sent if the handshake failed, so it can be sent using the fallback.
+	if r.FallbackRoundTripper != nil && cl.handshakeFailed() {
+		r.markQUICBroken(hostname)
+		return r.FallbackRoundTripper.RoundTrip(req)
+	}
+	// Requests refused by a server that is going away were not processed, so they can always be retried.
+	refused := err == errGoAway && canRewindRequestBody(req)
+	if !refused && (!isReused || !cl.isClosed() || !canRetryRequest(req)) {
+		return rsp, err
+	}
+	// The pooled connection was closed. Retry the request once on a new connection.
+	if req, err = rewindRequestBody(req); err != nil {
+		return nil, err
+	}
+	if cl, _, err = r.getClient(hostname, opt.OnlyCachedConn); err != nil {
+		return nil, err
+	}
 	return cl.RoundTrip(req)
 }
 
@@ -112,38 +179,95 @@ func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return r.RoundTripOpt(req, RoundTripOpt{})
 }
 
-func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTripper, error) {
+// getClient returns a client for the host.
+// Closed clients are removed from the pool. A new client is created if all clients are busy,
+// as long as there are less than MaxConnsPerHost clients.
+// The bool is true if the client was taken from the pool.
+func (r *RoundTripper) getClient(hostname string, onlyCached bool) (pooledClient, bool, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	if r.clients == nil {
-		r.clients = make(map[string]roundTripCloser)
+		r.clients = make(map[string][]pooledClient)
 	}
 
-	client, ok := r.clients[hostname]
-	if !ok {
-		if onlyCached {
-			return nil, ErrNoCachedConn
+	clients := r.clients[hostname][:0]
+	for _, cl := range r.clients[hostname] {
+		if !cl.isClosed() {
+			clients = append(clients, cl)
+		}
+	}
+	r.clients[hostname] = clients
+	for _, cl := range clients {
+		if cl.canTakeNewRequest() {
+			return cl, true, nil
 		}
-		client = newClient(
-			hostname,
-			r.TLSClientConfig,
-			&roundTripperOpts{DisableCompression: r.DisableCompression},
-			r.QuicConfig,
-			r.Dial,
-		)
-		r.clients[hostname] = client
 	}
-	return client, nil
+	if len(clients) > 0 && (onlyCached || len(clients) >= r.maxConnsPerHost()) {
+		// all clients are busy, the request will wait for a stream to become available
+		return clients[0], true, nil
+	}
+	if onlyCached {
+		return nil, false, ErrNoCachedConn
+	}
+	client := newClient(
+		hostname,
+		r.TLSClientConfig,
+		&roundTripperOpts{
+			DisableCompression: r.DisableCompression,
+			PushHandler:        r.PushHandler,
+		},
+		r.QuicConfig,
+		r.Dial,
+	)
+	r.clients[hostname] = append(clients, client)
+	return client, false, nil
+}
+
+// isQUICBroken says if the QUIC handshake failed for the host within the QUICBrokenDuration.
+func (r *RoundTripper) isQUICBroken(hostname string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	retryAt, ok := r.brokenHosts[hostname]
+	if !ok {
+		return false
+	}
+	if time.Now().Before(retryAt) {
+		return true
+	}
+	delete(r.brokenHosts, hostname)
+	return false
+}
+
+func (r *RoundTripper) markQUICBroken(hostname string) {
+	duration := r.QUICBrokenDuration
+	if duration == 0 {
+		duration = defaultQUICBrokenDuration
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.brokenHosts == nil {
+		r.brokenHosts = make(map[string]time.Time)
+	}
+	r.brokenHosts[hostname] = time.Now().Add(duration)
+}
+
+func (r *RoundTripper) maxConnsPerHost() int {
+	if r.MaxConnsPerHost <= 0 {
+		return 1
+	}
+	return r.MaxConnsPerHost
 }
 
 // Close closes the QUIC connections that this RoundTripper has used
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for _, client := range r.clients {
-		if err := client.Close(); err != nil {
-			return err
+	for _, clients := range r.clients {
+		for _, client := range clients {
+			if err := client.Close(); err != nil {
+				return err
+			}
 		}
 	}
 	r.clients = nil
@@ -156,6 +280,36 @@ func closeRequestBody(req *http.Request) {
 	}
 }
 
+// canRetryRequest says if a request can be sent again after the connection was closed.
+// This is only the case for idempotent requests, if the body can be sent again.
+func canRetryRequest(req *http.Request) bool {
+	switch req.Method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+	default:
+		return false
+	}
+	return canRewindRequestBody(req)
+}
+
+// canRewindRequestBody says if the request body can be sent again.
+func canRewindRequestBody(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewindRequestBody returns a copy of the request with a new body, obtained from GetBody.
+func rewindRequestBody(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.Body = body
+	return &newReq, nil
+}
+
 func validMethod(method string) bool {
 	/*
 				     Method         = "OPTIONS"                ; Section 9.2
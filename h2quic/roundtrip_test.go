@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 
@@ -14,18 +15,37 @@ import (
 )
 
 type mockClient struct {
-	closed bool
+	closed           bool
+	busy             bool
+	closeOnRoundTrip bool
+	roundTripErr     error
+	dialFailed       bool
+	requests         []*http.Request
 }
 
 func (m *mockClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, req)
+	if m.closeOnRoundTrip {
+		m.closed = true
+	}
+	if m.roundTripErr != nil {
+		return nil, m.roundTripErr
+	}
 	return &http.Response{Request: req}, nil
 }
 func (m *mockClient) Close() error {
 	m.closed = true
 	return nil
 }
+func (m *mockClient) canTakeNewRequest() bool { return !m.closed && !m.busy }
+func (m *mockClient) isClosed() bool          { return m.closed }
+func (m *mockClient) handshakeFailed() bool   { return m.dialFailed }
+
+var _ pooledClient = &mockClient{}
 
-var _ roundTripCloser = &mockClient{}
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
 
 type mockBody struct {
 	reader   bytes.Reader
@@ -91,6 +111,77 @@ var _ = Describe("RoundTripper", func() {
 			Expect(rt.clients).To(HaveLen(1))
 		})
 
+		Context("falling back to TCP", func() {
+			var (
+				dialCount        int
+				fallbackRequests []*http.Request
+			)
+
+			BeforeEach(func() {
+				dialCount = 0
+				fallbackRequests = nil
+				dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+					dialCount++
+					return nil, errors.New("handshake timeout")
+				}
+				rt.FallbackRoundTripper = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					fallbackRequests = append(fallbackRequests, req)
+					return &http.Response{Request: req}, nil
+				})
+			})
+
+			It("uses the fallback if the QUIC handshake fails", func() {
+				rsp, err := rt.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Request).To(Equal(req1))
+				Expect(fallbackRequests).To(Equal([]*http.Request{req1}))
+				Expect(dialCount).To(Equal(1))
+			})
+
+			It("doesn't use QUIC for a host after the handshake failed", func() {
+				_, err := rt.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = rt.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fallbackRequests).To(HaveLen(2))
+				Expect(dialCount).To(Equal(1))
+			})
+
+			It("tries QUIC again after the QUICBrokenDuration", func() {
+				rt.QUICBrokenDuration = time.Millisecond
+				_, err := rt.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				time.Sleep(2 * time.Millisecond)
+				_, err = rt.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dialCount).To(Equal(2))
+				Expect(rt.brokenHosts).To(HaveKey("www.example.org:443"))
+			})
+
+			It("uses a default QUICBrokenDuration", func() {
+				_, err := rt.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rt.brokenHosts["www.example.org:443"]).To(BeTemporally("~", time.Now().Add(defaultQUICBrokenDuration), time.Second))
+			})
+
+			It("doesn't use the fallback if the handshake succeeded", func() {
+				dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+					return &mockSession{streamOpenErr: streamOpenErr}, nil
+				}
+				_, err := rt.RoundTrip(req1)
+				Expect(err).To(MatchError(streamOpenErr))
+				Expect(fallbackRequests).To(BeEmpty())
+			})
+
+			It("doesn't use the fallback if RoundTripOpt.OnlyCachedConn is set", func() {
+				_, err := rt.RoundTrip(req1)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = rt.RoundTripOpt(req1, RoundTripOpt{OnlyCachedConn: true})
+				Expect(err).To(MatchError(ErrNoCachedConn))
+				Expect(fallbackRequests).To(HaveLen(1))
+			})
+		})
+
 		It("uses the quic.Config, if provided", func() {
 			config := &quic.Config{HandshakeTimeout: time.Millisecond}
 			var receivedConfig *quic.Config
@@ -115,16 +206,129 @@ var _ = Describe("RoundTripper", func() {
 		})
 
 		It("reuses existing clients", func() {
+			cl := &mockClient{}
+			rt.clients = map[string][]pooledClient{"quic.clemente.io:443": {cl}}
 			req, err := http.NewRequest("GET", "https://quic.clemente.io/file1.html", nil)
 			Expect(err).ToNot(HaveOccurred())
 			_, err = rt.RoundTrip(req)
-			Expect(err).To(MatchError(streamOpenErr))
-			Expect(rt.clients).To(HaveLen(1))
+			Expect(err).ToNot(HaveOccurred())
 			req2, err := http.NewRequest("GET", "https://quic.clemente.io/file2.html", nil)
 			Expect(err).ToNot(HaveOccurred())
 			_, err = rt.RoundTrip(req2)
-			Expect(err).To(MatchError(streamOpenErr))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cl.requests).To(Equal([]*http.Request{req, req2}))
 			Expect(rt.clients).To(HaveLen(1))
+			Expect(rt.clients["quic.clemente.io:443"]).To(HaveLen(1))
+		})
+
+		It("replaces clients that were closed", func() {
+			cl := &mockClient{closed: true}
+			rt.clients = map[string][]pooledClient{"www.example.org:443": {cl}}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError(streamOpenErr))
+			Expect(cl.requests).To(BeEmpty())
+			Expect(rt.clients["www.example.org:443"]).To(HaveLen(1))
+			Expect(rt.clients["www.example.org:443"][0]).ToNot(Equal(cl))
+		})
+
+		It("queues requests on a busy client, if a single connection is allowed per host", func() {
+			cl := &mockClient{busy: true}
+			rt.clients = map[string][]pooledClient{"www.example.org:443": {cl}}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cl.requests).To(HaveLen(1))
+			Expect(rt.clients["www.example.org:443"]).To(HaveLen(1))
+		})
+
+		It("opens a new connection if all connections are busy", func() {
+			rt.MaxConnsPerHost = 2
+			cl := &mockClient{busy: true}
+			rt.clients = map[string][]pooledClient{"www.example.org:443": {cl}}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError(streamOpenErr))
+			Expect(cl.requests).To(BeEmpty())
+			Expect(rt.clients["www.example.org:443"]).To(HaveLen(2))
+			// once the limit is reached, the request is queued on a busy connection
+			rt.clients["www.example.org:443"][1] = &mockClient{busy: true}
+			_, err = rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cl.requests).To(HaveLen(1))
+		})
+
+		Context("retrying requests", func() {
+			var cl *mockClient
+
+			BeforeEach(func() {
+				cl = &mockClient{roundTripErr: errors.New("session closed"), closeOnRoundTrip: true}
+				rt.clients = map[string][]pooledClient{"www.example.org:443": {cl}}
+			})
+
+			It("retries idempotent requests on a new connection, if the pooled connection was closed", func() {
+				_, err := rt.RoundTrip(req1)
+				Expect(err).To(MatchError(streamOpenErr)) // returned by the new connection
+				Expect(cl.requests).To(HaveLen(1))
+				Expect(rt.clients["www.example.org:443"]).To(HaveLen(1))
+				Expect(rt.clients["www.example.org:443"][0]).ToNot(Equal(cl))
+			})
+
+			It("only retries once", func() {
+				var dialCount int
+				dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+					dialCount++
+					return &mockSession{streamOpenErr: streamOpenErr}, nil
+				}
+				_, err := rt.RoundTrip(req1)
+				Expect(err).To(MatchError(streamOpenErr))
+				Expect(dialCount).To(Equal(1))
+			})
+
+			It("retries requests with a body that can be rewound", func() {
+				req, err := http.NewRequest("PUT", "https://www.example.org/file1.html", bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				_, err = rt.RoundTrip(req)
+				Expect(err).To(MatchError(streamOpenErr))
+				Expect(cl.requests).To(HaveLen(1))
+			})
+
+			It("rewinds the request body", func() {
+				req, err := http.NewRequest("PUT", "https://www.example.org/file1.html", bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				_, err = ioutil.ReadAll(req.Body)
+				Expect(err).ToNot(HaveOccurred())
+				newReq, err := rewindRequestBody(req)
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(newReq.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+			})
+
+			It("doesn't retry non-idempotent requests", func() {
+				req1.Method = "POST"
+				_, err := rt.RoundTrip(req1)
+				Expect(err).To(MatchError("session closed"))
+			})
+
+			It("doesn't retry requests with a body that can't be rewound", func() {
+				req1.Method = "PUT"
+				req1.Body = &mockBody{}
+				_, err := rt.RoundTrip(req1)
+				Expect(err).To(MatchError("session closed"))
+			})
+
+			It("retries non-idempotent requests that the server refused, since it is going away", func() {
+				cl.roundTripErr = errGoAway
+				req1.Method = "POST"
+				_, err := rt.RoundTrip(req1)
+				Expect(err).To(MatchError(streamOpenErr))
+				Expect(cl.requests).To(HaveLen(1))
+			})
+
+			It("doesn't retry if the connection is still alive", func() {
+				cl.closeOnRoundTrip = false
+				_, err := rt.RoundTrip(req1)
+				Expect(err).To(MatchError("session closed"))
+				Expect(rt.clients["www.example.org:443"]).To(Equal([]pooledClient{cl}))
+			})
 		})
 
 		It("doesn't create new clients if RoundTripOpt.OnlyCachedConn is set", func() {
@@ -199,9 +403,9 @@ var _ = Describe("RoundTripper", func() {
 
 	Context("closing", func() {
 		It("closes", func() {
-			rt.clients = make(map[string]roundTripCloser)
+			rt.clients = make(map[string][]pooledClient)
 			cl := &mockClient{}
-			rt.clients["foo.bar"] = cl
+			rt.clients["foo.bar"] = []pooledClient{cl}
 			err := rt.Close()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(len(rt.clients)).To(BeZero())
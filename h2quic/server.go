@@ -1,6 +1,8 @@
 package h2quic
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -29,6 +31,159 @@ type remoteCloser interface {
 	CloseRemote(protocol.ByteCount)
 }
 
+// A serverSession is a session, together with its header stream.
+// It keeps track of the requests, such that the server can go away gracefully.
+type serverSession struct {
+	streamCreator
+
+	headerStream      quic.Stream
+	headerStreamMutex sync.Mutex // Protects concurrent calls to Write()
+
+	// When no requests are active, the session is closed if the client doesn't send a new request within the idle timeout.
+	idleTimeout time.Duration
+	// Once the client opened a data stream, it has to send the headers of the request within the read header timeout.
+	readHeaderTimeout time.Duration
+
+	mutex          sync.Mutex
+	lastStreamID   protocol.StreamID // the largest stream ID of a request that was handled
+	goingAway      bool
+	activeRequests int // the number of requests and pushes whose handler is running
+
+	// Only used if the read header timeout is set.
+	// The data streams are accepted in order. Their headers might be received before or after they were accepted.
+	highestAcceptedStreamID protocol.StreamID
+	pendingHeaders          map[protocol.StreamID]*time.Timer // the accepted data streams whose headers weren't received yet
+	receivedHeaders         map[protocol.StreamID]struct{}    // the data streams whose headers were received before they were accepted
+}
+
+func newServerSession(sess streamCreator, headerStream quic.Stream) *serverSession {
+	return &serverSession{
+		streamCreator:   sess,
+		headerStream:    headerStream,
+		pendingHeaders:  make(map[protocol.StreamID]*time.Timer),
+		receivedHeaders: make(map[protocol.StreamID]struct{}),
+	}
+}
+
+// tlsConnectionState converts the state of a QUIC connection to a tls.ConnectionState.
+// gQUIC doesn't use TLS, so the TLS version and cipher suite are only set for IETF QUIC.
+// The peer certificates are only available if the client authenticated itself, which is not possible in gQUIC.
+func tlsConnectionState(state quic.ConnectionState) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		Version:            state.Version,
+		HandshakeComplete:  state.HandshakeComplete,
+		CipherSuite:        state.CipherSuite,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		ServerName:         state.ServerName,
+		PeerCertificates:   state.PeerCertificates,
+		VerifiedChains:     state.VerifiedChains,
+	}
+}
+
+// streamAccepted is called for every data stream opened by the client.
+// If the headers of the request aren't received within the read header timeout, onTimeout is called.
+func (s *serverSession) streamAccepted(id protocol.StreamID, onTimeout func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if id > s.highestAcceptedStreamID {
+		s.highestAcceptedStreamID = id
+	}
+	if _, ok := s.receivedHeaders[id]; ok {
+		delete(s.receivedHeaders, id)
+		return
+	}
+	s.pendingHeaders[id] = time.AfterFunc(s.readHeaderTimeout, func() {
+		s.mutex.Lock()
+		_, ok := s.pendingHeaders[id]
+		delete(s.pendingHeaders, id)
+		s.mutex.Unlock()
+		if ok {
+			onTimeout()
+		}
+	})
+}
+
+// headersReceived is called when the headers of a request are received.
+// It returns false if the stream was already reset, because the headers weren't received in time.
+func (s *serverSession) headersReceived(id protocol.StreamID) bool {
+	if s.readHeaderTimeout == 0 {
+		return true
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if t, ok := s.pendingHeaders[id]; ok {
+		t.Stop()
+		delete(s.pendingHeaders, id)
+		return true
+	}
+	if id <= s.highestAcceptedStreamID {
+		return false
+	}
+	s.receivedHeaders[id] = struct{}{}
+	return true
+}
+
+// close stops the timers of the streams waiting for their headers
+func (s *serverSession) close() {
+	s.mutex.Lock()
+	for id, t := range s.pendingHeaders {
+		t.Stop()
+		delete(s.pendingHeaders, id)
+	}
+	s.mutex.Unlock()
+}
+
+// startRequest says if a request on this stream should be handled.
+// Once the session is going away, requests on streams with a larger stream ID than the last handled request are refused.
+// For every handled request, requestDone must be called when the handler returns.
+func (s *serverSession) startRequest(id protocol.StreamID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if id > s.lastStreamID {
+		if s.goingAway {
+			return false
+		}
+		s.lastStreamID = id
+	}
+	s.startHandlerLocked()
+	return true
+}
+
+// startPush is called when the handler for a pushed request is started.
+// requestDone must be called when the handler returns.
+func (s *serverSession) startPush() {
+	s.mutex.Lock()
+	s.startHandlerLocked()
+	s.mutex.Unlock()
+}
+
+func (s *serverSession) startHandlerLocked() {
+	s.activeRequests++
+	// The client might not send any new requests while waiting for the response.
+	s.headerStream.SetReadDeadline(time.Time{})
+}
+
+func (s *serverSession) requestDone() {
+	s.mutex.Lock()
+	s.activeRequests--
+	if s.activeRequests == 0 && s.idleTimeout > 0 {
+		s.headerStream.SetReadDeadline(time.Now().Add(s.idleTimeout))
+	}
+	s.mutex.Unlock()
+}
+
+// goAway makes the session refuse new requests.
+// gQUIC doesn't use the HTTP/2 GOAWAY frame. The client is told by the QUIC layer, which sends a GOAWAY frame when the listener is shut down,
+// and by the refused streams, which are reset.
+func (s *serverSession) goAway() {
+	s.mutex.Lock()
+	s.goingAway = true
+	s.mutex.Unlock()
+}
+
+// errSessionIdle is used to close sessions on which the client didn't send a request in time.
+var errSessionIdle = qerr.Error(qerr.NetworkIdleTimeout, "no request received in time")
+
 // allows mocking of quic.Listen and quic.ListenAddr
 var (
 	quicListen     = quic.Listen
@@ -36,6 +191,15 @@ var (
 )
 
 // Server is a HTTP2 server listening for QUIC connections.
+// The following fields of the http.Server are used to limit the resources a client can use:
+// ReadHeaderTimeout is the amount of time allowed for the client to send the first request after establishing the session,
+// and IdleTimeout the amount of time allowed to send the next request once all requests were handled.
+// If the client doesn't send a request in time, the session is closed.
+// Once the client opened the stream of a request, it has to send the request headers within the ReadHeaderTimeout.
+// ReadTimeout limits the time to read the body of a request.
+// As for the http.Server, the ReadTimeout is used if the ReadHeaderTimeout or the IdleTimeout is zero.
+// MaxHeaderBytes limits the size of the request headers.
+// Streams of requests exceeding one of these limits are reset.
 type Server struct {
 	*http.Server
 
@@ -43,15 +207,27 @@ type Server struct {
 	// If nil, it uses reasonable default values.
 	QuicConfig *quic.Config
 
+	// DisableWriteBuffering disables the buffering of response bodies.
+	// By default, small writes of a handler are buffered, and sent when the buffer is full,
+	// when the handler calls Flush, or when it returns.
+	// If set, every write is sent on the stream immediately, which reduces latency at the cost of more (and smaller) frames.
+	DisableWriteBuffering bool
+
 	// Private flag for demo, do not use
 	CloseAfterFirstRequest bool
 
 	port uint32 // used atomically
 
-	listenerMutex sync.Mutex
-	listener      quic.Listener
-	closed        bool
+	mutex          sync.Mutex // protects all fields below
+	listener       quic.Listener
+	closed         bool
+	shuttingDown   bool
+	sessions       map[*serverSession]struct{}
+	activeHandlers int
+	handlersDone   chan struct{} // closed when the last handler returns, after Shutdown was called
+	onShutdown     []func()
 
+	supportedVersionsOnce     sync.Once
 	supportedVersionsAsString string
 
 	logger utils.Logger // will be set by Server.serveImpl()
@@ -91,13 +267,13 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 		return errors.New("use of h2quic.Server without http.Server")
 	}
 	s.logger = utils.DefaultLogger
-	s.listenerMutex.Lock()
-	if s.closed {
-		s.listenerMutex.Unlock()
+	s.mutex.Lock()
+	if s.closed || s.shuttingDown {
+		s.mutex.Unlock()
 		return errors.New("Server is already closed")
 	}
 	if s.listener != nil {
-		s.listenerMutex.Unlock()
+		s.mutex.Unlock()
 		return errors.New("ListenAndServe may only be called once")
 	}
 
@@ -109,15 +285,25 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 		ln, err = quicListen(conn, tlsConfig, s.QuicConfig)
 	}
 	if err != nil {
-		s.listenerMutex.Unlock()
+		s.mutex.Unlock()
 		return err
 	}
 	s.listener = ln
-	s.listenerMutex.Unlock()
+	s.mutex.Unlock()
+	// announce the port that the server is actually listening on, e.g. if Addr has port 0
+	if addr, ok := ln.Addr().(*net.UDPAddr); ok {
+		atomic.StoreUint32(&s.port, uint32(addr.Port))
+	}
 
 	for {
 		sess, err := ln.Accept()
 		if err != nil {
+			s.mutex.Lock()
+			shuttingDown := s.shuttingDown
+			s.mutex.Unlock()
+			if shuttingDown {
+				return http.ErrServerClosed
+			}
 			return err
 		}
 		go s.handleHeaderStream(sess.(streamCreator))
@@ -125,18 +311,41 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 }
 
 func (s *Server) handleHeaderStream(session streamCreator) {
-	stream, err := session.AcceptStream()
+	// The client needs to open the header stream and send the first request within the ReadHeaderTimeout.
+	ctx := context.Background()
+	var deadline time.Time
+	if timeout := s.readHeaderTimeout(); timeout > 0 {
+		deadline = time.Now().Add(timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	stream, err := session.AcceptStreamContext(ctx)
 	if err != nil {
+		if err == context.DeadlineExceeded {
+			session.Close(errSessionIdle)
+			return
+		}
 		session.Close(qerr.Error(qerr.InvalidHeadersStreamData, err.Error()))
 		return
 	}
+	stream.SetReadDeadline(deadline)
+	sess := newServerSession(session, stream)
+	sess.idleTimeout = s.idleTimeout()
+	sess.readHeaderTimeout = s.readHeaderTimeout()
+	s.addSession(sess)
+	defer s.removeSession(sess)
+	if sess.readHeaderTimeout > 0 {
+		go s.handleDataStreams(sess)
+		defer sess.close()
+	}
 
 	hpackDecoder := hpack.NewDecoder(4096, nil)
+	hpackDecoder.SetMaxStringLength(s.maxHeaderBytes())
 	h2framer := http2.NewFramer(nil, stream)
 
-	var headerStreamMutex sync.Mutex // Protects concurrent calls to Write()
 	for {
-		if err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer); err != nil {
+		if err := s.handleRequest(sess, hpackDecoder, h2framer); err != nil {
 			// QuicErrors must originate from stream.Read() returning an error.
 			// In this case, the session has already logged the error, so we don't
 			// need to log it again.
@@ -149,9 +358,29 @@ func (s *Server) handleHeaderStream(session streamCreator) {
 	}
 }
 
-func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex, hpackDecoder *hpack.Decoder, h2framer *http2.Framer) error {
+// handleDataStreams accepts the data streams opened by the client.
+// Streams whose request headers aren't received within the ReadHeaderTimeout are reset.
+func (s *Server) handleDataStreams(session *serverSession) {
+	for {
+		str, err := session.AcceptStream()
+		if err != nil {
+			return
+		}
+		session.streamAccepted(str.StreamID(), func() {
+			s.logger.Debugf("Resetting stream %d, since the request headers weren't received in time", str.StreamID())
+			// in gQUIC, the error code doesn't matter, so just use 0 here
+			str.CancelRead(0)
+			str.CancelWrite(0)
+		})
+	}
+}
+
+func (s *Server) handleRequest(session *serverSession, hpackDecoder *hpack.Decoder, h2framer *http2.Framer) error {
 	h2frame, err := h2framer.ReadFrame()
 	if err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return errSessionIdle
+		}
 		return qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")
 	}
 	h2headersFrame, ok := h2frame.(*http2.HeadersFrame)
@@ -166,6 +395,19 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 		s.logger.Errorf("invalid http2 headers encoding: %s", err.Error())
 		return err
 	}
+	if !session.headersReceived(protocol.StreamID(h2headersFrame.StreamID)) {
+		s.logger.Debugf("Ignoring request on stream %d, since the stream was already reset", h2headersFrame.StreamID)
+		return nil
+	}
+	var headerBytes uint32
+	for _, hf := range headers {
+		headerBytes += hf.Size()
+	}
+	if headerBytes > uint32(s.maxHeaderBytes()) {
+		s.logger.Debugf("Resetting stream %d, since the request headers are too large (%d bytes)", h2headersFrame.StreamID, headerBytes)
+		// in gQUIC, the error code doesn't matter, so just use 0 here
+		return s.resetStream(session, protocol.StreamID(h2headersFrame.StreamID), 0)
+	}
 
 	req, err := requestFromHeaders(headers)
 	if err != nil {
@@ -178,19 +420,33 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 		s.logger.Infof("%s %s%s", req.Method, req.Host, req.RequestURI)
 	}
 
+	if !session.startRequest(protocol.StreamID(h2headersFrame.StreamID)) {
+		s.logger.Debugf("Refusing request on stream %d, since the server is going away", h2headersFrame.StreamID)
+		return s.resetStream(session, protocol.StreamID(h2headersFrame.StreamID), errorCodeStreamRefused)
+	}
 	dataStream, err := session.GetOrOpenStream(protocol.StreamID(h2headersFrame.StreamID))
 	if err != nil {
+		session.requestDone()
 		return err
 	}
 	// this can happen if the client immediately closes the data stream after sending the request and the runtime processes the reset before the request
 	if dataStream == nil {
+		session.requestDone()
 		return nil
 	}
 
+	if s.ReadTimeout > 0 {
+		dataStream.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	}
+
 	// handleRequest should be as non-blocking as possible to minimize
 	// head-of-line blocking. Potentially blocking code is run in a separate
 	// goroutine, enabling handleRequest to return before the code is executed.
+	s.handlerStarted()
 	go func() {
+		defer s.handlerDone()
+		defer session.requestDone()
+
 		streamEnded := h2headersFrame.StreamEnded()
 		if streamEnded {
 			dataStream.(remoteCloser).CloseRemote(0)
@@ -198,37 +454,28 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 			_, _ = dataStream.Read([]byte{0}) // read the eof
 		}
 
-		req = req.WithContext(dataStream.Context())
-		reqBody := newRequestBody(dataStream)
+		// The request context is canceled when the client resets the stream, and when the handler returns.
+		ctx, cancel := context.WithCancel(dataStream.Context())
+		req = req.WithContext(ctx)
+		reqBody := newRequestBody(dataStream, cancel, func() {
+			s.logger.Debugf("Resetting stream %d, since the request body wasn't received in time", dataStream.StreamID())
+			dataStream.CancelRead(0)
+			dataStream.CancelWrite(0)
+			cancel()
+		})
 		req.Body = reqBody
 
 		req.RemoteAddr = session.RemoteAddr().String()
+		req.TLS = tlsConnectionState(session.ConnectionState())
 
-		responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID), s.logger)
-
-		handler := s.Handler
-		if handler == nil {
-			handler = http.DefaultServeMux
-		}
-		panicked := false
-		func() {
-			defer func() {
-				if p := recover(); p != nil {
-					// Copied from net/http/server.go
-					const size = 64 << 10
-					buf := make([]byte, size)
-					buf = buf[:runtime.Stack(buf, false)]
-					s.logger.Errorf("http: panic serving: %v\n%s", p, buf)
-					panicked = true
-				}
-			}()
-			handler.ServeHTTP(responseWriter, req)
-		}()
-		if panicked {
-			responseWriter.WriteHeader(500)
-		} else {
-			responseWriter.WriteHeader(200)
+		responseWriter := s.newResponseWriter(session, dataStream, protocol.StreamID(h2headersFrame.StreamID))
+		responseWriter.req = req
+		responseWriter.push = func(pushedReq *http.Request) error {
+			return s.push(session, protocol.StreamID(h2headersFrame.StreamID), pushedReq)
 		}
+
+		s.serveHTTP(responseWriter, req)
+		cancel()
 		if responseWriter.dataStream != nil {
 			if !streamEnded && !reqBody.requestRead {
 				// in gQUIC, the error code doesn't matter, so just use 0 here
@@ -245,11 +492,139 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 	return nil
 }
 
+// resetStream resets a stream in both directions, without handling the request.
+// The error code is sent to the client in the RST_STREAM frame.
+func (s *Server) resetStream(session *serverSession, id protocol.StreamID, errorCode quic.ErrorCode) error {
+	str, err := session.GetOrOpenStream(id)
+	if err != nil {
+		return err
+	}
+	if str != nil {
+		str.CancelRead(errorCode)
+		str.CancelWrite(errorCode)
+	}
+	return nil
+}
+
+// newResponseWriter creates the responseWriter for a request.
+// It buffers the response body, unless write buffering is disabled.
+func (s *Server) newResponseWriter(session *serverSession, dataStream quic.Stream, id protocol.StreamID) *responseWriter {
+	w := newResponseWriter(session.headerStream, &session.headerStreamMutex, dataStream, id, s.logger)
+	if !s.DisableWriteBuffering {
+		w.enableBuffering(responseBufferSize)
+	}
+	return w
+}
+
+// serveHTTP calls the handler, and writes the response headers, if the handler didn't write them.
+// If the handler panics, a 500 is sent.
+// Once the handler returned, the buffered body is sent, followed by the trailers.
+func (s *Server) serveHTTP(responseWriter *responseWriter, req *http.Request) {
+	handler := s.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	panicked := false
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				// Copied from net/http/server.go
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				s.logger.Errorf("http: panic serving: %v\n%s", p, buf)
+				panicked = true
+			}
+		}()
+		handler.ServeHTTP(responseWriter, req)
+	}()
+	if panicked {
+		responseWriter.WriteHeader(500)
+	} else {
+		responseWriter.WriteHeader(200)
+	}
+	responseWriter.flushBuffer()
+	responseWriter.writeTrailers()
+}
+
+// push opens a new stream for the pushed request, and sends a PUSH_PROMISE on the header stream.
+// The pushed request is then handled on the new stream, just like a request sent by the client.
+func (s *Server) push(session *serverSession, associatedStreamID protocol.StreamID, req *http.Request) error {
+	var headers bytes.Buffer
+	enc := hpack.NewEncoder(&headers)
+	enc.WriteField(hpack.HeaderField{Name: ":method", Value: req.Method})
+	enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: req.URL.Scheme})
+	enc.WriteField(hpack.HeaderField{Name: ":authority", Value: req.Host})
+	enc.WriteField(hpack.HeaderField{Name: ":path", Value: req.RequestURI})
+	for k, v := range req.Header {
+		for index := range v {
+			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
+		}
+	}
+
+	// Open the stream while holding the lock.
+	// This makes sure that the PUSH_PROMISEs are sent in the order of the promised stream IDs.
+	session.headerStreamMutex.Lock()
+	dataStream, err := session.OpenStream()
+	if err != nil {
+		session.headerStreamMutex.Unlock()
+		return err
+	}
+	err = http2.NewFramer(session.headerStream, nil).WritePushPromise(http2.PushPromiseParam{
+		StreamID:      uint32(associatedStreamID),
+		PromiseID:     uint32(dataStream.StreamID()),
+		BlockFragment: headers.Bytes(),
+		EndHeaders:    true,
+	})
+	session.headerStreamMutex.Unlock()
+	if err != nil {
+		dataStream.CancelWrite(0)
+		return err
+	}
+	s.logger.Infof("Pushing %s %s%s on stream %d", req.Method, req.Host, req.RequestURI, dataStream.StreamID())
+
+	s.handlerStarted()
+	session.startPush()
+	go func() {
+		defer s.handlerDone()
+		defer session.requestDone()
+		// the client never sends any data on a pushed stream
+		dataStream.CancelRead(0)
+		req = req.WithContext(dataStream.Context())
+		responseWriter := s.newResponseWriter(session, dataStream, dataStream.StreamID())
+		responseWriter.req = req
+		s.serveHTTP(responseWriter, req)
+		dataStream.Close()
+	}()
+	return nil
+}
+
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout > 0 {
+		return s.ReadHeaderTimeout
+	}
+	return s.ReadTimeout
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return s.ReadTimeout
+}
+
+func (s *Server) maxHeaderBytes() int {
+	if s.MaxHeaderBytes > 0 {
+		return s.MaxHeaderBytes
+	}
+	return http.DefaultMaxHeaderBytes
+}
+
 // Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients.
 // Close in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) Close() error {
-	s.listenerMutex.Lock()
-	defer s.listenerMutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.closed = true
 	if s.listener != nil {
 		err := s.listener.Close()
@@ -262,12 +637,118 @@ func (s *Server) Close() error {
 // CloseGracefully shuts down the server gracefully. The server sends a GOAWAY frame first, then waits for either timeout to trigger, or for all running requests to complete.
 // CloseGracefully in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) CloseGracefully(timeout time.Duration) error {
-	// TODO: implement
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		return err
+	}
 	return nil
 }
 
+// Shutdown shuts down the server gracefully, without interrupting any requests that are being handled.
+// It stops accepting new sessions, and the QUIC layer sends a GOAWAY frame to the clients. Requests that arrive after that are refused
+// by resetting their stream, and the clients retry them on a new connection.
+// Shutdown then waits for all handlers to return, and for the clients to close their sessions.
+// If the context expires first, the remaining sessions are closed, and the context's error is returned.
+// Once Shutdown was called, Serve, ListenAndServe and ListenAndServeTLS return http.ErrServerClosed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	if s.closed || s.shuttingDown {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.shuttingDown = true
+	ln := s.listener
+	sessions := make([]*serverSession, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	handlersDone := make(chan struct{})
+	if s.activeHandlers == 0 {
+		close(handlersDone)
+	} else {
+		s.handlersDone = handlersDone
+	}
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	s.mutex.Unlock()
+
+	// Refuse new requests on the existing sessions. The QUIC layer sends the GOAWAY frames, and refuses new streams.
+	for _, sess := range sessions {
+		sess.goAway()
+	}
+	lnErrChan := make(chan error, 1)
+	if ln == nil {
+		lnErrChan <- nil
+	} else {
+		go func() { lnErrChan <- ln.Shutdown(ctx) }()
+	}
+	var err error
+	select {
+	case <-handlersDone:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if lnErr := <-lnErrChan; err == nil {
+		err = lnErr
+	}
+
+	s.mutex.Lock()
+	s.closed = true
+	s.listener = nil
+	s.mutex.Unlock()
+	return err
+}
+
+// RegisterOnShutdown registers a function to call on Shutdown.
+// Each function is called in its own goroutine.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mutex.Lock()
+	s.onShutdown = append(s.onShutdown, f)
+	s.mutex.Unlock()
+}
+
+// addSession starts tracking a session.
+// If the server is already shutting down, the session is told to go away right away.
+func (s *Server) addSession(sess *serverSession) {
+	s.mutex.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[*serverSession]struct{})
+	}
+	s.sessions[sess] = struct{}{}
+	shuttingDown := s.shuttingDown
+	s.mutex.Unlock()
+	if shuttingDown {
+		sess.goAway()
+	}
+}
+
+func (s *Server) removeSession(sess *serverSession) {
+	s.mutex.Lock()
+	delete(s.sessions, sess)
+	s.mutex.Unlock()
+}
+
+func (s *Server) handlerStarted() {
+	s.mutex.Lock()
+	s.activeHandlers++
+	s.mutex.Unlock()
+}
+
+func (s *Server) handlerDone() {
+	s.mutex.Lock()
+	s.activeHandlers--
+	if s.activeHandlers == 0 && s.handlersDone != nil {
+		close(s.handlersDone)
+		s.handlersDone = nil
+	}
+	s.mutex.Unlock()
+}
+
 // SetQuicHeaders can be used to set the proper headers that announce that this server supports QUIC.
-// The values that are set depend on the port information from s.Server.Addr, and currently look like this (if Addr has port 443):
+// The values that are set depend on the port the server is listening on (or the port information from s.Server.Addr,
+// if it is not listening yet), and on the versions in the QuicConfig. They currently look like this (if Addr has port 443):
 //  Alt-Svc: quic=":443"; ma=2592000; v="33,32,31,30"
 func (s *Server) SetQuicHeaders(hdr http.Header) error {
 	port := atomic.LoadUint32(&s.port)
@@ -286,19 +767,34 @@ func (s *Server) SetQuicHeaders(hdr http.Header) error {
 		atomic.StoreUint32(&s.port, port)
 	}
 
-	if s.supportedVersionsAsString == "" {
-		var versions []string
-		for _, v := range protocol.SupportedVersions {
-			versions = append(versions, v.ToAltSvc())
+	s.supportedVersionsOnce.Do(func() {
+		versions := protocol.SupportedVersions
+		if s.QuicConfig != nil && len(s.QuicConfig.Versions) > 0 {
+			versions = s.QuicConfig.Versions
 		}
-		s.supportedVersionsAsString = strings.Join(versions, ",")
-	}
+		altSvcVersions := make([]string, len(versions))
+		for i, v := range versions {
+			altSvcVersions[i] = v.ToAltSvc()
+		}
+		s.supportedVersionsAsString = strings.Join(altSvcVersions, ",")
+	})
 
 	hdr.Add("Alt-Svc", fmt.Sprintf(`quic=":%d"; ma=2592000; v="%s"`, port, s.supportedVersionsAsString))
 
 	return nil
 }
 
+// AltSvcHandler returns a handler that announces this server in the Alt-Svc header of every response, and then calls h.
+// It is meant to be used for the HTTP server listening on TCP, so that clients discover the QUIC server.
+func (s *Server) AltSvcHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.SetQuicHeaders(w.Header()); err != nil {
+			utils.DefaultLogger.Errorf("Setting the Alt-Svc header failed: %s", err)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 // ListenAndServeQUIC listens on the UDP network address addr and calls the
 // handler for HTTP/2 requests on incoming connections. http.DefaultServeMux is
 // used when handler is nil.
@@ -351,31 +847,34 @@ func ListenAndServe(addr, certFile, keyFile string, handler http.Handler) error
 	}
 	defer tcpConn.Close()
 
-	tlsConn := tls.NewListener(tcpConn, config)
-	defer tlsConn.Close()
+	return ServeDual(tcpConn, udpConn, config, handler)
+}
 
-	// Start the servers
-	httpServer := &http.Server{
-		Addr:      addr,
-		TLSConfig: config,
+// ServeDual serves the handler over TLS on the TCP listener (using HTTP/1.1 or HTTP/2), and over QUIC on the UDP connection.
+// The responses sent over TCP carry an Alt-Svc header announcing the QUIC server, so that clients can switch to QUIC.
+// The tls.Config must contain the certificates. http.DefaultServeMux is used when handler is nil.
+// ServeDual returns if one of the two servers returns an error. The other server is closed.
+func ServeDual(tcpListener net.Listener, udpConn net.PacketConn, tlsConfig *tls.Config, handler http.Handler) error {
+	if handler == nil {
+		handler = http.DefaultServeMux
 	}
-
 	quicServer := &Server{
-		Server: httpServer,
+		Server: &http.Server{
+			Addr:      udpConn.LocalAddr().String(),
+			TLSConfig: tlsConfig,
+			Handler:   handler,
+		},
 	}
-
-	if handler == nil {
-		handler = http.DefaultServeMux
+	httpServer := &http.Server{
+		Addr:      tcpListener.Addr().String(),
+		TLSConfig: tlsConfig,
+		Handler:   quicServer.AltSvcHandler(handler),
 	}
-	httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		quicServer.SetQuicHeaders(w.Header())
-		handler.ServeHTTP(w, r)
-	})
 
-	hErr := make(chan error)
-	qErr := make(chan error)
+	hErr := make(chan error, 1)
+	qErr := make(chan error, 1)
 	go func() {
-		hErr <- httpServer.Serve(tlsConn)
+		hErr <- httpServer.ServeTLS(tcpListener, "", "")
 	}()
 	go func() {
 		qErr <- quicServer.Serve(udpConn)
@@ -386,7 +885,7 @@ func ListenAndServe(addr, certFile, keyFile string, handler http.Handler) error
 		quicServer.Close()
 		return err
 	case err := <-qErr:
-		// Cannot close the HTTP server or wait for requests to complete properly :/
+		httpServer.Close()
 		return err
 	}
 }
@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
-	"sync"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -31,10 +34,12 @@ type mockSession struct {
 	closedWithError     error
 	dataStream          quic.Stream
 	streamToAccept      quic.Stream
+	dataStreamsToAccept chan quic.Stream // the streams returned by AcceptStream
 	streamsToOpen       []quic.Stream
 	blockOpenStreamSync bool
 	blockOpenStreamChan chan struct{} // close this chan (or call Close) to make OpenStreamSync return
 	streamOpenErr       error
+	connectionState     quic.ConnectionState
 	ctx                 context.Context
 	ctxCancel           context.CancelFunc
 }
@@ -46,7 +51,14 @@ func newMockSession() *mockSession {
 func (s *mockSession) GetOrOpenStream(id protocol.StreamID) (quic.Stream, error) {
 	return s.dataStream, nil
 }
-func (s *mockSession) AcceptStream() (quic.Stream, error) { return s.streamToAccept, nil }
+func (s *mockSession) AcceptStream() (quic.Stream, error) {
+	select {
+	case str := <-s.dataStreamsToAccept:
+		return str, nil
+	case <-s.ctx.Done():
+		return nil, errors.New("session closed")
+	}
+}
 func (s *mockSession) OpenStream() (quic.Stream, error) {
 	if s.streamOpenErr != nil {
 		return nil, s.streamOpenErr
@@ -70,6 +82,9 @@ func (s *mockSession) Close(e error) error {
 	s.closed = true
 	return nil
 }
+func (s *mockSession) CloseWithError(code quic.ErrorCode, reason string) error {
+	return s.Close(qerr.NewApplicationError(qerr.ErrorCode(code), reason))
+}
 func (s *mockSession) LocalAddr() net.Addr {
 	panic("not implemented")
 }
@@ -79,10 +94,40 @@ func (s *mockSession) RemoteAddr() net.Addr {
 func (s *mockSession) Context() context.Context {
 	return s.ctx
 }
-func (s *mockSession) ConnectionState() quic.ConnectionState        { panic("not implemented") }
+func (s *mockSession) ConnectionState() quic.ConnectionState        { return s.connectionState }
+func (s *mockSession) Stats() quic.SessionStats                     { panic("not implemented") }
+func (s *mockSession) NextSendTime() time.Time                      { panic("not implemented") }
+func (s *mockSession) BandwidthEstimate() uint64                    { panic("not implemented") }
 func (s *mockSession) AcceptUniStream() (quic.ReceiveStream, error) { panic("not implemented") }
 func (s *mockSession) OpenUniStream() (quic.SendStream, error)      { panic("not implemented") }
 func (s *mockSession) OpenUniStreamSync() (quic.SendStream, error)  { panic("not implemented") }
+func (s *mockSession) SendMessage([]byte) error                     { panic("not implemented") }
+func (s *mockSession) ReceiveMessage() ([]byte, error)              { panic("not implemented") }
+func (s *mockSession) Migrate(net.PacketConn) error                 { panic("not implemented") }
+func (s *mockSession) UpdateKeys() error                            { panic("not implemented") }
+func (s *mockSession) ExportKeyingMaterial(string, []byte, int) ([]byte, error) {
+	panic("not implemented")
+}
+func (s *mockSession) ExportState() ([]byte, error) { panic("not implemented") }
+func (s *mockSession) AcceptStreamContext(ctx context.Context) (quic.Stream, error) {
+	if s.streamToAccept == nil {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.streamToAccept, nil
+}
+func (s *mockSession) AcceptUniStreamContext(context.Context) (quic.ReceiveStream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenStreamSyncContext(context.Context) (quic.Stream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenUniStreamSyncContext(context.Context) (quic.SendStream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) RTT() (time.Duration, time.Duration, time.Duration) {
+	panic("not implemented")
+}
 
 var _ = Describe("H2 server", func() {
 	var (
@@ -137,13 +182,48 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
 			Expect(dataStream.reset).To(BeFalse())
 		})
 
+		It("exposes the TLS connection state to the handler", func() {
+			// the connection state is read for every request, since it might change after the session was created
+			sess := newServerSession(session, headerStream)
+			cert := &x509.Certificate{Raw: []byte("foobar")}
+			session.connectionState = quic.ConnectionState{
+				HandshakeComplete:  true,
+				ServerName:         "www.example.com",
+				PeerCertificates:   []*x509.Certificate{cert},
+				VerifiedChains:     [][]*x509.Certificate{{cert}},
+				Version:            tls.VersionTLS13,
+				CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+				NegotiatedProtocol: "hq",
+			}
+			tlsStateChan := make(chan *tls.ConnectionState, 1)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tlsStateChan <- r.TLS
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(sess, hpackDecoder, h2framer)
+			Expect(err).NotTo(HaveOccurred())
+			var tlsState *tls.ConnectionState
+			Eventually(tlsStateChan).Should(Receive(&tlsState))
+			Expect(tlsState.HandshakeComplete).To(BeTrue())
+			Expect(tlsState.ServerName).To(Equal("www.example.com"))
+			Expect(tlsState.PeerCertificates).To(Equal([]*x509.Certificate{cert}))
+			Expect(tlsState.VerifiedChains).To(Equal([][]*x509.Certificate{{cert}}))
+			Expect(tlsState.Version).To(Equal(uint16(tls.VersionTLS13)))
+			Expect(tlsState.CipherSuite).To(Equal(tls.TLS_AES_128_GCM_SHA256))
+			Expect(tlsState.NegotiatedProtocol).To(Equal("hq"))
+		})
+
 		It("returns 200 with an empty handler", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 			headerStream.dataToRead.Write([]byte{
@@ -151,13 +231,49 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
 			}).Should(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5, 0x88})) // 0x88 is 200
 		})
 
+		Context("buffering the response body", func() {
+			var unblock chan struct{}
+
+			BeforeEach(func() {
+				unblock = make(chan struct{})
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("foobar"))
+					<-unblock
+				})
+				headerStream.dataToRead.Write([]byte{
+					0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+					// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+					0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+				})
+			})
+
+			It("sends the buffered body when the handler returns", func() {
+				err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
+				Expect(err).NotTo(HaveOccurred())
+				Consistently(func() int { return dataStream.dataWritten.Len() }).Should(BeZero())
+				close(unblock)
+				Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+				Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+			})
+
+			It("sends writes immediately, if write buffering is disabled", func() {
+				s.DisableWriteBuffering = true
+				err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(func() []byte { return dataStream.dataWritten.Bytes() }).Should(Equal([]byte("foobar")))
+				Expect(dataStream.closed).To(BeFalse())
+				close(unblock)
+				Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+			})
+		})
+
 		It("correctly handles a panicking handler", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				panic("foobar")
@@ -167,7 +283,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
@@ -185,7 +301,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
@@ -200,7 +316,7 @@ var _ = Describe("H2 server", func() {
 				handlerCalled = true
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
@@ -218,7 +334,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Consistently(func() bool { return handlerCalled }).Should(BeFalse())
 		})
@@ -233,7 +349,7 @@ var _ = Describe("H2 server", func() {
 				handlerCalled = true
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
@@ -253,7 +369,7 @@ var _ = Describe("H2 server", func() {
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
 			dataStream.dataToRead.Write([]byte("foo=bar"))
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.reset).To(BeFalse())
@@ -264,10 +380,78 @@ var _ = Describe("H2 server", func() {
 				0x0, 0x0, 0x06, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5,
 				'f', 'o', 'o', 'b', 'a', 'r',
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).To(MatchError("InvalidHeadersStreamData: expected a header frame"))
 		})
 
+		It("cancels the request context when the client resets the stream", func() {
+			handlerDone := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				_, err := r.Body.Read(make([]byte, 10))
+				Expect(err).To(MatchError("stream reset"))
+				Eventually(r.Context().Done()).Should(BeClosed())
+				Eventually(w.(http.CloseNotifier).CloseNotify()).Should(Receive())
+				close(handlerDone)
+			})
+			dataStream.readErr = errors.New("stream reset")
+			dataStream.terminationReason = quic.StreamResetByPeer
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(handlerDone).Should(BeClosed())
+		})
+
+		It("cancels the request context when the handler returns", func() {
+			ctxChan := make(chan context.Context, 1)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Context().Err()).ToNot(HaveOccurred())
+				ctxChan <- r.Context()
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
+			Expect(err).NotTo(HaveOccurred())
+			var ctx context.Context
+			Eventually(ctxChan).Should(Receive(&ctx))
+			Eventually(ctx.Done()).Should(BeClosed())
+		})
+
+		It("doesn't close the stream after it was hijacked", func() {
+			handlerDone := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Method).To(Equal("CONNECT"))
+				Expect(r.Host).To(Equal("www.example.com:443"))
+				str, err := w.(StreamHijacker).HijackStream()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str).To(Equal(dataStream))
+				close(handlerDone)
+			})
+			var headers bytes.Buffer
+			enc := hpack.NewEncoder(&headers)
+			enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "www.example.com:443"})
+			enc.WriteField(hpack.HeaderField{Name: ":method", Value: "CONNECT"})
+			Expect(http2.NewFramer(&headerStream.dataToRead, nil).WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      5,
+				EndHeaders:    true,
+				BlockFragment: headers.Bytes(),
+			})).To(Succeed())
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(handlerDone).Should(BeClosed())
+			Consistently(func() bool { return dataStream.closed }).Should(BeFalse())
+			Expect(dataStream.reset).To(BeFalse())
+		})
+
 		It("Cancels the request context when the datstream is closed", func() {
 			var handlerCalled bool
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -283,12 +467,108 @@ var _ = Describe("H2 server", func() {
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
 			dataStream.Close()
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
 			Expect(dataStream.reset).To(BeFalse())
 		})
+
+		Context("pushing", func() {
+			var pushStream *mockStream
+
+			// a GET request for www.example.com/ on stream 5
+			request := []byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			}
+
+			// frames are only valid until the next call to ReadFrame, so we only return the frame headers
+			readFrameHeaders := func(onPushPromise func(*http2.PushPromiseFrame)) []http2.FrameHeader {
+				var hdrs []http2.FrameHeader
+				framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
+				for {
+					frame, err := framer.ReadFrame()
+					if err == io.EOF {
+						return hdrs
+					}
+					Expect(err).ToNot(HaveOccurred())
+					if ppframe, ok := frame.(*http2.PushPromiseFrame); ok {
+						onPushPromise(ppframe)
+					}
+					hdrs = append(hdrs, frame.Header())
+				}
+			}
+
+			BeforeEach(func() {
+				pushStream = newMockStream(2)
+				session.streamsToOpen = []quic.Stream{pushStream}
+			})
+
+			It("pushes a response", func() {
+				pushErr := make(chan error, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					switch r.URL.Path {
+					case "/":
+						pushErr <- w.(http.Pusher).Push("/style.css", nil)
+					case "/style.css":
+						Expect(r.Host).To(Equal("www.example.com"))
+						Expect(r.RemoteAddr).To(Equal("127.0.0.1:42"))
+						// pushed responses can't push
+						Expect(w.(http.Pusher).Push("/foo", nil)).To(MatchError(http.ErrNotSupported))
+						w.Write([]byte("body {}"))
+					}
+				})
+				headerStream.dataToRead.Write(request)
+				err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(pushErr).Should(Receive(BeNil()))
+				Eventually(func() bool { return pushStream.closed }).Should(BeTrue())
+				Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+				Expect(pushStream.dataWritten.Bytes()).To(Equal([]byte("body {}")))
+				Expect(pushStream.reset).To(BeTrue())
+
+				var fields []hpack.HeaderField
+				hdrs := readFrameHeaders(func(ppframe *http2.PushPromiseFrame) {
+					Expect(ppframe.StreamID).To(BeEquivalentTo(5))
+					Expect(ppframe.PromiseID).To(BeEquivalentTo(2))
+					var err error
+					fields, err = hpack.NewDecoder(4096, nil).DecodeFull(ppframe.HeaderBlockFragment())
+					Expect(err).ToNot(HaveOccurred())
+				})
+				Expect(fields).To(ConsistOf(
+					hpack.HeaderField{Name: ":method", Value: "GET"},
+					hpack.HeaderField{Name: ":scheme", Value: "https"},
+					hpack.HeaderField{Name: ":authority", Value: "www.example.com"},
+					hpack.HeaderField{Name: ":path", Value: "/style.css"},
+				))
+				Expect(hdrs).To(HaveLen(3))
+				// the PUSH_PROMISE is sent before the response
+				Expect(hdrs[0].Type).To(Equal(http2.FramePushPromise))
+				Expect(hdrs[1].Type).To(Equal(http2.FrameHeaders))
+				Expect(hdrs[2].Type).To(Equal(http2.FrameHeaders))
+				Expect([]uint32{hdrs[1].StreamID, hdrs[2].StreamID}).To(ConsistOf(uint32(2), uint32(5)))
+			})
+
+			It("returns an error if it can't open the push stream", func() {
+				testErr := errors.New("too many streams")
+				session.streamOpenErr = testErr
+				pushErr := make(chan error, 1)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					pushErr <- w.(http.Pusher).Push("/style.css", nil)
+				})
+				headerStream.dataToRead.Write(request)
+				err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(pushErr).Should(Receive(MatchError(testErr)))
+				Eventually(func() bool { return dataStream.closed }).Should(BeTrue())
+				hdrs := readFrameHeaders(func(*http2.PushPromiseFrame) { Fail("didn't expect a PUSH_PROMISE") })
+				Expect(hdrs).To(HaveLen(1))
+				Expect(hdrs[0].Type).To(Equal(http2.FrameHeaders))
+			})
+		})
 	})
 
 	It("handles the header stream", func() {
@@ -308,6 +588,180 @@ var _ = Describe("H2 server", func() {
 		Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 	})
 
+	Context("timeouts and limits", func() {
+		var headerStream *mockStream
+
+		requestData := []byte{
+			0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+			// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+			0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+		}
+
+		handleRequest := func() error {
+			return s.handleRequest(newServerSession(session, headerStream), hpack.NewDecoder(4096, nil), http2.NewFramer(nil, headerStream))
+		}
+
+		BeforeEach(func() {
+			headerStream = &mockStream{id: 3}
+		})
+
+		It("resets the stream if the request headers are too large", func() {
+			var handlerCalled bool
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+			})
+			s.MaxHeaderBytes = 100
+			headerStream.dataToRead.Write(requestData)
+			Expect(handleRequest()).To(Succeed())
+			Expect(dataStream.reset).To(BeTrue())
+			Expect(dataStream.canceledWrite).To(BeTrue())
+			Consistently(func() bool { return handlerCalled }).Should(BeFalse())
+		})
+
+		It("sets a read deadline on the request stream", func() {
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			s.ReadTimeout = time.Minute
+			headerStream.dataToRead.Write(requestData)
+			Expect(handleRequest()).To(Succeed())
+			Expect(dataStream.readDeadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+		})
+
+		It("resets the stream if the request body isn't received in time", func() {
+			done := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				_, err := r.Body.Read(make([]byte, 10))
+				Expect(err).To(MatchError(os.ErrDeadlineExceeded))
+				Expect(r.Context().Done()).To(BeClosed())
+				close(done)
+			})
+			dataStream.readErr = os.ErrDeadlineExceeded
+			headerStream.dataToRead.Write(requestData)
+			Expect(handleRequest()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Expect(dataStream.reset).To(BeTrue())
+			Expect(dataStream.canceledWrite).To(BeTrue())
+		})
+
+		It("closes the session if the client doesn't send a request in time", func() {
+			headerStream.readErr = os.ErrDeadlineExceeded
+			Expect(handleRequest()).To(MatchError(errSessionIdle))
+		})
+
+		It("closes the session if the client doesn't open the header stream in time", func() {
+			s.ReadHeaderTimeout = 10 * time.Millisecond
+			s.handleHeaderStream(session)
+			Expect(session.closed).To(BeTrue())
+			Expect(session.closedWithError).To(MatchError(errSessionIdle))
+		})
+
+		It("uses the ReadHeaderTimeout for the first request", func() {
+			s.ReadHeaderTimeout = time.Minute
+			s.IdleTimeout = time.Hour
+			session.streamToAccept = headerStream
+			go s.handleHeaderStream(session)
+			Eventually(func() time.Time {
+				s.mutex.Lock()
+				defer s.mutex.Unlock()
+				for sess := range s.sessions {
+					return sess.headerStream.(*mockStream).readDeadline
+				}
+				return time.Time{}
+			}).Should(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+		})
+
+		It("uses the ReadTimeout if the ReadHeaderTimeout or the IdleTimeout is not set", func() {
+			s.ReadTimeout = time.Minute
+			Expect(s.readHeaderTimeout()).To(Equal(time.Minute))
+			Expect(s.idleTimeout()).To(Equal(time.Minute))
+			s.ReadHeaderTimeout = time.Second
+			s.IdleTimeout = time.Hour
+			Expect(s.readHeaderTimeout()).To(Equal(time.Second))
+			Expect(s.idleTimeout()).To(Equal(time.Hour))
+		})
+
+		It("resets data streams if the request headers aren't received in time", func() {
+			sess := newServerSession(session, headerStream)
+			sess.readHeaderTimeout = 10 * time.Millisecond
+			session.dataStreamsToAccept = make(chan quic.Stream, 1)
+			session.dataStreamsToAccept <- dataStream
+			go s.handleDataStreams(sess)
+			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
+			Expect(dataStream.canceledWrite).To(BeTrue())
+			Expect(sess.headersReceived(dataStream.StreamID())).To(BeFalse())
+			session.Close(nil)
+		})
+
+		Context("timing the request headers", func() {
+			var (
+				sess     *serverSession
+				timedOut chan struct{}
+			)
+
+			BeforeEach(func() {
+				sess = newServerSession(session, headerStream)
+				sess.readHeaderTimeout = 50 * time.Millisecond
+				timedOut = make(chan struct{})
+			})
+
+			It("doesn't time out if the headers are received after the stream was accepted", func() {
+				sess.streamAccepted(5, func() { close(timedOut) })
+				Expect(sess.headersReceived(5)).To(BeTrue())
+				Consistently(timedOut, 100*time.Millisecond).ShouldNot(BeClosed())
+				Expect(sess.pendingHeaders).To(BeEmpty())
+			})
+
+			It("doesn't time out if the headers are received before the stream was accepted", func() {
+				Expect(sess.headersReceived(5)).To(BeTrue())
+				sess.streamAccepted(5, func() { close(timedOut) })
+				Consistently(timedOut, 100*time.Millisecond).ShouldNot(BeClosed())
+				Expect(sess.pendingHeaders).To(BeEmpty())
+				Expect(sess.receivedHeaders).To(BeEmpty())
+			})
+
+			It("times out every request separately", func() {
+				sess.streamAccepted(5, func() {})
+				Expect(sess.headersReceived(5)).To(BeTrue())
+				time.Sleep(30 * time.Millisecond)
+				sess.streamAccepted(7, func() { close(timedOut) })
+				Consistently(timedOut, 30*time.Millisecond).ShouldNot(BeClosed())
+				Eventually(timedOut).Should(BeClosed())
+				Expect(sess.headersReceived(7)).To(BeFalse())
+			})
+
+			It("ignores requests on streams that were already reset", func() {
+				var handlerCalled bool
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					handlerCalled = true
+				})
+				sess.streamAccepted(5, func() { close(timedOut) })
+				Eventually(timedOut).Should(BeClosed())
+				headerStream.dataToRead.Write(requestData)
+				Expect(s.handleRequest(sess, hpack.NewDecoder(4096, nil), http2.NewFramer(nil, headerStream))).To(Succeed())
+				Consistently(func() bool { return handlerCalled }).Should(BeFalse())
+			})
+
+			It("stops the timers when the session is closed", func() {
+				sess.streamAccepted(5, func() { close(timedOut) })
+				sess.close()
+				Consistently(timedOut, 100*time.Millisecond).ShouldNot(BeClosed())
+			})
+		})
+
+		It("uses the IdleTimeout once all requests are done", func() {
+			sess := newServerSession(session, headerStream)
+			sess.idleTimeout = time.Hour
+			headerStream.readDeadline = time.Now()
+			Expect(sess.startRequest(5)).To(BeTrue())
+			Expect(headerStream.readDeadline).To(BeZero())
+			sess.startPush()
+			sess.requestDone()
+			Expect(headerStream.readDeadline).To(BeZero())
+			sess.requestDone()
+			Expect(headerStream.readDeadline).To(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+		})
+	})
+
 	It("closes the connection if it encounters an error on the header stream", func() {
 		var handlerCalled bool
 		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -407,6 +861,70 @@ var _ = Describe("H2 server", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(hdr).To(Equal(expected))
 		})
+
+		It("announces the versions from the quic.Config", func() {
+			s.Server.Addr = ":443"
+			s.QuicConfig = &quic.Config{Versions: []protocol.VersionNumber{protocol.SupportedVersions[0]}}
+			hdr := http.Header{}
+			Expect(s.SetQuicHeaders(hdr)).To(Succeed())
+			Expect(hdr).To(Equal(getExpectedHeader([]protocol.VersionNumber{protocol.SupportedVersions[0]})))
+		})
+
+		It("announces the port that the server is listening on", func() {
+			s.Server.Addr = "localhost:0"
+			go s.ListenAndServe()
+			defer s.Close()
+			var ln quic.Listener
+			Eventually(func() quic.Listener {
+				s.mutex.Lock()
+				defer s.mutex.Unlock()
+				ln = s.listener
+				return ln
+			}).ShouldNot(BeNil())
+			hdr := http.Header{}
+			Expect(s.SetQuicHeaders(hdr)).To(Succeed())
+			Expect(hdr.Get("Alt-Svc")).To(HavePrefix(fmt.Sprintf(`quic=":%d";`, ln.Addr().(*net.UDPAddr).Port)))
+		})
+
+		It("sets the headers before calling the handler", func() {
+			s.Server.Addr = ":443"
+			var handlerCalled bool
+			handler := s.AltSvcHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(w.Header()).To(Equal(expected))
+				handlerCalled = true
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			Expect(handlerCalled).To(BeTrue())
+		})
+	})
+
+	Context("serving over TCP and QUIC", func() {
+		It("announces the QUIC server in the responses sent over TCP", func() {
+			tcpLn, err := net.Listen("tcp", "localhost:0")
+			Expect(err).ToNot(HaveOccurred())
+			udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			defer udpConn.Close()
+			serveErr := make(chan error, 1)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("foobar"))
+			})
+			go func() { serveErr <- ServeDual(tcpLn, udpConn, testdata.GetTLSConfig(), handler) }()
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+			rsp, err := client.Get("https://" + tcpLn.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer rsp.Body.Close()
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(rsp.Header.Get("Alt-Svc")).To(HavePrefix(fmt.Sprintf(`quic=":%d";`, udpConn.LocalAddr().(*net.UDPAddr).Port)))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal([]byte("foobar")))
+
+			// closing the TCP listener stops both servers
+			Expect(tcpLn.Close()).To(Succeed())
+			Eventually(serveErr).Should(Receive())
+		})
 	})
 
 	It("should error when ListenAndServe is called with s.Server nil", func() {
@@ -503,6 +1021,111 @@ var _ = Describe("H2 server", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	Context("shutting down", func() {
+		var (
+			headerStream *mockStream
+			sess         *serverSession
+		)
+
+		handleRequest := func() {
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(sess, hpack.NewDecoder(4096, nil), http2.NewFramer(nil, headerStream))
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			headerStream = &mockStream{id: 3}
+			sess = newServerSession(session, headerStream)
+			s.addSession(sess)
+		})
+
+		It("refuses new requests after going away", func() {
+			Expect(sess.startRequest(5)).To(BeTrue())
+			sess.goAway()
+			Expect(sess.startRequest(3)).To(BeTrue())
+			Expect(sess.startRequest(7)).To(BeFalse())
+			// gQUIC doesn't use the HTTP/2 GOAWAY frame
+			Expect(headerStream.dataWritten.Len()).To(BeZero())
+		})
+
+		It("resets the stream of refused requests", func() {
+			var handlerCalled bool
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handlerCalled = true })
+			sess.goAway()
+			handleRequest()
+			Expect(dataStream.reset).To(BeTrue())
+			Expect(dataStream.canceledWrite).To(BeTrue())
+			Expect(dataStream.cancelWriteCode).To(Equal(errorCodeStreamRefused))
+			Consistently(func() bool { return handlerCalled }).Should(BeFalse())
+		})
+
+		It("refuses new requests and waits for the handlers to return", func() {
+			handlerReturn := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-handlerReturn })
+			handleRequest()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(s.Shutdown(context.Background())).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(sess.startRequest(7)).To(BeFalse())
+			close(handlerReturn)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns when the context expires", func() {
+			handlerReturn := make(chan struct{})
+			defer close(handlerReturn)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-handlerReturn })
+			handleRequest()
+			ctx, cancel := context.WithCancel(context.Background())
+			errChan := make(chan error)
+			go func() { errChan <- s.Shutdown(ctx) }()
+			Consistently(errChan).ShouldNot(Receive())
+			cancel()
+			Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+		})
+
+		It("refuses requests on sessions that are handled after Shutdown was called", func() {
+			Expect(s.Shutdown(context.Background())).To(Succeed())
+			sess := newServerSession(session, &mockStream{id: 3})
+			s.addSession(sess)
+			Expect(sess.startRequest(5)).To(BeFalse())
+		})
+
+		It("calls the functions registered with RegisterOnShutdown", func() {
+			called := make(chan struct{})
+			s.RegisterOnShutdown(func() { close(called) })
+			Consistently(called).ShouldNot(BeClosed())
+			Expect(s.Shutdown(context.Background())).To(Succeed())
+			Eventually(called).Should(BeClosed())
+		})
+
+		It("errors when ListenAndServe is called after Shutdown", func() {
+			Expect(s.Shutdown(context.Background())).To(Succeed())
+			Expect(s.ListenAndServe()).To(MatchError("Server is already closed"))
+		})
+
+		It("makes ListenAndServe return http.ErrServerClosed", func() {
+			s.Server.Addr = "localhost:0"
+			errChan := make(chan error, 1)
+			go func() { errChan <- s.ListenAndServe() }()
+			Eventually(func() quic.Listener {
+				s.mutex.Lock()
+				defer s.mutex.Unlock()
+				return s.listener
+			}).ShouldNot(BeNil())
+			Expect(s.Shutdown(context.Background())).To(Succeed())
+			Eventually(errChan).Should(Receive(Equal(http.ErrServerClosed)))
+		})
+	})
+
 	It("errors when listening fails", func() {
 		testErr := errors.New("listen error")
 		quicListenAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Listener, error) {
@@ -0,0 +1,102 @@
+package http3
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// The body of a HTTP request or response.
+// It reads the payload of the DATA frames sent on the stream.
+type body struct {
+	str quic.Stream
+
+	// only set for the response body
+	// reqDone is closed when the application is done with the response:
+	// either when Read returns an error, or when Close is called.
+	reqDone       chan<- struct{}
+	reqDoneClosed bool
+
+	// onFrameError is called when the peer sent a frame that is not allowed on a request stream
+	onFrameError func()
+	// closeErrorCode is used to stop the peer from sending when the body is closed before it was read completely
+	closeErrorCode errorCode
+
+	bytesRemainingInFrame uint64
+}
+
+var _ io.ReadCloser = &body{}
+
+func newRequestBody(str quic.Stream, onFrameError func()) *body {
+	return &body{
+		str:          str,
+		onFrameError: onFrameError,
+		// the server doesn't need the rest of the request body, but the client can still use the response
+		closeErrorCode: errorNoError,
+	}
+}
+
+func newResponseBody(str quic.Stream, reqDone chan<- struct{}, onFrameError func()) *body {
+	return &body{
+		str:            str,
+		reqDone:        reqDone,
+		onFrameError:   onFrameError,
+		closeErrorCode: errorRequestCanceled,
+	}
+}
+
+func (r *body) Read(b []byte) (int, error) {
+	n, err := r.readImpl(b)
+	if err != nil {
+		r.requestDone()
+	}
+	return n, err
+}
+
+func (r *body) readImpl(b []byte) (int, error) {
+	for r.bytesRemainingInFrame == 0 {
+		f, err := parseNextFrame(r.str)
+		if err != nil {
+			return 0, err
+		}
+		switch f := f.(type) {
+		case *dataFrame:
+			r.bytesRemainingInFrame = f.Length
+		case *headersFrame:
+			// TODO: add support for trailers
+			if _, err := io.CopyN(ioutil.Discard, r.str, int64(f.Length)); err != nil {
+				return 0, err
+			}
+		default:
+			r.onFrameError()
+			return 0, fmt.Errorf("peer sent an unexpected frame: %T", f)
+		}
+	}
+
+	if uint64(len(b)) > r.bytesRemainingInFrame {
+		b = b[:r.bytesRemainingInFrame]
+	}
+	n, err := r.str.Read(b)
+	r.bytesRemainingInFrame -= uint64(n)
+	if err == io.EOF && r.bytesRemainingInFrame > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *body) requestDone() {
+	if r.reqDoneClosed || r.reqDone == nil {
+		return
+	}
+	close(r.reqDone)
+	r.reqDoneClosed = true
+}
+
+func (r *body) Close() error {
+	r.requestDone()
+	// If the EOF was read, CancelRead() is a no-op.
+	r.str.CancelRead(quic.ErrorCode(r.closeErrorCode))
+	return nil
+}
@@ -0,0 +1,179 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockStream struct {
+	id          protocol.StreamID
+	dataToRead  bytes.Buffer
+	dataWritten bytes.Buffer
+
+	closed          bool
+	canceledRead    bool
+	cancelReadCode  quic.ErrorCode
+	canceledWrite   bool
+	cancelWriteCode quic.ErrorCode
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+}
+
+var _ quic.Stream = &mockStream{}
+
+func newMockStream(id protocol.StreamID) *mockStream {
+	s := &mockStream{id: id}
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *mockStream) Close() error { s.closed = true; s.ctxCancel(); return nil }
+func (s *mockStream) CancelRead(code quic.ErrorCode) error {
+	s.canceledRead = true
+	s.cancelReadCode = code
+	return nil
+}
+func (s *mockStream) CancelWrite(code quic.ErrorCode) error {
+	s.canceledWrite = true
+	s.cancelWriteCode = code
+	s.ctxCancel()
+	return nil
+}
+func (s *mockStream) StreamID() protocol.StreamID      { return s.id }
+func (s *mockStream) Context() context.Context         { return s.ctx }
+func (s *mockStream) SetDeadline(time.Time) error      { panic("not implemented") }
+func (s *mockStream) SetReadDeadline(time.Time) error  { panic("not implemented") }
+func (s *mockStream) SetWriteDeadline(time.Time) error { panic("not implemented") }
+func (s *mockStream) SetPriority(int)                  { panic("not implemented") }
+func (s *mockStream) ReleaseCredit(int)                { panic("not implemented") }
+func (s *mockStream) ReadTerminationReason() quic.StreamTerminationReason {
+	panic("not implemented")
+}
+func (s *mockStream) ReadFrom(r io.Reader) (int64, error) { return io.Copy(struct{ io.Writer }{s}, r) }
+
+// Read returns io.EOF after all data was read
+func (s *mockStream) Read(p []byte) (int, error)  { return s.dataToRead.Read(p) }
+func (s *mockStream) Write(p []byte) (int, error) { return s.dataWritten.Write(p) }
+
+var _ = Describe("Body", func() {
+	var (
+		str          *mockStream
+		rb           *body
+		reqDone      chan struct{}
+		frameErrored bool
+	)
+
+	getDataFrame := func(data []byte) []byte {
+		b := &bytes.Buffer{}
+		(&dataFrame{Length: uint64(len(data))}).Write(b)
+		b.Write(data)
+		return b.Bytes()
+	}
+
+	BeforeEach(func() {
+		str = newMockStream(4)
+		reqDone = make(chan struct{})
+		frameErrored = false
+		rb = newResponseBody(str, reqDone, func() { frameErrored = true })
+	})
+
+	It("reads DATA frames in a single run", func() {
+		str.dataToRead.Write(getDataFrame([]byte("foobar")))
+		b := make([]byte, 6)
+		n, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(6))
+		Expect(b).To(Equal([]byte("foobar")))
+	})
+
+	It("reads DATA frames in multiple runs", func() {
+		str.dataToRead.Write(getDataFrame([]byte("foobar")))
+		b := make([]byte, 3)
+		n, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(b).To(Equal([]byte("foo")))
+		n, err = rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(b).To(Equal([]byte("bar")))
+	})
+
+	It("doesn't read more than the DATA frame's payload", func() {
+		str.dataToRead.Write(getDataFrame([]byte("foo")))
+		str.dataToRead.Write(getDataFrame([]byte("bar")))
+		b := make([]byte, 6)
+		n, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(b[:n]).To(Equal([]byte("foo")))
+		n, err = rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(b[:n]).To(Equal([]byte("bar")))
+	})
+
+	It("reads the whole body", func() {
+		str.dataToRead.Write(getDataFrame([]byte("foo")))
+		str.dataToRead.Write(getDataFrame(nil))
+		str.dataToRead.Write(getDataFrame([]byte("bar")))
+		data, err := ioutil.ReadAll(rb)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+		Expect(reqDone).To(BeClosed())
+	})
+
+	It("skips HEADERS frames", func() {
+		str.dataToRead.Write(getDataFrame([]byte("foo")))
+		(&headersFrame{Length: 5}).Write(&str.dataToRead)
+		str.dataToRead.Write([]byte("trail"))
+		data, err := ioutil.ReadAll(rb)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foo")))
+	})
+
+	It("errors when the stream ends in the middle of a DATA frame", func() {
+		str.dataToRead.Write(getDataFrame([]byte("foobar"))[:4])
+		_, err := ioutil.ReadAll(rb)
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+
+	It("closes the session when the peer sends an unexpected frame", func() {
+		(&settingsFrame{}).Write(&str.dataToRead)
+		_, err := rb.Read(make([]byte, 10))
+		Expect(err).To(MatchError("peer sent an unexpected frame: *http3.settingsFrame"))
+		Expect(frameErrored).To(BeTrue())
+		Expect(reqDone).To(BeClosed())
+	})
+
+	It("cancels reading when closed", func() {
+		Expect(rb.Close()).To(Succeed())
+		Expect(str.canceledRead).To(BeTrue())
+		Expect(str.cancelReadCode).To(BeEquivalentTo(errorRequestCanceled))
+		Expect(reqDone).To(BeClosed())
+	})
+
+	It("only closes the reqDone channel once", func() {
+		_, err := rb.Read(make([]byte, 10))
+		Expect(err).To(MatchError(io.EOF))
+		Expect(reqDone).To(BeClosed())
+		Expect(rb.Close()).To(Succeed())
+	})
+
+	It("stops the peer from sending the request body with H3_NO_ERROR", func() {
+		rb = newRequestBody(str, func() {})
+		Expect(rb.Close()).To(Succeed())
+		Expect(str.canceledRead).To(BeTrue())
+		Expect(str.cancelReadCode).To(BeEquivalentTo(errorNoError))
+	})
+})
@@ -0,0 +1,224 @@
+package http3
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+type roundTripperOpts struct {
+	DisableCompression bool
+	MaxHeaderBytes     int64
+}
+
+var dialAddr = quic.DialAddr
+
+// client is a HTTP3 client doing requests
+type client struct {
+	tlsConf *tls.Config
+	config  *quic.Config
+	opts    *roundTripperOpts
+
+	dialOnce     sync.Once
+	dialer       func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
+	handshakeErr error
+
+	requestWriter *requestWriter
+
+	decoder *qpack.Decoder
+
+	hostname string
+	session  quic.Session
+
+	logger utils.Logger
+}
+
+var _ http.RoundTripper = &client{}
+
+func newClient(
+	hostname string,
+	tlsConf *tls.Config,
+	opts *roundTripperOpts,
+	quicConfig *quic.Config,
+	dialer func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error),
+) *client {
+	logger := utils.DefaultLogger
+	return &client{
+		hostname:      authorityAddr("https", hostname),
+		tlsConf:       tlsConf,
+		requestWriter: newRequestWriter(logger),
+		decoder:       qpack.NewDecoder(),
+		config:        getQuicConfig(quicConfig),
+		opts:          opts,
+		dialer:        dialer,
+		logger:        logger,
+	}
+}
+
+func (c *client) dial() error {
+	var err error
+	if c.dialer != nil {
+		c.session, err = c.dialer("udp", c.hostname, c.tlsConf, c.config)
+	} else {
+		c.session, err = dialAddr(c.hostname, c.tlsConf, c.config)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := openControlStream(c.session, c.maxHeaderBytes()); err != nil {
+		c.logger.Errorf("Setting up session failed: %s", err)
+		c.session.Close(errorInternalError.connectionError(""))
+		return err
+	}
+	go handleUnidirectionalStreams(c.session, protocol.PerspectiveClient, c.logger)
+	return nil
+}
+
+func (c *client) maxHeaderBytes() uint64 {
+	return getMaxHeaderBytes(int(c.opts.MaxHeaderBytes))
+}
+
+// RoundTrip executes a request and returns a response
+func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return nil, errors.New("http3: unsupported scheme")
+	}
+	if authorityAddr("https", hostnameFromRequest(req)) != c.hostname {
+		return nil, fmt.Errorf("http3 client BUG: RoundTrip called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
+	}
+
+	c.dialOnce.Do(func() {
+		c.handshakeErr = c.dial()
+	})
+
+	if c.handshakeErr != nil {
+		return nil, c.handshakeErr
+	}
+
+	str, err := c.session.OpenStreamSyncContext(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	// Request Cancellation:
+	// This go routine keeps running even after RoundTrip() returns.
+	// It is shut down when the application is done processing the body.
+	reqDone := make(chan struct{})
+	go func() {
+		select {
+		case <-req.Context().Done():
+			str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+			str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+		case <-reqDone:
+		}
+	}()
+
+	rsp, rerr := c.doRequest(req, str, reqDone)
+	if rerr.err != nil { // if any error occurred
+		close(reqDone)
+		if rerr.streamErr != 0 { // if it was a stream error
+			str.CancelWrite(quic.ErrorCode(rerr.streamErr))
+		}
+		if rerr.connErr != 0 { // if it was a connection error
+			c.session.Close(rerr.connErr.connectionError(rerr.err.Error()))
+		}
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+	}
+	return rsp, rerr.err
+}
+
+func (c *client) doRequest(req *http.Request, str quic.Stream, reqDone chan struct{}) (*http.Response, requestError) {
+	var requestGzip bool
+	if !c.opts.DisableCompression && req.Method != "HEAD" && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+		requestGzip = true
+	}
+	if err := c.requestWriter.WriteRequest(str, req, requestGzip); err != nil {
+		return nil, newStreamError(errorInternalError, err)
+	}
+
+	frame, err := parseNextFrame(str)
+	if err != nil {
+		return nil, newStreamError(errorFrameError, err)
+	}
+	hf, ok := frame.(*headersFrame)
+	if !ok {
+		return nil, newConnError(errorFrameUnexpected, errors.New("expected first frame to be a HEADERS frame"))
+	}
+	if hf.Length > c.maxHeaderBytes() {
+		return nil, newStreamError(errorFrameError, fmt.Errorf("HEADERS frame too large: %d bytes (max: %d)", hf.Length, c.maxHeaderBytes()))
+	}
+	headerBlock := make([]byte, hf.Length)
+	if _, err := io.ReadFull(str, headerBlock); err != nil {
+		return nil, newStreamError(errorRequestIncomplete, err)
+	}
+	hfs, err := c.decoder.DecodeFull(headerBlock)
+	if err != nil {
+		// TODO: use the right error code
+		return nil, newConnError(errorGeneralProtocolError, err)
+	}
+
+	res, err := responseFromHeaders(hfs)
+	if err != nil {
+		return nil, newStreamError(errorMessageError, err)
+	}
+	respBody := newResponseBody(str, reqDone, func() {
+		c.session.Close(errorFrameUnexpected.connectionError(""))
+	})
+	if requestGzip && res.Header.Get("Content-Encoding") == "gzip" {
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Body = &gzipReader{body: respBody}
+		res.Uncompressed = true
+	} else {
+		res.Body = respBody
+	}
+	res.Request = req
+	return res, requestError{}
+}
+
+// Close closes the client
+func (c *client) Close() error {
+	if c.session == nil {
+		return nil
+	}
+	return c.session.Close(errorNoError.connectionError(""))
+}
+
+// copied from net/transport.go
+
+// authorityAddr returns a given authority (a host/IP, or host:port / ip:port)
+// and returns a host:port. The port 443 is added if needed.
+func authorityAddr(scheme string, authority string) (addr string) {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil { // authority didn't have a port
+		port = "443"
+		if scheme == "http" {
+			port = "80"
+		}
+		host = authority
+	}
+	if a, err := idna.ToASCII(host); err == nil {
+		host = a
+	}
+	// IPv6 address literal, without a port:
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host + ":" + port
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,29 @@
+package http3
+
+import (
+	"net/http"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// getQuicConfig returns the quic.Config used for HTTP/3 connections.
+// HTTP/3 is only defined for IETF QUIC, so IETF QUIC is used unless the application configured the versions.
+func getQuicConfig(conf *quic.Config) *quic.Config {
+	var c quic.Config
+	if conf != nil {
+		c = *conf
+	}
+	if len(c.Versions) == 0 {
+		c.Versions = []protocol.VersionNumber{protocol.VersionTLS}
+	}
+	return &c
+}
+
+// getMaxHeaderBytes returns the maximum size of a header block that we accept
+func getMaxHeaderBytes(maxHeaderBytes int) uint64 {
+	if maxHeaderBytes <= 0 {
+		return http.DefaultMaxHeaderBytes
+	}
+	return uint64(maxHeaderBytes)
+}
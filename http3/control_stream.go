@@ -0,0 +1,104 @@
+package http3
+
+import (
+	"bytes"
+	"sync/atomic"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// stream types of unidirectional streams
+const (
+	streamTypeControlStream      = 0x00
+	streamTypePushStream         = 0x01
+	streamTypeQPACKEncoderStream = 0x02
+	streamTypeQPACKDecoderStream = 0x03
+)
+
+// openControlStream opens the control stream, and sends the SETTINGS frame on it.
+// The control stream is never closed.
+func openControlStream(sess quic.Session, maxHeaderBytes uint64) error {
+	str, err := sess.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	utils.WriteVarInt(buf, streamTypeControlStream)
+	(&settingsFrame{Settings: map[uint64]uint64{settingMaxFieldSectionSize: maxHeaderBytes}}).Write(buf)
+	_, err = str.Write(buf.Bytes())
+	return err
+}
+
+// handleUnidirectionalStreams accepts the unidirectional streams opened by the peer, until the session is closed.
+// The first frame sent on the peer's control stream must be a SETTINGS frame.
+func handleUnidirectionalStreams(sess quic.Session, pers protocol.Perspective, logger utils.Logger) {
+	var rcvdControlStream int32
+	for {
+		str, err := sess.AcceptUniStream()
+		if err != nil {
+			logger.Debugf("accepting unidirectional stream failed: %s", err)
+			return
+		}
+
+		go func(str quic.ReceiveStream) {
+			streamType, err := utils.ReadVarInt(&byteReaderImpl{str})
+			if err != nil {
+				logger.Debugf("reading stream type on stream %d failed: %s", str.StreamID(), err)
+				return
+			}
+			switch streamType {
+			case streamTypeControlStream:
+			case streamTypeQPACKEncoderStream, streamTypeQPACKDecoderStream:
+				// The QPACK encoder and decoder only use the static table,
+				// so there's nothing to do with the instructions sent on these streams.
+				return
+			case streamTypePushStream:
+				if pers == protocol.PerspectiveServer {
+					sess.Close(errorStreamCreationError.connectionError("clients can't open push streams"))
+				} else {
+					// We never sent a MAX_PUSH_ID frame, so the server isn't allowed to push.
+					sess.Close(errorIDError.connectionError("unexpected push stream"))
+				}
+				return
+			default:
+				str.CancelRead(quic.ErrorCode(errorStreamCreationError))
+				return
+			}
+			if !atomic.CompareAndSwapInt32(&rcvdControlStream, 0, 1) {
+				sess.Close(errorStreamCreationError.connectionError("duplicate control stream"))
+				return
+			}
+			handleControlStream(sess, str)
+		}(str)
+	}
+}
+
+func handleControlStream(sess quic.Session, str quic.ReceiveStream) {
+	f, err := parseNextFrame(str)
+	if err != nil {
+		sess.Close(errorFrameError.connectionError(err.Error()))
+		return
+	}
+	if _, ok := f.(*settingsFrame); !ok {
+		sess.Close(errorMissingSettings.connectionError("first frame on the control stream must be a SETTINGS frame"))
+		return
+	}
+	// TODO: use the peer's SETTINGS_MAX_FIELD_SECTION_SIZE
+	for {
+		f, err := parseNextFrame(str)
+		if err != nil {
+			// If the session was closed, this is a no-op.
+			sess.Close(errorClosedCriticalStream.connectionError("control stream closed"))
+			return
+		}
+		switch f.(type) {
+		case *goAwayFrame:
+			// TODO: stop opening new requests after receiving a GOAWAY
+		default:
+			sess.Close(errorFrameUnexpected.connectionError("unexpected frame on the control stream"))
+			return
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package http3
+
+import (
+	"github.com/lucas-clemente/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Error Codes", func() {
+	It("has a string representation for every error code", func() {
+		for code := errorNoError; code <= errorVersionFallback; code++ {
+			Expect(code.String()).To(HavePrefix("H3_"))
+		}
+	})
+
+	It("has a string representation for unknown error codes", func() {
+		Expect(errorCode(0x1337).String()).To(Equal("unknown error code: 0x1337"))
+	})
+
+	It("converts error codes to connection errors", func() {
+		err := errorClosedCriticalStream.connectionError("foobar")
+		Expect(err).To(BeAssignableToTypeOf(&qerr.QuicError{}))
+		quicErr := err.(*qerr.QuicError)
+		Expect(quicErr.IsApplicationError()).To(BeTrue())
+		Expect(quicErr.ErrorCode).To(BeEquivalentTo(0x104))
+		Expect(quicErr.ErrorMessage).To(Equal("foobar"))
+	})
+})
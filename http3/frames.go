@@ -0,0 +1,181 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const (
+	frameTypeData     = 0x0
+	frameTypeHeaders  = 0x1
+	frameTypeSettings = 0x4
+	frameTypeGoAway   = 0x7
+)
+
+// maxSettingsFrameSize is the maximum size of a SETTINGS frame that we accept
+const maxSettingsFrameSize = 8 * (1 << 10)
+
+type byteReader interface {
+	io.ByteReader
+	io.Reader
+}
+
+// byteReaderImpl reads single bytes from an io.Reader.
+// It doesn't buffer, so it never consumes more data than needed.
+type byteReaderImpl struct{ io.Reader }
+
+func (br *byteReaderImpl) ReadByte() (byte, error) {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(br.Reader, b); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+type frame interface{}
+
+// parseNextFrame parses the next frame.
+// For DATA and HEADERS frames, only the frame header is read, the payload has to be read by the caller.
+// Frames of an unknown type and frames used for server push (which is not supported) are skipped.
+func parseNextFrame(r io.Reader) (frame, error) {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = &byteReaderImpl{r}
+	}
+	for {
+		t, err := utils.ReadVarInt(br)
+		if err != nil {
+			return nil, err
+		}
+		l, err := utils.ReadVarInt(br)
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case frameTypeData:
+			return &dataFrame{Length: l}, nil
+		case frameTypeHeaders:
+			return &headersFrame{Length: l}, nil
+		case frameTypeSettings:
+			return parseSettingsFrame(br, l)
+		case frameTypeGoAway:
+			return parseGoAwayFrame(br, l)
+		}
+		if _, err := io.CopyN(ioutil.Discard, br, int64(l)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readFramePayload reads the l byte payload of a frame
+func readFramePayload(r io.Reader, l uint64) ([]byte, error) {
+	payload := make([]byte, l)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+type dataFrame struct {
+	Length uint64
+}
+
+func (f *dataFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeData)
+	utils.WriteVarInt(b, f.Length)
+}
+
+type headersFrame struct {
+	Length uint64
+}
+
+func (f *headersFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeHeaders)
+	utils.WriteVarInt(b, f.Length)
+}
+
+// settingMaxFieldSectionSize is the SETTINGS_MAX_FIELD_SECTION_SIZE setting.
+// The QPACK settings are never sent, since the QPACK decoder doesn't support the dynamic table.
+const settingMaxFieldSectionSize = 0x6
+
+type settingsFrame struct {
+	Settings map[uint64]uint64
+}
+
+func parseSettingsFrame(r io.Reader, l uint64) (*settingsFrame, error) {
+	if l > maxSettingsFrameSize {
+		return nil, fmt.Errorf("unexpected size for SETTINGS frame: %d", l)
+	}
+	payload, err := readFramePayload(r, l)
+	if err != nil {
+		return nil, err
+	}
+	frame := &settingsFrame{Settings: make(map[uint64]uint64)}
+	b := bytes.NewReader(payload)
+	for b.Len() > 0 {
+		id, err := utils.ReadVarInt(b)
+		if err != nil {
+			return nil, err
+		}
+		val, err := utils.ReadVarInt(b)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := frame.Settings[id]; ok {
+			return nil, fmt.Errorf("duplicate setting: %d", id)
+		}
+		frame.Settings[id] = val
+	}
+	return frame, nil
+}
+
+func (f *settingsFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeSettings)
+	var l protocol.ByteCount
+	for id, val := range f.Settings {
+		l += utils.VarIntLen(id) + utils.VarIntLen(val)
+	}
+	utils.WriteVarInt(b, uint64(l))
+	for id, val := range f.Settings {
+		utils.WriteVarInt(b, id)
+		utils.WriteVarInt(b, val)
+	}
+}
+
+type goAwayFrame struct {
+	StreamID protocol.StreamID
+}
+
+func parseGoAwayFrame(r io.Reader, l uint64) (*goAwayFrame, error) {
+	if l > 8 {
+		return nil, fmt.Errorf("unexpected size for GOAWAY frame: %d", l)
+	}
+	payload, err := readFramePayload(r, l)
+	if err != nil {
+		return nil, err
+	}
+	b := bytes.NewReader(payload)
+	id, err := utils.ReadVarInt(b)
+	if err != nil {
+		return nil, err
+	}
+	if b.Len() > 0 {
+		return nil, errors.New("GOAWAY frame contains trailing data")
+	}
+	return &goAwayFrame{StreamID: protocol.StreamID(id)}, nil
+}
+
+func (f *goAwayFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeGoAway)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(uint64(f.StreamID))))
+	utils.WriteVarInt(b, uint64(f.StreamID))
+}
@@ -0,0 +1,13 @@
+package http3
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHttp3(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HTTP/3 Suite")
+}
@@ -0,0 +1,17 @@
+package http3
+
+// A requestError is an error that occurred while processing a request.
+// Depending on the error, either the request stream or the whole session has to be closed.
+type requestError struct {
+	err       error
+	streamErr errorCode
+	connErr   errorCode
+}
+
+func newStreamError(code errorCode, err error) requestError {
+	return requestError{err: err, streamErr: code}
+}
+
+func newConnError(code errorCode, err error) requestError {
+	return requestError{err: err, connErr: code}
+}
@@ -0,0 +1,230 @@
+package http3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/lex/httplex"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const defaultUserAgent = "quic-go HTTP/3"
+
+type requestWriter struct {
+	logger utils.Logger
+}
+
+func newRequestWriter(logger utils.Logger) *requestWriter {
+	return &requestWriter{logger: logger}
+}
+
+// WriteRequest writes the HEADERS frame of the request to the stream.
+// The request body is sent in a separate go routine, and the stream is closed after sending the body.
+func (w *requestWriter) WriteRequest(str quic.Stream, req *http.Request, gzip bool) error {
+	headers := &bytes.Buffer{}
+	if err := w.encodeHeaders(headers, req, gzip, "", actualContentLength(req)); err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	(&headersFrame{Length: uint64(headers.Len())}).Write(buf)
+	buf.Write(headers.Bytes())
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	// TODO: add support for trailers
+	if req.Body == nil {
+		return str.Close()
+	}
+
+	go func() {
+		if err := w.writeBody(str, req.Body); err != nil {
+			w.logger.Errorf("Error writing request: %s", err)
+			str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+			return
+		}
+		str.Close()
+	}()
+	return nil
+}
+
+// writeBody sends the request body in a single DATA frame per Read call
+func (w *requestWriter) writeBody(str quic.Stream, body io.ReadCloser) (err error) {
+	defer func() {
+		if cerr := body.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	b := make([]byte, bodyCopyBufferSize)
+	buf := &bytes.Buffer{}
+	for {
+		n, rerr := body.Read(b)
+		if n > 0 {
+			buf.Reset()
+			(&dataFrame{Length: uint64(n)}).Write(buf)
+			buf.Write(b[:n])
+			if _, err := str.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// bodyCopyBufferSize is the maximum size of a DATA frame sent for the request body
+const bodyCopyBufferSize = 8 * 1024
+
+// the rest of this file is copied from http2.Transport
+func (w *requestWriter) encodeHeaders(buf *bytes.Buffer, req *http.Request, addGzipHeader bool, trailers string, contentLength int64) error {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host, err := httplex.PunycodeHostPort(host)
+	if err != nil {
+		return err
+	}
+
+	var path string
+	if req.Method != "CONNECT" {
+		path = req.URL.RequestURI()
+		if !validPseudoPath(path) {
+			orig := path
+			path = strings.TrimPrefix(path, req.URL.Scheme+"://"+host)
+			if !validPseudoPath(path) {
+				if req.URL.Opaque != "" {
+					return fmt.Errorf("invalid request :path %q from URL.Opaque = %q", orig, req.URL.Opaque)
+				}
+				return fmt.Errorf("invalid request :path %q", orig)
+			}
+		}
+	}
+
+	// Check for any invalid headers and return an error before we
+	// start encoding the header block.
+	for k, vv := range req.Header {
+		if !httplex.ValidHeaderFieldName(k) {
+			return fmt.Errorf("invalid HTTP header name %q", k)
+		}
+		for _, v := range vv {
+			if !httplex.ValidHeaderFieldValue(v) {
+				return fmt.Errorf("invalid HTTP header value %q for header %q", v, k)
+			}
+		}
+	}
+
+	enc := qpack.NewEncoder(buf)
+	writeHeader := func(name, value string) {
+		w.logger.Debugf("http3: Transport encoding header %q = %q", name, value)
+		enc.WriteField(qpack.HeaderField{Name: name, Value: value})
+	}
+
+	// 8.1.2.3 Request Pseudo-Header Fields
+	// The :path pseudo-header field includes the path and query parts of the
+	// target URI (the path-absolute production and optionally a '?' character
+	// followed by the query production (see Sections 3.3 and 3.4 of
+	// [RFC3986]).
+	writeHeader(":authority", host)
+	writeHeader(":method", req.Method)
+	if req.Method != "CONNECT" {
+		writeHeader(":path", path)
+		writeHeader(":scheme", req.URL.Scheme)
+	}
+	if trailers != "" {
+		writeHeader("trailer", trailers)
+	}
+
+	var didUA bool
+	for k, vv := range req.Header {
+		lowKey := strings.ToLower(k)
+		switch lowKey {
+		case "host", "content-length":
+			// Host is :authority, already sent.
+			// Content-Length is automatic, set below.
+			continue
+		case "connection", "proxy-connection", "transfer-encoding", "upgrade", "keep-alive":
+			// Per 8.1.2.2 Connection-Specific Header
+			// Fields, don't send connection-specific
+			// fields. We have already checked if any
+			// are error-worthy so just ignore the rest.
+			continue
+		case "user-agent":
+			// Match Go's http1 behavior: at most one
+			// User-Agent. If set to nil or empty string,
+			// then omit it. Otherwise if not mentioned,
+			// include the default (below).
+			didUA = true
+			if len(vv) < 1 {
+				continue
+			}
+			vv = vv[:1]
+			if vv[0] == "" {
+				continue
+			}
+		}
+		for _, v := range vv {
+			writeHeader(lowKey, v)
+		}
+	}
+	if shouldSendReqContentLength(req.Method, contentLength) {
+		writeHeader("content-length", strconv.FormatInt(contentLength, 10))
+	}
+	if addGzipHeader {
+		writeHeader("accept-encoding", "gzip")
+	}
+	if !didUA {
+		writeHeader("user-agent", defaultUserAgent)
+	}
+	return nil
+}
+
+// shouldSendReqContentLength reports whether the http2.Transport should send
+// a "content-length" request header. This logic is basically a copy of the net/http
+// transferWriter.shouldSendContentLength.
+// The contentLength is the corrected contentLength (so 0 means actually 0, not unknown).
+// -1 means unknown.
+func shouldSendReqContentLength(method string, contentLength int64) bool {
+	if contentLength > 0 {
+		return true
+	}
+	if contentLength < 0 {
+		return false
+	}
+	// For zero bodies, whether we send a content-length depends on the method.
+	// It also kinda doesn't matter for http2 either way, with END_STREAM.
+	switch method {
+	case "POST", "PUT", "PATCH":
+		return true
+	default:
+		return false
+	}
+}
+
+func validPseudoPath(v string) bool {
+	return (len(v) > 0 && v[0] == '/' && (len(v) == 1 || v[1] != '/')) || v == "*"
+}
+
+// actualContentLength returns a sanitized version of
+// req.ContentLength, where 0 actually means zero (not unknown) and -1
+// means unknown.
+func actualContentLength(req *http.Request) int64 {
+	if req.Body == nil {
+		return 0
+	}
+	if req.ContentLength != 0 {
+		return req.ContentLength
+	}
+	return -1
+}
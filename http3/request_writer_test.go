@@ -0,0 +1,142 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/lucas-clemente/quic-go/internal/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type trackingReadCloser struct {
+	io.Reader
+	closed bool
+}
+
+func (r *trackingReadCloser) Close() error {
+	r.closed = true
+	return nil
+}
+
+var _ = Describe("Request Writer", func() {
+	var (
+		rw  *requestWriter
+		str *mockStream
+	)
+
+	decode := func(str io.Reader) map[string] /* HeaderField.Name */ string /* HeaderField.Value */ {
+		frame, err := parseNextFrame(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&headersFrame{}))
+		data := make([]byte, frame.(*headersFrame).Length)
+		_, err = io.ReadFull(str, data)
+		Expect(err).ToNot(HaveOccurred())
+		hfs, err := qpack.NewDecoder().DecodeFull(data)
+		Expect(err).ToNot(HaveOccurred())
+		values := make(map[string]string)
+		for _, hf := range hfs {
+			values[hf.Name] = hf.Value
+		}
+		return values
+	}
+
+	BeforeEach(func() {
+		rw = newRequestWriter(utils.DefaultLogger)
+		str = newMockStream(4)
+	})
+
+	It("writes a GET request", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html?foo=bar", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		headerFields := decode(&str.dataWritten)
+		Expect(headerFields).To(HaveKeyWithValue(":authority", "quic.clemente.io"))
+		Expect(headerFields).To(HaveKeyWithValue(":method", "GET"))
+		Expect(headerFields).To(HaveKeyWithValue(":path", "/index.html?foo=bar"))
+		Expect(headerFields).To(HaveKeyWithValue(":scheme", "https"))
+		Expect(headerFields).To(HaveKeyWithValue("user-agent", defaultUserAgent))
+		Expect(headerFields).ToNot(HaveKey("accept-encoding"))
+		Expect(str.closed).To(BeTrue())
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("requests gzip compression, if requested", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html?foo=bar", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteRequest(str, req, true)).To(Succeed())
+		headerFields := decode(&str.dataWritten)
+		Expect(headerFields).To(HaveKeyWithValue("accept-encoding", "gzip"))
+	})
+
+	It("sends cookies", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		cookie1 := &http.Cookie{
+			Name:  "Cookie #1",
+			Value: "Value #1",
+		}
+		cookie2 := &http.Cookie{
+			Name:  "Cookie #2",
+			Value: "Value #2",
+		}
+		req.AddCookie(cookie1)
+		req.AddCookie(cookie2)
+		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		headerFields := decode(&str.dataWritten)
+		// TODO(lclemente): Remove Or() once we drop support for Go 1.8.
+		Expect(headerFields).To(Or(
+			HaveKeyWithValue("cookie", "Cookie #1=Value #1; Cookie #2=Value #2"),
+			HaveKeyWithValue("cookie", `Cookie #1="Value #1"; Cookie #2="Value #2"`),
+		))
+	})
+
+	It("rejects invalid header values", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("foo", "bar\r\n")
+		Expect(rw.WriteRequest(str, req, false)).To(MatchError("invalid HTTP header value \"bar\\r\\n\" for header \"Foo\""))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("writes a POST request", func() {
+		body := ioutil.NopCloser(strings.NewReader("foobar"))
+		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.writeBody(str, req.Body)).To(Succeed())
+		frame, err := parseNextFrame(&str.dataWritten)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(&dataFrame{Length: 6}))
+		Expect(str.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+	})
+
+	It("sends the content length of a POST request", func() {
+		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", strings.NewReader("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		headers := &bytes.Buffer{}
+		Expect(rw.encodeHeaders(headers, req, false, "", actualContentLength(req))).To(Succeed())
+		buf := &bytes.Buffer{}
+		(&headersFrame{Length: uint64(headers.Len())}).Write(buf)
+		buf.Write(headers.Bytes())
+		headerFields := decode(buf)
+		Expect(headerFields).To(HaveKeyWithValue(":method", "POST"))
+		Expect(headerFields).To(HaveKeyWithValue("content-length", "6"))
+	})
+
+	It("closes the request body when reading from it fails", func() {
+		testErr := errors.New("test error")
+		body := &trackingReadCloser{Reader: io.MultiReader(strings.NewReader("foo"), &errorReader{err: testErr})}
+		Expect(rw.writeBody(str, body)).To(MatchError(testErr))
+		Expect(body.closed).To(BeTrue())
+	})
+})
+
+type errorReader struct{ err error }
+
+func (r *errorReader) Read([]byte) (int, error) { return 0, r.err }
@@ -0,0 +1,68 @@
+package http3
+
+import (
+	"net/http"
+
+	"github.com/lucas-clemente/quic-go/internal/qpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response", func() {
+	It("populates the response", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":status", Value: "404"},
+			{Name: "content-length", Value: "42"},
+			{Name: "foo", Value: "bar"},
+			{Name: "foo", Value: "baz"},
+		}
+		rsp, err := responseFromHeaders(headers)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.Proto).To(Equal("HTTP/3"))
+		Expect(rsp.ProtoMajor).To(Equal(3))
+		Expect(rsp.StatusCode).To(Equal(404))
+		Expect(rsp.Status).To(Equal("404 Not Found"))
+		Expect(rsp.ContentLength).To(Equal(int64(42)))
+		Expect(rsp.Header).To(Equal(http.Header{
+			"Content-Length": []string{"42"},
+			"Foo":            []string{"bar", "baz"},
+		}))
+	})
+
+	It("sets an unknown content length", func() {
+		rsp, err := responseFromHeaders([]qpack.HeaderField{{Name: ":status", Value: "200"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.ContentLength).To(Equal(int64(-1)))
+	})
+
+	It("announces trailers", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: "trailer", Value: "foo, bar"},
+		}
+		rsp, err := responseFromHeaders(headers)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.Trailer).To(HaveKey("Foo"))
+		Expect(rsp.Trailer).To(HaveKey("Bar"))
+	})
+
+	It("errors when the status is missing", func() {
+		_, err := responseFromHeaders([]qpack.HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).To(MatchError("missing status pseudo header"))
+	})
+
+	It("errors when the status is not a number", func() {
+		_, err := responseFromHeaders([]qpack.HeaderField{{Name: ":status", Value: "foo"}})
+		Expect(err).To(MatchError("malformed non-numeric status pseudo header"))
+	})
+
+	It("errors on request pseudo headers", func() {
+		headers := []qpack.HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: ":path", Value: "/foo"},
+		}
+		_, err := responseFromHeaders(headers)
+		Expect(err).To(MatchError("invalid response pseudo header: :path"))
+	})
+})
@@ -0,0 +1,136 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/lucas-clemente/quic-go/internal/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response Writer", func() {
+	var (
+		w   *responseWriter
+		str *mockStream
+	)
+
+	BeforeEach(func() {
+		str = newMockStream(4)
+		w = newResponseWriter(str, utils.DefaultLogger)
+	})
+
+	decodeHeader := func(str io.Reader) map[string][]string {
+		fields := make(map[string][]string)
+		frame, err := parseNextFrame(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&headersFrame{}))
+		data := make([]byte, frame.(*headersFrame).Length)
+		_, err = io.ReadFull(str, data)
+		Expect(err).ToNot(HaveOccurred())
+		hfs, err := qpack.NewDecoder().DecodeFull(data)
+		Expect(err).ToNot(HaveOccurred())
+		for _, p := range hfs {
+			fields[p.Name] = append(fields[p.Name], p.Value)
+		}
+		return fields
+	}
+
+	getData := func(str io.Reader) []byte {
+		frame, err := parseNextFrame(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&dataFrame{}))
+		data := make([]byte, frame.(*dataFrame).Length)
+		_, err = io.ReadFull(str, data)
+		Expect(err).ToNot(HaveOccurred())
+		return data
+	}
+
+	It("writes status", func() {
+		w.WriteHeader(http.StatusTeapot)
+		fields := decodeHeader(&str.dataWritten)
+		Expect(fields).To(HaveLen(1))
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
+	})
+
+	It("writes headers", func() {
+		w.Header().Add("content-length", "42")
+		w.WriteHeader(http.StatusTeapot)
+		fields := decodeHeader(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue("content-length", []string{"42"}))
+	})
+
+	It("writes multiple headers with the same name", func() {
+		const cookie1 = "test1=1; Max-Age=7200; path=/"
+		const cookie2 = "test2=2; Max-Age=7200; path=/"
+		w.Header().Add("set-cookie", cookie1)
+		w.Header().Add("set-cookie", cookie2)
+		w.WriteHeader(http.StatusTeapot)
+		fields := decodeHeader(&str.dataWritten)
+		Expect(fields).To(HaveKey("set-cookie"))
+		cookies := fields["set-cookie"]
+		Expect(cookies).To(ContainElement(cookie1))
+		Expect(cookies).To(ContainElement(cookie2))
+	})
+
+	It("writes data", func() {
+		n, err := w.Write([]byte("foobar"))
+		Expect(n).To(Equal(6))
+		Expect(err).ToNot(HaveOccurred())
+		// Should have written 200 on the header stream
+		fields := decodeHeader(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		// And foobar on the data stream
+		Expect(getData(&str.dataWritten)).To(Equal([]byte("foobar")))
+	})
+
+	It("writes data after WriteHeader is called", func() {
+		w.WriteHeader(http.StatusTeapot)
+		n, err := w.Write([]byte("foobar"))
+		Expect(n).To(Equal(6))
+		Expect(err).ToNot(HaveOccurred())
+		fields := decodeHeader(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
+		Expect(getData(&str.dataWritten)).To(Equal([]byte("foobar")))
+	})
+
+	It("writes one DATA frame per Write call", func() {
+		w.Write([]byte("foo"))
+		w.Write([]byte("bar"))
+		decodeHeader(&str.dataWritten)
+		Expect(getData(&str.dataWritten)).To(Equal([]byte("foo")))
+		Expect(getData(&str.dataWritten)).To(Equal([]byte("bar")))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("doesn't write empty DATA frames", func() {
+		w.WriteHeader(http.StatusOK)
+		buf := &bytes.Buffer{}
+		buf.Write(str.dataWritten.Bytes())
+		n, err := w.Write(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeZero())
+		Expect(str.dataWritten.Bytes()).To(Equal(buf.Bytes()))
+	})
+
+	It("does not WriteHeader() twice", func() {
+		w.WriteHeader(200)
+		w.WriteHeader(500)
+		fields := decodeHeader(&str.dataWritten)
+		Expect(fields).To(HaveLen(1))
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("doesn't allow writes if the status code doesn't allow a body", func() {
+		w.WriteHeader(304)
+		n, err := w.Write([]byte("foobar"))
+		Expect(n).To(BeZero())
+		Expect(err).To(MatchError(http.ErrBodyNotAllowed))
+		decodeHeader(&str.dataWritten)
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+})
@@ -0,0 +1,193 @@
+package http3
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockBody struct {
+	closed bool
+}
+
+func (m *mockBody) Read(p []byte) (int, error) { return 0, errors.New("not implemented") }
+func (m *mockBody) Close() error               { m.closed = true; return nil }
+
+var _ = Describe("RoundTripper", func() {
+	var (
+		rt   *RoundTripper
+		req1 *http.Request
+	)
+
+	BeforeEach(func() {
+		rt = &RoundTripper{}
+		var err error
+		req1, err = http.NewRequest("GET", "https://www.example.org/file1.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("dialing hosts", func() {
+		origDialAddr := dialAddr
+		dialErr := errors.New("dial error")
+
+		BeforeEach(func() {
+			origDialAddr = dialAddr
+			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+				return nil, dialErr
+			}
+		})
+
+		AfterEach(func() {
+			dialAddr = origDialAddr
+		})
+
+		It("creates new clients", func() {
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(dialErr))
+			Expect(rt.clients).To(HaveLen(1))
+		})
+
+		It("uses IETF QUIC by default", func() {
+			var receivedConfig *quic.Config
+			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+				receivedConfig = config
+				return nil, dialErr
+			}
+			rt.RoundTrip(req1)
+			Expect(receivedConfig.Versions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS}))
+		})
+
+		It("uses the quic.Config, if provided", func() {
+			config := &quic.Config{HandshakeTimeout: time.Millisecond}
+			var receivedConfig *quic.Config
+			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+				receivedConfig = config
+				return nil, dialErr
+			}
+			rt.QuicConfig = config
+			rt.RoundTrip(req1)
+			Expect(receivedConfig.HandshakeTimeout).To(Equal(time.Millisecond))
+			Expect(receivedConfig.Versions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS}))
+			// the quic.Config is not modified
+			Expect(config.Versions).To(BeEmpty())
+		})
+
+		It("uses the custom dialer, if provided", func() {
+			var dialed bool
+			dialer := func(_, _ string, tlsCfgP *tls.Config, cfg *quic.Config) (quic.Session, error) {
+				dialed = true
+				return nil, dialErr
+			}
+			rt.Dial = dialer
+			rt.RoundTrip(req1)
+			Expect(dialed).To(BeTrue())
+		})
+
+		It("reuses existing clients", func() {
+			var count int
+			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+				count++
+				return nil, dialErr
+			}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/file1.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(dialErr))
+			Expect(rt.clients).To(HaveLen(1))
+			req2, err := http.NewRequest("GET", "https://quic.clemente.io/file2.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req2)
+			Expect(err).To(MatchError(dialErr))
+			Expect(rt.clients).To(HaveLen(1))
+			Expect(count).To(Equal(1))
+		})
+
+		It("doesn't create new clients if RoundTripOpt.OnlyCachedConn is set", func() {
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTripOpt(req, RoundTripOpt{OnlyCachedConn: true})
+			Expect(err).To(MatchError(ErrNoCachedConn))
+		})
+	})
+
+	Context("validating request", func() {
+		It("rejects plain HTTP requests", func() {
+			req, err := http.NewRequest("GET", "http://www.example.org/", nil)
+			req.Body = &mockBody{}
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("http3: unsupported protocol scheme: http"))
+			Expect(req.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("rejects requests without a URL", func() {
+			req1.URL = nil
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("http3: nil Request.URL"))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("rejects request without a URL Host", func() {
+			req1.URL.Host = ""
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("http3: no Host in request URL"))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("rejects requests without a header", func() {
+			req1.Header = nil
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("http3: nil Request.Header"))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("rejects requests with invalid header name fields", func() {
+			req1.Header.Add("foobär", "value")
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("http3: invalid http header field name \"foobär\""))
+		})
+
+		It("rejects requests with invalid header name values", func() {
+			req1.Header.Add("foo", string([]byte{0x7}))
+			_, err := rt.RoundTrip(req1)
+			Expect(err.Error()).To(ContainSubstring("http3: invalid http header field value"))
+		})
+
+		It("rejects requests with an invalid request method", func() {
+			req1.Method = "foobär"
+			req1.Body = ioutil.NopCloser(strings.NewReader(""))
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("http3: invalid method \"foobär\""))
+		})
+	})
+
+	Context("closing", func() {
+		It("closes", func() {
+			rt.clients = make(map[string]roundTripCloser)
+			cl := newClient("foo.bar", nil, &roundTripperOpts{}, nil, nil)
+			rt.clients["foo.bar"] = cl
+			Expect(rt.Close()).To(Succeed())
+			Expect(len(rt.clients)).To(BeZero())
+		})
+
+		It("closes a RoundTripper that has never been used", func() {
+			Expect(len(rt.clients)).To(BeZero())
+			Expect(rt.Close()).To(Succeed())
+			Expect(len(rt.clients)).To(BeZero())
+		})
+	})
+})
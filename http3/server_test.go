@@ -0,0 +1,244 @@
+package http3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	It("errors when used without a http.Server", func() {
+		s := &Server{}
+		Expect(s.ListenAndServe()).To(MatchError("use of http3.Server without http.Server"))
+		Expect(s.Serve(nil)).To(MatchError("use of http3.Server without http.Server"))
+	})
+
+	It("errors when the certificate can't be loaded", func() {
+		s := &Server{Server: &http.Server{}}
+		Expect(s.ListenAndServeTLS("", "")).ToNot(Succeed())
+	})
+
+	It("refuses to serve after it was closed", func() {
+		s := &Server{Server: &http.Server{}}
+		Expect(s.Close()).To(Succeed())
+		Expect(s.ListenAndServe()).To(MatchError("Server is already closed"))
+	})
+
+	It("sets the Alt-Svc header", func() {
+		s := &Server{Server: &http.Server{Addr: "localhost:1337"}}
+		hdr := http.Header{}
+		Expect(s.SetQuicHeaders(hdr)).To(Succeed())
+		Expect(hdr).To(Equal(http.Header{"Alt-Svc": []string{`h3=":1337"; ma=2592000`}}))
+	})
+
+	Context("serving requests", func() {
+		var (
+			s          *Server
+			mux        *http.ServeMux
+			serverAddr net.Addr
+			serveErr   chan error
+			rt         *RoundTripper
+			client     *http.Client
+			conns      []net.PacketConn
+		)
+
+		// dial uses quic.clemente.io for SNI, so that the server finds a certificate
+		dial := func(tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			conns = append(conns, conn)
+			return quic.Dial(conn, serverAddr, "quic.clemente.io:443", tlsConf, config)
+		}
+
+		BeforeEach(func() {
+			mux = http.NewServeMux()
+			s = &Server{
+				Server: &http.Server{
+					Handler:   mux,
+					TLSConfig: testdata.GetTLSConfig(),
+				},
+				logger: utils.DefaultLogger,
+			}
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			serverAddr = conn.LocalAddr()
+			serveErr = make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				serveErr <- s.Serve(conn)
+			}()
+
+			rt = &RoundTripper{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				Dial: func(_, _ string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+					return dial(tlsConf, config)
+				},
+			}
+			client = &http.Client{Transport: rt}
+		})
+
+		AfterEach(func() {
+			Expect(rt.Close()).To(Succeed())
+			Expect(s.Close()).To(Succeed())
+			Eventually(serveErr).Should(Receive())
+			for _, conn := range conns {
+				conn.Close()
+			}
+			conns = nil
+		})
+
+		It("refuses to serve twice", func() {
+			Eventually(func() quic.Listener {
+				s.listenerMutex.Lock()
+				defer s.listenerMutex.Unlock()
+				return s.listener
+			}).ShouldNot(BeNil())
+			Expect(s.Serve(nil)).To(MatchError("ListenAndServe may only be called once"))
+		})
+
+		It("handles a GET request", func() {
+			mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Proto).To(Equal("HTTP/3"))
+				Expect(r.Host).To(Equal("quic.clemente.io"))
+				Expect(r.Header.Get("User-Agent")).To(Equal(defaultUserAgent))
+				w.Header().Set("foo", "bar")
+				w.Write([]byte("Hello, World!\n"))
+			})
+			rsp, err := client.Get("https://quic.clemente.io/hello")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(rsp.Proto).To(Equal("HTTP/3"))
+			Expect(rsp.Header.Get("foo")).To(Equal("bar"))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("Hello, World!\n"))
+		})
+
+		It("uploads a request body", func() {
+			data := bytes.Repeat([]byte("foobar"), 10000)
+			mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.ContentLength).To(Equal(int64(len(data))))
+				body, err := ioutil.ReadAll(r.Body)
+				Expect(err).ToNot(HaveOccurred())
+				w.Write(body)
+			})
+			rsp, err := client.Post("https://quic.clemente.io/echo", "text/plain", bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal(data))
+		})
+
+		It("handles multiple requests on the same connection", func() {
+			mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			})
+			for i := 0; i < 5; i++ {
+				rsp, err := client.Get("https://quic.clemente.io/hello")
+				Expect(err).ToNot(HaveOccurred())
+				body, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("hello"))
+			}
+			Expect(rt.clients).To(HaveLen(1))
+		})
+
+		It("returns the status code set by the handler", func() {
+			rsp, err := client.Get("https://quic.clemente.io/not-found")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(404))
+		})
+
+		It("responds with 500 if the handler panics", func() {
+			mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+				panic("foobar")
+			})
+			rsp, err := client.Get("https://quic.clemente.io/panic")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(500))
+		})
+
+		It("transparently decompresses gzipped responses", func() {
+			mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Header.Get("Accept-Encoding")).To(Equal("gzip"))
+				w.Header().Set("Content-Encoding", "gzip")
+				gw := gzip.NewWriter(w)
+				gw.Write([]byte("compressed"))
+				Expect(gw.Close()).To(Succeed())
+			})
+			rsp, err := client.Get("https://quic.clemente.io/gzip")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Uncompressed).To(BeTrue())
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("compressed"))
+		})
+
+		It("cancels requests when the context is canceled", func() {
+			handlerCalled := make(chan struct{})
+			mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+				close(handlerCalled)
+				<-r.Context().Done()
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/slow", nil)
+			Expect(err).ToNot(HaveOccurred())
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := client.Do(req.WithContext(ctx))
+				errChan <- err
+			}()
+			Eventually(handlerCalled).Should(BeClosed())
+			cancel()
+			var rerr error
+			Eventually(errChan).Should(Receive(&rerr))
+			Expect(rerr).To(HaveOccurred())
+			Expect(rerr.Error()).To(ContainSubstring(context.Canceled.Error()))
+		})
+
+		It("closes the connection if the peer's control stream doesn't start with a SETTINGS frame", func() {
+			sess, err := dial(
+				&tls.Config{InsecureSkipVerify: true},
+				&quic.Config{Versions: []protocol.VersionNumber{protocol.VersionTLS}},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			buf := &bytes.Buffer{}
+			utils.WriteVarInt(buf, streamTypeControlStream)
+			(&dataFrame{}).Write(buf)
+			_, err = str.Write(buf.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				_, err := sess.AcceptStream()
+				var appErr *qerr.ApplicationError
+				Expect(errors.As(err, &appErr)).To(BeTrue())
+				Expect(appErr.Remote).To(BeTrue())
+				Expect(appErr.ErrorCode).To(BeEquivalentTo(errorMissingSettings))
+			}()
+			Eventually(done, 5*time.Second).Should(BeClosed())
+		})
+	})
+})
@@ -83,7 +83,8 @@ var _ = Describe("Handshake RTT tests", func() {
 		}
 		_, err := quic.DialAddr(proxy.LocalAddr().String(), nil, clientConfig)
 		Expect(err).To(HaveOccurred())
-		Expect(err.(qerr.ErrorCode)).To(Equal(qerr.InvalidVersion))
+		Expect(err).To(BeAssignableToTypeOf(&qerr.VersionNegotiationError{}))
+		Expect(err).To(MatchError(qerr.InvalidVersion))
 		expectDurationInRTTs(1)
 	})
 
@@ -109,8 +110,8 @@ var _ = Describe("Handshake RTT tests", func() {
 		expectDurationInRTTs(4)
 	})
 
-	It("is forward-secure after 2 RTTs when the server doesn't require a Cookie", func() {
-		serverConfig.AcceptCookie = func(_ net.Addr, _ *quic.Cookie) bool {
+	It("is forward-secure after 2 RTTs when the server doesn't require a Token", func() {
+		serverConfig.AcceptToken = func(_ net.Addr, _ *quic.Token) bool {
 			return true
 		}
 		runServerAndProxy()
@@ -119,14 +120,14 @@ var _ = Describe("Handshake RTT tests", func() {
 		expectDurationInRTTs(2)
 	})
 
-	It("doesn't complete the handshake when the server never accepts the Cookie", func() {
-		serverConfig.AcceptCookie = func(_ net.Addr, _ *quic.Cookie) bool {
+	It("doesn't complete the handshake when the server never accepts the Token", func() {
+		serverConfig.AcceptToken = func(_ net.Addr, _ *quic.Token) bool {
 			return false
 		}
 		runServerAndProxy()
 		_, err := quic.DialAddr(proxy.LocalAddr().String(), &tls.Config{InsecureSkipVerify: true}, nil)
 		Expect(err).To(HaveOccurred())
-		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.CryptoTooManyRejects))
+		Expect(err).To(MatchError(qerr.CryptoTooManyRejects))
 	})
 
 	It("doesn't complete the handshake when the handshake timeout is too short", func() {
@@ -134,7 +135,7 @@ var _ = Describe("Handshake RTT tests", func() {
 		runServerAndProxy()
 		_, err := quic.DialAddr(proxy.LocalAddr().String(), &tls.Config{InsecureSkipVerify: true}, nil)
 		Expect(err).To(HaveOccurred())
-		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.HandshakeTimeout))
+		Expect(err).To(BeAssignableToTypeOf(&qerr.HandshakeTimeoutError{}))
 		// 2 RTTs during the timeout
 		// plus 1 RTT: the timer starts 0.5 RTTs after sending the first packet, and the CONNECTION_CLOSE needs another 0.5 RTTs to reach the client
 		expectDurationInRTTs(3)
@@ -1,17 +1,77 @@
 package self
 
 import (
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"strings"
+	"sync"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/testdata"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+type countingSessionCache struct {
+	tls.ClientSessionCache
+
+	mutex      sync.Mutex
+	puts, hits int
+}
+
+func (c *countingSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	state, ok := c.ClientSessionCache.Get(sessionKey)
+	if ok {
+		c.mutex.Lock()
+		c.hits++
+		c.mutex.Unlock()
+	}
+	return state, ok
+}
+
+func (c *countingSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.mutex.Lock()
+	c.puts++
+	c.mutex.Unlock()
+	c.ClientSessionCache.Put(sessionKey, cs)
+}
+
+func (c *countingSessionCache) Puts() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.puts
+}
+
+func (c *countingSessionCache) Hits() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.hits
+}
+
 var _ = Describe("Handshake tests", func() {
 	var (
 		server        quic.Listener
@@ -83,6 +143,450 @@ var _ = Describe("Handshake tests", func() {
 		})
 	})
 
+	Context("connection ID length", func() {
+		for _, l := range []int{4, 8, 18} {
+			connIDLen := l
+
+			It(fmt.Sprintf("completes the handshake using %d byte connection IDs", connIDLen), func() {
+				serverConfig.Versions = []protocol.VersionNumber{protocol.VersionTLS}
+				serverConfig.ConnectionIDLength = connIDLen
+				runServer()
+				conf := &quic.Config{
+					Versions:           []protocol.VersionNumber{protocol.VersionTLS},
+					ConnectionIDLength: connIDLen,
+				}
+				sess, err := quic.DialAddr(server.Addr().String(), &tls.Config{InsecureSkipVerify: true}, conf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess.ConnectionState().HandshakeComplete).To(BeTrue())
+				Expect(sess.Close(nil)).To(Succeed())
+			})
+		}
+	})
+
+	Context("connection ID omission", func() {
+		It("transfers data in both directions, if the client requested the omission of the connection ID", func() {
+			var err error
+			serverConfig.Versions = []protocol.VersionNumber{protocol.Version39}
+			server, err = quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			// echo the data sent on the first stream
+			go func() {
+				defer GinkgoRecover()
+				defer close(acceptStopped)
+				sess, err := server.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				str, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Close()).To(Succeed())
+			}()
+
+			conf := &quic.Config{
+				Versions:                    []protocol.VersionNumber{protocol.Version39},
+				RequestConnectionIDOmission: true,
+			}
+			sess, err := quic.DialAddr(server.Addr().String(), &tls.Config{InsecureSkipVerify: true}, conf)
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write(testserver.PRData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+			data, err := ioutil.ReadAll(str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(testserver.PRData))
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+	})
+
+	Context("using the crypto/tls stack", func() {
+		BeforeEach(func() {
+			serverConfig.Versions = []protocol.VersionNumber{protocol.VersionTLS}
+			serverConfig.TLSStack = quic.TLSStackStandardLibrary
+		})
+
+		dial := func(tlsConf *tls.Config) (quic.Session, error) {
+			return quic.DialAddr(server.Addr().String(), tlsConf, &quic.Config{
+				Versions: []protocol.VersionNumber{protocol.VersionTLS},
+				TLSStack: quic.TLSStackStandardLibrary,
+			})
+		}
+
+		It("transfers data", func() {
+			var err error
+			server, err = quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			// echo the data sent on the first stream
+			go func() {
+				defer GinkgoRecover()
+				defer close(acceptStopped)
+				sess, err := server.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				str, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Close()).To(Succeed())
+			}()
+
+			sess, err := dial(&tls.Config{InsecureSkipVerify: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.ConnectionState().HandshakeComplete).To(BeTrue())
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write(testserver.PRData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+			data, err := ioutil.ReadAll(str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(testserver.PRData))
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+
+		It("uses GetCertificate", func() {
+			var serverName string
+			tlsConf := &tls.Config{
+				GetCertificate: func(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+					serverName = chi.ServerName
+					cert := testdata.GetCertificate()
+					return &cert, nil
+				},
+			}
+			var err error
+			server, err = quic.ListenAddr("localhost:0", tlsConf, serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				defer close(acceptStopped)
+				for {
+					if _, err := server.Accept(); err != nil {
+						return
+					}
+				}
+			}()
+			sess, err := dial(&tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverName).To(Equal("quic.clemente.io"))
+			Expect(sess.ConnectionState().PeerCertificates).ToNot(BeEmpty())
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+
+		It("writes the secrets to the KeyLogWriter", func() {
+			var err error
+			server, err = quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				defer close(acceptStopped)
+				for {
+					if _, err := server.Accept(); err != nil {
+						return
+					}
+				}
+			}()
+			keyLog := &lockedBuffer{}
+			sess, err := dial(&tls.Config{InsecureSkipVerify: true, KeyLogWriter: keyLog})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.Close(nil)).To(Succeed())
+			lines := strings.Split(strings.TrimSpace(keyLog.String()), "\n")
+			var labels []string
+			for _, line := range lines {
+				labels = append(labels, strings.Fields(line)[0])
+			}
+			Expect(labels).To(ContainElement("CLIENT_HANDSHAKE_TRAFFIC_SECRET"))
+			Expect(labels).To(ContainElement("SERVER_HANDSHAKE_TRAFFIC_SECRET"))
+			Expect(labels).To(ContainElement("QUIC_CLIENT_TRAFFIC_SECRET_0"))
+			Expect(labels).To(ContainElement("QUIC_SERVER_TRAFFIC_SECRET_0"))
+		})
+
+		It("exports the same keying material on both sides", func() {
+			var err error
+			server, err = quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			serverKey := make(chan []byte, 1)
+			go func() {
+				defer GinkgoRecover()
+				defer close(acceptStopped)
+				sess, err := server.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				key, err := sess.ExportKeyingMaterial("EXPORTER-quic-go-test", []byte("context"), 42)
+				Expect(err).ToNot(HaveOccurred())
+				serverKey <- key
+			}()
+			sess, err := dial(&tls.Config{InsecureSkipVerify: true})
+			Expect(err).ToNot(HaveOccurred())
+			key, err := sess.ExportKeyingMaterial("EXPORTER-quic-go-test", []byte("context"), 42)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key).To(HaveLen(42))
+			Eventually(serverKey).Should(Receive(Equal(key)))
+			otherKey, err := sess.ExportKeyingMaterial("EXPORTER-quic-go-other", []byte("context"), 42)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(otherKey).ToNot(Equal(key))
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+
+		It("authenticates the client", func() {
+			tlsConf := testdata.GetTLSConfig()
+			tlsConf.ClientAuth = tls.RequireAnyClientCert
+			var err error
+			server, err = quic.ListenAddr("localhost:0", tlsConf, serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			sessChan := make(chan quic.Session, 1)
+			go func() {
+				defer GinkgoRecover()
+				defer close(acceptStopped)
+				sess, err := server.Accept()
+				if err != nil {
+					return
+				}
+				sessChan <- sess
+			}()
+			sess, err := dial(&tls.Config{
+				InsecureSkipVerify: true,
+				Certificates:       []tls.Certificate{testdata.GetCertificate()},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			var serverSess quic.Session
+			Eventually(sessChan).Should(Receive(&serverSess))
+			Expect(serverSess.ConnectionState().PeerCertificates).ToNot(BeEmpty())
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+
+		It("verifies the client certificate", func() {
+			cert := testdata.GetCertificate()
+			intermediate, err := x509.ParseCertificate(cert.Certificate[1])
+			Expect(err).ToNot(HaveOccurred())
+			clientCAs := x509.NewCertPool()
+			clientCAs.AddCert(intermediate)
+			tlsConf := testdata.GetTLSConfig()
+			tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+			tlsConf.ClientCAs = clientCAs
+			// the test certificate is only valid in 2018
+			tlsConf.Time = func() time.Time { return time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC) }
+			server, err = quic.ListenAddr("localhost:0", tlsConf, serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			sessChan := make(chan quic.Session, 1)
+			go func() {
+				defer GinkgoRecover()
+				defer close(acceptStopped)
+				sess, err := server.Accept()
+				if err != nil {
+					return
+				}
+				sessChan <- sess
+			}()
+			sess, err := dial(&tls.Config{
+				InsecureSkipVerify: true,
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &cert, nil
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			var serverSess quic.Session
+			Eventually(sessChan).Should(Receive(&serverSess))
+			Expect(serverSess.ConnectionState().VerifiedChains).To(HaveLen(1))
+			Expect(serverSess.ConnectionState().VerifiedChains[0][1].Subject.CommonName).To(Equal("Let's Encrypt Authority X3"))
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+
+		It("resumes sessions using session tickets", func() {
+			runServer()
+			cache := &countingSessionCache{ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+			tlsConf := &tls.Config{InsecureSkipVerify: true, ClientSessionCache: cache}
+			sess, err := dial(tlsConf)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() int { return cache.Puts() }).Should(Equal(1))
+			Expect(sess.Close(nil)).To(Succeed())
+			sess, err = dial(tlsConf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cache.Hits()).To(Equal(1))
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+
+		It("resumes sessions using the ClientSessionCache of the quic.Config", func() {
+			runServer()
+			var didResume bool
+			tlsConf := &tls.Config{
+				ServerName:         "localhost",
+				InsecureSkipVerify: true,
+				// crypto/tls doesn't resume sessions if the certificate expired, which the test certificate did
+				Time: func() time.Time { return time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC) },
+				VerifyConnection: func(cs tls.ConnectionState) error {
+					didResume = cs.DidResume
+					return nil
+				},
+			}
+			cache := quic.NewLRUClientSessionCache(1)
+			conf := &quic.Config{
+				Versions:           []protocol.VersionNumber{protocol.VersionTLS},
+				TLSStack:           quic.TLSStackStandardLibrary,
+				ClientSessionCache: cache,
+			}
+			sess, err := quic.DialAddr(server.Addr().String(), tlsConf, conf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(didResume).To(BeFalse())
+			Eventually(func() bool {
+				_, ok := cache.Get(fmt.Sprintf("tls|localhost:%d", server.Addr().(*net.UDPAddr).Port))
+				return ok
+			}).Should(BeTrue())
+			Expect(sess.Close(nil)).To(Succeed())
+			sess, err = quic.DialAddr(server.Addr().String(), tlsConf, conf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(didResume).To(BeTrue())
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+
+		It("resumes sessions on another server that uses the same TicketKeys", func() {
+			var key [quic.TicketKeyLen]byte
+			copy(key[:], "foobar")
+			keys, err := quic.NewTicketKeys([][quic.TicketKeyLen]byte{key})
+			Expect(err).ToNot(HaveOccurred())
+			serverConfig.TicketKeys = keys
+			runServer()
+			server2, err := quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			defer server2.Close()
+			go func() {
+				defer GinkgoRecover()
+				for {
+					if _, err := server2.Accept(); err != nil {
+						return
+					}
+				}
+			}()
+
+			var didResume bool
+			cache := &countingSessionCache{ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+			tlsConf := &tls.Config{
+				ServerName:         "localhost",
+				InsecureSkipVerify: true,
+				ClientSessionCache: cache,
+				VerifyConnection: func(cs tls.ConnectionState) error {
+					didResume = cs.DidResume
+					return nil
+				},
+				// crypto/tls doesn't resume sessions if the certificate expired, which the test certificate did
+				Time: func() time.Time { return time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC) },
+			}
+			sess, err := dial(tlsConf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(didResume).To(BeFalse())
+			Eventually(func() int { return cache.Puts() }).Should(Equal(1))
+			Expect(sess.Close(nil)).To(Succeed())
+			sess, err = quic.DialAddr(server2.Addr().String(), tlsConf, &quic.Config{
+				Versions: []protocol.VersionNumber{protocol.VersionTLS},
+				TLSStack: quic.TLSStackStandardLibrary,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(didResume).To(BeTrue())
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+	})
+
+	Context("congestion control", func() {
+		It("transfers data using BBR", func() {
+			var err error
+			serverConfig.Versions = []protocol.VersionNumber{protocol.Version39}
+			serverConfig.CongestionControl = quic.CongestionBBR
+			server, err = quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			// echo the data sent on the first stream
+			go func() {
+				defer GinkgoRecover()
+				defer close(acceptStopped)
+				sess, err := server.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				str, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Close()).To(Succeed())
+			}()
+
+			conf := &quic.Config{
+				Versions:          []protocol.VersionNumber{protocol.Version39},
+				CongestionControl: quic.CongestionBBR,
+			}
+			sess, err := quic.DialAddr(server.Addr().String(), &tls.Config{InsecureSkipVerify: true}, conf)
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write(testserver.PRData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+			data, err := ioutil.ReadAll(str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(testserver.PRData))
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+	})
+
+	Context("getting the config for a client", func() {
+		for _, v := range []protocol.VersionNumber{protocol.Version39, protocol.VersionTLS} {
+			version := v
+
+			Context(fmt.Sprintf("using %s", version), func() {
+				var clientConfig *quic.Config
+
+				BeforeEach(func() {
+					serverConfig.Versions = []protocol.VersionNumber{version}
+					serverConfig.TLSStack = quic.TLSStackStandardLibrary
+					clientConfig = &quic.Config{
+						Versions: []protocol.VersionNumber{version},
+						TLSStack: quic.TLSStackStandardLibrary,
+					}
+					serverConfig.GetConfigForClient = func(info *quic.ClientHelloInfo) (*tls.Config, *quic.Config, error) {
+						if info.ServerName != "quic.clemente.io" {
+							return nil, nil, fmt.Errorf("unknown server name: %s", info.ServerName)
+						}
+						return testdata.GetTLSConfig(), &quic.Config{IdleTimeout: 42 * time.Second}, nil
+					}
+					var err error
+					// the tls.Config passed to Listen doesn't contain any certificates
+					server, err = quic.ListenAddr("localhost:0", &tls.Config{}, serverConfig)
+					Expect(err).ToNot(HaveOccurred())
+					go func() {
+						defer GinkgoRecover()
+						defer close(acceptStopped)
+						for {
+							if _, err := server.Accept(); err != nil {
+								return
+							}
+						}
+					}()
+				})
+
+				It("uses the config returned for the server name", func() {
+					sess, err := quic.DialAddr(
+						server.Addr().String(),
+						&tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true},
+						clientConfig,
+					)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sess.ConnectionState().PeerCertificates[0].DNSNames).To(ContainElement("quic.clemente.io"))
+					Expect(sess.Close(nil)).To(Succeed())
+				})
+
+				It("rejects connections for unknown server names", func() {
+					_, err := quic.DialAddr(
+						server.Addr().String(),
+						&tls.Config{ServerName: "foo.example", InsecureSkipVerify: true},
+						clientConfig,
+					)
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).ToNot(ContainSubstring("HandshakeTimeout"))
+				})
+			})
+		}
+	})
+
 	Context("Certifiate validation", func() {
 		for _, v := range []protocol.VersionNumber{protocol.Version39, protocol.VersionTLS} {
 			version := v
@@ -1,6 +1,7 @@
 package self_test
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -147,6 +148,49 @@ var _ = Describe("Bidirectional streams", func() {
 				<-done1
 				<-done2
 			})
+
+			It(fmt.Sprintf("client and server opening %d each, with the server running its sessions on a shared event loop", numStreams), func() {
+				server.Close()
+				conf := *qconf
+				conf.TLSStack = quic.TLSStackStandardLibrary
+				conf.SharedEventLoop = true
+				var err error
+				server, err = quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), &conf)
+				Expect(err).ToNot(HaveOccurred())
+
+				done1 := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					sess, err := server.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					done := make(chan struct{})
+					go func() {
+						defer GinkgoRecover()
+						runReceivingPeer(sess)
+						close(done)
+					}()
+					runSendingPeer(sess)
+					<-done
+					close(done1)
+				}()
+
+				client, err := quic.DialAddr(
+					fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+					&tls.Config{InsecureSkipVerify: true},
+					&quic.Config{Versions: qconf.Versions, TLSStack: quic.TLSStackStandardLibrary},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				done2 := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					runSendingPeer(client)
+					close(done2)
+				}()
+				runReceivingPeer(client)
+				<-done1
+				<-done2
+				Expect(client.Close(nil)).To(Succeed())
+			})
 		})
 	}
 })
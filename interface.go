@@ -2,32 +2,224 @@ package quic
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"io"
 	"net"
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qlog"
 )
 
 // The StreamID is the ID of a QUIC stream.
 type StreamID = protocol.StreamID
 
+// A ByteCount is a number of bytes.
+type ByteCount = protocol.ByteCount
+
+// A PacketNumber is the number of a QUIC packet.
+type PacketNumber = protocol.PacketNumber
+
 // A VersionNumber is a QUIC version number.
 type VersionNumber = protocol.VersionNumber
 
+// A ConnectionID is a QUIC connection ID.
+type ConnectionID = protocol.ConnectionID
+
 // VersionGQUIC39 is gQUIC version 39.
 const VersionGQUIC39 = protocol.Version39
 
-// A Cookie can be used to verify the ownership of the client address.
-type Cookie = handshake.Cookie
+// A Token can be used to verify the ownership of the client address.
+type Token = handshake.Token
 
 // ConnectionState records basic details about the QUIC connection.
 type ConnectionState = handshake.ConnectionState
 
+// PeerTransportParameters are the transport parameters sent by the peer during the handshake.
+type PeerTransportParameters = handshake.PeerTransportParameters
+
+// CongestionState is the state of the congestion controller.
+type CongestionState = congestion.State
+
+const (
+	// CongestionStateSlowStart is the slow start state
+	CongestionStateSlowStart = congestion.StateSlowStart
+	// CongestionStateCongestionAvoidance is the congestion avoidance state
+	CongestionStateCongestionAvoidance = congestion.StateCongestionAvoidance
+	// CongestionStateRecovery is the state after a loss event, until a packet sent after the loss is acknowledged
+	CongestionStateRecovery = congestion.StateRecovery
+)
+
+// A CongestionEvent is reported when the congestion controller transitions to a new state.
+// Warning: This API should not be considered stable and might change soon.
+type CongestionEvent struct {
+	State CongestionState
+	// CongestionWindow is the congestion window (in bytes) after the transition.
+	CongestionWindow uint64
+}
+
+// A CongestionController performs congestion control.
+// It is informed about every packet that is sent, acknowledged and lost,
+// and decides how much data may be in flight, and when the next packet may be sent.
+// Warning: This API should not be considered stable and might change soon.
+type CongestionController = congestion.Controller
+
+// A BandwidthEstimator is a CongestionController that estimates the bandwidth of the path.
+// The estimate is returned by Session.BandwidthEstimate.
+// Warning: This API should not be considered stable and might change soon.
+type BandwidthEstimator = congestion.BandwidthEstimator
+
+// A Bandwidth is a data rate in bits per second.
+type Bandwidth = congestion.Bandwidth
+
+// RTTStats gives read access to the RTT statistics of a connection.
+type RTTStats = congestion.RTTStatsReader
+
+// CongestionControl is a built-in congestion control algorithm.
+type CongestionControl uint8
+
+const (
+	// CongestionCubic is the Cubic congestion control algorithm. This is the default.
+	CongestionCubic CongestionControl = iota
+	// CongestionBBR is the BBR (bottleneck bandwidth and RTT) congestion control algorithm.
+	// Warning: This is experimental, and might change soon.
+	CongestionBBR
+)
+
+// A StreamScheduler determines the order in which streams are allowed to send data,
+// if more data is available than fits into a packet.
+type StreamScheduler uint8
+
+const (
+	// StreamSchedulerRoundRobin lets every stream send once, in the order they started sending data.
+	// This is the default.
+	StreamSchedulerRoundRobin StreamScheduler = iota
+	// StreamSchedulerFIFO sends all data of the stream that was opened first,
+	// before sending data of any other stream.
+	StreamSchedulerFIFO
+	// StreamSchedulerWeightedFair shares the bandwidth between the streams in proportion to their weights.
+	// The weights are set by Config.StreamWeight, or by Stream.SetPriority.
+	StreamSchedulerWeightedFair
+)
+
+// A TLSStack is a TLS 1.3 implementation that can be used for the IETF QUIC handshake.
+type TLSStack uint8
+
+const (
+	// TLSStackMint uses mint. This is the default.
+	TLSStackMint TLSStack = iota
+	// TLSStackStandardLibrary uses the TLS 1.3 implementation of crypto/tls.
+	// It supports all options of the tls.Config, e.g. GetCertificate, client authentication and session tickets.
+	// Both endpoints need to use it, it can't complete a handshake with a peer that uses mint.
+	// Servers don't perform a Stateless Retry when using it.
+	TLSStackStandardLibrary
+)
+
+// SessionStats contains statistics about a QUIC session.
+// Warning: This API should not be considered stable and might change soon.
+type SessionStats struct {
+	// QueuedPackets is the number of received packets that are waiting to be processed by the session.
+	QueuedPackets int
+	// MaxQueuedPackets is the largest number of received packets that were waiting to be processed at the same time.
+	MaxQueuedPackets int
+	// DroppedPackets is the number of received packets that were dropped because the queue was full.
+	DroppedPackets uint64
+	// DroppedUndecryptablePackets is the number of undecryptable packets received during the handshake that were dropped,
+	// either because the queue was full, or because the keys to decrypt them didn't become available in time.
+	DroppedUndecryptablePackets uint64
+	// Goodput is the rate (in bytes per second) at which stream data was acknowledged by the peer during the last second.
+	// In contrast to the congestion window and the pacing rate, it reflects the actually achieved throughput,
+	// including periods where the application didn't send any data.
+	Goodput uint64
+	// MaxOutgoingStreamID is the highest stream ID of a bidirectional stream that the peer allows us to open.
+	// If it is lower than the stream ID of the next stream, OpenStreamSync blocks until the peer raises the limit.
+	// It is only set for IETF QUIC.
+	MaxOutgoingStreamID StreamID
+	// MaxOutgoingUniStreamID is the highest stream ID of a unidirectional stream that the peer allows us to open.
+	// It is only set for IETF QUIC.
+	MaxOutgoingUniStreamID StreamID
+	// LastMaxStreamIDUpdate is the time when the peer last raised the stream limits by sending a MAX_STREAM_ID frame.
+	// Together with the stream limits, it allows the application to decide between waiting for a stream to become available,
+	// and opening a new connection.
+	LastMaxStreamIDUpdate time.Time
+	// FramesSent and FramesReceived count the frames sent and received on the connection, by frame type.
+	// The frame types are named as in the IETF QUIC draft, e.g. "STREAM", "ACK" or "RST_STREAM".
+	// For gQUIC, WINDOW_UPDATE frames are counted as MAX_DATA and MAX_STREAM_DATA frames.
+	FramesSent     map[string]uint64
+	FramesReceived map[string]uint64
+	// NextPacketNumber is the packet number that will be used for the next packet sent.
+	// All packets are sent in a single packet number space, for both gQUIC and IETF QUIC.
+	// It is intended for debugging only, e.g. to match a session to a packet capture.
+	NextPacketNumber uint64
+	// SmoothedRTT is the smoothed round-trip time, and RTTVariance is the mean deviation of the RTT samples.
+	// Both are zero until the first RTT sample was taken.
+	SmoothedRTT time.Duration
+	RTTVariance time.Duration
+	// CongestionWindow is the current congestion window of the congestion controller.
+	CongestionWindow ByteCount
+	// BytesInFlight is the number of bytes in packets that were sent, but neither acknowledged nor declared lost yet.
+	BytesInFlight ByteCount
+	// PacketsSent and PacketsReceived count the packets sent and received. Only packets that could be decrypted are counted as received.
+	// BytesSent and BytesReceived are the sizes of these packets, including the QUIC header, but not the UDP and IP headers.
+	PacketsSent     uint64
+	PacketsReceived uint64
+	BytesSent       uint64
+	BytesReceived   uint64
+	// PacketsLost is the number of packets that were declared lost by the loss detection.
+	PacketsLost uint64
+	// PacketsRetransmitted is the number of packets that were sent to retransmit the contents of lost packets.
+	PacketsRetransmitted uint64
+	// HandshakeDuration is the time from the creation of the session until the handshake completed.
+	// It is zero until the handshake completes.
+	HandshakeDuration time.Duration
+	// AmplificationLimited is set on servers until the handshake completes, if the client's address wasn't validated.
+	// AmplificationBudget is the number of bytes the server can then still send, before it has to wait for more data from the client.
+	// It helps to diagnose handshakes that are stalled by the anti-amplification limit.
+	AmplificationLimited bool
+	AmplificationBudget  ByteCount
+}
+
 // An ErrorCode is an application-defined error code.
 type ErrorCode = protocol.ApplicationErrorCode
 
+// A StreamTerminationReason says why the receive direction of a stream was terminated.
+type StreamTerminationReason uint8
+
+const (
+	// StreamNotTerminated means that the receive direction of the stream was not terminated yet.
+	StreamNotTerminated StreamTerminationReason = iota
+	// StreamFinished means that all data sent by the peer was read, and Read returned io.EOF.
+	StreamFinished
+	// StreamResetByPeer means that the peer reset the stream.
+	// Read returns a StreamError carrying the peer's error code.
+	StreamResetByPeer
+	// StreamCanceledLocally means that reading was canceled by calling CancelRead.
+	StreamCanceledLocally
+	// StreamSessionClosed means that the session was closed before the stream was terminated.
+	StreamSessionClosed
+)
+
+func (r StreamTerminationReason) String() string {
+	switch r {
+	case StreamNotTerminated:
+		return "not terminated"
+	case StreamFinished:
+		return "finished"
+	case StreamResetByPeer:
+		return "reset by peer"
+	case StreamCanceledLocally:
+		return "canceled locally"
+	case StreamSessionClosed:
+		return "session closed"
+	default:
+		return fmt.Sprintf("unknown termination reason: %d", r)
+	}
+}
+
 // Stream is the interface implemented by QUIC streams
 type Stream interface {
 	// StreamID returns the stream ID.
@@ -35,15 +227,22 @@ type Stream interface {
 	// Read reads data from the stream.
 	// Read can be made to time out and return a net.Error with Timeout() == true
 	// after a fixed time limit; see SetDeadline and SetReadDeadline.
-	// If the stream was canceled by the peer, the error implements the StreamError
-	// interface, and Canceled() == true.
+	// If the stream was canceled (either by the peer, or by calling CancelRead),
+	// the error implements the StreamError interface, and Canceled() == true.
 	io.Reader
 	// Write writes data to the stream.
 	// Write can be made to time out and return a net.Error with Timeout() == true
 	// after a fixed time limit; see SetDeadline and SetWriteDeadline.
-	// If the stream was canceled by the peer, the error implements the StreamError
-	// interface, and Canceled() == true.
+	// If the stream was canceled (either by the peer, or by calling CancelWrite),
+	// the error implements the StreamError interface, and Canceled() == true.
 	io.Writer
+	// ReadFrom writes the data read from an io.Reader to the stream, until it returns io.EOF.
+	// It is used by io.Copy. For regular files, bytes.Readers and strings.Readers,
+	// the data is read directly into the packets, without copying it into a buffer first.
+	// Reading from the file then happens when the packets are sent.
+	// Other io.Readers are copied just like by io.Copy.
+	// Like Write, ReadFrom obeys the write deadline.
+	io.ReaderFrom
 	// Close closes the write-direction of the stream.
 	// Future calls to Write are not permitted after calling Close.
 	// It must not be called concurrently with Write.
@@ -58,6 +257,13 @@ type Stream interface {
 	// It will ask the peer to stop transmitting stream data.
 	// Read will unblock immediately, and future Read calls will fail.
 	CancelRead(ErrorCode) error
+	// ReadTerminationReason says why the receive direction of the stream was terminated.
+	// This allows distinguishing a clean close by the peer (io.EOF) from a reset by the peer after the fact.
+	ReadTerminationReason() StreamTerminationReason
+	// ReleaseCredit returns flow control credit for n bytes of data read from the stream to the peer.
+	// It only has an effect if Config.ManualFlowControlCreditRelease is set.
+	// Credit is never released for more bytes than were read so far.
+	ReleaseCredit(n int)
 	// The context is canceled as soon as the write-side of the stream is closed.
 	// This happens when Close() is called, or when the stream is reset (either locally or remotely).
 	// Warning: This API should not be considered stable and might change soon.
@@ -76,6 +282,13 @@ type Stream interface {
 	// with the connection. It is equivalent to calling both
 	// SetReadDeadline and SetWriteDeadline.
 	SetDeadline(t time.Time) error
+	// SetPriority sets the weight of the stream, between 1 and 255.
+	// Values outside of this range are clamped.
+	// It takes precedence over the weight returned by Config.StreamWeight,
+	// and takes effect the next time the stream sends data.
+	// It only has an effect when using the StreamSchedulerWeightedFair.
+	// The crypto stream is always sent first, regardless of the weights of the other streams.
+	SetPriority(weight int)
 }
 
 // A ReceiveStream is a unidirectional Receive Stream.
@@ -86,6 +299,10 @@ type ReceiveStream interface {
 	io.Reader
 	// see Stream.CancelRead
 	CancelRead(ErrorCode) error
+	// see Stream.ReadTerminationReason
+	ReadTerminationReason() StreamTerminationReason
+	// see Stream.ReleaseCredit
+	ReleaseCredit(n int)
 	// see Stream.SetReadDealine
 	SetReadDeadline(t time.Time) error
 }
@@ -96,6 +313,8 @@ type SendStream interface {
 	StreamID() StreamID
 	// see Stream.Write
 	io.Writer
+	// see Stream.ReadFrom
+	io.ReaderFrom
 	// see Stream.Close
 	io.Closer
 	// see Stream.CancelWrite
@@ -104,9 +323,30 @@ type SendStream interface {
 	Context() context.Context
 	// see Stream.SetWriteDeadline
 	SetWriteDeadline(t time.Time) error
+	// see Stream.SetPriority
+	SetPriority(weight int)
 }
 
-// StreamError is returned by Read and Write when the peer cancels the stream.
+// A StatelessResetError is the error that a session is closed with when the peer sent a stateless reset.
+// This happens when the server lost the state for the connection, e.g. because it was restarted.
+// It implements net.Error.
+type StatelessResetError struct {
+	Token [16]byte
+}
+
+func (e StatelessResetError) Error() string {
+	return fmt.Sprintf("received a stateless reset with token %x", e.Token)
+}
+
+// Timeout is always false.
+func (e StatelessResetError) Timeout() bool { return false }
+
+// Temporary is always false.
+func (e StatelessResetError) Temporary() bool { return false }
+
+// StreamError is returned by Read and Write when the stream was canceled,
+// either by the peer or locally by CancelRead or CancelWrite.
+// ErrorCode returns the application error code the stream was canceled with.
 type StreamError interface {
 	error
 	Canceled() bool
@@ -117,8 +357,15 @@ type StreamError interface {
 type Session interface {
 	// AcceptStream returns the next stream opened by the peer, blocking until one is available.
 	AcceptStream() (Stream, error)
+	// AcceptStreamContext is like AcceptStream, but it also returns when the context is canceled.
+	// In that case, the context's error is returned.
+	// If the session is closed, the error that the session was closed with is returned.
+	AcceptStreamContext(context.Context) (Stream, error)
 	// AcceptUniStream returns the next unidirectional stream opened by the peer, blocking until one is available.
 	AcceptUniStream() (ReceiveStream, error)
+	// AcceptUniStreamContext is like AcceptUniStream, but it also returns when the context is canceled.
+	// In that case, the context's error is returned.
+	AcceptUniStreamContext(context.Context) (ReceiveStream, error)
 	// OpenStream opens a new bidirectional QUIC stream.
 	// It returns a special error when the peer's concurrent stream limit is reached.
 	// There is no signaling to the peer about new streams:
@@ -128,6 +375,10 @@ type Session interface {
 	// OpenStreamSync opens a new bidirectional QUIC stream.
 	// It blocks until the peer's concurrent stream limit allows a new stream to be opened.
 	OpenStreamSync() (Stream, error)
+	// OpenStreamSyncContext is like OpenStreamSync, but it also returns when the context is canceled.
+	// In that case, the context's error is returned.
+	// If the session is closed, the error that the session was closed with is returned.
+	OpenStreamSyncContext(context.Context) (Stream, error)
 	// OpenUniStream opens a new outgoing unidirectional QUIC stream.
 	// It returns a special error when the peer's concurrent stream limit is reached.
 	// TODO(#1152): Enable testing for the special error
@@ -135,50 +386,345 @@ type Session interface {
 	// OpenUniStreamSync opens a new outgoing unidirectional QUIC stream.
 	// It blocks until the peer's concurrent stream limit allows a new stream to be opened.
 	OpenUniStreamSync() (SendStream, error)
+	// OpenUniStreamSyncContext is like OpenUniStreamSync, but it also returns when the context is canceled.
+	// In that case, the context's error is returned.
+	OpenUniStreamSyncContext(context.Context) (SendStream, error)
 	// LocalAddr returns the local address.
 	LocalAddr() net.Addr
 	// RemoteAddr returns the address of the peer.
 	RemoteAddr() net.Addr
 	// Close closes the connection. The error will be sent to the remote peer in a CONNECTION_CLOSE frame. An error value of nil is allowed and will cause a normal PeerGoingAway to be sent.
 	Close(error) error
+	// CloseWithError closes the connection with an application error code and a reason phrase.
+	// In IETF QUIC, they are sent to the peer in an APPLICATION_CLOSE frame.
+	// gQUIC doesn't have application errors, the error code is sent in a CONNECTION_CLOSE frame.
+	// On the peer's side, pending and future calls on the session and its streams return a *qerr.ApplicationError,
+	// carrying the error code and the reason phrase.
+	CloseWithError(code ErrorCode, reason string) error
 	// The context is cancelled when the session is closed.
+	// The error that the session was closed with can be retrieved using SessionCloseError.
+	// It carries the values of the context returned by Config.SessionContext.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
 	// ConnectionState returns basic details about the QUIC connection.
 	// Warning: This API should not be considered stable and might change soon.
 	ConnectionState() ConnectionState
+	// Stats returns statistics about the QUIC connection.
+	// Warning: This API should not be considered stable and might change soon.
+	Stats() SessionStats
+	// RTT returns the latest RTT sample, the smoothed RTT and the minimum RTT of the connection.
+	// They are 0 before the first RTT sample was taken.
+	// Warning: This API should not be considered stable and might change soon.
+	RTT() (latest, smoothed, min time.Duration)
+	// BandwidthEstimate returns the congestion controller's estimate of the bandwidth (in bytes per second) available to the connection.
+	// It can be used to adjust the rate of the data sent, e.g. the encoding rate of a video stream.
+	// If the congestion controller doesn't implement the BandwidthEstimator, it is derived from the congestion window and the smoothed RTT.
+	// It returns 0 before the first RTT sample was taken.
+	// Warning: This API should not be considered stable and might change soon.
+	BandwidthEstimate() uint64
+	// NextSendTime returns the time when the session next wants to send a packet.
+	// This takes into account the pacing delay, the ACK and loss detection timers, and keep-alive PINGs.
+	// It returns time.Time{} if no packet is scheduled to be sent.
+	// Warning: This API should not be considered stable and might change soon.
+	NextSendTime() time.Time
+	// SendMessage sends a message as a DATAGRAM frame.
+	// Messages are sent unreliably: they might be lost, and they are never retransmitted.
+	// It errors if the DATAGRAM frame extension wasn't negotiated, or if the message doesn't fit into a single packet.
+	// Warning: This API should not be considered stable and might change soon.
+	SendMessage([]byte) error
+	// ReceiveMessage blocks until a message is received as a DATAGRAM frame, or the session is closed.
+	// Warning: This API should not be considered stable and might change soon.
+	ReceiveMessage() ([]byte, error)
+	// Migrate migrates the session to a new net.PacketConn, e.g. when switching from WiFi to a cellular network.
+	// It is only supported by IETF QUIC clients, after the handshake completed,
+	// and only if the server didn't disable migration (see ConnectionState().PeerTransportParameters).
+	// The new path is validated before it is used, and Migrate blocks until the validation completes.
+	// On success, the old net.PacketConn is closed. If the validation fails, the session continues using the old path,
+	// and the new net.PacketConn is closed.
+	// Warning: This API should not be considered stable and might change soon.
+	Migrate(net.PacketConn) error
+	// UpdateKeys initiates an update of the 1-RTT keys.
+	// It is only supported for IETF QUIC, after the handshake completed.
+	// The keys are updated when the next packet is sent, as soon as the peer acknowledged the last key update.
+	// Warning: This API should not be considered stable and might change soon.
+	UpdateKeys() error
+	// ExportKeyingMaterial exports keying material from the TLS session, as defined in RFC 8446, section 7.5 (see RFC 5705).
+	// Both peers derive the same keying material for the same label and context,
+	// so it can be used to bind an authentication token to the connection, or to derive keys for a protocol layered on top of QUIC.
+	// Labels starting with "EXPORTER-QUIC" are reserved for QUIC, and are rejected.
+	// It is only supported for IETF QUIC, after the handshake completed.
+	// Warning: This API should not be considered stable and might change soon.
+	ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error)
+	// ExportState exports the state of the session, such that the connection can be continued by another process,
+	// e.g. for a zero-downtime restart of a server. The state is imported using Listener.ImportSession.
+	// It is only supported by IETF QUIC servers, after the handshake completed.
+	// The session must be quiescent: all packets must have been acknowledged, and nothing may be waiting to be sent.
+	// The streams must not have unread data, and no unidirectional streams may be open.
+	// If the session isn't quiescent, an error is returned, and the session continues. The export can then be retried later.
+	// On success, the session is closed without sending a CONNECTION_CLOSE, and nothing is sent any more.
+	// The state contains the keys of the connection, and must be kept confidential.
+	// Warning: This API should not be considered stable and might change soon.
+	ExportState() ([]byte, error)
+}
+
+// An EarlySession is a session that is returned by DialEarly or accepted by an EarlyListener, before the handshake completes.
+// Data sent before the handshake completes is not forward-secure, and data received before that might be replayed by an attacker.
+// Applications should wait for HandshakeComplete before processing data that is not safe to replay.
+type EarlySession interface {
+	Session
+
+	// HandshakeComplete returns a context that is cancelled when the handshake completes (or fails).
+	// Use ConnectionState().HandshakeComplete to find out if the handshake succeeded.
+	// On the client side, ConnectionState().Used0RTT then reports if the server accepted the data sent before the handshake completed.
+	// Data that the server rejected is retransmitted automatically.
+	HandshakeComplete() context.Context
+}
+
+// A ClientSessionCache caches the state needed to send 0-RTT data to a server, or to resume a TLS session.
+// For gQUIC, this is the server config and the certificate chain of the server.
+// For IETF QUIC, these are the TLS session tickets, if the crypto/tls stack is used (see TLSStack).
+// The state is keyed by the hostname and the port of the server (e.g. "quic.clemente.io:443"). It is opaque to the cache, and can be persisted,
+// e.g. to a file, such that it can be used after the process restarts.
+// Implementations must be safe for concurrent use.
+type ClientSessionCache interface {
+	// Get returns the state cached for the given key.
+	Get(sessionKey string) (state []byte, ok bool)
+	// Put adds the state to the cache, replacing an existing entry for the given key.
+	Put(sessionKey string, state []byte)
+}
+
+// A TokenStore saves the tokens that a server sends in NEW_TOKEN frames.
+// Presenting such a token on the next connection allows the client to skip the Stateless Retry.
+// Implementations must be safe for concurrent use.
+type TokenStore interface {
+	// Pop returns the token saved for the given key, and removes it from the store.
+	// Tokens should only be used once, to prevent linking connections.
+	// It returns nil if no token is saved for the key.
+	Pop(key string) (token []byte)
+	// Put saves a token, replacing an existing token for the given key.
+	Put(key string, token []byte)
+}
+
+// A ConnectionIDGenerator generates the connection IDs that a client or server chooses for itself.
+// It can be used to encode routing information into the connection IDs, e.g. the server ID used by a QUIC-aware load balancer.
+// Implementations must be safe for concurrent use.
+type ConnectionIDGenerator interface {
+	// GenerateConnectionID generates a new connection ID.
+	// The connection ID must be ConnectionIDLen() bytes long, and should not be predictable by an observer.
+	GenerateConnectionID() (ConnectionID, error)
+	// ConnectionIDLen returns the length of the connection IDs generated.
+	// It must be constant, and between 4 and 18 bytes.
+	// Clients can also use zero-length connection IDs, if they don't share their socket with other connections.
+	ConnectionIDLen() int
+}
+
+// A Resolver resolves the hostname of the server in DialAddr.
+// A *net.Resolver can be used, or a custom implementation, e.g. a DNS over HTTPS client.
+// Implementations must be safe for concurrent use.
+type Resolver interface {
+	// LookupIPAddr looks up the IPv4 and IPv6 addresses of a host.
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// A PacketDropReason says why a received packet was dropped, see Tracer.
+type PacketDropReason = qlog.PacketDropReason
+
+const (
+	// PacketDropKeyUnavailable means that the keys to decrypt the packet didn't become available in time
+	PacketDropKeyUnavailable = qlog.PacketDropKeyUnavailable
+	// PacketDropPayloadDecryptError means that the packet couldn't be decrypted after the handshake completed
+	PacketDropPayloadDecryptError = qlog.PacketDropPayloadDecryptError
+	// PacketDropDOSPrevention means that the packet was dropped because the queue of packets waiting to be processed was full
+	PacketDropDOSPrevention = qlog.PacketDropDOSPrevention
+	// PacketDropUnknownConnectionID means that the server received a packet for a connection it doesn't know
+	PacketDropUnknownConnectionID = qlog.PacketDropUnknownConnectionID
+	// PacketDropUnexpectedPacket means that the client received a Version Negotiation Packet that it ignored,
+	// because it already received a packet from the server or switched to a new version, or because it lists the version that was offered
+	PacketDropUnexpectedPacket = qlog.PacketDropUnexpectedPacket
+)
+
+// A PacketHeader describes a packet that was sent or received, see Tracer.
+type PacketHeader struct {
+	// Type is the packet type, named as in a qlog trace, e.g. "initial", "handshake" or "1RTT".
+	Type         string
+	PacketNumber PacketNumber
+	// Size is the size of the packet, including the QUIC header.
+	Size             ByteCount
+	SrcConnectionID  ConnectionID
+	DestConnectionID ConnectionID
+	// Version is the version in the header. It is 0 for packets that don't carry a version.
+	Version VersionNumber
+}
+
+// A FrameInfo describes a frame contained in a packet, see Tracer.
+type FrameInfo struct {
+	// Type is the frame type, named as in SessionStats.FramesSent, e.g. "STREAM" or "ACK".
+	Type string
+	// StreamID is the stream ID of STREAM, RST_STREAM, STOP_SENDING, MAX_STREAM_DATA and STREAM_BLOCKED frames.
+	StreamID StreamID
+	// Length is the length of the data carried by STREAM and DATAGRAM frames.
+	Length ByteCount
+}
+
+// A Tracer is informed about events that occur on the connections it is used for, see Config.Tracer.
+// Connections are identified by the same connection ID that is passed to Config.GetLogWriter.
+// The callbacks are called synchronously by the session and the server, so they should return quickly.
+// Implementations must be safe for concurrent use.
+// Warning: This API should not be considered stable and might change soon.
+type Tracer interface {
+	// StartedConnection is called when a session starts running, and ClosedConnection when it is closed.
+	// The reason is the error that the session was closed with.
+	StartedConnection(connID ConnectionID)
+	ClosedConnection(connID ConnectionID, reason error)
+	// CompletedHandshake is called when the handshake completes.
+	CompletedHandshake(connID ConnectionID)
+	// SentPacket is called for every packet sent.
+	SentPacket(connID ConnectionID, hdr *PacketHeader, frames []FrameInfo)
+	// RetransmittedPacket is called for packets that retransmit the contents of a lost packet, in addition to SentPacket.
+	RetransmittedPacket(connID ConnectionID, pn PacketNumber)
+	// ReceivedPacket is called for every packet received and successfully decrypted.
+	ReceivedPacket(connID ConnectionID, hdr *PacketHeader, frames []FrameInfo)
+	// LostPacket is called when a packet is declared lost by the loss detection.
+	LostPacket(connID ConnectionID, pn PacketNumber)
+	// UpdatedCongestion and UpdatedRTT are called after an ACK was processed.
+	// The RTTStats must not be used after UpdatedRTT returns.
+	UpdatedCongestion(connID ConnectionID, cwnd, bytesInFlight ByteCount)
+	UpdatedRTT(connID ConnectionID, rttStats RTTStats)
+	// DroppedPacket is called for received packets that are not processed.
+	// For packets dropped by the server, the connID is the destination connection ID of the packet.
+	DroppedPacket(connID ConnectionID, reason PacketDropReason)
+	// SentVersionNegotiation and SentStatelessReset are called by the server,
+	// when it sends a Version Negotiation Packet, or a stateless reset in response to a packet for an unknown connection.
+	// For gQUIC, a Public Reset for an unknown connection counts as a stateless reset.
+	// The connID is the destination connection ID of the packet that was responded to.
+	SentVersionNegotiation(connID ConnectionID)
+	SentStatelessReset(connID ConnectionID)
+}
+
+// A LogLevel is the level of a log message, see Logger.
+type LogLevel = utils.LogLevel
+
+const (
+	// LogLevelError is used for errors
+	LogLevelError = utils.LogLevelError
+	// LogLevelInfo is used for events of the connection, e.g. a connection being closed
+	LogLevelInfo = utils.LogLevelInfo
+	// LogLevelDebug is used for detailed information, e.g. the contents of every packet sent and received
+	LogLevelDebug = utils.LogLevelDebug
+)
+
+// A LogField is a key-value pair attached to a log message, see Logger.
+type LogField = utils.Field
+
+// The keys of the fields attached to log messages.
+const (
+	// LogFieldPerspective is attached to all messages. Its value is "Client" or "Server".
+	LogFieldPerspective = utils.FieldPerspective
+	// LogFieldConnectionID is attached to all messages logged by a session.
+	// Its value is the ConnectionID that is passed to Config.GetLogWriter.
+	LogFieldConnectionID = utils.FieldConnectionID
+	// LogFieldPacketNumber is attached to the messages logging a packet that is sent or received.
+	// Its value is the PacketNumber.
+	LogFieldPacketNumber = utils.FieldPacketNumber
+)
+
+// A Logger receives the log messages of a client or a server, see Config.Logger.
+// The fields describe the context a message was logged in, which allows filtering the messages of a single connection.
+// Implementations must be safe for concurrent use.
+type Logger = utils.StructuredLogger
+
+// ClientHelloInfo contains information from the ClientHello sent by a client.
+// It is passed to Config.GetConfigForClient.
+type ClientHelloInfo struct {
+	// ServerName is the server name requested by the client (SNI), if any.
+	ServerName string
+	// SupportedProtos are the application protocols offered by the client (ALPN), in order of preference.
+	// It is only set for IETF QUIC.
+	SupportedProtos []string
+	// RemoteAddr is the address of the client.
+	RemoteAddr net.Addr
 }
 
 // Config contains all configuration data needed for a QUIC server or client.
 type Config struct {
-	// The QUIC versions that can be negotiated.
+	// The QUIC versions that can be negotiated, in order of preference.
 	// If not set, it uses all versions available.
+	// A gQUIC client offers a single version. If the server doesn't support it, it sends a Version Negotiation Packet
+	// listing these versions in this order, and the client then picks the version it prefers.
 	// Warning: This API should not be considered stable and will change soon.
 	Versions []VersionNumber
 	// Ask the server to omit the connection ID sent in the Public Header.
 	// This saves 8 bytes in the Public Header in every packet. However, if the IP address of the server changes, the connection cannot be migrated.
 	// Currently only valid for the client.
 	RequestConnectionIDOmission bool
+	// ConnectionIDLength is the length of the connection IDs used for IETF QUIC.
+	// All connection IDs a client or server chooses for itself have this length.
+	// Since the length of a connection ID is not encoded in the Short Header, client and server need to use the same value.
+	// It must be between 4 and 18 bytes. If this value is zero, it will default to 8 bytes.
+	// It is ignored if a ConnectionIDGenerator is set.
+	// gQUIC always uses 8 byte connection IDs.
+	ConnectionIDLength int
+	// ConnectionIDGenerator generates the connection IDs used for IETF QUIC.
+	// These are the connection ID a client uses for itself, and the connection IDs issued in NEW_CONNECTION_ID frames.
+	// The connection ID a server uses during the handshake is chosen by the client.
+	// If not set, random connection IDs of ConnectionIDLength bytes are used.
+	ConnectionIDGenerator ConnectionIDGenerator
 	// HandshakeTimeout is the maximum duration that the cryptographic handshake may take.
 	// If the timeout is exceeded, the connection is closed.
 	// If this value is zero, the timeout is set to 10 seconds.
 	HandshakeTimeout time.Duration
+	// MaxHandshakePackets is the maximum number of packets that are processed before the handshake completes.
+	// If the peer sends more packets without completing the handshake, the connection is closed.
+	// This complements the HandshakeTimeout, and bounds the CPU time spent on (trial) decrypting handshake packets.
+	// If this value is zero, it will default to 200.
+	MaxHandshakePackets int
 	// IdleTimeout is the maximum duration that may pass without any incoming network activity.
 	// This value only applies after the handshake has completed.
 	// If the timeout is exceeded, the connection is closed.
 	// If this value is zero, the timeout is set to 30 seconds.
 	IdleTimeout time.Duration
-	// AcceptCookie determines if a Cookie is accepted.
-	// It is called with cookie = nil if the client didn't send an Cookie.
-	// If not set, it verifies that the address matches, and that the Cookie was issued within the last 24 hours.
+	// AcceptToken determines if a Token is accepted.
+	// It is called with token = nil if the client didn't send a token.
+	// If it returns false for a nil token, the server performs a stateless Retry to validate the client's address,
+	// which allows forcing address validation when the server is under load.
+	// Tokens are sent in a Retry (then Token.IsRetryToken is set), and after the handshake in a NEW_TOKEN frame (for IETF QUIC),
+	// which allows returning clients to skip the Retry. For gQUIC, the token is the source address token (STK).
+	// If not set, it verifies that the address matches, and that the token was issued within the last 24 hours,
+	// or within the last 10 seconds for tokens sent in a Retry.
 	// This option is only valid for the server.
-	AcceptCookie func(clientAddr net.Addr, cookie *Cookie) bool
-	// MaxReceiveStreamFlowControlWindow is the maximum stream-level flow control window for receiving data.
+	AcceptToken func(clientAddr net.Addr, token *Token) bool
+	// RequireAddressValidation determines if the server performs a Stateless Retry to validate the address of a new client.
+	// It is called for clients that didn't present a valid token, and allows switching to address validation when the server is under load.
+	// If not set, a Retry is performed if AcceptToken returns false for a nil token.
+	// Independent of this setting, a Retry is performed for all new clients while 16 or more handshakes are in progress.
+	// This bounds the state the server keeps for unvalidated clients, and the amplification factor of their handshakes.
+	// It is only used for IETF QUIC, and not when using TLSStackStandardLibrary.
+	// Only valid for the server.
+	RequireAddressValidation func(clientAddr net.Addr) bool
+	// InitialStreamReceiveWindow is the initial size of the stream-level flow control window for receiving data.
+	// If the application is consuming data quickly enough, the flow control auto-tuning algorithm
+	// will increase the window up to MaxStreamReceiveWindow.
+	// If this value is zero, it will default to 32 KB.
+	InitialStreamReceiveWindow uint64
+	// MaxStreamReceiveWindow is the maximum stream-level flow control window for receiving data.
 	// If this value is zero, it will default to 1 MB for the server and 6 MB for the client.
-	MaxReceiveStreamFlowControlWindow uint64
-	// MaxReceiveConnectionFlowControlWindow is the connection-level flow control window for receiving data.
+	// If it is smaller than the InitialStreamReceiveWindow, the window is not auto-tuned.
+	MaxStreamReceiveWindow uint64
+	// InitialConnectionReceiveWindow is the initial size of the connection-level flow control window for receiving data.
+	// If the application is consuming data quickly enough, the flow control auto-tuning algorithm
+	// will increase the window up to MaxConnectionReceiveWindow.
+	// If this value is zero, it will default to 48 KB.
+	InitialConnectionReceiveWindow uint64
+	// MaxConnectionReceiveWindow is the maximum connection-level flow control window for receiving data.
 	// If this value is zero, it will default to 1.5 MB for the server and 15 MB for the client.
-	MaxReceiveConnectionFlowControlWindow uint64
+	// If it is smaller than the InitialConnectionReceiveWindow, the window is not auto-tuned.
+	MaxConnectionReceiveWindow uint64
+	// ManualFlowControlCreditRelease disables the automatic release of flow control credit when data is read from a stream.
+	// Instead, credit is only returned to the peer when the application calls ReleaseCredit on the stream.
+	// This way a slow consumer applies backpressure to the peer.
+	// Note that the connection-level flow control window is only increased for data that was released,
+	// so data that was read but never released reduces the connection-level window for the rest of the connection.
+	ManualFlowControlCreditRelease bool
 	// MaxIncomingStreams is the maximum number of concurrent bidirectional streams that a peer is allowed to open.
 	// If not set, it will default to 100.
 	// If set to a negative value, it doesn't allow any bidirectional streams.
@@ -190,16 +736,240 @@ type Config struct {
 	// If set to a negative value, it doesn't allow any unidirectional streams.
 	// Values larger than 65535 (math.MaxUint16) are invalid.
 	MaxIncomingUniStreams int
+	// MaxUndecryptablePackets is the maximum number of packets received during the handshake before the keys to decrypt them are available,
+	// that are queued for later decryption.
+	// On the server, it also limits the number of packets queued for a connection whose Initial packet is still being processed.
+	// If not set, it defaults to 10.
+	MaxUndecryptablePackets int
+	// UndecryptablePacketTimeout is the time after which a queued undecryptable packet is dropped,
+	// if the keys to decrypt it didn't become available.
+	// If not set, it defaults to 1s.
+	UndecryptablePacketTimeout time.Duration
+	// MaxIncomingConnections is the maximum number of connections that the server keeps open at the same time.
+	// When it is reached, new connections are refused.
+	// Independent of this setting, new connections are refused when too many sessions are waiting to be accepted by the application.
+	// If not set, the number of connections is not limited.
+	// Only valid for the server.
+	MaxIncomingConnections int
 	// KeepAlive defines whether this peer will periodically send PING frames to keep the connection alive.
+	// PING frames are only sent if no packets were received from the peer for KeepAlivePeriod.
 	KeepAlive bool
+	// KeepAlivePeriod is the period after which a PING frame is sent, if KeepAlive is set.
+	// It is capped at half the idle timeout negotiated with the peer, which is also the default.
+	KeepAlivePeriod time.Duration
+	// CloseOnOversizedPackets defines how packets larger than the maximum packet size we advertised (1452 bytes) are treated.
+	// By default, these packets are dropped.
+	// If set, the connection is closed with a PacketTooLarge error instead.
+	// Since the packet is not authenticated, this allows an attacker who knows the connection ID to close the connection.
+	CloseOnOversizedPackets bool
+	// HappyEyeballs enables Happy Eyeballs (RFC 8305) in DialAddr.
+	// If the hostname resolves to both IPv6 and IPv4 addresses, a connection attempt to the IPv6 address is started first.
+	// If it hasn't completed the handshake after PreferIPv6Delay, a second connection attempt to the IPv4 address is started in parallel.
+	// The session of the attempt that completes the handshake first is returned, the other attempt is aborted.
+	// Only valid for the client.
+	HappyEyeballs bool
+	// PreferIPv6Delay is the head start given to the IPv6 connection attempt when using HappyEyeballs.
+	// If not set, it defaults to 250ms, the Connection Attempt Delay recommended by RFC 8305.
+	// Only valid for the client.
+	PreferIPv6Delay time.Duration
+	// Resolver is used to resolve the hostname in DialAddr.
+	// If not set, net.DefaultResolver is used.
+	// Only valid for the client.
+	Resolver Resolver
+	// DialPacketConn is called by DialAddr to create the net.PacketConn used for the connection.
+	// The network is "udp" (or "udp4" and "udp6" when using HappyEyeballs), and laddr is the wildcard address of that network.
+	// It can be used to bind to a specific interface, or to use a custom socket.
+	// The net.PacketConn is closed when the session is closed.
+	// If not set, net.ListenUDP is used.
+	// Only valid for the client.
+	DialPacketConn func(network, laddr string) (net.PacketConn, error)
+	// SessionContext is called when a new session is created, with the address of the peer.
+	// The values of the returned context can be retrieved from the context returned by Session.Context.
+	// This allows attaching per-connection state to a session.
+	// The deadline and the cancellation of the returned context are ignored.
+	SessionContext func(remoteAddr net.Addr) context.Context
+	// OnCongestionEvent is called when the congestion controller transitions between
+	// slow start, congestion avoidance and recovery.
+	// It is called from the session's run loop, and must not block.
+	// It is only called when using the Cubic congestion controller.
+	// Warning: This API should not be considered stable and might change soon.
+	OnCongestionEvent func(CongestionEvent)
+	// StreamScheduler determines the order in which streams are allowed to send data.
+	// If not set, it defaults to StreamSchedulerRoundRobin.
+	StreamScheduler StreamScheduler
+	// StreamWeight returns the weight of a stream, between 1 and 255.
+	// It is only used by the StreamSchedulerWeightedFair, and called when the stream starts sending data.
+	// A weight of 0 is treated like a weight of 1.
+	// If not set, all streams have the same weight.
+	// Weights set by Stream.SetPriority take precedence.
+	StreamWeight func(StreamID) uint8
+	// CongestionControl is the congestion control algorithm.
+	// If not set, it defaults to CongestionCubic.
+	// It is ignored if the CongestionControllerFactory is set.
+	CongestionControl CongestionControl
+	// CongestionControllerFactory is called once for every session, and returns the congestion controller used by it.
+	// The RTTStats are updated by the session, and can be used by the congestion controller.
+	// If not set, the algorithm selected by CongestionControl is used.
+	// Warning: This API should not be considered stable and might change soon.
+	CongestionControllerFactory func(RTTStats) CongestionController
+	// InitialPacingRate is the pacing rate (in bytes per second) used before the congestion controller has an estimate of the path,
+	// i.e. before the first RTT sample was taken.
+	// If not set, packets are not paced until then.
+	InitialPacingRate uint64
+	// MaxPacingBurst is the maximum number of full-sized packets that are sent back-to-back.
+	// After the connection was idle for some time, a burst of this size can be sent, subsequent packets are paced.
+	// If not set, it defaults to 10 packets.
+	MaxPacingBurst int
+	// MaxAckDelay is the maximum time that sending an ACK for a retransmittable packet is delayed.
+	// For IETF QUIC, it is sent to the peer in the max_ack_delay transport parameter, so that the peer's loss recovery timers take it into account.
+	// If not set, it defaults to 25ms. Values larger than 255ms are reduced to 255ms.
+	MaxAckDelay time.Duration
+	// PacketsPerAck is the number of retransmittable packets that are acknowledged at once.
+	// An ACK is sent as soon as this number of packets was received, or when the MaxAckDelay expires.
+	// If not set, an ACK is sent for every 2 packets at the beginning of the connection,
+	// and then for every 10 packets, or after 1/4 of the minimum RTT (ACK decimation).
+	PacketsPerAck int
+	// ImmediateAckOnReordering makes the receiver send an ACK immediately when a packet arrives out of order,
+	// i.e. when a packet number is skipped, or when a packet fills a gap.
+	// This allows the peer to detect losses faster, at the cost of sending more ACKs on paths that reorder packets.
+	// If not set, an ACK is sent after 1/8 of the minimum RTT when a gap appears, and immediately when a gap reported in an ACK is filled.
+	ImmediateAckOnReordering bool
+	// EnableDatagrams enables the DATAGRAM frame extension, which allows sending of unreliable messages using SendMessage.
+	// Messages can only be sent when the peer enabled the extension as well.
+	// It is only supported for IETF QUIC.
+	EnableDatagrams bool
+	// DisableECN disables ECN (Explicit Congestion Notification).
+	// By default, outgoing packets are marked ECT(0) on Linux, and CE marks reported by the peer are treated as a congestion signal.
+	// This should only be needed on networks that drop or mangle ECN marked packets.
+	// It is only used for IETF QUIC.
+	DisableECN bool
+	// MaxPacketSize is the maximum size of the packets sent (the size of the UDP payload).
+	// It limits the initial packet size, as well as the packet sizes probed by path MTU discovery.
+	// If not set, it defaults to 1452 bytes, the largest packet size that quic-go accepts.
+	// Values smaller than 1200 bytes are increased to 1200 bytes.
+	MaxPacketSize uint64
+	// DisablePathMTUDiscovery disables path MTU discovery (DPLPMTUD, RFC 8899).
+	// By default, PING frames padded to increasing sizes are sent after the handshake completes,
+	// and the packet size is raised to the largest size that was acknowledged by the peer.
+	DisablePathMTUDiscovery bool
+	// KeyUpdateInterval is the number of packets sent with the same 1-RTT keys, before the keys are updated.
+	// If not set, it defaults to 100,000 packets.
+	// It is only used for IETF QUIC.
+	KeyUpdateInterval uint64
+	// TLSStack is the TLS 1.3 implementation used for the handshake.
+	// If not set, it defaults to TLSStackMint.
+	// It is only used for IETF QUIC.
+	TLSStack TLSStack
+	// GetLogWriter is used to create a qlog trace for a connection.
+	// It is called once for every connection, with the connection ID that identifies the connection.
+	// When it returns a non-nil io.WriteCloser, the trace is written to it while the connection is running.
+	// The writes are buffered, and the io.WriteCloser is closed when the connection is closed.
+	// The trace can be visualized using tools like qvis.
+	// Warning: This API should not be considered stable and might change soon.
+	GetLogWriter func(connectionID []byte) io.WriteCloser
+	// Tracer is informed about the packets sent, received, lost and dropped, and about congestion and RTT updates.
+	// In contrast to a qlog trace, it can aggregate events of all connections, e.g. to export metrics.
+	Tracer Tracer
+	// Logger receives the log messages.
+	// If not set, messages are written using the log package, and the log level is set by the QUIC_GO_LOG_LEVEL environment variable.
+	Logger Logger
+	// ClientSessionCache caches the state needed to send 0-RTT data to a server, see DialEarly.
+	// If not set, 0-RTT is never used.
+	// For IETF QUIC, it stores the TLS session tickets, if the crypto/tls stack is used,
+	// unless the tls.Config has a ClientSessionCache itself. 0-RTT is currently only supported for gQUIC.
+	// Only valid for the client.
+	ClientSessionCache ClientSessionCache
+	// TokenStore saves the tokens received from servers, which are used to skip the Stateless Retry on subsequent connections.
+	// Tokens are stored under the hostname of the server.
+	// It is only used for IETF QUIC.
+	// Only valid for the client.
+	TokenStore TokenStore
+	// StatelessResetKey is used to derive the stateless reset tokens for the connections of a server.
+	// The server sends a stateless reset when it receives a packet for a connection it doesn't have any state for,
+	// e.g. after a restart, allowing the client to close the connection right away instead of waiting for the idle timeout.
+	// For this to work across restarts, the same key must be used. It should be at least 32 bytes long and must be kept secret.
+	// If not set, a random key is generated, and stateless resets only work as long as the server is running.
+	// It is only used for IETF QUIC.
+	// Only valid for the server.
+	StatelessResetKey []byte
+	// TicketKeys are the keys used to encrypt the tokens issued by the server (the STKs for gQUIC),
+	// and the TLS session tickets if the crypto/tls stack is used (unless the tls.Config wraps the session tickets itself).
+	// To accept each other's tokens and tickets, a fleet of servers can share the TicketKeys, and rotate them using TicketKeys.SetKeys.
+	// If not set, random keys are generated, and tokens and tickets are only valid as long as the server is running.
+	// Only valid for the server.
+	TicketKeys *TicketKeys
+	// Allow0RTT is called when a client tries to complete the handshake in 0-RTT, using a server config and an STK it cached.
+	// Data sent by the client in 0-RTT can be replayed by an attacker, so applications that
+	// process requests that aren't idempotent can use it to bound or reject 0-RTT.
+	// The tokenAge is the time that passed since the server issued the STK.
+	// If it returns false, 0-RTT is rejected: the server sends a REJ, and the client retransmits its data after the handshake completed.
+	// If not set, all 0-RTT handshakes (with a valid STK) are accepted.
+	// Only valid for the server, and only for gQUIC.
+	Allow0RTT func(clientAddr net.Addr, tokenAge time.Duration) bool
+	// SingleUse0RTT makes the server accept every ClientHello for 0-RTT only once.
+	// The server only accepts ClientHellos for 0-RTT if the timestamp of their client nonce is within 10 minutes of its clock.
+	// It remembers the ClientHellos until their timestamp left this window,
+	// and rejects 0-RTT if it can't remember any more of them.
+	// The ClientHellos are only remembered by this server,
+	// so a replay sent to another server of the fleet is not detected.
+	// Only valid for the server, and only for gQUIC.
+	SingleUse0RTT bool
+	// SharedEventLoop makes the server run its sessions on a small number of shared event loops once the handshake completed,
+	// instead of running a goroutine for every session.
+	// The timers of the sessions are then set on a timer wheel, with a granularity of one millisecond.
+	// This reduces the memory used for servers that keep a large number of mostly idle connections open.
+	// Only valid for the server.
+	SharedEventLoop bool
+	// GetConfigForClient is called when the server receives the ClientHello of a new connection, before the session is created.
+	// It can return the tls.Config and the Config used for this session.
+	// If one of them is nil, the one passed to Listen is used.
+	// Options that apply to all sessions of the server are always taken from the Config passed to Listen:
+	// the Versions, the ConnectionIDLength, the ConnectionIDGenerator, AcceptToken, RequireAddressValidation, StatelessResetKey, TicketKeys, Allow0RTT, SingleUse0RTT, SharedEventLoop, TLSStack, CloseOnOversizedPackets, MaxIncomingConnections and the Logger.
+	// If it returns an error, the connection is rejected.
+	// For IETF QUIC, it is called again for the ClientHello sent after a Stateless Retry.
+	// Only valid for the server.
+	GetConfigForClient func(info *ClientHelloInfo) (*tls.Config, *Config, error)
 }
 
 // A Listener for incoming QUIC connections
 type Listener interface {
 	// Close the server, sending CONNECTION_CLOSE frames to each peer.
 	Close() error
+	// Shutdown shuts down the server gracefully.
+	// It stops accepting new sessions, and tells the peers that the server is going away:
+	// new streams opened by the peers are refused, but the streams that are already open can still be used.
+	// It then waits until all sessions are closed, or until the context expires.
+	// Sessions that are still open at that point are closed with a PeerGoingAway error.
+	Shutdown(context.Context) error
 	// Addr returns the local network addr that the server is listening on.
 	Addr() net.Addr
 	// Accept returns new sessions. It should be called in a loop.
 	Accept() (Session, error)
+	// ImportSession continues a session exported by Session.ExportState, usually in another process.
+	// It returns the session, and the streams that were opened or accepted before the export.
+	// Streams opened by the peer that weren't accepted yet are returned by AcceptStream.
+	// Moving the packets of the connection to this Listener (e.g. by passing the socket to the new process) is up to the application.
+	// The Config must use the same StatelessResetKey as the Config of the exporting Listener.
+	// The RTT and congestion control state are not exported, and start afresh.
+	// Imported sessions don't have the peer's certificates, can't export keying material,
+	// and can't decrypt packets with a Long Header any more.
+	// Warning: This API should not be considered stable and might change soon.
+	ImportSession(state []byte) (Session, []Stream, error)
+}
+
+// An EarlyListener listens for incoming QUIC connections,
+// and returns them before the handshake completes.
+type EarlyListener interface {
+	// Close the server, sending CONNECTION_CLOSE frames to each peer.
+	Close() error
+	// Shutdown shuts down the server gracefully.
+	// It stops accepting new sessions, and tells the peers that the server is going away:
+	// new streams opened by the peers are refused, but the streams that are already open can still be used.
+	// It then waits until all sessions are closed, or until the context expires.
+	// Sessions that are still open at that point are closed with a PeerGoingAway error.
+	Shutdown(context.Context) error
+	// Addr returns the local network addr that the server is listening on.
+	Addr() net.Addr
+	// Accept returns new early sessions. It should be called in a loop.
+	Accept() (EarlySession, error)
 }
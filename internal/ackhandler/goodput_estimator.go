@@ -0,0 +1,87 @@
+package ackhandler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// goodputWindow is the length of the sliding window used to calculate the goodput
+const goodputWindow = time.Second
+
+type goodputSample struct {
+	time  time.Time
+	bytes protocol.ByteCount
+}
+
+// The goodputEstimator calculates the rate at which STREAM data is acknowledged by the peer.
+// Since it is read when the application requests the session stats, it is safe for concurrent use.
+type goodputEstimator struct {
+	mutex sync.Mutex
+
+	startTime     time.Time // the time when the first STREAM data was sent
+	samples       []goodputSample
+	bytesInWindow protocol.ByteCount
+}
+
+// SentStreamData should be called when a packet containing STREAM data is sent
+func (e *goodputEstimator) SentStreamData(sendTime time.Time) {
+	e.mutex.Lock()
+	if e.startTime.IsZero() {
+		e.startTime = sendTime
+	}
+	e.mutex.Unlock()
+}
+
+// AckedStreamData should be called when STREAM data is acknowledged
+func (e *goodputEstimator) AckedStreamData(n protocol.ByteCount, rcvTime time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.samples = append(e.samples, goodputSample{time: rcvTime, bytes: n})
+	e.bytesInWindow += n
+	e.removeOldSamples(rcvTime)
+}
+
+// Goodput returns the goodput over the last goodputWindow
+func (e *goodputEstimator) Goodput(now time.Time) congestion.Bandwidth {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.startTime.IsZero() {
+		return 0
+	}
+	e.removeOldSamples(now)
+	window := goodputWindow
+	// the connection only started sending data recently
+	if elapsed := now.Sub(e.startTime); elapsed < window {
+		window = elapsed
+	}
+	if window <= 0 {
+		return 0
+	}
+	return congestion.BandwidthFromDelta(e.bytesInWindow, window)
+}
+
+func (e *goodputEstimator) removeOldSamples(now time.Time) {
+	var i int
+	for i < len(e.samples) && !e.samples[i].time.After(now.Add(-goodputWindow)) {
+		e.bytesInWindow -= e.samples[i].bytes
+		i++
+	}
+	e.samples = e.samples[i:]
+}
+
+// streamDataLen returns the number of bytes of STREAM data contained in the frames
+func streamDataLen(fs []wire.Frame) protocol.ByteCount {
+	var n protocol.ByteCount
+	for _, f := range fs {
+		if sf, ok := f.(*wire.StreamFrame); ok {
+			n += sf.DataLen()
+		}
+	}
+	return n
+}
@@ -0,0 +1,72 @@
+package ackhandler
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Goodput estimator", func() {
+	var (
+		e   *goodputEstimator
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		e = &goodputEstimator{}
+		now = time.Now()
+	})
+
+	It("returns 0 before any STREAM data was sent", func() {
+		Expect(e.Goodput(now)).To(BeZero())
+	})
+
+	It("calculates the goodput since the first STREAM data was sent", func() {
+		e.SentStreamData(now)
+		e.AckedStreamData(1000, now.Add(100*time.Millisecond))
+		e.AckedStreamData(1000, now.Add(200*time.Millisecond))
+		Expect(e.Goodput(now.Add(500 * time.Millisecond))).To(Equal(4000 * congestion.BytesPerSecond))
+	})
+
+	It("only takes into account data acknowledged in the sliding window", func() {
+		e.SentStreamData(now)
+		e.AckedStreamData(5000, now.Add(100*time.Millisecond))
+		e.AckedStreamData(1000, now.Add(1500*time.Millisecond))
+		Expect(e.Goodput(now.Add(2 * time.Second))).To(Equal(1000 * congestion.BytesPerSecond))
+		Expect(e.samples).To(HaveLen(1))
+	})
+
+	It("decreases when no more data is acknowledged", func() {
+		e.SentStreamData(now)
+		e.AckedStreamData(1000, now.Add(time.Second))
+		Expect(e.Goodput(now.Add(time.Second))).To(Equal(1000 * congestion.BytesPerSecond))
+		Expect(e.Goodput(now.Add(3 * time.Second))).To(BeZero())
+	})
+
+	It("approaches the link capacity for a saturating transfer", func() {
+		const linkCapacity = 1000 * 1000 // bytes per second
+		const packetSize = 1000
+		e.SentStreamData(now)
+		// a packet arrives every millisecond
+		t := now
+		for i := 0; i < 3000; i++ {
+			t = t.Add(time.Millisecond)
+			e.AckedStreamData(packetSize, t)
+		}
+		goodput := e.Goodput(t) / congestion.BytesPerSecond
+		Expect(goodput).To(BeNumerically("~", linkCapacity, linkCapacity/100))
+	})
+
+	It("counts the STREAM data in frames", func() {
+		frames := []wire.Frame{
+			&wire.StreamFrame{Data: []byte("foobar")},
+			&wire.PingFrame{},
+			&wire.StreamFrame{Data: []byte("foo")},
+		}
+		Expect(streamDataLen(frames)).To(Equal(protocol.ByteCount(9)))
+	})
+})
@@ -3,6 +3,7 @@ package ackhandler
 import (
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
@@ -14,6 +15,12 @@ type SentPacketHandler interface {
 	SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber)
 	ReceivedAck(ackFrame *wire.AckFrame, withPacketNumber protocol.PacketNumber, encLevel protocol.EncryptionLevel, recvTime time.Time) error
 	SetHandshakeComplete()
+	// LimitAmplification enables the anti-amplification limit:
+	// until the handshake completes, at most 3 times the number of bytes received from the peer are sent.
+	// It is used by servers that didn't validate the client's address.
+	LimitAmplification()
+	// ReceivedBytes is called for every packet received from the peer, and raises the anti-amplification limit.
+	ReceivedBytes(protocol.ByteCount)
 
 	// The SendMode determines if and what kind of packets can be sent.
 	SendMode() SendMode
@@ -22,7 +29,7 @@ type SentPacketHandler interface {
 	TimeUntilSend() time.Time
 	// ShouldSendNumPackets returns the number of packets that should be sent immediately.
 	// It always returns a number greater or equal than 1.
-	// A number greater than 1 is returned when the pacing delay is smaller than the minimum pacing delay.
+	// A number greater than 1 is returned when the pacer's budget allows sending a burst of packets.
 	// Note that the number of packets is only calculated based on the pacing algorithm.
 	// Before sending any packet, SendingAllowed() must be called to learn if we can actually send it.
 	ShouldSendNumPackets() int
@@ -34,11 +41,42 @@ type SentPacketHandler interface {
 
 	GetAlarmTimeout() time.Time
 	OnAlarm() error
+
+	// OnConnectionMigration is called when the connection migrated to a new path.
+	// It resets the RTT measurements, and replaces the congestion controller.
+	// If controller is nil, a new Cubic congestion controller is used.
+	OnConnectionMigration(controller congestion.Controller)
+	// SetMaxAckDelay sets the maximum time that the peer delays sending ACKs.
+	// It is taken into account for the TLP and RTO timers. Until it is set, protocol.DefaultMaxAckDelay is used.
+	SetMaxAckDelay(time.Duration)
+
+	// GetGoodput returns the rate at which STREAM data was acknowledged by the peer recently.
+	// It is safe to call it concurrently with the other methods.
+	GetGoodput(now time.Time) congestion.Bandwidth
+	// GetStats returns statistics about the packets sent, as well as the current RTT and congestion control state.
+	// It is safe to call it concurrently with the other methods.
+	GetStats() Stats
+
+	// ExportState returns the state needed to continue sending packets in another process.
+	// It errors if packets are still outstanding, or queued for retransmission.
+	ExportState() (SentPacketHandlerState, error)
+	// ImportState restores the state exported by another process.
+	// It must be called before any packet is sent.
+	ImportState(SentPacketHandlerState)
+}
+
+// A SentPacketTracer traces the events of the SentPacketHandler.
+// It is implemented by the qlog.Tracer.
+type SentPacketTracer interface {
+	LostPacket(t time.Time, packetType protocol.PacketType, encLevel protocol.EncryptionLevel, pn protocol.PacketNumber)
+	UpdatedMetrics(t time.Time, rttStats *congestion.RTTStats, cwnd, bytesInFlight protocol.ByteCount)
 }
 
 // ReceivedPacketHandler handles ACKs needed to send for incoming packets
 type ReceivedPacketHandler interface {
-	ReceivedPacket(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck bool) error
+	// ReceivedPacket is called for every packet received.
+	// ecn is the ECN codepoint of the IP packet. It is ECNNon if it couldn't be read from the socket.
+	ReceivedPacket(packetNumber protocol.PacketNumber, ecn protocol.ECN, rcvTime time.Time, shouldInstigateAck bool) error
 	IgnoreBelow(protocol.PacketNumber)
 
 	GetAlarmTimeout() time.Time
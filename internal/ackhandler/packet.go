@@ -15,6 +15,11 @@ type Packet struct {
 	Length          protocol.ByteCount
 	EncryptionLevel protocol.EncryptionLevel
 	SendTime        time.Time
+	// IsPathMTUProbePacket is set for packets sent by path MTU discovery.
+	// The loss of such a packet is not a sign of congestion, and it is not retransmitted.
+	IsPathMTUProbePacket bool
+	// ContainsRetransmission is set for packets that contain frames of a lost packet.
+	ContainsRetransmission bool
 
 	largestAcked protocol.PacketNumber // if the packet contains an ACK, the LargestAcked value of that ACK
 
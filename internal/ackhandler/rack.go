@@ -0,0 +1,120 @@
+package ackhandler
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+const (
+	// The reordering window is a multiple of the minimum RTT divided by this value.
+	rackReorderingWindowDivisor = 4
+	// After this many loss recoveries without a spurious loss, the reordering window shrinks back to its initial value.
+	rackReorderingWindowPersist = 16
+	// The number of packets declared lost that are remembered, in order to detect spurious losses.
+	rackMaxTrackedLostPackets = 64
+)
+
+// The rackDetector implements time-based loss detection as described in RACK (RFC 8985).
+// A packet is declared lost if a packet sent after it was acknowledged,
+// and the RTT plus a reordering window passed since it was sent.
+// The reordering window grows when a packet that was declared lost is acknowledged later,
+// and shrinks back after a number of loss recoveries without such spurious losses.
+type rackDetector struct {
+	// the send time and the packet number of the most recently sent packet that was acknowledged,
+	// and the time when the ACK for that packet was received
+	hasAckedPacket bool
+	xmitTime       time.Time
+	packetNumber   protocol.PacketNumber
+	ackTime        time.Time
+
+	reorderingWindowMult    uint32
+	reorderingWindowPersist int
+
+	// the packet numbers of packets that were recently declared lost
+	lostPackets []protocol.PacketNumber
+}
+
+func newRACKDetector() *rackDetector {
+	return &rackDetector{reorderingWindowMult: 1}
+}
+
+// OnPacketAcked must be called for every newly acknowledged packet.
+func (r *rackDetector) OnPacketAcked(p *Packet, rcvTime time.Time) {
+	if r.hasAckedPacket && !r.sentAfterXmitTime(p) {
+		return
+	}
+	r.hasAckedPacket = true
+	r.xmitTime = p.SendTime
+	r.packetNumber = p.PacketNumber
+	r.ackTime = rcvTime
+}
+
+// OnPacketLost must be called for every packet that is declared lost.
+func (r *rackDetector) OnPacketLost(pn protocol.PacketNumber) {
+	r.lostPackets = append(r.lostPackets, pn)
+	if len(r.lostPackets) > rackMaxTrackedLostPackets {
+		r.lostPackets = r.lostPackets[1:]
+	}
+}
+
+// OnLossRecovery must be called when packets were declared lost in response to an ACK or the loss alarm.
+func (r *rackDetector) OnLossRecovery() {
+	if r.reorderingWindowPersist == 0 {
+		return
+	}
+	r.reorderingWindowPersist--
+	if r.reorderingWindowPersist == 0 {
+		r.reorderingWindowMult = 1
+	}
+}
+
+// DetectSpuriousLosses checks if the ACK frame acknowledges packets that were declared lost.
+// In that case, the packets were only reordered, and the reordering window is increased.
+func (r *rackDetector) DetectSpuriousLosses(ackFrame *wire.AckFrame) {
+	var spurious bool
+	lostPackets := r.lostPackets[:0]
+	for _, pn := range r.lostPackets {
+		if ackFrame.AcksPacket(pn) {
+			spurious = true
+			continue
+		}
+		lostPackets = append(lostPackets, pn)
+	}
+	r.lostPackets = lostPackets
+	if spurious {
+		r.reorderingWindowMult++
+		r.reorderingWindowPersist = rackReorderingWindowPersist
+	}
+}
+
+// ReorderingWindow returns the time that a packet may arrive late before it is declared lost.
+// It is never larger than the smoothed RTT.
+func (r *rackDetector) ReorderingWindow(minRTT, smoothedRTT time.Duration) time.Duration {
+	return utils.MinDuration(time.Duration(r.reorderingWindowMult)*minRTT/rackReorderingWindowDivisor, smoothedRTT)
+}
+
+// LossDelay returns the remaining time until a packet will be declared lost.
+// A value <= 0 means that the packet is lost.
+// The bool is false if the packet was sent after the most recently sent packet that was acknowledged.
+// Those packets can't be declared lost yet.
+func (r *rackDetector) LossDelay(p *Packet, reorderingWindow time.Duration, now time.Time) (time.Duration, bool) {
+	if !r.hasAckedPacket || r.sentAfterXmitTime(p) || p.PacketNumber == r.packetNumber {
+		return 0, false
+	}
+	// A packet is lost when the RTT of the most recently sent packet that was acknowledged, plus the reordering window, passed since it was sent.
+	// This is calculated relative to the ACK, since the send times might be far in the past.
+	lossTime := r.ackTime.Add(reorderingWindow - r.xmitTime.Sub(p.SendTime))
+	return lossTime.Sub(now), true
+}
+
+// sentAfterXmitTime says if a packet was sent after the most recently sent packet that was acknowledged.
+// Packets sent at the same time are ordered by their packet number.
+func (r *rackDetector) sentAfterXmitTime(p *Packet) bool {
+	if p.SendTime.Equal(r.xmitTime) {
+		return p.PacketNumber > r.packetNumber
+	}
+	return p.SendTime.After(r.xmitTime)
+}
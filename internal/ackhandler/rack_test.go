@@ -0,0 +1,103 @@
+package ackhandler
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RACK loss detection", func() {
+	var (
+		r   *rackDetector
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		r = newRACKDetector()
+		now = time.Now()
+	})
+
+	It("doesn't declare packets lost before a packet was acknowledged", func() {
+		_, ok := r.LossDelay(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Hour)}, 0, now)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("declares packets lost when the RTT plus the reordering window passed", func() {
+		r.OnPacketAcked(&Packet{PacketNumber: 3, SendTime: now.Add(-100 * time.Millisecond)}, now)
+		// sent 10ms before packet 3
+		p := &Packet{PacketNumber: 2, SendTime: now.Add(-110 * time.Millisecond)}
+		delay, ok := r.LossDelay(p, 25*time.Millisecond, now)
+		Expect(ok).To(BeTrue())
+		Expect(delay).To(Equal(15 * time.Millisecond))
+		delay, ok = r.LossDelay(p, 25*time.Millisecond, now.Add(15*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		Expect(delay).To(BeZero())
+	})
+
+	It("doesn't declare packets lost that were sent after the most recently sent acknowledged packet", func() {
+		r.OnPacketAcked(&Packet{PacketNumber: 3, SendTime: now.Add(-time.Second)}, now)
+		_, ok := r.LossDelay(&Packet{PacketNumber: 4, SendTime: now.Add(-time.Second / 2)}, 0, now)
+		Expect(ok).To(BeFalse())
+		// packets sent at the same time are ordered by their packet number
+		_, ok = r.LossDelay(&Packet{PacketNumber: 4, SendTime: now.Add(-time.Second)}, 0, now)
+		Expect(ok).To(BeFalse())
+		_, ok = r.LossDelay(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Second)}, 0, now)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("uses the send time of the most recently sent packet, not the largest packet number", func() {
+		r.OnPacketAcked(&Packet{PacketNumber: 10, SendTime: now.Add(-time.Second)}, now)
+		// a retransmission carries a lower packet number, but was sent later
+		r.OnPacketAcked(&Packet{PacketNumber: 5, SendTime: now.Add(-time.Second / 2)}, now)
+		Expect(r.packetNumber).To(Equal(protocol.PacketNumber(5)))
+		// acknowledging a packet sent earlier doesn't change anything
+		r.OnPacketAcked(&Packet{PacketNumber: 11, SendTime: now.Add(-time.Second)}, now)
+		Expect(r.packetNumber).To(Equal(protocol.PacketNumber(5)))
+		Expect(r.xmitTime).To(Equal(now.Add(-time.Second / 2)))
+	})
+
+	Context("reordering window", func() {
+		It("uses a quarter of the minimum RTT", func() {
+			Expect(r.ReorderingWindow(100*time.Millisecond, 200*time.Millisecond)).To(Equal(25 * time.Millisecond))
+		})
+
+		It("increases the reordering window when a lost packet is acknowledged", func() {
+			r.OnPacketLost(5)
+			r.DetectSpuriousLosses(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 6, Largest: 7}}})
+			Expect(r.ReorderingWindow(100*time.Millisecond, 200*time.Millisecond)).To(Equal(25 * time.Millisecond))
+			r.DetectSpuriousLosses(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 7}}})
+			Expect(r.ReorderingWindow(100*time.Millisecond, 200*time.Millisecond)).To(Equal(50 * time.Millisecond))
+			Expect(r.lostPackets).To(BeEmpty())
+		})
+
+		It("limits the reordering window to the smoothed RTT", func() {
+			for i := protocol.PacketNumber(1); i <= 10; i++ {
+				r.OnPacketLost(i)
+				r.DetectSpuriousLosses(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: i, Largest: i}}})
+			}
+			Expect(r.ReorderingWindow(100*time.Millisecond, 200*time.Millisecond)).To(Equal(200 * time.Millisecond))
+		})
+
+		It("resets the reordering window after a number of loss recoveries", func() {
+			r.OnPacketLost(1)
+			r.DetectSpuriousLosses(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}})
+			for i := 0; i < rackReorderingWindowPersist-1; i++ {
+				r.OnLossRecovery()
+			}
+			Expect(r.ReorderingWindow(100*time.Millisecond, 200*time.Millisecond)).To(Equal(50 * time.Millisecond))
+			r.OnLossRecovery()
+			Expect(r.ReorderingWindow(100*time.Millisecond, 200*time.Millisecond)).To(Equal(25 * time.Millisecond))
+		})
+
+		It("only remembers a limited number of lost packets", func() {
+			for i := protocol.PacketNumber(0); i < 2*rackMaxTrackedLostPackets; i++ {
+				r.OnPacketLost(i)
+			}
+			Expect(r.lostPackets).To(HaveLen(rackMaxTrackedLostPackets))
+			Expect(r.lostPackets[0]).To(Equal(protocol.PacketNumber(rackMaxTrackedLostPackets)))
+		})
+	})
+})
@@ -17,6 +17,7 @@ type receivedPacketHandler struct {
 	packetHistory *receivedPacketHistory
 
 	ackSendDelay time.Duration
+	policy       AckPolicy
 	rttStats     *congestion.RTTStats
 
 	packetsReceivedSinceLastAck                int
@@ -25,12 +26,13 @@ type receivedPacketHandler struct {
 	ackAlarm                                   time.Time
 	lastAck                                    *wire.AckFrame
 
+	// the number of packets received with each ECN codepoint, reported in ACK frames
+	ect0, ect1, ecnce uint64
+
 	version protocol.VersionNumber
 }
 
 const (
-	// maximum delay that can be applied to an ACK for a retransmittable packet
-	ackSendDelay = 25 * time.Millisecond
 	// initial maximum number of retransmittable packets received before sending an ack.
 	initialRetransmittablePacketsBeforeAck = 2
 	// number of retransmittable that an ACK is sent for
@@ -51,22 +53,44 @@ const (
 	maxPacketsAfterNewMissing = 4
 )
 
-// NewReceivedPacketHandler creates a new receivedPacketHandler
-func NewReceivedPacketHandler(rttStats *congestion.RTTStats, version protocol.VersionNumber) ReceivedPacketHandler {
-	return &receivedPacketHandler{
+// An AckPolicy determines when ACKs are sent.
+type AckPolicy struct {
+	// MaxAckDelay is the maximum delay that can be applied to an ACK for a retransmittable packet.
+	// If 0, protocol.DefaultMaxAckDelay is used.
+	MaxAckDelay time.Duration
+	// PacketsPerAck is the number of retransmittable packets after which an ACK is sent.
+	// If 0, ACK decimation is used.
+	PacketsPerAck int
+	// ImmediateAckOnReordering makes the receiver send an ACK as soon as a packet arrives out of order.
+	ImmediateAckOnReordering bool
+}
+
+// NewReceivedPacketHandler creates a new receivedPacketHandler.
+// If policy is nil, the default ACK policy is used.
+func NewReceivedPacketHandler(rttStats *congestion.RTTStats, policy *AckPolicy, version protocol.VersionNumber) ReceivedPacketHandler {
+	h := &receivedPacketHandler{
 		packetHistory: newReceivedPacketHistory(),
-		ackSendDelay:  ackSendDelay,
+		ackSendDelay:  protocol.DefaultMaxAckDelay,
 		rttStats:      rttStats,
 		version:       version,
 	}
+	if policy != nil {
+		h.policy = *policy
+		if policy.MaxAckDelay > 0 {
+			h.ackSendDelay = policy.MaxAckDelay
+		}
+	}
+	return h
 }
 
-func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck bool) error {
+func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumber, ecn protocol.ECN, rcvTime time.Time, shouldInstigateAck bool) error {
 	if packetNumber < h.ignoreBelow {
 		return nil
 	}
 
 	isMissing := h.isMissing(packetNumber)
+	// The first packet is always acknowledged immediately.
+	isReordered := h.lastAck != nil && packetNumber != h.largestObserved+1
 	if packetNumber > h.largestObserved {
 		h.largestObserved = packetNumber
 		h.largestObservedReceivedTime = rcvTime
@@ -75,13 +99,30 @@ func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumbe
 	if err := h.packetHistory.ReceivedPacket(packetNumber); err != nil {
 		return err
 	}
-	h.maybeQueueAck(packetNumber, rcvTime, shouldInstigateAck, isMissing)
+	switch ecn {
+	case protocol.ECT0:
+		h.ect0++
+	case protocol.ECT1:
+		h.ect1++
+	case protocol.ECNCE:
+		h.ecnce++
+	}
+	h.maybeQueueAck(packetNumber, rcvTime, shouldInstigateAck, isMissing || (h.policy.ImmediateAckOnReordering && isReordered))
+	// Report congestion to the peer as soon as possible.
+	if ecn == protocol.ECNCE {
+		h.ackQueued = true
+		h.ackAlarm = time.Time{}
+	}
 	return nil
 }
 
 // IgnoreBelow sets a lower limit for acking packets.
 // Packets with packet numbers smaller than p will not be acked.
+// The limit is never decreased.
 func (h *receivedPacketHandler) IgnoreBelow(p protocol.PacketNumber) {
+	if p <= h.ignoreBelow {
+		return
+	}
 	h.ignoreBelow = p
 	h.packetHistory.DeleteBelow(p)
 }
@@ -124,13 +165,20 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 	if !h.ackQueued && shouldInstigateAck {
 		h.retransmittablePacketsReceivedSinceLastAck++
 
-		if packetNumber > minReceivedBeforeAckDecimation {
+		if h.policy.PacketsPerAck > 0 {
+			// the application configured the number of packets per ACK, don't use ack decimation
+			if h.retransmittablePacketsReceivedSinceLastAck >= h.policy.PacketsPerAck {
+				h.ackQueued = true
+			} else if h.ackAlarm.IsZero() {
+				h.ackAlarm = rcvTime.Add(h.ackSendDelay)
+			}
+		} else if packetNumber > minReceivedBeforeAckDecimation {
 			// ack up to 10 packets at once
 			if h.retransmittablePacketsReceivedSinceLastAck >= retransmittablePacketsBeforeAck {
 				h.ackQueued = true
 			} else if h.ackAlarm.IsZero() {
 				// wait for the minimum of the ack decimation delay or the delayed ack time before sending an ack
-				ackDelay := utils.MinDuration(ackSendDelay, time.Duration(float64(h.rttStats.MinRTT())*float64(ackDecimationDelay)))
+				ackDelay := utils.MinDuration(h.ackSendDelay, time.Duration(float64(h.rttStats.MinRTT())*float64(ackDecimationDelay)))
 				h.ackAlarm = rcvTime.Add(ackDelay)
 			}
 		} else {
@@ -138,7 +186,7 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 			if h.retransmittablePacketsReceivedSinceLastAck >= initialRetransmittablePacketsBeforeAck {
 				h.ackQueued = true
 			} else if h.ackAlarm.IsZero() {
-				h.ackAlarm = rcvTime.Add(ackSendDelay)
+				h.ackAlarm = rcvTime.Add(h.ackSendDelay)
 			}
 		}
 		// If there are new missing packets to report, set a short timer to send an ACK.
@@ -166,6 +214,9 @@ func (h *receivedPacketHandler) GetAckFrame() *wire.AckFrame {
 	ack := &wire.AckFrame{
 		AckRanges:          h.packetHistory.GetAckRanges(),
 		PacketReceivedTime: h.largestObservedReceivedTime,
+		ECT0:               h.ect0,
+		ECT1:               h.ect1,
+		ECNCE:              h.ecnce,
 	}
 
 	h.lastAck = ack
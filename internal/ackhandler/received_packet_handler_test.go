@@ -19,21 +19,21 @@ var _ = Describe("receivedPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats = &congestion.RTTStats{}
-		handler = NewReceivedPacketHandler(rttStats, protocol.VersionWhatever).(*receivedPacketHandler)
+		handler = NewReceivedPacketHandler(rttStats, nil, protocol.VersionWhatever).(*receivedPacketHandler)
 	})
 
 	Context("accepting packets", func() {
 		It("handles a packet that arrives late", func() {
-			err := handler.ReceivedPacket(protocol.PacketNumber(1), time.Time{}, true)
+			err := handler.ReceivedPacket(protocol.PacketNumber(1), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
-			err = handler.ReceivedPacket(protocol.PacketNumber(3), time.Time{}, true)
+			err = handler.ReceivedPacket(protocol.PacketNumber(3), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
-			err = handler.ReceivedPacket(protocol.PacketNumber(2), time.Time{}, true)
+			err = handler.ReceivedPacket(protocol.PacketNumber(2), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("saves the time when each packet arrived", func() {
-			err := handler.ReceivedPacket(protocol.PacketNumber(3), time.Now(), true)
+			err := handler.ReceivedPacket(protocol.PacketNumber(3), protocol.ECNNon, time.Now(), true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObservedReceivedTime).To(BeTemporally("~", time.Now(), 10*time.Millisecond))
 		})
@@ -42,7 +42,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			now := time.Now()
 			handler.largestObserved = 3
 			handler.largestObservedReceivedTime = now.Add(-1 * time.Second)
-			err := handler.ReceivedPacket(5, now, true)
+			err := handler.ReceivedPacket(5, protocol.ECNNon, now, true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObserved).To(Equal(protocol.PacketNumber(5)))
 			Expect(handler.largestObservedReceivedTime).To(Equal(now))
@@ -53,7 +53,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			timestamp := now.Add(-1 * time.Second)
 			handler.largestObserved = 5
 			handler.largestObservedReceivedTime = timestamp
-			err := handler.ReceivedPacket(4, now, true)
+			err := handler.ReceivedPacket(4, protocol.ECNNon, now, true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObserved).To(Equal(protocol.PacketNumber(5)))
 			Expect(handler.largestObservedReceivedTime).To(Equal(timestamp))
@@ -62,7 +62,7 @@ var _ = Describe("receivedPacketHandler", func() {
 		It("passes on errors from receivedPacketHistory", func() {
 			var err error
 			for i := protocol.PacketNumber(0); i < 5*protocol.MaxTrackedReceivedAckRanges; i++ {
-				err = handler.ReceivedPacket(2*i+1, time.Time{}, true)
+				err = handler.ReceivedPacket(2*i+1, protocol.ECNNon, time.Time{}, true)
 				// this will eventually return an error
 				// details about when exactly the receivedPacketHistory errors are tested there
 				if err != nil {
@@ -77,7 +77,7 @@ var _ = Describe("receivedPacketHandler", func() {
 		Context("queueing ACKs", func() {
 			receiveAndAck10Packets := func() {
 				for i := 1; i <= 10; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -86,7 +86,7 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			receiveAndAckPacketsUntilAckDecimation := func() {
 				for i := 1; i <= minReceivedBeforeAckDecimation; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -94,14 +94,14 @@ var _ = Describe("receivedPacketHandler", func() {
 			}
 
 			It("always queues an ACK for the first packet", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, false)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
 			})
 
 			It("works with packet number 0", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, false)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
@@ -111,11 +111,11 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAck10Packets()
 				p := protocol.PacketNumber(11)
 				for i := 0; i <= 20; i++ {
-					err := handler.ReceivedPacket(p, time.Time{}, true)
+					err := handler.ReceivedPacket(p, protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeFalse())
 					p++
-					err = handler.ReceivedPacket(p, time.Time{}, true)
+					err = handler.ReceivedPacket(p, protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeTrue())
 					p++
@@ -128,13 +128,13 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAck10Packets()
 				p := protocol.PacketNumber(10000)
 				for i := 0; i < 9; i++ {
-					err := handler.ReceivedPacket(p, time.Now(), true)
+					err := handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeFalse())
 					p++
 				}
 				Expect(handler.GetAlarmTimeout()).NotTo(BeZero())
-				err := handler.ReceivedPacket(p, time.Now(), true)
+				err := handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
@@ -142,28 +142,28 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("only sets the timer when receiving a retransmittable packets", func() {
 				receiveAndAck10Packets()
-				err := handler.ReceivedPacket(11, time.Now(), false)
+				err := handler.ReceivedPacket(11, protocol.ECNNon, time.Now(), false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
 				rcvTime := time.Now().Add(10 * time.Millisecond)
-				err = handler.ReceivedPacket(12, rcvTime, true)
+				err = handler.ReceivedPacket(12, protocol.ECNNon, rcvTime, true)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
-				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(ackSendDelay)))
+				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(protocol.DefaultMaxAckDelay)))
 			})
 
 			It("queues an ACK if it was reported missing before", func() {
 				receiveAndAck10Packets()
-				err := handler.ReceivedPacket(11, time.Time{}, true)
+				err := handler.ReceivedPacket(11, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(13, time.Time{}, true)
+				err = handler.ReceivedPacket(13, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame() // ACK: 1 and 3, missing: 2
 				Expect(ack).ToNot(BeNil())
 				Expect(ack.HasMissingRanges()).To(BeTrue())
 				Expect(handler.ackQueued).To(BeFalse())
-				err = handler.ReceivedPacket(12, time.Time{}, false)
+				err = handler.ReceivedPacket(12, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 			})
@@ -171,15 +171,26 @@ var _ = Describe("receivedPacketHandler", func() {
 			It("doesn't queue an ACK if the packet closes a gap that was not yet reported", func() {
 				receiveAndAckPacketsUntilAckDecimation()
 				p := protocol.PacketNumber(minReceivedBeforeAckDecimation + 1)
-				err := handler.ReceivedPacket(p+1, time.Now(), true) // p is missing now
+				err := handler.ReceivedPacket(p+1, protocol.ECNNon, time.Now(), true) // p is missing now
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 				Expect(handler.GetAlarmTimeout()).ToNot(BeZero())
-				err = handler.ReceivedPacket(p, time.Now(), true) // p is not missing any more
+				err = handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true) // p is not missing any more
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 			})
 
+			It("queues an ACK for a packet marked CE", func() {
+				receiveAndAck10Packets()
+				err := handler.ReceivedPacket(11, protocol.ECT0, time.Now(), true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackQueued).To(BeFalse())
+				err = handler.ReceivedPacket(12, protocol.ECNCE, time.Now(), false)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackQueued).To(BeTrue())
+				Expect(handler.GetAlarmTimeout()).To(BeZero())
+			})
+
 			It("sets an ACK alarm after 1/4 RTT if it creates a new missing range", func() {
 				now := time.Now().Add(-time.Hour)
 				rtt := 80 * time.Millisecond
@@ -187,10 +198,10 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAckPacketsUntilAckDecimation()
 				p := protocol.PacketNumber(minReceivedBeforeAckDecimation + 1)
 				for i := p; i < p+6; i++ {
-					err := handler.ReceivedPacket(i, now, true)
+					err := handler.ReceivedPacket(i, protocol.ECNNon, now, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
-				err := handler.ReceivedPacket(p+10, now, true) // we now know that packets p+7, p+8 and p+9
+				err := handler.ReceivedPacket(p+10, protocol.ECNNon, now, true) // we now know that packets p+7, p+8 and p+9
 				Expect(err).ToNot(HaveOccurred())
 				Expect(rttStats.MinRTT()).To(Equal(rtt))
 				Expect(handler.ackAlarm.Sub(now)).To(Equal(rtt / 8))
@@ -198,6 +209,43 @@ var _ = Describe("receivedPacketHandler", func() {
 				Expect(ack.HasMissingRanges()).To(BeTrue())
 				Expect(ack).ToNot(BeNil())
 			})
+
+			Context("using an ACK policy", func() {
+				It("uses the max ACK delay", func() {
+					handler = NewReceivedPacketHandler(rttStats, &AckPolicy{MaxAckDelay: 50 * time.Millisecond}, protocol.VersionWhatever).(*receivedPacketHandler)
+					receiveAndAck10Packets()
+					rcvTime := time.Now()
+					Expect(handler.ReceivedPacket(11, protocol.ECNNon, rcvTime, true)).To(Succeed())
+					Expect(handler.ackQueued).To(BeFalse())
+					Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(50 * time.Millisecond)))
+				})
+
+				It("queues an ACK for the configured number of packets, without ACK decimation", func() {
+					handler = NewReceivedPacketHandler(rttStats, &AckPolicy{PacketsPerAck: 4}, protocol.VersionWhatever).(*receivedPacketHandler)
+					receiveAndAckPacketsUntilAckDecimation()
+					rcvTime := time.Now()
+					p := protocol.PacketNumber(minReceivedBeforeAckDecimation + 1)
+					for i := 0; i < 3; i++ {
+						Expect(handler.ReceivedPacket(p, protocol.ECNNon, rcvTime, true)).To(Succeed())
+						Expect(handler.ackQueued).To(BeFalse())
+						p++
+					}
+					Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(protocol.DefaultMaxAckDelay)))
+					Expect(handler.ReceivedPacket(p, protocol.ECNNon, rcvTime, true)).To(Succeed())
+					Expect(handler.ackQueued).To(BeTrue())
+					Expect(handler.GetAlarmTimeout()).To(BeZero())
+				})
+
+				It("queues an ACK immediately when a packet number is skipped", func() {
+					handler = NewReceivedPacketHandler(rttStats, &AckPolicy{ImmediateAckOnReordering: true}, protocol.VersionWhatever).(*receivedPacketHandler)
+					receiveAndAck10Packets()
+					Expect(handler.ReceivedPacket(11, protocol.ECNNon, time.Now(), true)).To(Succeed())
+					Expect(handler.ackQueued).To(BeFalse())
+					Expect(handler.ReceivedPacket(13, protocol.ECNNon, time.Now(), true)).To(Succeed())
+					Expect(handler.ackQueued).To(BeTrue())
+				})
+
+			})
 		})
 
 		Context("ACK generation", func() {
@@ -206,9 +254,9 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates a simple ACK frame", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(2, time.Time{}, true)
+				err = handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -217,8 +265,35 @@ var _ = Describe("receivedPacketHandler", func() {
 				Expect(ack.HasMissingRanges()).To(BeFalse())
 			})
 
+			It("reports the ECN counts", func() {
+				Expect(handler.ReceivedPacket(1, protocol.ECT0, time.Time{}, true)).To(Succeed())
+				Expect(handler.ReceivedPacket(2, protocol.ECT0, time.Time{}, true)).To(Succeed())
+				Expect(handler.ReceivedPacket(3, protocol.ECT1, time.Time{}, true)).To(Succeed())
+				Expect(handler.ReceivedPacket(4, protocol.ECNCE, time.Time{}, true)).To(Succeed())
+				Expect(handler.ReceivedPacket(5, protocol.ECNNon, time.Time{}, true)).To(Succeed())
+				ack := handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.ECT0).To(BeEquivalentTo(2))
+				Expect(ack.ECT1).To(BeEquivalentTo(1))
+				Expect(ack.ECNCE).To(BeEquivalentTo(1))
+				// the counts are cumulative
+				Expect(handler.ReceivedPacket(6, protocol.ECT0, time.Time{}, true)).To(Succeed())
+				handler.ackQueued = true
+				ack = handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.ECT0).To(BeEquivalentTo(3))
+				Expect(ack.ECNCE).To(BeEquivalentTo(1))
+			})
+
+			It("doesn't report ECN counts if no packets were marked", func() {
+				Expect(handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)).To(Succeed())
+				ack := handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.HasECN()).To(BeFalse())
+			})
+
 			It("generates an ACK for packet number 0", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, true)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -228,12 +303,12 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("saves the last sent ACK", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
 				Expect(handler.lastAck).To(Equal(ack))
-				err = handler.ReceivedPacket(2, time.Time{}, true)
+				err = handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = true
 				ack = handler.GetAckFrame()
@@ -242,9 +317,9 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK frame with missing packets", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(4, time.Time{}, true)
+				err = handler.ReceivedPacket(4, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -257,11 +332,11 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK for packet number 0 and other packets", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, true)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(1, time.Time{}, true)
+				err = handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(3, time.Time{}, true)
+				err = handler.ReceivedPacket(3, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -275,15 +350,15 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("accepts packets below the lower limit", func() {
 				handler.IgnoreBelow(6)
-				err := handler.ReceivedPacket(2, time.Time{}, true)
+				err := handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 			})
 
 			It("doesn't add delayed packets to the packetHistory", func() {
 				handler.IgnoreBelow(7)
-				err := handler.ReceivedPacket(4, time.Time{}, true)
+				err := handler.ReceivedPacket(4, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(10, time.Time{}, true)
+				err = handler.ReceivedPacket(10, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -293,7 +368,7 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("deletes packets from the packetHistory when a lower limit is set", func() {
 				for i := 1; i <= 12; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				handler.IgnoreBelow(7)
@@ -305,10 +380,23 @@ var _ = Describe("receivedPacketHandler", func() {
 				Expect(ack.HasMissingRanges()).To(BeFalse())
 			})
 
+			It("doesn't decrease the lower limit", func() {
+				handler.IgnoreBelow(7)
+				handler.IgnoreBelow(5)
+				Expect(handler.ignoreBelow).To(Equal(protocol.PacketNumber(7)))
+				err := handler.ReceivedPacket(6, protocol.ECNNon, time.Time{}, true)
+				Expect(err).ToNot(HaveOccurred())
+				err = handler.ReceivedPacket(10, protocol.ECNNon, time.Time{}, true)
+				Expect(err).ToNot(HaveOccurred())
+				ack := handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.LowestAcked()).To(Equal(protocol.PacketNumber(10)))
+			})
+
 			// TODO: remove this test when dropping support for STOP_WAITINGs
 			It("handles a lower limit of 0", func() {
 				handler.IgnoreBelow(0)
-				err := handler.ReceivedPacket(1337, time.Time{}, true)
+				err := handler.ReceivedPacket(1337, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -316,7 +404,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("resets all counters needed for the ACK queueing decision when sending an ACK", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackAlarm = time.Now().Add(-time.Minute)
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -327,7 +415,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("doesn't generate an ACK when none is queued and the timer is not set", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Time{}
@@ -335,7 +423,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("doesn't generate an ACK when none is queued and the timer has not yet expired", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Now().Add(time.Minute)
@@ -343,7 +431,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK when the timer has expired", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Now().Add(-time.Minute)
@@ -1,8 +1,8 @@
 package ackhandler
 
 import (
+	"errors"
 	"fmt"
-	"math"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/congestion"
@@ -13,9 +13,6 @@ import (
 )
 
 const (
-	// Maximum reordering in time space before time based loss detection considers a packet lost.
-	// In fraction of an RTT.
-	timeReorderingFraction = 1.0 / 8
 	// The default RTT used before an RTT sample is taken.
 	// Note: This constant is also defined in the congestion package.
 	defaultInitialRTT = 100 * time.Millisecond
@@ -36,8 +33,8 @@ type sentPacketHandler struct {
 	lastSentRetransmittablePacketTime time.Time
 	lastSentHandshakePacketTime       time.Time
 
-	nextPacketSendTime time.Time
-	skippedPackets     []protocol.PacketNumber
+	pacer          *congestion.Pacer
+	skippedPackets []protocol.PacketNumber
 
 	largestAcked                 protocol.PacketNumber
 	largestReceivedPacketWithAck protocol.PacketNumber
@@ -54,10 +51,31 @@ type sentPacketHandler struct {
 
 	bytesInFlight protocol.ByteCount
 
-	congestion congestion.SendAlgorithm
-	rttStats   *congestion.RTTStats
+	// the highest number of CE marked packets reported by the peer
+	ecnCECount uint64
+
+	congestion        congestion.Controller
+	onCongestionEvent congestion.EventHandler
+	rttStats          *congestion.RTTStats
+	// the maximum time that the peer delays sending ACKs
+	maxAckDelay time.Duration
+
+	goodput goodputEstimator
+	rack    *rackDetector
+
+	numLostPackets          uint64
+	numRetransmittedPackets uint64
+	// the congestion window, as of the last call to SendMode
+	congestionWindow protocol.ByteCount
+	stats            statsTracker
 
 	handshakeComplete bool
+	// amplificationLimited is set until the handshake completes, if the peer's address was not validated.
+	// Then bytesSent can be at most protocol.AmplificationFactor times bytesReceived.
+	amplificationLimited bool
+	bytesReceived        protocol.ByteCount
+	bytesSent            protocol.ByteCount
+
 	// The number of times the handshake packets have been retransmitted without receiving an ack.
 	handshakeCount uint32
 
@@ -76,26 +94,52 @@ type sentPacketHandler struct {
 	// The alarm timeout
 	alarm time.Time
 
+	tracer SentPacketTracer // nil if neither qlog nor a Tracer is used
 	logger utils.Logger
 }
 
 // NewSentPacketHandler creates a new sentPacketHandler
-func NewSentPacketHandler(rttStats *congestion.RTTStats, logger utils.Logger) SentPacketHandler {
-	congestion := congestion.NewCubicSender(
-		congestion.DefaultClock{},
-		rttStats,
-		false, /* don't use reno since chromium doesn't (why?) */
-		protocol.InitialCongestionWindow,
-		protocol.DefaultMaxCongestionWindow,
-	)
-
-	return &sentPacketHandler{
+// If controller is nil, the Cubic congestion controller is used.
+// If pacer is nil, a Pacer using the default burst size is used.
+// onCongestionEvent is called when the Cubic congestion controller changes its state. It may be nil.
+func NewSentPacketHandler(
+	rttStats *congestion.RTTStats,
+	controller congestion.Controller,
+	pacer *congestion.Pacer,
+	onCongestionEvent congestion.EventHandler,
+	tracer SentPacketTracer,
+	logger utils.Logger,
+) SentPacketHandler {
+	h := &sentPacketHandler{
 		packetHistory:      newSentPacketHistory(),
 		stopWaitingManager: stopWaitingManager{},
 		rttStats:           rttStats,
-		congestion:         congestion,
+		congestion:         controller,
+		pacer:              pacer,
+		rack:               newRACKDetector(),
+		maxAckDelay:        protocol.DefaultMaxAckDelay,
+		onCongestionEvent:  onCongestionEvent,
+		tracer:             tracer,
 		logger:             logger,
 	}
+	if h.congestion == nil {
+		h.congestion = h.newCubicSender()
+	}
+	if h.pacer == nil {
+		h.pacer = congestion.NewPacer(0, 0)
+	}
+	return h
+}
+
+func (h *sentPacketHandler) newCubicSender() congestion.Controller {
+	return congestion.NewCubicSender(
+		congestion.DefaultClock{},
+		h.rttStats,
+		false, /* don't use reno since chromium doesn't (why?) */
+		protocol.InitialCongestionWindow,
+		protocol.DefaultMaxCongestionWindow,
+		h.onCongestionEvent,
+	)
 }
 
 func (h *sentPacketHandler) lowestUnacked() protocol.PacketNumber {
@@ -124,13 +168,74 @@ func (h *sentPacketHandler) SetHandshakeComplete() {
 	}
 	h.retransmissionQueue = queue
 	h.handshakeComplete = true
+	h.amplificationLimited = false
+	h.updateStats()
+}
+
+// SentPacketHandlerState is the state of a SentPacketHandler that has no outstanding packets.
+// It is used to continue a connection in another process.
+type SentPacketHandlerState struct {
+	LastSentPacketNumber          protocol.PacketNumber
+	LargestAcked                  protocol.PacketNumber
+	LargestReceivedPacketWithAck  protocol.PacketNumber
+	LowestPacketNotConfirmedAcked protocol.PacketNumber
+}
+
+var errOutstandingPackets = errors.New("SentPacketHandler: can't export the state while packets are outstanding")
+
+func (h *sentPacketHandler) ExportState() (SentPacketHandlerState, error) {
+	if h.packetHistory.Len() > 0 || len(h.retransmissionQueue) > 0 {
+		return SentPacketHandlerState{}, errOutstandingPackets
+	}
+	return SentPacketHandlerState{
+		LastSentPacketNumber:          h.lastSentPacketNumber,
+		LargestAcked:                  h.largestAcked,
+		LargestReceivedPacketWithAck:  h.largestReceivedPacketWithAck,
+		LowestPacketNotConfirmedAcked: h.lowestPacketNotConfirmedAcked,
+	}, nil
+}
+
+func (h *sentPacketHandler) ImportState(s SentPacketHandlerState) {
+	h.lastSentPacketNumber = s.LastSentPacketNumber
+	h.largestAcked = s.LargestAcked
+	h.largestReceivedPacketWithAck = s.LargestReceivedPacketWithAck
+	h.lowestPacketNotConfirmedAcked = s.LowestPacketNotConfirmedAcked
+}
+
+func (h *sentPacketHandler) LimitAmplification() {
+	h.amplificationLimited = true
+	h.updateStats()
+}
+
+func (h *sentPacketHandler) ReceivedBytes(n protocol.ByteCount) {
+	wasLimited := h.isAmplificationLimited()
+	h.bytesReceived += n
+	// the alarm is not set while we're amplification limited
+	if wasLimited && !h.isAmplificationLimited() {
+		h.updateLossDetectionAlarm()
+	}
+	if h.amplificationLimited {
+		h.updateStats()
+	}
+}
+
+// isAmplificationLimited says if the anti-amplification limit was reached.
+// Since this is checked before a packet is sent, the limit might be exceeded by up to one packet.
+func (h *sentPacketHandler) isAmplificationLimited() bool {
+	return h.amplificationLimited && h.bytesSent >= protocol.AmplificationFactor*h.bytesReceived
 }
 
 func (h *sentPacketHandler) SentPacket(packet *Packet) {
+	if packet.ContainsRetransmission {
+		h.numRetransmittedPackets++
+	}
 	if isRetransmittable := h.sentPacketImpl(packet); isRetransmittable {
 		h.packetHistory.SentPacket(packet)
 		h.updateLossDetectionAlarm()
+	} else if h.isAmplificationLimited() {
+		h.updateLossDetectionAlarm()
 	}
+	h.updateStats()
 }
 
 func (h *sentPacketHandler) SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber) {
@@ -142,6 +247,8 @@ func (h *sentPacketHandler) SentPacketsAsRetransmission(packets []*Packet, retra
 	}
 	h.packetHistory.SentPacketsAsRetransmission(p, retransmissionOf)
 	h.updateLossDetectionAlarm()
+	h.numRetransmittedPackets += uint64(len(packets))
+	h.updateStats()
 }
 
 func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmittable */ {
@@ -153,6 +260,7 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmitt
 	}
 
 	h.lastSentPacketNumber = packet.PacketNumber
+	h.bytesSent += packet.Length
 
 	if len(packet.Frames) > 0 {
 		if ackFrame, ok := packet.Frames[0].(*wire.AckFrame); ok {
@@ -171,6 +279,9 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmitt
 		packet.includedInBytesInFlight = true
 		h.bytesInFlight += packet.Length
 		packet.canBeRetransmitted = true
+		if streamDataLen(packet.Frames) > 0 {
+			h.goodput.SentStreamData(packet.SendTime)
+		}
 		if h.numRTOs > 0 {
 			h.numRTOs--
 		}
@@ -178,7 +289,8 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmitt
 	}
 	h.congestion.OnPacketSent(packet.SendTime, h.bytesInFlight, packet.PacketNumber, packet.Length, isRetransmittable)
 
-	h.nextPacketSendTime = utils.MaxTime(h.nextPacketSendTime, packet.SendTime).Add(h.congestion.TimeUntilSend(h.bytesInFlight))
+	h.pacer.SentPacket(packet.SendTime, packet.Length)
+	h.pacer.SetRate(h.pacingRate())
 	return isRetransmittable
 }
 
@@ -208,6 +320,7 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 	if err != nil {
 		return err
 	}
+	h.rack.DetectSpuriousLosses(ackFrame)
 
 	priorInFlight := h.bytesInFlight
 	for _, p := range ackedPackets {
@@ -220,7 +333,8 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 		if p.largestAcked != 0 {
 			h.lowestPacketNotConfirmedAcked = utils.MaxPacketNumber(h.lowestPacketNotConfirmedAcked, p.largestAcked+1)
 		}
-		if err := h.onPacketAcked(p); err != nil {
+		h.rack.OnPacketAcked(p, rcvTime)
+		if err := h.onPacketAcked(p, rcvTime); err != nil {
 			return err
 		}
 		if p.includedInBytesInFlight {
@@ -228,13 +342,28 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 		}
 	}
 
+	// An increase of the CE count means that packets have experienced congestion on the path.
+	// This is treated like the loss of the largest acknowledged packet,
+	// so the congestion controller only reduces its window once per round trip.
+	if ackFrame.ECNCE > h.ecnCECount {
+		h.ecnCECount = ackFrame.ECNCE
+		if len(ackedPackets) > 0 {
+			h.logger.Debugf("\tPeer reported %d CE marked packets", ackFrame.ECNCE)
+			h.congestion.OnPacketLost(largestAcked, 0, priorInFlight)
+		}
+	}
+
 	if err := h.detectLostPackets(rcvTime, priorInFlight); err != nil {
 		return err
 	}
+	if h.tracer != nil {
+		h.tracer.UpdatedMetrics(rcvTime, h.rttStats, h.congestion.GetCongestionWindow(), h.bytesInFlight)
+	}
 	h.updateLossDetectionAlarm()
 
 	h.garbageCollectSkippedPackets()
 	h.stopWaitingManager.ReceivedAck(ackFrame)
+	h.updateStats()
 
 	return nil
 }
@@ -294,6 +423,12 @@ func (h *sentPacketHandler) updateLossDetectionAlarm() {
 		h.alarm = time.Time{}
 		return
 	}
+	// Retransmissions can't be sent when we're amplification limited.
+	// The alarm is set again when we receive more data from the peer.
+	if h.isAmplificationLimited() {
+		h.alarm = time.Time{}
+		return
+	}
 
 	if !h.handshakeComplete {
 		h.alarm = h.lastSentHandshakePacketTime.Add(h.computeHandshakeTimeout())
@@ -315,32 +450,44 @@ func (h *sentPacketHandler) updateLossDetectionAlarm() {
 func (h *sentPacketHandler) detectLostPackets(now time.Time, priorInFlight protocol.ByteCount) error {
 	h.lossTime = time.Time{}
 
-	maxRTT := float64(utils.MaxDuration(h.rttStats.LatestRTT(), h.rttStats.SmoothedRTT()))
-	delayUntilLost := time.Duration((1.0 + timeReorderingFraction) * maxRTT)
+	reorderingWindow := h.rack.ReorderingWindow(h.rttStats.MinRTT(), h.rttStats.SmoothedRTT())
 
 	var lostPackets []*Packet
 	h.packetHistory.Iterate(func(packet *Packet) (bool, error) {
-		if packet.PacketNumber > h.largestAcked {
+		delay, ok := h.rack.LossDelay(packet, reorderingWindow, now)
+		if !ok {
+			// This packet was sent after the most recently sent packet that was acknowledged.
 			return false, nil
 		}
-
-		timeSinceSent := now.Sub(packet.SendTime)
-		if timeSinceSent > delayUntilLost {
+		if delay <= 0 {
 			lostPackets = append(lostPackets, packet)
 		} else if h.lossTime.IsZero() {
 			// Note: This conditional is only entered once per call
-			h.lossTime = now.Add(delayUntilLost - timeSinceSent)
+			h.lossTime = now.Add(delay)
 		}
 		return true, nil
 	})
 
+	if len(lostPackets) > 0 {
+		h.rack.OnLossRecovery()
+	}
 	for _, p := range lostPackets {
+		h.rack.OnPacketLost(p.PacketNumber)
+		if !p.IsPathMTUProbePacket {
+			h.numLostPackets++
+		}
+		if h.tracer != nil {
+			h.tracer.LostPacket(now, p.PacketType, p.EncryptionLevel, p.PacketNumber)
+		}
 		// the bytes in flight need to be reduced no matter if this packet will be retransmitted
 		if p.includedInBytesInFlight {
 			h.bytesInFlight -= p.Length
-			h.congestion.OnPacketLost(p.PacketNumber, p.Length, priorInFlight)
+			if !p.IsPathMTUProbePacket {
+				h.congestion.OnPacketLost(p.PacketNumber, p.Length, priorInFlight)
+			}
 		}
-		if p.canBeRetransmitted {
+		// a lost MTU probe only tells us that the path doesn't support packets of that size
+		if p.canBeRetransmitted && !p.IsPathMTUProbePacket {
 			// queue the packet for retransmission, and report the loss to the congestion controller
 			h.logger.Debugf("\tQueueing packet %#x because it was detected lost", p.PacketNumber)
 			if err := h.queuePacketForRetransmission(p); err != nil {
@@ -375,6 +522,7 @@ func (h *sentPacketHandler) OnAlarm() error {
 		return err
 	}
 	h.updateLossDetectionAlarm()
+	h.updateStats()
 	return nil
 }
 
@@ -382,7 +530,7 @@ func (h *sentPacketHandler) GetAlarmTimeout() time.Time {
 	return h.alarm
 }
 
-func (h *sentPacketHandler) onPacketAcked(p *Packet) error {
+func (h *sentPacketHandler) onPacketAcked(p *Packet, rcvTime time.Time) error {
 	// This happens if a packet and its retransmissions is acked in the same ACK.
 	// As soon as we process the first one, this will remove all the retransmissions,
 	// so we won't find the retransmitted packet number later.
@@ -393,9 +541,12 @@ func (h *sentPacketHandler) onPacketAcked(p *Packet) error {
 	// only report the acking of this packet to the congestion controller if:
 	// * it is a retransmittable packet
 	// * this packet wasn't retransmitted yet
+	originalAcked := false
 	if p.isRetransmission {
 		// that the parent doesn't exist is expected to happen every time the original packet was already acked
-		if parent := h.packetHistory.GetPacket(p.retransmissionOf); parent != nil {
+		parent := h.packetHistory.GetPacket(p.retransmissionOf)
+		originalAcked = parent == nil
+		if parent != nil {
 			if len(parent.retransmittedAs) == 1 {
 				parent.retransmittedAs = nil
 			} else {
@@ -414,6 +565,12 @@ func (h *sentPacketHandler) onPacketAcked(p *Packet) error {
 	if p.includedInBytesInFlight {
 		h.bytesInFlight -= p.Length
 	}
+	// if the original packet was already acked, the STREAM data was already accounted for
+	if !originalAcked {
+		if n := streamDataLen(p.Frames); n > 0 {
+			h.goodput.AckedStreamData(n, rcvTime)
+		}
+	}
 	if h.rtoCount > 0 {
 		h.verifyRTO(p.PacketNumber)
 	}
@@ -426,6 +583,69 @@ func (h *sentPacketHandler) onPacketAcked(p *Packet) error {
 	return h.packetHistory.Remove(p.PacketNumber)
 }
 
+func (h *sentPacketHandler) OnConnectionMigration(controller congestion.Controller) {
+	// The RTT and the available bandwidth of the new path are unknown.
+	h.rttStats.OnConnectionMigration()
+	if controller == nil {
+		controller = h.newCubicSender()
+	}
+	h.congestion = controller
+	h.pacer.Reset()
+	h.updateStats()
+}
+
+func (h *sentPacketHandler) SetMaxAckDelay(d time.Duration) {
+	h.maxAckDelay = d
+}
+
+func (h *sentPacketHandler) GetGoodput(now time.Time) congestion.Bandwidth {
+	return h.goodput.Goodput(now)
+}
+
+func (h *sentPacketHandler) GetStats() Stats {
+	return h.stats.Get()
+}
+
+// updateStats updates the snapshot returned by GetStats.
+// It must be called every time the RTT, the congestion window or the bytes in flight might have changed.
+// The congestion window is only read from the congestion controller in SendMode, which is called before sending every packet.
+func (h *sentPacketHandler) updateStats() {
+	h.stats.Update(Stats{
+		LatestRTT:            h.rttStats.LatestRTT(),
+		SmoothedRTT:          h.rttStats.SmoothedRTT(),
+		MinRTT:               h.rttStats.MinRTT(),
+		RTTVariance:          h.rttStats.MeanDeviation(),
+		CongestionWindow:     h.congestionWindow,
+		BytesInFlight:        h.bytesInFlight,
+		BandwidthEstimate:    h.bandwidthEstimate(),
+		PacketsLost:          h.numLostPackets,
+		PacketsRetransmitted: h.numRetransmittedPackets,
+		AmplificationLimited: h.amplificationLimited,
+		AmplificationBudget:  h.amplificationBudget(),
+	})
+}
+
+// amplificationBudget returns the number of bytes that can be sent before the anti-amplification limit is reached.
+func (h *sentPacketHandler) amplificationBudget() protocol.ByteCount {
+	if !h.amplificationLimited || h.isAmplificationLimited() {
+		return 0
+	}
+	return protocol.AmplificationFactor*h.bytesReceived - h.bytesSent
+}
+
+// bandwidthEstimate returns the estimate of the congestion controller, if it provides one.
+// Otherwise, the bandwidth is estimated as one congestion window per smoothed RTT.
+func (h *sentPacketHandler) bandwidthEstimate() congestion.Bandwidth {
+	if e, ok := h.congestion.(congestion.BandwidthEstimator); ok {
+		return e.BandwidthEstimate()
+	}
+	srtt := h.rttStats.SmoothedRTT()
+	if srtt == 0 {
+		return 0
+	}
+	return congestion.BandwidthFromDelta(h.congestionWindow, srtt)
+}
+
 func (h *sentPacketHandler) stopRetransmissionsFor(p *Packet) error {
 	if err := h.packetHistory.MarkCannotBeRetransmitted(p.PacketNumber); err != nil {
 		return err
@@ -483,6 +703,10 @@ func (h *sentPacketHandler) SendMode() SendMode {
 		h.logger.Debugf("Limited by the number of tracked packets: tracking %d packets, maximum %d", numTrackedPackets, protocol.MaxTrackedSentPackets)
 		return SendNone
 	}
+	if h.isAmplificationLimited() {
+		h.logger.Debugf("Amplification limited: sent %d bytes, received %d bytes", h.bytesSent, h.bytesReceived)
+		return SendNone
+	}
 	if h.allowTLP {
 		return SendTLP
 	}
@@ -490,7 +714,12 @@ func (h *sentPacketHandler) SendMode() SendMode {
 		return SendRTO
 	}
 	// Only send ACKs if we're congestion limited.
-	if cwnd := h.congestion.GetCongestionWindow(); h.bytesInFlight > cwnd {
+	cwnd := h.congestion.GetCongestionWindow()
+	if cwnd != h.congestionWindow {
+		h.congestionWindow = cwnd
+		h.updateStats()
+	}
+	if h.bytesInFlight > cwnd {
 		h.logger.Debugf("Congestion limited: bytes in flight %d, window %d", h.bytesInFlight, cwnd)
 		return SendAck
 	}
@@ -506,7 +735,7 @@ func (h *sentPacketHandler) SendMode() SendMode {
 }
 
 func (h *sentPacketHandler) TimeUntilSend() time.Time {
-	return h.nextPacketSendTime
+	return h.pacer.TimeUntilSend()
 }
 
 func (h *sentPacketHandler) ShouldSendNumPackets() int {
@@ -514,11 +743,22 @@ func (h *sentPacketHandler) ShouldSendNumPackets() int {
 		// RTO probes should not be paced, but must be sent immediately.
 		return h.numRTOs
 	}
+	return utils.Max(int(h.pacer.Budget(time.Now())/protocol.DefaultTCPMSS), 1)
+}
+
+// pacingRate derives the pacing rate from the time it takes to send a full-sized packet.
+// For the Cubic sender, this time depends on the congestion window and the RTT. BBR uses its pacing rate.
+// It returns 0 if the congestion controller doesn't pace packets at the moment.
+func (h *sentPacketHandler) pacingRate() congestion.Bandwidth {
 	delay := h.congestion.TimeUntilSend(h.bytesInFlight)
-	if delay == 0 || delay > protocol.MinPacingDelay {
-		return 1
+	if delay == 0 {
+		return 0
+	}
+	// make sure that very low pacing rates are not rounded to 0, which would disable pacing
+	if rate := congestion.BandwidthFromDelta(protocol.DefaultTCPMSS, delay); rate > 0 {
+		return rate
 	}
-	return int(math.Ceil(float64(protocol.MinPacingDelay) / float64(delay)))
+	return congestion.BitsPerSecond
 }
 
 // retransmit the oldest two packets
@@ -579,12 +819,11 @@ func (h *sentPacketHandler) computeHandshakeTimeout() time.Duration {
 }
 
 func (h *sentPacketHandler) computeTLPTimeout() time.Duration {
-	// TODO(#1236): include the max_ack_delay
 	srtt := h.rttStats.SmoothedRTT()
 	if srtt == 0 {
 		srtt = defaultInitialRTT
 	}
-	return utils.MaxDuration(srtt*3/2, minTPLTimeout)
+	return utils.MaxDuration(srtt*3/2+h.maxAckDelay, minTPLTimeout)
 }
 
 func (h *sentPacketHandler) computeRTOTimeout() time.Duration {
@@ -593,7 +832,7 @@ func (h *sentPacketHandler) computeRTOTimeout() time.Duration {
 	if rtt == 0 {
 		rto = defaultRTOTimeout
 	} else {
-		rto = rtt + 4*h.rttStats.MeanDeviation()
+		rto = rtt + 4*h.rttStats.MeanDeviation() + h.maxAckDelay
 	}
 	rto = utils.MaxDuration(rto, minRTOTimeout)
 	// Exponential backoff
@@ -41,6 +41,13 @@ func handshakePacket(p *Packet) *Packet {
 	return p
 }
 
+type bandwidthEstimatingController struct {
+	congestion.SendAlgorithm
+	bandwidth congestion.Bandwidth
+}
+
+func (c *bandwidthEstimatingController) BandwidthEstimate() congestion.Bandwidth { return c.bandwidth }
+
 var _ = Describe("SentPacketHandler", func() {
 	var (
 		handler     *sentPacketHandler
@@ -49,7 +56,7 @@ var _ = Describe("SentPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats := &congestion.RTTStats{}
-		handler = NewSentPacketHandler(rttStats, utils.DefaultLogger).(*sentPacketHandler)
+		handler = NewSentPacketHandler(rttStats, nil, nil, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
 		handler.SetHandshakeComplete()
 		streamFrame = wire.StreamFrame{
 			StreamID: 5,
@@ -226,10 +233,12 @@ var _ = Describe("SentPacketHandler", func() {
 
 	Context("ACK processing", func() {
 		BeforeEach(func() {
+			// Send the packets an hour ago, and increase RTT, because the tests would be flaky otherwise.
+			// Packets are only declared lost if the reordering window (a fraction of the minimum RTT) passed.
+			sendTime := time.Now().Add(-time.Hour)
 			for i := protocol.PacketNumber(0); i < 10; i++ {
-				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i}))
+				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i, SendTime: sendTime.Add(time.Duration(i) * time.Microsecond)}))
 			}
-			// Increase RTT, because the tests would be flaky otherwise
 			updateRTT(time.Hour)
 			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(10)))
 		})
@@ -517,6 +526,124 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("goodput", func() {
+		streamPacket := func(pn protocol.PacketNumber, dataLen int) *Packet {
+			p := retransmittablePacket(&Packet{PacketNumber: pn})
+			p.Frames = []wire.Frame{&wire.StreamFrame{StreamID: 5, Data: make([]byte, dataLen)}}
+			return p
+		}
+
+		It("counts acknowledged STREAM data", func() {
+			handler.SentPacket(streamPacket(1, 100))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
+			handler.SentPacket(streamPacket(3, 200))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 3}}}
+			err := handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(handler.goodput.bytesInWindow).To(Equal(protocol.ByteCount(300)))
+			Expect(handler.GetGoodput(time.Now())).ToNot(BeZero())
+		})
+
+		It("doesn't count STREAM data twice, if the original packet and the retransmission are acknowledged", func() {
+			handler.SentPacket(streamPacket(5, 100))
+			losePacket(5)
+			handler.SentPacketsAsRetransmission([]*Packet{streamPacket(6, 100)}, 5)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 5}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 6}}}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.goodput.bytesInWindow).To(Equal(protocol.ByteCount(100)))
+		})
+	})
+
+	Context("stats", func() {
+		It("reports the congestion window, when the send mode is determined", func() {
+			Expect(handler.GetStats().CongestionWindow).To(BeZero())
+			Expect(handler.SendMode()).To(Equal(SendAny))
+			stats := handler.GetStats()
+			Expect(stats.CongestionWindow).To(Equal(handler.congestion.GetCongestionWindow()))
+			Expect(stats.CongestionWindow).ToNot(BeZero())
+			Expect(stats.BytesInFlight).To(BeZero())
+		})
+
+		It("reports the bytes in flight", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, Length: 100, SendTime: time.Now()}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, Length: 200, SendTime: time.Now()}))
+			Expect(handler.GetStats().BytesInFlight).To(Equal(protocol.ByteCount(300)))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.GetStats().BytesInFlight).To(Equal(protocol.ByteCount(200)))
+		})
+
+		It("reports the RTT", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Second)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Second / 2)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(handler.GetStats().SmoothedRTT).To(Equal(time.Second))
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			stats := handler.GetStats()
+			Expect(stats.SmoothedRTT).To(Equal(handler.rttStats.SmoothedRTT()))
+			Expect(stats.RTTVariance).To(Equal(handler.rttStats.MeanDeviation()))
+			Expect(stats.RTTVariance).ToNot(BeZero())
+			Expect(stats.LatestRTT).To(Equal(time.Second / 2))
+			Expect(stats.MinRTT).To(Equal(time.Second / 2))
+		})
+
+		It("reports the bandwidth estimate of the congestion controller", func() {
+			cong := mocks.NewMockSendAlgorithm(mockCtrl)
+			handler.congestion = &bandwidthEstimatingController{SendAlgorithm: cong, bandwidth: 1337 * congestion.BytesPerSecond}
+			cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(10000))
+			Expect(handler.SendMode()).To(Equal(SendAny))
+			Expect(handler.GetStats().BandwidthEstimate).To(Equal(1337 * congestion.BytesPerSecond))
+		})
+
+		It("estimates the bandwidth from the congestion window, if the congestion controller doesn't provide an estimate", func() {
+			cong := mocks.NewMockSendAlgorithm(mockCtrl)
+			handler.congestion = cong
+			cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(10000))
+			handler.rttStats.UpdateRTT(100*time.Millisecond, 0, time.Now())
+			Expect(handler.SendMode()).To(Equal(SendAny))
+			Expect(handler.GetStats().BandwidthEstimate).To(Equal(100000 * congestion.BytesPerSecond))
+		})
+
+		It("counts lost packets, but not lost path MTU probe packets", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Hour)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Hour), IsPathMTUProbePacket: true}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3, SendTime: now.Add(-time.Second)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 3, Largest: 3}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(handler.GetStats().PacketsLost).To(BeEquivalentTo(1))
+		})
+
+		It("counts retransmitted packets", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 5}))
+			losePacket(5)
+			handler.SentPacketsAsRetransmission([]*Packet{
+				retransmittablePacket(&Packet{PacketNumber: 6}),
+				retransmittablePacket(&Packet{PacketNumber: 7}),
+			}, 5)
+			Expect(handler.GetStats().PacketsRetransmitted).To(BeEquivalentTo(2))
+		})
+
+		It("counts packets that contain frames of lost packets", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 5}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 6, ContainsRetransmission: true}))
+			Expect(handler.GetStats().PacketsRetransmitted).To(BeEquivalentTo(1))
+		})
+
+		It("resets the RTT on connection migration", func() {
+			updateRTT(time.Second)
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1}))
+			Expect(handler.GetStats().SmoothedRTT).To(Equal(time.Second))
+			handler.OnConnectionMigration(nil)
+			Expect(handler.GetStats().SmoothedRTT).To(BeZero())
+		})
+	})
+
 	Context("Retransmission handling", func() {
 		It("does not dequeue a packet if no ack has been received", func() {
 			handler.SentPacket(&Packet{PacketNumber: 1})
@@ -550,6 +677,23 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.congestion = cong
 		})
 
+		It("uses the Cubic congestion controller by default", func() {
+			h := NewSentPacketHandler(&congestion.RTTStats{}, nil, nil, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
+			Expect(h.congestion).To(BeAssignableToTypeOf(congestion.NewCubicSender(congestion.DefaultClock{}, &congestion.RTTStats{}, false, 1, 2, nil)))
+		})
+
+		It("uses a custom congestion controller", func() {
+			h := NewSentPacketHandler(&congestion.RTTStats{}, cong, nil, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
+			Expect(h.congestion).To(Equal(cong))
+			cong.EXPECT().OnPacketSent(gomock.Any(), protocol.ByteCount(42), protocol.PacketNumber(1), protocol.ByteCount(42), true)
+			cong.EXPECT().TimeUntilSend(gomock.Any())
+			h.SentPacket(&Packet{
+				PacketNumber: 1,
+				Length:       42,
+				Frames:       []wire.Frame{&wire.PingFrame{}},
+			})
+		})
+
 		It("should call OnSent", func() {
 			cong.EXPECT().OnPacketSent(
 				gomock.Any(),
@@ -671,6 +815,20 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("doesn't call OnPacketLost when a path MTU probe packet is lost", func() {
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(2)
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour), IsPathMTUProbePacket: true}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
+			gomock.InOrder(
+				cong.EXPECT().MaybeExitSlowStart(),
+				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(2), protocol.ByteCount(1), protocol.ByteCount(2)),
+			)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.bytesInFlight).To(BeZero())
+		})
+
 		It("calls OnPacketAcked and OnPacketLost with the right bytes_in_flight value", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(4)
 			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(4)
@@ -698,6 +856,46 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("reports an increase of the CE count to the congestion controller", func() {
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(4)
+			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(4)
+			for i := protocol.PacketNumber(1); i <= 4; i++ {
+				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i}))
+			}
+			gomock.InOrder(
+				cong.EXPECT().MaybeExitSlowStart(),
+				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(1), protocol.ByteCount(1), protocol.ByteCount(4)),
+				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(2), protocol.ByteCount(1), protocol.ByteCount(4)),
+				cong.EXPECT().OnPacketLost(protocol.PacketNumber(2), protocol.ByteCount(0), protocol.ByteCount(4)),
+			)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}, ECT0: 1, ECNCE: 1}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			// the CE count didn't increase
+			gomock.InOrder(
+				cong.EXPECT().MaybeExitSlowStart(),
+				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(3), protocol.ByteCount(1), protocol.ByteCount(2)),
+			)
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 3}}, ECT0: 2, ECNCE: 1}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+		})
+
+		It("ignores an increase of the CE count in an ACK that doesn't acknowledge new packets", func() {
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(2)
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
+			gomock.InOrder(
+				cong.EXPECT().MaybeExitSlowStart(),
+				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(1), protocol.ByteCount(1), protocol.ByteCount(2)),
+			)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}, ECT0: 1}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			// don't EXPECT any further calls to the congestion controller
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}, ECT0: 1, ECNCE: 1}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ecnCECount).To(BeEquivalentTo(1))
+		})
+
 		It("only allows sending of ACKs when congestion limited", func() {
 			handler.bytesInFlight = 100
 			cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(200))
@@ -748,13 +946,17 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.SendMode()).To(Equal(SendRTO))
 		})
 
-		It("gets the pacing delay", func() {
+		It("paces packets", func() {
 			sendTime := time.Now().Add(-time.Minute)
-			handler.bytesInFlight = 100
-			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
-			cong.EXPECT().TimeUntilSend(protocol.ByteCount(100)).Return(time.Hour)
-			handler.SentPacket(&Packet{PacketNumber: 1, SendTime: sendTime})
-			Expect(handler.TimeUntilSend()).To(Equal(sendTime.Add(time.Hour)))
+			// the pacing rate is 1 full-sized packet per 10ms
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(protocol.DefaultMaxPacingBurst)
+			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(10 * time.Millisecond).Times(protocol.DefaultMaxPacingBurst)
+			for i := 1; i <= protocol.DefaultMaxPacingBurst; i++ {
+				// a burst can be sent immediately
+				Expect(handler.TimeUntilSend()).To(Or(BeZero(), Equal(sendTime)))
+				handler.SentPacket(&Packet{PacketNumber: protocol.PacketNumber(i), Length: protocol.DefaultTCPMSS, SendTime: sendTime})
+			}
+			Expect(handler.TimeUntilSend()).To(Equal(sendTime.Add(10 * time.Millisecond)))
 		})
 
 		It("allows sending of all RTO probe packets", func() {
@@ -762,38 +964,61 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.ShouldSendNumPackets()).To(Equal(5))
 		})
 
-		It("allows sending of one packet, if it should be sent immediately", func() {
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(time.Duration(0))
-			Expect(handler.ShouldSendNumPackets()).To(Equal(1))
+		It("allows sending of a burst of packets", func() {
+			Expect(handler.ShouldSendNumPackets()).To(Equal(protocol.DefaultMaxPacingBurst))
 		})
 
-		It("allows sending of multiple packets, if the pacing delay is smaller than the minimum", func() {
-			pacingDelay := protocol.MinPacingDelay / 10
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(pacingDelay)
-			Expect(handler.ShouldSendNumPackets()).To(Equal(10))
+		It("allows sending of one packet, if the budget is used up", func() {
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(time.Hour)
+			handler.SentPacket(&Packet{PacketNumber: 1, Length: protocol.DefaultMaxPacingBurst * protocol.DefaultTCPMSS, SendTime: time.Now()})
+			Expect(handler.ShouldSendNumPackets()).To(Equal(1))
 		})
 
-		It("allows sending of multiple packets, if the pacing delay is smaller than the minimum, and not a fraction", func() {
-			pacingDelay := protocol.MinPacingDelay * 2 / 5
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(pacingDelay)
+		It("allows sending of multiple packets, if the budget allows it", func() {
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(time.Millisecond)
+			handler.SentPacket(&Packet{PacketNumber: 1, Length: protocol.DefaultMaxPacingBurst * protocol.DefaultTCPMSS, SendTime: time.Now().Add(-3500 * time.Microsecond)})
 			Expect(handler.ShouldSendNumPackets()).To(Equal(3))
 		})
+
+		It("uses the pacer passed to the constructor", func() {
+			// 10 packets per second
+			pacer := congestion.NewPacer(congestion.BandwidthFromDelta(protocol.DefaultTCPMSS, 100*time.Millisecond), 2)
+			h := NewSentPacketHandler(&congestion.RTTStats{}, cong, pacer, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
+			Expect(h.ShouldSendNumPackets()).To(Equal(2))
+			sendTime := time.Now()
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+			// the congestion controller doesn't have a pacing rate yet
+			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(2)
+			h.SentPacket(&Packet{PacketNumber: 1, Length: protocol.DefaultTCPMSS, SendTime: sendTime})
+			h.SentPacket(&Packet{PacketNumber: 2, Length: protocol.DefaultTCPMSS, SendTime: sendTime})
+			Expect(h.TimeUntilSend()).To(Equal(sendTime.Add(100 * time.Millisecond)))
+		})
 	})
 
 	Context("TLPs", func() {
 		It("uses the default RTT", func() {
-			Expect(handler.computeTLPTimeout()).To(Equal(defaultInitialRTT * 3 / 2))
+			Expect(handler.computeTLPTimeout()).To(Equal(defaultInitialRTT*3/2 + protocol.DefaultMaxAckDelay))
 		})
 
 		It("uses the RTT from RTT stats", func() {
 			rtt := 2 * time.Second
 			updateRTT(rtt)
-			Expect(handler.computeTLPTimeout()).To(Equal(rtt * 3 / 2))
+			Expect(handler.computeTLPTimeout()).To(Equal(rtt*3/2 + protocol.DefaultMaxAckDelay))
+		})
+
+		It("uses the peer's max_ack_delay", func() {
+			rtt := 2 * time.Second
+			updateRTT(rtt)
+			handler.SetMaxAckDelay(100 * time.Millisecond)
+			Expect(handler.computeTLPTimeout()).To(Equal(rtt*3/2 + 100*time.Millisecond))
 		})
 
 		It("uses the minTLPTimeout for short RTTs", func() {
 			rtt := 2 * time.Microsecond
 			updateRTT(rtt)
+			handler.SetMaxAckDelay(time.Millisecond)
 			Expect(handler.computeTLPTimeout()).To(Equal(minTPLTimeout))
 		})
 
@@ -837,10 +1062,17 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.rttStats.UpdateRTT(rtt, 0, time.Now())
 			Expect(handler.rttStats.SmoothedRTT()).To(Equal(rtt))
 			Expect(handler.rttStats.MeanDeviation()).To(Equal(rtt / 2))
-			expected := rtt + rtt/2*4
+			expected := rtt + rtt/2*4 + protocol.DefaultMaxAckDelay
 			Expect(handler.computeRTOTimeout()).To(Equal(expected))
 		})
 
+		It("uses the peer's max_ack_delay", func() {
+			rtt := time.Second
+			handler.rttStats.UpdateRTT(rtt, 0, time.Now())
+			handler.SetMaxAckDelay(100 * time.Millisecond)
+			Expect(handler.computeRTOTimeout()).To(Equal(rtt + rtt/2*4 + 100*time.Millisecond))
+		})
+
 		It("limits RTO min", func() {
 			rtt := 3 * time.Millisecond
 			updateRTT(rtt)
@@ -984,6 +1216,17 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.bytesInFlight).To(BeZero())
 		})
 
+		It("doesn't retransmit lost path MTU probe packets", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Hour), IsPathMTUProbePacket: true}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Second)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			Expect(handler.packetHistory.Len()).To(BeZero())
+			Expect(handler.bytesInFlight).To(BeZero())
+		})
+
 		It("sets the early retransmit alarm", func() {
 			now := time.Now()
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-2 * time.Second)}))
@@ -996,9 +1239,9 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(handler.rttStats.SmoothedRTT()).To(Equal(time.Second))
 
-			// Packet 1 should be considered lost (1+1/8) RTTs after it was sent.
+			// Packet 1 should be considered lost one RTT plus the reordering window (1/4 of the minimum RTT) after it was sent.
 			Expect(handler.lossTime.IsZero()).To(BeFalse())
-			Expect(handler.lossTime.Sub(getPacket(1).SendTime)).To(Equal(time.Second * 9 / 8))
+			Expect(handler.lossTime.Sub(getPacket(1).SendTime)).To(Equal(time.Second * 5 / 4))
 			// Expect(time.Until(handler.GetAlarmTimeout())).To(BeNumerically("~", time.Hour*9/8, time.Minute))
 
 			err = handler.OnAlarm()
@@ -1009,6 +1252,117 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("reordering", func() {
+		It("doesn't declare reordered packets lost after a spurious loss", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-3 * time.Second)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-3 * time.Second)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now.Add(-time.Second))).To(Succeed())
+			Expect(handler.rttStats.MinRTT()).To(Equal(2 * time.Second))
+			// packet 1 is declared lost 2.5 seconds after it was sent
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(handler.DequeuePacketForRetransmission().PacketNumber).To(Equal(protocol.PacketNumber(1)))
+			// packet 1 arrives late, so the reordering window is doubled
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(handler.rack.ReorderingWindow(handler.rttStats.MinRTT(), handler.rttStats.SmoothedRTT())).To(Equal(time.Second))
+
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3, SendTime: now}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 4, SendTime: now}))
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 4, Largest: 4}, {Smallest: 1, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 3, protocol.EncryptionForwardSecure, now.Add(2*time.Second))).To(Succeed())
+			Expect(handler.lossTime.Sub(now)).To(Equal(3 * time.Second))
+		})
+	})
+
+	Context("qlog", func() {
+		var tracer *mocks.MockSentPacketTracer
+
+		BeforeEach(func() {
+			tracer = mocks.NewMockSentPacketTracer(mockCtrl)
+			handler.tracer = tracer
+		})
+
+		It("traces lost packets, and the metrics after receiving an ACK", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Hour), EncryptionLevel: protocol.EncryptionForwardSecure}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Second), EncryptionLevel: protocol.EncryptionForwardSecure}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			var cwnd protocol.ByteCount
+			gomock.InOrder(
+				tracer.EXPECT().LostPacket(now, protocol.PacketType(0), protocol.EncryptionForwardSecure, protocol.PacketNumber(1)),
+				tracer.EXPECT().UpdatedMetrics(now, handler.rttStats, gomock.Any(), protocol.ByteCount(0)).Do(func(_ time.Time, _ *congestion.RTTStats, c, _ protocol.ByteCount) {
+					cwnd = c
+				}),
+			)
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			// the congestion window is reduced when the loss is detected
+			Expect(cwnd).To(Equal(handler.congestion.GetCongestionWindow()))
+		})
+	})
+
+	Context("connection migration", func() {
+		It("resets the RTT measurements", func() {
+			handler.rttStats.UpdateRTT(time.Second, 0, time.Now())
+			Expect(handler.rttStats.SmoothedRTT()).ToNot(BeZero())
+			handler.OnConnectionMigration(nil)
+			Expect(handler.rttStats.SmoothedRTT()).To(BeZero())
+			Expect(handler.rttStats.MinRTT()).To(BeZero())
+		})
+
+		It("replaces the congestion controller", func() {
+			cong := mocks.NewMockSendAlgorithm(mockCtrl)
+			handler.OnConnectionMigration(cong)
+			Expect(handler.congestion).To(Equal(cong))
+		})
+
+		It("creates a new Cubic congestion controller", func() {
+			oldCong := mocks.NewMockSendAlgorithm(mockCtrl)
+			handler.congestion = oldCong
+			handler.OnConnectionMigration(nil)
+			Expect(handler.congestion).ToNot(Equal(oldCong))
+			Expect(handler.congestion.GetCongestionWindow()).To(Equal(protocol.InitialCongestionWindow * protocol.DefaultTCPMSS))
+		})
+	})
+
+	Context("exporting the state", func() {
+		It("errors while packets are outstanding", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1}))
+			_, err := handler.ExportState()
+			Expect(err).To(MatchError(errOutstandingPackets))
+		})
+
+		It("errors while packets are queued for retransmission", func() {
+			handler.retransmissionQueue = []*Packet{{PacketNumber: 1}}
+			_, err := handler.ExportState()
+			Expect(err).To(MatchError(errOutstandingPackets))
+		})
+
+		It("continues sending packets after importing the state", func() {
+			for i := protocol.PacketNumber(1); i <= 10; i++ {
+				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i}))
+			}
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}}
+			Expect(handler.ReceivedAck(ack, 42, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			state, err := handler.ExportState()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.LastSentPacketNumber).To(Equal(protocol.PacketNumber(10)))
+			Expect(state.LargestAcked).To(Equal(protocol.PacketNumber(10)))
+			Expect(state.LargestReceivedPacketWithAck).To(Equal(protocol.PacketNumber(42)))
+
+			imported := NewSentPacketHandler(&congestion.RTTStats{}, nil, nil, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
+			imported.ImportState(state)
+			Expect(imported.GetPacketNumberLen(11)).To(Equal(handler.GetPacketNumberLen(11)))
+			imported.SentPacket(retransmittablePacket(&Packet{PacketNumber: 11}))
+			// ACKs sent before the ACK that was already processed are ignored
+			Expect(imported.ReceivedAck(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 11, Largest: 11}}}, 41, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(imported.packetHistory.Len()).To(Equal(1))
+			Expect(imported.ReceivedAck(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 11, Largest: 11}}}, 43, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(imported.packetHistory.Len()).To(BeZero())
+		})
+	})
+
 	Context("handshake packets", func() {
 		BeforeEach(func() {
 			handler.handshakeComplete = false
@@ -1073,5 +1427,72 @@ var _ = Describe("SentPacketHandler", func() {
 			packet := handler.DequeuePacketForRetransmission()
 			Expect(packet).To(BeNil())
 		})
+
+		Context("amplification limit", func() {
+			It("isn't limited, if the peer's address was validated", func() {
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1, Length: 1000}))
+				Expect(handler.SendMode()).To(Equal(SendAny))
+			})
+
+			It("doesn't send anything before receiving data from the peer", func() {
+				handler.LimitAmplification()
+				Expect(handler.SendMode()).To(Equal(SendNone))
+				handler.ReceivedBytes(1200)
+				Expect(handler.SendMode()).To(Equal(SendAny))
+			})
+
+			It("allows sending 3 times the bytes received", func() {
+				handler.LimitAmplification()
+				handler.ReceivedBytes(1000)
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1, Length: 1500}))
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 2, Length: 1400}))
+				Expect(handler.SendMode()).To(Equal(SendAny))
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 3, Length: 100}))
+				Expect(handler.SendMode()).To(Equal(SendNone))
+				handler.ReceivedBytes(1)
+				Expect(handler.SendMode()).To(Equal(SendAny))
+			})
+
+			It("lifts the limit when the handshake completes", func() {
+				handler.LimitAmplification()
+				handler.ReceivedBytes(100)
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1, Length: 300}))
+				Expect(handler.SendMode()).To(Equal(SendNone))
+				handler.SetHandshakeComplete()
+				Expect(handler.SendMode()).To(Equal(SendAny))
+			})
+
+			It("doesn't set the alarm while limited, and sets it when receiving more data", func() {
+				handler.LimitAmplification()
+				handler.ReceivedBytes(100)
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1, Length: 200}))
+				Expect(handler.GetAlarmTimeout()).ToNot(BeZero())
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 2, Length: 100}))
+				Expect(handler.GetAlarmTimeout()).To(BeZero())
+				handler.SentPacket(nonRetransmittablePacket(&Packet{PacketNumber: 3, Length: 10}))
+				Expect(handler.GetAlarmTimeout()).To(BeZero())
+				handler.ReceivedBytes(50)
+				Expect(handler.GetAlarmTimeout()).ToNot(BeZero())
+			})
+
+			It("reports the remaining budget in the stats", func() {
+				Expect(handler.GetStats().AmplificationLimited).To(BeFalse())
+				handler.LimitAmplification()
+				Expect(handler.GetStats().AmplificationLimited).To(BeTrue())
+				Expect(handler.GetStats().AmplificationBudget).To(BeZero())
+				handler.ReceivedBytes(1000)
+				Expect(handler.GetStats().AmplificationBudget).To(Equal(protocol.ByteCount(3000)))
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1, Length: 1200}))
+				Expect(handler.GetStats().AmplificationBudget).To(Equal(protocol.ByteCount(1800)))
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 2, Length: 1200}))
+				Expect(handler.GetStats().AmplificationBudget).To(Equal(protocol.ByteCount(600)))
+				// the limit might be exceeded by up to one packet
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 3, Length: 1200}))
+				Expect(handler.GetStats().AmplificationBudget).To(BeZero())
+				handler.SetHandshakeComplete()
+				Expect(handler.GetStats().AmplificationLimited).To(BeFalse())
+				Expect(handler.GetStats().AmplificationBudget).To(BeZero())
+			})
+		})
 	})
 })
@@ -0,0 +1,48 @@
+package ackhandler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// Stats contains statistics about the packets sent, and the state of the RTT estimator and the congestion controller
+type Stats struct {
+	LatestRTT   time.Duration
+	SmoothedRTT time.Duration
+	MinRTT      time.Duration
+	RTTVariance time.Duration
+
+	CongestionWindow  protocol.ByteCount
+	BytesInFlight     protocol.ByteCount
+	BandwidthEstimate congestion.Bandwidth
+
+	PacketsLost          uint64
+	PacketsRetransmitted uint64
+
+	// AmplificationLimited is set while the anti-amplification limit applies.
+	// AmplificationBudget is the number of bytes that can then still be sent.
+	AmplificationLimited bool
+	AmplificationBudget  protocol.ByteCount
+}
+
+// The statsTracker holds a snapshot of the Stats.
+// Since it is read when the application requests the session stats, it is safe for concurrent use.
+type statsTracker struct {
+	mutex sync.Mutex
+	stats Stats
+}
+
+func (t *statsTracker) Update(s Stats) {
+	t.mutex.Lock()
+	t.stats = s
+	t.mutex.Unlock()
+}
+
+func (t *statsTracker) Get() Stats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.stats
+}
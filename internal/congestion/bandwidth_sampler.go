@@ -0,0 +1,102 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// The bandwidthSampler estimates the delivery rate of the connection.
+// When a packet is acknowledged, the number of bytes delivered since the packet was sent
+// is divided by the time it took to deliver them.
+// See https://tools.ietf.org/html/draft-cheng-iccrg-delivery-rate-estimation-00.
+type bandwidthSampler struct {
+	totalBytesDelivered protocol.ByteCount
+	// the time when the last packet was acknowledged
+	lastDeliveredTime time.Time
+	// the send time of the packet that was acknowledged last
+	lastAckedSentTime time.Time
+
+	packets map[protocol.PacketNumber]*sentPacketState
+}
+
+// The sentPacketState saves the state of the sampler when a packet was sent
+type sentPacketState struct {
+	sentTime                  time.Time
+	size                      protocol.ByteCount
+	totalBytesDeliveredAtSend protocol.ByteCount
+	lastDeliveredTimeAtSend   time.Time
+	lastAckedSentTimeAtSend   time.Time
+}
+
+func newBandwidthSampler() *bandwidthSampler {
+	return &bandwidthSampler{packets: make(map[protocol.PacketNumber]*sentPacketState)}
+}
+
+// OnPacketSent is called for every retransmittable packet sent.
+// bytesInFlight includes the packet.
+func (s *bandwidthSampler) OnPacketSent(sentTime time.Time, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, bytesInFlight protocol.ByteCount) {
+	// If this is the only packet in flight, the connection was idle.
+	// Don't include the idle period when calculating the delivery rate.
+	if bytesInFlight <= bytes {
+		s.lastDeliveredTime = sentTime
+		s.lastAckedSentTime = sentTime
+	}
+	s.packets[packetNumber] = &sentPacketState{
+		sentTime:                  sentTime,
+		size:                      bytes,
+		totalBytesDeliveredAtSend: s.totalBytesDelivered,
+		lastDeliveredTimeAtSend:   s.lastDeliveredTime,
+		lastAckedSentTimeAtSend:   s.lastAckedSentTime,
+	}
+}
+
+// OnPacketAcked is called when a packet is acknowledged.
+// It returns the delivery rate, or 0 if no sample could be taken.
+func (s *bandwidthSampler) OnPacketAcked(ackTime time.Time, packetNumber protocol.PacketNumber) Bandwidth {
+	p, ok := s.packets[packetNumber]
+	if !ok {
+		return 0
+	}
+	delete(s.packets, packetNumber)
+	s.removeStalePackets(packetNumber)
+
+	s.totalBytesDelivered += p.size
+	s.lastDeliveredTime = ackTime
+	s.lastAckedSentTime = p.sentTime
+
+	// The delivery rate can't be higher than the rate at which the packets were sent,
+	// so use the longer of the two intervals.
+	sendInterval := p.sentTime.Sub(p.lastAckedSentTimeAtSend)
+	ackInterval := ackTime.Sub(p.lastDeliveredTimeAtSend)
+	interval := utils.MaxDuration(sendInterval, ackInterval)
+	if interval <= 0 {
+		return 0
+	}
+	return BandwidthFromDelta(s.totalBytesDelivered-p.totalBytesDeliveredAtSend, interval)
+}
+
+// OnPacketLost is called when a packet is declared lost
+func (s *bandwidthSampler) OnPacketLost(packetNumber protocol.PacketNumber) {
+	delete(s.packets, packetNumber)
+}
+
+// Packets that were retransmitted after an RTO are neither reported as acknowledged nor as lost.
+// Once we're tracking more packets than the sentPacketHandler does, delete the packets sent
+// before the packet that was just acknowledged.
+func (s *bandwidthSampler) removeStalePackets(ackedPacketNumber protocol.PacketNumber) {
+	if len(s.packets) <= protocol.MaxTrackedSentPackets {
+		return
+	}
+	for pn := range s.packets {
+		if pn < ackedPacketNumber {
+			delete(s.packets, pn)
+		}
+	}
+}
+
+// Reset removes all state
+func (s *bandwidthSampler) Reset() {
+	*s = *newBandwidthSampler()
+}
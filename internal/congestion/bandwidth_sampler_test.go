@@ -0,0 +1,75 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bandwidth sampler", func() {
+	var (
+		sampler *bandwidthSampler
+		now     time.Time
+	)
+
+	BeforeEach(func() {
+		sampler = newBandwidthSampler()
+		now = time.Now()
+	})
+
+	It("takes a sample for a single packet", func() {
+		sampler.OnPacketSent(now, 1, 1000, 1000)
+		Expect(sampler.OnPacketAcked(now.Add(10*time.Millisecond), 1)).To(Equal(100 * 1000 * BytesPerSecond))
+	})
+
+	It("measures the rate at which packets are acknowledged", func() {
+		// send 10 packets at once
+		for i := 1; i <= 10; i++ {
+			sampler.OnPacketSent(now, protocol.PacketNumber(i), 1000, protocol.ByteCount(i*1000))
+		}
+		// packets are acknowledged every millisecond, after an RTT of 10ms
+		var bw Bandwidth
+		for i := 1; i <= 10; i++ {
+			bw = sampler.OnPacketAcked(now.Add(time.Duration(9+i)*time.Millisecond), protocol.PacketNumber(i))
+		}
+		Expect(bw).To(Equal(BandwidthFromDelta(10*1000, 19*time.Millisecond)))
+		// packet 11 is sent after the ACK for packet 10 was received
+		now = now.Add(19 * time.Millisecond)
+		sampler.OnPacketSent(now, 11, 1000, 1000)
+		sampler.OnPacketSent(now, 12, 1000, 2000)
+		Expect(sampler.OnPacketAcked(now.Add(10*time.Millisecond), 11)).To(Equal(BandwidthFromDelta(1000, 10*time.Millisecond)))
+		Expect(sampler.OnPacketAcked(now.Add(11*time.Millisecond), 12)).To(Equal(BandwidthFromDelta(2000, 11*time.Millisecond)))
+	})
+
+	It("doesn't measure a rate higher than the send rate", func() {
+		sampler.OnPacketSent(now, 1, 1000, 1000)
+		sampler.OnPacketSent(now.Add(time.Millisecond), 2, 1000, 2000)
+		sampler.OnPacketAcked(now.Add(20*time.Millisecond), 1)
+		sampler.OnPacketSent(now.Add(20*time.Millisecond), 3, 1000, 2000)
+		sampler.OnPacketAcked(now.Add(21*time.Millisecond), 2)
+		// 2 packets were acknowledged within 5ms, but it took 20ms to send them
+		Expect(sampler.OnPacketAcked(now.Add(25*time.Millisecond), 3)).To(Equal(BandwidthFromDelta(2000, 20*time.Millisecond)))
+	})
+
+	It("doesn't take a sample for unknown packets", func() {
+		Expect(sampler.OnPacketAcked(now, 1)).To(BeZero())
+	})
+
+	It("doesn't take a sample for lost packets", func() {
+		sampler.OnPacketSent(now, 1, 1000, 1000)
+		sampler.OnPacketLost(1)
+		Expect(sampler.OnPacketAcked(now.Add(10*time.Millisecond), 1)).To(BeZero())
+		Expect(sampler.packets).To(BeEmpty())
+	})
+
+	It("removes packets that are neither acknowledged nor lost", func() {
+		for i := 1; i <= protocol.MaxTrackedSentPackets+2; i++ {
+			sampler.OnPacketSent(now, protocol.PacketNumber(i), 1000, protocol.ByteCount(i*1000))
+		}
+		sampler.OnPacketAcked(now.Add(10*time.Millisecond), protocol.MaxTrackedSentPackets+1)
+		Expect(sampler.packets).To(HaveLen(1))
+		Expect(sampler.packets).To(HaveKey(protocol.PacketNumber(protocol.MaxTrackedSentPackets + 2)))
+	})
+})
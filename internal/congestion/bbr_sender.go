@@ -0,0 +1,365 @@
+package congestion
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// This is an implementation of BBR (version 1), as described in
+// https://tools.ietf.org/html/draft-cardwell-iccrg-bbr-congestion-control-00.
+
+type bbrMode uint8
+
+const (
+	// bbrModeStartup grows the sending rate exponentially, until the bandwidth stops increasing
+	bbrModeStartup bbrMode = iota
+	// bbrModeDrain drains the queue that was created during startup
+	bbrModeDrain
+	// bbrModeProbeBW cycles the pacing gain, in order to probe for more bandwidth
+	bbrModeProbeBW
+	// bbrModeProbeRTT reduces the congestion window, in order to measure the minimum RTT
+	bbrModeProbeRTT
+)
+
+func (m bbrMode) String() string {
+	switch m {
+	case bbrModeStartup:
+		return "startup"
+	case bbrModeDrain:
+		return "drain"
+	case bbrModeProbeBW:
+		return "probe bandwidth"
+	case bbrModeProbeRTT:
+		return "probe RTT"
+	default:
+		return "unknown mode"
+	}
+}
+
+const (
+	// bbrHighGain is the gain used during startup: 2/ln(2)
+	// It is the smallest gain that allows the sending rate to double every round trip.
+	bbrHighGain = 2.885
+	// bbrDrainGain is the pacing gain used to drain the queue created during startup
+	bbrDrainGain = 1 / bbrHighGain
+	// bbrCongestionWindowGain is the congestion window gain used in probe bandwidth mode
+	bbrCongestionWindowGain = 2
+	// bbrBandwidthWindow is the number of round trips the max bandwidth filter remembers samples for
+	bbrBandwidthWindow = 10
+	// bbrMinRTTExpiry is the time after which the minimum RTT is measured again, if it didn't decrease
+	bbrMinRTTExpiry = 10 * time.Second
+	// bbrProbeRTTDuration is the minimum duration of the probe RTT mode
+	bbrProbeRTTDuration = 200 * time.Millisecond
+	// bbrStartupGrowthTarget is the growth of the bandwidth per round trip expected during startup
+	bbrStartupGrowthTarget = 1.25
+	// bbrStartupRoundsWithoutGrowth is the number of round trips without the expected growth,
+	// after which the bottleneck bandwidth is considered to be reached
+	bbrStartupRoundsWithoutGrowth = 3
+	// bbrMinCongestionWindow is the smallest congestion window, which is also used in probe RTT mode
+	bbrMinCongestionWindow = 4 * protocol.DefaultTCPMSS
+)
+
+// bbrPacingGainCycle are the pacing gains used in probe bandwidth mode.
+// Each phase lasts for (about) one minimum RTT.
+var bbrPacingGainCycle = [...]float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+type bbrSender struct {
+	clock    Clock
+	rttStats *RTTStats
+
+	sampler      *bandwidthSampler
+	maxBandwidth *maxBandwidthFilter
+
+	mode       bbrMode
+	pacingGain float64
+	cwndGain   float64
+
+	congestionWindow        protocol.ByteCount
+	initialCongestionWindow protocol.ByteCount
+	maxCongestionWindow     protocol.ByteCount
+
+	largestSentPacketNumber protocol.PacketNumber
+	// a round trip ends when a packet sent after the start of the round trip is acknowledged
+	roundCount          uint64
+	currentRoundTripEnd protocol.PacketNumber
+
+	// used to detect when the bottleneck bandwidth is reached during startup
+	fullBandwidthReached         bool
+	fullBandwidth                Bandwidth
+	roundsWithoutBandwidthGrowth int
+
+	// used in probe bandwidth mode
+	cycleIndex          int
+	cycleStart          time.Time
+	lossSinceCycleStart bool
+
+	minRTT          time.Duration
+	minRTTTimestamp time.Time
+
+	// used in probe RTT mode
+	// probeRTTDoneTime is zero until the bytes in flight dropped to the minimum congestion window
+	probeRTTDoneTime    time.Time
+	probeRTTRoundPassed bool
+}
+
+var _ SendAlgorithm = &bbrSender{}
+
+// NewBBRSender makes a new BBR sender
+func NewBBRSender(clock Clock, rttStats *RTTStats, initialCongestionWindow, maxCongestionWindow protocol.PacketNumber) SendAlgorithm {
+	b := &bbrSender{
+		clock:                   clock,
+		rttStats:                rttStats,
+		initialCongestionWindow: protocol.ByteCount(initialCongestionWindow) * protocol.DefaultTCPMSS,
+		maxCongestionWindow:     protocol.ByteCount(maxCongestionWindow) * protocol.DefaultTCPMSS,
+	}
+	b.reset()
+	return b
+}
+
+func (b *bbrSender) reset() {
+	b.sampler = newBandwidthSampler()
+	b.maxBandwidth = newMaxBandwidthFilter(bbrBandwidthWindow)
+	b.congestionWindow = b.initialCongestionWindow
+	b.largestSentPacketNumber = 0
+	b.roundCount = 0
+	b.currentRoundTripEnd = 0
+	b.fullBandwidthReached = false
+	b.fullBandwidth = 0
+	b.roundsWithoutBandwidthGrowth = 0
+	b.minRTT = 0
+	b.minRTTTimestamp = time.Time{}
+	b.enterStartupMode()
+}
+
+// TimeUntilSend returns the time it takes to send a full-sized packet at the pacing rate
+func (b *bbrSender) TimeUntilSend(bytesInFlight protocol.ByteCount) time.Duration {
+	rate := b.pacingRate()
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(uint64(protocol.DefaultTCPMSS) * uint64(BytesPerSecond) * uint64(time.Second) / uint64(rate))
+}
+
+func (b *bbrSender) OnPacketSent(sentTime time.Time, bytesInFlight protocol.ByteCount, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool) bool {
+	if !isRetransmittable {
+		return false
+	}
+	b.largestSentPacketNumber = packetNumber
+	b.sampler.OnPacketSent(sentTime, packetNumber, bytes, bytesInFlight)
+	return true
+}
+
+func (b *bbrSender) GetCongestionWindow() protocol.ByteCount {
+	if b.mode == bbrModeProbeRTT {
+		return bbrMinCongestionWindow
+	}
+	return b.congestionWindow
+}
+
+// MaybeExitSlowStart does nothing, since BBR detects the end of startup by itself
+func (b *bbrSender) MaybeExitSlowStart() {}
+
+func (b *bbrSender) OnPacketAcked(number protocol.PacketNumber, ackedBytes protocol.ByteCount, priorInFlight protocol.ByteCount) {
+	now := b.clock.Now()
+	bytesInFlight := priorInFlight - utils.MinByteCount(ackedBytes, priorInFlight)
+
+	roundStart := false
+	if number > b.currentRoundTripEnd {
+		b.roundCount++
+		b.currentRoundTripEnd = b.largestSentPacketNumber
+		roundStart = true
+	}
+	if bw := b.sampler.OnPacketAcked(now, number); bw > 0 {
+		b.maxBandwidth.Update(bw, b.roundCount)
+	}
+	minRTTExpired := b.updateMinRTT(now)
+
+	if b.mode == bbrModeProbeBW {
+		b.updateGainCyclePhase(now, priorInFlight)
+	}
+	if roundStart && !b.fullBandwidthReached {
+		b.checkIfFullBandwidthReached()
+	}
+	b.maybeExitStartupOrDrain(now, bytesInFlight)
+	b.maybeEnterOrExitProbeRTT(now, roundStart, minRTTExpired, bytesInFlight)
+	b.updateCongestionWindow(ackedBytes)
+}
+
+// OnPacketLost removes the packet from the bandwidth sampler.
+// BBR doesn't use packet loss as a congestion signal.
+func (b *bbrSender) OnPacketLost(number protocol.PacketNumber, lostBytes protocol.ByteCount, bytesInFlight protocol.ByteCount) {
+	b.sampler.OnPacketLost(number)
+	b.lossSinceCycleStart = true
+}
+
+// OnRetransmissionTimeout reduces the congestion window to the minimum
+func (b *bbrSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
+	if !packetsRetransmitted {
+		return
+	}
+	b.congestionWindow = bbrMinCongestionWindow
+}
+
+// SetNumEmulatedConnections does nothing, since BBR doesn't emulate multiple connections
+func (b *bbrSender) SetNumEmulatedConnections(int) {}
+
+// OnConnectionMigration resets the sender, since the path properties are unknown after a migration
+func (b *bbrSender) OnConnectionMigration() {
+	b.reset()
+}
+
+// SetSlowStartLargeReduction does nothing, since BBR doesn't use slow start
+func (b *bbrSender) SetSlowStartLargeReduction(bool) {}
+
+// BandwidthEstimate returns the estimate of the bottleneck bandwidth
+func (b *bbrSender) BandwidthEstimate() Bandwidth {
+	return b.maxBandwidth.Get()
+}
+
+func (b *bbrSender) pacingRate() Bandwidth {
+	bw := b.maxBandwidth.Get()
+	if bw == 0 {
+		// Before the first bandwidth sample, derive the rate from the initial congestion window.
+		srtt := b.rttStats.SmoothedRTT()
+		if srtt == 0 {
+			return 0
+		}
+		bw = BandwidthFromDelta(b.initialCongestionWindow, srtt)
+	}
+	return Bandwidth(b.pacingGain * float64(bw))
+}
+
+// getTargetCongestionWindow calculates the bandwidth-delay product, multiplied by the gain
+func (b *bbrSender) getTargetCongestionWindow(gain float64) protocol.ByteCount {
+	bw := b.maxBandwidth.Get()
+	if bw == 0 || b.minRTT == 0 {
+		return protocol.ByteCount(gain * float64(b.initialCongestionWindow))
+	}
+	bdp := float64(bw) / float64(BytesPerSecond) * b.minRTT.Seconds()
+	return utils.MaxByteCount(protocol.ByteCount(gain*bdp), bbrMinCongestionWindow)
+}
+
+// updateMinRTT updates the minimum RTT, and returns if the previous minimum RTT expired
+func (b *bbrSender) updateMinRTT(now time.Time) bool {
+	rtt := b.rttStats.LatestRTT()
+	if rtt == 0 {
+		return false
+	}
+	expired := !b.minRTTTimestamp.IsZero() && now.Sub(b.minRTTTimestamp) > bbrMinRTTExpiry
+	if expired || b.minRTT == 0 || rtt <= b.minRTT {
+		b.minRTT = rtt
+		b.minRTTTimestamp = now
+	}
+	return expired
+}
+
+func (b *bbrSender) updateGainCyclePhase(now time.Time, priorInFlight protocol.ByteCount) {
+	shouldAdvance := now.Sub(b.cycleStart) > b.minRTT
+	// When probing for more bandwidth, stay in this phase until the bytes in flight reached the target,
+	// unless packets are lost.
+	if b.pacingGain > 1 && !b.lossSinceCycleStart && priorInFlight < b.getTargetCongestionWindow(b.pacingGain) {
+		shouldAdvance = false
+	}
+	// When draining the queue created by probing, exit early once the bytes in flight drop to the BDP.
+	if b.pacingGain < 1 && priorInFlight <= b.getTargetCongestionWindow(1) {
+		shouldAdvance = true
+	}
+	if shouldAdvance {
+		b.cycleIndex = (b.cycleIndex + 1) % len(bbrPacingGainCycle)
+		b.cycleStart = now
+		b.lossSinceCycleStart = false
+		b.pacingGain = bbrPacingGainCycle[b.cycleIndex]
+	}
+}
+
+func (b *bbrSender) checkIfFullBandwidthReached() {
+	bw := b.maxBandwidth.Get()
+	if float64(bw) >= float64(b.fullBandwidth)*bbrStartupGrowthTarget {
+		b.fullBandwidth = bw
+		b.roundsWithoutBandwidthGrowth = 0
+		return
+	}
+	b.roundsWithoutBandwidthGrowth++
+	if b.roundsWithoutBandwidthGrowth >= bbrStartupRoundsWithoutGrowth {
+		b.fullBandwidthReached = true
+	}
+}
+
+func (b *bbrSender) maybeExitStartupOrDrain(now time.Time, bytesInFlight protocol.ByteCount) {
+	if b.mode == bbrModeStartup && b.fullBandwidthReached {
+		b.mode = bbrModeDrain
+		b.pacingGain = bbrDrainGain
+		b.cwndGain = bbrHighGain
+	}
+	if b.mode == bbrModeDrain && bytesInFlight <= b.getTargetCongestionWindow(1) {
+		b.enterProbeBandwidthMode(now)
+	}
+}
+
+func (b *bbrSender) maybeEnterOrExitProbeRTT(now time.Time, roundStart, minRTTExpired bool, bytesInFlight protocol.ByteCount) {
+	if minRTTExpired && b.mode != bbrModeProbeRTT {
+		b.mode = bbrModeProbeRTT
+		b.pacingGain = 1
+		b.probeRTTDoneTime = time.Time{}
+	}
+	if b.mode != bbrModeProbeRTT {
+		return
+	}
+	if b.probeRTTDoneTime.IsZero() {
+		if bytesInFlight <= bbrMinCongestionWindow {
+			b.probeRTTDoneTime = now.Add(bbrProbeRTTDuration)
+			// stay in probe RTT mode for at least one round trip
+			b.probeRTTRoundPassed = false
+			b.currentRoundTripEnd = b.largestSentPacketNumber
+		}
+		return
+	}
+	if roundStart {
+		b.probeRTTRoundPassed = true
+	}
+	if b.probeRTTRoundPassed && !now.Before(b.probeRTTDoneTime) {
+		b.minRTTTimestamp = now
+		if b.fullBandwidthReached {
+			b.enterProbeBandwidthMode(now)
+		} else {
+			b.enterStartupMode()
+		}
+	}
+}
+
+func (b *bbrSender) enterStartupMode() {
+	b.mode = bbrModeStartup
+	b.pacingGain = bbrHighGain
+	b.cwndGain = bbrHighGain
+}
+
+func (b *bbrSender) enterProbeBandwidthMode(now time.Time) {
+	b.mode = bbrModeProbeBW
+	b.cwndGain = bbrCongestionWindowGain
+	// Start at a random phase, but never in the phase that drains the queue,
+	// since there's no queue to drain after startup or probe RTT.
+	b.cycleIndex = rand.Intn(len(bbrPacingGainCycle) - 1)
+	if b.cycleIndex >= 1 {
+		b.cycleIndex++
+	}
+	b.cycleStart = now
+	b.lossSinceCycleStart = false
+	b.pacingGain = bbrPacingGainCycle[b.cycleIndex]
+}
+
+func (b *bbrSender) updateCongestionWindow(ackedBytes protocol.ByteCount) {
+	if b.mode == bbrModeProbeRTT {
+		return
+	}
+	target := b.getTargetCongestionWindow(b.cwndGain)
+	if b.fullBandwidthReached {
+		b.congestionWindow = utils.MinByteCount(b.congestionWindow+ackedBytes, target)
+	} else if b.congestionWindow < target || b.sampler.totalBytesDelivered < b.initialCongestionWindow {
+		b.congestionWindow += ackedBytes
+	}
+	b.congestionWindow = utils.MaxByteCount(b.congestionWindow, bbrMinCongestionWindow)
+	b.congestionWindow = utils.MinByteCount(b.congestionWindow, b.maxCongestionWindow)
+}
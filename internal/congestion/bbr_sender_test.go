@@ -0,0 +1,190 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BBR sender", func() {
+	const (
+		// properties of the simulated link
+		linkRTT       = 50 * time.Millisecond
+		linkBandwidth = 10 * 1000 * 1000 * BitsPerSecond
+		linkBDP       = protocol.ByteCount(uint64(linkBandwidth) / uint64(BytesPerSecond) * uint64(linkRTT) / uint64(time.Second))
+		// the time it takes the bottleneck link to transmit a packet
+		serializationDelay = time.Duration(uint64(protocol.DefaultTCPMSS) * uint64(BytesPerSecond) * uint64(time.Second) / uint64(linkBandwidth))
+	)
+
+	type packetInFlight struct {
+		packetNumber protocol.PacketNumber
+		sentTime     time.Time
+		ackTime      time.Time
+	}
+
+	var (
+		sender        *bbrSender
+		clock         mockClock
+		rttStats      *RTTStats
+		packetNumber  protocol.PacketNumber
+		bytesInFlight protocol.ByteCount
+		inFlight      []packetInFlight
+		nextSendTime  time.Time
+		lastAckTime   time.Time
+		// extraDelay is added to the RTT of the link
+		extraDelay time.Duration
+	)
+
+	BeforeEach(func() {
+		clock = mockClock{}
+		clock.Advance(time.Hour)
+		rttStats = NewRTTStats()
+		sender = NewBBRSender(&clock, rttStats, initialCongestionWindowPackets, MaxCongestionWindow).(*bbrSender)
+		packetNumber = 1
+		bytesInFlight = 0
+		inFlight = nil
+		nextSendTime = time.Time{}
+		lastAckTime = time.Time{}
+		extraDelay = 0
+	})
+
+	sendPacket := func() {
+		now := clock.Now()
+		bytesInFlight += protocol.DefaultTCPMSS
+		sender.OnPacketSent(now, bytesInFlight, packetNumber, protocol.DefaultTCPMSS, true)
+		// the bottleneck link serializes the packets
+		ackTime := now.Add(linkRTT + extraDelay)
+		if minAckTime := lastAckTime.Add(serializationDelay); ackTime.Before(minAckTime) {
+			ackTime = minAckTime
+		}
+		lastAckTime = ackTime
+		inFlight = append(inFlight, packetInFlight{packetNumber: packetNumber, sentTime: now, ackTime: ackTime})
+		packetNumber++
+		nextSendTime = now.Add(sender.TimeUntilSend(bytesInFlight))
+	}
+
+	ackPacket := func() {
+		p := inFlight[0]
+		inFlight = inFlight[1:]
+		rttStats.UpdateRTT(clock.Now().Sub(p.sentTime), 0, clock.Now())
+		sender.OnPacketAcked(p.packetNumber, protocol.DefaultTCPMSS, bytesInFlight)
+		bytesInFlight -= protocol.DefaultTCPMSS
+	}
+
+	// simulate sends as much data as the sender allows, for the given duration
+	simulate := func(d time.Duration) {
+		end := clock.Now().Add(d)
+		for clock.Now().Before(end) {
+			canSend := bytesInFlight < sender.GetCongestionWindow()
+			if canSend && !clock.Now().Before(nextSendTime) {
+				sendPacket()
+				continue
+			}
+			next := end
+			if canSend && nextSendTime.Before(next) {
+				next = nextSendTime
+			}
+			if len(inFlight) > 0 && inFlight[0].ackTime.Before(next) {
+				next = inFlight[0].ackTime
+			}
+			clock = mockClock(next)
+			for len(inFlight) > 0 && !inFlight[0].ackTime.After(clock.Now()) {
+				ackPacket()
+			}
+		}
+	}
+
+	It("starts in startup mode", func() {
+		Expect(sender.mode).To(Equal(bbrModeStartup))
+		Expect(sender.pacingGain).To(Equal(bbrHighGain))
+		Expect(sender.GetCongestionWindow()).To(Equal(protocol.ByteCount(initialCongestionWindowPackets) * protocol.DefaultTCPMSS))
+	})
+
+	It("doesn't pace packets before the RTT is known", func() {
+		Expect(sender.TimeUntilSend(0)).To(BeZero())
+	})
+
+	It("paces packets at the pacing rate", func() {
+		sender.maxBandwidth.Update(BandwidthFromDelta(protocol.DefaultTCPMSS, time.Millisecond), 1)
+		sender.pacingGain = 1
+		Expect(sender.TimeUntilSend(0)).To(Equal(time.Millisecond))
+		sender.pacingGain = 2
+		Expect(sender.TimeUntilSend(0)).To(Equal(time.Millisecond / 2))
+	})
+
+	It("estimates the bandwidth and the minimum RTT", func() {
+		simulate(2 * time.Second)
+		Expect(sender.BandwidthEstimate()).To(BeNumerically("~", linkBandwidth, linkBandwidth/20))
+		Expect(sender.minRTT).To(BeNumerically("~", linkRTT, time.Millisecond))
+	})
+
+	It("exits startup and drains the queue, once the full bandwidth is reached", func() {
+		simulate(2 * time.Second)
+		Expect(sender.fullBandwidthReached).To(BeTrue())
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		Expect(sender.GetCongestionWindow()).To(BeNumerically("~", bbrCongestionWindowGain*linkBDP, linkBDP/5))
+		// the queue was drained, so the RTT is close to the minimum RTT
+		Expect(rttStats.LatestRTT()).To(BeNumerically("<", linkRTT*3/2))
+	})
+
+	It("cycles through the pacing gains in probe bandwidth mode", func() {
+		simulate(2 * time.Second)
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		gains := make(map[float64]bool)
+		for i := 0; i < 100; i++ {
+			simulate(linkRTT / 5)
+			gains[sender.pacingGain] = true
+		}
+		Expect(gains).To(HaveLen(3))
+		Expect(gains).To(HaveKey(1.25))
+		Expect(gains).To(HaveKey(0.75))
+		Expect(gains).To(HaveKey(1.0))
+	})
+
+	It("enters probe RTT mode when the minimum RTT expires", func() {
+		simulate(2 * time.Second)
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		// the RTT increases, so the minimum RTT isn't updated any more,
+		// once the packets sent before the increase are acknowledged
+		extraDelay = 10 * time.Millisecond
+		simulate(2 * linkRTT)
+		minRTTTimestamp := sender.minRTTTimestamp
+		simulate(minRTTTimestamp.Add(bbrMinRTTExpiry).Sub(clock.Now()))
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		simulate(linkRTT)
+		Expect(sender.mode).To(Equal(bbrModeProbeRTT))
+		Expect(sender.GetCongestionWindow()).To(Equal(bbrMinCongestionWindow))
+		simulate(bbrProbeRTTDuration / 2)
+		Expect(sender.mode).To(Equal(bbrModeProbeRTT))
+		simulate(bbrProbeRTTDuration)
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		Expect(sender.minRTTTimestamp).To(BeTemporally(">", minRTTTimestamp.Add(bbrMinRTTExpiry)))
+		Expect(sender.minRTT).To(BeNumerically("~", linkRTT+extraDelay, time.Millisecond))
+		Expect(sender.GetCongestionWindow()).To(BeNumerically(">", bbrMinCongestionWindow))
+	})
+
+	It("doesn't reduce the congestion window when a packet is lost", func() {
+		simulate(2 * time.Second)
+		cwnd := sender.GetCongestionWindow()
+		sender.OnPacketLost(inFlight[0].packetNumber, protocol.DefaultTCPMSS, bytesInFlight)
+		Expect(sender.GetCongestionWindow()).To(Equal(cwnd))
+	})
+
+	It("reduces the congestion window on a retransmission timeout", func() {
+		simulate(2 * time.Second)
+		sender.OnRetransmissionTimeout(false)
+		Expect(sender.GetCongestionWindow()).To(BeNumerically(">", bbrMinCongestionWindow))
+		sender.OnRetransmissionTimeout(true)
+		Expect(sender.GetCongestionWindow()).To(Equal(bbrMinCongestionWindow))
+	})
+
+	It("resets on a connection migration", func() {
+		simulate(2 * time.Second)
+		sender.OnConnectionMigration()
+		Expect(sender.mode).To(Equal(bbrModeStartup))
+		Expect(sender.BandwidthEstimate()).To(BeZero())
+		Expect(sender.GetCongestionWindow()).To(Equal(protocol.ByteCount(initialCongestionWindowPackets) * protocol.DefaultTCPMSS))
+	})
+})
@@ -19,6 +19,7 @@ type cubicSender struct {
 	rttStats        *RTTStats
 	stats           connectionStats
 	cubic           *Cubic
+	clock           Clock
 
 	reno bool
 
@@ -53,15 +54,20 @@ type cubicSender struct {
 	// Number of connections to simulate.
 	numConnections int
 
-	// ACK counter for the Reno implementation.
+	// ACK counter for the Reno implementation, and for Conservative Slow Start.
 	congestionWindowCount protocol.ByteCount
 
 	initialCongestionWindow    protocol.PacketNumber
 	initialMaxCongestionWindow protocol.PacketNumber
+
+	// The state that was last reported to the onStateChange callback.
+	state         State
+	onStateChange EventHandler
 }
 
 // NewCubicSender makes a new cubic sender
-func NewCubicSender(clock Clock, rttStats *RTTStats, reno bool, initialCongestionWindow, initialMaxCongestionWindow protocol.PacketNumber) SendAlgorithmWithDebugInfo {
+// onStateChange is called when the sender transitions between slow start, congestion avoidance and recovery. It may be nil.
+func NewCubicSender(clock Clock, rttStats *RTTStats, reno bool, initialCongestionWindow, initialMaxCongestionWindow protocol.PacketNumber, onStateChange EventHandler) SendAlgorithmWithDebugInfo {
 	return &cubicSender{
 		rttStats:                   rttStats,
 		initialCongestionWindow:    initialCongestionWindow,
@@ -72,7 +78,9 @@ func NewCubicSender(clock Clock, rttStats *RTTStats, reno bool, initialCongestio
 		maxTCPCongestionWindow:     initialMaxCongestionWindow,
 		numConnections:             defaultNumConnections,
 		cubic:                      NewCubic(clock),
+		clock:                      clock,
 		reno:                       reno,
+		onStateChange:              onStateChange,
 	}
 }
 
@@ -123,6 +131,7 @@ func (c *cubicSender) GetSlowStartThreshold() protocol.ByteCount {
 
 func (c *cubicSender) ExitSlowstart() {
 	c.slowstartThreshold = c.congestionWindow
+	c.congestionWindowCount = 0
 }
 
 func (c *cubicSender) SlowstartThreshold() protocol.PacketNumber {
@@ -130,12 +139,14 @@ func (c *cubicSender) SlowstartThreshold() protocol.PacketNumber {
 }
 
 func (c *cubicSender) MaybeExitSlowStart() {
-	if c.InSlowStart() && c.hybridSlowStart.ShouldExitSlowStart(c.rttStats.LatestRTT(), c.rttStats.MinRTT(), c.GetCongestionWindow()/protocol.DefaultTCPMSS) {
+	if c.InSlowStart() && c.hybridSlowStart.ShouldExitSlowStart(c.clock.Now(), c.rttStats.LatestRTT(), c.rttStats.MinRTT(), c.GetCongestionWindow()/protocol.DefaultTCPMSS) {
 		c.ExitSlowstart()
+		c.maybeReportStateChange()
 	}
 }
 
 func (c *cubicSender) OnPacketAcked(ackedPacketNumber protocol.PacketNumber, ackedBytes protocol.ByteCount, bytesInFlight protocol.ByteCount) {
+	defer c.maybeReportStateChange()
 	c.largestAckedPacketNumber = utils.MaxPacketNumber(ackedPacketNumber, c.largestAckedPacketNumber)
 	if c.InRecovery() {
 		// PRR is used when in recovery.
@@ -149,6 +160,7 @@ func (c *cubicSender) OnPacketAcked(ackedPacketNumber protocol.PacketNumber, ack
 }
 
 func (c *cubicSender) OnPacketLost(packetNumber protocol.PacketNumber, lostBytes protocol.ByteCount, bytesInFlight protocol.ByteCount) {
+	defer c.maybeReportStateChange()
 	// TCP NewReno (RFC6582) says that once a loss occurs, any losses in packets
 	// already sent should be treated as a single loss event, since it's expected.
 	if packetNumber <= c.largestSentAtLastCutback {
@@ -191,6 +203,26 @@ func (c *cubicSender) OnPacketLost(packetNumber protocol.PacketNumber, lostBytes
 	c.congestionWindowCount = 0
 }
 
+// maybeReportStateChange calls the onStateChange callback if the sender transitioned to a new state
+func (c *cubicSender) maybeReportStateChange() {
+	var state State
+	switch {
+	case c.InRecovery():
+		state = StateRecovery
+	case c.InSlowStart():
+		state = StateSlowStart
+	default:
+		state = StateCongestionAvoidance
+	}
+	if state == c.state {
+		return
+	}
+	c.state = state
+	if c.onStateChange != nil {
+		c.onStateChange(state, c.GetCongestionWindow())
+	}
+}
+
 func (c *cubicSender) RenoBeta() float32 {
 	// kNConnectionBeta is the backoff factor after loss for our N-connection
 	// emulation, which emulates the effective backoff of an ensemble of N
@@ -212,6 +244,15 @@ func (c *cubicSender) maybeIncreaseCwnd(ackedPacketNumber protocol.PacketNumber,
 		return
 	}
 	if c.InSlowStart() {
+		if c.hybridSlowStart.InConservativeSlowStart() {
+			// HyStart++ Conservative Slow Start, increase by one for every hybridStartCSSGrowthDivisor ACKs.
+			c.congestionWindowCount++
+			if c.congestionWindowCount >= hybridStartCSSGrowthDivisor {
+				c.congestionWindow++
+				c.congestionWindowCount = 0
+			}
+			return
+		}
 		// TCP slow start, exponential growth, increase by one for each ACK.
 		c.congestionWindow++
 		return
@@ -263,6 +304,7 @@ func (c *cubicSender) SetNumEmulatedConnections(n int) {
 
 // OnRetransmissionTimeout is called on an retransmission timeout
 func (c *cubicSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
+	defer c.maybeReportStateChange()
 	c.largestSentAtLastCutback = 0
 	if !packetsRetransmitted {
 		return
@@ -286,6 +328,7 @@ func (c *cubicSender) OnConnectionMigration() {
 	c.congestionWindow = c.initialCongestionWindow
 	c.slowstartThreshold = c.initialMaxCongestionWindow
 	c.maxTCPCongestionWindow = c.initialMaxCongestionWindow
+	c.maybeReportStateChange()
 }
 
 // SetSlowStartLargeReduction allows enabling the SSLR experiment
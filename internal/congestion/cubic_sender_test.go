@@ -40,7 +40,7 @@ var _ = Describe("Cubic Sender", func() {
 		ackedPacketNumber = 0
 		clock = mockClock{}
 		rttStats = NewRTTStats()
-		sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets, MaxCongestionWindow)
+		sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets, MaxCongestionWindow, nil)
 	})
 
 	SendAvailableSendWindowLen := func(packetLength protocol.ByteCount) int {
@@ -185,6 +185,21 @@ var _ = Describe("Cubic Sender", func() {
 		Expect(sender.HybridSlowStart().Started()).To(BeFalse())
 	})
 
+	It("grows the congestion window slower during conservative slow start", func() {
+		SendAvailableSendWindow()
+		AckNPackets(2)
+		SendAvailableSendWindow()
+		expectedSendWindow := defaultWindowTCP + 2*protocol.DefaultTCPMSS
+		Expect(sender.GetCongestionWindow()).To(Equal(expectedSendWindow))
+		sender.HybridSlowStart().inConservativeSlowStart = true
+		sender.HybridSlowStart().cssBaselineMinRTT = 60 * time.Millisecond
+		AckNPackets(hybridStartCSSGrowthDivisor - 1)
+		Expect(sender.GetCongestionWindow()).To(Equal(expectedSendWindow))
+		AckNPackets(1)
+		expectedSendWindow += protocol.DefaultTCPMSS
+		Expect(sender.GetCongestionWindow()).To(Equal(expectedSendWindow))
+	})
+
 	It("slow start packet loss with large reduction", func() {
 		sender.SetSlowStartLargeReduction(true)
 
@@ -400,7 +415,7 @@ var _ = Describe("Cubic Sender", func() {
 	It("slow start max send window", func() {
 		const maxCongestionWindowTCP = 50
 		const numberOfAcks = 100
-		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindowTCP)
+		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindowTCP, nil)
 
 		for i := 0; i < numberOfAcks; i++ {
 			// Send our full send window.
@@ -414,7 +429,7 @@ var _ = Describe("Cubic Sender", func() {
 	It("tcp reno max congestion window", func() {
 		const maxCongestionWindowTCP = 50
 		const numberOfAcks = 1000
-		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindowTCP)
+		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindowTCP, nil)
 
 		SendAvailableSendWindow()
 		AckNPackets(2)
@@ -436,7 +451,7 @@ var _ = Describe("Cubic Sender", func() {
 		// Set to 10000 to compensate for small cubic alpha.
 		const numberOfAcks = 10000
 
-		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindowTCP)
+		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindowTCP, nil)
 
 		SendAvailableSendWindow()
 		AckNPackets(2)
@@ -456,7 +471,7 @@ var _ = Describe("Cubic Sender", func() {
 	It("tcp cubic reset epoch on quiescence", func() {
 		const maxCongestionWindow = 50
 		const maxCongestionWindowBytes = maxCongestionWindow * protocol.DefaultTCPMSS
-		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindow)
+		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindow, nil)
 
 		numSent := SendAvailableSendWindow()
 
@@ -496,7 +511,7 @@ var _ = Describe("Cubic Sender", func() {
 	It("tcp cubic shifted epoch on quiescence", func() {
 		const maxCongestionWindow = 50
 		const maxCongestionWindowBytes = maxCongestionWindow * protocol.DefaultTCPMSS
-		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindow)
+		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets, maxCongestionWindow, nil)
 
 		numSent := SendAvailableSendWindow()
 
@@ -790,4 +805,43 @@ var _ = Describe("Cubic Sender", func() {
 		Expect(sender.SlowstartThreshold()).To(Equal(MaxCongestionWindow))
 		Expect(sender.HybridSlowStart().Started()).To(BeFalse())
 	})
+
+	It("reports state changes", func() {
+		type event struct {
+			state State
+			cwnd  protocol.ByteCount
+		}
+		var events []event
+		sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets, MaxCongestionWindow, func(state State, cwnd protocol.ByteCount) {
+			events = append(events, event{state: state, cwnd: cwnd})
+		})
+		sender.SetNumEmulatedConnections(1)
+		for i := 0; i < 10; i++ {
+			SendAvailableSendWindow()
+			AckNPackets(2)
+		}
+		SendAvailableSendWindow()
+		// still in slow start
+		Expect(events).To(BeEmpty())
+		cwnd := sender.GetCongestionWindow()
+
+		// Lose a packet to enter recovery.
+		LoseNPackets(1)
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].state).To(Equal(StateRecovery))
+		Expect(events[0].cwnd).To(BeNumerically("<", cwnd))
+		Expect(events[0].cwnd).To(Equal(sender.GetCongestionWindow()))
+
+		// Ack all packets in the recovery window to exit recovery.
+		AckNPackets(int(cwnd / protocol.DefaultTCPMSS))
+		Expect(events).To(HaveLen(2))
+		Expect(events[1].state).To(Equal(StateCongestionAvoidance))
+		Expect(events[1].cwnd).To(Equal(events[0].cwnd))
+
+		// An RTO resets the sender to slow start.
+		sender.OnRetransmissionTimeout(true)
+		Expect(events).To(HaveLen(3))
+		Expect(events[2].state).To(Equal(StateSlowStart))
+		Expect(events[2].cwnd).To(Equal(protocol.ByteCount(defaultMinimumCongestionWindow) * protocol.DefaultTCPMSS))
+	})
 })
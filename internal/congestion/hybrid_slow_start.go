@@ -20,22 +20,50 @@ const hybridStartDelayFactorExp = 3 // 2^3 = 8
 const hybridStartDelayMinThresholdUs = int64(4000)
 const hybridStartDelayMaxThresholdUs = int64(16000)
 
-// HybridSlowStart implements the TCP hybrid slow start algorithm
+// ACKs that arrive less than 2ms apart belong to the same ACK train.
+const hybridStartAckDelta = 2 * time.Millisecond
+
+// During Conservative Slow Start, the congestion window grows 4 times slower than during slow start.
+const hybridStartCSSGrowthDivisor = 4
+
+// Slow start is exited after 5 rounds of Conservative Slow Start.
+const hybridStartCSSRounds = uint32(5)
+
+// HybridSlowStart implements HyStart++ (RFC 9406), together with the ACK train detection of the TCP hybrid slow start algorithm.
+// When the RTT of a round increases, it first enters Conservative Slow Start (CSS), instead of exiting slow start immediately.
+// If the RTT decreases again during CSS, the increase was spurious, and slow start is resumed.
+// Slow start is exited after hybridStartCSSRounds rounds of CSS, or when an ACK train longer than half the min RTT is detected.
 type HybridSlowStart struct {
 	endPacketNumber      protocol.PacketNumber
 	lastSentPacketNumber protocol.PacketNumber
 	started              bool
 	currentMinRTT        time.Duration
+	lastRoundMinRTT      time.Duration
 	rttSampleCount       uint32
 	hystartFound         bool
+
+	// the arrival time of the first ACK of the current round, and of the last ACK of the ACK train
+	roundStart  time.Time
+	lastAckTime time.Time
+
+	inConservativeSlowStart bool
+	cssBaselineMinRTT       time.Duration
+	cssRounds               uint32
 }
 
 // StartReceiveRound is called for the start of each receive round (burst) in the slow start phase.
 func (s *HybridSlowStart) StartReceiveRound(lastSent protocol.PacketNumber) {
 	s.endPacketNumber = lastSent
+	if s.currentMinRTT != 0 {
+		s.lastRoundMinRTT = s.currentMinRTT
+	}
 	s.currentMinRTT = 0
 	s.rttSampleCount = 0
+	s.roundStart = time.Time{}
 	s.started = true
+	if s.inConservativeSlowStart {
+		s.cssRounds++
+	}
 }
 
 // IsEndOfRound returns true if this ack is the last packet number of our current slow start round.
@@ -45,10 +73,11 @@ func (s *HybridSlowStart) IsEndOfRound(ack protocol.PacketNumber) bool {
 
 // ShouldExitSlowStart should be called on every new ack frame, since a new
 // RTT measurement can be made then.
+// ackTime: the time when the ack was received.
 // rtt: the RTT for this ack packet.
 // minRTT: is the lowest delay (RTT) we have seen during the session.
 // congestionWindow: the congestion window in packets.
-func (s *HybridSlowStart) ShouldExitSlowStart(latestRTT time.Duration, minRTT time.Duration, congestionWindow protocol.ByteCount) bool {
+func (s *HybridSlowStart) ShouldExitSlowStart(ackTime time.Time, latestRTT time.Duration, minRTT time.Duration, congestionWindow protocol.ByteCount) bool {
 	if !s.started {
 		// Time to start the hybrid slow start.
 		s.StartReceiveRound(s.lastSentPacketNumber)
@@ -56,9 +85,21 @@ func (s *HybridSlowStart) ShouldExitSlowStart(latestRTT time.Duration, minRTT ti
 	if s.hystartFound {
 		return true
 	}
+	// First detection parameter - ACK train detection.
+	// The ACKs of a burst of packets arrive closely spaced. If this train of ACKs
+	// lasts longer than half the min RTT, the congestion window exceeds the BDP.
+	if s.roundStart.IsZero() {
+		s.roundStart = ackTime
+		s.lastAckTime = ackTime
+	} else if ackTime.Sub(s.lastAckTime) <= hybridStartAckDelta {
+		s.lastAckTime = ackTime
+		if minRTT > 0 && ackTime.Sub(s.roundStart) >= minRTT/2 && congestionWindow >= hybridStartLowWindow {
+			s.hystartFound = true
+		}
+	}
 	// Second detection parameter - delay increase detection.
 	// Compare the minimum delay (s.currentMinRTT) of the current
-	// burst of packets relative to the minimum delay during the session.
+	// burst of packets relative to the minimum delay of the previous burst.
 	// Note: we only look at the first few(8) packets in each burst, since we
 	// only want to compare the lowest RTT of the burst relative to previous
 	// bursts.
@@ -70,21 +111,38 @@ func (s *HybridSlowStart) ShouldExitSlowStart(latestRTT time.Duration, minRTT ti
 	}
 	// We only need to check this once per round.
 	if s.rttSampleCount == hybridStartMinSamples {
-		// Divide minRTT by 8 to get a rtt increase threshold for exiting.
-		minRTTincreaseThresholdUs := int64(minRTT / time.Microsecond >> hybridStartDelayFactorExp)
-		// Ensure the rtt threshold is never less than 2ms or more than 16ms.
-		minRTTincreaseThresholdUs = utils.MinInt64(minRTTincreaseThresholdUs, hybridStartDelayMaxThresholdUs)
-		minRTTincreaseThreshold := time.Duration(utils.MaxInt64(minRTTincreaseThresholdUs, hybridStartDelayMinThresholdUs)) * time.Microsecond
+		if s.inConservativeSlowStart {
+			// The RTT decreased again, so the increase was spurious. Resume slow start.
+			if s.currentMinRTT < s.cssBaselineMinRTT {
+				s.inConservativeSlowStart = false
+			}
+		} else if s.lastRoundMinRTT != 0 {
+			// Divide the min RTT of the last round by 8 to get a rtt increase threshold for entering CSS.
+			minRTTincreaseThresholdUs := int64(s.lastRoundMinRTT / time.Microsecond >> hybridStartDelayFactorExp)
+			// Ensure the rtt threshold is never less than 4ms or more than 16ms.
+			minRTTincreaseThresholdUs = utils.MinInt64(minRTTincreaseThresholdUs, hybridStartDelayMaxThresholdUs)
+			minRTTincreaseThreshold := time.Duration(utils.MaxInt64(minRTTincreaseThresholdUs, hybridStartDelayMinThresholdUs)) * time.Microsecond
 
-		if s.currentMinRTT > (minRTT + minRTTincreaseThreshold) {
-			s.hystartFound = true
+			if s.currentMinRTT >= s.lastRoundMinRTT+minRTTincreaseThreshold {
+				s.inConservativeSlowStart = true
+				s.cssBaselineMinRTT = s.currentMinRTT
+				s.cssRounds = 0
+			}
 		}
 	}
+	if s.inConservativeSlowStart && s.cssRounds >= hybridStartCSSRounds {
+		s.hystartFound = true
+	}
 	// Exit from slow start if the cwnd is greater than 16 and
-	// increasing delay is found.
+	// an ACK train was detected, or CSS was completed.
 	return congestionWindow >= hybridStartLowWindow && s.hystartFound
 }
 
+// InConservativeSlowStart returns true if the RTT increased, and the congestion window should grow slower.
+func (s *HybridSlowStart) InConservativeSlowStart() bool {
+	return s.inConservativeSlowStart && !s.hystartFound
+}
+
 // OnPacketSent is called when a packet was sent
 func (s *HybridSlowStart) OnPacketSent(packetNumber protocol.PacketNumber) {
 	s.lastSentPacketNumber = packetNumber
@@ -108,4 +166,8 @@ func (s *HybridSlowStart) Started() bool {
 func (s *HybridSlowStart) Restart() {
 	s.started = false
 	s.hystartFound = false
+	s.lastRoundMinRTT = 0
+	s.currentMinRTT = 0
+	s.inConservativeSlowStart = false
+	s.cssRounds = 0
 }
@@ -47,29 +47,94 @@ var _ = Describe("Hybrid slow start", func() {
 		Expect(slowStart.IsEndOfRound(packetNumber)).To(BeTrue())
 	})
 
-	It("works with delay", func() {
+	It("enters conservative slow start when the delay increases", func() {
 		rtt := 60 * time.Millisecond
 		// We expect to detect the increase at +1/8 of the RTT; hence at a typical
 		// RTT of 60ms the detection will happen at 67.5 ms.
 		const hybridStartMinSamples = 8 // Number of acks required to trigger.
+		now := time.Now()
 
 		endPacketNumber := protocol.PacketNumber(1)
 		endPacketNumber++
 		slowStart.StartReceiveRound(endPacketNumber)
 
-		// Will not trigger since our lowest RTT in our burst is the same as the long
-		// term RTT provided.
+		// Will not trigger since there's no previous round to compare the RTT to.
 		for n := 0; n < hybridStartMinSamples; n++ {
-			Expect(slowStart.ShouldExitSlowStart(rtt+time.Duration(n)*time.Millisecond, rtt, 100)).To(BeFalse())
+			Expect(slowStart.ShouldExitSlowStart(now, rtt+time.Duration(n)*time.Millisecond, rtt, 100)).To(BeFalse())
+			now = now.Add(10 * time.Millisecond)
 		}
 		endPacketNumber++
 		slowStart.StartReceiveRound(endPacketNumber)
 		for n := 1; n < hybridStartMinSamples; n++ {
-			Expect(slowStart.ShouldExitSlowStart(rtt+(time.Duration(n)+10)*time.Millisecond, rtt, 100)).To(BeFalse())
+			Expect(slowStart.ShouldExitSlowStart(now, rtt+(time.Duration(n)+10)*time.Millisecond, rtt, 100)).To(BeFalse())
+			now = now.Add(10 * time.Millisecond)
+		}
+		Expect(slowStart.InConservativeSlowStart()).To(BeFalse())
+		// Expect to enter CSS since all packets in this burst were above the RTT of the last round.
+		Expect(slowStart.ShouldExitSlowStart(now, rtt+10*time.Millisecond, rtt, 100)).To(BeFalse())
+		Expect(slowStart.InConservativeSlowStart()).To(BeTrue())
+		// Slow start is exited after 5 CSS rounds.
+		for i := 0; i < 5; i++ {
+			endPacketNumber++
+			slowStart.StartReceiveRound(endPacketNumber)
+			now = now.Add(10 * time.Millisecond)
+			exit := slowStart.ShouldExitSlowStart(now, rtt+10*time.Millisecond, rtt, 100)
+			Expect(exit).To(Equal(i == 4))
+		}
+		Expect(slowStart.InConservativeSlowStart()).To(BeFalse())
+	})
+
+	It("resumes slow start when the delay decreases during conservative slow start", func() {
+		rtt := 60 * time.Millisecond
+		now := time.Now()
+		round := func(latestRTT time.Duration) bool {
+			slowStart.StartReceiveRound(protocol.PacketNumber(1))
+			var exit bool
+			for n := 0; n < 8; n++ {
+				exit = slowStart.ShouldExitSlowStart(now, latestRTT, rtt, 100)
+				now = now.Add(10 * time.Millisecond)
+			}
+			return exit
+		}
+		Expect(round(rtt)).To(BeFalse())
+		Expect(round(rtt + 10*time.Millisecond)).To(BeFalse())
+		Expect(slowStart.InConservativeSlowStart()).To(BeTrue())
+		Expect(round(rtt + 10*time.Millisecond)).To(BeFalse())
+		Expect(slowStart.InConservativeSlowStart()).To(BeTrue())
+		// the increase was spurious
+		Expect(round(rtt + 5*time.Millisecond)).To(BeFalse())
+		Expect(slowStart.InConservativeSlowStart()).To(BeFalse())
+	})
+
+	It("exits slow start when an ACK train longer than half the min RTT is detected", func() {
+		rtt := 60 * time.Millisecond
+		now := time.Now()
+		slowStart.StartReceiveRound(protocol.PacketNumber(100))
+		// ACKs arriving 1ms apart, for 29ms
+		for n := 0; n < 30; n++ {
+			Expect(slowStart.ShouldExitSlowStart(now, rtt, rtt, 100)).To(BeFalse())
+			now = now.Add(time.Millisecond)
+		}
+		Expect(slowStart.ShouldExitSlowStart(now, rtt, rtt, 100)).To(BeTrue())
+	})
+
+	It("doesn't detect ACK trains that are interrupted", func() {
+		rtt := 60 * time.Millisecond
+		now := time.Now()
+		slowStart.StartReceiveRound(protocol.PacketNumber(100))
+		for n := 0; n < 100; n++ {
+			Expect(slowStart.ShouldExitSlowStart(now, rtt, rtt, 100)).To(BeFalse())
+			now = now.Add(3 * time.Millisecond)
 		}
-		// Expect to trigger since all packets in this burst was above the long term
-		// RTT provided.
-		Expect(slowStart.ShouldExitSlowStart(rtt+10*time.Millisecond, rtt, 100)).To(BeTrue())
 	})
 
+	It("doesn't exit slow start for small congestion windows", func() {
+		rtt := 60 * time.Millisecond
+		now := time.Now()
+		slowStart.StartReceiveRound(protocol.PacketNumber(100))
+		for n := 0; n < 50; n++ {
+			Expect(slowStart.ShouldExitSlowStart(now, rtt, rtt, 10)).To(BeFalse())
+			now = now.Add(time.Millisecond)
+		}
+	})
 })
@@ -6,16 +6,79 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
-// A SendAlgorithm performs congestion control and calculates the congestion window
-type SendAlgorithm interface {
+// State is the state of the congestion controller
+type State uint8
+
+const (
+	// StateSlowStart is the slow start state
+	StateSlowStart State = iota
+	// StateCongestionAvoidance is the congestion avoidance state
+	StateCongestionAvoidance
+	// StateRecovery is the state after a loss event, until a packet sent after the loss is acknowledged
+	StateRecovery
+)
+
+func (s State) String() string {
+	switch s {
+	case StateSlowStart:
+		return "slow start"
+	case StateCongestionAvoidance:
+		return "congestion avoidance"
+	case StateRecovery:
+		return "recovery"
+	default:
+		return "unknown state"
+	}
+}
+
+// An EventHandler is called when the congestion controller transitions to a new state.
+// cwnd is the congestion window after the transition.
+type EventHandler func(state State, cwnd protocol.ByteCount)
+
+// A Controller performs congestion control.
+// It is informed about every packet that is sent, acknowledged and lost,
+// and decides how much data may be in flight, and when the next packet may be sent.
+// It is only accessed from the session's run loop, so implementations don't need to be safe for concurrent use.
+type Controller interface {
+	// TimeUntilSend returns the time that should pass after sending a packet, before the next packet is sent.
+	// It is used to pace packets. A return value of 0 disables pacing.
 	TimeUntilSend(bytesInFlight protocol.ByteCount) time.Duration
+	// OnPacketSent is called for every packet that is sent.
 	OnPacketSent(sentTime time.Time, bytesInFlight protocol.ByteCount, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool) bool
+	// GetCongestionWindow returns the congestion window.
+	// No more retransmittable packets are sent, if the bytes in flight exceed the congestion window.
 	GetCongestionWindow() protocol.ByteCount
+	// MaybeExitSlowStart is called when an ACK frame is received, before the acknowledged packets are reported.
 	MaybeExitSlowStart()
+	// OnPacketAcked is called for every retransmittable packet that is acknowledged.
 	OnPacketAcked(number protocol.PacketNumber, ackedBytes protocol.ByteCount, bytesInFlight protocol.ByteCount)
+	// OnPacketLost is called for every retransmittable packet that is declared lost.
 	OnPacketLost(number protocol.PacketNumber, lostBytes protocol.ByteCount, bytesInFlight protocol.ByteCount)
-	SetNumEmulatedConnections(n int)
+	// OnRetransmissionTimeout is called when the retransmission timer fires.
 	OnRetransmissionTimeout(packetsRetransmitted bool)
+}
+
+// RTTStatsReader gives read access to the RTT statistics of a connection
+type RTTStatsReader interface {
+	MinRTT() time.Duration
+	LatestRTT() time.Duration
+	SmoothedRTT() time.Duration
+	MeanDeviation() time.Duration
+}
+
+var _ RTTStatsReader = &RTTStats{}
+
+// A BandwidthEstimator is a Controller that estimates the bandwidth of the path.
+// The estimate is exposed to the application, see Session.BandwidthEstimate.
+type BandwidthEstimator interface {
+	// BandwidthEstimate returns the estimated bandwidth. It returns 0 if the bandwidth is not known yet.
+	BandwidthEstimate() Bandwidth
+}
+
+// A SendAlgorithm performs congestion control and calculates the congestion window
+type SendAlgorithm interface {
+	Controller
+	SetNumEmulatedConnections(n int)
 	OnConnectionMigration()
 
 	// Experiments
@@ -25,7 +88,7 @@ type SendAlgorithm interface {
 // SendAlgorithmWithDebugInfo adds some debug functions to SendAlgorithm
 type SendAlgorithmWithDebugInfo interface {
 	SendAlgorithm
-	BandwidthEstimate() Bandwidth
+	BandwidthEstimator
 
 	// Stuff only used in testing
 
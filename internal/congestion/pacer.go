@@ -0,0 +1,98 @@
+package congestion
+
+import (
+	"math"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A Pacer paces packets using a token bucket.
+// The bucket is filled at the pacing rate, and holds at most the maximum burst size.
+// Sending a packet takes the number of bytes of the packet from the bucket.
+// This allows sending a burst of packets after the connection was idle, but limits the rate of bulk transfers to the pacing rate.
+type Pacer struct {
+	rate        Bandwidth
+	rateKnown   bool
+	initialRate Bandwidth
+	maxBurst    protocol.ByteCount
+
+	budgetAtLastSent protocol.ByteCount
+	lastSentTime     time.Time
+}
+
+// NewPacer creates a new Pacer.
+// The initialRate is used until the first pacing rate is set. If it is 0, packets are not paced until then.
+// The maxBurstPackets is the maximum number of full-sized packets sent back-to-back. If it is 0, protocol.DefaultMaxPacingBurst is used.
+func NewPacer(initialRate Bandwidth, maxBurstPackets int) *Pacer {
+	if maxBurstPackets <= 0 {
+		maxBurstPackets = protocol.DefaultMaxPacingBurst
+	}
+	return &Pacer{
+		initialRate:      initialRate,
+		maxBurst:         protocol.ByteCount(maxBurstPackets) * protocol.DefaultTCPMSS,
+		budgetAtLastSent: protocol.ByteCount(maxBurstPackets) * protocol.DefaultTCPMSS,
+	}
+}
+
+// SetRate sets the pacing rate. A rate of 0 means that packets are not paced.
+// Until the first non-zero rate is set, the initial rate is used.
+func (p *Pacer) SetRate(rate Bandwidth) {
+	if rate != 0 {
+		p.rateKnown = true
+	}
+	p.rate = rate
+}
+
+func (p *Pacer) getRate() Bandwidth {
+	if !p.rateKnown {
+		return p.initialRate
+	}
+	return p.rate
+}
+
+// Budget returns the number of bytes that can be sent at time now.
+func (p *Pacer) Budget(now time.Time) protocol.ByteCount {
+	rate := p.getRate()
+	if rate == 0 || p.lastSentTime.IsZero() {
+		return p.maxBurst
+	}
+	budget := float64(p.budgetAtLastSent) + float64(rate)/float64(BytesPerSecond)*now.Sub(p.lastSentTime).Seconds()
+	if budget >= float64(p.maxBurst) {
+		return p.maxBurst
+	}
+	return protocol.ByteCount(budget)
+}
+
+// SentPacket is called for every packet sent.
+func (p *Pacer) SentPacket(sendTime time.Time, size protocol.ByteCount) {
+	budget := p.Budget(sendTime)
+	if size > budget {
+		p.budgetAtLastSent = 0
+	} else {
+		p.budgetAtLastSent = budget - size
+	}
+	p.lastSentTime = sendTime
+}
+
+// TimeUntilSend returns the time when the next full-sized packet can be sent.
+// No packet is scheduled less than protocol.MinPacingDelay after the last packet, so that multiple packets are sent at once at high pacing rates.
+// It returns the zero time if no packet was sent yet.
+func (p *Pacer) TimeUntilSend() time.Time {
+	rate := p.getRate()
+	if p.budgetAtLastSent >= protocol.DefaultTCPMSS || rate == 0 {
+		return p.lastSentTime
+	}
+	delay := time.Duration(math.Ceil(float64(protocol.DefaultTCPMSS-p.budgetAtLastSent) * float64(BytesPerSecond) / float64(rate) * float64(time.Second)))
+	return p.lastSentTime.Add(utils.MaxDuration(protocol.MinPacingDelay, delay))
+}
+
+// Reset resets the Pacer, when the connection migrates to a new path.
+// The initial rate is used until a new pacing rate is set.
+func (p *Pacer) Reset() {
+	p.rate = 0
+	p.rateKnown = false
+	p.budgetAtLastSent = p.maxBurst
+	p.lastSentTime = time.Time{}
+}
@@ -0,0 +1,97 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pacer", func() {
+	var p *Pacer
+
+	// 100 full-sized packets per second
+	const packetsPerSecond = 100
+	rate := BandwidthFromDelta(packetsPerSecond*protocol.DefaultTCPMSS, time.Second)
+
+	BeforeEach(func() {
+		p = NewPacer(0, 0)
+		p.SetRate(rate)
+	})
+
+	It("allows a burst at the beginning", func() {
+		t := time.Now()
+		Expect(p.TimeUntilSend()).To(BeZero())
+		Expect(p.Budget(t)).To(Equal(protocol.DefaultMaxPacingBurst * protocol.DefaultTCPMSS))
+	})
+
+	It("paces packets after a burst", func() {
+		t := time.Now()
+		for i := 0; i < protocol.DefaultMaxPacingBurst; i++ {
+			Expect(p.TimeUntilSend()).To(Or(BeZero(), Equal(t)))
+			p.SentPacket(t, protocol.DefaultTCPMSS)
+		}
+		Expect(p.Budget(t)).To(BeZero())
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(time.Second / packetsPerSecond)))
+		t = t.Add(time.Second / packetsPerSecond)
+		Expect(p.Budget(t)).To(Equal(protocol.DefaultTCPMSS))
+		p.SentPacket(t, protocol.DefaultTCPMSS)
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(time.Second / packetsPerSecond)))
+	})
+
+	It("doesn't accumulate more budget than the maximum burst size", func() {
+		t := time.Now()
+		p.SentPacket(t, protocol.DefaultTCPMSS)
+		Expect(p.Budget(t.Add(time.Hour))).To(Equal(protocol.DefaultMaxPacingBurst * protocol.DefaultTCPMSS))
+	})
+
+	It("uses the configured burst size", func() {
+		p = NewPacer(rate, 3)
+		t := time.Now()
+		Expect(p.Budget(t)).To(Equal(3 * protocol.DefaultTCPMSS))
+		for i := 0; i < 3; i++ {
+			p.SentPacket(t, protocol.DefaultTCPMSS)
+		}
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(time.Second / packetsPerSecond)))
+	})
+
+	It("uses the initial rate until a rate is set", func() {
+		p = NewPacer(rate/2, 1)
+		t := time.Now()
+		p.SentPacket(t, protocol.DefaultTCPMSS)
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(2 * time.Second / packetsPerSecond)))
+		p.SetRate(rate)
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(time.Second / packetsPerSecond)))
+		// once a rate was set, a rate of 0 disables pacing
+		p.SetRate(0)
+		Expect(p.TimeUntilSend()).To(Equal(t))
+	})
+
+	It("doesn't pace packets without a rate", func() {
+		p = NewPacer(0, 1)
+		t := time.Now()
+		p.SentPacket(t, protocol.DefaultTCPMSS)
+		p.SentPacket(t, protocol.DefaultTCPMSS)
+		Expect(p.TimeUntilSend()).To(Equal(t))
+		Expect(p.Budget(t)).To(Equal(protocol.DefaultTCPMSS))
+	})
+
+	It("doesn't schedule packets closer than the minimum pacing delay", func() {
+		p.SetRate(BandwidthFromDelta(protocol.DefaultTCPMSS, protocol.MinPacingDelay/10))
+		t := time.Now()
+		p.SentPacket(t, protocol.DefaultMaxPacingBurst*protocol.DefaultTCPMSS)
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(protocol.MinPacingDelay)))
+		// after the minimum pacing delay, multiple packets can be sent
+		Expect(p.Budget(t.Add(protocol.MinPacingDelay))).To(BeNumerically(">=", 9*protocol.DefaultTCPMSS))
+	})
+
+	It("resets", func() {
+		t := time.Now()
+		p.SentPacket(t, protocol.DefaultMaxPacingBurst*protocol.DefaultTCPMSS)
+		p.Reset()
+		Expect(p.TimeUntilSend()).To(BeZero())
+		Expect(p.Budget(t)).To(Equal(protocol.DefaultMaxPacingBurst * protocol.DefaultTCPMSS))
+	})
+})
@@ -0,0 +1,44 @@
+package congestion
+
+// A maxBandwidthFilter keeps track of the maximum bandwidth sample seen during the last round trips.
+type maxBandwidthFilter struct {
+	windowLength uint64 // in round trips
+
+	// samples that might become the maximum, once the larger samples expire
+	// The bandwidth is decreasing, the round trip count is increasing.
+	samples []bandwidthFilterSample
+}
+
+type bandwidthFilterSample struct {
+	bandwidth Bandwidth
+	round     uint64
+}
+
+func newMaxBandwidthFilter(windowLength uint64) *maxBandwidthFilter {
+	return &maxBandwidthFilter{windowLength: windowLength}
+}
+
+// Update adds a new sample, taken during the given round trip
+func (f *maxBandwidthFilter) Update(bw Bandwidth, round uint64) {
+	// samples that are smaller than the new sample will never become the maximum
+	for len(f.samples) > 0 && f.samples[len(f.samples)-1].bandwidth <= bw {
+		f.samples = f.samples[:len(f.samples)-1]
+	}
+	f.samples = append(f.samples, bandwidthFilterSample{bandwidth: bw, round: round})
+	for f.samples[0].round+f.windowLength <= round {
+		f.samples = f.samples[1:]
+	}
+}
+
+// Get returns the maximum bandwidth
+func (f *maxBandwidthFilter) Get() Bandwidth {
+	if len(f.samples) == 0 {
+		return 0
+	}
+	return f.samples[0].bandwidth
+}
+
+// Reset removes all samples
+func (f *maxBandwidthFilter) Reset() {
+	f.samples = nil
+}
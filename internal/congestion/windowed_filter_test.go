@@ -0,0 +1,44 @@
+package congestion
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Max bandwidth filter", func() {
+	var filter *maxBandwidthFilter
+
+	BeforeEach(func() {
+		filter = newMaxBandwidthFilter(3)
+	})
+
+	It("returns 0 if there are no samples", func() {
+		Expect(filter.Get()).To(BeZero())
+	})
+
+	It("returns the maximum sample", func() {
+		filter.Update(100, 1)
+		filter.Update(300, 1)
+		filter.Update(200, 2)
+		Expect(filter.Get()).To(Equal(Bandwidth(300)))
+	})
+
+	It("expires samples", func() {
+		filter.Update(300, 1)
+		filter.Update(200, 2)
+		filter.Update(100, 3)
+		Expect(filter.Get()).To(Equal(Bandwidth(300)))
+		filter.Update(50, 4)
+		Expect(filter.Get()).To(Equal(Bandwidth(200)))
+		filter.Update(50, 5)
+		Expect(filter.Get()).To(Equal(Bandwidth(100)))
+		filter.Update(50, 100)
+		Expect(filter.Get()).To(Equal(Bandwidth(50)))
+	})
+
+	It("resets", func() {
+		filter.Update(300, 1)
+		filter.Reset()
+		Expect(filter.Get()).To(BeZero())
+	})
+})
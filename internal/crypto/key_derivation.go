@@ -11,6 +11,8 @@ import (
 const (
 	clientExporterLabel = "EXPORTER-QUIC client 1rtt"
 	serverExporterLabel = "EXPORTER-QUIC server 1rtt"
+
+	keyUpdateLabel = "key update"
 )
 
 // A TLSExporter gets the negotiated ciphersuite and computes exporter
@@ -19,6 +21,36 @@ type TLSExporter interface {
 	ComputeExporter(label string, context []byte, keyLength int) ([]byte, error)
 }
 
+// NextAEADFunc derives the AEAD for the next key phase.
+// It is used for updating the 1-RTT keys.
+type NextAEADFunc func() (AEAD, NextAEADFunc, error)
+
+// OneRTTSecrets are the secrets that the 1-RTT keys of a key phase are derived from.
+// They are used to continue a connection in another process, and must be kept confidential.
+type OneRTTSecrets struct {
+	CipherSuite mint.CipherSuiteParams
+	MySecret    []byte
+	OtherSecret []byte
+}
+
+// A SecretsExporter is an AEAD that can export the secrets that it was derived from.
+// The AEADs returned by DeriveAESKeys implement it.
+type SecretsExporter interface {
+	Secrets() OneRTTSecrets
+}
+
+// aeadWithSecrets is an AEAD that retains the secrets that it was derived from
+type aeadWithSecrets struct {
+	AEAD
+	secrets OneRTTSecrets
+}
+
+var _ SecretsExporter = &aeadWithSecrets{}
+
+func (a *aeadWithSecrets) Secrets() OneRTTSecrets {
+	return a.secrets
+}
+
 func qhkdfExpand(secret []byte, label string, length int) []byte {
 	qlabel := make([]byte, 2+1+5+len(label))
 	binary.BigEndian.PutUint16(qlabel[0:2], uint16(length))
@@ -27,8 +59,10 @@ func qhkdfExpand(secret []byte, label string, length int) []byte {
 	return mint.HkdfExpand(crypto.SHA256, secret, qlabel, length)
 }
 
-// DeriveAESKeys derives the AES keys and creates a matching AES-GCM AEAD instance
-func DeriveAESKeys(tls TLSExporter, pers protocol.Perspective) (AEAD, error) {
+// DeriveAESKeys derives the AES keys and creates a matching AES-GCM AEAD instance.
+// It also returns a function that derives the AEAD for the next key phase.
+// If the TLSExporter implements the KeyLogger, the secrets are written to the key log.
+func DeriveAESKeys(tls TLSExporter, pers protocol.Perspective) (AEAD, NextAEADFunc, error) {
 	var myLabel, otherLabel string
 	if pers == protocol.PerspectiveClient {
 		myLabel = clientExporterLabel
@@ -37,24 +71,58 @@ func DeriveAESKeys(tls TLSExporter, pers protocol.Perspective) (AEAD, error) {
 		myLabel = serverExporterLabel
 		otherLabel = clientExporterLabel
 	}
-	myKey, myIV, err := computeKeyAndIV(tls, myLabel)
+	cs := tls.GetCipherSuite()
+	mySecret, err := tls.ComputeExporter(myLabel, nil, cs.Hash.Size())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	otherKey, otherIV, err := computeKeyAndIV(tls, otherLabel)
+	otherSecret, err := tls.ComputeExporter(otherLabel, nil, cs.Hash.Size())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return NewAEADAESGCM(otherKey, myKey, otherIV, myIV)
+	return deriveAESKeysFromSecrets(cs, mySecret, otherSecret, newKeyLog(tls, pers), 0)
 }
 
-func computeKeyAndIV(tls TLSExporter, label string) (key, iv []byte, err error) {
-	cs := tls.GetCipherSuite()
-	secret, err := tls.ComputeExporter(label, nil, cs.Hash.Size())
+// DeriveAESKeysFromSecrets creates the AES-GCM AEAD for secrets exported by a SecretsExporter.
+// Like DeriveAESKeys, it also returns a function that derives the AEAD for the next key phase.
+// The secrets are not written to a key log.
+func DeriveAESKeysFromSecrets(secrets OneRTTSecrets) (AEAD, NextAEADFunc, error) {
+	return deriveAESKeysFromSecrets(secrets.CipherSuite, secrets.MySecret, secrets.OtherSecret, nil, 0)
+}
+
+func deriveAESKeysFromSecrets(cs mint.CipherSuiteParams, mySecret, otherSecret []byte, keyLog *keyLog, keyPhase int) (AEAD, NextAEADFunc, error) {
+	if err := keyLog.logSecrets(keyPhase, mySecret, otherSecret); err != nil {
+		return nil, nil, err
+	}
+	myKey, myIV := computeKeyAndIV(cs, mySecret)
+	otherKey, otherIV := computeKeyAndIV(cs, otherSecret)
+	aesgcm, err := NewAEADAESGCM(otherKey, myKey, otherIV, myIV)
 	if err != nil {
 		return nil, nil, err
 	}
+	aead := &aeadWithSecrets{
+		AEAD: aesgcm,
+		secrets: OneRTTSecrets{
+			CipherSuite: cs,
+			MySecret:    mySecret,
+			OtherSecret: otherSecret,
+		},
+	}
+	// the secrets of the next key phase are derived from the secrets of this key phase
+	next := func() (AEAD, NextAEADFunc, error) {
+		return deriveAESKeysFromSecrets(
+			cs,
+			qhkdfExpand(mySecret, keyUpdateLabel, len(mySecret)),
+			qhkdfExpand(otherSecret, keyUpdateLabel, len(otherSecret)),
+			keyLog,
+			keyPhase+1,
+		)
+	}
+	return aead, next, nil
+}
+
+func computeKeyAndIV(cs mint.CipherSuiteParams, secret []byte) (key, iv []byte) {
 	key = qhkdfExpand(secret, "key", cs.KeyLen)
 	iv = qhkdfExpand(secret, "iv", cs.IvLen)
-	return key, iv, nil
+	return key, iv
 }
@@ -21,6 +21,22 @@ import (
 
 // DeriveQuicCryptoAESKeys derives the client and server keys and creates a matching AES-GCM AEAD instance
 func DeriveQuicCryptoAESKeys(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (AEAD, error) {
+	return deriveQuicCryptoAESKeys(nil, forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, pers)
+}
+
+// NewQuicCryptoAESKeyDerivation returns a function that derives the keys like DeriveQuicCryptoAESKeys.
+// If keyLog is not nil, the derived keys and IVs are written to it, using the NSS key log format.
+// Since there's no client random in gQUIC, they are identified by the connection ID.
+func NewQuicCryptoAESKeyDerivation(keyLog io.Writer) func(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (AEAD, error) {
+	if keyLog == nil {
+		return DeriveQuicCryptoAESKeys
+	}
+	return func(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (AEAD, error) {
+		return deriveQuicCryptoAESKeys(keyLog, forwardSecure, sharedSecret, nonces, connID, chlo, scfg, cert, divNonce, pers)
+	}
+}
+
+func deriveQuicCryptoAESKeys(keyLog io.Writer, forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo []byte, scfg []byte, cert []byte, divNonce []byte, pers protocol.Perspective) (AEAD, error) {
 	var swap bool
 	if pers == protocol.PerspectiveClient {
 		swap = true
@@ -29,9 +45,41 @@ func DeriveQuicCryptoAESKeys(forwardSecure bool, sharedSecret, nonces []byte, co
 	if err != nil {
 		return nil, err
 	}
+	if keyLog != nil {
+		if err := logQuicCryptoKeys(keyLog, forwardSecure, connID, otherKey, myKey, otherIV, myIV, pers); err != nil {
+			return nil, err
+		}
+	}
 	return NewAEADAESGCM12(otherKey, myKey, otherIV, myIV)
 }
 
+// logQuicCryptoKeys writes the keys and IVs to the key log.
+// They are logged as GQUIC_<CLIENT|SERVER>_<SECURE|FORWARD_SECURE>_<KEY|IV>.
+func logQuicCryptoKeys(keyLog io.Writer, forwardSecure bool, connID protocol.ConnectionID, otherKey, myKey, otherIV, myIV []byte, pers protocol.Perspective) error {
+	encLevel := "SECURE"
+	if forwardSecure {
+		encLevel = "FORWARD_SECURE"
+	}
+	clientKey, serverKey, clientIV, serverIV := myKey, otherKey, myIV, otherIV
+	if pers == protocol.PerspectiveServer {
+		clientKey, serverKey, clientIV, serverIV = otherKey, myKey, otherIV, myIV
+	}
+	for _, l := range []struct {
+		label string
+		value []byte
+	}{
+		{"GQUIC_CLIENT_" + encLevel + "_KEY", clientKey},
+		{"GQUIC_CLIENT_" + encLevel + "_IV", clientIV},
+		{"GQUIC_SERVER_" + encLevel + "_KEY", serverKey},
+		{"GQUIC_SERVER_" + encLevel + "_IV", serverIV},
+	} {
+		if err := writeKeyLog(keyLog, l.label, connID, l.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // deriveKeys derives the keys and the IVs
 // swap should be set true if generating the values for the client, and false for the server
 func deriveKeys(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo, scfg, cert, divNonce []byte, keyLen int, swap bool) ([]byte, []byte, []byte, []byte, error) {
@@ -1,6 +1,10 @@
 package crypto
 
 import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 
 	. "github.com/onsi/ginkgo"
@@ -193,5 +197,47 @@ var _ = Describe("QUIC Crypto Key Derivation", func() {
 			Expect(aesgcm.myIV).To(Equal([]byte{0x7, 0xad, 0xab, 0xb8}))
 			Expect(aesgcm.otherIV).To(Equal([]byte{0xf2, 0x7a, 0xcc, 0x42}))
 		})
+
+		It("writes the keys to the key log", func() {
+			keyLog := &bytes.Buffer{}
+			aead, err := NewQuicCryptoAESKeyDerivation(keyLog)(
+				true,
+				[]byte("0123456789012345678901"),
+				[]byte("nonce"),
+				protocol.ConnectionID([]byte{42, 0, 0, 0, 0, 0, 0, 0}),
+				[]byte("chlo"),
+				[]byte("scfg"),
+				[]byte("cert"),
+				nil,
+				protocol.PerspectiveServer,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			aesgcm := aead.(*aeadAESGCM12)
+			lines := strings.Split(strings.TrimSpace(keyLog.String()), "\n")
+			Expect(lines).To(HaveLen(4))
+			Expect(lines[0]).To(HavePrefix("GQUIC_CLIENT_FORWARD_SECURE_KEY 2a00000000000000 "))
+			Expect(lines[1]).To(Equal("GQUIC_CLIENT_FORWARD_SECURE_IV 2a00000000000000 " + hex.EncodeToString(aesgcm.otherIV)))
+			Expect(lines[2]).To(HavePrefix("GQUIC_SERVER_FORWARD_SECURE_KEY 2a00000000000000 "))
+			Expect(lines[3]).To(Equal("GQUIC_SERVER_FORWARD_SECURE_IV 2a00000000000000 " + hex.EncodeToString(aesgcm.myIV)))
+		})
+
+		It("logs the keys of the client", func() {
+			keyLog := &bytes.Buffer{}
+			aead, err := NewQuicCryptoAESKeyDerivation(keyLog)(
+				false,
+				[]byte("0123456789012345678901"),
+				[]byte("nonce"),
+				protocol.ConnectionID([]byte{42, 0, 0, 0, 0, 0, 0, 0}),
+				[]byte("chlo"),
+				[]byte("scfg"),
+				[]byte("cert"),
+				[]byte("divnonce"),
+				protocol.PerspectiveClient,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			aesgcm := aead.(*aeadAESGCM12)
+			Expect(keyLog.String()).To(ContainSubstring("GQUIC_CLIENT_SECURE_IV 2a00000000000000 " + hex.EncodeToString(aesgcm.myIV) + "\n"))
+			Expect(keyLog.String()).To(ContainSubstring("GQUIC_SERVER_SECURE_IV 2a00000000000000 " + hex.EncodeToString(aesgcm.otherIV) + "\n"))
+		})
 	})
 })
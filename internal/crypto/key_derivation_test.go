@@ -1,8 +1,12 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto"
+	"encoding/hex"
 	"errors"
+	"io"
+	"strings"
 
 	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -34,11 +38,23 @@ func (c *mockTLSExporter) ComputeExporter(label string, context []byte, keyLengt
 	return append([]byte(label), context...), nil
 }
 
+type keyLoggingTLSExporter struct {
+	mockTLSExporter
+	keyLog       io.Writer
+	clientRandom []byte
+}
+
+var _ KeyLogger = &keyLoggingTLSExporter{}
+
+func (c *keyLoggingTLSExporter) GetKeyLog() (io.Writer, []byte) {
+	return c.keyLog, c.clientRandom
+}
+
 var _ = Describe("Key Derivation", func() {
 	It("derives keys", func() {
-		clientAEAD, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveClient)
+		clientAEAD, _, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveClient)
 		Expect(err).ToNot(HaveOccurred())
-		serverAEAD, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveServer)
+		serverAEAD, _, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveServer)
 		Expect(err).ToNot(HaveOccurred())
 		ciphertext := clientAEAD.Seal(nil, []byte("foobar"), 0, []byte("aad"))
 		data, err := serverAEAD.Open(nil, ciphertext, 0, []byte("aad"))
@@ -46,9 +62,104 @@ var _ = Describe("Key Derivation", func() {
 		Expect(data).To(Equal([]byte("foobar")))
 	})
 
+	It("derives the keys for the next key phase", func() {
+		clientAEAD, clientNext, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveClient)
+		Expect(err).ToNot(HaveOccurred())
+		serverAEAD, serverNext, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveServer)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 3; i++ {
+			nextClientAEAD, nextClientNext, err := clientNext()
+			Expect(err).ToNot(HaveOccurred())
+			nextServerAEAD, nextServerNext, err := serverNext()
+			Expect(err).ToNot(HaveOccurred())
+			ciphertext := nextClientAEAD.Seal(nil, []byte("foobar"), 0, []byte("aad"))
+			data, err := nextServerAEAD.Open(nil, ciphertext, 0, []byte("aad"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+			// the keys of the previous key phase can't be used to decrypt the packet
+			_, err = serverAEAD.Open(nil, ciphertext, 0, []byte("aad"))
+			Expect(err).To(HaveOccurred())
+			Expect(ciphertext).ToNot(Equal(clientAEAD.Seal(nil, []byte("foobar"), 0, []byte("aad"))))
+			clientAEAD, clientNext = nextClientAEAD, nextClientNext
+			serverAEAD, serverNext = nextServerAEAD, nextServerNext
+		}
+	})
+
+	It("derives the same keys from the exported secrets", func() {
+		_, clientNext, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveClient)
+		Expect(err).ToNot(HaveOccurred())
+		_, serverNext, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveServer)
+		Expect(err).ToNot(HaveOccurred())
+		// export the secrets of the second key phase
+		_, clientNext, err = clientNext()
+		Expect(err).ToNot(HaveOccurred())
+		serverAEAD, _, err := serverNext()
+		Expect(err).ToNot(HaveOccurred())
+		secrets := serverAEAD.(SecretsExporter).Secrets()
+		Expect(secrets.CipherSuite.KeyLen).To(Equal(32))
+		importedAEAD, importedNext, err := DeriveAESKeysFromSecrets(secrets)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(importedAEAD.Seal(nil, []byte("foobar"), 0, []byte("aad"))).To(Equal(serverAEAD.Seal(nil, []byte("foobar"), 0, []byte("aad"))))
+		// the imported keys are updated like the original keys
+		nextClientAEAD, _, err := clientNext()
+		Expect(err).ToNot(HaveOccurred())
+		nextImportedAEAD, _, err := importedNext()
+		Expect(err).ToNot(HaveOccurred())
+		ciphertext := nextClientAEAD.Seal(nil, []byte("foobar"), 0, []byte("aad"))
+		data, err := nextImportedAEAD.Open(nil, ciphertext, 0, []byte("aad"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
 	It("fails when computing the exporter fails", func() {
 		testErr := errors.New("test error")
-		_, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256, computerError: testErr}, protocol.PerspectiveClient)
+		_, _, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256, computerError: testErr}, protocol.PerspectiveClient)
 		Expect(err).To(MatchError(testErr))
 	})
+
+	Context("key logging", func() {
+		It("writes the secrets to the key log", func() {
+			keyLog := &bytes.Buffer{}
+			exporter := &keyLoggingTLSExporter{
+				mockTLSExporter: mockTLSExporter{hash: crypto.SHA256},
+				keyLog:          keyLog,
+				clientRandom:    []byte{0xde, 0xca, 0xfb, 0xad},
+			}
+			_, next, err := DeriveAESKeys(exporter, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyLog.String()).To(Equal(
+				"QUIC_CLIENT_TRAFFIC_SECRET_0 decafbad " + hex.EncodeToString([]byte(clientExporterLabel)) + "\n" +
+					"QUIC_SERVER_TRAFFIC_SECRET_0 decafbad " + hex.EncodeToString([]byte(serverExporterLabel)) + "\n",
+			))
+			keyLog.Reset()
+			_, next, err = next()
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = next()
+			Expect(err).ToNot(HaveOccurred())
+			lines := strings.Split(strings.TrimSpace(keyLog.String()), "\n")
+			Expect(lines).To(HaveLen(4))
+			Expect(lines[0]).To(HavePrefix("QUIC_CLIENT_TRAFFIC_SECRET_1 decafbad "))
+			Expect(lines[1]).To(HavePrefix("QUIC_SERVER_TRAFFIC_SECRET_1 decafbad "))
+			Expect(lines[2]).To(HavePrefix("QUIC_CLIENT_TRAFFIC_SECRET_2 decafbad "))
+			Expect(lines[3]).To(HavePrefix("QUIC_SERVER_TRAFFIC_SECRET_2 decafbad "))
+		})
+
+		It("logs the secrets of the client", func() {
+			keyLog := &bytes.Buffer{}
+			exporter := &keyLoggingTLSExporter{
+				mockTLSExporter: mockTLSExporter{hash: crypto.SHA256},
+				keyLog:          keyLog,
+				clientRandom:    []byte{0xde, 0xca, 0xfb, 0xad},
+			}
+			_, _, err := DeriveAESKeys(exporter, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyLog.String()).To(HavePrefix("QUIC_CLIENT_TRAFFIC_SECRET_0 decafbad " + hex.EncodeToString([]byte(clientExporterLabel)) + "\n"))
+		})
+
+		It("doesn't log anything if there's no key log", func() {
+			exporter := &keyLoggingTLSExporter{mockTLSExporter: mockTLSExporter{hash: crypto.SHA256}}
+			_, _, err := DeriveAESKeys(exporter, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
 })
@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A KeyLogger provides the key log that the secrets of a connection are written to, see tls.Config.KeyLogWriter.
+// A TLSExporter can implement it to have the secrets used to derive the 1-RTT keys written to the key log.
+type KeyLogger interface {
+	// GetKeyLog returns the key log, and the client random that identifies the connection in the key log.
+	// The key log is nil if the secrets should not be logged.
+	GetKeyLog() (io.Writer, []byte)
+}
+
+// the key log is shared between connections, so lines must not be interleaved
+var keyLogMutex sync.Mutex
+
+// writeKeyLog writes a line in the NSS key log format.
+func writeKeyLog(w io.Writer, label string, id, secret []byte) error {
+	keyLogMutex.Lock()
+	defer keyLogMutex.Unlock()
+	_, err := fmt.Fprintf(w, "%s %x %x\n", label, id, secret)
+	return err
+}
+
+// The keyLog writes the 1-RTT secrets of one connection.
+// The secrets of the n-th key phase are logged as QUIC_CLIENT_TRAFFIC_SECRET_n and QUIC_SERVER_TRAFFIC_SECRET_n.
+type keyLog struct {
+	w            io.Writer
+	clientRandom []byte
+	perspective  protocol.Perspective
+}
+
+func newKeyLog(tls TLSExporter, pers protocol.Perspective) *keyLog {
+	kl, ok := tls.(KeyLogger)
+	if !ok {
+		return nil
+	}
+	w, clientRandom := kl.GetKeyLog()
+	if w == nil {
+		return nil
+	}
+	return &keyLog{w: w, clientRandom: clientRandom, perspective: pers}
+}
+
+func (l *keyLog) logSecrets(keyPhase int, mySecret, otherSecret []byte) error {
+	if l == nil {
+		return nil
+	}
+	clientSecret, serverSecret := mySecret, otherSecret
+	if l.perspective == protocol.PerspectiveServer {
+		clientSecret, serverSecret = otherSecret, mySecret
+	}
+	if err := writeKeyLog(l.w, fmt.Sprintf("QUIC_CLIENT_TRAFFIC_SECRET_%d", keyPhase), l.clientRandom, clientSecret); err != nil {
+		return err
+	}
+	return writeKeyLog(l.w, fmt.Sprintf("QUIC_SERVER_TRAFFIC_SECRET_%d", keyPhase), l.clientRandom, serverSecret)
+}
@@ -29,6 +29,47 @@ type baseFlowController struct {
 	logger utils.Logger
 }
 
+// State is the state of a flow controller.
+// It is used to continue a connection in another process.
+type State struct {
+	BytesSent         protocol.ByteCount
+	SendWindow        protocol.ByteCount
+	BytesRead         protocol.ByteCount
+	HighestReceived   protocol.ByteCount
+	ReceiveWindow     protocol.ByteCount
+	ReceiveWindowSize protocol.ByteCount
+}
+
+// GetState returns the state of the flow controller
+func (c *baseFlowController) GetState() State {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return State{
+		BytesSent:         c.bytesSent,
+		SendWindow:        c.sendWindow,
+		BytesRead:         c.bytesRead,
+		HighestReceived:   c.highestReceived,
+		ReceiveWindow:     c.receiveWindow,
+		ReceiveWindowSize: c.receiveWindowSize,
+	}
+}
+
+// SetState restores the state of the flow controller.
+// It must be called before the flow controller is used.
+func (c *baseFlowController) SetState(s State) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.bytesSent = s.BytesSent
+	c.sendWindow = s.SendWindow
+	c.bytesRead = s.BytesRead
+	c.highestReceived = s.HighestReceived
+	c.receiveWindow = s.ReceiveWindow
+	c.receiveWindowSize = utils.MinByteCount(s.ReceiveWindowSize, c.maxReceiveWindowSize)
+	if c.bytesRead > 0 {
+		c.startNewAutoTuningEpoch()
+	}
+}
+
 func (c *baseFlowController) AddBytesSent(n protocol.ByteCount) {
 	c.bytesSent += n
 }
@@ -61,6 +102,14 @@ func (c *baseFlowController) AddBytesRead(n protocol.ByteCount) {
 	c.bytesRead += n
 }
 
+// GetReceiveWindow returns the highest offset the peer is allowed to send.
+// This is the offset of the last window update.
+func (c *baseFlowController) GetReceiveWindow() protocol.ByteCount {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.receiveWindow
+}
+
 func (c *baseFlowController) hasWindowUpdate() bool {
 	bytesRemaining := c.receiveWindow - c.bytesRead
 	// update the window when more than the threshold was consumed
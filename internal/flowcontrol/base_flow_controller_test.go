@@ -91,6 +91,14 @@ var _ = Describe("Base Flow controller", func() {
 			Expect(controller.receiveWindow).To(Equal(readPosition + receiveWindowSize))
 		})
 
+		It("returns the receive window", func() {
+			Expect(controller.GetReceiveWindow()).To(Equal(receiveWindow))
+			controller.bytesRead = receiveWindow - receiveWindowSize/10
+			offset := controller.getWindowUpdate()
+			Expect(offset).ToNot(BeZero())
+			Expect(controller.GetReceiveWindow()).To(Equal(offset))
+		})
+
 		It("doesn't trigger a window update when not necessary", func() {
 			bytesConsumed := float64(receiveWindowSize)*protocol.WindowUpdateThreshold - 1 // consumed 1 byte less than the threshold
 			bytesRemaining := receiveWindowSize - protocol.ByteCount(bytesConsumed)
@@ -209,4 +217,31 @@ var _ = Describe("Base Flow controller", func() {
 			})
 		})
 	})
+
+	Context("exporting the state", func() {
+		It("restores the state in another flow controller", func() {
+			controller.bytesSent = 100
+			controller.sendWindow = 1000
+			controller.bytesRead = 200
+			controller.highestReceived = 300
+			controller.receiveWindow = 2000
+			controller.receiveWindowSize = 1500
+			state := controller.GetState()
+			other := &baseFlowController{maxReceiveWindowSize: 5000}
+			other.SetState(state)
+			Expect(other.sendWindowSize()).To(Equal(protocol.ByteCount(900)))
+			Expect(other.bytesRead).To(Equal(protocol.ByteCount(200)))
+			Expect(other.highestReceived).To(Equal(protocol.ByteCount(300)))
+			Expect(other.GetReceiveWindow()).To(Equal(protocol.ByteCount(2000)))
+			Expect(other.receiveWindowSize).To(Equal(protocol.ByteCount(1500)))
+			Expect(other.epochStartOffset).To(Equal(protocol.ByteCount(200)))
+		})
+
+		It("doesn't restore a receive window size larger than the maximum", func() {
+			controller.receiveWindowSize = 10000
+			other := &baseFlowController{maxReceiveWindowSize: 5000}
+			other.SetState(controller.GetState())
+			Expect(other.receiveWindowSize).To(Equal(protocol.ByteCount(5000)))
+		})
+	})
 })
@@ -10,6 +10,10 @@ type flowController interface {
 	// for receiving
 	AddBytesRead(protocol.ByteCount)
 	GetWindowUpdate() protocol.ByteCount // returns 0 if no update is necessary
+	GetReceiveWindow() protocol.ByteCount
+	// for continuing the connection in another process
+	GetState() State
+	SetState(State)
 }
 
 // A StreamFlowController is a flow controller for a QUIC stream.
@@ -23,6 +27,8 @@ type StreamFlowController interface {
 	UpdateHighestReceived(offset protocol.ByteCount, final bool) error
 	// HasWindowUpdate says if it is necessary to update the window
 	HasWindowUpdate() bool
+	// ReleaseCredit returns flow control credit for data that was read, if the flow controller uses manual credit release
+	ReleaseCredit(protocol.ByteCount)
 }
 
 // The ConnectionFlowController is the flow controller for the connection.
@@ -18,6 +18,10 @@ type streamFlowController struct {
 	contributesToConnection bool // does the stream contribute to connection level flow control
 
 	receivedFinalOffset bool
+
+	// if set, data read is only accounted for when ReleaseCredit is called
+	manualCreditRelease bool
+	bytesReadUnreleased protocol.ByteCount
 }
 
 var _ StreamFlowController = &streamFlowController{}
@@ -30,6 +34,7 @@ func NewStreamFlowController(
 	receiveWindow protocol.ByteCount,
 	maxReceiveWindow protocol.ByteCount,
 	initialSendWindow protocol.ByteCount,
+	manualCreditRelease bool,
 	rttStats *congestion.RTTStats,
 	logger utils.Logger,
 ) StreamFlowController {
@@ -37,6 +42,7 @@ func NewStreamFlowController(
 		streamID:                streamID,
 		contributesToConnection: contributesToConnection,
 		connection:              cfc.(connectionFlowControllerI),
+		manualCreditRelease:     manualCreditRelease,
 		baseFlowController: baseFlowController{
 			rttStats:             rttStats,
 			receiveWindow:        receiveWindow,
@@ -90,6 +96,32 @@ func (c *streamFlowController) UpdateHighestReceived(byteOffset protocol.ByteCou
 }
 
 func (c *streamFlowController) AddBytesRead(n protocol.ByteCount) {
+	if c.manualCreditRelease {
+		c.mutex.Lock()
+		c.bytesReadUnreleased += n
+		c.mutex.Unlock()
+		return
+	}
+	c.addBytesRead(n)
+}
+
+// ReleaseCredit releases flow control credit for n bytes read by the application.
+// It never releases more credit than the data that was read so far.
+func (c *streamFlowController) ReleaseCredit(n protocol.ByteCount) {
+	if !c.manualCreditRelease {
+		return
+	}
+	c.mutex.Lock()
+	n = utils.MinByteCount(n, c.bytesReadUnreleased)
+	c.bytesReadUnreleased -= n
+	c.mutex.Unlock()
+	if n == 0 {
+		return
+	}
+	c.addBytesRead(n)
+}
+
+func (c *streamFlowController) addBytesRead(n protocol.ByteCount) {
 	c.baseFlowController.AddBytesRead(n)
 	if c.contributesToConnection {
 		c.connection.AddBytesRead(n)
@@ -34,7 +34,7 @@ var _ = Describe("Stream Flow controller", func() {
 			sendWindow := protocol.ByteCount(4000)
 
 			cc := NewConnectionFlowController(0, 0, nil, utils.DefaultLogger)
-			fc := NewStreamFlowController(5, true, cc, receiveWindow, maxReceiveWindow, sendWindow, rttStats, utils.DefaultLogger).(*streamFlowController)
+			fc := NewStreamFlowController(5, true, cc, receiveWindow, maxReceiveWindow, sendWindow, false, rttStats, utils.DefaultLogger).(*streamFlowController)
 			Expect(fc.streamID).To(Equal(protocol.StreamID(5)))
 			Expect(fc.receiveWindow).To(Equal(receiveWindow))
 			Expect(fc.maxReceiveWindowSize).To(Equal(maxReceiveWindow))
@@ -158,6 +158,53 @@ var _ = Describe("Stream Flow controller", func() {
 			})
 		})
 
+		Context("manual credit release", func() {
+			BeforeEach(func() {
+				controller.manualCreditRelease = true
+				controller.contributesToConnection = true
+				controller.receiveWindow = 100
+				controller.receiveWindowSize = 100
+			})
+
+			It("doesn't release credit when data is read", func() {
+				Expect(controller.UpdateHighestReceived(100, false)).To(Succeed())
+				controller.AddBytesRead(100)
+				Expect(controller.bytesRead).To(BeZero())
+				Expect(controller.connection.(*connectionFlowController).bytesRead).To(BeZero())
+				Expect(controller.HasWindowUpdate()).To(BeFalse())
+				Expect(controller.GetWindowUpdate()).To(BeZero())
+				// the peer is blocked, and not allowed to send any more data
+				Expect(controller.UpdateHighestReceived(101, false)).To(MatchError("FlowControlReceivedTooMuchData: Received 101 bytes on stream 10, allowed 100 bytes"))
+			})
+
+			It("releases credit", func() {
+				controller.AddBytesRead(80)
+				controller.ReleaseCredit(30)
+				Expect(controller.bytesRead).To(Equal(protocol.ByteCount(30)))
+				Expect(controller.connection.(*connectionFlowController).bytesRead).To(Equal(protocol.ByteCount(30)))
+				controller.ReleaseCredit(50)
+				Expect(controller.bytesRead).To(Equal(protocol.ByteCount(80)))
+				Expect(controller.connection.(*connectionFlowController).bytesRead).To(Equal(protocol.ByteCount(80)))
+				Expect(controller.HasWindowUpdate()).To(BeTrue())
+				Expect(controller.GetWindowUpdate()).To(Equal(protocol.ByteCount(180)))
+			})
+
+			It("doesn't release more credit than data was read", func() {
+				controller.AddBytesRead(20)
+				controller.ReleaseCredit(50)
+				Expect(controller.bytesRead).To(Equal(protocol.ByteCount(20)))
+				controller.ReleaseCredit(10)
+				Expect(controller.bytesRead).To(Equal(protocol.ByteCount(20)))
+			})
+
+			It("ignores calls to ReleaseCredit if credit is released automatically", func() {
+				controller.manualCreditRelease = false
+				controller.AddBytesRead(20)
+				controller.ReleaseCredit(20)
+				Expect(controller.bytesRead).To(Equal(protocol.ByteCount(20)))
+			})
+		})
+
 		Context("generating window updates", func() {
 			var oldWindowSize protocol.ByteCount
 
@@ -11,8 +11,8 @@ import (
 // The cookie is sent in the TLS Retry.
 // By including the cookie in its ClientHello, a client can proof ownership of its source address.
 type CookieHandler struct {
-	callback        func(net.Addr, *Cookie) bool
-	cookieGenerator *CookieGenerator
+	callback       func(net.Addr, *Token) bool
+	tokenGenerator *TokenGenerator
 
 	logger utils.Logger
 }
@@ -20,16 +20,13 @@ type CookieHandler struct {
 var _ mint.CookieHandler = &CookieHandler{}
 
 // NewCookieHandler creates a new CookieHandler.
-func NewCookieHandler(callback func(net.Addr, *Cookie) bool, logger utils.Logger) (*CookieHandler, error) {
-	cookieGenerator, err := NewCookieGenerator()
-	if err != nil {
-		return nil, err
-	}
+// The cookies are generated and decoded by the TokenGenerator.
+func NewCookieHandler(callback func(net.Addr, *Token) bool, tokenGenerator *TokenGenerator, logger utils.Logger) *CookieHandler {
 	return &CookieHandler{
-		callback:        callback,
-		cookieGenerator: cookieGenerator,
-		logger:          logger,
-	}, nil
+		callback:       callback,
+		tokenGenerator: tokenGenerator,
+		logger:         logger,
+	}
 }
 
 // Generate a new cookie for a mint connection.
@@ -37,12 +34,12 @@ func (h *CookieHandler) Generate(conn *mint.Conn) ([]byte, error) {
 	if h.callback(conn.RemoteAddr(), nil) {
 		return nil, nil
 	}
-	return h.cookieGenerator.NewToken(conn.RemoteAddr())
+	return h.tokenGenerator.NewRetryToken(conn.RemoteAddr())
 }
 
 // Validate a cookie.
 func (h *CookieHandler) Validate(conn *mint.Conn, token []byte) bool {
-	data, err := h.cookieGenerator.DecodeToken(token)
+	data, err := h.tokenGenerator.DecodeToken(token)
 	if err != nil {
 		h.logger.Debugf("Couldn't decode cookie from %s: %s", conn.RemoteAddr(), err.Error())
 		return false
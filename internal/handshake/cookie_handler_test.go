@@ -27,7 +27,9 @@ func (c *mockConn) SetWriteDeadline(time.Time) error { panic("not implemented")
 func (c *mockConn) SetDeadline(time.Time) error      { panic("not implemented") }
 
 var callbackReturn bool
-var mockCallback = func(net.Addr, *Cookie) bool {
+var callbackToken *Token
+var mockCallback = func(_ net.Addr, token *Token) bool {
+	callbackToken = token
 	return callbackReturn
 }
 
@@ -37,9 +39,9 @@ var _ = Describe("Cookie Handler", func() {
 
 	BeforeEach(func() {
 		callbackReturn = false
-		var err error
-		ch, err = NewCookieHandler(mockCallback, utils.DefaultLogger)
+		tokenGen, err := NewTokenGenerator(time.Now)
 		Expect(err).ToNot(HaveOccurred())
+		ch = NewCookieHandler(mockCallback, tokenGen, utils.DefaultLogger)
 		addr := &net.UDPAddr{IP: net.IPv4(42, 43, 44, 45), Port: 46}
 		conn = mint.NewConn(&mockConn{remoteAddr: addr}, &mint.Config{}, false)
 	})
@@ -52,6 +54,14 @@ var _ = Describe("Cookie Handler", func() {
 		Expect(ch.Validate(conn, cookie)).To(BeTrue())
 	})
 
+	It("uses retry tokens as cookies", func() {
+		cookie, err := ch.Generate(conn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ch.Validate(conn, cookie)).To(BeFalse())
+		Expect(callbackToken.IsRetryToken).To(BeTrue())
+		Expect(callbackToken.RemoteAddr).To(Equal("42.43.44.45"))
+	})
+
 	It("doesn't generate a token if the callback says so", func() {
 		callbackReturn = true
 		cookie, err := ch.Generate(conn)
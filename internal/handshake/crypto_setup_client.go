@@ -28,6 +28,9 @@ type cryptoSetupClient struct {
 
 	cryptoStream io.ReadWriter
 
+	tlsConfig    *tls.Config
+	sessionCache ClientSessionCache
+
 	serverConfig *serverConfigClient
 
 	stk              []byte
@@ -36,6 +39,7 @@ type cryptoSetupClient struct {
 	proof            []byte
 	chloForSignature []byte
 	lastSentCHLO     []byte
+	certData         []byte // the compressed certificate chain, as sent by the server
 	certManager      crypto.CertManager
 
 	divNonceChan         chan struct{}
@@ -50,6 +54,13 @@ type cryptoSetupClient struct {
 	secureAEAD           crypto.AEAD
 	forwardSecureAEAD    crypto.AEAD
 
+	usesCachedState bool                 // was the last CHLO sent using a cached server config
+	cachedParams    *TransportParameters // the parameters the server sent in the connection the state was cached from
+	// earlyAEAD is used to send 0-RTT data, before the secureAEAD is available.
+	// It can only be used for sealing, since the server's keys depend on the diversification nonce.
+	earlyAEAD         crypto.AEAD
+	earlyDataRejected bool
+
 	paramsChan     chan<- TransportParameters
 	handshakeEvent chan<- struct{}
 
@@ -73,6 +84,7 @@ func NewCryptoSetupClient(
 	connID protocol.ConnectionID,
 	version protocol.VersionNumber,
 	tlsConfig *tls.Config,
+	sessionCache ClientSessionCache,
 	params *TransportParameters,
 	paramsChan chan<- TransportParameters,
 	handshakeEvent chan<- struct{},
@@ -84,15 +96,21 @@ func NewCryptoSetupClient(
 	if err != nil {
 		return nil, err
 	}
+	var keyLog io.Writer
+	if tlsConfig != nil {
+		keyLog = tlsConfig.KeyLogWriter
+	}
 	divNonceChan := make(chan struct{})
 	cs := &cryptoSetupClient{
 		cryptoStream:       cryptoStream,
 		hostname:           hostname,
 		connID:             connID,
 		version:            version,
+		tlsConfig:          tlsConfig,
+		sessionCache:       sessionCache,
 		certManager:        crypto.NewCertManager(tlsConfig),
 		params:             params,
-		keyDerivation:      crypto.DeriveQuicCryptoAESKeys,
+		keyDerivation:      crypto.NewQuicCryptoAESKeyDerivation(keyLog),
 		nullAEAD:           nullAEAD,
 		paramsChan:         paramsChan,
 		handshakeEvent:     handshakeEvent,
@@ -119,6 +137,13 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 		}
 	}()
 
+	h.restoreCachedState()
+	if h.usesCachedState {
+		// Use the server's parameters from the last connection until we receive the SHLO.
+		// This allows us to open streams and send 0-RTT data.
+		h.paramsChan <- *h.cachedParams
+	}
+
 	for {
 		if err := h.maybeUpgradeCrypto(); err != nil {
 			return err
@@ -131,6 +156,9 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 			if err := h.sendCHLO(); err != nil {
 				return err
 			}
+			if err := h.maybeDeriveEarlyAEAD(); err != nil {
+				return err
+			}
 		}
 
 		var message HandshakeMessage
@@ -154,6 +182,7 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 			if err != nil {
 				return err
 			}
+			h.cacheState(params)
 			// blocks until the session has received the parameters
 			h.paramsChan <- *params
 			h.handshakeEvent <- struct{}{}
@@ -167,6 +196,10 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 	var err error
 
+	if h.usesCachedState {
+		h.rejectCachedState()
+	}
+
 	if stk, ok := cryptoData[TagSTK]; ok {
 		h.stk = stk
 	}
@@ -205,6 +238,7 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 		if err != nil {
 			return qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")
 		}
+		h.certData = crt
 
 		err = h.certManager.Verify(h.hostname)
 		if err != nil {
@@ -340,6 +374,8 @@ func (h *cryptoSetupClient) GetSealer() (protocol.EncryptionLevel, Sealer) {
 		return protocol.EncryptionForwardSecure, h.forwardSecureAEAD
 	} else if h.secureAEAD != nil {
 		return protocol.EncryptionSecure, h.secureAEAD
+	} else if h.earlyAEAD != nil && !h.earlyDataRejected {
+		return protocol.EncryptionSecure, h.earlyAEAD
 	} else {
 		return protocol.EncryptionUnencrypted, h.nullAEAD
 	}
@@ -357,10 +393,15 @@ func (h *cryptoSetupClient) GetSealerWithEncryptionLevel(encLevel protocol.Encry
 	case protocol.EncryptionUnencrypted:
 		return h.nullAEAD, nil
 	case protocol.EncryptionSecure:
-		if h.secureAEAD == nil {
-			return nil, errors.New("CryptoSetupClient: no secureAEAD")
+		if h.secureAEAD != nil {
+			return h.secureAEAD, nil
+		}
+		// If the 0-RTT data was rejected, retransmissions of 0-RTT packets can't be decrypted by the server.
+		// They will be retransmitted again, as soon as the secureAEAD is available.
+		if h.earlyAEAD != nil {
+			return h.earlyAEAD, nil
 		}
-		return h.secureAEAD, nil
+		return nil, errors.New("CryptoSetupClient: no secureAEAD")
 	case protocol.EncryptionForwardSecure:
 		if h.forwardSecureAEAD == nil {
 			return nil, errors.New("CryptoSetupClient: no forwardSecureAEAD")
@@ -376,6 +417,7 @@ func (h *cryptoSetupClient) ConnectionState() ConnectionState {
 	return ConnectionState{
 		HandshakeComplete: h.forwardSecureAEAD != nil,
 		PeerCertificates:  h.certManager.GetChain(),
+		Used0RTT:          h.forwardSecureAEAD != nil && h.earlyAEAD != nil && !h.earlyDataRejected,
 	}
 }
 
@@ -514,6 +556,132 @@ func (h *cryptoSetupClient) maybeUpgradeCrypto() error {
 	return nil
 }
 
+// restoreCachedState restores the server config and the certificate chain cached from a previous connection to the same server.
+// This allows us to send a full CHLO right away, and to send 0-RTT data.
+func (h *cryptoSetupClient) restoreCachedState() {
+	if h.sessionCache == nil {
+		return
+	}
+	state, ok := h.sessionCache.Get(h.hostname)
+	if !ok {
+		return
+	}
+	if err := h.restoreState(state); err != nil {
+		h.logger.Debugf("Not using cached state for %s: %s", h.hostname, err)
+		h.serverConfig = nil
+		h.nonc = nil
+		h.certManager = crypto.NewCertManager(h.tlsConfig)
+		return
+	}
+	h.logger.Debugf("Using cached server config for %s", h.hostname)
+}
+
+func (h *cryptoSetupClient) restoreState(state []byte) error {
+	message, err := ParseHandshakeMessage(bytes.NewReader(state))
+	if err != nil {
+		return err
+	}
+	scfg, ok := message.Data[TagSCFG]
+	if !ok {
+		return errors.New("no server config")
+	}
+	crt, ok := message.Data[TagCERT]
+	if !ok {
+		return errors.New("no certificate chain")
+	}
+	serverConfig, err := parseServerConfig(scfg)
+	if err != nil {
+		return err
+	}
+	if serverConfig.IsExpired() {
+		return errors.New("server config expired")
+	}
+	if err := h.certManager.SetData(crt); err != nil {
+		return err
+	}
+	// the proof was already verified when the state was cached, but the certificate might have expired since then
+	if err := h.certManager.Verify(h.hostname); err != nil {
+		return err
+	}
+	params, err := readHelloMap(message.Data)
+	if err != nil {
+		return err
+	}
+	h.serverConfig = serverConfig
+	if err := h.generateClientNonce(); err != nil {
+		return err
+	}
+	h.cachedParams = params
+	h.certData = crt
+	h.stk = message.Data[TagSTK]
+	h.serverVerified = true
+	h.usesCachedState = true
+	return nil
+}
+
+// cacheState caches the server config, the certificate chain and the server's parameters,
+// so that they can be used for the next connection to the same server.
+func (h *cryptoSetupClient) cacheState(params *TransportParameters) {
+	if h.sessionCache == nil || h.serverConfig == nil || len(h.certData) == 0 {
+		return
+	}
+	p := *params
+	// we only omit the connection ID after the server requested it in this connection
+	p.OmitConnectionID = false
+	data := p.getHelloMap()
+	data[TagSCFG] = h.serverConfig.Get()
+	data[TagCERT] = h.certData
+	if len(h.stk) > 0 {
+		data[TagSTK] = h.stk
+	}
+	b := &bytes.Buffer{}
+	HandshakeMessage{Tag: TagREJ, Data: data}.Write(b)
+	h.sessionCache.Put(h.hostname, b.Bytes())
+}
+
+// rejectCachedState is called when the server rejects a CHLO sent using a cached server config.
+// The server can't decrypt the 0-RTT data we sent, and we need to verify the server again.
+func (h *cryptoSetupClient) rejectCachedState() {
+	h.logger.Infof("Server rejected the cached server config")
+	h.mutex.Lock()
+	h.earlyDataRejected = true
+	h.mutex.Unlock()
+	h.usesCachedState = false
+	h.serverVerified = false
+	h.nonc = nil
+	h.proof = nil
+	h.certData = nil
+	h.certManager = crypto.NewCertManager(h.tlsConfig)
+}
+
+// maybeDeriveEarlyAEAD derives the keys used to send 0-RTT data.
+// This is only possible if the last CHLO was sent using a cached server config.
+func (h *cryptoSetupClient) maybeDeriveEarlyAEAD() error {
+	if !h.usesCachedState || h.earlyAEAD != nil {
+		return nil
+	}
+	h.mutex.Lock()
+	var err error
+	// The diversification nonce is only used to derive the server's keys, which we never use.
+	h.earlyAEAD, err = h.keyDerivation(
+		false,
+		h.serverConfig.sharedSecret,
+		h.nonc,
+		h.connID,
+		h.lastSentCHLO,
+		h.serverConfig.Get(),
+		h.certManager.GetLeafCert(),
+		make([]byte, 32),
+		protocol.PerspectiveClient,
+	)
+	h.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	h.handshakeEvent <- struct{}{}
+	return nil
+}
+
 func (h *cryptoSetupClient) generateClientNonce() error {
 	if len(h.nonc) > 0 {
 		return errClientNonceAlreadyExists
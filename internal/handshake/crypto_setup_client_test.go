@@ -82,6 +82,19 @@ func (m *mockCertManager) GetChain() []*x509.Certificate {
 	return m.chain
 }
 
+type mockSessionCache map[string][]byte
+
+var _ ClientSessionCache = mockSessionCache{}
+
+func (c mockSessionCache) Get(key string) ([]byte, bool) {
+	state, ok := c[key]
+	return state, ok
+}
+
+func (c mockSessionCache) Put(key string, state []byte) {
+	c[key] = state
+}
+
 var _ = Describe("Client Crypto Setup", func() {
 	var (
 		cs                      *cryptoSetupClient
@@ -125,6 +138,7 @@ var _ = Describe("Client Crypto Setup", func() {
 			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 			version,
 			nil,
+			nil,
 			&TransportParameters{IdleTimeout: protocol.DefaultIdleTimeout},
 			paramsChan,
 			handshakeEvent,
@@ -914,6 +928,227 @@ var _ = Describe("Client Crypto Setup", func() {
 		})
 	})
 
+	Context("0-RTT", func() {
+		var cache mockSessionCache
+
+		cacheState := func(scfg map[Tag][]byte) {
+			b := &bytes.Buffer{}
+			HandshakeMessage{Tag: TagSCFG, Data: scfg}.Write(b)
+			data := (&TransportParameters{MaxStreams: 42, IdleTimeout: time.Minute}).getHelloMap()
+			data[TagSCFG] = b.Bytes()
+			data[TagCERT] = []byte("cert")
+			data[TagSTK] = []byte("stk")
+			state := &bytes.Buffer{}
+			HandshakeMessage{Tag: TagREJ, Data: data}.Write(state)
+			cache["hostname"] = state.Bytes()
+		}
+
+		BeforeEach(func() {
+			cache = make(mockSessionCache)
+			cs.sessionCache = cache
+			certManager.leafCert = []byte("leafCert")
+		})
+
+		It("caches the server config, the certificate chain and the server's parameters", func() {
+			cs.serverConfig = &serverConfigClient{raw: []byte("rawserverconfig")}
+			cs.certData = []byte("cert")
+			cs.stk = []byte("stk")
+			params := &TransportParameters{
+				MaxStreams:                  42,
+				StreamFlowControlWindow:     0x1000,
+				ConnectionFlowControlWindow: 0x2000,
+				IdleTimeout:                 time.Minute,
+				OmitConnectionID:            true,
+			}
+			cs.cacheState(params)
+			Expect(cache).To(HaveKey("hostname"))
+			message, err := ParseHandshakeMessage(bytes.NewReader(cache["hostname"]))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(message.Data).To(HaveKeyWithValue(TagSCFG, []byte("rawserverconfig")))
+			Expect(message.Data).To(HaveKeyWithValue(TagCERT, []byte("cert")))
+			Expect(message.Data).To(HaveKeyWithValue(TagSTK, []byte("stk")))
+			cachedParams, err := readHelloMap(message.Data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cachedParams.MaxStreams).To(Equal(params.MaxStreams))
+			Expect(cachedParams.StreamFlowControlWindow).To(Equal(params.StreamFlowControlWindow))
+			Expect(cachedParams.ConnectionFlowControlWindow).To(Equal(params.ConnectionFlowControlWindow))
+			Expect(cachedParams.IdleTimeout).To(Equal(params.IdleTimeout))
+			Expect(cachedParams.OmitConnectionID).To(BeFalse())
+		})
+
+		It("doesn't cache anything if it didn't receive a certificate chain", func() {
+			cs.serverConfig = &serverConfigClient{raw: []byte("rawserverconfig")}
+			cs.cacheState(&TransportParameters{})
+			Expect(cache).To(BeEmpty())
+		})
+
+		It("restores the cached state", func() {
+			cacheState(getDefaultServerConfigClient())
+			cs.restoreCachedState()
+			Expect(cs.usesCachedState).To(BeTrue())
+			Expect(cs.serverVerified).To(BeTrue())
+			Expect(cs.serverConfig).ToNot(BeNil())
+			Expect(cs.serverConfig.ID).To(Equal(getDefaultServerConfigClient()[TagSCID]))
+			Expect(cs.stk).To(Equal([]byte("stk")))
+			Expect(cs.nonc).To(HaveLen(32))
+			Expect(cs.cachedParams.MaxStreams).To(BeEquivalentTo(42))
+			Expect(certManager.setDataCalledWith).To(Equal([]byte("cert")))
+			Expect(certManager.verifyCalled).To(BeTrue())
+		})
+
+		It("passes the cached parameters to the session", func() {
+			cacheState(getDefaultServerConfigClient())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := cs.HandleCryptoStream()
+				Expect(err).To(MatchError(qerr.Error(qerr.HandshakeFailed, errMockStreamClosing.Error())))
+				close(done)
+			}()
+			var params TransportParameters
+			Eventually(paramsChan).Should(Receive(&params))
+			Expect(params.MaxStreams).To(BeEquivalentTo(42))
+			Expect(params.IdleTimeout).To(Equal(time.Minute))
+			// make the go routine return
+			stream.close()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("sends a full CHLO using the cached state", func() {
+			cacheState(getDefaultServerConfigClient())
+			cs.restoreCachedState()
+			tags, err := cs.getTags()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tags).To(HaveKeyWithValue(TagSCID, cs.serverConfig.ID))
+			Expect(tags).To(HaveKeyWithValue(TagNONC, cs.nonc))
+			Expect(tags).To(HaveKeyWithValue(TagSTK, []byte("stk")))
+			Expect(tags).To(HaveKey(TagXLCT))
+			Expect(tags).To(HaveKey(TagPUBS))
+		})
+
+		It("doesn't use an expired server config", func() {
+			scfg := getDefaultServerConfigClient()
+			scfg[TagEXPY] = []byte{0x80, 0x54, 0x72, 0x4F, 0, 0, 0, 0} // 2012-03-28
+			cacheState(scfg)
+			cs.restoreCachedState()
+			Expect(cs.usesCachedState).To(BeFalse())
+			Expect(cs.serverVerified).To(BeFalse())
+			Expect(cs.serverConfig).To(BeNil())
+		})
+
+		It("doesn't use the cached state if the certificate chain is not valid anymore", func() {
+			certManager.verifyError = errors.New("certificate expired")
+			cacheState(getDefaultServerConfigClient())
+			cs.restoreCachedState()
+			Expect(cs.usesCachedState).To(BeFalse())
+			Expect(cs.serverVerified).To(BeFalse())
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.nonc).To(BeEmpty())
+			Expect(cs.certManager).ToNot(Equal(certManager))
+		})
+
+		It("doesn't use invalid cached state", func() {
+			cache["hostname"] = []byte("foobar")
+			cs.restoreCachedState()
+			Expect(cs.usesCachedState).To(BeFalse())
+			Expect(cs.serverConfig).To(BeNil())
+		})
+
+		Context("sending 0-RTT data", func() {
+			BeforeEach(func() {
+				cacheState(getDefaultServerConfigClient())
+				cs.restoreCachedState()
+				Expect(cs.sendCHLO()).To(Succeed())
+				Expect(cs.maybeDeriveEarlyAEAD()).To(Succeed())
+			})
+
+			It("derives the keys for 0-RTT data after sending the CHLO", func() {
+				Expect(cs.earlyAEAD).ToNot(BeNil())
+				Expect(keyDerivationCalledWith.forwardSecure).To(BeFalse())
+				Expect(keyDerivationCalledWith.sharedSecret).To(Equal(cs.serverConfig.sharedSecret))
+				Expect(keyDerivationCalledWith.nonces).To(Equal(cs.nonc))
+				Expect(keyDerivationCalledWith.chlo).To(Equal(cs.lastSentCHLO))
+				Expect(keyDerivationCalledWith.scfg).To(Equal(cs.serverConfig.Get()))
+				Expect(keyDerivationCalledWith.cert).To(Equal(certManager.leafCert))
+				Expect(keyDerivationCalledWith.pers).To(Equal(protocol.PerspectiveClient))
+				Expect(handshakeEvent).To(Receive())
+				Expect(handshakeEvent).ToNot(BeClosed())
+			})
+
+			It("uses the 0-RTT keys for sealing", func() {
+				encLevel, sealer := cs.GetSealer()
+				Expect(encLevel).To(Equal(protocol.EncryptionSecure))
+				Expect(sealer).To(Equal(cs.earlyAEAD))
+				sealer, err := cs.GetSealerWithEncryptionLevel(protocol.EncryptionSecure)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sealer).To(Equal(cs.earlyAEAD))
+			})
+
+			It("uses the secureAEAD, as soon as it is available", func() {
+				cs.secureAEAD = mockcrypto.NewMockAEAD(mockCtrl)
+				encLevel, sealer := cs.GetSealer()
+				Expect(encLevel).To(Equal(protocol.EncryptionSecure))
+				Expect(sealer).To(Equal(cs.secureAEAD))
+			})
+
+			It("only derives the 0-RTT keys once", func() {
+				Expect(handshakeEvent).To(Receive())
+				earlyAEAD := cs.earlyAEAD
+				Expect(cs.maybeDeriveEarlyAEAD()).To(Succeed())
+				Expect(cs.earlyAEAD).To(BeIdenticalTo(earlyAEAD))
+				Expect(handshakeEvent).ToNot(Receive())
+			})
+
+			It("reports that 0-RTT was used when the handshake completes", func() {
+				Expect(cs.ConnectionState().Used0RTT).To(BeFalse())
+				cs.forwardSecureAEAD = mockcrypto.NewMockAEAD(mockCtrl)
+				Expect(cs.ConnectionState().Used0RTT).To(BeTrue())
+			})
+
+			Context("rejections", func() {
+				BeforeEach(func() {
+					Expect(cs.handleREJMessage(map[Tag][]byte{})).To(Succeed())
+				})
+
+				It("stops using the 0-RTT keys when the server rejects the CHLO", func() {
+					Expect(cs.earlyDataRejected).To(BeTrue())
+					encLevel, _ := cs.GetSealer()
+					Expect(encLevel).To(Equal(protocol.EncryptionUnencrypted))
+				})
+
+				It("retransmits 0-RTT packets with the 0-RTT keys, until the secureAEAD is available", func() {
+					sealer, err := cs.GetSealerWithEncryptionLevel(protocol.EncryptionSecure)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sealer).To(Equal(cs.earlyAEAD))
+					cs.secureAEAD = mockcrypto.NewMockAEAD(mockCtrl)
+					sealer, err = cs.GetSealerWithEncryptionLevel(protocol.EncryptionSecure)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sealer).To(Equal(cs.secureAEAD))
+				})
+
+				It("verifies the server again", func() {
+					Expect(cs.usesCachedState).To(BeFalse())
+					Expect(cs.serverVerified).To(BeFalse())
+					Expect(cs.nonc).To(BeEmpty())
+					Expect(cs.proof).To(BeEmpty())
+					Expect(cs.certManager).ToNot(Equal(certManager))
+				})
+
+				It("reports that 0-RTT was not used", func() {
+					cs.forwardSecureAEAD = mockcrypto.NewMockAEAD(mockCtrl)
+					Expect(cs.ConnectionState().Used0RTT).To(BeFalse())
+				})
+			})
+		})
+
+		It("doesn't derive 0-RTT keys without cached state", func() {
+			Expect(cs.sendCHLO()).To(Succeed())
+			Expect(cs.maybeDeriveEarlyAEAD()).To(Succeed())
+			Expect(cs.earlyAEAD).To(BeNil())
+			Expect(handshakeEvent).ToNot(Receive())
+		})
+	})
+
 	Context("Diversification Nonces", func() {
 		It("sets a diversification nonce", func() {
 			done := make(chan struct{})
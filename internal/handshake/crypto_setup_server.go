@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -33,7 +34,7 @@ type cryptoSetupServer struct {
 	version           protocol.VersionNumber
 	supportedVersions []protocol.VersionNumber
 
-	acceptSTKCallback func(net.Addr, *Cookie) bool
+	acceptSTKCallback func(net.Addr, *Token) bool
 
 	nullAEAD                    crypto.AEAD
 	secureAEAD                  crypto.AEAD
@@ -41,6 +42,7 @@ type cryptoSetupServer struct {
 	receivedForwardSecurePacket bool
 	receivedSecurePacket        bool
 	sentSHLO                    chan struct{} // this channel is closed as soon as the SHLO has been written
+	sentREJ                     bool
 
 	receivedParams bool
 	paramsChan     chan<- TransportParameters
@@ -79,7 +81,7 @@ func NewCryptoSetup(
 	scfg *ServerConfig,
 	params *TransportParameters,
 	supportedVersions []protocol.VersionNumber,
-	acceptSTK func(net.Addr, *Cookie) bool,
+	acceptSTK func(net.Addr, *Token) bool,
 	paramsChan chan<- TransportParameters,
 	handshakeEvent chan<- struct{},
 	logger utils.Logger,
@@ -96,7 +98,7 @@ func NewCryptoSetup(
 		supportedVersions:    supportedVersions,
 		diversificationNonce: divNonce,
 		scfg:                 scfg,
-		keyDerivation:        crypto.DeriveQuicCryptoAESKeys,
+		keyDerivation:        crypto.NewQuicCryptoAESKeyDerivation(scfg.KeyLogWriter),
 		keyExchange:          getEphermalKEX,
 		nullAEAD:             nullAEAD,
 		params:               params,
@@ -182,7 +184,7 @@ func (h *cryptoSetupServer) handleMessage(chloData []byte, cryptoData map[Tag][]
 		h.paramsChan <- *params
 	}
 
-	if !h.isInchoateCHLO(cryptoData, certUncompressed) {
+	if !h.isInchoateCHLO(cryptoData, certUncompressed) && h.accept0RTT(cryptoData) {
 		// We have a CHLO with a proper server config ID, do a 0-RTT handshake
 		reply, err = h.handleCHLO(sni, chloData, cryptoData)
 		if err != nil {
@@ -201,17 +203,51 @@ func (h *cryptoSetupServer) handleMessage(chloData []byte, cryptoData map[Tag][]
 	if err != nil {
 		return false, err
 	}
+	h.sentREJ = true
 	_, err = h.cryptoStream.Write(reply)
 	return false, err
 }
 
+// accept0RTT is called for a CHLO with a proper server config ID, and decides if the handshake can be completed.
+// If the client sends such a CHLO right away, it used a cached server config, and might have sent 0-RTT data.
+// This data might be replayed by an attacker, so the application can decide to reject it (by sending a REJ).
+// If single-use 0-RTT is enabled, CHLOs are rejected if the server already accepted a CHLO with the same client nonce,
+// or if the timestamp of the client nonce is outside of the strike register's window.
+// If the server can't remember any more nonces, 0-RTT is rejected, but the handshake can still be completed after the REJ.
+func (h *cryptoSetupServer) accept0RTT(cryptoData map[Tag][]byte) bool {
+	if !h.sentREJ && h.scfg.Allow0RTT != nil {
+		// the STK was already validated when checking if the CHLO is inchoate
+		if stk, err := h.scfg.tokenGenerator.DecodeToken(cryptoData[TagSTK]); err == nil && stk != nil {
+			if !h.scfg.Allow0RTT(h.remoteAddr, time.Since(stk.SentTime)) {
+				h.logger.Debugf("Rejecting 0-RTT handshake")
+				return false
+			}
+		}
+	}
+	if h.scfg.strikeRegister != nil {
+		if err := h.scfg.strikeRegister.Add(cryptoData[TagNONC], time.Now()); err == errReplayedNonce || (err != nil && !h.sentREJ) {
+			h.logger.Debugf("Rejecting 0-RTT handshake: %s", err)
+			return false
+		}
+	}
+	return true
+}
+
 // Open a message
 func (h *cryptoSetupServer) Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error) {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
 	if h.forwardSecureAEAD != nil {
-		res, err := h.forwardSecureAEAD.Open(dst, src, packetNumber, associatedData)
+		encrypted := src
+		// The AEAD overwrites dst if decryption fails, and dst might be the same buffer as src.
+		// As long as the client might still send packets with the secure AEAD (e.g. 0-RTT data),
+		// keep a copy of the packet for the next attempt.
+		if !h.receivedForwardSecurePacket {
+			src = make([]byte, len(encrypted))
+			copy(src, encrypted)
+		}
+		res, err := h.forwardSecureAEAD.Open(dst, encrypted, packetNumber, associatedData)
 		if err == nil {
 			if !h.receivedForwardSecurePacket { // this is the first forward secure packet we receive from the client
 				h.receivedForwardSecurePacket = true
@@ -301,7 +337,7 @@ func (h *cryptoSetupServer) isInchoateCHLO(cryptoData map[Tag][]byte, cert []byt
 }
 
 func (h *cryptoSetupServer) acceptSTK(token []byte) bool {
-	stk, err := h.scfg.cookieGenerator.DecodeToken(token)
+	stk, err := h.scfg.tokenGenerator.DecodeToken(token)
 	if err != nil {
 		h.logger.Debugf("STK invalid: %s", err.Error())
 		return false
@@ -310,7 +346,7 @@ func (h *cryptoSetupServer) acceptSTK(token []byte) bool {
 }
 
 func (h *cryptoSetupServer) handleInchoateCHLO(sni string, chlo []byte, cryptoData map[Tag][]byte) ([]byte, error) {
-	token, err := h.scfg.cookieGenerator.NewToken(h.remoteAddr)
+	token, err := h.scfg.tokenGenerator.NewToken(h.remoteAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/bifurcation/mint"
+	"github.com/golang/mock/gomock"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/mocks/crypto"
@@ -151,6 +152,7 @@ var _ = Describe("Server Crypto Setup", func() {
 		signer = &mockSigner{}
 		scfg, err = NewServerConfig(kex, signer)
 		nonce32 = make([]byte, 32)
+		binary.BigEndian.PutUint32(nonce32, uint32(time.Now().Unix()))
 		aead = []byte("AESG")
 		kexs = []byte("C255")
 		copy(nonce32[4:12], scfg.obit) // set the OBIT value at the right position
@@ -175,11 +177,11 @@ var _ = Describe("Server Crypto Setup", func() {
 		)
 		Expect(err).NotTo(HaveOccurred())
 		cs = csInt.(*cryptoSetupServer)
-		cs.scfg.cookieGenerator.cookieProtector = &mockCookieProtector{}
-		validSTK, err = cs.scfg.cookieGenerator.NewToken(remoteAddr)
+		cs.scfg.tokenGenerator.cookieProtector = &mockCookieProtector{}
+		validSTK, err = cs.scfg.tokenGenerator.NewToken(remoteAddr)
 		Expect(err).NotTo(HaveOccurred())
 		sourceAddrValid = true
-		cs.acceptSTKCallback = func(_ net.Addr, _ *Cookie) bool { return sourceAddrValid }
+		cs.acceptSTKCallback = func(_ net.Addr, _ *Token) bool { return sourceAddrValid }
 		cs.keyDerivation = mockQuicCryptoKeyDerivation
 		cs.keyExchange = func() (crypto.KeyExchange, error) { return &mockKEX{ephermal: true}, nil }
 		cs.nullAEAD = mockcrypto.NewMockAEAD(mockCtrl)
@@ -367,6 +369,65 @@ var _ = Describe("Server Crypto Setup", func() {
 			Expect(handshakeEvent).ToNot(BeClosed())
 		})
 
+		It("handles 0-RTT handshakes allowed by the application", func() {
+			var addr net.Addr
+			var tokenAge time.Duration
+			scfg.Allow0RTT = func(a net.Addr, age time.Duration) bool {
+				addr = a
+				tokenAge = age
+				return true
+			}
+			HandshakeMessage{Tag: TagCHLO, Data: fullCHLO}.Write(&stream.dataToRead)
+			err := cs.HandleCryptoStream()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stream.dataWritten.Bytes()).To(HavePrefix("SHLO"))
+			Expect(addr).To(Equal(cs.remoteAddr))
+			Expect(tokenAge).To(BeNumerically("<", time.Minute))
+		})
+
+		It("sends a REJ for 0-RTT handshakes rejected by the application", func() {
+			var called int
+			scfg.Allow0RTT = func(net.Addr, time.Duration) bool {
+				called++
+				return false
+			}
+			HandshakeMessage{Tag: TagCHLO, Data: fullCHLO}.Write(&stream.dataToRead)
+			HandshakeMessage{Tag: TagCHLO, Data: fullCHLO}.Write(&stream.dataToRead)
+			err := cs.HandleCryptoStream()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stream.dataWritten.Bytes()).To(HavePrefix("REJ"))
+			// the second CHLO is sent after receiving the REJ, so it doesn't carry any 0-RTT data
+			Expect(stream.dataWritten.Bytes()).To(ContainSubstring("SHLO"))
+			Expect(called).To(Equal(1))
+		})
+
+		It("rejects replayed CHLOs if 0-RTT is single-use", func() {
+			scfg.EnableSingleUse0RTT()
+			Expect(cs.accept0RTT(fullCHLO)).To(BeTrue())
+			Expect(cs.accept0RTT(fullCHLO)).To(BeFalse())
+			nonce := make([]byte, 32)
+			copy(nonce, nonce32)
+			nonce[31]++
+			fullCHLO[TagNONC] = nonce
+			Expect(cs.accept0RTT(fullCHLO)).To(BeTrue())
+		})
+
+		It("rejects 0-RTT for CHLOs with an old client nonce, if 0-RTT is single-use", func() {
+			scfg.EnableSingleUse0RTT()
+			binary.BigEndian.PutUint32(nonce32, uint32(time.Now().Add(-protocol.StrikeRegisterWindow-time.Minute).Unix()))
+			Expect(cs.accept0RTT(fullCHLO)).To(BeFalse())
+			cs.sentREJ = true
+			Expect(cs.accept0RTT(fullCHLO)).To(BeTrue())
+		})
+
+		It("only rejects 0-RTT if it can't remember any more CHLOs", func() {
+			scfg.EnableSingleUse0RTT()
+			scfg.strikeRegister.maxEntries = 0
+			Expect(cs.accept0RTT(fullCHLO)).To(BeFalse())
+			cs.sentREJ = true
+			Expect(cs.accept0RTT(fullCHLO)).To(BeTrue())
+		})
+
 		It("recognizes inchoate CHLOs missing SCID", func() {
 			delete(fullCHLO, TagSCID)
 			Expect(cs.isInchoateCHLO(fullCHLO, cert)).To(BeTrue())
@@ -394,7 +455,7 @@ var _ = Describe("Server Crypto Setup", func() {
 
 		It("recognizes inchoate CHLOs with an invalid STK", func() {
 			testErr := errors.New("STK invalid")
-			cs.scfg.cookieGenerator.cookieProtector.(*mockCookieProtector).decodeErr = testErr
+			cs.scfg.tokenGenerator.cookieProtector.(*mockCookieProtector).decodeErr = testErr
 			Expect(cs.isInchoateCHLO(fullCHLO, cert)).To(BeTrue())
 		})
 
@@ -604,6 +665,23 @@ var _ = Describe("Server Crypto Setup", func() {
 				Expect(d).To(Equal([]byte("decrypted")))
 			})
 
+			It("is accepted if decrypting with the forward secure AEAD overwrote the packet", func() {
+				doCHLO()
+				data := []byte("encrypted")
+				cs.forwardSecureAEAD.(*mockcrypto.MockAEAD).EXPECT().Open(gomock.Any(), []byte("encrypted"), protocol.PacketNumber(98), []byte{}).DoAndReturn(func(dst, src []byte, _ protocol.PacketNumber, _ []byte) ([]byte, error) {
+					// decryption happens in place, and the AEAD zeroes the plaintext if authentication fails
+					for i := range src {
+						src[i] = 0
+					}
+					return nil, errors.New("authentication failed")
+				})
+				cs.secureAEAD.(*mockcrypto.MockAEAD).EXPECT().Open(gomock.Any(), []byte("encrypted"), protocol.PacketNumber(98), []byte{}).Return([]byte("decrypted"), nil)
+				d, enc, err := cs.Open(data[:0], data, 98, []byte{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(enc).To(Equal(protocol.EncryptionSecure))
+				Expect(d).To(Equal([]byte("decrypted")))
+			})
+
 			It("is not accepted after receiving forward secure packet", func() {
 				doCHLO()
 				// receive a forward secure packet
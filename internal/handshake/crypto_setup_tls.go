@@ -1,10 +1,13 @@
 package handshake
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
@@ -15,7 +18,34 @@ import (
 var ErrCloseSessionForRetry = errors.New("closing session in order to recreate after a retry")
 
 // KeyDerivationFunction is used for key derivation
-type KeyDerivationFunction func(crypto.TLSExporter, protocol.Perspective) (crypto.AEAD, error)
+type KeyDerivationFunction func(crypto.TLSExporter, protocol.Perspective) (crypto.AEAD, crypto.NextAEADFunc, error)
+
+var (
+	errKeyUpdateBeforeHandshake = errors.New("CryptoSetup: can't update keys before the handshake completes")
+	errExportBeforeHandshake    = errors.New("CryptoSetup: can't export keying material before the handshake completes")
+	errExportReservedLabel      = errors.New("CryptoSetup: can't export keying material for a label reserved for QUIC")
+)
+
+// reservedExporterLabelPrefix is the prefix of the labels used to derive the packet protection keys
+const reservedExporterLabelPrefix = "EXPORTER-QUIC"
+
+// The oneRTTSealer seals packets using the 1-RTT keys of one key phase.
+type oneRTTSealer struct {
+	crypto.AEAD
+	keyPhase  int
+	numSealed uint64
+}
+
+var _ ShortHeaderSealer = &oneRTTSealer{}
+
+func (s *oneRTTSealer) Seal(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) []byte {
+	s.numSealed++
+	return s.AEAD.Seal(dst, src, packetNumber, associatedData)
+}
+
+func (s *oneRTTSealer) KeyPhase() int {
+	return s.keyPhase
+}
 
 type cryptoSetupTLS struct {
 	mutex sync.RWMutex
@@ -24,11 +54,29 @@ type cryptoSetupTLS struct {
 
 	keyDerivation KeyDerivationFunction
 	nullAEAD      crypto.AEAD
-	aead          crypto.AEAD
+	aead          crypto.AEAD // the AEAD of the current key phase
+	sealer        *oneRTTSealer
+
+	// Key updates.
+	// The AEAD of the next key phase is derived in advance, so that packets sent by the peer after a key update can be decrypted.
+	// The AEAD of the previous key phase is kept for a while, so that reordered packets can be decrypted.
+	keyUpdateInterval  uint64 // the number of packets sent before the keys are updated
+	keyUpdateRequested bool
+	keyPhase           int
+	nextAEAD           crypto.AEAD
+	nextAEADFunc       crypto.NextAEADFunc
+	prevAEAD           crypto.AEAD
+	prevAEADExpiry     time.Time
+	// the lowest packet number received with the keys of the current key phase
+	firstRcvdWithCurrentKeys protocol.PacketNumber
+	rcvdWithCurrentKeys      bool
 
 	tls            MintTLS
 	cryptoStream   *CryptoStreamConn
 	handshakeEvent chan<- struct{}
+	// imported is set if the CryptoSetup was created from the state exported by another process.
+	// The handshake was then already completed by that process.
+	imported bool
 }
 
 var _ CryptoSetupTLS = &cryptoSetupTLS{}
@@ -39,15 +87,17 @@ func NewCryptoSetupTLSServer(
 	cryptoStream *CryptoStreamConn,
 	nullAEAD crypto.AEAD,
 	handshakeEvent chan<- struct{},
+	keyUpdateInterval uint64,
 	version protocol.VersionNumber,
 ) CryptoSetupTLS {
 	return &cryptoSetupTLS{
-		tls:            tls,
-		cryptoStream:   cryptoStream,
-		nullAEAD:       nullAEAD,
-		perspective:    protocol.PerspectiveServer,
-		keyDerivation:  crypto.DeriveAESKeys,
-		handshakeEvent: handshakeEvent,
+		tls:               tls,
+		cryptoStream:      cryptoStream,
+		nullAEAD:          nullAEAD,
+		perspective:       protocol.PerspectiveServer,
+		keyDerivation:     crypto.DeriveAESKeys,
+		keyUpdateInterval: keyUpdateInterval,
+		handshakeEvent:    handshakeEvent,
 	}
 }
 
@@ -58,6 +108,7 @@ func NewCryptoSetupTLSClient(
 	hostname string,
 	handshakeEvent chan<- struct{},
 	tls MintTLS,
+	keyUpdateInterval uint64,
 	version protocol.VersionNumber,
 ) (CryptoSetupTLS, error) {
 	nullAEAD, err := crypto.NewNullAEAD(protocol.PerspectiveClient, connID, version)
@@ -66,15 +117,19 @@ func NewCryptoSetupTLSClient(
 	}
 
 	return &cryptoSetupTLS{
-		perspective:    protocol.PerspectiveClient,
-		tls:            tls,
-		nullAEAD:       nullAEAD,
-		keyDerivation:  crypto.DeriveAESKeys,
-		handshakeEvent: handshakeEvent,
+		perspective:       protocol.PerspectiveClient,
+		tls:               tls,
+		nullAEAD:          nullAEAD,
+		keyDerivation:     crypto.DeriveAESKeys,
+		keyUpdateInterval: keyUpdateInterval,
+		handshakeEvent:    handshakeEvent,
 	}, nil
 }
 
 func (h *cryptoSetupTLS) HandleCryptoStream() error {
+	if h.imported {
+		return nil
+	}
 	if h.perspective == protocol.PerspectiveServer {
 		// mint already wrote the ServerHello, EncryptedExtensions and the certificate chain to the buffer
 		// send out that data now
@@ -96,12 +151,19 @@ handshakeLoop:
 		}
 	}
 
-	aead, err := h.keyDerivation(h.tls, h.perspective)
+	aead, nextAEADFunc, err := h.keyDerivation(h.tls, h.perspective)
+	if err != nil {
+		return err
+	}
+	nextAEAD, nextAEADFunc, err := nextAEADFunc()
 	if err != nil {
 		return err
 	}
 	h.mutex.Lock()
 	h.aead = aead
+	h.sealer = &oneRTTSealer{AEAD: aead}
+	h.nextAEAD = nextAEAD
+	h.nextAEADFunc = nextAEADFunc
 	h.mutex.Unlock()
 
 	h.handshakeEvent <- struct{}{}
@@ -110,25 +172,118 @@ handshakeLoop:
 }
 
 func (h *cryptoSetupTLS) OpenHandshake(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error) {
+	if h.nullAEAD == nil {
+		return nil, errors.New("no handshake opener")
+	}
 	return h.nullAEAD.Open(dst, src, packetNumber, associatedData)
 }
 
-func (h *cryptoSetupTLS) Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+func (h *cryptoSetupTLS) Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, keyPhase int, associatedData []byte) ([]byte, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 
 	if h.aead == nil {
 		return nil, errors.New("no 1-RTT sealer")
 	}
-	return h.aead.Open(dst, src, packetNumber, associatedData)
+	h.maybeDropPreviousKeys()
+	if keyPhase == h.keyPhase {
+		data, err := h.aead.Open(dst, src, packetNumber, associatedData)
+		if err == nil && (!h.rcvdWithCurrentKeys || packetNumber < h.firstRcvdWithCurrentKeys) {
+			h.rcvdWithCurrentKeys = true
+			h.firstRcvdWithCurrentKeys = packetNumber
+		}
+		return data, err
+	}
+	// Packets sent before the peer received packets of the current key phase use the previous keys.
+	if h.prevAEAD != nil && (!h.rcvdWithCurrentKeys || packetNumber < h.firstRcvdWithCurrentKeys) {
+		return h.prevAEAD.Open(dst, src, packetNumber, associatedData)
+	}
+	data, err := h.nextAEAD.Open(dst, src, packetNumber, associatedData)
+	if err != nil {
+		return nil, err
+	}
+	// the peer initiated a key update
+	if err := h.rollKeys(); err != nil {
+		return nil, err
+	}
+	h.rcvdWithCurrentKeys = true
+	h.firstRcvdWithCurrentKeys = packetNumber
+	return data, nil
+}
+
+// UpdateKeys initiates a key update.
+// The keys are updated when the next packet is sent, as soon as the last key update is completed.
+func (h *cryptoSetupTLS) UpdateKeys() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.aead == nil {
+		return errKeyUpdateBeforeHandshake
+	}
+	h.keyUpdateRequested = true
+	return nil
+}
+
+// ExportKeyingMaterial exports keying material from the TLS session, as defined in RFC 8446, section 7.5.
+// Labels starting with "EXPORTER-QUIC" are rejected, since they would export the secrets of the packet protection keys.
+func (h *cryptoSetupTLS) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	if strings.HasPrefix(label, reservedExporterLabelPrefix) {
+		return nil, errExportReservedLabel
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.aead == nil {
+		return nil, errExportBeforeHandshake
+	}
+	return h.tls.ComputeExporter(label, context, length)
+}
+
+// rollKeys switches to the next key phase
+func (h *cryptoSetupTLS) rollKeys() error {
+	nextAEAD, nextAEADFunc, err := h.nextAEADFunc()
+	if err != nil {
+		return err
+	}
+	h.prevAEAD = h.aead
+	h.prevAEADExpiry = time.Now().Add(protocol.KeyUpdateOldKeysRetention)
+	h.aead = h.nextAEAD
+	h.nextAEAD = nextAEAD
+	h.nextAEADFunc = nextAEADFunc
+	h.keyPhase = 1 - h.keyPhase
+	h.sealer = &oneRTTSealer{AEAD: h.aead, keyPhase: h.keyPhase}
+	h.rcvdWithCurrentKeys = false
+	h.keyUpdateRequested = false
+	return nil
+}
+
+func (h *cryptoSetupTLS) maybeDropPreviousKeys() {
+	if h.prevAEAD != nil && !time.Now().Before(h.prevAEADExpiry) {
+		h.prevAEAD = nil
+	}
+}
+
+// maybeUpdateKeys initiates a key update, if it was requested or if enough packets were sent with the current keys.
+// A new key update is only possible after the peer sent packets with the current keys, and the keys of the previous key phase were dropped.
+func (h *cryptoSetupTLS) maybeUpdateKeys() error {
+	h.maybeDropPreviousKeys()
+	if h.prevAEAD != nil || !h.rcvdWithCurrentKeys {
+		return nil
+	}
+	if !h.keyUpdateRequested && h.sealer.numSealed < h.keyUpdateInterval {
+		return nil
+	}
+	return h.rollKeys()
 }
 
 func (h *cryptoSetupTLS) GetSealer() (protocol.EncryptionLevel, Sealer) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 
 	if h.aead != nil {
-		return protocol.EncryptionForwardSecure, h.aead
+		// If deriving the keys of the next key phase fails, we keep using the current keys.
+		_ = h.maybeUpdateKeys()
+		return protocol.EncryptionForwardSecure, h.sealer
 	}
 	return protocol.EncryptionUnencrypted, h.nullAEAD
 }
@@ -140,12 +295,15 @@ func (h *cryptoSetupTLS) GetSealerWithEncryptionLevel(encLevel protocol.Encrypti
 
 	switch encLevel {
 	case protocol.EncryptionUnencrypted:
+		if h.nullAEAD == nil {
+			return nil, errNoSealer
+		}
 		return h.nullAEAD, nil
 	case protocol.EncryptionForwardSecure:
 		if h.aead == nil {
 			return nil, errNoSealer
 		}
-		return h.aead, nil
+		return h.sealer, nil
 	default:
 		return nil, errNoSealer
 	}
@@ -159,9 +317,16 @@ func (h *cryptoSetupTLS) ConnectionState() ConnectionState {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	mintConnState := h.tls.ConnectionState()
-	return ConnectionState{
-		// TODO: set the ServerName, once mint exports it
+	state := ConnectionState{
+		ServerName:        h.tls.ServerName(),
 		HandshakeComplete: h.aead != nil,
 		PeerCertificates:  mintConnState.PeerCertificates,
+		VerifiedChains:    mintConnState.VerifiedChains,
+	}
+	if state.HandshakeComplete {
+		state.Version = tls.VersionTLS13
+		state.CipherSuite = uint16(mintConnState.CipherSuite.Suite)
+		state.NegotiatedProtocol = mintConnState.NextProto
 	}
+	return state
 }
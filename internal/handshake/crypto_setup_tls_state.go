@@ -0,0 +1,132 @@
+package handshake
+
+import (
+	"errors"
+	"io"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+var (
+	errStateExportBeforeHandshake = errors.New("CryptoSetup: can't export the state before the handshake completes")
+	errStateExportDuringKeyUpdate = errors.New("CryptoSetup: can't export the state while a key update is in progress")
+	errStateExportUnsupportedKeys = errors.New("CryptoSetup: the keys can't be exported")
+	errImportedExport             = errors.New("CryptoSetup: can't export keying material for a session that was imported from another process")
+)
+
+// CryptoSetupTLSState is the state of a TLS CryptoSetup after the handshake completed.
+// It is used to continue the connection in another process (see NewCryptoSetupTLSFromState).
+// It contains the secrets of the 1-RTT keys, and must be kept confidential.
+type CryptoSetupTLSState struct {
+	Secrets  crypto.OneRTTSecrets
+	KeyPhase int
+	// the lowest packet number received with the keys of the current key phase, if any
+	FirstRcvdWithCurrentKeys protocol.PacketNumber
+	RcvdWithCurrentKeys      bool
+
+	ServerName         string
+	NegotiatedProtocol string
+}
+
+// NewCryptoSetupTLSFromState creates a TLS CryptoSetup from the state exported by another process.
+// The handshake already completed, so HandleCryptoStream returns immediately.
+// Packets with a Long Header can't be decrypted any more, and keying material can't be exported.
+func NewCryptoSetupTLSFromState(
+	state *CryptoSetupTLSState,
+	perspective protocol.Perspective,
+	keyUpdateInterval uint64,
+) (CryptoSetupTLS, error) {
+	aead, nextAEADFunc, err := crypto.DeriveAESKeysFromSecrets(state.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	nextAEAD, nextAEADFunc, err := nextAEADFunc()
+	if err != nil {
+		return nil, err
+	}
+	return &cryptoSetupTLS{
+		perspective:              perspective,
+		tls:                      &importedTLS{state: state, perspective: perspective},
+		keyDerivation:            crypto.DeriveAESKeys,
+		keyUpdateInterval:        keyUpdateInterval,
+		aead:                     aead,
+		sealer:                   &oneRTTSealer{AEAD: aead, keyPhase: state.KeyPhase},
+		keyPhase:                 state.KeyPhase,
+		nextAEAD:                 nextAEAD,
+		nextAEADFunc:             nextAEADFunc,
+		firstRcvdWithCurrentKeys: state.FirstRcvdWithCurrentKeys,
+		rcvdWithCurrentKeys:      state.RcvdWithCurrentKeys,
+		imported:                 true,
+	}, nil
+}
+
+// ExportState exports the state needed to continue the connection in another process.
+// It is only possible after the handshake completed, and not while a key update is in progress.
+func (h *cryptoSetupTLS) ExportState() (*CryptoSetupTLSState, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.aead == nil {
+		return nil, errStateExportBeforeHandshake
+	}
+	h.maybeDropPreviousKeys()
+	if h.prevAEAD != nil || h.keyUpdateRequested {
+		return nil, errStateExportDuringKeyUpdate
+	}
+	e, ok := h.aead.(crypto.SecretsExporter)
+	if !ok {
+		return nil, errStateExportUnsupportedKeys
+	}
+	return &CryptoSetupTLSState{
+		Secrets:                  e.Secrets(),
+		KeyPhase:                 h.keyPhase,
+		FirstRcvdWithCurrentKeys: h.firstRcvdWithCurrentKeys,
+		RcvdWithCurrentKeys:      h.rcvdWithCurrentKeys,
+		ServerName:               h.tls.ServerName(),
+		NegotiatedProtocol:       h.tls.ConnectionState().NextProto,
+	}, nil
+}
+
+// importedTLS replaces the TLS stack of a CryptoSetup that was created from an exported state.
+// The handshake was completed by the TLS stack of the other process.
+type importedTLS struct {
+	state       *CryptoSetupTLSState
+	perspective protocol.Perspective
+}
+
+var _ MintTLS = &importedTLS{}
+
+func (t *importedTLS) GetCipherSuite() mint.CipherSuiteParams {
+	return t.state.Secrets.CipherSuite
+}
+
+func (t *importedTLS) ComputeExporter(string, []byte, int) ([]byte, error) {
+	return nil, errImportedExport
+}
+
+func (t *importedTLS) Handshake() mint.Alert {
+	return mint.AlertNoAlert
+}
+
+func (t *importedTLS) State() mint.State {
+	if t.perspective == protocol.PerspectiveClient {
+		return mint.StateClientConnected
+	}
+	return mint.StateServerConnected
+}
+
+func (t *importedTLS) ConnectionState() mint.ConnectionState {
+	return mint.ConnectionState{
+		HandshakeState: t.State(),
+		CipherSuite:    t.state.Secrets.CipherSuite,
+		NextProto:      t.state.NegotiatedProtocol,
+	}
+}
+
+func (t *importedTLS) ServerName() string {
+	return t.state.ServerName
+}
+
+func (t *importedTLS) SetCryptoStream(io.ReadWriter) {}
@@ -1,10 +1,15 @@
 package handshake
 
 import (
+	gocrypto "crypto"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/bifurcation/mint"
+	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/mocks/crypto"
 	"github.com/lucas-clemente/quic-go/internal/mocks/handshake"
@@ -14,8 +19,12 @@ import (
 	. "github.com/onsi/gomega"
 )
 
-func mockKeyDerivation(crypto.TLSExporter, protocol.Perspective) (crypto.AEAD, error) {
-	return mockcrypto.NewMockAEAD(mockCtrl), nil
+func mockNextAEAD() (crypto.AEAD, crypto.NextAEADFunc, error) {
+	return mockcrypto.NewMockAEAD(mockCtrl), mockNextAEAD, nil
+}
+
+func mockKeyDerivation(crypto.TLSExporter, protocol.Perspective) (crypto.AEAD, crypto.NextAEADFunc, error) {
+	return mockNextAEAD()
 }
 
 var _ = Describe("TLS Crypto Setup", func() {
@@ -31,6 +40,7 @@ var _ = Describe("TLS Crypto Setup", func() {
 			NewCryptoStreamConn(nil),
 			nil, // AEAD
 			handshakeEvent,
+			protocol.DefaultKeyUpdateInterval,
 			protocol.VersionTLS,
 		).(*cryptoSetupTLS)
 		cs.nullAEAD = mockcrypto.NewMockAEAD(mockCtrl)
@@ -69,14 +79,17 @@ var _ = Describe("TLS Crypto Setup", func() {
 	Context("reporting the handshake state", func() {
 		It("reports before the handshake compeletes", func() {
 			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ServerName()
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{})
 			state := cs.ConnectionState()
 			Expect(state.HandshakeComplete).To(BeFalse())
 			Expect(state.PeerCertificates).To(BeNil())
+			Expect(state.Version).To(BeZero())
 		})
 
 		It("reports after the handshake completes", func() {
 			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ServerName()
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{})
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
@@ -87,6 +100,177 @@ var _ = Describe("TLS Crypto Setup", func() {
 			Expect(state.HandshakeComplete).To(BeTrue())
 			Expect(state.PeerCertificates).To(BeNil())
 		})
+
+		It("reports the negotiated parameters after the handshake completes", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ServerName()
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{
+				CipherSuite: mint.CipherSuiteParams{Suite: mint.TLS_AES_128_GCM_SHA256},
+				NextProto:   "hq",
+			})
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+			cs.keyDerivation = mockKeyDerivation
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			state := cs.ConnectionState()
+			Expect(state.Version).To(Equal(uint16(tls.VersionTLS13)))
+			Expect(state.CipherSuite).To(Equal(tls.TLS_AES_128_GCM_SHA256))
+			Expect(state.NegotiatedProtocol).To(Equal("hq"))
+		})
+
+		It("reports the peer's certificates", func() {
+			cert := &x509.Certificate{Raw: []byte("foobar")}
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ServerName()
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			})
+			state := cs.ConnectionState()
+			Expect(state.PeerCertificates).To(Equal([]*x509.Certificate{cert}))
+			Expect(state.VerifiedChains).To(Equal([][]*x509.Certificate{{cert}}))
+		})
+
+		It("reports the server name", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ServerName().Return("quic.clemente.io")
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{})
+			Expect(cs.ConnectionState().ServerName).To(Equal("quic.clemente.io"))
+		})
+	})
+
+	Context("exporting keying material", func() {
+		It("errors before the handshake completes", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			_, err := cs.ExportKeyingMaterial("label", []byte("context"), 32)
+			Expect(err).To(MatchError(errExportBeforeHandshake))
+		})
+
+		It("exports keying material after the handshake completes", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+			cs.keyDerivation = mockKeyDerivation
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ComputeExporter("label", []byte("context"), 32).Return([]byte("keying material"), nil)
+			key, err := cs.ExportKeyingMaterial("label", []byte("context"), 32)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key).To(Equal([]byte("keying material")))
+		})
+
+		It("rejects labels reserved for QUIC", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+			cs.keyDerivation = mockKeyDerivation
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			_, err := cs.ExportKeyingMaterial("EXPORTER-QUIC server 1rtt", nil, 32)
+			Expect(err).To(MatchError(errExportReservedLabel))
+			_, err = cs.ExportKeyingMaterial("EXPORTER-QUIC-foobar", []byte("context"), 32)
+			Expect(err).To(MatchError(errExportReservedLabel))
+		})
+	})
+
+	Context("exporting the state", func() {
+		// doHandshake completes the handshake, deriving the keys from the exporter of the MintTLS
+		doHandshake := func() {
+			mtls := mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls = mtls
+			mtls.EXPECT().Handshake().Return(mint.AlertNoAlert)
+			mtls.EXPECT().State().Return(mint.StateServerConnected)
+			mtls.EXPECT().GetCipherSuite().Return(mint.CipherSuiteParams{
+				Suite:  mint.TLS_AES_128_GCM_SHA256,
+				Hash:   gocrypto.SHA256,
+				KeyLen: 16,
+				IvLen:  12,
+			}).AnyTimes()
+			mtls.EXPECT().ComputeExporter(gomock.Any(), nil, 32).DoAndReturn(func(label string, _ []byte, length int) ([]byte, error) {
+				return append([]byte(label), make([]byte, length-len(label))...), nil
+			}).Times(2)
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			mtls.EXPECT().ServerName().Return("quic.clemente.io").AnyTimes()
+			mtls.EXPECT().ConnectionState().Return(mint.ConnectionState{NextProto: "hq"}).AnyTimes()
+		}
+
+		It("errors before the handshake completes", func() {
+			_, err := cs.ExportState()
+			Expect(err).To(MatchError(errStateExportBeforeHandshake))
+		})
+
+		It("errors while a key update is in progress", func() {
+			doHandshake()
+			Expect(cs.UpdateKeys()).To(Succeed())
+			_, err := cs.ExportState()
+			Expect(err).To(MatchError(errStateExportDuringKeyUpdate))
+		})
+
+		It("errors if the keys don't expose their secrets", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+			cs.keyDerivation = mockKeyDerivation
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			_, err := cs.ExportState()
+			Expect(err).To(MatchError(errStateExportUnsupportedKeys))
+		})
+
+		It("continues using the keys in a CryptoSetup created from the state", func() {
+			doHandshake()
+			sealed := cs.sealer.Seal(nil, []byte("foobar"), 42, []byte("aad"))
+			state, err := cs.ExportState()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.KeyPhase).To(BeZero())
+			imported, err := NewCryptoSetupTLSFromState(state, protocol.PerspectiveServer, protocol.DefaultKeyUpdateInterval)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(imported.HandleCryptoStream()).To(Succeed())
+			encLevel, sealer := imported.GetSealer()
+			Expect(encLevel).To(Equal(protocol.EncryptionForwardSecure))
+			Expect(sealer.(ShortHeaderSealer).KeyPhase()).To(BeZero())
+			Expect(sealer.Seal(nil, []byte("foobar"), 42, []byte("aad"))).To(Equal(sealed))
+			// the imported CryptoSetup can't open packets with a Long Header
+			_, err = imported.OpenHandshake(nil, []byte("foobar"), 1, []byte("aad"))
+			Expect(err).To(HaveOccurred())
+			_, err = imported.GetSealerWithEncryptionLevel(protocol.EncryptionUnencrypted)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("restores the key phase", func() {
+			doHandshake()
+			Expect(cs.rollKeys()).To(Succeed())
+			cs.prevAEAD = nil // the previous keys were dropped
+			sealed := cs.sealer.Seal(nil, []byte("foobar"), 42, []byte("aad"))
+			state, err := cs.ExportState()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.KeyPhase).To(Equal(1))
+			imported, err := NewCryptoSetupTLSFromState(state, protocol.PerspectiveServer, protocol.DefaultKeyUpdateInterval)
+			Expect(err).ToNot(HaveOccurred())
+			_, sealer := imported.GetSealer()
+			Expect(sealer.(ShortHeaderSealer).KeyPhase()).To(Equal(1))
+			Expect(sealer.Seal(nil, []byte("foobar"), 42, []byte("aad"))).To(Equal(sealed))
+		})
+
+		It("reports the connection state of the exporting CryptoSetup", func() {
+			doHandshake()
+			state, err := cs.ExportState()
+			Expect(err).ToNot(HaveOccurred())
+			imported, err := NewCryptoSetupTLSFromState(state, protocol.PerspectiveServer, protocol.DefaultKeyUpdateInterval)
+			Expect(err).ToNot(HaveOccurred())
+			connState := imported.ConnectionState()
+			Expect(connState.HandshakeComplete).To(BeTrue())
+			Expect(connState.ServerName).To(Equal("quic.clemente.io"))
+			Expect(connState.CipherSuite).To(Equal(tls.TLS_AES_128_GCM_SHA256))
+			Expect(connState.NegotiatedProtocol).To(Equal("hq"))
+		})
+
+		It("doesn't export keying material for an imported CryptoSetup", func() {
+			doHandshake()
+			state, err := cs.ExportState()
+			Expect(err).ToNot(HaveOccurred())
+			imported, err := NewCryptoSetupTLSFromState(state, protocol.PerspectiveServer, protocol.DefaultKeyUpdateInterval)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = imported.ExportKeyingMaterial("label", nil, 32)
+			Expect(err).To(MatchError(errImportedExport))
+		})
 	})
 
 	Context("escalating crypto", func() {
@@ -143,9 +327,116 @@ var _ = Describe("TLS Crypto Setup", func() {
 			It("is used for opening", func() {
 				doHandshake()
 				cs.aead.(*mockcrypto.MockAEAD).EXPECT().Open(nil, []byte("encrypted"), protocol.PacketNumber(6), []byte{}).Return([]byte("decrypted"), nil)
-				d, err := cs.Open1RTT(nil, []byte("encrypted"), 6, []byte{})
+				d, err := cs.Open1RTT(nil, []byte("encrypted"), 6, 0, []byte{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(d).To(Equal([]byte("decrypted")))
+			})
+		})
+
+		Context("key updates", func() {
+			var aead0, aead1, aead2 *mockcrypto.MockAEAD
+
+			BeforeEach(func() {
+				doHandshake()
+				aead0 = cs.aead.(*mockcrypto.MockAEAD)
+				aead1 = cs.nextAEAD.(*mockcrypto.MockAEAD)
+			})
+
+			// receive receives a packet, and checks that it was opened by the AEAD
+			receive := func(aead *mockcrypto.MockAEAD, pn protocol.PacketNumber, keyPhase int) {
+				aead.EXPECT().Open(nil, []byte("encrypted"), pn, []byte{}).Return([]byte("decrypted"), nil)
+				d, err := cs.Open1RTT(nil, []byte("encrypted"), pn, keyPhase, []byte{})
 				Expect(err).ToNot(HaveOccurred())
 				Expect(d).To(Equal([]byte("decrypted")))
+			}
+
+			// send gets the sealer, seals a packet, and returns the key phase of the sealer
+			send := func(aead *mockcrypto.MockAEAD) int {
+				_, sealer := cs.GetSealer()
+				aead.EXPECT().Seal(nil, []byte("foobar"), gomock.Any(), []byte{}).Return([]byte("foobar sealed"))
+				sealer.Seal(nil, []byte("foobar"), 1, []byte{})
+				return sealer.(ShortHeaderSealer).KeyPhase()
+			}
+
+			It("starts with key phase 0", func() {
+				Expect(send(aead0)).To(BeZero())
+			})
+
+			It("errors when updating keys before the handshake completes", func() {
+				cs.aead = nil
+				Expect(cs.UpdateKeys()).To(MatchError(errKeyUpdateBeforeHandshake))
+			})
+
+			It("handles a key update initiated by the peer", func() {
+				receive(aead0, 10, 0)
+				receive(aead1, 11, 1)
+				Expect(cs.keyPhase).To(Equal(1))
+				Expect(send(aead1)).To(Equal(1))
+			})
+
+			It("errors if a packet with the other key phase can't be decrypted", func() {
+				receive(aead0, 10, 0)
+				aead1.EXPECT().Open(nil, []byte("encrypted"), protocol.PacketNumber(11), []byte{}).Return(nil, errors.New("authentication failed"))
+				_, err := cs.Open1RTT(nil, []byte("encrypted"), 11, 1, []byte{})
+				Expect(err).To(MatchError("authentication failed"))
+				Expect(cs.keyPhase).To(BeZero())
+			})
+
+			It("uses the previous keys for reordered packets", func() {
+				receive(aead0, 10, 0)
+				receive(aead1, 12, 1)
+				receive(aead0, 11, 0)
+			})
+
+			It("drops the previous keys after a while", func() {
+				receive(aead0, 10, 0)
+				receive(aead1, 12, 1)
+				aead2 = cs.nextAEAD.(*mockcrypto.MockAEAD)
+				cs.prevAEADExpiry = time.Now().Add(-time.Second)
+				// the packet is now treated as a key update to the next key phase
+				aead2.EXPECT().Open(nil, []byte("encrypted"), protocol.PacketNumber(11), []byte{}).Return(nil, errors.New("authentication failed"))
+				_, err := cs.Open1RTT(nil, []byte("encrypted"), 11, 0, []byte{})
+				Expect(err).To(MatchError("authentication failed"))
+				Expect(cs.prevAEAD).To(BeNil())
+			})
+
+			It("updates the keys after sending the configured number of packets", func() {
+				cs.keyUpdateInterval = 3
+				receive(aead0, 10, 0)
+				for i := 0; i < 3; i++ {
+					Expect(send(aead0)).To(BeZero())
+				}
+				Expect(send(aead1)).To(Equal(1))
+			})
+
+			It("updates the keys when requested", func() {
+				receive(aead0, 10, 0)
+				Expect(cs.UpdateKeys()).To(Succeed())
+				Expect(send(aead1)).To(Equal(1))
+				// the peer still uses the old keys
+				receive(aead0, 11, 0)
+				// the peer responds to the key update
+				receive(aead1, 12, 1)
+				Expect(cs.keyPhase).To(Equal(1))
+			})
+
+			It("doesn't update the keys before receiving a packet with the current keys", func() {
+				Expect(cs.UpdateKeys()).To(Succeed())
+				Expect(send(aead0)).To(BeZero())
+				receive(aead0, 10, 0)
+				Expect(send(aead1)).To(Equal(1))
+			})
+
+			It("doesn't update the keys again before the previous keys were dropped", func() {
+				receive(aead0, 10, 0)
+				Expect(cs.UpdateKeys()).To(Succeed())
+				Expect(send(aead1)).To(Equal(1))
+				receive(aead1, 11, 1)
+				aead2 = cs.nextAEAD.(*mockcrypto.MockAEAD)
+				Expect(cs.UpdateKeys()).To(Succeed())
+				Expect(send(aead1)).To(Equal(1))
+				cs.prevAEADExpiry = time.Now().Add(-time.Second)
+				Expect(send(aead2)).To(BeZero())
 			})
 		})
 
@@ -204,6 +495,7 @@ var _ = Describe("TLS Crypto Setup, for the client", func() {
 			"quic.clemente.io",
 			handshakeEvent,
 			nil, // mintTLS
+			protocol.DefaultKeyUpdateInterval,
 			protocol.VersionTLS,
 		)
 		Expect(err).ToNot(HaveOccurred())
@@ -3,6 +3,7 @@ package handshake
 import (
 	"crypto/x509"
 	"io"
+	"time"
 
 	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
@@ -15,6 +16,13 @@ type Sealer interface {
 	Overhead() int
 }
 
+// A ShortHeaderSealer seals packets sent with an IETF QUIC Short Header.
+// The Key Phase bit of the header must be set to the value returned by KeyPhase.
+type ShortHeaderSealer interface {
+	Sealer
+	KeyPhase() int
+}
+
 // A TLSExtensionHandler sends and received the QUIC TLS extension.
 // It provides the parameters sent by the peer on a channel.
 type TLSExtensionHandler interface {
@@ -31,6 +39,8 @@ type MintTLS interface {
 	Handshake() mint.Alert
 	State() mint.State
 	ConnectionState() mint.ConnectionState
+	// ServerName returns the server name sent in the ClientHello.
+	ServerName() string
 
 	SetCryptoStream(io.ReadWriter)
 }
@@ -56,13 +66,63 @@ type CryptoSetupTLS interface {
 	baseCryptoSetup
 
 	OpenHandshake(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
-	Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
+	Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, keyPhase int, associatedData []byte) ([]byte, error)
+	UpdateKeys() error
+	ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error)
+	ExportState() (*CryptoSetupTLSState, error)
+}
+
+// A ClientSessionCache stores the state that a client needs to send 0-RTT data to a server.
+// This state is opaque to the cache.
+type ClientSessionCache interface {
+	Get(sessionKey string) (state []byte, ok bool)
+	Put(sessionKey string, state []byte)
 }
 
 // ConnectionState records basic details about the QUIC connection.
 // Warning: This API should not be considered stable and might change soon.
 type ConnectionState struct {
-	HandshakeComplete bool                // handshake is complete
-	ServerName        string              // server name requested by client, if any (server side only)
-	PeerCertificates  []*x509.Certificate // certificate chain presented by remote peer
+	HandshakeComplete bool                  // handshake is complete
+	ServerName        string                // server name requested by client, if any (server side only)
+	PeerCertificates  []*x509.Certificate   // certificate chain presented by remote peer
+	VerifiedChains    [][]*x509.Certificate // verified chains built from PeerCertificates (IETF QUIC only)
+	Used0RTT          bool                  // the server accepted the 0-RTT data sent by the client (client side only)
+	// Version, CipherSuite and NegotiatedProtocol are only set for IETF QUIC, once the handshake completed.
+	// gQUIC doesn't use TLS.
+	Version            uint16 // TLS version used by the connection (always TLS 1.3)
+	CipherSuite        uint16 // TLS cipher suite used by the connection
+	NegotiatedProtocol string // application protocol negotiated using ALPN
+	// PeerTransportParameters are the transport parameters sent by the peer.
+	// It is nil until they were received.
+	PeerTransportParameters *PeerTransportParameters
+}
+
+// PeerTransportParameters are the transport parameters that the peer sent during the handshake.
+// They define the limits that apply to data sent to the peer.
+// Warning: This API should not be considered stable and might change soon.
+type PeerTransportParameters struct {
+	// IdleTimeout is the peer's idle timeout.
+	// The connection uses the minimum of this value and the local idle timeout.
+	IdleTimeout time.Duration
+	// InitialMaxData is the initial connection-level flow control window.
+	InitialMaxData protocol.ByteCount
+	// InitialMaxStreamData is the initial stream-level flow control window.
+	InitialMaxStreamData protocol.ByteCount
+	// MaxBidiStreams is the number of bidirectional streams that may be opened.
+	MaxBidiStreams uint64
+	// MaxUniStreams is the number of unidirectional streams that may be opened.
+	// It is only used for IETF QUIC.
+	MaxUniStreams uint64
+	// MaxPacketSize is the maximum size of packets that the peer accepts.
+	// It is 0 if the peer didn't send a limit.
+	MaxPacketSize protocol.ByteCount
+	// MaxDatagramFrameSize is the maximum size of DATAGRAM frames that the peer accepts.
+	// It is 0 if the peer doesn't support DATAGRAM frames.
+	MaxDatagramFrameSize protocol.ByteCount
+	// DisableMigration is set if the peer doesn't support connection migration.
+	// It is only used for IETF QUIC.
+	DisableMigration bool
+	// MaxAckDelay is the maximum time that the peer delays sending ACKs.
+	// It is only used for IETF QUIC.
+	MaxAckDelay time.Duration
 }
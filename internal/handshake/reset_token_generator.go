@@ -0,0 +1,40 @@
+package handshake
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+const resetTokenKeyLen = 32
+
+// A ResetTokenGenerator derives the stateless reset tokens for connection IDs.
+// Since the token only depends on the key and the connection ID, a server can send a stateless reset
+// for a connection it doesn't have any state for, e.g. after a restart.
+// It is safe for concurrent use.
+type ResetTokenGenerator struct {
+	key []byte
+}
+
+// NewResetTokenGenerator initializes a new ResetTokenGenerator.
+// If no key is given, a random key is generated.
+func NewResetTokenGenerator(key []byte) (*ResetTokenGenerator, error) {
+	if len(key) == 0 {
+		key = make([]byte, resetTokenKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &ResetTokenGenerator{key: key}, nil
+}
+
+// GetResetToken returns the stateless reset token for a connection ID
+func (g *ResetTokenGenerator) GetResetToken(connID protocol.ConnectionID) protocol.StatelessResetToken {
+	h := hmac.New(sha256.New, g.key)
+	h.Write(connID)
+	var token protocol.StatelessResetToken
+	copy(token[:], h.Sum(nil))
+	return token
+}
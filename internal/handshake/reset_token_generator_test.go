@@ -0,0 +1,41 @@
+package handshake
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reset Token Generator", func() {
+	It("generates different tokens for different connection IDs", func() {
+		g, err := NewResetTokenGenerator([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		token1 := g.GetResetToken(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8})
+		token2 := g.GetResetToken(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1})
+		Expect(token1).ToNot(Equal(token2))
+		Expect(g.GetResetToken(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8})).To(Equal(token1))
+	})
+
+	It("generates the same tokens for the same key", func() {
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		g1, err := NewResetTokenGenerator([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		g2, err := NewResetTokenGenerator([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		g3, err := NewResetTokenGenerator([]byte("raboof"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(g1.GetResetToken(connID)).To(Equal(g2.GetResetToken(connID)))
+		Expect(g1.GetResetToken(connID)).ToNot(Equal(g3.GetResetToken(connID)))
+	})
+
+	It("generates a random key, if none is given", func() {
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		g1, err := NewResetTokenGenerator(nil)
+		Expect(err).ToNot(HaveOccurred())
+		g2, err := NewResetTokenGenerator(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(g1.key).To(HaveLen(resetTokenKeyLen))
+		Expect(g1.GetResetToken(connID)).ToNot(Equal(g2.GetResetToken(connID)))
+	})
+})
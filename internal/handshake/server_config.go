@@ -3,17 +3,29 @@ package handshake
 import (
 	"bytes"
 	"crypto/rand"
+	"io"
+	"net"
+	"time"
 
+	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 )
 
 // ServerConfig is a server config
 type ServerConfig struct {
-	kex             crypto.KeyExchange
-	certChain       crypto.CertChain
-	ID              []byte
-	obit            []byte
-	cookieGenerator *CookieGenerator
+	kex            crypto.KeyExchange
+	certChain      crypto.CertChain
+	ID             []byte
+	obit           []byte
+	tokenGenerator *TokenGenerator
+
+	// strikeRegister remembers the ClientHellos accepted for 0-RTT, it is only set if 0-RTT is single-use
+	strikeRegister *strikeRegister
+
+	// KeyLogWriter is the key log that the keys of the sessions are written to, see tls.Config.KeyLogWriter
+	KeyLogWriter io.Writer
+	// Allow0RTT is called for ClientHellos sent using 0-RTT, see quic.Config.Allow0RTT
+	Allow0RTT func(clientAddr net.Addr, tokenAge time.Duration) bool
 }
 
 // NewServerConfig creates a new server config
@@ -29,18 +41,18 @@ func NewServerConfig(kex crypto.KeyExchange, certChain crypto.CertChain) (*Serve
 		return nil, err
 	}
 
-	cookieGenerator, err := NewCookieGenerator()
+	tokenGenerator, err := NewTokenGenerator(time.Now)
 
 	if err != nil {
 		return nil, err
 	}
 
 	return &ServerConfig{
-		kex:             kex,
-		certChain:       certChain,
-		ID:              id,
-		obit:            obit,
-		cookieGenerator: cookieGenerator,
+		kex:            kex,
+		certChain:      certChain,
+		ID:             id,
+		obit:           obit,
+		tokenGenerator: tokenGenerator,
 	}, nil
 }
 
@@ -71,3 +83,22 @@ func (s *ServerConfig) Sign(sni string, chlo []byte) ([]byte, error) {
 func (s *ServerConfig) GetCertsCompressed(sni string, commonSetHashes, compressedHashes []byte) ([]byte, error) {
 	return s.certChain.GetCertsCompressed(sni, commonSetHashes, compressedHashes)
 }
+
+// EnableSingleUse0RTT makes sure that every ClientHello is only accepted once.
+// Replayed ClientHellos are rejected, such that the 0-RTT data sent with them is not processed.
+func (s *ServerConfig) EnableSingleUse0RTT() {
+	s.strikeRegister = newStrikeRegister()
+}
+
+// SetTokenProtector sets the protector used to encrypt the source address tokens (STKs).
+func (s *ServerConfig) SetTokenProtector(protector mint.CookieProtector) {
+	s.tokenGenerator = NewTokenGeneratorWithProtector(time.Now, protector)
+}
+
+// WithCertChain returns a copy of the server config that uses a different certificate chain.
+// The copy uses the same key exchange and ID as the original.
+func (s *ServerConfig) WithCertChain(certChain crypto.CertChain) *ServerConfig {
+	scfg := *s
+	scfg.certChain = certChain
+	return &scfg
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -27,7 +28,7 @@ var _ = Describe("ServerConfig", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(scfg1.ID).ToNot(Equal(scfg2.ID))
 		Expect(scfg1.obit).ToNot(Equal(scfg2.obit))
-		Expect(scfg1.cookieGenerator).ToNot(Equal(scfg2.cookieGenerator))
+		Expect(scfg1.tokenGenerator).ToNot(Equal(scfg2.tokenGenerator))
 	})
 
 	It("gets the proper binary representation", func() {
@@ -42,4 +43,14 @@ var _ = Describe("ServerConfig", func() {
 		expected.Write([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
 		Expect(scfg.Get()).To(Equal(expected.Bytes()))
 	})
+
+	It("creates a copy with a different certificate chain", func() {
+		scfg, err := NewServerConfig(kex, nil)
+		Expect(err).NotTo(HaveOccurred())
+		certChain := crypto.NewCertChain(testdata.GetTLSConfig())
+		scfg2 := scfg.WithCertChain(certChain)
+		Expect(scfg2.certChain).To(Equal(certChain))
+		Expect(scfg.certChain).To(BeNil())
+		Expect(scfg2.Get()).To(Equal(scfg.Get()))
+	})
 })
@@ -0,0 +1,79 @@
+package handshake
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+var (
+	errReplayedNonce      = errors.New("nonce was already used")
+	errStrikeRegisterFull = errors.New("too many nonces")
+	errNonceOutsideWindow = errors.New("nonce timestamp outside of the strike window")
+)
+
+type strikeRegisterEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// A strikeRegister remembers the client nonces of the ClientHellos it accepted, to detect replays.
+// A client nonce starts with the time it was generated at.
+// Only nonces with a timestamp within the window around the current time are accepted,
+// so a nonce needs to be remembered until its timestamp left the window.
+// It is safe for concurrent use.
+type strikeRegister struct {
+	mutex sync.Mutex
+
+	window     time.Duration
+	maxEntries int
+	nonces     map[string]struct{}
+	queue      *list.List // ordered by expiry, the oldest entry is at the front
+}
+
+func newStrikeRegister() *strikeRegister {
+	return &strikeRegister{
+		window:     protocol.StrikeRegisterWindow,
+		maxEntries: protocol.MaxRemembered0RTTClientHellos,
+		nonces:     make(map[string]struct{}),
+		queue:      list.New(),
+	}
+}
+
+// Add adds the nonce. It returns an error if the nonce was already added before,
+// if its timestamp is outside of the window, or if the register is full.
+func (r *strikeRegister) Add(nonce []byte, now time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for e := r.queue.Front(); e != nil; e = r.queue.Front() {
+		entry := e.Value.(*strikeRegisterEntry)
+		if now.Before(entry.expires) {
+			break
+		}
+		r.queue.Remove(e)
+		delete(r.nonces, entry.nonce)
+	}
+	if len(nonce) < 4 {
+		return errNonceOutsideWindow
+	}
+	timestamp := time.Unix(int64(binary.BigEndian.Uint32(nonce)), 0)
+	if now.Sub(timestamp) > r.window || timestamp.Sub(now) > r.window {
+		return errNonceOutsideWindow
+	}
+	if _, ok := r.nonces[string(nonce)]; ok {
+		return errReplayedNonce
+	}
+	if len(r.nonces) >= r.maxEntries {
+		return errStrikeRegisterFull
+	}
+	r.nonces[string(nonce)] = struct{}{}
+	// The timestamp leaves the window at most 2 windows from now.
+	// Using the same lifetime for all entries keeps the queue ordered by expiry.
+	r.queue.PushBack(&strikeRegisterEntry{nonce: string(nonce), expires: now.Add(2 * r.window)})
+	return nil
+}
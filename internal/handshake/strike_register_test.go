@@ -0,0 +1,65 @@
+package handshake
+
+import (
+	"encoding/binary"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strike Register", func() {
+	var (
+		r   *strikeRegister
+		now time.Time
+	)
+
+	// nonce creates a client nonce with the given timestamp
+	nonce := func(t time.Time, val string) []byte {
+		n := make([]byte, 4, 4+len(val))
+		binary.BigEndian.PutUint32(n, uint32(t.Unix()))
+		return append(n, val...)
+	}
+
+	BeforeEach(func() {
+		r = newStrikeRegister()
+		now = time.Unix(1500000000, 0)
+	})
+
+	It("rejects nonces that were added before", func() {
+		Expect(r.Add(nonce(now, "foo"), now)).To(Succeed())
+		Expect(r.Add(nonce(now, "bar"), now)).To(Succeed())
+		Expect(r.Add(nonce(now, "foo"), now.Add(time.Second))).To(MatchError(errReplayedNonce))
+	})
+
+	It("rejects nonces with a timestamp outside of the window", func() {
+		Expect(r.Add(nonce(now.Add(-r.window-time.Second), "foo"), now)).To(MatchError(errNonceOutsideWindow))
+		Expect(r.Add(nonce(now.Add(r.window+time.Second), "foo"), now)).To(MatchError(errNonceOutsideWindow))
+		Expect(r.Add(nonce(now.Add(-r.window), "foo"), now)).To(Succeed())
+		Expect(r.Add(nonce(now.Add(r.window), "bar"), now)).To(Succeed())
+		Expect(r.nonces).To(HaveLen(2))
+	})
+
+	It("rejects nonces that are too short to contain a timestamp", func() {
+		Expect(r.Add([]byte("foo"), now)).To(MatchError(errNonceOutsideWindow))
+	})
+
+	It("forgets nonces after their timestamp left the window", func() {
+		n := nonce(now.Add(r.window), "foo")
+		Expect(r.Add(n, now)).To(Succeed())
+		Expect(r.Add(nonce(now.Add(2*r.window), "bar"), now.Add(r.window))).To(Succeed())
+		Expect(r.Add(n, now.Add(2*r.window-time.Nanosecond))).To(MatchError(errReplayedNonce))
+		// The nonce is forgotten, but it is now outside of the window.
+		Expect(r.Add(n, now.Add(2*r.window+time.Second))).To(MatchError(errNonceOutsideWindow))
+		Expect(r.nonces).To(HaveLen(1))
+		Expect(r.queue.Len()).To(Equal(1))
+	})
+
+	It("rejects nonces when it is full", func() {
+		r.maxEntries = 2
+		Expect(r.Add(nonce(now, "foo"), now)).To(Succeed())
+		Expect(r.Add(nonce(now, "bar"), now)).To(Succeed())
+		Expect(r.Add(nonce(now, "baz"), now)).To(MatchError(errStrikeRegisterFull))
+		Expect(r.Add(nonce(now.Add(2*r.window), "baz"), now.Add(2*r.window))).To(Succeed())
+	})
+})
@@ -16,6 +16,9 @@ const (
 	maxPacketSizeParameterID         transportParameterID = 0x5
 	statelessResetTokenParameterID   transportParameterID = 0x6
 	initialMaxStreamsUniParameterID  transportParameterID = 0x8
+	disableMigrationParameterID      transportParameterID = 0x9
+	maxAckDelayParameterID           transportParameterID = 0xc
+	maxDatagramFrameSizeParameterID  transportParameterID = 0x20
 )
 
 type transportParameter struct {
@@ -52,3 +55,19 @@ func (e *tlsExtensionBody) Unmarshal(data []byte) (int, error) {
 	e.data = data
 	return len(data), nil
 }
+
+// NewExtensionListWithBody returns an ExtensionList containing the QUIC extension with the given body.
+// It is used with TLS stacks that encode the QUIC extension themselves, and only expose its body.
+func NewExtensionListWithBody(data []byte) *mint.ExtensionList {
+	return &mint.ExtensionList{{ExtensionType: quicTLSExtensionType, ExtensionData: data}}
+}
+
+// GetExtensionBody returns the body of the QUIC extension contained in the ExtensionList.
+// It returns nil if the list doesn't contain the QUIC extension.
+func GetExtensionBody(el *mint.ExtensionList) []byte {
+	ext := &tlsExtensionBody{}
+	if found, err := el.Find(ext); err != nil || !found {
+		return nil
+	}
+	return ext.data
+}
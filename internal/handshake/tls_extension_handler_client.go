@@ -108,17 +108,17 @@ func (h *extensionHandlerClient) Receive(hType mint.HandshakeType, el *mint.Exte
 	}
 
 	// check that the server sent the stateless reset token
-	var foundStatelessResetToken bool
+	var statelessResetToken *protocol.StatelessResetToken
 	for _, p := range eetp.Parameters {
 		if p.Parameter == statelessResetTokenParameterID {
-			if len(p.Value) != 16 {
+			if len(p.Value) != len(protocol.StatelessResetToken{}) {
 				return fmt.Errorf("wrong length for stateless_reset_token: %d (expected 16)", len(p.Value))
 			}
-			foundStatelessResetToken = true
-			// TODO: handle this value
+			statelessResetToken = &protocol.StatelessResetToken{}
+			copy(statelessResetToken[:], p.Value)
 		}
 	}
-	if !foundStatelessResetToken {
+	if statelessResetToken == nil {
 		// TODO: return the right error here
 		return errors.New("server didn't sent stateless_reset_token")
 	}
@@ -126,6 +126,7 @@ func (h *extensionHandlerClient) Receive(hType mint.HandshakeType, el *mint.Exte
 	if err != nil {
 		return err
 	}
+	params.StatelessResetToken = statelessResetToken
 	h.logger.Debugf("Received Transport Parameters: %s", params)
 	h.paramsChan <- *params
 	return nil
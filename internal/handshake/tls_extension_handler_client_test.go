@@ -104,6 +104,23 @@ var _ = Describe("TLS Extension Handler, for the client", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("saves the stateless reset token", func() {
+			parameters[statelessResetTokenParameterID] = bytes.Repeat([]byte{0x42}, 16)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				addEncryptedExtensionsWithParameters(parameters)
+				err := handler.Receive(mint.HandshakeTypeEncryptedExtensions, &el)
+				Expect(err).ToNot(HaveOccurred())
+				close(done)
+			}()
+			var params TransportParameters
+			Eventually(handler.GetPeerParams()).Should(Receive(&params))
+			Eventually(done).Should(BeClosed())
+			Expect(params.StatelessResetToken).ToNot(BeNil())
+			Expect(params.StatelessResetToken[:]).To(Equal(bytes.Repeat([]byte{0x42}, 16)))
+		})
+
 		It("errors if the EncryptedExtensions message doesn't contain TransportParameters", func() {
 			err := handler.Receive(mint.HandshakeTypeEncryptedExtensions, &el)
 			Expect(err).To(MatchError("EncryptedExtensions message didn't contain a QUIC extension"))
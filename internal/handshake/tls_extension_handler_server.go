@@ -1,7 +1,6 @@
 package handshake
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 
@@ -50,11 +49,10 @@ func (h *extensionHandlerServer) Send(hType mint.HandshakeType, el *mint.Extensi
 		return nil
 	}
 
-	transportParams := append(
-		h.ourParams.getTransportParameters(),
-		// TODO(#855): generate a real token
-		transportParameter{statelessResetTokenParameterID, bytes.Repeat([]byte{42}, 16)},
-	)
+	transportParams := h.ourParams.getTransportParameters()
+	if token := h.ourParams.StatelessResetToken; token != nil {
+		transportParams = append(transportParams, transportParameter{statelessResetTokenParameterID, token[:]})
+	}
 	supportedVersions := protocol.GetGreasedVersions(h.supportedVersions)
 	versions := make([]uint32, len(supportedVersions))
 	for i, v := range supportedVersions {
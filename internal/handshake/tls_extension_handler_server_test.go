@@ -62,6 +62,21 @@ var _ = Describe("TLS Extension Handler, for the server", func() {
 				Expect(eetp.SupportedVersions).To(ContainElement(uint32(version)))
 			}
 		})
+
+		It("sends the stateless reset token", func() {
+			token := protocol.StatelessResetToken{0xde, 0xad, 0xbe, 0xef}
+			handler.ourParams.StatelessResetToken = &token
+			err := handler.Send(mint.HandshakeTypeEncryptedExtensions, &el)
+			Expect(err).ToNot(HaveOccurred())
+			ext := &tlsExtensionBody{}
+			found, err := el.Find(ext)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			eetp := &encryptedExtensionsTransportParameters{}
+			_, err = syntax.Unmarshal(ext.data, eetp)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eetp.Parameters).To(ContainElement(transportParameter{statelessResetTokenParameterID, token[:]}))
+		})
 	})
 
 	Context("receiving", func() {
@@ -1,6 +1,8 @@
 package handshake
 
 import (
+	"github.com/bifurcation/mint"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -29,4 +31,17 @@ var _ = Describe("TLS extension body", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(data).To(Equal([]byte("foo")))
 	})
+
+	It("creates an extension list with the body", func() {
+		el := NewExtensionListWithBody([]byte("foobar"))
+		Expect(*el).To(HaveLen(1))
+		Expect((*el)[0].ExtensionType).To(BeEquivalentTo(quicTLSExtensionType))
+		Expect(GetExtensionBody(el)).To(Equal([]byte("foobar")))
+	})
+
+	It("returns nil if the extension list doesn't contain the QUIC extension", func() {
+		Expect(GetExtensionBody(&mint.ExtensionList{})).To(BeNil())
+		el := &mint.ExtensionList{{ExtensionType: quicTLSExtensionType + 1, ExtensionData: []byte("foobar")}}
+		Expect(GetExtensionBody(el)).To(BeNil())
+	})
 })
@@ -0,0 +1,126 @@
+package handshake
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/bifurcation/mint"
+)
+
+const (
+	tokenPrefixIP byte = iota
+	tokenPrefixString
+)
+
+// A Token is derived from the client address and can be used to verify the ownership of this address.
+type Token struct {
+	// IsRetryToken is set for tokens sent in a Retry.
+	// Other tokens are sent in a NEW_TOKEN frame (for IETF QUIC) or as an STK (for gQUIC).
+	IsRetryToken bool
+	RemoteAddr   string
+	// The time that the token was issued (resolution 1 second)
+	SentTime time.Time
+}
+
+// token is the struct that is used for ASN1 serialization and deserialization
+type token struct {
+	IsRetryToken bool
+	Data         []byte
+	Timestamp    int64
+}
+
+// A TokenGenerator generates Tokens
+type TokenGenerator struct {
+	cookieProtector mint.CookieProtector
+	// now returns the current time. It is used to set the timestamp of new Tokens.
+	now func() time.Time
+}
+
+// NewTokenGenerator initializes a new TokenGenerator.
+// The time source is used to timestamp the Tokens, usually it is time.Now.
+func NewTokenGenerator(now func() time.Time) (*TokenGenerator, error) {
+	cookieProtector, err := mint.NewDefaultCookieProtector()
+	if err != nil {
+		return nil, err
+	}
+	return NewTokenGeneratorWithProtector(now, cookieProtector), nil
+}
+
+// NewTokenGeneratorWithProtector initializes a new TokenGenerator that encrypts the Tokens using the given protector,
+// e.g. a TokenProtector, such that Tokens can be decoded by other servers using the same keys.
+func NewTokenGeneratorWithProtector(now func() time.Time, protector mint.CookieProtector) *TokenGenerator {
+	return &TokenGenerator{
+		cookieProtector: protector,
+		now:             now,
+	}
+}
+
+// NewRetryToken generates a new token for a Retry for a given source address
+func (g *TokenGenerator) NewRetryToken(raddr net.Addr) ([]byte, error) {
+	return g.newToken(raddr, true)
+}
+
+// NewToken generates a new token to be sent in a NEW_TOKEN frame (or as an STK) for a given source address
+func (g *TokenGenerator) NewToken(raddr net.Addr) ([]byte, error) {
+	return g.newToken(raddr, false)
+}
+
+func (g *TokenGenerator) newToken(raddr net.Addr, isRetryToken bool) ([]byte, error) {
+	data, err := asn1.Marshal(token{
+		IsRetryToken: isRetryToken,
+		Data:         encodeRemoteAddr(raddr),
+		Timestamp:    g.now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g.cookieProtector.NewToken(data)
+}
+
+// DecodeToken decodes a Token
+func (g *TokenGenerator) DecodeToken(encrypted []byte) (*Token, error) {
+	// if the client didn't send any Token, DecodeToken will be called with a nil-slice
+	if len(encrypted) == 0 {
+		return nil, nil
+	}
+
+	data, err := g.cookieProtector.DecodeToken(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	t := &token{}
+	rest, err := asn1.Unmarshal(data, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("rest when unpacking token: %d", len(rest))
+	}
+	return &Token{
+		IsRetryToken: t.IsRetryToken,
+		RemoteAddr:   decodeRemoteAddr(t.Data),
+		SentTime:     time.Unix(t.Timestamp, 0),
+	}, nil
+}
+
+// encodeRemoteAddr encodes a remote address such that it can be saved in the Token
+func encodeRemoteAddr(remoteAddr net.Addr) []byte {
+	if udpAddr, ok := remoteAddr.(*net.UDPAddr); ok {
+		return append([]byte{tokenPrefixIP}, udpAddr.IP...)
+	}
+	return append([]byte{tokenPrefixString}, []byte(remoteAddr.String())...)
+}
+
+// decodeRemoteAddr decodes the remote address saved in the Token
+func decodeRemoteAddr(data []byte) string {
+	// data will never be empty for a Token that we generated. Check it to be on the safe side
+	if len(data) == 0 {
+		return ""
+	}
+	if data[0] == tokenPrefixIP {
+		return net.IP(data[1:]).String()
+	}
+	return string(data[1:])
+}
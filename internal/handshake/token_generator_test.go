@@ -9,49 +9,70 @@ import (
 	. "github.com/onsi/gomega"
 )
 
-var _ = Describe("Cookie Generator", func() {
-	var cookieGen *CookieGenerator
+var _ = Describe("Token Generator", func() {
+	var tokenGen *TokenGenerator
 
 	BeforeEach(func() {
 		var err error
-		cookieGen, err = NewCookieGenerator()
+		tokenGen, err = NewTokenGenerator(time.Now)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
-	It("generates a Cookie", func() {
+	It("generates a Token", func() {
 		ip := net.IPv4(127, 0, 0, 1)
-		token, err := cookieGen.NewToken(&net.UDPAddr{IP: ip, Port: 1337})
+		token, err := tokenGen.NewToken(&net.UDPAddr{IP: ip, Port: 1337})
 		Expect(err).ToNot(HaveOccurred())
 		Expect(token).ToNot(BeEmpty())
 	})
 
+	It("generates retry tokens", func() {
+		token, err := tokenGen.NewRetryToken(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337})
+		Expect(err).ToNot(HaveOccurred())
+		t, err := tokenGen.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.IsRetryToken).To(BeTrue())
+		Expect(t.RemoteAddr).To(Equal("192.168.0.1"))
+	})
+
 	It("works with nil tokens", func() {
-		cookie, err := cookieGen.DecodeToken(nil)
+		cookie, err := tokenGen.DecodeToken(nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(cookie).To(BeNil())
 	})
 
-	It("accepts a valid cookie", func() {
+	It("accepts a valid token", func() {
 		ip := net.IPv4(192, 168, 0, 1)
-		token, err := cookieGen.NewToken(&net.UDPAddr{IP: ip, Port: 1337})
+		token, err := tokenGen.NewToken(&net.UDPAddr{IP: ip, Port: 1337})
 		Expect(err).ToNot(HaveOccurred())
-		cookie, err := cookieGen.DecodeToken(token)
+		cookie, err := tokenGen.DecodeToken(token)
 		Expect(err).ToNot(HaveOccurred())
+		Expect(cookie.IsRetryToken).To(BeFalse())
 		Expect(cookie.RemoteAddr).To(Equal("192.168.0.1"))
-		// the time resolution of the Cookie is just 1 second
-		// if Cookie generation and this check happen in "different seconds", the difference will be between 1 and 2 seconds
+		// the time resolution of the Token is just 1 second
+		// if Token generation and this check happen in "different seconds", the difference will be between 1 and 2 seconds
 		Expect(cookie.SentTime).To(BeTemporally("~", time.Now(), 2*time.Second))
 	})
 
+	It("uses the time source to set the timestamp", func() {
+		t := time.Unix(1500000000, 0)
+		tokenGen, err := NewTokenGenerator(func() time.Time { return t })
+		Expect(err).ToNot(HaveOccurred())
+		token, err := tokenGen.NewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337})
+		Expect(err).ToNot(HaveOccurred())
+		cookie, err := tokenGen.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cookie.SentTime).To(Equal(t))
+	})
+
 	It("rejects invalid tokens", func() {
-		_, err := cookieGen.DecodeToken([]byte("invalid token"))
+		_, err := tokenGen.DecodeToken([]byte("invalid token"))
 		Expect(err).To(HaveOccurred())
 	})
 
 	It("rejects tokens that cannot be decoded", func() {
-		token, err := cookieGen.cookieProtector.NewToken([]byte("foobar"))
+		token, err := tokenGen.cookieProtector.NewToken([]byte("foobar"))
 		Expect(err).ToNot(HaveOccurred())
-		_, err = cookieGen.DecodeToken(token)
+		_, err = tokenGen.DecodeToken(token)
 		Expect(err).To(HaveOccurred())
 	})
 
@@ -59,9 +80,9 @@ var _ = Describe("Cookie Generator", func() {
 		t, err := asn1.Marshal(token{Data: []byte("foobar")})
 		Expect(err).ToNot(HaveOccurred())
 		t = append(t, []byte("rest")...)
-		enc, err := cookieGen.cookieProtector.NewToken(t)
+		enc, err := tokenGen.cookieProtector.NewToken(t)
 		Expect(err).ToNot(HaveOccurred())
-		_, err = cookieGen.DecodeToken(enc)
+		_, err = tokenGen.DecodeToken(enc)
 		Expect(err).To(MatchError("rest when unpacking token: 4"))
 	})
 
@@ -69,9 +90,9 @@ var _ = Describe("Cookie Generator", func() {
 	It("doesn't panic if a tokens has no data", func() {
 		t, err := asn1.Marshal(token{Data: []byte("")})
 		Expect(err).ToNot(HaveOccurred())
-		enc, err := cookieGen.cookieProtector.NewToken(t)
+		enc, err := tokenGen.cookieProtector.NewToken(t)
 		Expect(err).ToNot(HaveOccurred())
-		_, err = cookieGen.DecodeToken(enc)
+		_, err = tokenGen.DecodeToken(enc)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
@@ -86,26 +107,26 @@ var _ = Describe("Cookie Generator", func() {
 			ip := net.ParseIP(addr)
 			Expect(ip).ToNot(BeNil())
 			raddr := &net.UDPAddr{IP: ip, Port: 1337}
-			token, err := cookieGen.NewToken(raddr)
+			token, err := tokenGen.NewToken(raddr)
 			Expect(err).ToNot(HaveOccurred())
-			cookie, err := cookieGen.DecodeToken(token)
+			cookie, err := tokenGen.DecodeToken(token)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(cookie.RemoteAddr).To(Equal(ip.String()))
-			// the time resolution of the Cookie is just 1 second
-			// if Cookie generation and this check happen in "different seconds", the difference will be between 1 and 2 seconds
+			// the time resolution of the Token is just 1 second
+			// if Token generation and this check happen in "different seconds", the difference will be between 1 and 2 seconds
 			Expect(cookie.SentTime).To(BeTemporally("~", time.Now(), 2*time.Second))
 		}
 	})
 
 	It("uses the string representation an address that is not a UDP address", func() {
 		raddr := &net.TCPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
-		token, err := cookieGen.NewToken(raddr)
+		token, err := tokenGen.NewToken(raddr)
 		Expect(err).ToNot(HaveOccurred())
-		cookie, err := cookieGen.DecodeToken(token)
+		cookie, err := tokenGen.DecodeToken(token)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(cookie.RemoteAddr).To(Equal("192.168.13.37:1337"))
-		// the time resolution of the Cookie is just 1 second
-		// if Cookie generation and this check happen in "different seconds", the difference will be between 1 and 2 seconds
+		// the time resolution of the Token is just 1 second
+		// if Token generation and this check happen in "different seconds", the difference will be between 1 and 2 seconds
 		Expect(cookie.SentTime).To(BeTemporally("~", time.Now(), 2*time.Second))
 	})
 })
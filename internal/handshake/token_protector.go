@@ -0,0 +1,95 @@
+package handshake
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"sync"
+
+	"github.com/bifurcation/mint"
+)
+
+// TokenProtectorKeyLen is the length of the keys used by a TokenProtector
+const TokenProtectorKeyLen = 32
+
+// A TokenProtector encrypts and authenticates tokens, using a list of keys that can be rotated.
+// New tokens are encrypted with the first key. Tokens encrypted with any of the keys are accepted,
+// such that tokens issued before a key rotation stay valid as long as the old key is kept.
+// The AEAD keys are derived from the keys and a label,
+// so the same keys can be used for different kinds of tokens.
+// It is safe for concurrent use.
+type TokenProtector struct {
+	label []byte
+
+	mutex sync.RWMutex
+	aeads []cipher.AEAD
+}
+
+var _ mint.CookieProtector = &TokenProtector{}
+
+// NewTokenProtector creates a new TokenProtector.
+func NewTokenProtector(label string, keys [][TokenProtectorKeyLen]byte) (*TokenProtector, error) {
+	p := &TokenProtector{label: []byte(label)}
+	if err := p.SetKeys(keys); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetKeys replaces the keys.
+func (p *TokenProtector) SetKeys(keys [][TokenProtectorKeyLen]byte) error {
+	if len(keys) == 0 {
+		return errors.New("no token keys")
+	}
+	aeads := make([]cipher.AEAD, len(keys))
+	for i, key := range keys {
+		h := hmac.New(sha256.New, key[:])
+		h.Write(p.label)
+		c, err := aes.NewCipher(h.Sum(nil))
+		if err != nil {
+			return err
+		}
+		aeads[i], err = cipher.NewGCM(c)
+		if err != nil {
+			return err
+		}
+	}
+	p.mutex.Lock()
+	p.aeads = aeads
+	p.mutex.Unlock()
+	return nil
+}
+
+// NewToken encrypts the data using the first key.
+func (p *TokenProtector) NewToken(data []byte) ([]byte, error) {
+	p.mutex.RLock()
+	aead := p.aeads[0]
+	p.mutex.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// DecodeToken decrypts a token encrypted with any of the keys.
+func (p *TokenProtector) DecodeToken(token []byte) ([]byte, error) {
+	p.mutex.RLock()
+	aeads := p.aeads
+	p.mutex.RUnlock()
+
+	for _, aead := range aeads {
+		if len(token) < aead.NonceSize() {
+			return nil, errors.New("token too short")
+		}
+		nonce := token[:aead.NonceSize()]
+		if data, err := aead.Open(nil, nonce, token[aead.NonceSize():], nil); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("token was not encrypted with any of the keys")
+}
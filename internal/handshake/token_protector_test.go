@@ -0,0 +1,92 @@
+package handshake
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token Protector", func() {
+	var key1, key2 [TokenProtectorKeyLen]byte
+
+	BeforeEach(func() {
+		copy(key1[:], "foobar")
+		copy(key2[:], "raboof")
+	})
+
+	It("encrypts and decrypts tokens", func() {
+		p, err := NewTokenProtector("label", [][TokenProtectorKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		token, err := p.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).ToNot(ContainSubstring("foobar"))
+		data, err := p.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("rejects tokens that were modified", func() {
+		p, err := NewTokenProtector("label", [][TokenProtectorKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		token, err := p.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		token[len(token)-1]++
+		_, err = p.DecodeToken(token)
+		Expect(err).To(MatchError("token was not encrypted with any of the keys"))
+		_, err = p.DecodeToken([]byte("foo"))
+		Expect(err).To(MatchError("token too short"))
+	})
+
+	It("decodes tokens of other TokenProtectors using the same key and label", func() {
+		p1, err := NewTokenProtector("label", [][TokenProtectorKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		p2, err := NewTokenProtector("label", [][TokenProtectorKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		token, err := p1.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		data, err := p2.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("uses different keys for different labels", func() {
+		p1, err := NewTokenProtector("foo", [][TokenProtectorKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		p2, err := NewTokenProtector("bar", [][TokenProtectorKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		token, err := p1.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = p2.DecodeToken(token)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rotates keys", func() {
+		p, err := NewTokenProtector("label", [][TokenProtectorKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		oldToken, err := p.NewToken([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.SetKeys([][TokenProtectorKeyLen]byte{key2, key1})).To(Succeed())
+		newToken, err := p.NewToken([]byte("bar"))
+		Expect(err).ToNot(HaveOccurred())
+		data, err := p.DecodeToken(oldToken)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foo")))
+		// the new token is encrypted with the new key
+		p2, err := NewTokenProtector("label", [][TokenProtectorKeyLen]byte{key2})
+		Expect(err).ToNot(HaveOccurred())
+		data, err = p2.DecodeToken(newToken)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("bar")))
+		// the old key is removed
+		Expect(p.SetKeys([][TokenProtectorKeyLen]byte{key2})).To(Succeed())
+		_, err = p.DecodeToken(oldToken)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("requires at least one key", func() {
+		_, err := NewTokenProtector("label", nil)
+		Expect(err).To(MatchError("no token keys"))
+		p, err := NewTokenProtector("label", [][TokenProtectorKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.SetKeys(nil)).To(MatchError("no token keys"))
+	})
+})
@@ -117,8 +117,10 @@ var _ = Describe("Transport Parameters", func() {
 				MaxBidiStreams:              1337,
 				MaxUniStreams:               7331,
 				IdleTimeout:                 42 * time.Second,
+				MaxDatagramFrameSize:        1200,
+				MaxAckDelay:                 30 * time.Millisecond,
 			}
-			Expect(p.String()).To(Equal("&handshake.TransportParameters{StreamFlowControlWindow: 0x1234, ConnectionFlowControlWindow: 0x4321, MaxBidiStreams: 1337, MaxUniStreams: 7331, IdleTimeout: 42s}"))
+			Expect(p.String()).To(Equal("&handshake.TransportParameters{StreamFlowControlWindow: 0x1234, ConnectionFlowControlWindow: 0x4321, MaxBidiStreams: 1337, MaxUniStreams: 7331, IdleTimeout: 42s, MaxDatagramFrameSize: 1200, MaxAckDelay: 30ms}"))
 		})
 
 		Context("parsing", func() {
@@ -144,6 +146,48 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(params.IdleTimeout).To(Equal(0x1337 * time.Second))
 				Expect(params.OmitConnectionID).To(BeFalse())
 				Expect(params.MaxPacketSize).To(Equal(protocol.ByteCount(0x7331)))
+				Expect(params.MaxDatagramFrameSize).To(BeZero())
+				Expect(params.DisableMigration).To(BeFalse())
+				Expect(params.MaxAckDelay).To(Equal(protocol.DefaultMaxAckDelay))
+			})
+
+			It("reads the max_ack_delay", func() {
+				parameters[maxAckDelayParameterID] = []byte{42}
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.MaxAckDelay).To(Equal(42 * time.Millisecond))
+			})
+
+			It("rejects the parameters if max_ack_delay has the wrong length", func() {
+				parameters[maxAckDelayParameterID] = []byte{0, 42} // should be 1 byte
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for max_ack_delay: 2 (expected 1)"))
+			})
+
+			It("reads the max_datagram_frame_size", func() {
+				parameters[maxDatagramFrameSizeParameterID] = []byte{0x4, 0xb0} // 1200
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.MaxDatagramFrameSize).To(Equal(protocol.ByteCount(1200)))
+			})
+
+			It("rejects the parameters if max_datagram_frame_size has the wrong length", func() {
+				parameters[maxDatagramFrameSizeParameterID] = []byte{0x11} // should be 2 bytes
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for max_datagram_frame_size: 1 (expected 2)"))
+			})
+
+			It("reads the disable_migration parameter", func() {
+				parameters[disableMigrationParameterID] = []byte{}
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.DisableMigration).To(BeTrue())
+			})
+
+			It("rejects the parameters if disable_migration has a value", func() {
+				parameters[disableMigrationParameterID] = []byte{0x1}
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for disable_migration: 1 (expected empty)"))
 			})
 
 			It("rejects the parameters if the initial_max_stream_data is missing", func() {
@@ -253,6 +297,65 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(values).To(HaveKeyWithValue(idleTimeoutParameterID, []byte{0xca, 0xfe}))
 				Expect(values).To(HaveKeyWithValue(maxPacketSizeParameterID, []byte{0x5, 0xac})) // 1452 = 0x5ac
 			})
+
+			It("sends the max_datagram_frame_size, if DATAGRAM frames are supported", func() {
+				params.MaxDatagramFrameSize = 1200
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveLen(7))
+				Expect(values).To(HaveKeyWithValue(maxDatagramFrameSizeParameterID, []byte{0x4, 0xb0})) // 1200 = 0x4b0
+			})
+
+			It("sends the disable_migration parameter", func() {
+				params.DisableMigration = true
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveLen(7))
+				Expect(values).To(HaveKeyWithValue(disableMigrationParameterID, []byte{}))
+			})
+
+			It("sends the max_ack_delay", func() {
+				params.MaxAckDelay = 42 * time.Millisecond
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveLen(7))
+				Expect(values).To(HaveKeyWithValue(maxAckDelayParameterID, []byte{42}))
+			})
+
+			It("limits the max_ack_delay to the maximum value that can be encoded", func() {
+				params.MaxAckDelay = time.Second
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveKeyWithValue(maxAckDelayParameterID, []byte{255}))
+			})
+		})
+	})
+
+	Context("exposing to the application", func() {
+		It("converts IETF QUIC transport parameters", func() {
+			params := &TransportParameters{
+				StreamFlowControlWindow:     0x1234,
+				ConnectionFlowControlWindow: 0x4321,
+				MaxPacketSize:               1337,
+				MaxBidiStreams:              12,
+				MaxUniStreams:               34,
+				IdleTimeout:                 42 * time.Second,
+				MaxDatagramFrameSize:        1200,
+				DisableMigration:            true,
+				MaxAckDelay:                 30 * time.Millisecond,
+			}
+			Expect(params.PeerTransportParameters()).To(Equal(&PeerTransportParameters{
+				IdleTimeout:          42 * time.Second,
+				InitialMaxData:       0x4321,
+				InitialMaxStreamData: 0x1234,
+				MaxBidiStreams:       12,
+				MaxUniStreams:        34,
+				MaxPacketSize:        1337,
+				MaxDatagramFrameSize: 1200,
+				DisableMigration:     true,
+				MaxAckDelay:          30 * time.Millisecond,
+			}))
+		})
+
+		It("uses the maximum number of streams for gQUIC", func() {
+			params := &TransportParameters{MaxStreams: 100}
+			Expect(params.PeerTransportParameters().MaxBidiStreams).To(BeEquivalentTo(100))
 		})
 	})
 })
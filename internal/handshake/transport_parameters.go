@@ -28,6 +28,21 @@ type TransportParameters struct {
 
 	OmitConnectionID bool // only used for gQUIC
 	IdleTimeout      time.Duration
+
+	// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that is accepted.
+	// If 0, DATAGRAM frames are not supported.
+	MaxDatagramFrameSize protocol.ByteCount // only used for IETF QUIC
+
+	// DisableMigration says that the endpoint doesn't support connection migration.
+	DisableMigration bool // only used for IETF QUIC
+
+	// MaxAckDelay is the maximum time that the endpoint delays sending ACKs.
+	// When reading the transport parameters, it defaults to protocol.DefaultMaxAckDelay.
+	MaxAckDelay time.Duration // only used for IETF QUIC
+
+	// StatelessResetToken is the token used to detect stateless resets.
+	// It is only sent by the server, and only used for IETF QUIC.
+	StatelessResetToken *protocol.StatelessResetToken
 }
 
 // readHelloMap reads the transport parameters from the tags sent in a gQUIC handshake message
@@ -96,7 +111,7 @@ func (p *TransportParameters) getHelloMap() map[Tag][]byte {
 
 // readTransportParameters reads the transport parameters sent in the QUIC TLS extension
 func readTransportParameters(paramsList []transportParameter) (*TransportParameters, error) {
-	params := &TransportParameters{}
+	params := &TransportParameters{MaxAckDelay: protocol.DefaultMaxAckDelay}
 
 	var foundInitialMaxStreamData bool
 	var foundInitialMaxData bool
@@ -141,6 +156,21 @@ func readTransportParameters(paramsList []transportParameter) (*TransportParamet
 				return nil, fmt.Errorf("invalid value for max_packet_size: %d (minimum 1200)", maxPacketSize)
 			}
 			params.MaxPacketSize = maxPacketSize
+		case maxDatagramFrameSizeParameterID:
+			if len(p.Value) != 2 {
+				return nil, fmt.Errorf("wrong length for max_datagram_frame_size: %d (expected 2)", len(p.Value))
+			}
+			params.MaxDatagramFrameSize = protocol.ByteCount(binary.BigEndian.Uint16(p.Value))
+		case disableMigrationParameterID:
+			if len(p.Value) != 0 {
+				return nil, fmt.Errorf("wrong length for disable_migration: %d (expected empty)", len(p.Value))
+			}
+			params.DisableMigration = true
+		case maxAckDelayParameterID:
+			if len(p.Value) != 1 {
+				return nil, fmt.Errorf("wrong length for max_ack_delay: %d (expected 1)", len(p.Value))
+			}
+			params.MaxAckDelay = time.Duration(p.Value[0]) * time.Millisecond
 		}
 	}
 
@@ -173,11 +203,42 @@ func (p *TransportParameters) getTransportParameters() []transportParameter {
 		{idleTimeoutParameterID, idleTimeout},
 		{maxPacketSizeParameterID, maxPacketSize},
 	}
+	if p.MaxDatagramFrameSize > 0 {
+		maxDatagramFrameSize := make([]byte, 2)
+		binary.BigEndian.PutUint16(maxDatagramFrameSize, uint16(p.MaxDatagramFrameSize))
+		params = append(params, transportParameter{maxDatagramFrameSizeParameterID, maxDatagramFrameSize})
+	}
+	if p.DisableMigration {
+		params = append(params, transportParameter{disableMigrationParameterID, []byte{}})
+	}
+	if p.MaxAckDelay > 0 {
+		maxAckDelay := utils.MinDuration(p.MaxAckDelay, protocol.MaxMaxAckDelay)
+		params = append(params, transportParameter{maxAckDelayParameterID, []byte{uint8(maxAckDelay / time.Millisecond)}})
+	}
 	return params
 }
 
+// PeerTransportParameters returns the view of the transport parameters that is exposed to the application.
+func (p *TransportParameters) PeerTransportParameters() *PeerTransportParameters {
+	maxBidiStreams := uint64(p.MaxBidiStreams)
+	if p.MaxStreams > 0 { // gQUIC
+		maxBidiStreams = uint64(p.MaxStreams)
+	}
+	return &PeerTransportParameters{
+		IdleTimeout:          p.IdleTimeout,
+		InitialMaxData:       p.ConnectionFlowControlWindow,
+		InitialMaxStreamData: p.StreamFlowControlWindow,
+		MaxBidiStreams:       maxBidiStreams,
+		MaxUniStreams:        uint64(p.MaxUniStreams),
+		MaxPacketSize:        p.MaxPacketSize,
+		MaxDatagramFrameSize: p.MaxDatagramFrameSize,
+		DisableMigration:     p.DisableMigration,
+		MaxAckDelay:          p.MaxAckDelay,
+	}
+}
+
 // String returns a string representation, intended for logging.
 // It should only used for IETF QUIC.
 func (p *TransportParameters) String() string {
-	return fmt.Sprintf("&handshake.TransportParameters{StreamFlowControlWindow: %#x, ConnectionFlowControlWindow: %#x, MaxBidiStreams: %d, MaxUniStreams: %d, IdleTimeout: %s}", p.StreamFlowControlWindow, p.ConnectionFlowControlWindow, p.MaxBidiStreams, p.MaxUniStreams, p.IdleTimeout)
+	return fmt.Sprintf("&handshake.TransportParameters{StreamFlowControlWindow: %#x, ConnectionFlowControlWindow: %#x, MaxBidiStreams: %d, MaxUniStreams: %d, IdleTimeout: %s, MaxDatagramFrameSize: %d, MaxAckDelay: %s}", p.StreamFlowControlWindow, p.ConnectionFlowControlWindow, p.MaxBidiStreams, p.MaxUniStreams, p.IdleTimeout, p.MaxDatagramFrameSize, p.MaxAckDelay)
 }
@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	flowcontrol "github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	protocol "github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
@@ -54,6 +55,30 @@ func (mr *MockConnectionFlowControllerMockRecorder) AddBytesSent(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBytesSent", reflect.TypeOf((*MockConnectionFlowController)(nil).AddBytesSent), arg0)
 }
 
+// GetReceiveWindow mocks base method
+func (m *MockConnectionFlowController) GetReceiveWindow() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "GetReceiveWindow")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetReceiveWindow indicates an expected call of GetReceiveWindow
+func (mr *MockConnectionFlowControllerMockRecorder) GetReceiveWindow() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReceiveWindow", reflect.TypeOf((*MockConnectionFlowController)(nil).GetReceiveWindow))
+}
+
+// GetState mocks base method
+func (m *MockConnectionFlowController) GetState() flowcontrol.State {
+	ret := m.ctrl.Call(m, "GetState")
+	ret0, _ := ret[0].(flowcontrol.State)
+	return ret0
+}
+
+// GetState indicates an expected call of GetState
+func (mr *MockConnectionFlowControllerMockRecorder) GetState() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetState", reflect.TypeOf((*MockConnectionFlowController)(nil).GetState))
+}
+
 // GetWindowUpdate mocks base method
 func (m *MockConnectionFlowController) GetWindowUpdate() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "GetWindowUpdate")
@@ -91,6 +116,16 @@ func (mr *MockConnectionFlowControllerMockRecorder) SendWindowSize() *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendWindowSize", reflect.TypeOf((*MockConnectionFlowController)(nil).SendWindowSize))
 }
 
+// SetState mocks base method
+func (m *MockConnectionFlowController) SetState(arg0 flowcontrol.State) {
+	m.ctrl.Call(m, "SetState", arg0)
+}
+
+// SetState indicates an expected call of SetState
+func (mr *MockConnectionFlowControllerMockRecorder) SetState(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetState", reflect.TypeOf((*MockConnectionFlowController)(nil).SetState), arg0)
+}
+
 // UpdateSendWindow mocks base method
 func (m *MockConnectionFlowController) UpdateSendWindow(arg0 protocol.ByteCount) {
 	m.ctrl.Call(m, "UpdateSendWindow", arg0)
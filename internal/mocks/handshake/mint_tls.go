@@ -84,6 +84,18 @@ func (mr *MockMintTLSMockRecorder) Handshake() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Handshake", reflect.TypeOf((*MockMintTLS)(nil).Handshake))
 }
 
+// ServerName mocks base method
+func (m *MockMintTLS) ServerName() string {
+	ret := m.ctrl.Call(m, "ServerName")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// ServerName indicates an expected call of ServerName
+func (mr *MockMintTLSMockRecorder) ServerName() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ServerName", reflect.TypeOf((*MockMintTLS)(nil).ServerName))
+}
+
 // SetCryptoStream mocks base method
 func (m *MockMintTLS) SetCryptoStream(arg0 io.ReadWriter) {
 	m.ctrl.Call(m, "SetCryptoStream", arg0)
@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	flowcontrol "github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	protocol "github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
@@ -54,6 +55,30 @@ func (mr *MockStreamFlowControllerMockRecorder) AddBytesSent(arg0 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBytesSent", reflect.TypeOf((*MockStreamFlowController)(nil).AddBytesSent), arg0)
 }
 
+// GetReceiveWindow mocks base method
+func (m *MockStreamFlowController) GetReceiveWindow() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "GetReceiveWindow")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetReceiveWindow indicates an expected call of GetReceiveWindow
+func (mr *MockStreamFlowControllerMockRecorder) GetReceiveWindow() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReceiveWindow", reflect.TypeOf((*MockStreamFlowController)(nil).GetReceiveWindow))
+}
+
+// GetState mocks base method
+func (m *MockStreamFlowController) GetState() flowcontrol.State {
+	ret := m.ctrl.Call(m, "GetState")
+	ret0, _ := ret[0].(flowcontrol.State)
+	return ret0
+}
+
+// GetState indicates an expected call of GetState
+func (mr *MockStreamFlowControllerMockRecorder) GetState() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetState", reflect.TypeOf((*MockStreamFlowController)(nil).GetState))
+}
+
 // GetWindowUpdate mocks base method
 func (m *MockStreamFlowController) GetWindowUpdate() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "GetWindowUpdate")
@@ -91,6 +116,16 @@ func (mr *MockStreamFlowControllerMockRecorder) IsBlocked() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsBlocked", reflect.TypeOf((*MockStreamFlowController)(nil).IsBlocked))
 }
 
+// ReleaseCredit mocks base method
+func (m *MockStreamFlowController) ReleaseCredit(arg0 protocol.ByteCount) {
+	m.ctrl.Call(m, "ReleaseCredit", arg0)
+}
+
+// ReleaseCredit indicates an expected call of ReleaseCredit
+func (mr *MockStreamFlowControllerMockRecorder) ReleaseCredit(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseCredit", reflect.TypeOf((*MockStreamFlowController)(nil).ReleaseCredit), arg0)
+}
+
 // SendWindowSize mocks base method
 func (m *MockStreamFlowController) SendWindowSize() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "SendWindowSize")
@@ -103,6 +138,16 @@ func (mr *MockStreamFlowControllerMockRecorder) SendWindowSize() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendWindowSize", reflect.TypeOf((*MockStreamFlowController)(nil).SendWindowSize))
 }
 
+// SetState mocks base method
+func (m *MockStreamFlowController) SetState(arg0 flowcontrol.State) {
+	m.ctrl.Call(m, "SetState", arg0)
+}
+
+// SetState indicates an expected call of SetState
+func (mr *MockStreamFlowControllerMockRecorder) SetState(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetState", reflect.TypeOf((*MockStreamFlowController)(nil).SetState), arg0)
+}
+
 // UpdateHighestReceived mocks base method
 func (m *MockStreamFlowController) UpdateHighestReceived(arg0 protocol.ByteCount, arg1 bool) error {
 	ret := m.ctrl.Call(m, "UpdateHighestReceived", arg0, arg1)
@@ -10,9 +10,9 @@ import (
 // A ConnectionID in QUIC
 type ConnectionID []byte
 
-// GenerateConnectionID generates a connection ID using cryptographic random
-func GenerateConnectionID() (ConnectionID, error) {
-	b := make([]byte, ConnectionIDLen)
+// GenerateConnectionID generates a connection ID of length l using cryptographic random
+func GenerateConnectionID(l int) (ConnectionID, error) {
+	b := make([]byte, l)
 	if _, err := rand.Read(b); err != nil {
 		return nil, err
 	}
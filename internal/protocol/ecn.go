@@ -0,0 +1,27 @@
+package protocol
+
+// ECN is the ECN codepoint of an IP packet, i.e. the two least significant bits of the TOS / Traffic Class field
+type ECN uint8
+
+// the ECN codepoints
+const (
+	ECNNon ECN = 0 // Not-ECT
+	ECT1   ECN = 1 // ECN Capable Transport, ECT(1)
+	ECT0   ECN = 2 // ECN Capable Transport, ECT(0)
+	ECNCE  ECN = 3 // Congestion Experienced
+)
+
+func (e ECN) String() string {
+	switch e {
+	case ECNNon:
+		return "Not-ECT"
+	case ECT1:
+		return "ECT(1)"
+	case ECT0:
+		return "ECT(0)"
+	case ECNCE:
+		return "CE"
+	default:
+		return "invalid ECN value"
+	}
+}
@@ -61,12 +61,27 @@ const MaxByteCount = ByteCount(1<<62 - 1)
 // An ApplicationErrorCode is an application-defined error code.
 type ApplicationErrorCode uint16
 
+// A StatelessResetToken is the token used for IETF QUIC stateless resets.
+type StatelessResetToken [16]byte
+
+// MinStatelessResetSize is the size of the stateless resets we send.
+// Stateless resets are only sent in response to packets that are larger than that.
+const MinStatelessResetSize = 1 /* type byte */ + 20 /* random bytes */ + 16 /* token */
+
 // MaxReceivePacketSize maximum packet size of any QUIC packet, based on
 // ethernet's max size, minus the IP and UDP headers. IPv6 has a 40 byte header,
 // UDP adds an additional 8 bytes.  This is a total overhead of 48 bytes.
 // Ethernet's max packet size is 1500 bytes,  1500 - 48 = 1452.
 const MaxReceivePacketSize ByteCount = 1452
 
+// MaxReceiveBufferSize is the size of the buffers used for reading packets from the network.
+// It is one byte larger than MaxReceivePacketSize, such that packets exceeding MaxReceivePacketSize can be detected.
+const MaxReceiveBufferSize = MaxReceivePacketSize + 1
+
+// PacketBatchSize is the maximum number of packets read or written using a single syscall.
+// It is only used on Linux, where packets are read using recvmmsg and written using sendmmsg.
+const PacketBatchSize = 8
+
 // DefaultTCPMSS is the default maximum packet size used in the Linux TCP implementation.
 // Used in QUIC for congestion window computations in bytes.
 const DefaultTCPMSS ByteCount = 1460
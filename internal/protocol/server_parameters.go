@@ -18,10 +18,13 @@ const DefaultMaxCongestionWindow = 1000
 // InitialCongestionWindow is the initial congestion window in QUIC packets
 const InitialCongestionWindow = 32
 
-// MaxUndecryptablePackets limits the number of undecryptable packets that a
+// MaxUndecryptablePackets is the default value for the number of undecryptable packets that a
 // session queues for later until it sends a public reset.
 const MaxUndecryptablePackets = 10
 
+// DefaultUndecryptablePacketTimeout is the default time after which a queued undecryptable packet is dropped
+const DefaultUndecryptablePacketTimeout = time.Second
+
 // PublicResetTimeout is the time to wait before sending a Public Reset when receiving too many undecryptable packets during the handshake
 // This timeout allows the Go scheduler to switch to the Go rountine that reads the crypto stream and to escalate the crypto
 const PublicResetTimeout = 500 * time.Millisecond
@@ -78,8 +81,37 @@ const SkipPacketAveragePeriodLength PacketNumber = 500
 // MaxTrackedSkippedPackets is the maximum number of skipped packet numbers the SentPacketHandler keep track of for Optimistic ACK attack mitigation
 const MaxTrackedSkippedPackets = 10
 
-// CookieExpiryTime is the valid time of a cookie
-const CookieExpiryTime = 24 * time.Hour
+// TokenValidity is the duration that a token sent in a NEW_TOKEN frame (or an STK in gQUIC) is valid
+const TokenValidity = 24 * time.Hour
+
+// RetryTokenValidity is the duration that a token sent in a Retry is valid
+const RetryTokenValidity = 10 * time.Second
+
+// StrikeRegisterWindow is the maximum difference between the timestamp of the client nonce of a 0-RTT ClientHello and the server's clock.
+// ClientHellos with a nonce outside of this window are rejected for 0-RTT, so the nonces only need to be remembered for a short time.
+const StrikeRegisterWindow = 10 * time.Minute
+
+// MaxRemembered0RTTClientHellos is the maximum number of ClientHellos remembered to detect replayed 0-RTT handshakes.
+// When reached, 0-RTT is rejected until old entries expire.
+const MaxRemembered0RTTClientHellos = 1 << 16
+
+// PacketHandlerMapShards is the number of shards of the map that the server uses to route packets to its sessions.
+const PacketHandlerMapShards = 64
+
+// TimerWheelGranularity is the duration of one tick of the timer wheel used by the shared event loops.
+// Timers fire up to one tick late.
+const TimerWheelGranularity = time.Millisecond
+
+// TimerWheelSlots is the number of slots of the timer wheel used by the shared event loops.
+// Timers further in the future than TimerWheelSlots ticks are checked every time the wheel wraps around.
+const TimerWheelSlots = 1 << 16
+
+// MaxEventLoopIterations is the number of times a shared event loop runs a session's run loop in a row.
+// After that, the session is scheduled again behind the other sessions with pending events.
+const MaxEventLoopIterations = 16
+
+// MaxTokenLen is the maximum length of a token that we accept in an Initial packet
+const MaxTokenLen = 256
 
 // MaxOutstandingSentPackets is maximum number of packets saved for retransmission.
 // When reached, it imposes a soft limit on sending new packets:
@@ -120,6 +152,38 @@ const DefaultIdleTimeout = 30 * time.Second
 // DefaultHandshakeTimeout is the default timeout for a connection until the crypto handshake succeeds.
 const DefaultHandshakeTimeout = 10 * time.Second
 
+// HappyEyeballsDelay is the default time the IPv6 connection attempt is given to complete the handshake,
+// before a parallel connection attempt to the IPv4 address is started (see Config.PreferIPv6Delay).
+// This is the Connection Attempt Delay recommended by RFC 8305.
+const HappyEyeballsDelay = 250 * time.Millisecond
+
+// AmplificationFactor is the factor by which a server may send more data than it received from a client, before the client's address is validated.
+const AmplificationFactor = 3
+
+// DefaultMaxHandshakePackets is the default number of packets a session processes before the crypto handshake has to be completed.
+// This limits the amount of (trial) decryptions an attacker can cause by sending packets for a connection that never completes the handshake.
+const DefaultMaxHandshakePackets = 200
+
+// MaxHalfOpenHandshakes is the number of handshakes in progress, at which the server starts performing a Stateless Retry for all new connections.
+// This bounds the state kept for clients whose address was not validated.
+const MaxHalfOpenHandshakes = 16
+
+// StatelessResetInterval is the interval at which the server regains the budget to send one stateless reset (or Public Reset, for gQUIC).
+// Together with MaxStatelessResetBurst, this limits the traffic that an attacker can make the server send to a spoofed address.
+const StatelessResetInterval = 10 * time.Millisecond
+
+// MaxStatelessResetBurst is the maximum number of stateless resets (or Public Resets, for gQUIC) that the server sends in a burst.
+const MaxStatelessResetBurst = 20
+
+// MaxPendingPacketQueues is the maximum number of connections for which the server queues packets that arrive before the session is created.
+// Packets for other connections are dropped until the sessions for the queued connections are created.
+const MaxPendingPacketQueues = 128
+
+// MaxAcceptQueueSize is the maximum number of sessions that the server keeps, before they are accepted by the application.
+// This includes the sessions that are still performing the handshake.
+// New connections are refused when this limit is reached.
+const MaxAcceptQueueSize = 32
+
 // ClosedSessionDeleteTimeout the server ignores packets arriving on a connection that is already closed
 // after this time all information about the old connection will be deleted
 const ClosedSessionDeleteTimeout = time.Minute
@@ -144,8 +208,62 @@ const MaxAckFrameSize ByteCount = 1000
 // Example: For a packet pacing delay of 20 microseconds, we would send 5 packets at once, wait for 100 microseconds, and so forth.
 const MinPacingDelay time.Duration = 100 * time.Microsecond
 
-// ConnectionIDLen is the length of the source Connection ID used on IETF QUIC packets.
+// DefaultMaxPacingBurst is the default number of full-sized packets that the pacer allows to be sent back-to-back.
+const DefaultMaxPacingBurst = 10
+
+// DefaultMaxAckDelay is the maximum time by which we delay sending ACKs, if not configured otherwise.
+// For IETF QUIC, it is also the value assumed for the peer, if it didn't send the max_ack_delay transport parameter.
+const DefaultMaxAckDelay = 25 * time.Millisecond
+
+// MaxMaxAckDelay is the largest max_ack_delay that can be sent in the transport parameters.
+const MaxMaxAckDelay = 255 * time.Millisecond
+
+// DefaultConnectionIDLength is the default length of the connection IDs used on IETF QUIC packets.
 // The Short Header contains the connection ID, but not the length,
 // so we need to know this value in advance (or encode it into the connection ID).
-// TODO: make this configurable
-const ConnectionIDLen = 8
+const DefaultConnectionIDLength = 8
+
+// MinConnectionIDLen is the minimum length of a connection ID used on IETF QUIC packets.
+const MinConnectionIDLen = 4
+
+// MaxConnectionIDLen is the maximum length of a connection ID used on IETF QUIC packets.
+const MaxConnectionIDLen = 18
+
+// ConnectionIDLenGQUIC is the length of the connection ID used by gQUIC.
+const ConnectionIDLenGQUIC = 8
+
+// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that we send and accept.
+// It is chosen such that a DATAGRAM frame fits into every packet, even if the packet has the largest possible header.
+const MaxDatagramFrameSize ByteCount = 1150
+
+// DatagramSendQueueLen is the number of DATAGRAM frames that are queued for sending
+const DatagramSendQueueLen = 32
+
+// DatagramRcvQueueLen is the number of received DATAGRAM frames that are queued until the application reads them.
+// If the queue is full, new DATAGRAM frames are dropped.
+const DatagramRcvQueueLen = 128
+
+// MaxPathChallenges is the maximum number of PATH_CHALLENGE frames sent when validating a new path.
+// If none of them is answered, the path validation fails.
+const MaxPathChallenges = 3
+
+// MinPathChallengeInterval is the minimum time to wait for a PATH_RESPONSE before sending a new PATH_CHALLENGE
+const MinPathChallengeInterval = 200 * time.Millisecond
+
+// MinPathValidationInterval is the minimum time between two validations of a new address of the client.
+// It limits the number of path validations that an attacker can trigger by spoofing the client's address.
+const MinPathValidationInterval = time.Second
+
+// DefaultKeyUpdateInterval is the number of packets sent with the same 1-RTT keys, before the keys are updated
+const DefaultKeyUpdateInterval = 100 * 1000
+
+// KeyUpdateOldKeysRetention is the time that the 1-RTT keys of the previous key phase are kept after a key update.
+// It allows decrypting reordered packets that were sent before the key update.
+const KeyUpdateOldKeysRetention = 3 * time.Second
+
+// NumIssuedConnectionIDs is the number of connection IDs that an endpoint provides to its peer after the handshake completes.
+// This doesn't include the connection ID used during the handshake.
+const NumIssuedConnectionIDs = 3
+
+// MaxActiveConnectionIDs is the maximum number of unused connection IDs issued by the peer that we store
+const MaxActiveConnectionIDs = 8
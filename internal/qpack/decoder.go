@@ -0,0 +1,123 @@
+package qpack
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+var (
+	errUnexpectedEnd           = errors.New("qpack: unexpected end of header block")
+	errDynamicTableNotAllowed  = errors.New("qpack: header block references the dynamic table")
+	errInvalidStaticTableIndex = errors.New("qpack: invalid static table index")
+)
+
+// A Decoder decodes QPACK header blocks.
+// It doesn't support the dynamic table, so the peer must not insert any entries into it.
+// This is the case as long as the SETTINGS_QPACK_MAX_TABLE_CAPACITY setting is not sent.
+type Decoder struct{}
+
+// NewDecoder returns a new Decoder.
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// DecodeFull decodes an entire header block.
+func (d *Decoder) DecodeFull(p []byte) ([]HeaderField, error) {
+	requiredInsertCount, p, err := readVarInt(8, p)
+	if err != nil {
+		return nil, err
+	}
+	if requiredInsertCount != 0 {
+		return nil, errDynamicTableNotAllowed
+	}
+	// the Delta Base is meaningless if the dynamic table is not used
+	if _, p, err = readVarInt(7, p); err != nil {
+		return nil, err
+	}
+	var fields []HeaderField
+	for len(p) > 0 {
+		var hf HeaderField
+		hf, p, err = d.parseFieldLine(p)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, hf)
+	}
+	return fields, nil
+}
+
+func (d *Decoder) parseFieldLine(p []byte) (HeaderField, []byte, error) {
+	switch {
+	case p[0]&0x80 > 0: // Indexed Field Line
+		if p[0]&0x40 == 0 {
+			return HeaderField{}, nil, errDynamicTableNotAllowed
+		}
+		idx, p, err := readVarInt(6, p)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf, err := staticTableEntry(idx)
+		return hf, p, err
+	case p[0]&0x40 > 0: // Literal Field Line With Name Reference
+		if p[0]&0x10 == 0 {
+			return HeaderField{}, nil, errDynamicTableNotAllowed
+		}
+		idx, p, err := readVarInt(4, p)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf, err := staticTableEntry(idx)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf.Value, p, err = readString(7, 0x80, p)
+		return hf, p, err
+	case p[0]&0x20 > 0: // Literal Field Line With Literal Name
+		var hf HeaderField
+		var err error
+		hf.Name, p, err = readString(3, 0x08, p)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf.Value, p, err = readString(7, 0x80, p)
+		return hf, p, err
+	default: // field lines with Post-Base Indices reference the dynamic table
+		return HeaderField{}, nil, errDynamicTableNotAllowed
+	}
+}
+
+func staticTableEntry(idx uint64) (HeaderField, error) {
+	if idx >= uint64(len(staticTable)) {
+		return HeaderField{}, errInvalidStaticTableIndex
+	}
+	return staticTable[idx], nil
+}
+
+// readString reads a string literal, which might be Huffman encoded.
+// huffmanFlag is the bit in the first byte that is set if the string is Huffman encoded,
+// and n is the length of the prefix used to encode the string length.
+func readString(n byte, huffmanFlag byte, p []byte) (string, []byte, error) {
+	if len(p) == 0 {
+		return "", nil, errUnexpectedEnd
+	}
+	isHuffman := p[0]&huffmanFlag > 0
+	l, p, err := readVarInt(n, p)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(p)) < l {
+		return "", nil, errUnexpectedEnd
+	}
+	data := p[:l]
+	p = p[l:]
+	if !isHuffman {
+		return string(data), p, nil
+	}
+	s, err := hpack.HuffmanDecodeToString(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("qpack: invalid Huffman-encoded string: %s", err)
+	}
+	return s, p, nil
+}
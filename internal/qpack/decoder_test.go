@@ -0,0 +1,70 @@
+package qpack
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Decoder", func() {
+	var dec *Decoder
+
+	BeforeEach(func() {
+		dec = NewDecoder()
+	})
+
+	It("decodes indexed field lines", func() {
+		fields, err := dec.DecodeFull([]byte{0, 0, 0xc0 | 25, 0xc0 | 0x3f, 98 - 0x3f})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: "x-frame-options", Value: "sameorigin"},
+		}))
+	})
+
+	It("decodes literal field lines with a name reference", func() {
+		fields, err := dec.DecodeFull([]byte{0, 0, 0x50 | 1, 4, '/', 'f', 'o', 'o'})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: ":path", Value: "/foo"}}))
+	})
+
+	It("decodes literal field lines with a literal name", func() {
+		fields, err := dec.DecodeFull([]byte{0, 0, 0x20 | 3, 'f', 'o', 'o', 3, 'b', 'a', 'r'})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: "foo", Value: "bar"}}))
+	})
+
+	It("decodes an empty header block", func() {
+		fields, err := dec.DecodeFull([]byte{0, 0})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(BeEmpty())
+	})
+
+	It("rejects header blocks that reference the dynamic table", func() {
+		// non-zero Required Insert Count
+		_, err := dec.DecodeFull([]byte{1, 0})
+		Expect(err).To(MatchError(errDynamicTableNotAllowed))
+		// Indexed Field Line referencing the dynamic table
+		_, err = dec.DecodeFull([]byte{0, 0, 0x80})
+		Expect(err).To(MatchError(errDynamicTableNotAllowed))
+		// Literal Field Line With Name Reference referencing the dynamic table
+		_, err = dec.DecodeFull([]byte{0, 0, 0x40, 0})
+		Expect(err).To(MatchError(errDynamicTableNotAllowed))
+		// Indexed Field Line With Post-Base Index
+		_, err = dec.DecodeFull([]byte{0, 0, 0x10})
+		Expect(err).To(MatchError(errDynamicTableNotAllowed))
+	})
+
+	It("rejects invalid static table indices", func() {
+		_, err := dec.DecodeFull([]byte{0, 0, 0xc0 | 0x3f, 99 - 0x3f})
+		Expect(err).To(MatchError(errInvalidStaticTableIndex))
+	})
+
+	It("errors on truncated header blocks", func() {
+		_, err := dec.DecodeFull([]byte{0})
+		Expect(err).To(MatchError(errUnexpectedEnd))
+		_, err = dec.DecodeFull([]byte{0, 0, 0x20 | 3, 'f', 'o'})
+		Expect(err).To(MatchError(errUnexpectedEnd))
+		_, err = dec.DecodeFull([]byte{0, 0, 0x50 | 1})
+		Expect(err).To(MatchError(errUnexpectedEnd))
+	})
+})
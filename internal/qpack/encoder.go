@@ -0,0 +1,62 @@
+package qpack
+
+import (
+	"io"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// An Encoder encodes header fields into a QPACK header block.
+// It only uses the static table, so it never sends instructions on the encoder stream,
+// and the peer never has to block on the encoder stream when decoding a header block.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+
+	wrotePrefix bool
+}
+
+// NewEncoder returns a new Encoder which writes the header block to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// WriteField encodes f into a single Write to e's underlying Writer.
+// The first call also writes the header block prefix.
+func (e *Encoder) WriteField(f HeaderField) error {
+	e.buf = e.buf[:0]
+	if !e.wrotePrefix {
+		// Required Insert Count and Delta Base are 0, since the dynamic table is not used
+		e.buf = append(e.buf, 0, 0)
+		e.wrotePrefix = true
+	}
+
+	if idx, ok := staticTableEntries[f]; ok {
+		// Indexed Field Line, referencing the static table
+		e.buf = appendVarInt(e.buf, 6, 0xc0, uint64(idx))
+	} else if idx, ok := staticTableNames[f.Name]; ok {
+		// Literal Field Line With Name Reference, referencing the static table
+		e.buf = appendVarInt(e.buf, 4, 0x50, uint64(idx))
+		e.buf = appendString(e.buf, 7, 0x80, f.Value)
+	} else {
+		// Literal Field Line With Literal Name
+		start := len(e.buf)
+		e.buf = appendString(e.buf, 3, 0x08, f.Name)
+		e.buf[start] |= 0x20
+		e.buf = appendString(e.buf, 7, 0x80, f.Value)
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// appendString appends a string literal, using Huffman encoding if that's shorter.
+// huffmanFlag is the bit that is set in the first byte if the string is Huffman encoded,
+// and n is the length of the prefix used to encode the string length.
+func appendString(b []byte, n byte, huffmanFlag byte, s string) []byte {
+	if l := hpack.HuffmanEncodeLength(s); l < uint64(len(s)) {
+		b = appendVarInt(b, n, huffmanFlag, l)
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendVarInt(b, n, 0, uint64(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,62 @@
+package qpack
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encoder", func() {
+	var (
+		buf *bytes.Buffer
+		enc *Encoder
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		enc = NewEncoder(buf)
+	})
+
+	It("writes the header block prefix before the first field", func() {
+		Expect(enc.WriteField(HeaderField{Name: ":method", Value: "GET"})).To(Succeed())
+		Expect(enc.WriteField(HeaderField{Name: ":path", Value: "/"})).To(Succeed())
+		Expect(buf.Bytes()).To(Equal([]byte{0, 0, 0xc0 | 17, 0xc0 | 1}))
+	})
+
+	It("references names in the static table", func() {
+		Expect(enc.WriteField(HeaderField{Name: ":path", Value: "/foo"})).To(Succeed())
+		Expect(buf.Bytes()[:3]).To(Equal([]byte{0, 0, 0x50 | 1}))
+	})
+
+	It("writes literal names", func() {
+		Expect(enc.WriteField(HeaderField{Name: "x", Value: "y"})).To(Succeed())
+		Expect(buf.Bytes()).To(Equal([]byte{0, 0, 0x20 | 1, 'x', 1, 'y'}))
+	})
+
+	It("uses Huffman encoding if it's shorter", func() {
+		Expect(enc.WriteField(HeaderField{Name: "user-agent", Value: "quic-go HTTP/3 client"})).To(Succeed())
+		// user-agent is entry 95 of the static table, which doesn't fit into the 4 bit prefix
+		Expect(buf.Bytes()[:4]).To(Equal([]byte{0, 0, 0x5f, 95 - 0xf}))
+		Expect(buf.Bytes()[4] & 0x80).ToNot(BeZero())
+		Expect(buf.Len()).To(BeNumerically("<", 4+1+len("quic-go HTTP/3 client")))
+	})
+
+	It("encodes fields that can be decoded", func() {
+		fields := []HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: ":status", Value: "418"},
+			{Name: "content-type", Value: "text/plain"},
+			{Name: "content-length", Value: "1337"},
+			{Name: "x-custom-header", Value: "foobar"},
+			{Name: "x-empty"},
+			{Name: "a-very-long-header-name-that-does-not-fit-into-the-prefix", Value: string(bytes.Repeat([]byte{'a'}, 1000))},
+		}
+		for _, f := range fields {
+			Expect(enc.WriteField(f)).To(Succeed())
+		}
+		decoded, err := NewDecoder().DecodeFull(buf.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal(fields))
+	})
+})
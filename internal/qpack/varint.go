@@ -0,0 +1,53 @@
+package qpack
+
+import "errors"
+
+var errIntegerOverflow = errors.New("qpack: integer overflow")
+
+// appendVarInt appends i, as encoded in variable integer form using n bit prefix, to b.
+// The flags are set in the bits of the first byte that are not used by the prefix.
+// See Section 5.1 of RFC 7541.
+func appendVarInt(b []byte, n byte, flags byte, i uint64) []byte {
+	k := uint64((1 << n) - 1)
+	if i < k {
+		return append(b, flags|byte(i))
+	}
+	b = append(b, flags|byte(k))
+	i -= k
+	for ; i >= 128; i >>= 7 {
+		b = append(b, byte(0x80|(i&0x7f)))
+	}
+	return append(b, byte(i))
+}
+
+// readVarInt reads an unsigned variable length integer off the beginning of p.
+// n is the parameter as described in Section 5.1 of RFC 7541.
+// It returns errUnexpectedEnd if p doesn't contain the complete integer.
+func readVarInt(n byte, p []byte) (uint64, []byte, error) {
+	if len(p) == 0 {
+		return 0, nil, errUnexpectedEnd
+	}
+	i := uint64(p[0])
+	if n < 8 {
+		i &= (1 << uint64(n)) - 1
+	}
+	if i < (1<<uint64(n))-1 {
+		return i, p[1:], nil
+	}
+	origP := p
+	p = p[1:]
+	var m uint64
+	for len(p) > 0 {
+		b := p[0]
+		p = p[1:]
+		i += uint64(b&127) << m
+		if b&128 == 0 {
+			return i, p, nil
+		}
+		m += 7
+		if m >= 63 {
+			return 0, origP, errIntegerOverflow
+		}
+	}
+	return 0, origP, errUnexpectedEnd
+}
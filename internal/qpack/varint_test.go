@@ -0,0 +1,47 @@
+package qpack
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Varint encoding", func() {
+	It("encodes small values in the prefix", func() {
+		Expect(appendVarInt(nil, 5, 0xe0, 10)).To(Equal([]byte{0xea}))
+	})
+
+	// example from Section C.1.2 of RFC 7541
+	It("encodes values that don't fit into the prefix", func() {
+		Expect(appendVarInt(nil, 5, 0, 1337)).To(Equal([]byte{0x1f, 0x9a, 0x0a}))
+	})
+
+	It("decodes values", func() {
+		for _, n := range []byte{3, 4, 6, 7, 8} {
+			for _, i := range []uint64{0, 1, 6, 7, 8, 127, 128, 1337, 1 << 40} {
+				b := appendVarInt(nil, n, 0, i)
+				v, rest, err := readVarInt(n, append(b, 0x42))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(v).To(Equal(i))
+				Expect(rest).To(Equal([]byte{0x42}))
+			}
+		}
+	})
+
+	It("ignores the flags when decoding", func() {
+		v, _, err := readVarInt(5, []byte{0xea})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(BeEquivalentTo(10))
+	})
+
+	It("errors on incomplete values", func() {
+		_, _, err := readVarInt(5, []byte{0x1f, 0x9a})
+		Expect(err).To(MatchError(errUnexpectedEnd))
+		_, _, err = readVarInt(5, nil)
+		Expect(err).To(MatchError(errUnexpectedEnd))
+	})
+
+	It("errors on overflows", func() {
+		_, _, err := readVarInt(5, []byte{0x1f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+		Expect(err).To(MatchError(errIntegerOverflow))
+	})
+})
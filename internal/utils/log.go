@@ -33,6 +33,9 @@ type Logger interface {
 	Errorf(format string, args ...interface{})
 	Infof(format string, args ...interface{})
 	Debugf(format string, args ...interface{})
+
+	// WithFields returns a Logger that adds the fields to every message it logs.
+	WithFields(fields ...Field) Logger
 }
 
 // DefaultLogger is used by quic-go for logging.
@@ -91,6 +94,13 @@ func (l *defaultLogger) Debug() bool {
 	return l.logLevel == LogLevelDebug
 }
 
+// WithFields returns the defaultLogger itself.
+// The messages already contain all information needed, so the fields are not logged.
+// This also makes sure that changing the log level of the DefaultLogger applies to all loggers derived from it.
+func (l *defaultLogger) WithFields(...Field) Logger {
+	return l
+}
+
 func init() {
 	DefaultLogger = &defaultLogger{}
 	DefaultLogger.SetLogLevel(readLoggingEnv())
@@ -38,6 +38,17 @@ var _ = Describe("Log", func() {
 		Expect(b.Bytes()).To(Equal([]byte("")))
 	})
 
+	It("doesn't log fields", func() {
+		DefaultLogger.SetLogLevel(LogLevelDebug)
+		logger := DefaultLogger.WithFields(Field{Key: FieldConnectionID, Value: 42})
+		logger.Debugf("debug")
+		Expect(b.String()).To(HaveSuffix("debug\n"))
+		Expect(b.String()).ToNot(ContainSubstring("42"))
+		// the log level of the DefaultLogger applies
+		DefaultLogger.SetLogLevel(LogLevelNothing)
+		Expect(logger.Debug()).To(BeFalse())
+	})
+
 	It("log level err", func() {
 		DefaultLogger.SetLogLevel(LogLevelError)
 		DefaultLogger.Debugf("debug")
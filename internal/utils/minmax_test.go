@@ -45,6 +45,11 @@ var _ = Describe("Min / Max", func() {
 			Expect(MinDuration(time.Nanosecond, time.Microsecond)).To(Equal(time.Nanosecond))
 		})
 
+		It("returns the maximum ByteCount", func() {
+			Expect(MaxByteCount(7, 5)).To(Equal(protocol.ByteCount(7)))
+			Expect(MaxByteCount(5, 7)).To(Equal(protocol.ByteCount(7)))
+		})
+
 		It("returns packet number max", func() {
 			Expect(MaxPacketNumber(1, 2)).To(Equal(protocol.PacketNumber(2)))
 			Expect(MaxPacketNumber(2, 1)).To(Equal(protocol.PacketNumber(2)))
@@ -90,6 +95,16 @@ var _ = Describe("Min / Max", func() {
 			Expect(MinTime(a, b)).To(Equal(a))
 			Expect(MinTime(b, a)).To(Equal(a))
 		})
+
+		It("returns the minimum non-zero time", func() {
+			a := time.Time{}
+			b := time.Now()
+			Expect(MinNonZeroTime(time.Time{}, time.Time{})).To(Equal(time.Time{}))
+			Expect(MinNonZeroTime(a, b)).To(Equal(b))
+			Expect(MinNonZeroTime(b, a)).To(Equal(b))
+			Expect(MinNonZeroTime(b, b.Add(time.Second))).To(Equal(b))
+			Expect(MinNonZeroTime(b.Add(time.Second), b)).To(Equal(b))
+		})
 	})
 
 	It("returns the abs time", func() {
@@ -0,0 +1,84 @@
+package utils
+
+import "fmt"
+
+// The keys of the fields added to log messages.
+const (
+	// FieldConnectionID is the connection ID of the session that logged the message.
+	FieldConnectionID = "connection_id"
+	// FieldPerspective is the perspective of the endpoint that logged the message, "Client" or "Server".
+	FieldPerspective = "perspective"
+	// FieldPacketNumber is the packet number of the packet that is sent or received.
+	FieldPacketNumber = "packet_number"
+)
+
+// A Field is a key-value pair describing the context that a message was logged in.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// A StructuredLogger receives log messages, together with the fields attached to them.
+// In contrast to the Logger, it doesn't format the fields into the message,
+// which allows it to be backed by logging libraries that support structured logging.
+type StructuredLogger interface {
+	// Enabled says if messages of the log level are logged.
+	// Messages are only formatted if the log level is enabled.
+	Enabled(LogLevel) bool
+	// Log logs a message. The fields must not be modified.
+	Log(level LogLevel, msg string, fields []Field)
+}
+
+type structuredLogger struct {
+	logger StructuredLogger
+	fields []Field
+}
+
+var _ Logger = &structuredLogger{}
+
+// NewStructuredLogger creates a Logger that passes all messages to a StructuredLogger.
+func NewStructuredLogger(l StructuredLogger) Logger {
+	return &structuredLogger{logger: l}
+}
+
+// SetLogLevel does nothing, the log level is controlled by the StructuredLogger
+func (l *structuredLogger) SetLogLevel(LogLevel) {}
+
+// SetLogTimeFormat does nothing, timestamps are added by the StructuredLogger
+func (l *structuredLogger) SetLogTimeFormat(string) {}
+
+// Debug returns true if the StructuredLogger logs debug messages
+func (l *structuredLogger) Debug() bool {
+	return l.logger.Enabled(LogLevelDebug)
+}
+
+// Debugf logs something
+func (l *structuredLogger) Debugf(format string, args ...interface{}) {
+	l.log(LogLevelDebug, format, args...)
+}
+
+// Infof logs something
+func (l *structuredLogger) Infof(format string, args ...interface{}) {
+	l.log(LogLevelInfo, format, args...)
+}
+
+// Errorf logs something
+func (l *structuredLogger) Errorf(format string, args ...interface{}) {
+	l.log(LogLevelError, format, args...)
+}
+
+func (l *structuredLogger) log(level LogLevel, format string, args ...interface{}) {
+	if !l.logger.Enabled(level) {
+		return
+	}
+	l.logger.Log(level, fmt.Sprintf(format, args...), l.fields)
+}
+
+// WithFields returns a Logger that logs to the same StructuredLogger, and adds the fields to the fields of this Logger.
+func (l *structuredLogger) WithFields(fields ...Field) Logger {
+	// copy the fields, so that Loggers derived from the same Logger don't share the underlying array
+	newFields := make([]Field, 0, len(l.fields)+len(fields))
+	newFields = append(newFields, l.fields...)
+	newFields = append(newFields, fields...)
+	return &structuredLogger{logger: l.logger, fields: newFields}
+}
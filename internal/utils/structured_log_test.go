@@ -0,0 +1,83 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type loggedMessage struct {
+	level  LogLevel
+	msg    string
+	fields []Field
+}
+
+type recordingLogger struct {
+	level    LogLevel
+	messages []loggedMessage
+}
+
+var _ StructuredLogger = &recordingLogger{}
+
+func (l *recordingLogger) Enabled(level LogLevel) bool {
+	return level <= l.level
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string, fields []Field) {
+	l.messages = append(l.messages, loggedMessage{level: level, msg: msg, fields: fields})
+}
+
+var _ = Describe("Structured Logger", func() {
+	var (
+		rl     *recordingLogger
+		logger Logger
+	)
+
+	BeforeEach(func() {
+		rl = &recordingLogger{level: LogLevelDebug}
+		logger = NewStructuredLogger(rl)
+	})
+
+	It("passes formatted messages to the StructuredLogger", func() {
+		logger.Debugf("debug %d", 1)
+		logger.Infof("info %s", "foo")
+		logger.Errorf("error")
+		Expect(rl.messages).To(Equal([]loggedMessage{
+			{level: LogLevelDebug, msg: "debug 1"},
+			{level: LogLevelInfo, msg: "info foo"},
+			{level: LogLevelError, msg: "error"},
+		}))
+	})
+
+	It("only logs messages of enabled log levels", func() {
+		rl.level = LogLevelInfo
+		Expect(logger.Debug()).To(BeFalse())
+		logger.Debugf("debug")
+		logger.Infof("info")
+		Expect(rl.messages).To(HaveLen(1))
+		Expect(rl.messages[0].msg).To(Equal("info"))
+		rl.level = LogLevelDebug
+		Expect(logger.Debug()).To(BeTrue())
+	})
+
+	It("adds fields", func() {
+		connLogger := logger.WithFields(Field{Key: FieldPerspective, Value: "Server"}).WithFields(Field{Key: FieldConnectionID, Value: 1337})
+		connLogger.Infof("foo")
+		logger.Infof("bar")
+		Expect(rl.messages).To(HaveLen(2))
+		Expect(rl.messages[0].fields).To(Equal([]Field{
+			{Key: FieldPerspective, Value: "Server"},
+			{Key: FieldConnectionID, Value: 1337},
+		}))
+		Expect(rl.messages[1].fields).To(BeEmpty())
+	})
+
+	It("doesn't share fields between derived loggers", func() {
+		base := logger.WithFields(Field{Key: FieldPerspective, Value: "Client"})
+		logger1 := base.WithFields(Field{Key: FieldPacketNumber, Value: 1})
+		logger2 := base.WithFields(Field{Key: FieldPacketNumber, Value: 2})
+		logger1.Infof("foo")
+		logger2.Infof("bar")
+		Expect(rl.messages[0].fields[1].Value).To(Equal(1))
+		Expect(rl.messages[1].fields[1].Value).To(Equal(2))
+	})
+})
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// A TokenBucket limits the rate of events.
+// It holds up to burst tokens, and is refilled at a constant rate.
+// Every event takes one token. Events are not allowed while the bucket is empty.
+// It is safe for concurrent use.
+type TokenBucket struct {
+	mutex sync.Mutex
+
+	interval time.Duration // the time it takes to add one token
+	burst    int
+
+	tokens   int
+	lastFill time.Time
+}
+
+// NewTokenBucket creates a new token bucket that is full.
+// One token is added every interval.
+func NewTokenBucket(interval time.Duration, burst int) *TokenBucket {
+	return &TokenBucket{
+		interval: interval,
+		burst:    burst,
+		tokens:   burst,
+	}
+}
+
+// Allow says if an event is allowed at time now, and takes a token if it is.
+func (b *TokenBucket) Allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.lastFill.IsZero() {
+		b.lastFill = now
+	}
+	if elapsed := now.Sub(b.lastFill); elapsed >= b.interval {
+		n := int(elapsed / b.interval)
+		b.tokens += n
+		b.lastFill = b.lastFill.Add(time.Duration(n) * b.interval)
+		if b.tokens >= b.burst {
+			b.tokens = b.burst
+			b.lastFill = now
+		}
+	}
+	if b.tokens == 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token Bucket", func() {
+	const interval = 10 * time.Millisecond
+
+	It("allows a burst of events", func() {
+		b := NewTokenBucket(interval, 3)
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			Expect(b.Allow(now)).To(BeTrue())
+		}
+		Expect(b.Allow(now)).To(BeFalse())
+	})
+
+	It("refills the bucket", func() {
+		b := NewTokenBucket(interval, 3)
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			Expect(b.Allow(now)).To(BeTrue())
+		}
+		Expect(b.Allow(now.Add(interval - time.Nanosecond))).To(BeFalse())
+		Expect(b.Allow(now.Add(interval))).To(BeTrue())
+		Expect(b.Allow(now.Add(interval))).To(BeFalse())
+		// the time that passed since the last token was added is taken into account
+		Expect(b.Allow(now.Add(5 * interval / 2))).To(BeTrue())
+		Expect(b.Allow(now.Add(5 * interval / 2))).To(BeFalse())
+		Expect(b.Allow(now.Add(3 * interval))).To(BeTrue())
+	})
+
+	It("doesn't hold more than burst tokens", func() {
+		b := NewTokenBucket(interval, 2)
+		now := time.Now()
+		Expect(b.Allow(now)).To(BeTrue())
+		now = now.Add(time.Hour)
+		Expect(b.Allow(now)).To(BeTrue())
+		Expect(b.Allow(now)).To(BeTrue())
+		Expect(b.Allow(now)).To(BeFalse())
+	})
+})
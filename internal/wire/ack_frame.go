@@ -21,6 +21,10 @@ type AckFrame struct {
 	// this field will not be set for received ACKs frames
 	PacketReceivedTime time.Time
 	DelayTime          time.Duration
+
+	// ECN counts, only used for IETF QUIC.
+	// If any of them is non-zero, the frame is sent as an ACK_ECN frame.
+	ECT0, ECT1, ECNCE uint64
 }
 
 // parseAckFrame reads an ACK frame
@@ -29,9 +33,11 @@ func parseAckFrame(r *bytes.Reader, version protocol.VersionNumber) (*AckFrame,
 		return parseAckFrameLegacy(r, version)
 	}
 
-	if _, err := r.ReadByte(); err != nil {
+	typeByte, err := r.ReadByte()
+	if err != nil {
 		return nil, err
 	}
+	ecn := typeByte == 0x1a
 
 	frame := &AckFrame{}
 
@@ -90,6 +96,19 @@ func parseAckFrame(r *bytes.Reader, version protocol.VersionNumber) (*AckFrame,
 	if !frame.validateAckRanges() {
 		return nil, errInvalidAckRanges
 	}
+
+	// read the ECN counts
+	if ecn {
+		if frame.ECT0, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+		if frame.ECT1, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+		if frame.ECNCE, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+	}
 	return frame, nil
 }
 
@@ -99,7 +118,12 @@ func (f *AckFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error
 		return f.writeLegacy(b, version)
 	}
 
-	b.WriteByte(0x0d)
+	hasECN := f.HasECN()
+	if hasECN {
+		b.WriteByte(0x1a)
+	} else {
+		b.WriteByte(0x0d)
+	}
 	utils.WriteVarInt(b, uint64(f.LargestAcked()))
 	utils.WriteVarInt(b, encodeAckDelay(f.DelayTime))
 
@@ -116,6 +140,12 @@ func (f *AckFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error
 		utils.WriteVarInt(b, gap)
 		utils.WriteVarInt(b, len)
 	}
+
+	if hasECN {
+		utils.WriteVarInt(b, f.ECT0)
+		utils.WriteVarInt(b, f.ECT1)
+		utils.WriteVarInt(b, f.ECNCE)
+	}
 	return nil
 }
 
@@ -139,7 +169,14 @@ func (f *AckFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
 		length += utils.VarIntLen(gap)
 		length += utils.VarIntLen(len)
 	}
-	return length
+	return length + f.ecnLength()
+}
+
+func (f *AckFrame) ecnLength() protocol.ByteCount {
+	if !f.HasECN() {
+		return 0
+	}
+	return utils.VarIntLen(f.ECT0) + utils.VarIntLen(f.ECT1) + utils.VarIntLen(f.ECNCE)
 }
 
 // gets the number of ACK ranges that can be encoded
@@ -147,6 +184,7 @@ func (f *AckFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
 func (f *AckFrame) numEncodableAckRanges() int {
 	length := 1 + utils.VarIntLen(uint64(f.LargestAcked())) + utils.VarIntLen(encodeAckDelay(f.DelayTime))
 	length += 2 // assume that the number of ranges will consume 2 bytes
+	length += f.ecnLength()
 	for i := 1; i < len(f.AckRanges); i++ {
 		gap, len := f.encodeAckRange(i)
 		rangeLen := utils.VarIntLen(gap) + utils.VarIntLen(len)
@@ -168,6 +206,11 @@ func (f *AckFrame) encodeAckRange(i int) (uint64 /* gap */, uint64 /* length */)
 		uint64(f.AckRanges[i].Largest - f.AckRanges[i].Smallest)
 }
 
+// HasECN says if this frame contains ECN counts
+func (f *AckFrame) HasECN() bool {
+	return f.ECT0 > 0 || f.ECT1 > 0 || f.ECNCE > 0
+}
+
 // HasMissingRanges returns if this frame reports any missing packets
 func (f *AckFrame) HasMissingRanges() bool {
 	return len(f.AckRanges) > 1
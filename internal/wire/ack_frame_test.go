@@ -113,6 +113,44 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 			Expect(b.Len()).To(BeZero())
 		})
 
+		It("parses an ACK_ECN frame", func() {
+			data := []byte{0x1a}
+			data = append(data, encodeVarInt(100)...) // largest acked
+			data = append(data, encodeVarInt(0)...)   // delay
+			data = append(data, encodeVarInt(0)...)   // num blocks
+			data = append(data, encodeVarInt(10)...)  // first ack block
+			data = append(data, encodeVarInt(42)...)  // ECT(0)
+			data = append(data, encodeVarInt(1)...)   // ECT(1)
+			data = append(data, encodeVarInt(7)...)   // CE
+			b := bytes.NewReader(data)
+			frame, err := parseAckFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.LargestAcked()).To(Equal(protocol.PacketNumber(100)))
+			Expect(frame.LowestAcked()).To(Equal(protocol.PacketNumber(90)))
+			Expect(frame.HasECN()).To(BeTrue())
+			Expect(frame.ECT0).To(BeEquivalentTo(42))
+			Expect(frame.ECT1).To(BeEquivalentTo(1))
+			Expect(frame.ECNCE).To(BeEquivalentTo(7))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors on EOF in an ACK_ECN frame", func() {
+			data := []byte{0x1a}
+			data = append(data, encodeVarInt(1000)...) // largest acked
+			data = append(data, encodeVarInt(0)...)    // delay
+			data = append(data, encodeVarInt(0)...)    // num blocks
+			data = append(data, encodeVarInt(100)...)  // first ack block
+			data = append(data, encodeVarInt(1)...)    // ECT(0)
+			data = append(data, encodeVarInt(2)...)    // ECT(1)
+			data = append(data, encodeVarInt(3)...)    // CE
+			_, err := parseAckFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseAckFrame(bytes.NewReader(data[0:i]), versionIETFFrames)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+
 		It("errors on EOF", func() {
 			data := []byte{0xd}
 			data = append(data, encodeVarInt(1000)...) // largest acked
@@ -221,6 +259,36 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 			Expect(b.Len()).To(BeZero())
 		})
 
+		It("writes an ACK_ECN frame", func() {
+			buf := &bytes.Buffer{}
+			f := &AckFrame{
+				AckRanges: []AckRange{
+					{Smallest: 400, Largest: 1000},
+					{Smallest: 100, Largest: 200},
+				},
+				ECT0:  0x1337,
+				ECT1:  1,
+				ECNCE: 0xdeadbeef,
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()[0]).To(BeEquivalentTo(0x1a))
+			Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(buf.Len()))
+			b := bytes.NewReader(buf.Bytes())
+			frame, err := parseAckFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("writes an ACK frame if none of the ECN counts are set", func() {
+			buf := &bytes.Buffer{}
+			f := &AckFrame{AckRanges: []AckRange{{Smallest: 100, Largest: 1337}}}
+			Expect(f.HasECN()).To(BeFalse())
+			Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+			Expect(buf.Bytes()[0]).To(BeEquivalentTo(0xd))
+		})
+
 		It("limits the maximum size of the ACK frame", func() {
 			buf := &bytes.Buffer{}
 			const numRanges = 1000
@@ -243,6 +311,24 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 			Expect(b.Len()).To(BeZero())
 			Expect(len(frame.AckRanges)).To(BeNumerically("<", numRanges)) // make sure we dropped some ranges
 		})
+
+		It("accounts for the ECN counts when limiting the size of the ACK frame", func() {
+			buf := &bytes.Buffer{}
+			const numRanges = 1000
+			ackRanges := make([]AckRange, numRanges)
+			for i := protocol.PacketNumber(1); i <= numRanges; i++ {
+				ackRanges[numRanges-i] = AckRange{Smallest: 2 * i, Largest: 2 * i}
+			}
+			f := &AckFrame{
+				AckRanges: ackRanges,
+				ECT0:      0xdeadbeef,
+				ECT1:      0xdeadbeef,
+				ECNCE:     0xdeadbeef,
+			}
+			Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+			Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(buf.Len()))
+			Expect(buf.Len()).To(BeNumerically("<=", protocol.MaxAckFrameSize))
+		})
 	})
 
 	Context("ACK range validator", func() {
@@ -12,14 +12,18 @@ import (
 )
 
 // A ConnectionCloseFrame in QUIC
+// In IETF QUIC, it is sent as an APPLICATION_CLOSE frame, if IsApplicationError is set.
+// gQUIC doesn't have APPLICATION_CLOSE frames.
 type ConnectionCloseFrame struct {
-	ErrorCode    qerr.ErrorCode
-	ReasonPhrase string
+	IsApplicationError bool
+	ErrorCode          qerr.ErrorCode
+	ReasonPhrase       string
 }
 
-// parseConnectionCloseFrame reads a CONNECTION_CLOSE frame
+// parseConnectionCloseFrame reads a CONNECTION_CLOSE or an APPLICATION_CLOSE frame
 func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber) (*ConnectionCloseFrame, error) {
-	if _, err := r.ReadByte(); err != nil { // read the TypeByte
+	typeByte, err := r.ReadByte()
+	if err != nil {
 		return nil, err
 	}
 
@@ -62,8 +66,9 @@ func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber)
 	}
 
 	return &ConnectionCloseFrame{
-		ErrorCode:    errorCode,
-		ReasonPhrase: string(reasonPhrase),
+		IsApplicationError: version.UsesIETFFrameFormat() && typeByte == 0x3,
+		ErrorCode:          errorCode,
+		ReasonPhrase:       string(reasonPhrase),
 	}, nil
 }
 
@@ -77,7 +82,11 @@ func (f *ConnectionCloseFrame) Length(version protocol.VersionNumber) protocol.B
 
 // Write writes an CONNECTION_CLOSE frame.
 func (f *ConnectionCloseFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
-	b.WriteByte(0x02)
+	if f.IsApplicationError && version.UsesIETFFrameFormat() {
+		b.WriteByte(0x03)
+	} else {
+		b.WriteByte(0x02)
+	}
 
 	if len(f.ReasonPhrase) > math.MaxUint16 {
 		return errors.New("ConnectionFrame: ReasonPhrase too long")
@@ -58,6 +58,19 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 				Expect(frame.ReasonPhrase).To(BeEmpty())
 				Expect(b.Len()).To(BeZero())
 			})
+
+			It("parses an APPLICATION_CLOSE frame", func() {
+				data := []byte{0x3, 0xca, 0xfe}
+				data = append(data, encodeVarInt(6)...) // reason phrase length
+				data = append(data, []byte("foobar")...)
+				b := bytes.NewReader(data)
+				frame, err := parseConnectionCloseFrame(b, versionIETFFrames)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.IsApplicationError).To(BeTrue())
+				Expect(frame.ErrorCode).To(Equal(qerr.ErrorCode(0xcafe)))
+				Expect(frame.ReasonPhrase).To(Equal("foobar"))
+				Expect(b.Len()).To(BeZero())
+			})
 		})
 
 		Context("in big endian", func() {
@@ -138,6 +151,21 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 				Expect(b.Bytes()).To(Equal(expected))
 			})
 
+			It("writes an APPLICATION_CLOSE frame", func() {
+				b := &bytes.Buffer{}
+				frame := &ConnectionCloseFrame{
+					IsApplicationError: true,
+					ErrorCode:          0xdead,
+					ReasonPhrase:       "foobar",
+				}
+				err := frame.Write(b, versionIETFFrames)
+				Expect(err).ToNot(HaveOccurred())
+				expected := []byte{0x3, 0xde, 0xad}
+				expected = append(expected, encodeVarInt(6)...)
+				expected = append(expected, []byte{'f', 'o', 'o', 'b', 'a', 'r'}...)
+				Expect(b.Bytes()).To(Equal(expected))
+			})
+
 			It("has proper min length", func() {
 				b := &bytes.Buffer{}
 				f := &ConnectionCloseFrame{
@@ -181,6 +209,17 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 				}))
 			})
 
+			It("writes a CONNECTION_CLOSE frame for application errors", func() {
+				b := &bytes.Buffer{}
+				frame := &ConnectionCloseFrame{
+					IsApplicationError: true,
+					ErrorCode:          0xdeadbeef,
+				}
+				err := frame.Write(b, versionBigEndian)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(b.Bytes()[0]).To(BeEquivalentTo(0x2))
+			})
+
 			It("has proper min length", func() {
 				b := &bytes.Buffer{}
 				f := &ConnectionCloseFrame{
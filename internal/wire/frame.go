@@ -11,3 +11,54 @@ type Frame interface {
 	Write(b *bytes.Buffer, version protocol.VersionNumber) error
 	Length(version protocol.VersionNumber) protocol.ByteCount
 }
+
+// FrameName returns the name of the frame type, as used in the IETF QUIC draft
+func FrameName(f Frame) string {
+	switch frame := f.(type) {
+	case *StreamFrame:
+		return "STREAM"
+	case *AckFrame:
+		return "ACK"
+	case *StopWaitingFrame:
+		return "STOP_WAITING"
+	case *PingFrame:
+		return "PING"
+	case *RstStreamFrame:
+		return "RST_STREAM"
+	case *ConnectionCloseFrame:
+		if frame.IsApplicationError {
+			return "APPLICATION_CLOSE"
+		}
+		return "CONNECTION_CLOSE"
+	case *GoawayFrame:
+		return "GOAWAY"
+	case *MaxDataFrame:
+		return "MAX_DATA"
+	case *MaxStreamDataFrame:
+		return "MAX_STREAM_DATA"
+	case *MaxStreamIDFrame:
+		return "MAX_STREAM_ID"
+	case *BlockedFrame:
+		return "BLOCKED"
+	case *StreamBlockedFrame:
+		return "STREAM_BLOCKED"
+	case *StreamIDBlockedFrame:
+		return "STREAM_ID_BLOCKED"
+	case *StopSendingFrame:
+		return "STOP_SENDING"
+	case *PathChallengeFrame:
+		return "PATH_CHALLENGE"
+	case *PathResponseFrame:
+		return "PATH_RESPONSE"
+	case *NewTokenFrame:
+		return "NEW_TOKEN"
+	case *NewConnectionIDFrame:
+		return "NEW_CONNECTION_ID"
+	case *RetireConnectionIDFrame:
+		return "RETIRE_CONNECTION_ID"
+	case *DatagramFrame:
+		return "DATAGRAM"
+	default:
+		return "UNKNOWN"
+	}
+}
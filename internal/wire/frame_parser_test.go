@@ -200,6 +200,19 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame).To(Equal(f))
 		})
 
+		It("unpacks APPLICATION_CLOSE frames", func() {
+			f := &ConnectionCloseFrame{
+				IsApplicationError: true,
+				ErrorCode:          0x42,
+				ReasonPhrase:       "foo",
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("unpacks MAX_DATA frames", func() {
 			f := &MaxDataFrame{
 				ByteOffset: 0xcafe,
@@ -289,6 +302,19 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame.(*AckFrame).LargestAcked()).To(Equal(protocol.PacketNumber(0x13)))
 		})
 
+		It("unpacks ACK_ECN frames", func() {
+			f := &AckFrame{
+				AckRanges: []AckRange{{Smallest: 1, Largest: 0x13}},
+				ECT0:      10,
+				ECNCE:     2,
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("unpacks PATH_CHALLENGE frames", func() {
 			f := &PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
 			err := f.Write(buf, versionIETFFrames)
@@ -311,6 +337,46 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame.(*PathResponseFrame).Data).To(Equal([8]byte{1, 2, 3, 4, 5, 6, 7, 8}))
 		})
 
+		It("unpacks NEW_TOKEN frames", func() {
+			f := &NewTokenFrame{Token: []byte("foobar")}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks NEW_CONNECTION_ID frames", func() {
+			f := &NewConnectionIDFrame{
+				SequenceNumber:      42,
+				ConnectionID:        protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				StatelessResetToken: protocol.StatelessResetToken{0xde, 0xad, 0xbe, 0xef},
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks RETIRE_CONNECTION_ID frames", func() {
+			f := &RetireConnectionIDFrame{SequenceNumber: 1337}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks DATAGRAM frames", func() {
+			f := &DatagramFrame{DataLenPresent: true, Data: []byte("foobar")}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("errors on invalid type", func() {
 			_, err := ParseNextFrame(bytes.NewReader([]byte{0x42}), nil, versionIETFFrames)
 			Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0x42"))
@@ -320,17 +386,22 @@ var _ = Describe("Frame parsing", func() {
 			for b, e := range map[byte]qerr.ErrorCode{
 				0x01: qerr.InvalidRstStreamData,
 				0x02: qerr.InvalidConnectionCloseData,
+				0x03: qerr.InvalidConnectionCloseData,
 				0x04: qerr.InvalidWindowUpdateData,
 				0x05: qerr.InvalidWindowUpdateData,
 				0x06: qerr.InvalidFrameData,
 				0x08: qerr.InvalidBlockedData,
 				0x09: qerr.InvalidBlockedData,
 				0x0a: qerr.InvalidFrameData,
+				0x0b: qerr.InvalidFrameData,
 				0x0c: qerr.InvalidFrameData,
 				0x0d: qerr.InvalidAckData,
 				0x0e: qerr.InvalidFrameData,
 				0x0f: qerr.InvalidFrameData,
 				0x10: qerr.InvalidStreamData,
+				0x19: qerr.InvalidFrameData,
+				0x1b: qerr.InvalidFrameData,
+				0x31: qerr.InvalidFrameData,
 			} {
 				_, err := ParseNextFrame(bytes.NewReader([]byte{b}), nil, versionIETFFrames)
 				Expect(err).To(HaveOccurred())
@@ -0,0 +1,32 @@
+package wire
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Frame", func() {
+	It("returns the names of frame types", func() {
+		Expect(FrameName(&StreamFrame{})).To(Equal("STREAM"))
+		Expect(FrameName(&AckFrame{})).To(Equal("ACK"))
+		Expect(FrameName(&StopWaitingFrame{})).To(Equal("STOP_WAITING"))
+		Expect(FrameName(&PingFrame{})).To(Equal("PING"))
+		Expect(FrameName(&RstStreamFrame{})).To(Equal("RST_STREAM"))
+		Expect(FrameName(&ConnectionCloseFrame{})).To(Equal("CONNECTION_CLOSE"))
+		Expect(FrameName(&ConnectionCloseFrame{IsApplicationError: true})).To(Equal("APPLICATION_CLOSE"))
+		Expect(FrameName(&GoawayFrame{})).To(Equal("GOAWAY"))
+		Expect(FrameName(&MaxDataFrame{})).To(Equal("MAX_DATA"))
+		Expect(FrameName(&MaxStreamDataFrame{})).To(Equal("MAX_STREAM_DATA"))
+		Expect(FrameName(&MaxStreamIDFrame{})).To(Equal("MAX_STREAM_ID"))
+		Expect(FrameName(&BlockedFrame{})).To(Equal("BLOCKED"))
+		Expect(FrameName(&StreamBlockedFrame{})).To(Equal("STREAM_BLOCKED"))
+		Expect(FrameName(&StreamIDBlockedFrame{})).To(Equal("STREAM_ID_BLOCKED"))
+		Expect(FrameName(&StopSendingFrame{})).To(Equal("STOP_SENDING"))
+		Expect(FrameName(&PathChallengeFrame{})).To(Equal("PATH_CHALLENGE"))
+		Expect(FrameName(&PathResponseFrame{})).To(Equal("PATH_RESPONSE"))
+		Expect(FrameName(&NewTokenFrame{})).To(Equal("NEW_TOKEN"))
+		Expect(FrameName(&NewConnectionIDFrame{})).To(Equal("NEW_CONNECTION_ID"))
+		Expect(FrameName(&RetireConnectionIDFrame{})).To(Equal("RETIRE_CONNECTION_ID"))
+		Expect(FrameName(&DatagramFrame{})).To(Equal("DATAGRAM"))
+	})
+})
@@ -2,6 +2,7 @@ package wire
 
 import (
 	"bytes"
+	"io"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -34,13 +35,15 @@ type Header struct {
 	IsLongHeader bool
 	KeyPhase     int
 	PayloadLen   protocol.ByteCount
+	Token        []byte // only present in Initial packets
 
-	// only needed for logging
+	// set when parsing or writing a gQUIC Public Header
 	isPublicHeader bool
 }
 
 // ParseHeaderSentByServer parses the header for a packet that was sent by the server.
-func ParseHeaderSentByServer(b *bytes.Reader, version protocol.VersionNumber) (*Header, error) {
+// For IETF QUIC Short Headers, the connection ID is expected to be connIDLen bytes long.
+func ParseHeaderSentByServer(b *bytes.Reader, version protocol.VersionNumber, connIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -57,11 +60,12 @@ func ParseHeaderSentByServer(b *bytes.Reader, version protocol.VersionNumber) (*
 		isPublicHeader = !version.UsesTLS()
 	}
 
-	return parsePacketHeader(b, protocol.PerspectiveServer, isPublicHeader)
+	return parsePacketHeader(b, protocol.PerspectiveServer, isPublicHeader, connIDLen)
 }
 
 // ParseHeaderSentByClient parses the header for a packet that was sent by the client.
-func ParseHeaderSentByClient(b *bytes.Reader) (*Header, error) {
+// For IETF QUIC Short Headers, the connection ID is expected to be connIDLen bytes long.
+func ParseHeaderSentByClient(b *bytes.Reader, connIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -75,10 +79,41 @@ func ParseHeaderSentByClient(b *bytes.Reader) (*Header, error) {
 	// * 0x80 is always unset and
 	// * and 0x8 is always set (this is the Connection ID flag, which the client always sets)
 	isPublicHeader := typeByte&0x88 == 0x8
-	return parsePacketHeader(b, protocol.PerspectiveClient, isPublicHeader)
+	return parsePacketHeader(b, protocol.PerspectiveClient, isPublicHeader, connIDLen)
 }
 
-func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHeader bool) (*Header, error) {
+// ParseConnectionID parses the destination connection ID of a packet, without parsing the rest of the header.
+// It is used to demultiplex packets received on a shared net.PacketConn.
+// For IETF QUIC Short Headers, the connection ID is expected to be shortHeaderConnIDLen bytes long.
+// The gQUIC Public Header is only supported if it contains the connection ID.
+// The returned connection ID is a slice of data.
+func ParseConnectionID(data []byte, shortHeaderConnIDLen int) (protocol.ConnectionID, error) {
+	if len(data) == 0 {
+		return nil, io.EOF
+	}
+	var connIDStart, connIDLen int
+	switch {
+	case data[0]&0x80 > 0: // IETF Long Header or Version Negotiation
+		// the connection ID lengths are encoded in the byte after the version
+		if len(data) < 6 {
+			return nil, io.EOF
+		}
+		connIDStart = 6
+		connIDLen, _ = decodeConnIDLen(data[5])
+	case data[0]&0x8 > 0: // gQUIC Public Header with the connection ID flag set
+		connIDStart = 1
+		connIDLen = protocol.ConnectionIDLenGQUIC
+	default: // IETF Short Header
+		connIDStart = 1
+		connIDLen = shortHeaderConnIDLen
+	}
+	if len(data) < connIDStart+connIDLen {
+		return nil, io.EOF
+	}
+	return protocol.ConnectionID(data[connIDStart : connIDStart+connIDLen]), nil
+}
+
+func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHeader bool, shortHeaderConnIDLen int) (*Header, error) {
 	// This is a gQUIC Public Header.
 	if isPublicHeader {
 		hdr, err := parsePublicHeader(b, sentBy)
@@ -88,7 +123,7 @@ func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHea
 		hdr.isPublicHeader = true // save that this is a Public Header, so we can log it correctly later
 		return hdr, nil
 	}
-	return parseHeader(b, sentBy)
+	return parseHeader(b, sentBy, shortHeaderConnIDLen)
 }
 
 // Write writes the Header.
@@ -108,6 +143,12 @@ func (h *Header) GetLength(pers protocol.Perspective, version protocol.VersionNu
 	return h.getHeaderLength()
 }
 
+// IsPublicHeader says if this is a gQUIC Public Header.
+// It is only reliable for headers that were parsed or written.
+func (h *Header) IsPublicHeader() bool {
+	return h.isPublicHeader
+}
+
 // Log logs the Header
 func (h *Header) Log(logger utils.Logger) {
 	if h.isPublicHeader {
@@ -31,11 +31,12 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen2,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.KeyPhase).To(BeEquivalentTo(1))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
 			Expect(hdr.isPublicHeader).To(BeFalse())
+			Expect(hdr.IsPublicHeader()).To(BeFalse())
 		})
 
 		It("parses an IETF draft header, when the version is not known, but it has Long Header format", func() {
@@ -49,7 +50,7 @@ var _ = Describe("Header", func() {
 				Version:          0x1234,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.Type).To(Equal(protocol.PacketType0RTT))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
@@ -68,7 +69,7 @@ var _ = Describe("Header", func() {
 				PacketNumber:     0x42,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), versionIETFHeader)
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), versionIETFHeader, 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.isPublicHeader).To(BeFalse())
 		})
@@ -85,13 +86,14 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen6,
 			}).writePublicHeader(buf, protocol.PerspectiveClient, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
 			Expect(hdr.SrcConnectionID).To(Equal(connID))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
 			Expect(hdr.Version).To(Equal(versionPublicHeader))
 			Expect(hdr.isPublicHeader).To(BeTrue())
+			Expect(hdr.IsPublicHeader()).To(BeTrue())
 		})
 
 		It("parses a gQUIC Public Header, when the version is known", func() {
@@ -105,7 +107,7 @@ var _ = Describe("Header", func() {
 				DiversificationNonce: bytes.Repeat([]byte{'f'}, 32),
 			}).writePublicHeader(buf, protocol.PerspectiveServer, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), versionPublicHeader)
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), versionPublicHeader, 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
 			Expect(hdr.SrcConnectionID).To(Equal(connID))
@@ -125,14 +127,14 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen6,
 			}).writePublicHeader(buf, protocol.PerspectiveClient, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()[0:12]))
+			_, err = ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()[0:12]), 8)
 			Expect(err).To(MatchError(io.EOF))
 		})
 
 		It("errors when given no data", func() {
-			_, err := ParseHeaderSentByServer(bytes.NewReader([]byte{}), protocol.VersionUnknown)
+			_, err := ParseHeaderSentByServer(bytes.NewReader([]byte{}), protocol.VersionUnknown, 8)
 			Expect(err).To(MatchError(io.EOF))
-			_, err = ParseHeaderSentByClient(bytes.NewReader([]byte{}))
+			_, err = ParseHeaderSentByClient(bytes.NewReader([]byte{}), 8)
 			Expect(err).To(MatchError(io.EOF))
 		})
 
@@ -140,7 +142,7 @@ var _ = Describe("Header", func() {
 			connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0xde, 0xca, 0xfb, 0xad}
 			versions := []protocol.VersionNumber{0x13, 0x37}
 			data := ComposeGQUICVersionNegotiation(connID, versions)
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), protocol.VersionUnknown)
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), protocol.VersionUnknown, 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.isPublicHeader).To(BeTrue())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
@@ -157,7 +159,7 @@ var _ = Describe("Header", func() {
 			versions := []protocol.VersionNumber{0x13, 0x37}
 			data, err := ComposeVersionNegotiation(destConnID, srcConnID, versions)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), protocol.VersionUnknown)
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), protocol.VersionUnknown, 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.isPublicHeader).To(BeFalse())
 			Expect(hdr.IsVersionNegotiation).To(BeTrue())
@@ -171,6 +173,87 @@ var _ = Describe("Header", func() {
 		})
 	})
 
+	Context("parsing the connection ID", func() {
+		It("parses the connection ID of an IETF Long Header", func() {
+			buf := &bytes.Buffer{}
+			err := (&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				PacketNumber:     0x42,
+				Version:          0x1234,
+			}).writeHeader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			connID, err := ParseConnectionID(buf.Bytes(), 4)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
+		})
+
+		It("parses the connection ID of an IETF Version Negotiation Packet", func() {
+			data, err := ComposeVersionNegotiation(protocol.ConnectionID{1, 2, 3, 4, 5}, protocol.ConnectionID{5, 4, 3, 2, 1}, []protocol.VersionNumber{0x1234})
+			Expect(err).ToNot(HaveOccurred())
+			connID, err := ParseConnectionID(data, 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5}))
+		})
+
+		It("parses the connection ID of an IETF Short Header", func() {
+			buf := &bytes.Buffer{}
+			err := (&Header{
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6},
+				PacketNumber:     0x42,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+			}).writeHeader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			connID, err := ParseConnectionID(buf.Bytes(), 6)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6}))
+		})
+
+		It("parses the connection ID of a gQUIC Public Header", func() {
+			buf := &bytes.Buffer{}
+			err := (&Header{
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				PacketNumber:     0x42,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+			}).Write(buf, protocol.PerspectiveClient, versionPublicHeader)
+			Expect(err).ToNot(HaveOccurred())
+			// use a different length for IETF QUIC Short Headers
+			connID, err := ParseConnectionID(buf.Bytes(), 4)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+		})
+
+		It("parses the connection ID of a gQUIC Version Negotiation Packet", func() {
+			data := ComposeGQUICVersionNegotiation(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, []protocol.VersionNumber{0x1234})
+			connID, err := ParseConnectionID(data, 4)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+		})
+
+		It("errors on EOF", func() {
+			buf := &bytes.Buffer{}
+			err := (&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				PacketNumber:     0x42,
+				Version:          0x1234,
+			}).writeHeader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			data := buf.Bytes()[:16] // cut the packet in the middle of the destination connection ID
+			for i := range data {
+				_, err := ParseConnectionID(data[:i], 8)
+				Expect(err).To(MatchError(io.EOF))
+			}
+			_, err = ParseConnectionID([]byte{0x30, 1, 2, 3}, 8)
+			Expect(err).To(MatchError(io.EOF))
+		})
+	})
+
 	Context("writing", func() {
 		It("writes a gQUIC Public Header", func() {
 			buf := &bytes.Buffer{}
@@ -198,7 +281,7 @@ var _ = Describe("Header", func() {
 			}
 			err := hdr.Write(buf, protocol.PerspectiveServer, versionIETFHeader)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = parseHeader(bytes.NewReader(buf.Bytes()), protocol.PerspectiveServer)
+			_, err = parseHeader(bytes.NewReader(buf.Bytes()), protocol.PerspectiveServer, 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.isPublicHeader).To(BeFalse())
 		})
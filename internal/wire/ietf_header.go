@@ -12,7 +12,7 @@ import (
 )
 
 // parseHeader parses the header.
-func parseHeader(b *bytes.Reader, packetSentBy protocol.Perspective) (*Header, error) {
+func parseHeader(b *bytes.Reader, packetSentBy protocol.Perspective, shortHeaderConnIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -20,7 +20,7 @@ func parseHeader(b *bytes.Reader, packetSentBy protocol.Perspective) (*Header, e
 	if typeByte&0x80 > 0 {
 		return parseLongHeader(b, packetSentBy, typeByte)
 	}
-	return parseShortHeader(b, typeByte)
+	return parseShortHeader(b, typeByte, shortHeaderConnIDLen)
 }
 
 // parse long header and version negotiation packets
@@ -70,6 +70,22 @@ func parseLongHeader(b *bytes.Reader, sentBy protocol.Perspective, typeByte byte
 		return h, nil
 	}
 
+	if protocol.PacketType(typeByte&0x7f) == protocol.PacketTypeInitial {
+		tokenLen, err := utils.ReadVarInt(b)
+		if err != nil {
+			return nil, err
+		}
+		if tokenLen > uint64(b.Len()) {
+			return nil, io.EOF
+		}
+		if tokenLen > 0 {
+			h.Token = make([]byte, tokenLen)
+			if _, err := io.ReadFull(b, h.Token); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	pl, err := utils.ReadVarInt(b)
 	if err != nil {
 		return nil, err
@@ -91,12 +107,9 @@ func parseLongHeader(b *bytes.Reader, sentBy protocol.Perspective, typeByte byte
 	return h, nil
 }
 
-func parseShortHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
-	connID := make(protocol.ConnectionID, 8)
-	if _, err := io.ReadFull(b, connID); err != nil {
-		if err == io.ErrUnexpectedEOF {
-			err = io.EOF
-		}
+func parseShortHeader(b *bytes.Reader, typeByte byte, connIDLen int) (*Header, error) {
+	connID, err := protocol.ReadConnectionID(b, connIDLen)
+	if err != nil {
 		return nil, err
 	}
 	// bits 2 and 3 must be set, bit 4 must be unset
@@ -136,8 +149,9 @@ func (h *Header) writeHeader(b *bytes.Buffer) error {
 
 // TODO: add support for the key phase
 func (h *Header) writeLongHeader(b *bytes.Buffer) error {
-	if h.SrcConnectionID.Len() != protocol.ConnectionIDLen {
-		return fmt.Errorf("Header: source connection ID must be %d bytes, is %d", protocol.ConnectionIDLen, h.SrcConnectionID.Len())
+	// clients may use a zero-length source connection ID
+	if l := h.SrcConnectionID.Len(); l != 0 && l < protocol.MinConnectionIDLen {
+		return fmt.Errorf("Header: source connection ID must be at least %d bytes, is %d", protocol.MinConnectionIDLen, h.SrcConnectionID.Len())
 	}
 	b.WriteByte(byte(0x80 | h.Type))
 	utils.BigEndian.WriteUint32(b, uint32(h.Version))
@@ -148,6 +162,10 @@ func (h *Header) writeLongHeader(b *bytes.Buffer) error {
 	b.WriteByte(connIDLen)
 	b.Write(h.DestConnectionID.Bytes())
 	b.Write(h.SrcConnectionID.Bytes())
+	if h.Type == protocol.PacketTypeInitial {
+		utils.WriteVarInt(b, uint64(len(h.Token)))
+		b.Write(h.Token)
+	}
 	utils.WriteVarInt(b, uint64(h.PayloadLen))
 	utils.BigEndian.WriteUint32(b, uint32(h.PacketNumber))
 	return nil
@@ -181,7 +199,11 @@ func (h *Header) writeShortHeader(b *bytes.Buffer) error {
 
 func (h *Header) getHeaderLength() (protocol.ByteCount, error) {
 	if h.IsLongHeader {
-		return 1 /* type byte */ + 4 /* version */ + 1 /* conn id len byte */ + protocol.ByteCount(h.DestConnectionID.Len()+h.SrcConnectionID.Len()) + utils.VarIntLen(uint64(h.PayloadLen)) + 4 /* packet number */, nil
+		length := 1 /* type byte */ + 4 /* version */ + 1 /* conn id len byte */ + protocol.ByteCount(h.DestConnectionID.Len()+h.SrcConnectionID.Len()) + utils.VarIntLen(uint64(h.PayloadLen)) + 4 /* packet number */
+		if h.Type == protocol.PacketTypeInitial {
+			length += utils.VarIntLen(uint64(len(h.Token))) + protocol.ByteCount(len(h.Token))
+		}
+		return length, nil
 	}
 
 	length := protocol.ByteCount(1 /* type byte */ + h.DestConnectionID.Len())
@@ -196,6 +218,14 @@ func (h *Header) logHeader(logger utils.Logger) {
 	if h.IsLongHeader {
 		if h.Version == 0 {
 			logger.Debugf("    VersionNegotiationPacket{DestConnectionID: %s, SrcConnectionID: %s, SupportedVersions: %s}", h.DestConnectionID, h.SrcConnectionID, h.SupportedVersions)
+		} else if h.Type == protocol.PacketTypeInitial {
+			var token string
+			if len(h.Token) > 0 {
+				token = fmt.Sprintf("%#x", h.Token)
+			} else {
+				token = "(empty)"
+			}
+			logger.Debugf("   Long Header{Type: %s, DestConnectionID: %s, SrcConnectionID: %s, Token: %s, PacketNumber: %#x, PayloadLen: %d, Version: %s}", h.Type, h.DestConnectionID, h.SrcConnectionID, token, h.PacketNumber, h.PayloadLen, h.Version)
 		} else {
 			logger.Debugf("   Long Header{Type: %s, DestConnectionID: %s, SrcConnectionID: %s, PacketNumber: %#x, PayloadLen: %d, Version: %s}", h.Type, h.DestConnectionID, h.SrcConnectionID, h.PacketNumber, h.PayloadLen, h.Version)
 		}
@@ -16,7 +16,7 @@ import (
 )
 
 var _ = Describe("IETF QUIC Header", func() {
-	srcConnID := protocol.ConnectionID(bytes.Repeat([]byte{'f'}, protocol.ConnectionIDLen))
+	srcConnID := protocol.ConnectionID(bytes.Repeat([]byte{'f'}, protocol.DefaultConnectionIDLength))
 
 	Context("parsing", func() {
 		Context("Version Negotiation Packets", func() {
@@ -26,7 +26,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b, protocol.PerspectiveServer)
+				h, err := parseHeader(b, protocol.PerspectiveServer, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsVersionNegotiation).To(BeTrue())
 				Expect(h.Version).To(BeZero())
@@ -43,7 +43,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(data[:len(data)-2])
-				_, err = parseHeader(b, protocol.PerspectiveServer)
+				_, err = parseHeader(b, protocol.PerspectiveServer, 8)
 				Expect(err).To(MatchError(qerr.InvalidVersionNegotiationPacket))
 			})
 
@@ -53,7 +53,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				// remove 8 bytes (two versions), since ComposeVersionNegotiation also added a reserved version number
-				_, err = parseHeader(bytes.NewReader(data[:len(data)-8]), protocol.PerspectiveServer)
+				_, err = parseHeader(bytes.NewReader(data[:len(data)-8]), protocol.PerspectiveServer, 8)
 				Expect(err).To(MatchError("InvalidVersionNegotiationPacket: empty version list"))
 			})
 		})
@@ -67,6 +67,10 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // destination connection ID
 					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // source connection ID
 				}
+				if t == protocol.PacketTypeInitial {
+					data = append(data, encodeVarInt(6)...)  // token length
+					data = append(data, []byte("foobar")...) // token
+				}
 				data = append(data, encodeVarInt(0x1337)...)           // payload length
 				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...) // packet number
 				return data
@@ -74,13 +78,14 @@ var _ = Describe("IETF QUIC Header", func() {
 
 			It("parses a long header", func() {
 				b := bytes.NewReader(generatePacket(protocol.PacketTypeInitial))
-				h, err := parseHeader(b, protocol.PerspectiveClient)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.Type).To(Equal(protocol.PacketTypeInitial))
 				Expect(h.IsLongHeader).To(BeTrue())
 				Expect(h.OmitConnectionID).To(BeFalse())
 				Expect(h.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}))
 				Expect(h.SrcConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}))
+				Expect(h.Token).To(Equal([]byte("foobar")))
 				Expect(h.PayloadLen).To(Equal(protocol.ByteCount(0x1337)))
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdecafbad)))
 				Expect(h.PacketNumberLen).To(Equal(protocol.PacketNumberLen4))
@@ -89,6 +94,46 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(b.Len()).To(BeZero())
 			})
 
+			It("parses a Handshake packet, which doesn't have a token", func() {
+				b := bytes.NewReader(generatePacket(protocol.PacketTypeHandshake))
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.Type).To(Equal(protocol.PacketTypeHandshake))
+				Expect(h.Token).To(BeEmpty())
+				Expect(h.PayloadLen).To(Equal(protocol.ByteCount(0x1337)))
+				Expect(b.Len()).To(BeZero())
+			})
+
+			It("parses an Initial packet without a token", func() {
+				data := []byte{
+					0x80 ^ uint8(protocol.PacketTypeInitial),
+					0x1, 0x2, 0x3, 0x4, // version number
+					0x50,                                           // connection ID lengths
+					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // destination connection ID
+				}
+				data = append(data, encodeVarInt(0)...)    // token length
+				data = append(data, encodeVarInt(0x42)...) // payload length
+				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...)
+				b := bytes.NewReader(data)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.Token).To(BeNil())
+				Expect(h.PayloadLen).To(Equal(protocol.ByteCount(0x42)))
+				Expect(b.Len()).To(BeZero())
+			})
+
+			It("errors if the token length is too large", func() {
+				data := []byte{
+					0x80 ^ uint8(protocol.PacketTypeInitial),
+					0x1, 0x2, 0x3, 0x4, // version number
+					0x0, // no connection IDs
+				}
+				data = append(data, encodeVarInt(5)...)    // token length: 5 bytes (1 byte too long)
+				data = append(data, []byte{1, 2, 3, 4}...) // 4 bytes of token
+				_, err := parseHeader(bytes.NewReader(data), protocol.PerspectiveClient, 8)
+				Expect(err).To(MatchError(io.EOF))
+			})
+
 			It("parses a long header without a destination connection ID", func() {
 				data := []byte{
 					0x80 ^ uint8(protocol.PacketTypeInitial),
@@ -96,10 +141,11 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x01,                   // connection ID lengths
 					0xde, 0xad, 0xbe, 0xef, // source connection ID
 				}
+				data = append(data, encodeVarInt(0)...)    // token length
 				data = append(data, encodeVarInt(0x42)...) // payload length
 				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...)
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b, protocol.PerspectiveClient)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.SrcConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
 				Expect(h.DestConnectionID).To(BeEmpty())
@@ -112,10 +158,11 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x70,                          // connection ID lengths
 					1, 2, 3, 4, 5, 6, 7, 8, 9, 10, // source connection ID
 				}
+				data = append(data, encodeVarInt(0)...)    // token length
 				data = append(data, encodeVarInt(0x42)...) // payload length
 				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...)
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b, protocol.PerspectiveClient)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.SrcConnectionID).To(BeEmpty())
 				Expect(h.DestConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
@@ -131,7 +178,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				}).Write(buf, protocol.PerspectiveServer, protocol.VersionTLS)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(buf.Bytes())
-				_, err = parseHeader(b, protocol.PerspectiveClient)
+				_, err = parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).To(MatchError(fmt.Sprintf("InvalidPacketHeader: Received packet with invalid packet type: %d", protocol.PacketTypeRetry)))
 			})
 
@@ -145,7 +192,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				}).Write(buf, protocol.PerspectiveClient, protocol.VersionTLS)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(buf.Bytes())
-				_, err = parseHeader(b, protocol.PerspectiveServer)
+				_, err = parseHeader(b, protocol.PerspectiveServer, 8)
 				Expect(err).To(MatchError(fmt.Sprintf("InvalidPacketHeader: Received packet with invalid packet type: %d", protocol.PacketType0RTT)))
 			})
 
@@ -159,7 +206,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				}).Write(buf, protocol.PerspectiveClient, protocol.VersionTLS)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(buf.Bytes())
-				_, err = parseHeader(b, protocol.PerspectiveServer)
+				_, err = parseHeader(b, protocol.PerspectiveServer, 8)
 				Expect(err).To(MatchError("InvalidPacketHeader: Received packet with invalid packet type: 42"))
 			})
 
@@ -170,7 +217,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x0,                    // no connection IDs
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
-				_, err := parseHeader(bytes.NewReader(data), protocol.PerspectiveClient)
+				_, err := parseHeader(bytes.NewReader(data), protocol.PerspectiveClient, 8)
 				Expect(err).To(MatchError(qerr.InvalidVersion))
 			})
 
@@ -181,10 +228,12 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x55,                                           // connection ID lengths
 					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // destination connection ID
 					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // source connection ID
+					0x3, 0xca, 0xfe, 0x42, // token
+					0x1,                    // payload length
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				for i := 0; i < len(data); i++ {
-					_, err := parseHeader(bytes.NewReader(data[:i]), protocol.PerspectiveClient)
+					_, err := parseHeader(bytes.NewReader(data[:i]), protocol.PerspectiveClient, 8)
 					Expect(err).To(Equal(io.EOF))
 				}
 			})
@@ -198,7 +247,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x42, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b, protocol.PerspectiveClient)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.KeyPhase).To(Equal(0))
@@ -210,6 +259,20 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(b.Len()).To(BeZero())
 			})
 
+			It("reads a short header with a connection ID of a configured length", func() {
+				data := []byte{
+					0x30,                   // 1 byte packet number
+					0xde, 0xad, 0xbe, 0xef, // connection ID
+					0x42, // packet number
+				}
+				b := bytes.NewReader(data)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 4)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
+				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
+				Expect(b.Len()).To(BeZero())
+			})
+
 			It("reads the Key Phase Bit", func() {
 				data := []byte{
 					0x30 ^ 0x40,
@@ -217,7 +280,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x11,
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b, protocol.PerspectiveClient)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.KeyPhase).To(Equal(1))
@@ -231,7 +294,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x13, 0x37, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b, protocol.PerspectiveClient)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
@@ -246,7 +309,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xad, 0xbe, 0xef, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b, protocol.PerspectiveClient)
+				h, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdeadbeef)))
@@ -261,7 +324,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xad, 0xbe, 0xef, // packet number
 				}
 				b := bytes.NewReader(data)
-				_, err := parseHeader(b, protocol.PerspectiveClient)
+				_, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).To(MatchError("invalid short header type"))
 			})
 
@@ -272,7 +335,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				b := bytes.NewReader(data)
-				_, err := parseHeader(b, protocol.PerspectiveClient)
+				_, err := parseHeader(b, protocol.PerspectiveClient, 8)
 				Expect(err).To(MatchError("invalid bits 3, 4 and 5"))
 			})
 
@@ -283,7 +346,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				for i := 0; i < len(data); i++ {
-					_, err := parseHeader(bytes.NewReader(data[:i]), protocol.PerspectiveClient)
+					_, err := parseHeader(bytes.NewReader(data[:i]), protocol.PerspectiveClient, 8)
 					Expect(err).To(Equal(io.EOF))
 				}
 			})
@@ -321,6 +384,61 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(buf.Bytes()).To(Equal(expected))
 			})
 
+			It("writes an Initial packet with a token", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeInitial,
+					DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe},
+					SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x0, 0x0, 0x13, 0x37},
+					Token:            []byte("foobar"),
+					PayloadLen:       0xcafe,
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				expected := []byte{
+					0x80 ^ uint8(protocol.PacketTypeInitial),
+					0x1, 0x2, 0x3, 0x4, // version number
+					0x35,                               // connection ID lengths
+					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, // dest connection ID
+					0xde, 0xca, 0xfb, 0xad, 0x0, 0x0, 0x13, 0x37, // source connection ID
+				}
+				expected = append(expected, encodeVarInt(6)...)                // token length
+				expected = append(expected, []byte("foobar")...)               // token
+				expected = append(expected, encodeVarInt(0xcafe)...)           // payload length
+				expected = append(expected, []byte{0xde, 0xca, 0xfb, 0xad}...) // packet number
+				Expect(buf.Bytes()).To(Equal(expected))
+			})
+
+			It("writes an Initial packet without a token", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4},
+					PayloadLen:       0x42,
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()[1+4+1+4+4]).To(BeZero()) // token length
+			})
+
+			It("doesn't write a token for packets other than Initial packets", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4},
+					Token:            []byte("foobar"),
+					PayloadLen:       0x42,
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()).ToNot(ContainSubstring("foobar"))
+			})
+
 			It("refuses to write a header with a too short connection ID", func() {
 				err := (&Header{
 					IsLongHeader:     true,
@@ -357,6 +475,43 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(buf.Bytes()).To(ContainSubstring(string([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18})))
 			})
+
+			It("writes a header with a 4 byte source connection ID", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             0x5,
+					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4},
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()[5]).To(Equal(byte(0x11))) // connection ID lengths
+			})
+
+			It("refuses to write a header with a too short source connection ID", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             0x5,
+					SrcConnectionID:  protocol.ConnectionID{1, 2, 3},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4},
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).To(MatchError("Header: source connection ID must be at least 4 bytes, is 3"))
+			})
+
+			It("writes a header with a zero-length source connection ID", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             0x5,
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4},
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()[5]).To(Equal(byte(0x10))) // connection ID lengths
+			})
 		})
 
 		Context("short header", func() {
@@ -472,6 +627,22 @@ var _ = Describe("IETF QUIC Header", func() {
 			Expect(buf.Len()).To(Equal(expectedLen))
 		})
 
+		It("has the right length for an Initial packet containing a token", func() {
+			h := &Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				PayloadLen:       1500,
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				Token:            []byte("foo"),
+			}
+			expectedLen := 1 /* type byte */ + 4 /* version */ + 1 /* conn ID len */ + 8 /* dest conn id */ + 8 /* src conn id */ + 1 /* token length */ + 3 /* token */ + 2 /* long payload len */ + 4 /* packet number */
+			Expect(h.getHeaderLength()).To(BeEquivalentTo(expectedLen))
+			err := h.writeHeader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Len()).To(Equal(expectedLen))
+		})
+
 		It("has the right length for a hort header containing a connection ID", func() {
 			h := &Header{
 				PacketNumberLen:  protocol.PacketNumberLen1,
@@ -566,6 +737,33 @@ var _ = Describe("IETF QUIC Header", func() {
 			Expect(buf.String()).To(ContainSubstring("Long Header{Type: Handshake, DestConnectionID: 0xdeadbeefcafe1337, SrcConnectionID: 0xdecafbad13371337, PacketNumber: 0x1337, PayloadLen: 54321, Version: 0xfeed}"))
 		})
 
+		It("logs Initial packets", func() {
+			(&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				PacketNumber:     0x1337,
+				PayloadLen:       54321,
+				DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37},
+				SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x013, 0x37, 0x13, 0x37},
+				Token:            []byte{0xde, 0xad, 0xbe, 0xef},
+				Version:          0xfeed,
+			}).logHeader(logger)
+			Expect(buf.String()).To(ContainSubstring("Long Header{Type: Initial, DestConnectionID: 0xdeadbeefcafe1337, SrcConnectionID: 0xdecafbad13371337, Token: 0xdeadbeef, PacketNumber: 0x1337, PayloadLen: 54321, Version: 0xfeed}"))
+		})
+
+		It("logs Initial packets without a token", func() {
+			(&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				PacketNumber:     0x1337,
+				PayloadLen:       54321,
+				DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37},
+				SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x013, 0x37, 0x13, 0x37},
+				Version:          0xfeed,
+			}).logHeader(logger)
+			Expect(buf.String()).To(ContainSubstring("Token: (empty)"))
+		})
+
 		It("logs Short Headers containing a connection ID", func() {
 			(&Header{
 				KeyPhase:         1,
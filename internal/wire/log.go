@@ -21,11 +21,15 @@ func LogFrame(logger utils.Logger, frame Frame, sent bool) {
 			logger.Debugf("\t%s &wire.StopWaitingFrame{LeastUnacked: 0x%x}", dir, f.LeastUnacked)
 		}
 	case *AckFrame:
-		if len(f.AckRanges) > 1 {
+		if f.HasECN() {
+			logger.Debugf("\t%s &wire.AckFrame{LargestAcked: 0x%x, LowestAcked: 0x%x, AckRanges: %#v, DelayTime: %s, ECT0: %d, ECT1: %d, CE: %d}", dir, f.LargestAcked(), f.LowestAcked(), f.AckRanges, f.DelayTime.String(), f.ECT0, f.ECT1, f.ECNCE)
+		} else if len(f.AckRanges) > 1 {
 			logger.Debugf("\t%s &wire.AckFrame{LargestAcked: 0x%x, LowestAcked: 0x%x, AckRanges: %#v, DelayTime: %s}", dir, f.LargestAcked(), f.LowestAcked(), f.AckRanges, f.DelayTime.String())
 		} else {
 			logger.Debugf("\t%s &wire.AckFrame{LargestAcked: 0x%x, LowestAcked: 0x%x, DelayTime: %s}", dir, f.LargestAcked(), f.LowestAcked(), f.DelayTime.String())
 		}
+	case *DatagramFrame:
+		logger.Debugf("\t%s &wire.DatagramFrame{Data length: 0x%x}", dir, len(f.Data))
 	default:
 		logger.Debugf("\t%s %#v", dir, frame)
 	}
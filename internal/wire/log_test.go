@@ -56,6 +56,11 @@ var _ = Describe("Frame logging", func() {
 		Expect(buf.Bytes()).To(ContainSubstring("\t<- &wire.StreamFrame{StreamID: 42, FinBit: false, Offset: 0x1337, Data length: 0x100, Offset + Data length: 0x1437}\n"))
 	})
 
+	It("logs DATAGRAM frames", func() {
+		LogFrame(logger, &DatagramFrame{Data: bytes.Repeat([]byte{'f'}, 0x100)}, true)
+		Expect(buf.Bytes()).To(ContainSubstring("\t-> &wire.DatagramFrame{Data length: 0x100}\n"))
+	})
+
 	It("logs ACK frames without missing packets", func() {
 		frame := &AckFrame{
 			AckRanges: []AckRange{{Smallest: 0x42, Largest: 0x1337}},
@@ -77,6 +82,17 @@ var _ = Describe("Frame logging", func() {
 		Expect(buf.String()).To(ContainSubstring("\t<- &wire.AckFrame{LargestAcked: 0x8, LowestAcked: 0x2, AckRanges: []wire.AckRange{wire.AckRange{Smallest:0x5, Largest:0x8}, wire.AckRange{Smallest:0x2, Largest:0x3}}, DelayTime: 12ms}\n"))
 	})
 
+	It("logs ACK frames with ECN counts", func() {
+		frame := &AckFrame{
+			AckRanges: []AckRange{{Smallest: 0x42, Largest: 0x1337}},
+			DelayTime: 1 * time.Millisecond,
+			ECT0:      10,
+			ECNCE:     2,
+		}
+		LogFrame(logger, frame, false)
+		Expect(buf.String()).To(ContainSubstring("\t<- &wire.AckFrame{LargestAcked: 0x1337, LowestAcked: 0x42, AckRanges: []wire.AckRange{wire.AckRange{Smallest:0x42, Largest:0x1337}}, DelayTime: 1ms, ECT0: 10, ECT1: 0, CE: 2}\n"))
+	})
+
 	It("logs incoming StopWaiting frames", func() {
 		frame := &StopWaitingFrame{
 			LeastUnacked: 0x1337,
@@ -0,0 +1,64 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A NewConnectionIDFrame is a NEW_CONNECTION_ID frame
+// It provides the peer with an alternative connection ID, which can be used to break linkability when migrating.
+type NewConnectionIDFrame struct {
+	SequenceNumber      uint64
+	ConnectionID        protocol.ConnectionID
+	StatelessResetToken protocol.StatelessResetToken
+}
+
+func parseNewConnectionIDFrame(r *bytes.Reader, _ protocol.VersionNumber) (*NewConnectionIDFrame, error) {
+	if _, err := r.ReadByte(); err != nil {
+		return nil, err
+	}
+	seq, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	connIDLen, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if connIDLen < protocol.MinConnectionIDLen || connIDLen > protocol.MaxConnectionIDLen {
+		return nil, fmt.Errorf("invalid connection ID length: %d", connIDLen)
+	}
+	connID, err := protocol.ReadConnectionID(r, int(connIDLen))
+	if err != nil {
+		return nil, err
+	}
+	frame := &NewConnectionIDFrame{
+		SequenceNumber: seq,
+		ConnectionID:   connID,
+	}
+	if _, err := io.ReadFull(r, frame.StatelessResetToken[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (f *NewConnectionIDFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+	b.WriteByte(0x0b)
+	utils.WriteVarInt(b, f.SequenceNumber)
+	b.WriteByte(uint8(f.ConnectionID.Len()))
+	b.Write(f.ConnectionID.Bytes())
+	b.Write(f.StatelessResetToken[:])
+	return nil
+}
+
+// Length of a written frame
+func (f *NewConnectionIDFrame) Length(_ protocol.VersionNumber) protocol.ByteCount {
+	return 1 + utils.VarIntLen(f.SequenceNumber) + 1 + protocol.ByteCount(f.ConnectionID.Len()) + 16
+}
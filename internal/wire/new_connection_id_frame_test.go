@@ -0,0 +1,89 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NEW_CONNECTION_ID frame", func() {
+	Context("when parsing", func() {
+		It("accepts a sample frame", func() {
+			data := []byte{0x0b}
+			data = append(data, encodeVarInt(0xdeadbeef)...)   // sequence number
+			data = append(data, 4)                             // connection ID length
+			data = append(data, []byte{1, 2, 3, 4}...)         // connection ID
+			data = append(data, []byte("deadbeefdecafbad")...) // stateless reset token
+			b := bytes.NewReader(data)
+			frame, err := parseNewConnectionIDFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.SequenceNumber).To(Equal(uint64(0xdeadbeef)))
+			Expect(frame.ConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4}))
+			Expect(string(frame.StatelessResetToken[:])).To(Equal("deadbeefdecafbad"))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors when the connection ID has an invalid length", func() {
+			for _, l := range []byte{3, 19} {
+				data := []byte{0x0b}
+				data = append(data, encodeVarInt(1)...)
+				data = append(data, l)
+				data = append(data, bytes.Repeat([]byte{1}, int(l))...)
+				data = append(data, []byte("deadbeefdecafbad")...)
+				_, err := parseNewConnectionIDFrame(bytes.NewReader(data), versionIETFFrames)
+				Expect(err).To(MatchError(fmt.Sprintf("invalid connection ID length: %d", l)))
+			}
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0x0b}
+			data = append(data, encodeVarInt(0xdeadbeef)...)
+			data = append(data, 4)
+			data = append(data, []byte{1, 2, 3, 4}...)
+			data = append(data, []byte("deadbeefdecafbad")...)
+			_, err := parseNewConnectionIDFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseNewConnectionIDFrame(bytes.NewReader(data[0:i]), versionIETFFrames)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a sample frame", func() {
+			token := protocol.StatelessResetToken{}
+			copy(token[:], []byte("deadbeefdecafbad"))
+			frame := &NewConnectionIDFrame{
+				SequenceNumber:      0x1337,
+				ConnectionID:        protocol.ConnectionID{1, 2, 3, 4, 5, 6},
+				StatelessResetToken: token,
+			}
+			b := &bytes.Buffer{}
+			Expect(frame.Write(b, versionIETFFrames)).To(Succeed())
+			expected := []byte{0x0b}
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, 6)
+			expected = append(expected, []byte{1, 2, 3, 4, 5, 6}...)
+			expected = append(expected, []byte("deadbeefdecafbad")...)
+			Expect(b.Bytes()).To(Equal(expected))
+		})
+
+		It("has the correct length", func() {
+			frame := &NewConnectionIDFrame{
+				SequenceNumber: 0xdecafbad,
+				ConnectionID:   protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+			}
+			b := &bytes.Buffer{}
+			Expect(frame.Write(b, versionIETFFrames)).To(Succeed())
+			Expect(frame.Length(versionIETFFrames)).To(BeEquivalentTo(b.Len()))
+			Expect(frame.Length(versionIETFFrames)).To(Equal(1 + utils.VarIntLen(0xdecafbad) + 1 + 8 + 16))
+		})
+	})
+})
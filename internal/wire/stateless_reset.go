@@ -0,0 +1,21 @@
+package wire
+
+import (
+	"crypto/rand"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// WriteStatelessReset writes an IETF QUIC stateless reset.
+// To an observer, it looks like a packet with a Short Header:
+// apart from the type byte and the token at the end, it consists of random bytes.
+func WriteStatelessReset(token protocol.StatelessResetToken) ([]byte, error) {
+	b := make([]byte, protocol.MinStatelessResetSize)
+	if _, err := rand.Read(b[:len(b)-len(token)]); err != nil {
+		return nil, err
+	}
+	// use a random key phase and a random packet number length
+	b[0] = 0x30 | (b[0] & 0x40) | (b[0] & 0x3 % 3)
+	copy(b[len(b)-len(token):], token[:])
+	return b, nil
+}
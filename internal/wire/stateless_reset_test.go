@@ -0,0 +1,39 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stateless Resets", func() {
+	token := protocol.StatelessResetToken{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}
+
+	It("writes a stateless reset", func() {
+		b, err := WriteStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(HaveLen(protocol.MinStatelessResetSize))
+		Expect(b[len(b)-16:]).To(Equal(token[:]))
+	})
+
+	It("uses random bytes", func() {
+		b1, err := WriteStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		b2, err := WriteStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b1[1 : len(b1)-16]).ToNot(Equal(b2[1 : len(b2)-16]))
+	})
+
+	It("looks like a packet with a Short Header", func() {
+		for i := 0; i < 100; i++ {
+			b, err := WriteStatelessReset(token)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(b), protocol.VersionTLS, 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.IsLongHeader).To(BeFalse())
+		}
+	})
+})
@@ -204,5 +204,24 @@ var _ = Describe("StopWaitingFrame", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(readframe.LeastUnacked).To(Equal(frame.LeastUnacked))
 		})
+
+		It("reads STOP_WAITING frames written with all packet number lengths", func() {
+			packetNumber := protocol.PacketNumber(0x1337)
+			for _, pnLen := range []protocol.PacketNumberLen{protocol.PacketNumberLen1, protocol.PacketNumberLen2, protocol.PacketNumberLen4, protocol.PacketNumberLen6} {
+				frame := &StopWaitingFrame{
+					LeastUnacked:    packetNumber - 0x42,
+					PacketNumber:    packetNumber,
+					PacketNumberLen: pnLen,
+				}
+				b := &bytes.Buffer{}
+				Expect(frame.Write(b, versionBigEndian)).To(Succeed())
+				Expect(b.Len()).To(BeEquivalentTo(frame.Length(versionBigEndian)))
+				r := bytes.NewReader(b.Bytes())
+				readframe, err := parseStopWaitingFrame(r, packetNumber, pnLen, versionBigEndian)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(readframe.LeastUnacked).To(Equal(frame.LeastUnacked))
+				Expect(r.Len()).To(BeZero())
+			}
+		})
 	})
 })
@@ -0,0 +1,16 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// newLogger creates the logger used by a client or a server.
+// If no Logger is set in the Config, the utils.DefaultLogger is used.
+func newLogger(config *Config, pers protocol.Perspective) utils.Logger {
+	logger := utils.DefaultLogger
+	if config.Logger != nil {
+		logger = utils.NewStructuredLogger(config.Logger)
+	}
+	return logger.WithFields(utils.Field{Key: utils.FieldPerspective, Value: pers.String()})
+}
@@ -0,0 +1,62 @@
+package quic
+
+import (
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type loggedMessage struct {
+	level  LogLevel
+	msg    string
+	fields []LogField
+}
+
+// The recordingLogger records the messages passed to a Logger.
+type recordingLogger struct {
+	mutex    sync.Mutex
+	level    LogLevel
+	messages []loggedMessage
+}
+
+var _ Logger = &recordingLogger{}
+
+func (l *recordingLogger) Enabled(level LogLevel) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return level <= l.level
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string, fields []LogField) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.messages = append(l.messages, loggedMessage{level: level, msg: msg, fields: fields})
+}
+
+func (l *recordingLogger) getMessages() []loggedMessage {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.messages
+}
+
+var _ = Describe("Logger", func() {
+	It("uses the DefaultLogger, if no Logger is set", func() {
+		Expect(newLogger(&Config{}, protocol.PerspectiveClient)).To(Equal(utils.DefaultLogger))
+	})
+
+	It("adds the perspective to the messages", func() {
+		l := &recordingLogger{level: LogLevelInfo}
+		logger := newLogger(&Config{Logger: l}, protocol.PerspectiveServer)
+		logger.Infof("foo %d", 42)
+		logger.Debugf("bar")
+		Expect(l.getMessages()).To(Equal([]loggedMessage{{
+			level:  LogLevelInfo,
+			msg:    "foo 42",
+			fields: []LogField{{Key: LogFieldPerspective, Value: "Server"}},
+		}}))
+	})
+})
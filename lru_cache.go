@@ -0,0 +1,75 @@
+package quic
+
+import (
+	"container/list"
+	"sync"
+)
+
+type lruCacheEntry struct {
+	key   string
+	value []byte
+}
+
+// An lruCache is a map that evicts the least recently used entry when it runs full.
+// It is safe for concurrent use.
+// It is used by both the lruSessionCache and the lruTokenStore.
+type lruCache struct {
+	mutex sync.Mutex
+
+	entries  map[string]*list.Element
+	queue    *list.List // the most recently used entry is at the front
+	capacity int
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		entries:  make(map[string]*list.Element),
+		queue:    list.New(),
+		capacity: capacity,
+	}
+}
+
+// Get returns the value stored for a key, and marks the entry as the most recently used.
+func (c *lruCache) Get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.queue.MoveToFront(elem)
+	return elem.Value.(*lruCacheEntry).value, true
+}
+
+// Put stores the value for a key, evicting the least recently used entry if the cache is full.
+func (c *lruCache) Put(key string, value []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lruCacheEntry).value = value
+		c.queue.MoveToFront(elem)
+		return
+	}
+	if c.queue.Len() >= c.capacity {
+		oldest := c.queue.Back()
+		c.queue.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruCacheEntry).key)
+	}
+	c.entries[key] = c.queue.PushFront(&lruCacheEntry{key: key, value: value})
+}
+
+// Remove deletes the entry for a key, and returns its value.
+func (c *lruCache) Remove(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.queue.Remove(elem)
+	delete(c.entries, key)
+	return elem.Value.(*lruCacheEntry).value, true
+}
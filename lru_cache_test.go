@@ -0,0 +1,56 @@
+package quic
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LRU Cache", func() {
+	var cache *lruCache
+
+	BeforeEach(func() {
+		cache = newLRUCache(2)
+	})
+
+	expectEntry := func(key string, value []byte) {
+		v, ok := cache.Get(key)
+		ExpectWithOffset(1, ok).To(BeTrue())
+		ExpectWithOffset(1, v).To(Equal(value))
+	}
+
+	expectNoEntry := func(key string) {
+		_, ok := cache.Get(key)
+		ExpectWithOffset(1, ok).To(BeFalse())
+	}
+
+	It("gets and removes values", func() {
+		expectNoEntry("foo")
+		cache.Put("foo", []byte("foobar"))
+		expectEntry("foo", []byte("foobar"))
+		v, ok := cache.Remove("foo")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal([]byte("foobar")))
+		_, ok = cache.Remove("foo")
+		Expect(ok).To(BeFalse())
+		expectNoEntry("foo")
+	})
+
+	It("marks entries as recently used when getting them", func() {
+		cache.Put("foo", []byte("foo"))
+		cache.Put("bar", []byte("bar"))
+		expectEntry("foo", []byte("foo"))
+		cache.Put("baz", []byte("baz"))
+		expectNoEntry("bar")
+		expectEntry("foo", []byte("foo"))
+		expectEntry("baz", []byte("baz"))
+	})
+
+	It("doesn't evict entries after another entry was removed", func() {
+		cache.Put("foo", []byte("foo"))
+		cache.Put("bar", []byte("bar"))
+		cache.Remove("foo")
+		cache.Put("baz", []byte("baz"))
+		expectEntry("bar", []byte("bar"))
+		expectEntry("baz", []byte("baz"))
+	})
+})
@@ -0,0 +1,168 @@
+// Package metrics aggregates the events of QUIC connections into counters.
+// The counters can be published using expvar, and exported in the Prometheus text format.
+//
+// A Metrics is used as the Tracer of a listener or a client:
+//
+//	m := metrics.New("my-server")
+//	expvar.Publish("quic", m)
+//	http.Handle("/metrics", metrics.PrometheusHandler(m))
+//	ln, err := quic.ListenAddr(addr, tlsConf, &quic.Config{Tracer: m})
+//
+// The package doesn't implement a prometheus.Collector, since that would add a dependency on the Prometheus client library.
+// Applications that already use the client library can register a collector that reads the values from Snapshot.
+package metrics
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// A Snapshot contains the values of the counters of a Metrics at one point in time.
+type Snapshot struct {
+	// SessionsStarted is the number of sessions that were started.
+	SessionsStarted uint64 `json:"sessions_started"`
+	// ActiveSessions is the number of sessions that were started, but not closed yet.
+	ActiveSessions uint64 `json:"active_sessions"`
+	// Handshakes is the number of handshakes that completed.
+	Handshakes uint64 `json:"handshakes"`
+	// PacketsSent and PacketsReceived count the packets sent and received. Only packets that could be decrypted are counted as received.
+	PacketsSent     uint64 `json:"packets_sent"`
+	PacketsReceived uint64 `json:"packets_received"`
+	// PacketsLost is the number of packets that were declared lost.
+	PacketsLost uint64 `json:"packets_lost"`
+	// PacketsRetransmitted is the number of packets that were sent to retransmit the contents of lost packets.
+	PacketsRetransmitted uint64 `json:"packets_retransmitted"`
+	// PacketsDropped is the number of received packets that were not processed.
+	PacketsDropped uint64 `json:"packets_dropped"`
+	// VersionNegotiationsSent is the number of Version Negotiation Packets sent by the server.
+	VersionNegotiationsSent uint64 `json:"version_negotiations_sent"`
+	// StatelessResetsSent is the number of stateless resets (or Public Resets, for gQUIC) sent by the server.
+	StatelessResetsSent uint64 `json:"stateless_resets_sent"`
+}
+
+// Metrics counts the events of all connections it is used for.
+// It implements quic.Tracer, and expvar.Var.
+// It is safe for concurrent use.
+type Metrics struct {
+	// the counters are accessed atomically, and need to be 64 bit aligned
+	sessionsStarted         uint64
+	sessionsClosed          uint64
+	handshakes              uint64
+	packetsSent             uint64
+	packetsReceived         uint64
+	packetsLost             uint64
+	packetsRetransmitted    uint64
+	packetsDropped          uint64
+	versionNegotiationsSent uint64
+	statelessResetsSent     uint64
+
+	name string
+}
+
+var _ quic.Tracer = &Metrics{}
+
+// New creates a new Metrics.
+// The name identifies the listener (or client) in the Prometheus export, where it is used as the value of the "listener" label.
+// It may be empty.
+func New(name string) *Metrics {
+	return &Metrics{name: name}
+}
+
+// Name returns the name passed to New.
+func (m *Metrics) Name() string {
+	return m.name
+}
+
+// Snapshot returns the current values of the counters.
+// Since the counters are read one after the other, they might not be consistent with each other.
+func (m *Metrics) Snapshot() Snapshot {
+	started := atomic.LoadUint64(&m.sessionsStarted)
+	closed := atomic.LoadUint64(&m.sessionsClosed)
+	s := Snapshot{
+		SessionsStarted:         started,
+		Handshakes:              atomic.LoadUint64(&m.handshakes),
+		PacketsSent:             atomic.LoadUint64(&m.packetsSent),
+		PacketsReceived:         atomic.LoadUint64(&m.packetsReceived),
+		PacketsLost:             atomic.LoadUint64(&m.packetsLost),
+		PacketsRetransmitted:    atomic.LoadUint64(&m.packetsRetransmitted),
+		PacketsDropped:          atomic.LoadUint64(&m.packetsDropped),
+		VersionNegotiationsSent: atomic.LoadUint64(&m.versionNegotiationsSent),
+		StatelessResetsSent:     atomic.LoadUint64(&m.statelessResetsSent),
+	}
+	// a session might be closed between loading the two counters
+	if started > closed {
+		s.ActiveSessions = started - closed
+	}
+	return s
+}
+
+// String returns the snapshot of the counters, encoded as a JSON object.
+// It makes Metrics implement expvar.Var.
+func (m *Metrics) String() string {
+	data, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		// this should never happen, since the Snapshot only contains integers
+		return "{}"
+	}
+	return string(data)
+}
+
+// StartedConnection implements quic.Tracer.
+func (m *Metrics) StartedConnection(quic.ConnectionID) {
+	atomic.AddUint64(&m.sessionsStarted, 1)
+}
+
+// ClosedConnection implements quic.Tracer.
+func (m *Metrics) ClosedConnection(quic.ConnectionID, error) {
+	atomic.AddUint64(&m.sessionsClosed, 1)
+}
+
+// CompletedHandshake implements quic.Tracer.
+func (m *Metrics) CompletedHandshake(quic.ConnectionID) {
+	atomic.AddUint64(&m.handshakes, 1)
+}
+
+// SentPacket implements quic.Tracer.
+func (m *Metrics) SentPacket(quic.ConnectionID, *quic.PacketHeader, []quic.FrameInfo) {
+	atomic.AddUint64(&m.packetsSent, 1)
+}
+
+// RetransmittedPacket implements quic.Tracer.
+func (m *Metrics) RetransmittedPacket(quic.ConnectionID, quic.PacketNumber) {
+	atomic.AddUint64(&m.packetsRetransmitted, 1)
+}
+
+// ReceivedPacket implements quic.Tracer.
+func (m *Metrics) ReceivedPacket(quic.ConnectionID, *quic.PacketHeader, []quic.FrameInfo) {
+	atomic.AddUint64(&m.packetsReceived, 1)
+}
+
+// LostPacket implements quic.Tracer.
+func (m *Metrics) LostPacket(quic.ConnectionID, quic.PacketNumber) {
+	atomic.AddUint64(&m.packetsLost, 1)
+}
+
+// UpdatedCongestion implements quic.Tracer.
+// The congestion window is a property of a single connection, so it is not aggregated.
+func (m *Metrics) UpdatedCongestion(quic.ConnectionID, quic.ByteCount, quic.ByteCount) {}
+
+// UpdatedRTT implements quic.Tracer.
+// The RTT is a property of a single connection, so it is not aggregated.
+func (m *Metrics) UpdatedRTT(quic.ConnectionID, quic.RTTStats) {}
+
+// DroppedPacket implements quic.Tracer.
+func (m *Metrics) DroppedPacket(quic.ConnectionID, quic.PacketDropReason) {
+	atomic.AddUint64(&m.packetsDropped, 1)
+}
+
+// SentVersionNegotiation implements quic.Tracer.
+func (m *Metrics) SentVersionNegotiation(quic.ConnectionID) {
+	atomic.AddUint64(&m.versionNegotiationsSent, 1)
+}
+
+// SentStatelessReset implements quic.Tracer.
+func (m *Metrics) SentStatelessReset(quic.ConnectionID) {
+	atomic.AddUint64(&m.statelessResetsSent, 1)
+}
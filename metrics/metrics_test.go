@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		m      *Metrics
+		connID quic.ConnectionID
+	)
+
+	BeforeEach(func() {
+		m = New("server")
+		connID = quic.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+	})
+
+	It("has a name", func() {
+		Expect(m.Name()).To(Equal("server"))
+	})
+
+	It("counts sessions", func() {
+		m.StartedConnection(connID)
+		m.StartedConnection(connID)
+		m.CompletedHandshake(connID)
+		m.ClosedConnection(connID, errors.New("test error"))
+		s := m.Snapshot()
+		Expect(s.SessionsStarted).To(BeEquivalentTo(2))
+		Expect(s.ActiveSessions).To(BeEquivalentTo(1))
+		Expect(s.Handshakes).To(BeEquivalentTo(1))
+	})
+
+	It("counts packets", func() {
+		hdr := &quic.PacketHeader{PacketNumber: 1}
+		m.SentPacket(connID, hdr, nil)
+		m.SentPacket(connID, hdr, nil)
+		m.RetransmittedPacket(connID, 2)
+		m.ReceivedPacket(connID, hdr, nil)
+		m.LostPacket(connID, 1)
+		m.DroppedPacket(connID, quic.PacketDropKeyUnavailable)
+		m.UpdatedCongestion(connID, 1000, 100)
+		s := m.Snapshot()
+		Expect(s.PacketsSent).To(BeEquivalentTo(2))
+		Expect(s.PacketsRetransmitted).To(BeEquivalentTo(1))
+		Expect(s.PacketsReceived).To(BeEquivalentTo(1))
+		Expect(s.PacketsLost).To(BeEquivalentTo(1))
+		Expect(s.PacketsDropped).To(BeEquivalentTo(1))
+	})
+
+	It("counts Version Negotiation Packets and stateless resets", func() {
+		m.SentVersionNegotiation(connID)
+		m.SentStatelessReset(connID)
+		m.SentStatelessReset(connID)
+		s := m.Snapshot()
+		Expect(s.VersionNegotiationsSent).To(BeEquivalentTo(1))
+		Expect(s.StatelessResetsSent).To(BeEquivalentTo(2))
+	})
+
+	It("is safe for concurrent use", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					m.StartedConnection(connID)
+					m.ClosedConnection(connID, nil)
+					m.Snapshot()
+				}
+			}()
+		}
+		wg.Wait()
+		s := m.Snapshot()
+		Expect(s.SessionsStarted).To(BeEquivalentTo(1000))
+		Expect(s.ActiveSessions).To(BeZero())
+	})
+
+	It("can be published using expvar", func() {
+		var _ expvar.Var = m
+		m.StartedConnection(connID)
+		m.SentPacket(connID, &quic.PacketHeader{}, nil)
+		var s map[string]uint64
+		Expect(json.Unmarshal([]byte(m.String()), &s)).To(Succeed())
+		Expect(s).To(HaveKeyWithValue("sessions_started", uint64(1)))
+		Expect(s).To(HaveKeyWithValue("active_sessions", uint64(1)))
+		Expect(s).To(HaveKeyWithValue("packets_sent", uint64(1)))
+		Expect(s).To(HaveKeyWithValue("stateless_resets_sent", uint64(0)))
+	})
+})
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// the content type of the Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type prometheusMetric struct {
+	name       string
+	help       string
+	metricType string // "counter" or "gauge"
+	value      func(Snapshot) uint64
+}
+
+var prometheusMetrics = []prometheusMetric{
+	{"quic_sessions_started_total", "Number of QUIC sessions started.", "counter", func(s Snapshot) uint64 { return s.SessionsStarted }},
+	{"quic_sessions_active", "Number of QUIC sessions that are currently open.", "gauge", func(s Snapshot) uint64 { return s.ActiveSessions }},
+	{"quic_handshakes_total", "Number of QUIC handshakes completed.", "counter", func(s Snapshot) uint64 { return s.Handshakes }},
+	{"quic_packets_sent_total", "Number of QUIC packets sent.", "counter", func(s Snapshot) uint64 { return s.PacketsSent }},
+	{"quic_packets_received_total", "Number of QUIC packets received and decrypted.", "counter", func(s Snapshot) uint64 { return s.PacketsReceived }},
+	{"quic_packets_lost_total", "Number of QUIC packets declared lost.", "counter", func(s Snapshot) uint64 { return s.PacketsLost }},
+	{"quic_packets_retransmitted_total", "Number of QUIC packets sent to retransmit lost packets.", "counter", func(s Snapshot) uint64 { return s.PacketsRetransmitted }},
+	{"quic_packets_dropped_total", "Number of received QUIC packets that were dropped.", "counter", func(s Snapshot) uint64 { return s.PacketsDropped }},
+	{"quic_version_negotiations_sent_total", "Number of Version Negotiation Packets sent.", "counter", func(s Snapshot) uint64 { return s.VersionNegotiationsSent }},
+	{"quic_stateless_resets_sent_total", "Number of stateless resets sent.", "counter", func(s Snapshot) uint64 { return s.StatelessResetsSent }},
+}
+
+// WritePrometheus writes the counters of the Metrics in the Prometheus text exposition format.
+// Every Metrics is identified by the "listener" label, which is set to its name.
+func WritePrometheus(w io.Writer, metrics ...*Metrics) error {
+	snapshots := make([]Snapshot, len(metrics))
+	for i, m := range metrics {
+		snapshots[i] = m.Snapshot()
+	}
+	bw := bufio.NewWriter(w)
+	for _, pm := range prometheusMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", pm.name, pm.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", pm.name, pm.metricType)
+		for i, m := range metrics {
+			if m.name == "" {
+				fmt.Fprintf(bw, "%s %d\n", pm.name, pm.value(snapshots[i]))
+			} else {
+				fmt.Fprintf(bw, "%s{listener=\"%s\"} %d\n", pm.name, escapeLabelValue(m.name), pm.value(snapshots[i]))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// PrometheusHandler returns an http.Handler that serves the counters of the Metrics in the Prometheus text exposition format.
+// It can be scraped by a Prometheus server, without depending on the Prometheus client library.
+func PrometheusHandler(metrics ...*Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		WritePrometheus(w, metrics...)
+	})
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
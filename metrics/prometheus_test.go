@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prometheus export", func() {
+	It("writes the counters in the text exposition format", func() {
+		m := New("")
+		m.StartedConnection(quic.ConnectionID{1, 2, 3, 4})
+		m.CompletedHandshake(quic.ConnectionID{1, 2, 3, 4})
+		buf := &bytes.Buffer{}
+		Expect(WritePrometheus(buf, m)).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("# HELP quic_handshakes_total Number of QUIC handshakes completed.\n# TYPE quic_handshakes_total counter\nquic_handshakes_total 1\n"))
+		Expect(buf.String()).To(ContainSubstring("# TYPE quic_sessions_active gauge\nquic_sessions_active 1\n"))
+		Expect(buf.String()).To(ContainSubstring("\nquic_stateless_resets_sent_total 0\n"))
+	})
+
+	It("uses the name as a label", func() {
+		m1 := New("server1")
+		m2 := New(`my "server"`)
+		m2.SentStatelessReset(quic.ConnectionID{1, 2, 3, 4})
+		buf := &bytes.Buffer{}
+		Expect(WritePrometheus(buf, m1, m2)).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("# TYPE quic_stateless_resets_sent_total counter\n" +
+			"quic_stateless_resets_sent_total{listener=\"server1\"} 0\n" +
+			"quic_stateless_resets_sent_total{listener=\"my \\\"server\\\"\"} 1\n"))
+		// the HELP and TYPE lines are only written once per metric
+		Expect(bytes.Count(buf.Bytes(), []byte("# TYPE quic_stateless_resets_sent_total"))).To(Equal(1))
+	})
+
+	It("serves the counters via HTTP", func() {
+		m := New("server")
+		m.SentPacket(quic.ConnectionID{1, 2, 3, 4}, &quic.PacketHeader{}, nil)
+		w := httptest.NewRecorder()
+		PrometheusHandler(m).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+		Expect(w.Body.String()).To(ContainSubstring("quic_packets_sent_total{listener=\"server\"} 1\n"))
+	})
+})
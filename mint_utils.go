@@ -8,6 +8,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"sync"
 
 	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
@@ -17,28 +19,151 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
 
+// the offset of the client random in a ClientHello message, following the handshake message header and the legacy_version
+const clientRandomOffset = 4 + 2
+
+// getClientRandom returns the client random of a ClientHello message.
+// It returns nil if the message is not a ClientHello.
+func getClientRandom(msg []byte) []byte {
+	if len(msg) < clientRandomOffset+32 || mint.HandshakeType(msg[0]) != mint.HandshakeTypeClientHello {
+		return nil
+	}
+	clientRandom := make([]byte, 32)
+	copy(clientRandom, msg[clientRandomOffset:])
+	return clientRandom
+}
+
+// parseClientHelloInfo parses a ClientHello message.
+// The RemoteAddr of the ClientHelloInfo is not set.
+func parseClientHelloInfo(msg []byte) (*ClientHelloInfo, error) {
+	if len(msg) < 4 || mint.HandshakeType(msg[0]) != mint.HandshakeTypeClientHello {
+		return nil, errors.New("expected a ClientHello")
+	}
+	length := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+	if len(msg)-4 < length {
+		return nil, errors.New("ClientHello too short")
+	}
+	ch := &mint.ClientHelloBody{}
+	if _, err := ch.Unmarshal(msg[4 : 4+length]); err != nil {
+		return nil, err
+	}
+	info := &ClientHelloInfo{}
+	var sni mint.ServerNameExtension
+	if found, err := ch.Extensions.Find(&sni); err != nil {
+		return nil, err
+	} else if found {
+		info.ServerName = string(sni)
+	}
+	var alpn mint.ALPNExtension
+	if found, err := ch.Extensions.Find(&alpn); err != nil {
+		return nil, err
+	} else if found {
+		info.SupportedProtos = alpn.Protocols
+	}
+	return info, nil
+}
+
+// The clientHelloRecorder records the beginning of the first TLS record sent (by the client) or received (by the server),
+// so that the client random can be retrieved from the ClientHello.
+// mint doesn't expose the client random.
+type clientHelloRecorder struct {
+	*handshake.CryptoStreamConn
+	perspective protocol.Perspective
+	data        []byte
+}
+
+// the length of a TLS record header
+const recordHeaderLen = 5
+
+func (r *clientHelloRecorder) Read(b []byte) (int, error) {
+	n, err := r.CryptoStreamConn.Read(b)
+	if r.perspective == protocol.PerspectiveServer {
+		r.record(b[:n])
+	}
+	return n, err
+}
+
+func (r *clientHelloRecorder) Write(p []byte) (int, error) {
+	if r.perspective == protocol.PerspectiveClient {
+		r.record(p)
+	}
+	return r.CryptoStreamConn.Write(p)
+}
+
+func (r *clientHelloRecorder) record(p []byte) {
+	if missing := recordHeaderLen + clientRandomOffset + 32 - len(r.data); missing > 0 {
+		r.data = append(r.data, p[:utils.Min(missing, len(p))]...)
+	}
+}
+
+func (r *clientHelloRecorder) ClientRandom() []byte {
+	if len(r.data) < recordHeaderLen {
+		return nil
+	}
+	return getClientRandom(r.data[recordHeaderLen:])
+}
+
 type mintController struct {
 	csc  *handshake.CryptoStreamConn
 	conn *mint.Conn
+
+	keyLog              io.Writer
+	clientHelloRecorder *clientHelloRecorder // only set if there's a key log
+
+	mutex sync.Mutex
+	// mint doesn't verify client certificates, see verifyClientCertificate
+	verifiedChains [][]*x509.Certificate
+	// mint doesn't export the server name, see serverNameRecorder
+	serverName string
 }
 
 var _ handshake.MintTLS = &mintController{}
+var _ crypto.KeyLogger = &mintController{}
 
+// newMintController creates a new mintController.
+// The mint.Config must have been generated from the tls.Config (see tlsToMintConfig), and must not be shared with other connections.
 func newMintController(
 	csc *handshake.CryptoStreamConn,
 	mconf *mint.Config,
+	tlsConf *tls.Config,
 	pers protocol.Perspective,
 ) handshake.MintTLS {
-	var conn *mint.Conn
+	mc := &mintController{csc: csc}
+	if tlsConf != nil {
+		mc.keyLog = tlsConf.KeyLogWriter
+		if pers == protocol.PerspectiveServer && tlsConf.ClientAuth == tls.RequireAndVerifyClientCert {
+			verifyPeerCertificate := mconf.VerifyPeerCertificate
+			mconf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				chains, err := verifyClientCertificate(tlsConf, rawCerts)
+				if err != nil {
+					return err
+				}
+				mc.mutex.Lock()
+				mc.verifiedChains = chains
+				mc.mutex.Unlock()
+				if verifyPeerCertificate != nil {
+					return verifyPeerCertificate(rawCerts, chains)
+				}
+				return nil
+			}
+		}
+	}
 	if pers == protocol.PerspectiveClient {
-		conn = mint.Client(csc, mconf)
+		mc.serverName = mconf.ServerName
 	} else {
-		conn = mint.Server(csc, mconf)
+		mconf.ExtensionHandler = &serverNameRecorder{AppExtensionHandler: mconf.ExtensionHandler, mc: mc}
 	}
-	return &mintController{
-		csc:  csc,
-		conn: conn,
+	var conn net.Conn = csc
+	if mc.keyLog != nil {
+		mc.clientHelloRecorder = &clientHelloRecorder{CryptoStreamConn: csc, perspective: pers}
+		conn = mc.clientHelloRecorder
 	}
+	if pers == protocol.PerspectiveClient {
+		mc.conn = mint.Client(conn, mconf)
+	} else {
+		mc.conn = mint.Server(conn, mconf)
+	}
+	return mc
 }
 
 func (mc *mintController) GetCipherSuite() mint.CipherSuiteParams {
@@ -58,13 +183,64 @@ func (mc *mintController) State() mint.State {
 }
 
 func (mc *mintController) ConnectionState() mint.ConnectionState {
-	return mc.conn.ConnectionState()
+	state := mc.conn.ConnectionState()
+	mc.mutex.Lock()
+	if mc.verifiedChains != nil {
+		state.VerifiedChains = mc.verifiedChains
+	}
+	mc.mutex.Unlock()
+	return state
+}
+
+// ServerName returns the server name sent by the client.
+// For the server, it is only available once the ClientHello was received.
+func (mc *mintController) ServerName() string {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	return mc.serverName
+}
+
+// GetKeyLog returns the key log that the 1-RTT secrets are written to.
+func (mc *mintController) GetKeyLog() (io.Writer, []byte) {
+	if mc.keyLog == nil {
+		return nil, nil
+	}
+	return mc.keyLog, mc.clientHelloRecorder.ClientRandom()
 }
 
 func (mc *mintController) SetCryptoStream(stream io.ReadWriter) {
 	mc.csc.SetStream(stream)
 }
 
+// A serverNameRecorder records the server name that the client sent in the ClientHello.
+// It passes all extensions to the extension handler of the mint.Config, if set.
+type serverNameRecorder struct {
+	mint.AppExtensionHandler
+	mc *mintController
+}
+
+func (r *serverNameRecorder) Send(hType mint.HandshakeType, el *mint.ExtensionList) error {
+	if r.AppExtensionHandler == nil {
+		return nil
+	}
+	return r.AppExtensionHandler.Send(hType, el)
+}
+
+func (r *serverNameRecorder) Receive(hType mint.HandshakeType, el *mint.ExtensionList) error {
+	if hType == mint.HandshakeTypeClientHello {
+		serverName := new(mint.ServerNameExtension)
+		if found, err := el.Find(serverName); err == nil && found {
+			r.mc.mutex.Lock()
+			r.mc.serverName = string(*serverName)
+			r.mc.mutex.Unlock()
+		}
+	}
+	if r.AppExtensionHandler == nil {
+		return nil
+	}
+	return r.AppExtensionHandler.Receive(hType, el)
+}
+
 func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Config, error) {
 	mconf := &mint.Config{
 		NonBlocking: true,
@@ -76,10 +252,21 @@ func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Conf
 	if tlsConf != nil {
 		mconf.ServerName = tlsConf.ServerName
 		mconf.InsecureSkipVerify = tlsConf.InsecureSkipVerify
-		mconf.Certificates = make([]*mint.Certificate, len(tlsConf.Certificates))
 		mconf.RootCAs = tlsConf.RootCAs
 		mconf.VerifyPeerCertificate = tlsConf.VerifyPeerCertificate
-		for i, certChain := range tlsConf.Certificates {
+		certificates := tlsConf.Certificates
+		// mint doesn't support selecting the client certificate during the handshake
+		if pers == protocol.PerspectiveClient && len(certificates) == 0 && tlsConf.GetClientCertificate != nil {
+			cert, err := tlsConf.GetClientCertificate(&tls.CertificateRequestInfo{})
+			if err != nil {
+				return nil, err
+			}
+			if cert != nil && len(cert.Certificate) > 0 {
+				certificates = []tls.Certificate{*cert}
+			}
+		}
+		mconf.Certificates = make([]*mint.Certificate, len(certificates))
+		for i, certChain := range certificates {
 			mconf.Certificates[i] = &mint.Certificate{
 				Chain:      make([]*x509.Certificate, len(certChain.Certificate)),
 				PrivateKey: certChain.PrivateKey.(gocrypto.Signer),
@@ -94,10 +281,11 @@ func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Conf
 		}
 		switch tlsConf.ClientAuth {
 		case tls.NoClientCert:
-		case tls.RequireAnyClientCert:
+		case tls.RequireAnyClientCert, tls.RequireAndVerifyClientCert:
+			// the certificate chain is verified by the mintController
 			mconf.RequireClientAuth = true
 		default:
-			return nil, errors.New("mint currently only support ClientAuthType RequireAnyClientCert")
+			return nil, errors.New("mint currently only supports ClientAuthType RequireAnyClientCert and RequireAndVerifyClientCert")
 		}
 	}
 	if err := mconf.Init(pers == protocol.PerspectiveClient); err != nil {
@@ -106,6 +294,34 @@ func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Conf
 	return mconf, nil
 }
 
+// verifyClientCertificate verifies the certificate chain presented by the client, using the ClientCAs of the tls.Config.
+// mint only checks that the client owns the private key of the certificate.
+func verifyClientCertificate(tlsConf *tls.Config, rawCerts [][]byte) ([][]*x509.Certificate, error) {
+	if len(rawCerts) == 0 {
+		return nil, errors.New("client didn't provide a certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, rawCert := range rawCerts {
+		cert, err := x509.ParseCertificate(rawCert)
+		if err != nil {
+			return nil, err
+		}
+		certs[i] = cert
+	}
+	opts := x509.VerifyOptions{
+		Roots:         tlsConf.ClientCAs,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if tlsConf.Time != nil {
+		opts.CurrentTime = tlsConf.Time()
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	return certs[0].Verify(opts)
+}
+
 // unpackInitialOrRetryPacket unpacks packets Initial and Retry packets
 // These packets must contain a STREAM_FRAME for the crypto stream, starting at offset 0.
 func unpackInitialPacket(aead crypto.AEAD, hdr *wire.Header, data []byte, logger utils.Logger, version protocol.VersionNumber) (*wire.StreamFrame, error) {
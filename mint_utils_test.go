@@ -2,11 +2,20 @@ package quic
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"math/big"
+	"net"
+	"time"
 
+	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/testdata"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -83,10 +92,244 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 			Expect(mintConf.RequireClientAuth).To(BeTrue())
 		})
 
-		It("rejects unsupported client auth types", func() {
+		It("requires client authentication, if the client certificate is verified", func() {
 			conf := &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}
+			mintConf, err := tlsToMintConfig(conf, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mintConf.RequireClientAuth).To(BeTrue())
+		})
+
+		It("rejects unsupported client auth types", func() {
+			conf := &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven}
+			_, err := tlsToMintConfig(conf, protocol.PerspectiveClient)
+			Expect(err).To(MatchError("mint currently only supports ClientAuthType RequireAnyClientCert and RequireAndVerifyClientCert"))
+		})
+
+		It("uses the certificate returned by GetClientCertificate", func() {
+			cert := testdata.GetCertificate()
+			conf := &tls.Config{
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &cert, nil
+				},
+			}
+			mintConf, err := tlsToMintConfig(conf, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mintConf.Certificates).To(HaveLen(1))
+			Expect(mintConf.Certificates[0].Chain[0].Raw).To(Equal(cert.Certificate[0]))
+		})
+
+		It("doesn't use a certificate if GetClientCertificate returns an empty certificate", func() {
+			conf := &tls.Config{
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &tls.Certificate{}, nil
+				},
+			}
+			mintConf, err := tlsToMintConfig(conf, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mintConf.Certificates).To(BeEmpty())
+		})
+
+		It("returns the error of GetClientCertificate", func() {
+			conf := &tls.Config{
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return nil, errors.New("no certificate")
+				},
+			}
 			_, err := tlsToMintConfig(conf, protocol.PerspectiveClient)
-			Expect(err).To(MatchError("mint currently only support ClientAuthType RequireAnyClientCert"))
+			Expect(err).To(MatchError("no certificate"))
+		})
+	})
+
+	Context("client authentication", func() {
+		var (
+			clientCAs  *x509.CertPool
+			clientCert tls.Certificate
+		)
+
+		BeforeEach(func() {
+			caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).ToNot(HaveOccurred())
+			caTemplate := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				Subject:               pkix.Name{CommonName: "client CA"},
+				NotBefore:             time.Now().Add(-time.Hour),
+				NotAfter:              time.Now().Add(time.Hour),
+				IsCA:                  true,
+				BasicConstraintsValid: true,
+				KeyUsage:              x509.KeyUsageCertSign,
+			}
+			caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+			Expect(err).ToNot(HaveOccurred())
+			ca, err := x509.ParseCertificate(caDER)
+			Expect(err).ToNot(HaveOccurred())
+			clientCAs = x509.NewCertPool()
+			clientCAs.AddCert(ca)
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).ToNot(HaveOccurred())
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(2),
+				Subject:      pkix.Name{CommonName: "client"},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}
+			certDER, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+			Expect(err).ToNot(HaveOccurred())
+			clientCert = tls.Certificate{Certificate: [][]byte{certDER}, PrivateKey: key}
+		})
+
+		It("verifies the client certificate", func() {
+			chains, err := verifyClientCertificate(&tls.Config{ClientCAs: clientCAs}, clientCert.Certificate)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chains).To(HaveLen(1))
+			Expect(chains[0]).To(HaveLen(2))
+			Expect(chains[0][1].Subject.CommonName).To(Equal("client CA"))
+		})
+
+		It("rejects a client certificate that wasn't issued by one of the ClientCAs", func() {
+			_, err := verifyClientCertificate(&tls.Config{ClientCAs: x509.NewCertPool()}, clientCert.Certificate)
+			Expect(err).To(BeAssignableToTypeOf(x509.UnknownAuthorityError{}))
+		})
+
+		It("uses the time of the tls.Config", func() {
+			conf := &tls.Config{
+				ClientCAs: clientCAs,
+				Time:      func() time.Time { return time.Now().Add(2 * time.Hour) },
+			}
+			_, err := verifyClientCertificate(conf, clientCert.Certificate)
+			Expect(err).To(BeAssignableToTypeOf(x509.CertificateInvalidError{}))
+		})
+
+		It("rejects an empty certificate chain", func() {
+			_, err := verifyClientCertificate(&tls.Config{ClientCAs: clientCAs}, nil)
+			Expect(err).To(MatchError("client didn't provide a certificate"))
+		})
+
+		// runHandshake runs the handshake between two mintControllers, and returns the server and the first alert it returned
+		runHandshake := func(clientTLSConf, serverTLSConf *tls.Config) (handshake.MintTLS, mint.Alert) {
+			clientConf, err := tlsToMintConfig(clientTLSConf, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			serverConf, err := tlsToMintConfig(serverTLSConf, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			client := newMintController(handshake.NewCryptoStreamConn(nil), clientConf, clientTLSConf, protocol.PerspectiveClient)
+			server := newMintController(handshake.NewCryptoStreamConn(nil), serverConf, serverTLSConf, protocol.PerspectiveServer)
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+			defer serverConn.Close()
+			client.SetCryptoStream(clientConn)
+			server.SetCryptoStream(serverConn)
+			go func() {
+				defer GinkgoRecover()
+				for {
+					if alert := client.Handshake(); alert != mint.AlertNoAlert && alert != mint.AlertWouldBlock {
+						return
+					}
+					if client.State() == mint.StateClientConnected {
+						return
+					}
+				}
+			}()
+			for {
+				if alert := server.Handshake(); alert != mint.AlertNoAlert && alert != mint.AlertWouldBlock {
+					return server, alert
+				}
+				if server.State() == mint.StateServerConnected {
+					return server, mint.AlertNoAlert
+				}
+			}
+		}
+
+		It("exposes the verified chains", func() {
+			var verifiedChains [][]*x509.Certificate
+			serverConf := testdata.GetTLSConfig()
+			serverConf.ClientAuth = tls.RequireAndVerifyClientCert
+			serverConf.ClientCAs = clientCAs
+			serverConf.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+				verifiedChains = chains
+				return nil
+			}
+			server, alert := runHandshake(
+				&tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true, Certificates: []tls.Certificate{clientCert}},
+				serverConf,
+			)
+			Expect(alert).To(Equal(mint.AlertNoAlert))
+			Expect(verifiedChains).To(HaveLen(1))
+			Expect(server.ConnectionState().VerifiedChains).To(Equal(verifiedChains))
+			Expect(server.ConnectionState().PeerCertificates[0].Raw).To(Equal(clientCert.Certificate[0]))
+		})
+
+		It("exposes the server name sent in the ClientHello", func() {
+			server, alert := runHandshake(&tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true}, testdata.GetTLSConfig())
+			Expect(alert).To(Equal(mint.AlertNoAlert))
+			Expect(server.ServerName()).To(Equal("quic.clemente.io"))
+		})
+
+		It("rejects a client certificate that can't be verified", func() {
+			serverConf := testdata.GetTLSConfig()
+			serverConf.ClientAuth = tls.RequireAndVerifyClientCert
+			serverConf.ClientCAs = x509.NewCertPool()
+			server, alert := runHandshake(
+				&tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true, Certificates: []tls.Certificate{clientCert}},
+				serverConf,
+			)
+			Expect(alert).To(Equal(mint.AlertBadCertificate))
+			Expect(server.ConnectionState().VerifiedChains).To(BeNil())
+		})
+
+		It("doesn't verify the client certificate for RequireAnyClientCert", func() {
+			serverConf := testdata.GetTLSConfig()
+			serverConf.ClientAuth = tls.RequireAnyClientCert
+			server, alert := runHandshake(
+				&tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true, Certificates: []tls.Certificate{clientCert}},
+				serverConf,
+			)
+			Expect(alert).To(Equal(mint.AlertNoAlert))
+			Expect(server.ConnectionState().VerifiedChains).To(BeNil())
+			Expect(server.ConnectionState().PeerCertificates).To(HaveLen(1))
+		})
+	})
+
+	Context("key logging", func() {
+		It("gets the client random from the ClientHello", func() {
+			keyLog := &bytes.Buffer{}
+			clientConf, err := tlsToMintConfig(&tls.Config{ServerName: "localhost"}, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			clientCSC := handshake.NewCryptoStreamConn(nil)
+			client := newMintController(clientCSC, clientConf, &tls.Config{KeyLogWriter: keyLog}, protocol.PerspectiveClient)
+			Expect(client.Handshake()).To(Equal(mint.AlertNoAlert))
+			w, clientRandom := client.(crypto.KeyLogger).GetKeyLog()
+			Expect(w).To(Equal(keyLog))
+			Expect(clientRandom).To(HaveLen(32))
+			Expect(clientRandom).ToNot(Equal(make([]byte, 32)))
+
+			serverConf, err := tlsToMintConfig(testdata.GetTLSConfig(), protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			serverCSC := handshake.NewCryptoStreamConn(nil)
+			serverCSC.AddDataForReading(clientCSC.GetDataForWriting())
+			server := newMintController(serverCSC, serverConf, &tls.Config{KeyLogWriter: keyLog}, protocol.PerspectiveServer)
+			server.Handshake()
+			_, serverClientRandom := server.(crypto.KeyLogger).GetKeyLog()
+			Expect(serverClientRandom).To(Equal(clientRandom))
+		})
+
+		It("doesn't return a key log if there's no KeyLogWriter", func() {
+			conf, err := tlsToMintConfig(&tls.Config{ServerName: "localhost"}, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			client := newMintController(handshake.NewCryptoStreamConn(nil), conf, nil, protocol.PerspectiveClient)
+			Expect(client.Handshake()).To(Equal(mint.AlertNoAlert))
+			w, clientRandom := client.(crypto.KeyLogger).GetKeyLog()
+			Expect(w).To(BeNil())
+			Expect(clientRandom).To(BeNil())
+		})
+
+		It("only gets the client random from a ClientHello", func() {
+			msg := make([]byte, 4+2+32)
+			msg[0] = byte(mint.HandshakeTypeServerHello)
+			Expect(getClientRandom(msg)).To(BeNil())
+			msg[0] = byte(mint.HandshakeTypeClientHello)
+			Expect(getClientRandom(msg)).To(HaveLen(32))
+			Expect(getClientRandom(msg[:37])).To(BeNil())
 		})
 	})
 
@@ -83,6 +83,18 @@ func (mr *MockCryptoStreamMockRecorder) closeForShutdown(arg0 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeForShutdown", reflect.TypeOf((*MockCryptoStream)(nil).closeForShutdown), arg0)
 }
 
+// getReceiveWindow mocks base method
+func (m *MockCryptoStream) getReceiveWindow() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "getReceiveWindow")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// getReceiveWindow indicates an expected call of getReceiveWindow
+func (mr *MockCryptoStreamMockRecorder) getReceiveWindow() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getReceiveWindow", reflect.TypeOf((*MockCryptoStream)(nil).getReceiveWindow))
+}
+
 // getWindowUpdate mocks base method
 func (m *MockCryptoStream) getWindowUpdate() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "getWindowUpdate")
@@ -61,6 +61,28 @@ func (mr *MockReceiveStreamIMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockReceiveStreamI)(nil).Read), arg0)
 }
 
+// ReadTerminationReason mocks base method
+func (m *MockReceiveStreamI) ReadTerminationReason() StreamTerminationReason {
+	ret := m.ctrl.Call(m, "ReadTerminationReason")
+	ret0, _ := ret[0].(StreamTerminationReason)
+	return ret0
+}
+
+// ReadTerminationReason indicates an expected call of ReadTerminationReason
+func (mr *MockReceiveStreamIMockRecorder) ReadTerminationReason() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadTerminationReason", reflect.TypeOf((*MockReceiveStreamI)(nil).ReadTerminationReason))
+}
+
+// ReleaseCredit mocks base method
+func (m *MockReceiveStreamI) ReleaseCredit(arg0 int) {
+	m.ctrl.Call(m, "ReleaseCredit", arg0)
+}
+
+// ReleaseCredit indicates an expected call of ReleaseCredit
+func (mr *MockReceiveStreamIMockRecorder) ReleaseCredit(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseCredit", reflect.TypeOf((*MockReceiveStreamI)(nil).ReleaseCredit), arg0)
+}
+
 // SetReadDeadline mocks base method
 func (m *MockReceiveStreamI) SetReadDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetReadDeadline", arg0)
@@ -95,6 +117,18 @@ func (mr *MockReceiveStreamIMockRecorder) closeForShutdown(arg0 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeForShutdown", reflect.TypeOf((*MockReceiveStreamI)(nil).closeForShutdown), arg0)
 }
 
+// getReceiveWindow mocks base method
+func (m *MockReceiveStreamI) getReceiveWindow() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "getReceiveWindow")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// getReceiveWindow indicates an expected call of getReceiveWindow
+func (mr *MockReceiveStreamIMockRecorder) getReceiveWindow() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getReceiveWindow", reflect.TypeOf((*MockReceiveStreamI)(nil).getReceiveWindow))
+}
+
 // getWindowUpdate mocks base method
 func (m *MockReceiveStreamI) getWindowUpdate() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "getWindowUpdate")
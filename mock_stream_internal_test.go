@@ -6,6 +6,7 @@ package quic
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
 	time "time"
 
@@ -98,6 +99,41 @@ func (mr *MockStreamIMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockStreamI)(nil).Read), arg0)
 }
 
+// ReadFrom mocks base method
+func (m *MockStreamI) ReadFrom(arg0 io.Reader) (int64, error) {
+	ret := m.ctrl.Call(m, "ReadFrom", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadFrom indicates an expected call of ReadFrom
+func (mr *MockStreamIMockRecorder) ReadFrom(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadFrom", reflect.TypeOf((*MockStreamI)(nil).ReadFrom), arg0)
+}
+
+// ReadTerminationReason mocks base method
+func (m *MockStreamI) ReadTerminationReason() StreamTerminationReason {
+	ret := m.ctrl.Call(m, "ReadTerminationReason")
+	ret0, _ := ret[0].(StreamTerminationReason)
+	return ret0
+}
+
+// ReadTerminationReason indicates an expected call of ReadTerminationReason
+func (mr *MockStreamIMockRecorder) ReadTerminationReason() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadTerminationReason", reflect.TypeOf((*MockStreamI)(nil).ReadTerminationReason))
+}
+
+// ReleaseCredit mocks base method
+func (m *MockStreamI) ReleaseCredit(arg0 int) {
+	m.ctrl.Call(m, "ReleaseCredit", arg0)
+}
+
+// ReleaseCredit indicates an expected call of ReleaseCredit
+func (mr *MockStreamIMockRecorder) ReleaseCredit(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseCredit", reflect.TypeOf((*MockStreamI)(nil).ReleaseCredit), arg0)
+}
+
 // SetDeadline mocks base method
 func (m *MockStreamI) SetDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetDeadline", arg0)
@@ -110,6 +146,16 @@ func (mr *MockStreamIMockRecorder) SetDeadline(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeadline", reflect.TypeOf((*MockStreamI)(nil).SetDeadline), arg0)
 }
 
+// SetPriority mocks base method
+func (m *MockStreamI) SetPriority(arg0 int) {
+	m.ctrl.Call(m, "SetPriority", arg0)
+}
+
+// SetPriority indicates an expected call of SetPriority
+func (mr *MockStreamIMockRecorder) SetPriority(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPriority", reflect.TypeOf((*MockStreamI)(nil).SetPriority), arg0)
+}
+
 // SetReadDeadline mocks base method
 func (m *MockStreamI) SetReadDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetReadDeadline", arg0)
@@ -169,6 +215,43 @@ func (mr *MockStreamIMockRecorder) closeForShutdown(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeForShutdown", reflect.TypeOf((*MockStreamI)(nil).closeForShutdown), arg0)
 }
 
+// exportState mocks base method
+func (m *MockStreamI) exportState() (*streamState, error) {
+	ret := m.ctrl.Call(m, "exportState")
+	ret0, _ := ret[0].(*streamState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// exportState indicates an expected call of exportState
+func (mr *MockStreamIMockRecorder) exportState() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "exportState", reflect.TypeOf((*MockStreamI)(nil).exportState))
+}
+
+// getPriority mocks base method
+func (m *MockStreamI) getPriority() uint8 {
+	ret := m.ctrl.Call(m, "getPriority")
+	ret0, _ := ret[0].(uint8)
+	return ret0
+}
+
+// getPriority indicates an expected call of getPriority
+func (mr *MockStreamIMockRecorder) getPriority() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getPriority", reflect.TypeOf((*MockStreamI)(nil).getPriority))
+}
+
+// getReceiveWindow mocks base method
+func (m *MockStreamI) getReceiveWindow() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "getReceiveWindow")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// getReceiveWindow indicates an expected call of getReceiveWindow
+func (mr *MockStreamIMockRecorder) getReceiveWindow() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getReceiveWindow", reflect.TypeOf((*MockStreamI)(nil).getReceiveWindow))
+}
+
 // getWindowUpdate mocks base method
 func (m *MockStreamI) getWindowUpdate() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "getWindowUpdate")
@@ -225,6 +308,16 @@ func (mr *MockStreamIMockRecorder) handleStreamFrame(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStreamFrame", reflect.TypeOf((*MockStreamI)(nil).handleStreamFrame), arg0)
 }
 
+// importState mocks base method
+func (m *MockStreamI) importState(arg0 *streamState) {
+	m.ctrl.Call(m, "importState", arg0)
+}
+
+// importState indicates an expected call of importState
+func (mr *MockStreamIMockRecorder) importState(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "importState", reflect.TypeOf((*MockStreamI)(nil).importState), arg0)
+}
+
 // popStreamFrame mocks base method
 func (m *MockStreamI) popStreamFrame(arg0 protocol.ByteCount) (*wire.StreamFrame, bool) {
 	ret := m.ctrl.Call(m, "popStreamFrame", arg0)
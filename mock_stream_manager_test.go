@@ -5,6 +5,7 @@
 package quic
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -37,29 +38,29 @@ func (m *MockStreamManager) EXPECT() *MockStreamManagerMockRecorder {
 }
 
 // AcceptStream mocks base method
-func (m *MockStreamManager) AcceptStream() (Stream, error) {
-	ret := m.ctrl.Call(m, "AcceptStream")
+func (m *MockStreamManager) AcceptStream(arg0 context.Context) (Stream, error) {
+	ret := m.ctrl.Call(m, "AcceptStream", arg0)
 	ret0, _ := ret[0].(Stream)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AcceptStream indicates an expected call of AcceptStream
-func (mr *MockStreamManagerMockRecorder) AcceptStream() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptStream", reflect.TypeOf((*MockStreamManager)(nil).AcceptStream))
+func (mr *MockStreamManagerMockRecorder) AcceptStream(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptStream", reflect.TypeOf((*MockStreamManager)(nil).AcceptStream), arg0)
 }
 
 // AcceptUniStream mocks base method
-func (m *MockStreamManager) AcceptUniStream() (ReceiveStream, error) {
-	ret := m.ctrl.Call(m, "AcceptUniStream")
+func (m *MockStreamManager) AcceptUniStream(arg0 context.Context) (ReceiveStream, error) {
+	ret := m.ctrl.Call(m, "AcceptUniStream", arg0)
 	ret0, _ := ret[0].(ReceiveStream)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AcceptUniStream indicates an expected call of AcceptUniStream
-func (mr *MockStreamManagerMockRecorder) AcceptUniStream() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptUniStream", reflect.TypeOf((*MockStreamManager)(nil).AcceptUniStream))
+func (mr *MockStreamManagerMockRecorder) AcceptUniStream(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptUniStream", reflect.TypeOf((*MockStreamManager)(nil).AcceptUniStream), arg0)
 }
 
 // CloseWithError mocks base method
@@ -111,10 +112,11 @@ func (mr *MockStreamManagerMockRecorder) GetOrOpenSendStream(arg0 interface{}) *
 }
 
 // HandleMaxStreamIDFrame mocks base method
-func (m *MockStreamManager) HandleMaxStreamIDFrame(arg0 *wire.MaxStreamIDFrame) error {
+func (m *MockStreamManager) HandleMaxStreamIDFrame(arg0 *wire.MaxStreamIDFrame) (bool, error) {
 	ret := m.ctrl.Call(m, "HandleMaxStreamIDFrame", arg0)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // HandleMaxStreamIDFrame indicates an expected call of HandleMaxStreamIDFrame
@@ -136,16 +138,16 @@ func (mr *MockStreamManagerMockRecorder) OpenStream() *gomock.Call {
 }
 
 // OpenStreamSync mocks base method
-func (m *MockStreamManager) OpenStreamSync() (Stream, error) {
-	ret := m.ctrl.Call(m, "OpenStreamSync")
+func (m *MockStreamManager) OpenStreamSync(arg0 context.Context) (Stream, error) {
+	ret := m.ctrl.Call(m, "OpenStreamSync", arg0)
 	ret0, _ := ret[0].(Stream)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // OpenStreamSync indicates an expected call of OpenStreamSync
-func (mr *MockStreamManagerMockRecorder) OpenStreamSync() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenStreamSync", reflect.TypeOf((*MockStreamManager)(nil).OpenStreamSync))
+func (mr *MockStreamManagerMockRecorder) OpenStreamSync(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenStreamSync", reflect.TypeOf((*MockStreamManager)(nil).OpenStreamSync), arg0)
 }
 
 // OpenUniStream mocks base method
@@ -162,16 +164,29 @@ func (mr *MockStreamManagerMockRecorder) OpenUniStream() *gomock.Call {
 }
 
 // OpenUniStreamSync mocks base method
-func (m *MockStreamManager) OpenUniStreamSync() (SendStream, error) {
-	ret := m.ctrl.Call(m, "OpenUniStreamSync")
+func (m *MockStreamManager) OpenUniStreamSync(arg0 context.Context) (SendStream, error) {
+	ret := m.ctrl.Call(m, "OpenUniStreamSync", arg0)
 	ret0, _ := ret[0].(SendStream)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // OpenUniStreamSync indicates an expected call of OpenUniStreamSync
-func (mr *MockStreamManagerMockRecorder) OpenUniStreamSync() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockStreamManager)(nil).OpenUniStreamSync))
+func (mr *MockStreamManagerMockRecorder) OpenUniStreamSync(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockStreamManager)(nil).OpenUniStreamSync), arg0)
+}
+
+// StreamLimits mocks base method
+func (m *MockStreamManager) StreamLimits() (protocol.StreamID, protocol.StreamID) {
+	ret := m.ctrl.Call(m, "StreamLimits")
+	ret0, _ := ret[0].(protocol.StreamID)
+	ret1, _ := ret[1].(protocol.StreamID)
+	return ret0, ret1
+}
+
+// StreamLimits indicates an expected call of StreamLimits
+func (mr *MockStreamManagerMockRecorder) StreamLimits() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamLimits", reflect.TypeOf((*MockStreamManager)(nil).StreamLimits))
 }
 
 // UpdateLimits mocks base method
@@ -183,3 +198,28 @@ func (m *MockStreamManager) UpdateLimits(arg0 *handshake.TransportParameters) {
 func (mr *MockStreamManagerMockRecorder) UpdateLimits(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLimits", reflect.TypeOf((*MockStreamManager)(nil).UpdateLimits), arg0)
 }
+
+// exportState mocks base method
+func (m *MockStreamManager) exportState() (*streamsMapState, error) {
+	ret := m.ctrl.Call(m, "exportState")
+	ret0, _ := ret[0].(*streamsMapState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// exportState indicates an expected call of exportState
+func (mr *MockStreamManagerMockRecorder) exportState() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "exportState", reflect.TypeOf((*MockStreamManager)(nil).exportState))
+}
+
+// importState mocks base method
+func (m *MockStreamManager) importState(arg0 *streamsMapState) []Stream {
+	ret := m.ctrl.Call(m, "importState", arg0)
+	ret0, _ := ret[0].([]Stream)
+	return ret0
+}
+
+// importState indicates an expected call of importState
+func (mr *MockStreamManagerMockRecorder) importState(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "importState", reflect.TypeOf((*MockStreamManager)(nil).importState), arg0)
+}
@@ -0,0 +1,115 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+const (
+	// maxMTUProbes is the number of probes of a size that are lost before we assume that the path doesn't support this size
+	maxMTUProbes = 3
+	// mtuProbeDelay is the time between two probes, in multiples of the smoothed RTT
+	mtuProbeDelay = 5
+	// mtuSearchPrecision is the precision of the binary search.
+	// We stop probing when the largest size that might work is less than mtuSearchPrecision bytes larger than the largest size known to work.
+	mtuSearchPrecision = 20
+	// defaultMTUProbeRTT is used to calculate the probe delay if no RTT sample is available
+	defaultMTUProbeRTT = 100 * time.Millisecond
+)
+
+// The mtuDiscoverer implements Datagram Packetization Layer Path MTU Discovery (DPLPMTUD, RFC 8899).
+// It periodically sends PING frames padded to a probe size, and uses a binary search to find the largest size supported by the path.
+// It must only be used after the handshake completed.
+type mtuDiscoverer struct {
+	rttStats *congestion.RTTStats
+	// onIncrease is called when a probe was acknowledged
+	onIncrease func(protocol.ByteCount)
+
+	current protocol.ByteCount // the largest packet size that is known to work
+	max     protocol.ByteCount // the largest packet size that might work
+
+	lastProbeTime time.Time
+	numProbesLost int // the number of probes of the current probe size that were lost
+
+	// the probe that is currently in flight. probeSize is 0 if there's no probe in flight.
+	probePacketNumber protocol.PacketNumber
+	probeSize         protocol.ByteCount
+}
+
+func newMTUDiscoverer(
+	rttStats *congestion.RTTStats,
+	start protocol.ByteCount,
+	max protocol.ByteCount,
+	onIncrease func(protocol.ByteCount),
+	now time.Time,
+) *mtuDiscoverer {
+	return &mtuDiscoverer{
+		rttStats:      rttStats,
+		onIncrease:    onIncrease,
+		current:       start,
+		max:           max,
+		lastProbeTime: now,
+	}
+}
+
+func (d *mtuDiscoverer) done() bool {
+	return d.max < d.current+mtuSearchPrecision
+}
+
+// NextProbeTime returns the time when the next probe should be sent.
+// It returns the zero time if no probe needs to be sent.
+func (d *mtuDiscoverer) NextProbeTime() time.Time {
+	if d.probeSize != 0 || d.done() {
+		return time.Time{}
+	}
+	rtt := d.rttStats.SmoothedRTT()
+	if rtt == 0 {
+		rtt = defaultMTUProbeRTT
+	}
+	return d.lastProbeTime.Add(mtuProbeDelay * rtt)
+}
+
+// ShouldSendProbe says if a probe should be sent now
+func (d *mtuDiscoverer) ShouldSendProbe(now time.Time) bool {
+	next := d.NextProbeTime()
+	return !next.IsZero() && !now.Before(next)
+}
+
+// ProbeSize returns the size of the next probe packet
+func (d *mtuDiscoverer) ProbeSize() protocol.ByteCount {
+	return (d.current + d.max + 1) / 2
+}
+
+// SentProbe is called when a probe packet was sent
+func (d *mtuDiscoverer) SentProbe(pn protocol.PacketNumber, size protocol.ByteCount, now time.Time) {
+	d.probePacketNumber = pn
+	d.probeSize = size
+	d.lastProbeTime = now
+}
+
+// ReceivedAck is called for every ACK frame received for forward-secure packets.
+// A probe is considered lost if the ACK acknowledges a later packet, but not the probe.
+func (d *mtuDiscoverer) ReceivedAck(ack *wire.AckFrame) {
+	if d.probeSize == 0 {
+		return
+	}
+	if ack.AcksPacket(d.probePacketNumber) {
+		d.current = d.probeSize
+		d.probeSize = 0
+		d.numProbesLost = 0
+		d.onIncrease(d.current)
+		return
+	}
+	if ack.LargestAcked() <= d.probePacketNumber {
+		return
+	}
+	d.numProbesLost++
+	if d.numProbesLost >= maxMTUProbes {
+		d.max = d.probeSize - 1
+		d.numProbesLost = 0
+	}
+	d.probeSize = 0
+}
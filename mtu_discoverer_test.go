@@ -0,0 +1,116 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MTU Discoverer", func() {
+	var (
+		d         *mtuDiscoverer
+		rttStats  *congestion.RTTStats
+		increased []protocol.ByteCount
+		now       time.Time
+	)
+	const rtt = 100 * time.Millisecond
+
+	ackFor := func(pns ...protocol.PacketNumber) *wire.AckFrame {
+		ack := &wire.AckFrame{}
+		for i := len(pns) - 1; i >= 0; i-- {
+			ack.AckRanges = append(ack.AckRanges, wire.AckRange{Smallest: pns[i], Largest: pns[i]})
+		}
+		return ack
+	}
+
+	BeforeEach(func() {
+		rttStats = &congestion.RTTStats{}
+		rttStats.UpdateRTT(rtt, 0, time.Now())
+		Expect(rttStats.SmoothedRTT()).To(Equal(rtt))
+		increased = nil
+		now = time.Now()
+		d = newMTUDiscoverer(rttStats, 1000, 2000, func(s protocol.ByteCount) { increased = append(increased, s) }, now)
+	})
+
+	It("waits before sending the first probe", func() {
+		Expect(d.NextProbeTime()).To(Equal(now.Add(mtuProbeDelay * rtt)))
+		Expect(d.ShouldSendProbe(now)).To(BeFalse())
+		Expect(d.ShouldSendProbe(now.Add(mtuProbeDelay * rtt))).To(BeTrue())
+	})
+
+	It("uses a default RTT if no RTT sample is available", func() {
+		d = newMTUDiscoverer(&congestion.RTTStats{}, 1000, 2000, func(protocol.ByteCount) {}, now)
+		Expect(d.NextProbeTime()).To(Equal(now.Add(mtuProbeDelay * defaultMTUProbeRTT)))
+	})
+
+	It("doesn't send a probe while another probe is in flight", func() {
+		Expect(d.ProbeSize()).To(Equal(protocol.ByteCount(1500)))
+		d.SentProbe(10, 1500, now)
+		Expect(d.NextProbeTime()).To(BeZero())
+		Expect(d.ShouldSendProbe(now.Add(time.Hour))).To(BeFalse())
+	})
+
+	It("increases the packet size when a probe is acknowledged", func() {
+		d.SentProbe(10, 1500, now)
+		d.ReceivedAck(ackFor(8, 9, 10))
+		Expect(increased).To(Equal([]protocol.ByteCount{1500}))
+		Expect(d.NextProbeTime()).To(Equal(now.Add(mtuProbeDelay * rtt)))
+		Expect(d.ProbeSize()).To(Equal(protocol.ByteCount(1750)))
+	})
+
+	It("ignores ACKs that don't acknowledge packets sent after the probe", func() {
+		d.SentProbe(10, 1500, now)
+		d.ReceivedAck(ackFor(8, 9))
+		Expect(d.NextProbeTime()).To(BeZero())
+		Expect(increased).To(BeEmpty())
+	})
+
+	It("retries a lost probe", func() {
+		d.SentProbe(10, 1500, now)
+		d.ReceivedAck(ackFor(11))
+		Expect(increased).To(BeEmpty())
+		Expect(d.NextProbeTime()).To(Equal(now.Add(mtuProbeDelay * rtt)))
+		Expect(d.ProbeSize()).To(Equal(protocol.ByteCount(1500)))
+	})
+
+	It("reduces the probe size after losing multiple probes", func() {
+		for i := 0; i < maxMTUProbes; i++ {
+			Expect(d.ProbeSize()).To(Equal(protocol.ByteCount(1500)))
+			pn := protocol.PacketNumber(10 * (i + 1))
+			d.SentProbe(pn, 1500, now)
+			d.ReceivedAck(ackFor(pn + 1))
+		}
+		Expect(d.ProbeSize()).To(Equal(protocol.ByteCount(1250)))
+		Expect(increased).To(BeEmpty())
+	})
+
+	It("finds the path MTU", func() {
+		const pathMTU = 1337
+		var pn protocol.PacketNumber
+		for !d.NextProbeTime().IsZero() {
+			pn++
+			size := d.ProbeSize()
+			d.SentProbe(pn, size, now)
+			pn++
+			if size <= pathMTU {
+				d.ReceivedAck(ackFor(pn-1, pn))
+			} else {
+				d.ReceivedAck(ackFor(pn))
+			}
+		}
+		Expect(increased).ToNot(BeEmpty())
+		current := increased[len(increased)-1]
+		Expect(current).To(BeNumerically("<=", pathMTU))
+		Expect(current).To(BeNumerically(">", pathMTU-mtuSearchPrecision))
+	})
+
+	It("doesn't probe if the max size is reached", func() {
+		d = newMTUDiscoverer(rttStats, 1252, 1260, func(protocol.ByteCount) {}, now)
+		Expect(d.NextProbeTime()).To(BeZero())
+	})
+})
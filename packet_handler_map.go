@@ -0,0 +1,112 @@
+package quic
+
+import (
+	"hash/maphash"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// The packetHandlerMap maps connection IDs to the sessions they belong to.
+// It is split into shards, each protected by its own mutex,
+// so that packets for different sessions can be routed concurrently, without contending for a single lock.
+// A connection ID can be mapped to a nil packetHandler, to remember that the session using it was closed.
+type packetHandlerMap struct {
+	// The seed is chosen randomly, so that a client can't choose connection IDs that all end up in the same shard.
+	seed   maphash.Seed
+	shards []packetHandlerMapShard
+}
+
+type packetHandlerMapShard struct {
+	mutex    sync.RWMutex
+	handlers map[string] /* string(ConnectionID)*/ packetHandler
+}
+
+func newPacketHandlerMap(numShards int) *packetHandlerMap {
+	m := &packetHandlerMap{
+		seed:   maphash.MakeSeed(),
+		shards: make([]packetHandlerMapShard, numShards),
+	}
+	for i := range m.shards {
+		m.shards[i].handlers = make(map[string]packetHandler)
+	}
+	return m
+}
+
+func (m *packetHandlerMap) shard(id protocol.ConnectionID) *packetHandlerMapShard {
+	return &m.shards[maphash.Bytes(m.seed, id)%uint64(len(m.shards))]
+}
+
+// Get returns the packetHandler that a connection ID is mapped to.
+// The second return value is true if the connection ID is known, even if its session was already closed.
+func (m *packetHandlerMap) Get(id protocol.ConnectionID) (packetHandler, bool) {
+	s := m.shard(id)
+	s.mutex.RLock()
+	handler, ok := s.handlers[string(id)]
+	s.mutex.RUnlock()
+	return handler, ok
+}
+
+// Add maps a connection ID to a packetHandler, unless the connection ID is already known.
+// It returns false if the connection ID was already known.
+func (m *packetHandlerMap) Add(id protocol.ConnectionID, handler packetHandler) bool {
+	s := m.shard(id)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.handlers[string(id)]; ok {
+		return false
+	}
+	s.handlers[string(id)] = handler
+	return true
+}
+
+// Set maps a connection ID to a packetHandler, replacing the packetHandler it was mapped to before.
+func (m *packetHandlerMap) Set(id protocol.ConnectionID, handler packetHandler) {
+	s := m.shard(id)
+	s.mutex.Lock()
+	s.handlers[string(id)] = handler
+	s.mutex.Unlock()
+}
+
+// Remove removes a connection ID.
+func (m *packetHandlerMap) Remove(id protocol.ConnectionID) {
+	s := m.shard(id)
+	s.mutex.Lock()
+	delete(s.handlers, string(id))
+	s.mutex.Unlock()
+}
+
+// Handlers returns all packetHandlers.
+// A packetHandler that is mapped to by multiple connection IDs is only returned once.
+func (m *packetHandlerMap) Handlers() []packetHandler {
+	seen := make(map[packetHandler]struct{})
+	var handlers []packetHandler
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mutex.RLock()
+		for _, handler := range s.handlers {
+			if handler == nil {
+				continue
+			}
+			if _, ok := seen[handler]; ok {
+				continue
+			}
+			seen[handler] = struct{}{}
+			handlers = append(handlers, handler)
+		}
+		s.mutex.RUnlock()
+	}
+	return handlers
+}
+
+// Len returns the number of connection IDs, including the ones of closed sessions.
+func (m *packetHandlerMap) Len() int {
+	var n int
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mutex.RLock()
+		n += len(s.handlers)
+		s.mutex.RUnlock()
+	}
+	return n
+}
@@ -0,0 +1,139 @@
+package quic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Packet Handler Map", func() {
+	var m *packetHandlerMap
+
+	BeforeEach(func() {
+		m = newPacketHandlerMap(4)
+	})
+
+	It("adds and gets packet handlers", func() {
+		sess := &mockSession{}
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		Expect(m.Add(connID, sess)).To(BeTrue())
+		h, ok := m.Get(connID)
+		Expect(ok).To(BeTrue())
+		Expect(h).To(Equal(sess))
+		_, ok = m.Get(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1})
+		Expect(ok).To(BeFalse())
+	})
+
+	It("doesn't add a connection ID twice", func() {
+		sess1 := &mockSession{}
+		sess2 := &mockSession{}
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		Expect(m.Add(connID, sess1)).To(BeTrue())
+		Expect(m.Add(connID, sess2)).To(BeFalse())
+		h, _ := m.Get(connID)
+		Expect(h).To(Equal(sess1))
+	})
+
+	It("remembers connection IDs of closed sessions", func() {
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		m.Set(connID, &mockSession{})
+		m.Set(connID, nil)
+		h, ok := m.Get(connID)
+		Expect(ok).To(BeTrue())
+		Expect(h).To(BeNil())
+		Expect(m.Add(connID, &mockSession{})).To(BeFalse())
+		m.Remove(connID)
+		_, ok = m.Get(connID)
+		Expect(ok).To(BeFalse())
+		Expect(m.Len()).To(BeZero())
+	})
+
+	It("returns every packet handler once", func() {
+		sess1 := &mockSession{}
+		sess2 := &mockSession{}
+		for i := byte(0); i < 100; i++ {
+			m.Set(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, i}, sess1)
+		}
+		m.Set(protocol.ConnectionID{1}, sess2)
+		m.Set(protocol.ConnectionID{2}, nil)
+		Expect(m.Len()).To(Equal(102))
+		Expect(m.Handlers()).To(ConsistOf(sess1, sess2))
+	})
+
+	It("distributes the connection IDs over the shards", func() {
+		for i := byte(0); i < 100; i++ {
+			m.Set(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, i}, &mockSession{})
+		}
+		for i := range m.shards {
+			Expect(m.shards[i].handlers).ToNot(BeEmpty())
+		}
+	})
+
+	It("is safe for concurrent use", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i byte) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for j := byte(0); j < 100; j++ {
+					connID := protocol.ConnectionID{i, j}
+					sess := &mockSession{}
+					Expect(m.Add(connID, sess)).To(BeTrue())
+					h, _ := m.Get(connID)
+					Expect(h).To(Equal(sess))
+					m.Handlers()
+				}
+			}(byte(i))
+		}
+		wg.Wait()
+		Expect(m.Len()).To(Equal(1000))
+	})
+})
+
+// BenchmarkPacketHandlerMap looks up the sessions of incoming packets from multiple go routines,
+// while sessions are added and removed, like a server with many concurrent sessions does.
+// With a single shard, all lookups contend for the same lock.
+func BenchmarkPacketHandlerMap(b *testing.B) {
+	const numSessions = 100000
+
+	connIDs := make([]protocol.ConnectionID, numSessions)
+	for i := range connIDs {
+		connIDs[i] = make(protocol.ConnectionID, protocol.DefaultConnectionIDLength)
+		binary.BigEndian.PutUint64(connIDs[i], uint64(i)*0x9e3779b97f4a7c15)
+	}
+
+	run := func(b *testing.B, numShards int) {
+		m := newPacketHandlerMap(numShards)
+		for _, connID := range connIDs {
+			m.Set(connID, &mockSession{})
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			var i int
+			for pb.Next() {
+				connID := connIDs[i%numSessions]
+				i++
+				// one in 100 packets belongs to a new session
+				if i%100 == 0 {
+					m.Set(connID, &mockSession{})
+					continue
+				}
+				if _, ok := m.Get(connID); !ok {
+					b.Fatal("session not found")
+				}
+			}
+		})
+	}
+
+	for _, numShards := range []int{1, protocol.PacketHandlerMapShards} {
+		b.Run(fmt.Sprintf("%d shards", numShards), func(b *testing.B) { run(b, numShards) })
+	}
+}
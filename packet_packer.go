@@ -20,6 +20,8 @@ type packedPacket struct {
 	raw             []byte
 	frames          []wire.Frame
 	encryptionLevel protocol.EncryptionLevel
+	// containsRetransmission is set if the packet contains frames of a lost packet
+	containsRetransmission bool
 }
 
 func (p *packedPacket) ToAckHandlerPacket() *ackhandler.Packet {
@@ -30,6 +32,8 @@ func (p *packedPacket) ToAckHandlerPacket() *ackhandler.Packet {
 		Length:          protocol.ByteCount(len(p.raw)),
 		EncryptionLevel: p.encryptionLevel,
 		SendTime:        time.Now(),
+
+		ContainsRetransmission: p.containsRetransmission,
 	}
 }
 
@@ -57,9 +61,15 @@ type packetPacker struct {
 	packetNumberGenerator *packetNumberGenerator
 	getPacketNumberLen    func(protocol.PacketNumber) protocol.PacketNumberLen
 	streams               streamFrameSource
+	datagramQueue         *datagramQueue // nil if DATAGRAM frames are not enabled
+	token                 []byte         // the token sent in Initial packets
 
 	controlFrameMutex sync.Mutex
 	controlFrames     []wire.Frame
+	resetStreams      map[protocol.StreamID]struct{} // streams for which a RST_STREAM was queued
+
+	// the frames of lost forward-secure packets, that are sent before new frames
+	retransmissionQueue []wire.Frame
 
 	stopWaiting               *wire.StopWaitingFrame
 	ackFrame                  *wire.AckFrame
@@ -81,19 +91,6 @@ func newPacketPacker(
 	perspective protocol.Perspective,
 	version protocol.VersionNumber,
 ) *packetPacker {
-	maxPacketSize := protocol.ByteCount(protocol.MinInitialPacketSize)
-	// If this is not a UDP address, we don't know anything about the MTU.
-	// Use the minimum size of an Initial packet as the max packet size.
-	if udpAddr, ok := remoteAddr.(*net.UDPAddr); ok {
-		// If ip is not an IPv4 address, To4 returns nil.
-		// Note that there might be some corner cases, where this is not correct.
-		// See https://stackoverflow.com/questions/22751035/golang-distinguish-ipv4-ipv6.
-		if udpAddr.IP.To4() == nil {
-			maxPacketSize = protocol.MaxPacketSizeIPv6
-		} else {
-			maxPacketSize = protocol.MaxPacketSizeIPv4
-		}
-	}
 	return &packetPacker{
 		cryptoSetup:           cryptoSetup,
 		divNonce:              divNonce,
@@ -104,8 +101,26 @@ func newPacketPacker(
 		streams:               streamFramer,
 		getPacketNumberLen:    getPacketNumberLen,
 		packetNumberGenerator: newPacketNumberGenerator(initialPacketNumber, protocol.SkipPacketAveragePeriodLength),
-		maxPacketSize:         maxPacketSize,
+		maxPacketSize:         getMaxPacketSize(remoteAddr),
+		resetStreams:          make(map[protocol.StreamID]struct{}),
+	}
+}
+
+// getMaxPacketSize returns the packet size that is used before path MTU discovery found a larger size
+func getMaxPacketSize(addr net.Addr) protocol.ByteCount {
+	// If this is not a UDP address, we don't know anything about the MTU.
+	// Use the minimum size of an Initial packet as the max packet size.
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return protocol.MinInitialPacketSize
+	}
+	// If ip is not an IPv4 address, To4 returns nil.
+	// Note that there might be some corner cases, where this is not correct.
+	// See https://stackoverflow.com/questions/22751035/golang-distinguish-ipv4-ipv6.
+	if udpAddr.IP.To4() == nil {
+		return protocol.MaxPacketSizeIPv6
 	}
+	return protocol.MaxPacketSizeIPv4
 }
 
 // PackConnectionClose packs a packet that ONLY contains a ConnectionCloseFrame
@@ -122,6 +137,41 @@ func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*pac
 	}, err
 }
 
+// PackPathProbe packs a packet that ONLY contains a PathChallengeFrame or a PathResponseFrame.
+// It is sent on a path other than the current one, in order to validate that path.
+// The destination connection ID might differ from the one used on the current path.
+func (p *packetPacker) PackPathProbe(frame wire.Frame, destConnID protocol.ConnectionID) (*packedPacket, error) {
+	frames := []wire.Frame{frame}
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	header := p.getHeader(encLevel)
+	header.DestConnectionID = destConnID
+	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	return &packedPacket{
+		header:          header,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+	}, err
+}
+
+// PackMTUProbePacket packs a packet that contains a PING frame, padded to size bytes.
+// It is used for path MTU discovery, and may be larger than the current max packet size.
+func (p *packetPacker) PackMTUProbePacket(size protocol.ByteCount) (*packedPacket, error) {
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	if encLevel != protocol.EncryptionForwardSecure {
+		return nil, errors.New("packet packer BUG: MTU probe packets can only be sent after the handshake")
+	}
+	frames := []wire.Frame{&wire.PingFrame{}}
+	header := p.getHeader(encLevel)
+	raw, err := p.writeAndSealPaddedPacket(header, frames, sealer, size)
+	return &packedPacket{
+		header:          header,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+	}, err
+}
+
 func (p *packetPacker) PackAckPacket() (*packedPacket, error) {
 	if p.ackFrame == nil {
 		return nil, errors.New("packet packer BUG: no ack frame queued")
@@ -145,108 +195,14 @@ func (p *packetPacker) PackAckPacket() (*packedPacket, error) {
 	}, err
 }
 
-// PackRetransmission packs a retransmission
-// For packets sent after completion of the handshake, it might happen that 2 packets have to be sent.
-// This can happen e.g. when a longer packet number is used in the header.
-func (p *packetPacker) PackRetransmission(packet *ackhandler.Packet) ([]*packedPacket, error) {
-	if packet.EncryptionLevel != protocol.EncryptionForwardSecure {
-		p, err := p.packHandshakeRetransmission(packet)
-		return []*packedPacket{p}, err
+// PackRetransmission packs a retransmission of a handshake packet.
+// The frames of lost forward-secure packets are queued using QueueRetransmission,
+// and are bundled with new frames in the next packets.
+func (p *packetPacker) PackRetransmission(packet *ackhandler.Packet) (*packedPacket, error) {
+	if packet.EncryptionLevel == protocol.EncryptionForwardSecure {
+		return nil, errors.New("PacketPacker BUG: forward-secure packets are retransmitted frame by frame")
 	}
-
-	var controlFrames []wire.Frame
-	var streamFrames []*wire.StreamFrame
-	for _, f := range packet.Frames {
-		if sf, ok := f.(*wire.StreamFrame); ok {
-			sf.DataLenPresent = true
-			streamFrames = append(streamFrames, sf)
-		} else {
-			controlFrames = append(controlFrames, f)
-		}
-	}
-
-	var packets []*packedPacket
-	encLevel, sealer := p.cryptoSetup.GetSealer()
-	for len(controlFrames) > 0 || len(streamFrames) > 0 {
-		var frames []wire.Frame
-		var payloadLength protocol.ByteCount
-
-		header := p.getHeader(encLevel)
-		headerLength, err := header.GetLength(p.perspective, p.version)
-		if err != nil {
-			return nil, err
-		}
-		maxSize := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - headerLength
-
-		// for gQUIC: add a STOP_WAITING for *every* retransmission
-		if p.version.UsesStopWaitingFrames() {
-			if p.stopWaiting == nil {
-				return nil, errors.New("PacketPacker BUG: Handshake retransmissions must contain a STOP_WAITING frame")
-			}
-			// create a new StopWaitingFrame, since we might need to send more than one packet as a retransmission
-			swf := &wire.StopWaitingFrame{
-				LeastUnacked:    p.stopWaiting.LeastUnacked,
-				PacketNumber:    header.PacketNumber,
-				PacketNumberLen: header.PacketNumberLen,
-			}
-			payloadLength += swf.Length(p.version)
-			frames = append(frames, swf)
-		}
-
-		for len(controlFrames) > 0 {
-			frame := controlFrames[0]
-			length := frame.Length(p.version)
-			if payloadLength+length > maxSize {
-				break
-			}
-			payloadLength += length
-			frames = append(frames, frame)
-			controlFrames = controlFrames[1:]
-		}
-
-		// temporarily increase the maxFrameSize by the (minimum) length of the DataLen field
-		// this leads to a properly sized packet in all cases, since we do all the packet length calculations with StreamFrames that have the DataLen set
-		// however, for the last STREAM frame in the packet, we can omit the DataLen, thus yielding a packet of exactly the correct size
-		// for gQUIC STREAM frames, DataLen is always 2 bytes
-		// for IETF draft style STREAM frames, the length is encoded to either 1 or 2 bytes
-		if p.version.UsesIETFFrameFormat() {
-			maxSize++
-		} else {
-			maxSize += 2
-		}
-		for len(streamFrames) > 0 && payloadLength+protocol.MinStreamFrameSize < maxSize {
-			// TODO: optimize by setting DataLenPresent = false on all but the last STREAM frame
-			frame := streamFrames[0]
-			frameToAdd := frame
-
-			sf, err := frame.MaybeSplitOffFrame(maxSize-payloadLength, p.version)
-			if err != nil {
-				return nil, err
-			}
-			if sf != nil {
-				frameToAdd = sf
-			} else {
-				streamFrames = streamFrames[1:]
-			}
-			payloadLength += frameToAdd.Length(p.version)
-			frames = append(frames, frameToAdd)
-		}
-		if sf, ok := frames[len(frames)-1].(*wire.StreamFrame); ok {
-			sf.DataLenPresent = false
-		}
-		raw, err := p.writeAndSealPacket(header, frames, sealer)
-		if err != nil {
-			return nil, err
-		}
-		packets = append(packets, &packedPacket{
-			header:          header,
-			raw:             raw,
-			frames:          frames,
-			encryptionLevel: encLevel,
-		})
-	}
-	p.stopWaiting = nil
-	return packets, nil
+	return p.packHandshakeRetransmission(packet)
 }
 
 // packHandshakeRetransmission retransmits a handshake packet, that was sent with less than forward-secure encryption
@@ -274,6 +230,23 @@ func (p *packetPacker) packHandshakeRetransmission(packet *ackhandler.Packet) (*
 	} else {
 		frames = packet.Frames
 	}
+	headerLength, err := header.GetLength(p.perspective, p.version)
+	if err != nil {
+		return nil, err
+	}
+	payloadLength := protocol.ByteCount(sealer.Overhead())
+	for _, f := range frames {
+		payloadLength += f.Length(p.version)
+	}
+	// The header of the retransmission might be longer than the header of the original packet,
+	// and the maximum packet size might have decreased since the original packet was sent.
+	var remaining protocol.ByteCount
+	if headerLength+payloadLength < p.maxPacketSize {
+		remaining = p.maxPacketSize - headerLength - payloadLength
+	}
+	if ackFrames := p.getAckFramesForHandshakePacket(header, packet.EncryptionLevel, remaining); len(ackFrames) > 0 {
+		frames = append(ackFrames, frames...)
+	}
 	raw, err := p.writeAndSealPacket(header, frames, sealer)
 	return &packedPacket{
 		header:          header,
@@ -308,7 +281,7 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 	}
 
 	maxSize := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - headerLength
-	payloadFrames, err := p.composeNextPacket(maxSize, p.canSendData(encLevel))
+	payloadFrames, containsRetransmission, err := p.composeNextPacket(maxSize, p.canSendData(encLevel))
 	if err != nil {
 		return nil, err
 	}
@@ -342,10 +315,11 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 		return nil, err
 	}
 	return &packedPacket{
-		header:          header,
-		raw:             raw,
-		frames:          payloadFrames,
-		encryptionLevel: encLevel,
+		header:                 header,
+		raw:                    raw,
+		frames:                 payloadFrames,
+		encryptionLevel:        encLevel,
+		containsRetransmission: containsRetransmission,
 	}, nil
 }
 
@@ -357,9 +331,13 @@ func (p *packetPacker) packCryptoPacket() (*packedPacket, error) {
 		return nil, err
 	}
 	maxLen := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - protocol.NonForwardSecurePacketSizeReduction - headerLength
+	frames := p.getAckFramesForHandshakePacket(header, encLevel, maxLen-protocol.MinStreamFrameSize)
+	for _, f := range frames {
+		maxLen -= f.Length(p.version)
+	}
 	sf := p.streams.PopCryptoStreamFrame(maxLen)
 	sf.DataLenPresent = false
-	frames := []wire.Frame{sf}
+	frames = append(frames, sf)
 	raw, err := p.writeAndSealPacket(header, frames, sealer)
 	if err != nil {
 		return nil, err
@@ -372,10 +350,42 @@ func (p *packetPacker) packCryptoPacket() (*packedPacket, error) {
 	}, nil
 }
 
+// getAckFramesForHandshakePacket returns the queued ACK frame (and STOP_WAITING frame, for gQUIC),
+// so that it can be sent in the same packet as crypto stream data.
+// This saves sending a separate ACK packet during the handshake.
+// The ACK is only coalesced if it would be sent with the same encryption level in a separate packet,
+// and if it fits into maxLen bytes.
+func (p *packetPacker) getAckFramesForHandshakePacket(
+	header *wire.Header,
+	encLevel protocol.EncryptionLevel,
+	maxLen protocol.ByteCount,
+) []wire.Frame {
+	if p.ackFrame == nil {
+		return nil
+	}
+	if ackEncLevel, _ := p.cryptoSetup.GetSealer(); ackEncLevel != encLevel {
+		return nil
+	}
+	frames := []wire.Frame{p.ackFrame}
+	length := p.ackFrame.Length(p.version)
+	if p.stopWaiting != nil { // a STOP_WAITING will only be queued when using gQUIC
+		p.stopWaiting.PacketNumber = header.PacketNumber
+		p.stopWaiting.PacketNumberLen = header.PacketNumberLen
+		frames = append(frames, p.stopWaiting)
+		length += p.stopWaiting.Length(p.version)
+	}
+	if length > maxLen {
+		return nil
+	}
+	p.ackFrame = nil
+	p.stopWaiting = nil
+	return frames
+}
+
 func (p *packetPacker) composeNextPacket(
 	maxFrameSize protocol.ByteCount,
 	canSendStreamFrames bool,
-) ([]wire.Frame, error) {
+) ([]wire.Frame, bool /* contains a retransmission */, error) {
 	var payloadLength protocol.ByteCount
 	var payloadFrames []wire.Frame
 
@@ -390,6 +400,16 @@ func (p *packetPacker) composeNextPacket(
 		payloadLength += p.stopWaiting.Length(p.version)
 	}
 
+	// Retransmitted control frames are sent before new control frames.
+	// The retransmission queue only contains frames of forward-secure packets,
+	// which can only be lost after we started sending data.
+	var containsRetransmission bool
+	if canSendStreamFrames {
+		numFrames := len(payloadFrames)
+		payloadFrames, payloadLength = p.appendRetransmittedControlFrames(payloadFrames, payloadLength, maxFrameSize)
+		containsRetransmission = len(payloadFrames) > numFrames
+	}
+
 	p.controlFrameMutex.Lock()
 	for len(p.controlFrames) > 0 {
 		frame := p.controlFrames[len(p.controlFrames)-1]
@@ -404,11 +424,11 @@ func (p *packetPacker) composeNextPacket(
 	p.controlFrameMutex.Unlock()
 
 	if payloadLength > maxFrameSize {
-		return nil, fmt.Errorf("Packet Packer BUG: packet payload (%d) too large (%d)", payloadLength, maxFrameSize)
+		return nil, false, fmt.Errorf("Packet Packer BUG: packet payload (%d) too large (%d)", payloadLength, maxFrameSize)
 	}
 
 	if !canSendStreamFrames {
-		return payloadFrames, nil
+		return payloadFrames, false, nil
 	}
 
 	// temporarily increase the maxFrameSize by the (minimum) length of the DataLen field
@@ -416,21 +436,129 @@ func (p *packetPacker) composeNextPacket(
 	// however, for the last STREAM frame in the packet, we can omit the DataLen, thus yielding a packet of exactly the correct size
 	// for gQUIC STREAM frames, DataLen is always 2 bytes
 	// for IETF draft style STREAM frames, the length is encoded to either 1 or 2 bytes
+	maxStreamFrameSize := maxFrameSize
 	if p.version.UsesIETFFrameFormat() {
-		maxFrameSize++
+		maxStreamFrameSize++
 	} else {
-		maxFrameSize += 2
+		maxStreamFrameSize += 2
 	}
 
-	fs := p.streams.PopStreamFrames(maxFrameSize - payloadLength)
-	if len(fs) != 0 {
-		fs[len(fs)-1].DataLenPresent = false
+	numFrames := len(payloadFrames)
+	payloadFrames, payloadLength, err := p.appendRetransmittedStreamFrames(payloadFrames, payloadLength, maxStreamFrameSize)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(payloadFrames) > numFrames {
+		containsRetransmission = true
 	}
 
+	if p.datagramQueue != nil {
+		// If the DATAGRAM frame doesn't fit, it stays queued and will be sent in the next packet.
+		if f := p.datagramQueue.Peek(); f != nil {
+			if length := f.Length(p.version); payloadLength+length <= maxFrameSize {
+				payloadFrames = append(payloadFrames, f)
+				payloadLength += length
+				p.datagramQueue.Pop()
+			}
+		}
+	}
+
+	fs := p.streams.PopStreamFrames(maxStreamFrameSize - payloadLength)
 	for _, f := range fs {
 		payloadFrames = append(payloadFrames, f)
 	}
-	return payloadFrames, nil
+	if len(payloadFrames) > 0 {
+		if sf, ok := payloadFrames[len(payloadFrames)-1].(*wire.StreamFrame); ok {
+			sf.DataLenPresent = false
+		}
+	}
+	return payloadFrames, containsRetransmission, nil
+}
+
+// appendRetransmittedControlFrames appends the retransmitted control frames that fit into the packet.
+// Control frames that don't fit stay queued.
+func (p *packetPacker) appendRetransmittedControlFrames(frames []wire.Frame, length, maxLength protocol.ByteCount) ([]wire.Frame, protocol.ByteCount) {
+	queue := p.retransmissionQueue[:0]
+	for _, f := range p.retransmissionQueue {
+		if _, ok := f.(*wire.StreamFrame); !ok {
+			if l := f.Length(p.version); length+l <= maxLength {
+				frames = append(frames, f)
+				length += l
+				continue
+			}
+		}
+		queue = append(queue, f)
+	}
+	p.retransmissionQueue = queue
+	return frames, length
+}
+
+// appendRetransmittedStreamFrames appends the retransmitted STREAM frames that fit into the packet.
+// STREAM frames are split, if necessary.
+// STREAM frames for streams that were reset are dropped.
+func (p *packetPacker) appendRetransmittedStreamFrames(frames []wire.Frame, length, maxLength protocol.ByteCount) ([]wire.Frame, protocol.ByteCount, error) {
+	queue := p.retransmissionQueue[:0]
+	for i, f := range p.retransmissionQueue {
+		sf, ok := f.(*wire.StreamFrame)
+		if !ok {
+			queue = append(queue, f)
+			continue
+		}
+		if p.isStreamReset(sf.StreamID) {
+			continue
+		}
+		if length+protocol.MinStreamFrameSize >= maxLength {
+			queue = append(queue, p.retransmissionQueue[i:]...)
+			break
+		}
+		frameToAdd := sf
+		splitFrame, err := sf.MaybeSplitOffFrame(maxLength-length, p.version)
+		if err != nil {
+			return nil, 0, err
+		}
+		if splitFrame != nil {
+			frameToAdd = splitFrame
+			queue = append(queue, sf)
+		}
+		frames = append(frames, frameToAdd)
+		length += frameToAdd.Length(p.version)
+	}
+	p.retransmissionQueue = queue
+	return frames, length, nil
+}
+
+func (p *packetPacker) isStreamReset(id protocol.StreamID) bool {
+	p.controlFrameMutex.Lock()
+	_, ok := p.resetStreams[id]
+	p.controlFrameMutex.Unlock()
+	return ok
+}
+
+// StreamCompleted is called when a stream was completed.
+// Both sides have stopped sending on the stream, so it doesn't need to be tracked as reset any more.
+func (p *packetPacker) StreamCompleted(id protocol.StreamID) {
+	p.controlFrameMutex.Lock()
+	delete(p.resetStreams, id)
+	p.controlFrameMutex.Unlock()
+}
+
+// QueueRetransmission queues a frame of a lost forward-secure packet.
+// Retransmitted frames are sent before new frames.
+// STREAM frames are dropped if the stream is reset before they are sent.
+func (p *packetPacker) QueueRetransmission(frame wire.Frame) {
+	if sf, ok := frame.(*wire.StreamFrame); ok {
+		sf.DataLenPresent = true
+	}
+	p.retransmissionQueue = append(p.retransmissionQueue, frame)
+}
+
+// RetransmissionQueueLength returns the number of bytes of the frames queued for retransmission.
+func (p *packetPacker) RetransmissionQueueLength() protocol.ByteCount {
+	var length protocol.ByteCount
+	for _, f := range p.retransmissionQueue {
+		length += f.Length(p.version)
+	}
+	return length
 }
 
 func (p *packetPacker) QueueControlFrame(frame wire.Frame) {
@@ -442,6 +570,9 @@ func (p *packetPacker) QueueControlFrame(frame wire.Frame) {
 	default:
 		p.controlFrameMutex.Lock()
 		p.controlFrames = append(p.controlFrames, f)
+		if rst, ok := f.(*wire.RstStreamFrame); ok {
+			p.resetStreams[rst.StreamID] = struct{}{}
+		}
 		p.controlFrameMutex.Unlock()
 	}
 }
@@ -463,6 +594,10 @@ func (p *packetPacker) getHeader(encLevel protocol.EncryptionLevel) *wire.Header
 		// Set the payload len to maximum size.
 		// Since it is encoded as a varint, this guarantees us that the header will end up at most as big as GetLength() returns.
 		header.PayloadLen = p.maxPacketSize
+		if p.perspective == protocol.PerspectiveClient {
+			// the token is only written for Initial packets, including retransmissions of the Initial
+			header.Token = p.token
+		}
 		if !p.hasSentPacket && p.perspective == protocol.PerspectiveClient {
 			header.Type = protocol.PacketTypeInitial
 		} else {
@@ -494,6 +629,20 @@ func (p *packetPacker) writeAndSealPacket(
 	payloadFrames []wire.Frame,
 	sealer handshake.Sealer,
 ) ([]byte, error) {
+	return p.writeAndSealPaddedPacket(header, payloadFrames, sealer, 0)
+}
+
+// writeAndSealPaddedPacket writes and seals a packet.
+// If paddedSize is not 0, the packet is padded to paddedSize bytes, which may exceed the max packet size.
+func (p *packetPacker) writeAndSealPaddedPacket(
+	header *wire.Header,
+	payloadFrames []wire.Frame,
+	sealer handshake.Sealer,
+	paddedSize protocol.ByteCount,
+) ([]byte, error) {
+	if paddedSize > protocol.MaxReceivePacketSize {
+		return nil, fmt.Errorf("PacketPacker BUG: can't pad packet to %d bytes", paddedSize)
+	}
 	raw := *getPacketBuffer()
 	buffer := bytes.NewBuffer(raw[:0])
 
@@ -511,6 +660,10 @@ func (p *packetPacker) writeAndSealPacket(
 		}
 	}
 
+	// the Key Phase bit must match the keys used for sealing
+	if s, ok := sealer.(handshake.ShortHeaderSealer); ok && !header.IsLongHeader {
+		header.KeyPhase = s.KeyPhase()
+	}
 	if err := header.Write(buffer, p.perspective, p.version); err != nil {
 		return nil, err
 	}
@@ -537,8 +690,16 @@ func (p *packetPacker) writeAndSealPacket(
 		}
 	}
 
-	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > p.maxPacketSize {
-		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, p.maxPacketSize)
+	maxPacketSize := p.maxPacketSize
+	if paddedSize != 0 {
+		// PADDING frames are 0 bytes, in both gQUIC and IETF QUIC
+		if paddingLen := int(paddedSize) - sealer.Overhead() - buffer.Len(); paddingLen > 0 {
+			buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
+		}
+		maxPacketSize = paddedSize
+	}
+	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > maxPacketSize {
+		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, maxPacketSize)
 	}
 
 	raw = raw[0:buffer.Len()]
@@ -560,10 +721,29 @@ func (p *packetPacker) canSendData(encLevel protocol.EncryptionLevel) bool {
 	return encLevel == protocol.EncryptionForwardSecure
 }
 
+// SetDestConnectionID sets the destination connection ID, e.g. when switching to a connection ID issued by the peer
+func (p *packetPacker) SetDestConnectionID(connID protocol.ConnectionID) {
+	p.destConnID = connID
+}
+
 func (p *packetPacker) SetOmitConnectionID() {
 	p.omitConnectionID = true
 }
 
+func (p *packetPacker) SetDatagramQueue(q *datagramQueue) {
+	p.datagramQueue = q
+}
+
+// SetToken sets the token that is sent in Initial packets
+func (p *packetPacker) SetToken(token []byte) {
+	p.token = token
+}
+
 func (p *packetPacker) SetMaxPacketSize(size protocol.ByteCount) {
 	p.maxPacketSize = utils.MinByteCount(p.maxPacketSize, size)
 }
+
+// IncreaseMaxPacketSize raises the max packet size after path MTU discovery found that larger packets can be sent.
+func (p *packetPacker) IncreaseMaxPacketSize(size protocol.ByteCount) {
+	p.maxPacketSize = utils.MaxByteCount(p.maxPacketSize, size)
+}
@@ -8,12 +8,15 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
-type mockSealer struct{}
+type mockSealer struct {
+	keyPhase int
+}
 
 func (s *mockSealer) Seal(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) []byte {
 	return append(src, bytes.Repeat([]byte{0}, 12)...)
@@ -21,13 +24,17 @@ func (s *mockSealer) Seal(dst, src []byte, packetNumber protocol.PacketNumber, a
 
 func (s *mockSealer) Overhead() int { return 12 }
 
-var _ handshake.Sealer = &mockSealer{}
+func (s *mockSealer) KeyPhase() int { return s.keyPhase }
+
+var _ handshake.ShortHeaderSealer = &mockSealer{}
 
 type mockCryptoSetup struct {
 	handleErr          error
 	encLevelSeal       protocol.EncryptionLevel
 	encLevelSealCrypto protocol.EncryptionLevel
+	keyPhase           int
 	divNonce           []byte
+	connectionState    ConnectionState
 }
 
 var _ handshake.CryptoSetup = &mockCryptoSetup{}
@@ -39,7 +46,7 @@ func (m *mockCryptoSetup) Open(dst, src []byte, packetNumber protocol.PacketNumb
 	return nil, protocol.EncryptionUnspecified, nil
 }
 func (m *mockCryptoSetup) GetSealer() (protocol.EncryptionLevel, handshake.Sealer) {
-	return m.encLevelSeal, &mockSealer{}
+	return m.encLevelSeal, &mockSealer{keyPhase: m.keyPhase}
 }
 func (m *mockCryptoSetup) GetSealerForCryptoStream() (protocol.EncryptionLevel, handshake.Sealer) {
 	return m.encLevelSealCrypto, &mockSealer{}
@@ -51,7 +58,7 @@ func (m *mockCryptoSetup) SetDiversificationNonce(divNonce []byte) error {
 	m.divNonce = divNonce
 	return nil
 }
-func (m *mockCryptoSetup) ConnectionState() ConnectionState { panic("not implemented") }
+func (m *mockCryptoSetup) ConnectionState() ConnectionState { return m.connectionState }
 
 var _ = Describe("Packet packer", func() {
 	const maxPacketSize protocol.ByteCount = 1357
@@ -265,11 +272,26 @@ var _ = Describe("Packet packer", func() {
 		Expect(err).ToNot(HaveOccurred())
 		// parse the packet
 		r := bytes.NewReader(p.raw)
-		hdr, err := wire.ParseHeaderSentByServer(r, packer.version)
+		hdr, err := wire.ParseHeaderSentByServer(r, packer.version, 8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 	})
 
+	It("sets the Key Phase bit of the sealer", func() {
+		packer.version = versionIETFFrames
+		packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionForwardSecure
+		packer.cryptoSetup.(*mockCryptoSetup).keyPhase = 1
+		packer.QueueControlFrame(&wire.PingFrame{})
+		mockStreamFramer.EXPECT().HasCryptoStreamData()
+		mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+		p, err := packer.PackPacket()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.header.IsLongHeader).To(BeFalse())
+		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(p.raw), packer.version, 8)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hdr.KeyPhase).To(Equal(1))
+	})
+
 	It("packs a CONNECTION_CLOSE", func() {
 		ccf := wire.ConnectionCloseFrame{
 			ErrorCode:    0x1337,
@@ -293,6 +315,73 @@ var _ = Describe("Packet packer", func() {
 		Expect(p.frames).To(Equal([]wire.Frame{ccf}))
 	})
 
+	It("packs a path probe with a PATH_RESPONSE", func() {
+		prf := &wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+		p, err := packer.PackPathProbe(prf, packer.destConnID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.frames).To(Equal([]wire.Frame{prf}))
+		Expect(p.header.DestConnectionID).To(Equal(packer.destConnID))
+	})
+
+	It("uses the destination connection ID for path probes", func() {
+		packer.version = versionIETFFrames
+		prf := &wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+		connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+		p, err := packer.PackPathProbe(prf, connID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.header.DestConnectionID).To(Equal(connID))
+		// the connection ID only applies to this packet
+		Expect(packer.destConnID).ToNot(Equal(connID))
+	})
+
+	It("changes the destination connection ID", func() {
+		packer.version = versionIETFFrames
+		connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+		packer.SetDestConnectionID(connID)
+		mockStreamFramer.EXPECT().HasCryptoStreamData()
+		mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+		packer.controlFrames = []wire.Frame{&wire.MaxStreamDataFrame{StreamID: 37}}
+		p, err := packer.PackPacket()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.header.DestConnectionID).To(Equal(connID))
+	})
+
+	It("packs a path probe with a PATH_CHALLENGE", func() {
+		pcf := &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+		packer.controlFrames = []wire.Frame{&wire.MaxStreamDataFrame{StreamID: 37}}
+		p, err := packer.PackPathProbe(pcf, packer.destConnID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.frames).To(Equal([]wire.Frame{pcf}))
+		Expect(p.encryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+		// the control frame is sent in the next packet
+		Expect(packer.controlFrames).To(HaveLen(1))
+	})
+
+	Context("MTU probe packets", func() {
+		It("packs a PING frame, padded to the probe size", func() {
+			packer.controlFrames = []wire.Frame{&wire.MaxStreamDataFrame{StreamID: 37}}
+			p, err := packer.PackMTUProbePacket(maxPacketSize + 42)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+			Expect(p.raw).To(HaveLen(int(maxPacketSize) + 42))
+			// the control frame is sent in the next packet
+			Expect(packer.controlFrames).To(HaveLen(1))
+			// the max packet size is not changed
+			Expect(packer.maxPacketSize).To(Equal(maxPacketSize))
+		})
+
+		It("doesn't pack MTU probe packets before the handshake completes", func() {
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+			_, err := packer.PackMTUProbePacket(maxPacketSize + 42)
+			Expect(err).To(MatchError("packet packer BUG: MTU probe packets can only be sent after the handshake"))
+		})
+
+		It("doesn't pack MTU probe packets larger than the receive buffer", func() {
+			_, err := packer.PackMTUProbePacket(protocol.MaxReceivePacketSize + 1)
+			Expect(err).To(MatchError("PacketPacker BUG: can't pad packet to 1453 bytes"))
+		})
+	})
+
 	It("packs only control frames", func() {
 		mockStreamFramer.EXPECT().HasCryptoStreamData()
 		mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
@@ -384,10 +473,10 @@ var _ = Describe("Packet packer", func() {
 			controlFrames = append(controlFrames, f)
 		}
 		packer.controlFrames = controlFrames
-		payloadFrames, err := packer.composeNextPacket(maxFrameSize, false)
+		payloadFrames, _, err := packer.composeNextPacket(maxFrameSize, false)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(payloadFrames).To(HaveLen(maxFramesPerPacket))
-		payloadFrames, err = packer.composeNextPacket(maxFrameSize, false)
+		payloadFrames, _, err = packer.composeNextPacket(maxFrameSize, false)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(payloadFrames).To(BeEmpty())
 	})
@@ -400,10 +489,10 @@ var _ = Describe("Packet packer", func() {
 			controlFrames = append(controlFrames, blockedFrame)
 		}
 		packer.controlFrames = controlFrames
-		payloadFrames, err := packer.composeNextPacket(maxFrameSize, false)
+		payloadFrames, _, err := packer.composeNextPacket(maxFrameSize, false)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(payloadFrames).To(HaveLen(maxFramesPerPacket))
-		payloadFrames, err = packer.composeNextPacket(maxFrameSize, false)
+		payloadFrames, _, err = packer.composeNextPacket(maxFrameSize, false)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(payloadFrames).To(HaveLen(10))
 	})
@@ -614,7 +703,7 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.header.IsLongHeader).To(BeTrue())
 			// parse the packet
 			r := bytes.NewReader(p.raw)
-			hdr, err := wire.ParseHeaderSentByServer(r, packer.version)
+			hdr, err := wire.ParseHeaderSentByServer(r, packer.version, 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 		})
@@ -647,6 +736,73 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionSecure))
 		})
 
+		Context("coalescing ACKs with crypto data", func() {
+			var f *wire.StreamFrame
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Largest: 10, Smallest: 1}}}
+
+			BeforeEach(func() {
+				f = &wire.StreamFrame{
+					StreamID: packer.version.CryptoStreamID(),
+					Data:     []byte("foobar"),
+				}
+				mockStreamFramer.EXPECT().HasCryptoStreamData().Return(true)
+			})
+
+			It("packs an ACK together with crypto data", func() {
+				mockStreamFramer.EXPECT().PopCryptoStreamFrame(gomock.Any()).Return(f)
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionSecure
+				packer.QueueControlFrame(ack)
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.frames).To(Equal([]wire.Frame{ack, f}))
+				Expect(packer.ackFrame).To(BeNil())
+			})
+
+			It("packs a STOP_WAITING frame together with the ACK, for gQUIC", func() {
+				mockStreamFramer.EXPECT().PopCryptoStreamFrame(gomock.Any()).Return(f)
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionSecure
+				swf := &wire.StopWaitingFrame{LeastUnacked: 1}
+				packer.QueueControlFrame(ack)
+				packer.QueueControlFrame(swf)
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.frames).To(Equal([]wire.Frame{ack, swf, f}))
+				Expect(swf.PacketNumber).To(Equal(p.header.PacketNumber))
+			})
+
+			It("reduces the size of the crypto data by the size of the ACK", func() {
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionSecure
+				packer.version = versionIETFFrames
+				mockStreamFramer.EXPECT().PopCryptoStreamFrame(gomock.Any()).DoAndReturn(func(size protocol.ByteCount) *wire.StreamFrame {
+					f = &wire.StreamFrame{
+						StreamID: packer.version.CryptoStreamID(),
+						Offset:   0x1337,
+					}
+					f.Data = bytes.Repeat([]byte{'f'}, int(size-f.Length(packer.version)))
+					return f
+				})
+				packer.QueueControlFrame(ack)
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.frames).To(Equal([]wire.Frame{ack, f}))
+				Expect(p.raw).To(HaveLen(int(packer.maxPacketSize - protocol.NonForwardSecurePacketSizeReduction)))
+			})
+
+			It("doesn't pack an ACK with crypto data sent with a lower encryption level", func() {
+				mockStreamFramer.EXPECT().PopCryptoStreamFrame(gomock.Any()).Return(f)
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionForwardSecure
+				packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionSecure
+				packer.QueueControlFrame(ack)
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.frames).To(Equal([]wire.Frame{f}))
+				Expect(packer.ackFrame).To(Equal(ack))
+			})
+		})
+
 		It("does not pack STREAM frames if not allowed", func() {
 			mockStreamFramer.EXPECT().HasCryptoStreamData()
 			// don't expect a call to mockStreamFramer.PopStreamFrames
@@ -659,6 +815,62 @@ var _ = Describe("Packet packer", func() {
 		})
 	})
 
+	Context("DATAGRAM frame handling", func() {
+		var datagramQueue *datagramQueue
+
+		BeforeEach(func() {
+			datagramQueue = newDatagramQueue(func() {}, packer.version, utils.DefaultLogger)
+			datagramQueue.SetMaxFrameSize(protocol.MaxDatagramFrameSize)
+			packer.SetDatagramQueue(datagramQueue)
+		})
+
+		It("packs a DATAGRAM frame", func() {
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			Expect(datagramQueue.AddAndWait([]byte("foobar"))).To(Succeed())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{&wire.DatagramFrame{DataLenPresent: true, Data: []byte("foobar")}}))
+			Expect(datagramQueue.Peek()).To(BeNil())
+		})
+
+		It("packs a DATAGRAM frame together with STREAM frames", func() {
+			f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Return([]*wire.StreamFrame{f})
+			Expect(datagramQueue.AddAndWait([]byte("foobar"))).To(Succeed())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(HaveLen(2))
+			Expect(p.frames[0]).To(BeAssignableToTypeOf(&wire.DatagramFrame{}))
+			Expect(p.frames[1]).To(Equal(f))
+		})
+
+		It("keeps a DATAGRAM frame queued if it doesn't fit into the packet", func() {
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			// queue a control frame that almost fills the packet
+			ccf := &wire.ConnectionCloseFrame{ReasonPhrase: string(bytes.Repeat([]byte{'a'}, int(maxFrameSize)-100))}
+			packer.QueueControlFrame(ccf)
+			Expect(datagramQueue.AddAndWait(make([]byte, 200))).To(Succeed())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{ccf}))
+			Expect(datagramQueue.Peek()).ToNot(BeNil())
+		})
+
+		It("doesn't pack DATAGRAM frames if not allowed", func() {
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionUnencrypted
+			packer.QueueControlFrame(&wire.PingFrame{})
+			Expect(datagramQueue.AddAndWait([]byte("foobar"))).To(Succeed())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+			Expect(datagramQueue.Peek()).ToNot(BeNil())
+		})
+	})
+
 	It("packs a single ACK", func() {
 		mockStreamFramer.EXPECT().HasCryptoStreamData()
 		mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
@@ -699,10 +911,9 @@ var _ = Describe("Packet packer", func() {
 			}
 			p, err := packer.PackRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].header.Type).To(Equal(protocol.PacketTypeHandshake))
-			Expect(p[0].frames).To(Equal([]wire.Frame{swf, sf}))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
+			Expect(p.header.Type).To(Equal(protocol.PacketTypeHandshake))
+			Expect(p.frames).To(Equal([]wire.Frame{swf, sf}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
 		})
 
 		It("doesn't add a STOP_WAITING frame for IETF QUIC", func() {
@@ -713,9 +924,8 @@ var _ = Describe("Packet packer", func() {
 			}
 			p, err := packer.PackRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].frames).To(Equal([]wire.Frame{sf}))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
+			Expect(p.frames).To(Equal([]wire.Frame{sf}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
 		})
 
 		It("packs a retransmission for a packet sent with initial encryption", func() {
@@ -725,12 +935,79 @@ var _ = Describe("Packet packer", func() {
 			}
 			p, err := packer.PackRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].frames).To(Equal([]wire.Frame{swf, sf}))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionSecure))
+			Expect(p.frames).To(Equal([]wire.Frame{swf, sf}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionSecure))
 			// a packet sent by the server with initial encryption contains the SHLO
 			// it needs to have a diversification nonce
-			Expect(p[0].raw).To(ContainSubstring(string(divNonce)))
+			Expect(p.raw).To(ContainSubstring(string(divNonce)))
+		})
+
+		It("coalesces an ACK with the retransmission", func() {
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Largest: 10, Smallest: 1}}}
+			packer.QueueControlFrame(ack)
+			packet := &ackhandler.Packet{
+				EncryptionLevel: protocol.EncryptionSecure,
+				Frames:          []wire.Frame{sf},
+			}
+			p, err := packer.PackRetransmission(packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{ack, swf, sf}))
+			Expect(packer.ackFrame).To(BeNil())
+		})
+
+		It("doesn't coalesce an ACK with a retransmission sent with a lower encryption level", func() {
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionForwardSecure
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Largest: 10, Smallest: 1}}}
+			packer.QueueControlFrame(ack)
+			packet := &ackhandler.Packet{
+				EncryptionLevel: protocol.EncryptionSecure,
+				Frames:          []wire.Frame{sf},
+			}
+			p, err := packer.PackRetransmission(packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{swf, sf}))
+			Expect(packer.ackFrame).To(Equal(ack))
+		})
+
+		It("doesn't coalesce an ACK with a retransmission, if it doesn't fit", func() {
+			packer.version = versionIETFFrames
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Largest: 10, Smallest: 1}}}
+			packer.QueueControlFrame(ack)
+			largeFrame := &wire.StreamFrame{
+				StreamID: 1,
+				Data:     bytes.Repeat([]byte{'f'}, int(maxPacketSize-protocol.NonForwardSecurePacketSizeReduction)),
+			}
+			packet := &ackhandler.Packet{
+				EncryptionLevel: protocol.EncryptionSecure,
+				Frames:          []wire.Frame{largeFrame},
+			}
+			p, err := packer.PackRetransmission(packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{largeFrame}))
+			Expect(packer.ackFrame).To(Equal(ack))
+		})
+
+		It("doesn't coalesce an ACK with a full-size retransmission", func() {
+			packer.version = versionIETFFrames
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Largest: 10, Smallest: 1}}}
+			packer.QueueControlFrame(ack)
+			largeFrame := &wire.StreamFrame{
+				StreamID: 1,
+				Data:     bytes.Repeat([]byte{'f'}, int(maxPacketSize-protocol.NonForwardSecurePacketSizeReduction)),
+			}
+			packet := &ackhandler.Packet{
+				EncryptionLevel: protocol.EncryptionSecure,
+				Frames:          []wire.Frame{largeFrame},
+			}
+			// the maximum packet size decreased after the original packet was sent
+			packer.maxPacketSize -= 100
+			_, err := packer.PackRetransmission(packet)
+			Expect(err).To(MatchError(ContainSubstring("PacketPacker BUG: packet too large")))
+			// the ACK is sent in the next packet
+			Expect(packer.ackFrame).To(Equal(ack))
 		})
 
 		It("includes the diversification nonce on packets sent with initial encryption", func() {
@@ -740,8 +1017,7 @@ var _ = Describe("Packet packer", func() {
 			}
 			p, err := packer.PackRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionSecure))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionSecure))
 		})
 
 		// this should never happen, since non forward-secure packets are limited to a size smaller than MaxPacketSize, such that it is always possible to retransmit them without splitting the StreamFrame
@@ -795,7 +1071,7 @@ var _ = Describe("Packet packer", func() {
 			Expect(err).ToNot(HaveOccurred())
 			// parse the header and check the values
 			r := bytes.NewReader(packet.raw)
-			hdr, err := wire.ParseHeaderSentByClient(r)
+			hdr, err := wire.ParseHeaderSentByClient(r, 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 		})
@@ -810,10 +1086,31 @@ var _ = Describe("Packet packer", func() {
 			}
 			p, err := packer.PackRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].frames).To(Equal([]wire.Frame{sf}))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
-			Expect(p[0].header.Type).To(Equal(protocol.PacketTypeInitial))
+			Expect(p.frames).To(Equal([]wire.Frame{sf}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
+			Expect(p.header.Type).To(Equal(protocol.PacketTypeInitial))
+		})
+
+		It("sends the token in retransmissions of Initial packets", func() {
+			packer.version = versionIETFFrames
+			packer.perspective = protocol.PerspectiveClient
+			packer.SetToken([]byte("foobar"))
+			packet := &ackhandler.Packet{
+				PacketType:      protocol.PacketTypeInitial,
+				EncryptionLevel: protocol.EncryptionUnencrypted,
+				Frames:          []wire.Frame{sf},
+			}
+			p, err := packer.PackRetransmission(packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.header.Token).To(Equal([]byte("foobar")))
+		})
+
+		It("refuses to retransmit forward-secure packets", func() {
+			_, err := packer.PackRetransmission(&ackhandler.Packet{
+				EncryptionLevel: protocol.EncryptionForwardSecure,
+				Frames:          []wire.Frame{sf},
+			})
+			Expect(err).To(MatchError("PacketPacker BUG: forward-secure packets are retransmitted frame by frame"))
 		})
 
 		It("refuses to retransmit packets without a STOP_WAITING Frame", func() {
@@ -825,84 +1122,111 @@ var _ = Describe("Packet packer", func() {
 		})
 	})
 
-	Context("retransmission of forward-secure packets", func() {
+	Context("retransmission of forward-secure frames", func() {
 		BeforeEach(func() {
 			packer.packetNumberGenerator.next = 15
-			packer.stopWaiting = &wire.StopWaitingFrame{LeastUnacked: 7}
 		})
 
-		It("retransmits a small packet", func() {
+		It("retransmits frames of a lost packet", func() {
 			frames := []wire.Frame{
 				&wire.MaxDataFrame{ByteOffset: 0x1234},
 				&wire.StreamFrame{StreamID: 42, Data: []byte("foobar")},
 			}
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          frames,
-			})
+			for _, f := range frames {
+				packer.QueueRetransmission(f)
+			}
+			Expect(packer.RetransmissionQueueLength()).To(Equal(frames[0].Length(packer.version) + frames[1].Length(packer.version)))
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			p, err := packer.PackPacket()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(1))
-			p := packets[0]
 			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
-			Expect(p.frames).To(HaveLen(3))
-			Expect(p.frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(p.frames[0].(*wire.StopWaitingFrame).LeastUnacked).To(Equal(protocol.PacketNumber(7)))
-			Expect(p.frames[0].(*wire.StopWaitingFrame).PacketNumber).To(Equal(p.header.PacketNumber))
-			Expect(p.frames[0].(*wire.StopWaitingFrame).PacketNumberLen).To(Equal(p.header.PacketNumberLen))
-			Expect(p.frames[1:]).To(Equal(frames))
+			Expect(p.frames).To(Equal(frames))
+			Expect(p.containsRetransmission).To(BeTrue())
+			Expect(p.ToAckHandlerPacket().ContainsRetransmission).To(BeTrue())
+			Expect(packer.RetransmissionQueueLength()).To(BeZero())
 		})
 
-		It("refuses to retransmit packets without a STOP_WAITING Frame", func() {
-			packer.stopWaiting = nil
-			_, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          []wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1234}},
-			})
-			Expect(err).To(MatchError("PacketPacker BUG: Handshake retransmissions must contain a STOP_WAITING frame"))
+		It("bundles retransmitted frames with new frames", func() {
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}}
+			swf := &wire.StopWaitingFrame{LeastUnacked: 7}
+			retransmittedControlFrame := &wire.MaxStreamDataFrame{StreamID: 3, ByteOffset: 0x42}
+			newControlFrame := &wire.BlockedFrame{Offset: 0x1337}
+			retransmittedStreamFrame := &wire.StreamFrame{StreamID: 5, Data: []byte("foo")}
+			newStreamFrame := &wire.StreamFrame{StreamID: 7, Data: []byte("bar")}
+			packer.QueueControlFrame(ack)
+			packer.QueueControlFrame(swf)
+			packer.QueueControlFrame(newControlFrame)
+			packer.QueueRetransmission(retransmittedStreamFrame)
+			packer.QueueRetransmission(retransmittedControlFrame)
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Return([]*wire.StreamFrame{newStreamFrame})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{ack, swf, retransmittedControlFrame, newControlFrame, retransmittedStreamFrame, newStreamFrame}))
+			Expect(retransmittedStreamFrame.DataLenPresent).To(BeTrue())
+			Expect(newStreamFrame.DataLenPresent).To(BeFalse())
+			Expect(p.containsRetransmission).To(BeTrue())
+		})
+
+		It("doesn't mark packets without retransmitted frames", func() {
+			packer.QueueControlFrame(&wire.PingFrame{})
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.containsRetransmission).To(BeFalse())
+		})
+
+		It("omits the DataLen of the last retransmitted STREAM frame", func() {
+			packer.QueueRetransmission(&wire.StreamFrame{StreamID: 4, Data: []byte("foobar")})
+			packer.QueueRetransmission(&wire.StreamFrame{StreamID: 5, Data: []byte("barfoo")})
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(HaveLen(2))
+			Expect(p.frames[0].(*wire.StreamFrame).DataLenPresent).To(BeTrue())
+			Expect(p.frames[1].(*wire.StreamFrame).DataLenPresent).To(BeFalse())
 		})
 
-		It("packs two packets for retransmission if the original packet contained many control frames", func() {
+		It("packs retransmitted control frames into two packets, if they don't fit into one", func() {
 			var frames []wire.Frame
 			var totalLen protocol.ByteCount
-			// pack a bunch of control frames, such that the packet is way bigger than a single packet
 			for i := 0; totalLen < maxPacketSize*3/2; i++ {
 				f := &wire.MaxStreamDataFrame{StreamID: protocol.StreamID(i), ByteOffset: protocol.ByteCount(i)}
 				frames = append(frames, f)
 				totalLen += f.Length(packer.version)
+				packer.QueueRetransmission(f)
 			}
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          frames,
-			})
+			mockStreamFramer.EXPECT().HasCryptoStreamData().Times(2)
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Times(2)
+			p1, err := packer.PackPacket()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(2))
-			Expect(len(packets[0].frames) + len(packets[1].frames)).To(Equal(len(frames) + 2)) // all frames, plus 2 STOP_WAITING frames
-			Expect(packets[0].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[1].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[0].frames[1:]).To(Equal(frames[:len(packets[0].frames)-1]))
-			Expect(packets[1].frames[1:]).To(Equal(frames[len(packets[0].frames)-1:]))
-			// check that the first packet was filled up as far as possible:
-			// if the first frame (after the STOP_WAITING) was packed into the first packet, it would have overflown the MaxPacketSize
-			Expect(len(packets[0].raw) + int(packets[1].frames[1].Length(packer.version))).To(BeNumerically(">", maxPacketSize))
+			p2, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(append(p1.frames, p2.frames...)).To(Equal(frames))
+			// check that the first packet was filled up as far as possible
+			Expect(len(p1.raw) + int(p2.frames[0].Length(packer.version))).To(BeNumerically(">", maxPacketSize))
+			Expect(packer.RetransmissionQueueLength()).To(BeZero())
 		})
 
-		It("splits a STREAM frame that doesn't fit", func() {
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames: []wire.Frame{&wire.StreamFrame{
-					StreamID: 42,
-					Offset:   1337,
-					Data:     bytes.Repeat([]byte{'a'}, int(maxPacketSize)*3/2),
-				}},
+		It("splits a retransmitted STREAM frame that doesn't fit", func() {
+			packer.QueueRetransmission(&wire.StreamFrame{
+				StreamID: 42,
+				Offset:   1337,
+				Data:     bytes.Repeat([]byte{'a'}, int(maxPacketSize)*3/2),
 			})
+			mockStreamFramer.EXPECT().HasCryptoStreamData().Times(2)
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Times(2)
+			p1, err := packer.PackPacket()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(2))
-			Expect(packets[0].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[1].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[0].frames[1]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
-			Expect(packets[1].frames[1]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
-			sf1 := packets[0].frames[1].(*wire.StreamFrame)
-			sf2 := packets[1].frames[1].(*wire.StreamFrame)
+			p2, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p1.frames).To(HaveLen(1))
+			Expect(p2.frames).To(HaveLen(1))
+			sf1 := p1.frames[0].(*wire.StreamFrame)
+			sf2 := p2.frames[0].(*wire.StreamFrame)
 			Expect(sf1.StreamID).To(Equal(protocol.StreamID(42)))
 			Expect(sf1.Offset).To(Equal(protocol.ByteCount(1337)))
 			Expect(sf1.DataLenPresent).To(BeFalse())
@@ -910,59 +1234,43 @@ var _ = Describe("Packet packer", func() {
 			Expect(sf2.Offset).To(Equal(protocol.ByteCount(1337) + sf1.DataLen()))
 			Expect(sf2.DataLenPresent).To(BeFalse())
 			Expect(sf1.DataLen() + sf2.DataLen()).To(Equal(maxPacketSize * 3 / 2))
-			Expect(packets[0].raw).To(HaveLen(int(maxPacketSize)))
+			Expect(p1.raw).To(HaveLen(int(maxPacketSize)))
 		})
 
-		It("packs two packets for retransmission if the original packet contained many STREAM frames", func() {
-			var frames []wire.Frame
-			var totalLen protocol.ByteCount
-			// pack a bunch of control frames, such that the packet is way bigger than a single packet
-			for i := 0; totalLen < maxPacketSize*3/2; i++ {
-				f := &wire.StreamFrame{
-					StreamID:       protocol.StreamID(i),
-					Data:           []byte("foobar"),
-					DataLenPresent: true,
-				}
-				frames = append(frames, f)
-				totalLen += f.Length(packer.version)
-			}
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          frames,
-			})
+		It("drops retransmitted STREAM frames for streams that were reset", func() {
+			packer.QueueRetransmission(&wire.StreamFrame{StreamID: 5, Data: []byte("foobar")})
+			sf := &wire.StreamFrame{StreamID: 7, Data: []byte("raboof")}
+			packer.QueueRetransmission(sf)
+			rst := &wire.RstStreamFrame{StreamID: 5, ByteOffset: 6}
+			packer.QueueControlFrame(rst)
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			p, err := packer.PackPacket()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(2))
-			Expect(len(packets[0].frames) + len(packets[1].frames)).To(Equal(len(frames) + 2)) // all frames, plus 2 STOP_WAITING frames
-			Expect(packets[0].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[1].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[0].frames[1:]).To(Equal(frames[:len(packets[0].frames)-1]))
-			Expect(packets[1].frames[1:]).To(Equal(frames[len(packets[0].frames)-1:]))
-			// check that the first packet was filled up as far as possible:
-			// if the first frame (after the STOP_WAITING) was packed into the first packet, it would have overflown the MaxPacketSize
-			Expect(len(packets[0].raw) + int(packets[1].frames[1].Length(packer.version))).To(BeNumerically(">", maxPacketSize-protocol.MinStreamFrameSize))
+			Expect(p.frames).To(Equal([]wire.Frame{rst, sf}))
+			Expect(packer.RetransmissionQueueLength()).To(BeZero())
 		})
 
-		It("correctly sets the DataLenPresent on STREAM frames", func() {
-			frames := []wire.Frame{
-				&wire.StreamFrame{StreamID: 4, Data: []byte("foobar"), DataLenPresent: true},
-				&wire.StreamFrame{StreamID: 5, Data: []byte("barfoo")},
-			}
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          frames,
-			})
+		It("forgets reset streams when they are completed", func() {
+			packer.QueueControlFrame(&wire.RstStreamFrame{StreamID: 5})
+			packer.QueueControlFrame(&wire.RstStreamFrame{StreamID: 7})
+			Expect(packer.isStreamReset(5)).To(BeTrue())
+			packer.StreamCompleted(5)
+			Expect(packer.isStreamReset(5)).To(BeFalse())
+			Expect(packer.isStreamReset(7)).To(BeTrue())
+			Expect(packer.resetStreams).To(HaveLen(1))
+		})
+
+		It("doesn't send retransmissions in packets that can't carry data", func() {
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+			packer.QueueRetransmission(&wire.MaxDataFrame{ByteOffset: 0x1234})
+			packer.QueueControlFrame(&wire.PingFrame{})
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			p, err := packer.PackPacket()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(1))
-			p := packets[0]
-			Expect(p.frames).To(HaveLen(3))
-			Expect(p.frames[1]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
-			Expect(p.frames[2]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
-			sf1 := p.frames[1].(*wire.StreamFrame)
-			sf2 := p.frames[2].(*wire.StreamFrame)
-			Expect(sf1.StreamID).To(Equal(protocol.StreamID(4)))
-			Expect(sf1.DataLenPresent).To(BeTrue())
-			Expect(sf2.StreamID).To(Equal(protocol.StreamID(5)))
-			Expect(sf2.DataLenPresent).To(BeFalse())
+			Expect(p.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+			Expect(p.containsRetransmission).To(BeFalse())
+			Expect(packer.RetransmissionQueueLength()).ToNot(BeZero())
 		})
 	})
 
@@ -1020,5 +1328,22 @@ var _ = Describe("Packet packer", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
 		})
+
+		It("increases the max packet size after path MTU discovery", func() {
+			for i := 0; i < 10*int(maxPacketSize); i++ {
+				packer.QueueControlFrame(&wire.PingFrame{})
+			}
+			mockStreamFramer.EXPECT().HasCryptoStreamData().AnyTimes()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).AnyTimes()
+			packer.IncreaseMaxPacketSize(maxPacketSize + 10)
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(int(maxPacketSize) + 10))
+			// IncreaseMaxPacketSize never reduces the max packet size
+			packer.IncreaseMaxPacketSize(maxPacketSize)
+			p, err = packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(int(maxPacketSize) + 10))
+		})
 	})
 })
@@ -73,7 +73,7 @@ var _ = Describe("Packet Unpacker (for IETF QUIC)", func() {
 
 	It("errors if the packet doesn't contain any payload", func() {
 		data := []byte("foobar")
-		aead.EXPECT().Open1RTT(gomock.Any(), []byte("foobar"), hdr.PacketNumber, hdr.Raw).Return([]byte{}, nil)
+		aead.EXPECT().Open1RTT(gomock.Any(), []byte("foobar"), hdr.PacketNumber, 0, hdr.Raw).Return([]byte{}, nil)
 		_, err := unpacker.Unpack(hdr.Raw, hdr, data)
 		Expect(err).To(MatchError(qerr.MissingPayload))
 	})
@@ -86,11 +86,19 @@ var _ = Describe("Packet Unpacker (for IETF QUIC)", func() {
 		Expect(packet.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
 	})
 
+	It("passes the key phase to the AEAD", func() {
+		hdr.KeyPhase = 1
+		aead.EXPECT().Open1RTT(gomock.Any(), gomock.Any(), hdr.PacketNumber, 1, hdr.Raw).Return([]byte{0}, nil)
+		packet, err := unpacker.Unpack(hdr.Raw, hdr, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packet.encryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+	})
+
 	It("unpacks the frames", func() {
 		buf := &bytes.Buffer{}
 		(&wire.PingFrame{}).Write(buf, versionIETFFrames)
 		(&wire.BlockedFrame{}).Write(buf, versionIETFFrames)
-		aead.EXPECT().Open1RTT(gomock.Any(), gomock.Any(), hdr.PacketNumber, hdr.Raw).Return(buf.Bytes(), nil)
+		aead.EXPECT().Open1RTT(gomock.Any(), gomock.Any(), hdr.PacketNumber, 0, hdr.Raw).Return(buf.Bytes(), nil)
 		packet, err := unpacker.Unpack(hdr.Raw, hdr, nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.frames).To(Equal([]wire.Frame{&wire.PingFrame{}, &wire.BlockedFrame{}}))
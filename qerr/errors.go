@@ -0,0 +1,195 @@
+package qerr
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A TransportError is returned when a connection is closed with a QUIC error code.
+// It can be compared to an ErrorCode using errors.Is.
+// It implements net.Error.
+type TransportError struct {
+	// Remote is set if the peer closed the connection.
+	Remote       bool
+	ErrorCode    ErrorCode
+	ErrorMessage string
+
+	// err is the local error that was converted to an InternalError, see NewInternalError
+	err error
+}
+
+// NewInternalError converts a local error, e.g. an error passed to Session.Close, to a TransportError with the InternalError code.
+// The local error can still be inspected using errors.Is and errors.As.
+func NewInternalError(err error) *TransportError {
+	return &TransportError{ErrorCode: InternalError, ErrorMessage: err.Error(), err: err}
+}
+
+var _ net.Error = &TransportError{}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode.String(), e.ErrorMessage)
+}
+
+// Timeout is always false. Timeouts are reported as an IdleTimeoutError or a HandshakeTimeoutError.
+func (e *TransportError) Timeout() bool { return false }
+
+// Temporary is always false.
+func (e *TransportError) Temporary() bool { return false }
+
+// Unwrap returns the local error, if the TransportError was created by NewInternalError.
+func (e *TransportError) Unwrap() error { return e.err }
+
+// Is says if the target is the ErrorCode of this error, or a QuicError with the same error code and message.
+func (e *TransportError) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrorCode:
+		return t == e.ErrorCode
+	case *QuicError:
+		return !t.isApplicationError && t.ErrorCode == e.ErrorCode && t.ErrorMessage == e.ErrorMessage
+	}
+	return false
+}
+
+// An ApplicationError is returned when a connection is closed with an error code defined by the application protocol.
+// It implements net.Error.
+type ApplicationError struct {
+	// Remote is set if the peer closed the connection.
+	Remote       bool
+	ErrorCode    ErrorCode
+	ErrorMessage string
+}
+
+var _ net.Error = &ApplicationError{}
+
+func (e *ApplicationError) Error() string {
+	if len(e.ErrorMessage) == 0 {
+		return fmt.Sprintf("Application error %#x", uint32(e.ErrorCode))
+	}
+	return fmt.Sprintf("Application error %#x: %s", uint32(e.ErrorCode), e.ErrorMessage)
+}
+
+// Timeout is always false.
+func (e *ApplicationError) Timeout() bool { return false }
+
+// Temporary is always false.
+func (e *ApplicationError) Temporary() bool { return false }
+
+// Is says if the target is an application error QuicError with the same error code and message.
+func (e *ApplicationError) Is(target error) bool {
+	t, ok := target.(*QuicError)
+	return ok && t.isApplicationError && t.ErrorCode == e.ErrorCode && t.ErrorMessage == e.ErrorMessage
+}
+
+// An IdleTimeoutError is returned when a connection is closed because there was no network activity for the idle timeout.
+// It implements net.Error.
+type IdleTimeoutError struct{}
+
+var _ net.Error = &IdleTimeoutError{}
+
+func (e *IdleTimeoutError) Error() string { return "timeout: no recent network activity" }
+
+// Timeout is always true.
+func (e *IdleTimeoutError) Timeout() bool { return true }
+
+// Temporary is always false.
+func (e *IdleTimeoutError) Temporary() bool { return false }
+
+// Is says if the target is an IdleTimeoutError, the NetworkIdleTimeout (or TimeoutsWithOpenStreams) error code,
+// or a QuicError with one of these error codes.
+func (e *IdleTimeoutError) Is(target error) bool {
+	if _, ok := target.(*IdleTimeoutError); ok {
+		return true
+	}
+	return hasErrorCode(target, NetworkIdleTimeout, TimeoutsWithOpenStreams)
+}
+
+// A HandshakeTimeoutError is returned when the handshake didn't complete within the handshake timeout.
+// It implements net.Error.
+type HandshakeTimeoutError struct{}
+
+var _ net.Error = &HandshakeTimeoutError{}
+
+func (e *HandshakeTimeoutError) Error() string { return "timeout: handshake did not complete in time" }
+
+// Timeout is always true.
+func (e *HandshakeTimeoutError) Timeout() bool { return true }
+
+// Temporary is always false.
+func (e *HandshakeTimeoutError) Temporary() bool { return false }
+
+// Is says if the target is a HandshakeTimeoutError, the HandshakeTimeout error code,
+// or a QuicError with this error code.
+func (e *HandshakeTimeoutError) Is(target error) bool {
+	if _, ok := target.(*HandshakeTimeoutError); ok {
+		return true
+	}
+	return hasErrorCode(target, HandshakeTimeout)
+}
+
+// A VersionNegotiationError is returned by the client when the server doesn't support any of the client's versions.
+type VersionNegotiationError struct {
+	// Ours are the versions supported by the client, Theirs the versions sent by the server in the Version Negotiation Packet.
+	Ours   []protocol.VersionNumber
+	Theirs []protocol.VersionNumber
+}
+
+var _ error = &VersionNegotiationError{}
+
+func (e *VersionNegotiationError) Error() string {
+	return fmt.Sprintf("no compatible QUIC version found (we support %s, server offered %s)", e.Ours, e.Theirs)
+}
+
+// Is says if the target is the InvalidVersion error code.
+func (e *VersionNegotiationError) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && code == InvalidVersion
+}
+
+// hasErrorCode says if the target is one of the error codes, or a QuicError with one of the error codes.
+func hasErrorCode(target error, codes ...ErrorCode) bool {
+	var code ErrorCode
+	switch t := target.(type) {
+	case ErrorCode:
+		code = t
+	case *QuicError:
+		if t.isApplicationError {
+			return false
+		}
+		code = t.ErrorCode
+	default:
+		return false
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ToPublicError converts the error that a connection was closed with to the error returned to the application.
+// QuicErrors and ErrorCodes are converted to a TransportError, an ApplicationError, an IdleTimeoutError or a HandshakeTimeoutError.
+// All other errors are returned unchanged.
+func ToPublicError(err error, remote bool) error {
+	var quicErr *QuicError
+	switch e := err.(type) {
+	case *QuicError:
+		quicErr = e
+	case ErrorCode:
+		quicErr = Error(e, "")
+	default:
+		return err
+	}
+	if quicErr.isApplicationError {
+		return &ApplicationError{Remote: remote, ErrorCode: quicErr.ErrorCode, ErrorMessage: quicErr.ErrorMessage}
+	}
+	switch quicErr.ErrorCode {
+	case NetworkIdleTimeout, TimeoutsWithOpenStreams:
+		return &IdleTimeoutError{}
+	case HandshakeTimeout:
+		return &HandshakeTimeoutError{}
+	}
+	return &TransportError{Remote: remote, ErrorCode: quicErr.ErrorCode, ErrorMessage: quicErr.ErrorMessage}
+}
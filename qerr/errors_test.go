@@ -0,0 +1,129 @@
+package qerr
+
+import (
+	"errors"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Public errors", func() {
+	Context("converting to public errors", func() {
+		It("converts transport errors", func() {
+			err := ToPublicError(Error(ProofInvalid, "foobar"), true)
+			Expect(err).To(Equal(&TransportError{Remote: true, ErrorCode: ProofInvalid, ErrorMessage: "foobar"}))
+			Expect(err.Error()).To(Equal("ProofInvalid: foobar"))
+			Expect(ToPublicError(PeerGoingAway, false)).To(Equal(&TransportError{ErrorCode: PeerGoingAway}))
+		})
+
+		It("converts application errors", func() {
+			err := ToPublicError(NewApplicationError(0x42, "foobar"), true)
+			Expect(err).To(Equal(&ApplicationError{Remote: true, ErrorCode: 0x42, ErrorMessage: "foobar"}))
+			Expect(err.Error()).To(Equal("Application error 0x42: foobar"))
+			Expect((&ApplicationError{ErrorCode: 0x42}).Error()).To(Equal("Application error 0x42"))
+		})
+
+		It("converts timeouts", func() {
+			Expect(ToPublicError(Error(NetworkIdleTimeout, "no activity"), false)).To(Equal(&IdleTimeoutError{}))
+			Expect(ToPublicError(TimeoutsWithOpenStreams, false)).To(Equal(&IdleTimeoutError{}))
+			Expect(ToPublicError(Error(HandshakeTimeout, "too slow"), true)).To(Equal(&HandshakeTimeoutError{}))
+			// an application error code that happens to have the same value is not a timeout
+			Expect(ToPublicError(NewApplicationError(NetworkIdleTimeout, ""), false)).To(BeAssignableToTypeOf(&ApplicationError{}))
+		})
+
+		It("leaves other errors unchanged", func() {
+			testErr := errors.New("test error")
+			Expect(ToPublicError(testErr, false)).To(Equal(testErr))
+			vnErr := &VersionNegotiationError{}
+			Expect(ToPublicError(vnErr, false)).To(Equal(vnErr))
+			Expect(ToPublicError(nil, false)).To(BeNil())
+		})
+
+		It("converts local errors to internal errors", func() {
+			testErr := errors.New("test error")
+			err := NewInternalError(testErr)
+			Expect(err.ErrorCode).To(Equal(InternalError))
+			Expect(err.Error()).To(Equal("InternalError: test error"))
+			Expect(errors.Is(err, testErr)).To(BeTrue())
+			Expect(errors.Is(err, InternalError)).To(BeTrue())
+			var netErr net.Error
+			Expect(errors.As(err, &netErr)).To(BeTrue())
+			Expect(netErr.Timeout()).To(BeFalse())
+		})
+
+		It("converts public errors back to QuicErrors", func() {
+			Expect(ToQuicError(&TransportError{ErrorCode: ProofInvalid, ErrorMessage: "foobar"})).To(Equal(Error(ProofInvalid, "foobar")))
+			Expect(ToQuicError(&ApplicationError{ErrorCode: 0x42, ErrorMessage: "foobar"})).To(Equal(NewApplicationError(0x42, "foobar")))
+			Expect(ToQuicError(&IdleTimeoutError{}).ErrorCode).To(Equal(NetworkIdleTimeout))
+			Expect(ToQuicError(&HandshakeTimeoutError{}).ErrorCode).To(Equal(HandshakeTimeout))
+			Expect(ToQuicError(&VersionNegotiationError{}).ErrorCode).To(Equal(InvalidVersion))
+		})
+	})
+
+	Context("errors.Is and errors.As", func() {
+		It("compares transport errors to error codes", func() {
+			var err error = &TransportError{ErrorCode: ProofInvalid, ErrorMessage: "foobar"}
+			Expect(errors.Is(err, ProofInvalid)).To(BeTrue())
+			Expect(errors.Is(err, PeerGoingAway)).To(BeFalse())
+			Expect(errors.Is(err, Error(ProofInvalid, "foobar"))).To(BeTrue())
+			Expect(errors.Is(err, Error(ProofInvalid, "other reason"))).To(BeFalse())
+			var transportErr *TransportError
+			Expect(errors.As(err, &transportErr)).To(BeTrue())
+			Expect(transportErr.ErrorCode).To(Equal(ProofInvalid))
+		})
+
+		It("doesn't compare application errors to error codes", func() {
+			var err error = &ApplicationError{ErrorCode: ProofInvalid, ErrorMessage: "foobar"}
+			Expect(errors.Is(err, ProofInvalid)).To(BeFalse())
+			Expect(errors.Is(err, NewApplicationError(ProofInvalid, "foobar"))).To(BeTrue())
+			Expect(errors.Is(err, Error(ProofInvalid, "foobar"))).To(BeFalse())
+			Expect(errors.Is(NewApplicationError(ProofInvalid, "foobar"), ProofInvalid)).To(BeFalse())
+		})
+
+		It("compares QuicErrors to error codes", func() {
+			Expect(errors.Is(Error(ProofInvalid, "foobar"), ProofInvalid)).To(BeTrue())
+			Expect(errors.Is(Error(ProofInvalid, "foobar"), PeerGoingAway)).To(BeFalse())
+		})
+
+		It("compares timeout errors", func() {
+			var err error = &IdleTimeoutError{}
+			Expect(errors.Is(err, &IdleTimeoutError{})).To(BeTrue())
+			Expect(errors.Is(err, NetworkIdleTimeout)).To(BeTrue())
+			Expect(errors.Is(err, Error(NetworkIdleTimeout, "foobar"))).To(BeTrue())
+			Expect(errors.Is(err, &HandshakeTimeoutError{})).To(BeFalse())
+			err = &HandshakeTimeoutError{}
+			Expect(errors.Is(err, &HandshakeTimeoutError{})).To(BeTrue())
+			Expect(errors.Is(err, HandshakeTimeout)).To(BeTrue())
+			Expect(errors.Is(err, NetworkIdleTimeout)).To(BeFalse())
+		})
+
+		It("says that timeouts are timeouts", func() {
+			for _, err := range []error{&IdleTimeoutError{}, &HandshakeTimeoutError{}} {
+				var netErr net.Error
+				Expect(errors.As(err, &netErr)).To(BeTrue())
+				Expect(netErr.Timeout()).To(BeTrue())
+				Expect(netErr.Temporary()).To(BeFalse())
+			}
+		})
+
+		It("says that transport and application errors are not timeouts", func() {
+			for _, err := range []error{&TransportError{ErrorCode: ProofInvalid}, &ApplicationError{ErrorCode: 0x42}} {
+				var netErr net.Error
+				Expect(errors.As(err, &netErr)).To(BeTrue())
+				Expect(netErr.Timeout()).To(BeFalse())
+				Expect(netErr.Temporary()).To(BeFalse())
+			}
+		})
+
+		It("compares version negotiation errors", func() {
+			err := &VersionNegotiationError{
+				Ours:   []protocol.VersionNumber{protocol.Version39},
+				Theirs: []protocol.VersionNumber{42},
+			}
+			Expect(errors.Is(err, InvalidVersion)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("no compatible QUIC version found"))
+		})
+	})
+})
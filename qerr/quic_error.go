@@ -15,6 +15,8 @@ func (e ErrorCode) Error() string {
 type QuicError struct {
 	ErrorCode    ErrorCode
 	ErrorMessage string
+
+	isApplicationError bool
 }
 
 // Error creates a new QuicError instance
@@ -25,12 +27,44 @@ func Error(errorCode ErrorCode, errorMessage string) *QuicError {
 	}
 }
 
+// NewApplicationError creates a new QuicError instance for an error that occurred on the application layer.
+// The error code is defined by the application protocol.
+func NewApplicationError(errorCode ErrorCode, errorMessage string) *QuicError {
+	return &QuicError{
+		ErrorCode:          errorCode,
+		ErrorMessage:       errorMessage,
+		isApplicationError: true,
+	}
+}
+
 func (e *QuicError) Error() string {
+	if e.isApplicationError {
+		if len(e.ErrorMessage) == 0 {
+			return fmt.Sprintf("Application error %#x", uint32(e.ErrorCode))
+		}
+		return fmt.Sprintf("Application error %#x: %s", uint32(e.ErrorCode), e.ErrorMessage)
+	}
 	return fmt.Sprintf("%s: %s", e.ErrorCode.String(), e.ErrorMessage)
 }
 
+// Is says if the target is the ErrorCode of this error.
+// Application errors never match an ErrorCode.
+func (e *QuicError) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && !e.isApplicationError && code == e.ErrorCode
+}
+
+// IsApplicationError says if this error was caused by the application,
+// i.e. if the ErrorCode is an application error code (and not a QUIC error code).
+func (e *QuicError) IsApplicationError() bool {
+	return e.isApplicationError
+}
+
 // Timeout says if this error is a timeout.
 func (e *QuicError) Timeout() bool {
+	if e.isApplicationError {
+		return false
+	}
 	switch e.ErrorCode {
 	case NetworkIdleTimeout,
 		HandshakeTimeout,
@@ -48,6 +82,16 @@ func ToQuicError(err error) *QuicError {
 		return e
 	case ErrorCode:
 		return Error(e, "")
+	case *TransportError:
+		return Error(e.ErrorCode, e.ErrorMessage)
+	case *ApplicationError:
+		return NewApplicationError(e.ErrorCode, e.ErrorMessage)
+	case *IdleTimeoutError:
+		return Error(NetworkIdleTimeout, e.Error())
+	case *HandshakeTimeoutError:
+		return Error(HandshakeTimeout, e.Error())
+	case *VersionNegotiationError:
+		return Error(InvalidVersion, e.Error())
 	}
 	return Error(InternalError, err.Error())
 }
@@ -12,6 +12,28 @@ var _ = Describe("Quic error", func() {
 		It("has a string representation", func() {
 			err := Error(DecryptionFailure, "foobar")
 			Expect(err.Error()).To(Equal("DecryptionFailure: foobar"))
+			Expect(err.IsApplicationError()).To(BeFalse())
+		})
+	})
+
+	Context("application errors", func() {
+		It("has a string representation", func() {
+			err := NewApplicationError(0x42, "foobar")
+			Expect(err.IsApplicationError()).To(BeTrue())
+			Expect(err.Error()).To(Equal("Application error 0x42: foobar"))
+		})
+
+		It("has a string representation for errors without a message", func() {
+			Expect(NewApplicationError(0x42, "").Error()).To(Equal("Application error 0x42"))
+		})
+
+		It("is never a timeout", func() {
+			Expect(NewApplicationError(NetworkIdleTimeout, "").Timeout()).To(BeFalse())
+		})
+
+		It("leaves application errors unchanged when converting to a QuicError", func() {
+			err := NewApplicationError(0x42, "foobar")
+			Expect(ToQuicError(err)).To(Equal(err))
 		})
 	})
 
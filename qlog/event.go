@@ -0,0 +1,137 @@
+package qlog
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+func milliseconds(d time.Duration) float64 { return float64(d.Nanoseconds()) / 1e6 }
+
+type eventDetails interface {
+	Category() category
+	Name() string
+}
+
+type event struct {
+	RelativeTime time.Duration
+	eventDetails
+}
+
+// MarshalJSON serializes the event in the order given by the event_fields of the trace
+func (e event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{
+		milliseconds(e.RelativeTime),
+		e.Category().String(),
+		e.Name(),
+		e.eventDetails,
+	})
+}
+
+type eventConnectionStarted struct {
+	IPVersion string `json:"ip_version,omitempty"`
+	SrcAddr   string `json:"src_ip"`
+	DestAddr  string `json:"dst_ip"`
+
+	Version    versionNumber `json:"quic_version"`
+	SrcConnID  connectionID  `json:"src_cid"`
+	DestConnID connectionID  `json:"dst_cid"`
+}
+
+func (e eventConnectionStarted) Category() category { return categoryConnectivity }
+func (e eventConnectionStarted) Name() string       { return "connection_started" }
+
+type eventConnectionClosed struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+func (e eventConnectionClosed) Category() category { return categoryConnectivity }
+func (e eventConnectionClosed) Name() string       { return "connection_closed" }
+
+type eventHandshakeCompleted struct{}
+
+func (e eventHandshakeCompleted) Category() category { return categorySecurity }
+func (e eventHandshakeCompleted) Name() string       { return "handshake_completed" }
+
+type eventTransportParameters struct {
+	Owner string `json:"owner"`
+
+	IdleTimeout                 float64            `json:"idle_timeout"` // in ms
+	MaxPacketSize               protocol.ByteCount `json:"max_packet_size,omitempty"`
+	StreamFlowControlWindow     protocol.ByteCount `json:"initial_max_stream_data"`
+	ConnectionFlowControlWindow protocol.ByteCount `json:"initial_max_data"`
+	MaxBidiStreams              uint16             `json:"initial_max_streams_bidi,omitempty"`
+	MaxUniStreams               uint16             `json:"initial_max_streams_uni,omitempty"`
+	MaxStreams                  uint32             `json:"max_streams,omitempty"` // only used for gQUIC
+	OmitConnectionID            bool               `json:"omit_connection_id,omitempty"`
+	MaxDatagramFrameSize        protocol.ByteCount `json:"max_datagram_frame_size,omitempty"`
+	MaxAckDelay                 float64            `json:"max_ack_delay,omitempty"` // in ms
+}
+
+func (e eventTransportParameters) Category() category { return categoryTransport }
+func (e eventTransportParameters) Name() string       { return "parameters_set" }
+
+type packetHeader struct {
+	PacketNumber protocol.PacketNumber `json:"packet_number"`
+	PacketSize   protocol.ByteCount    `json:"packet_size"`
+	Version      versionNumber         `json:"version,omitempty"`
+	SrcConnID    connectionID          `json:"scid,omitempty"`
+	DestConnID   connectionID          `json:"dcid,omitempty"`
+}
+
+type eventPacket struct {
+	sent bool
+
+	PacketType string        `json:"packet_type"`
+	Header     packetHeader  `json:"header"`
+	Frames     []interface{} `json:"frames"`
+}
+
+func (e eventPacket) Category() category { return categoryTransport }
+func (e eventPacket) Name() string {
+	if e.sent {
+		return "packet_sent"
+	}
+	return "packet_received"
+}
+
+type eventPacketDropped struct {
+	PacketType string             `json:"packet_type"`
+	PacketSize protocol.ByteCount `json:"packet_size"`
+	Trigger    string             `json:"trigger"`
+}
+
+func (e eventPacketDropped) Category() category { return categoryTransport }
+func (e eventPacketDropped) Name() string       { return "packet_dropped" }
+
+type eventPacketLost struct {
+	PacketType   string                `json:"packet_type"`
+	PacketNumber protocol.PacketNumber `json:"packet_number"`
+	Trigger      string                `json:"trigger"`
+}
+
+func (e eventPacketLost) Category() category { return categoryRecovery }
+func (e eventPacketLost) Name() string       { return "packet_lost" }
+
+type eventMetricsUpdated struct {
+	// all RTTs are in ms
+	MinRTT      float64 `json:"min_rtt"`
+	SmoothedRTT float64 `json:"smoothed_rtt"`
+	LatestRTT   float64 `json:"latest_rtt"`
+	RTTVariance float64 `json:"rtt_variance"`
+
+	CongestionWindow protocol.ByteCount `json:"congestion_window"`
+	BytesInFlight    protocol.ByteCount `json:"bytes_in_flight"`
+}
+
+func (e eventMetricsUpdated) Category() category { return categoryRecovery }
+func (e eventMetricsUpdated) Name() string       { return "metrics_updated" }
+
+type eventStreamStateUpdated struct {
+	StreamID protocol.StreamID `json:"stream_id"`
+	New      string            `json:"new"`
+}
+
+func (e eventStreamStateUpdated) Category() category { return categoryTransport }
+func (e eventStreamStateUpdated) Name() string       { return "stream_state_updated" }
@@ -0,0 +1,229 @@
+package qlog
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+type streamFrame struct {
+	FrameType string             `json:"frame_type"`
+	StreamID  protocol.StreamID  `json:"stream_id"`
+	Offset    protocol.ByteCount `json:"offset"`
+	Length    protocol.ByteCount `json:"length"`
+	Fin       bool               `json:"fin,omitempty"`
+}
+
+type ackFrame struct {
+	FrameType string `json:"frame_type"`
+	// the ACK delay, in ms
+	AckDelay    float64                    `json:"ack_delay,omitempty"`
+	AckedRanges [][2]protocol.PacketNumber `json:"acked_ranges"`
+	ECT0        uint64                     `json:"ect0,omitempty"`
+	ECT1        uint64                     `json:"ect1,omitempty"`
+	CE          uint64                     `json:"ce,omitempty"`
+}
+
+type resetStreamFrame struct {
+	FrameType string                        `json:"frame_type"`
+	StreamID  protocol.StreamID             `json:"stream_id"`
+	ErrorCode protocol.ApplicationErrorCode `json:"error_code"`
+	FinalSize protocol.ByteCount            `json:"final_size"`
+}
+
+type stopSendingFrame struct {
+	FrameType string                        `json:"frame_type"`
+	StreamID  protocol.StreamID             `json:"stream_id"`
+	ErrorCode protocol.ApplicationErrorCode `json:"error_code"`
+}
+
+type maxDataFrame struct {
+	FrameType string             `json:"frame_type"`
+	Maximum   protocol.ByteCount `json:"maximum"`
+}
+
+type maxStreamDataFrame struct {
+	FrameType string             `json:"frame_type"`
+	StreamID  protocol.StreamID  `json:"stream_id"`
+	Maximum   protocol.ByteCount `json:"maximum"`
+}
+
+type maxStreamsFrame struct {
+	FrameType string            `json:"frame_type"`
+	StreamID  protocol.StreamID `json:"stream_id"`
+}
+
+type dataBlockedFrame struct {
+	FrameType string             `json:"frame_type"`
+	Limit     protocol.ByteCount `json:"limit"`
+}
+
+type streamDataBlockedFrame struct {
+	FrameType string             `json:"frame_type"`
+	StreamID  protocol.StreamID  `json:"stream_id"`
+	Limit     protocol.ByteCount `json:"limit"`
+}
+
+type streamsBlockedFrame struct {
+	FrameType string            `json:"frame_type"`
+	StreamID  protocol.StreamID `json:"stream_id"`
+}
+
+type connectionCloseFrame struct {
+	FrameType string `json:"frame_type"`
+	ErrorCode uint32 `json:"error_code"`
+	Reason    string `json:"reason"`
+}
+
+type pathFrame struct {
+	FrameType string `json:"frame_type"`
+	Data      string `json:"data"`
+}
+
+type newTokenFrame struct {
+	FrameType string `json:"frame_type"`
+	Length    int    `json:"length"`
+	Token     string `json:"token"`
+}
+
+type newConnectionIDFrame struct {
+	FrameType           string `json:"frame_type"`
+	SequenceNumber      uint64 `json:"sequence_number"`
+	Length              int    `json:"length"`
+	ConnectionID        string `json:"connection_id"`
+	StatelessResetToken string `json:"stateless_reset_token"`
+}
+
+type retireConnectionIDFrame struct {
+	FrameType      string `json:"frame_type"`
+	SequenceNumber uint64 `json:"sequence_number"`
+}
+
+type datagramFrame struct {
+	FrameType string             `json:"frame_type"`
+	Length    protocol.ByteCount `json:"length"`
+}
+
+type stopWaitingFrame struct {
+	FrameType    string                `json:"frame_type"`
+	LeastUnacked protocol.PacketNumber `json:"least_unacked"`
+}
+
+type simpleFrame struct {
+	FrameType string `json:"frame_type"`
+}
+
+// transformFrame converts a frame to a value that is serialized to the qlog representation of the frame
+func transformFrame(f wire.Frame) interface{} {
+	switch f := f.(type) {
+	case *wire.StreamFrame:
+		return &streamFrame{
+			FrameType: "stream",
+			StreamID:  f.StreamID,
+			Offset:    f.Offset,
+			Length:    f.DataLen(),
+			Fin:       f.FinBit,
+		}
+	case *wire.AckFrame:
+		ranges := make([][2]protocol.PacketNumber, len(f.AckRanges))
+		for i, r := range f.AckRanges {
+			ranges[i] = [2]protocol.PacketNumber{r.Smallest, r.Largest}
+		}
+		return &ackFrame{
+			FrameType:   "ack",
+			AckDelay:    milliseconds(f.DelayTime),
+			AckedRanges: ranges,
+			ECT0:        f.ECT0,
+			ECT1:        f.ECT1,
+			CE:          f.ECNCE,
+		}
+	case *wire.RstStreamFrame:
+		return &resetStreamFrame{
+			FrameType: "reset_stream",
+			StreamID:  f.StreamID,
+			ErrorCode: f.ErrorCode,
+			FinalSize: f.ByteOffset,
+		}
+	case *wire.StopSendingFrame:
+		return &stopSendingFrame{
+			FrameType: "stop_sending",
+			StreamID:  f.StreamID,
+			ErrorCode: f.ErrorCode,
+		}
+	case *wire.MaxDataFrame:
+		return &maxDataFrame{FrameType: "max_data", Maximum: f.ByteOffset}
+	case *wire.MaxStreamDataFrame:
+		return &maxStreamDataFrame{
+			FrameType: "max_stream_data",
+			StreamID:  f.StreamID,
+			Maximum:   f.ByteOffset,
+		}
+	case *wire.MaxStreamIDFrame:
+		return &maxStreamsFrame{FrameType: "max_stream_id", StreamID: f.StreamID}
+	case *wire.BlockedFrame:
+		return &dataBlockedFrame{FrameType: "data_blocked", Limit: f.Offset}
+	case *wire.StreamBlockedFrame:
+		return &streamDataBlockedFrame{
+			FrameType: "stream_data_blocked",
+			StreamID:  f.StreamID,
+			Limit:     f.Offset,
+		}
+	case *wire.StreamIDBlockedFrame:
+		return &streamsBlockedFrame{FrameType: "stream_id_blocked", StreamID: f.StreamID}
+	case *wire.ConnectionCloseFrame:
+		frameType := "connection_close"
+		if f.IsApplicationError {
+			frameType = "application_close"
+		}
+		return &connectionCloseFrame{
+			FrameType: frameType,
+			ErrorCode: uint32(f.ErrorCode),
+			Reason:    f.ReasonPhrase,
+		}
+	case *wire.GoawayFrame:
+		return &connectionCloseFrame{
+			FrameType: "goaway",
+			ErrorCode: uint32(f.ErrorCode),
+			Reason:    f.ReasonPhrase,
+		}
+	case *wire.PathChallengeFrame:
+		return &pathFrame{FrameType: "path_challenge", Data: hex.EncodeToString(f.Data[:])}
+	case *wire.PathResponseFrame:
+		return &pathFrame{FrameType: "path_response", Data: hex.EncodeToString(f.Data[:])}
+	case *wire.NewTokenFrame:
+		return &newTokenFrame{
+			FrameType: "new_token",
+			Length:    len(f.Token),
+			Token:     hex.EncodeToString(f.Token),
+		}
+	case *wire.NewConnectionIDFrame:
+		return &newConnectionIDFrame{
+			FrameType:           "new_connection_id",
+			SequenceNumber:      f.SequenceNumber,
+			Length:              f.ConnectionID.Len(),
+			ConnectionID:        hex.EncodeToString(f.ConnectionID),
+			StatelessResetToken: hex.EncodeToString(f.StatelessResetToken[:]),
+		}
+	case *wire.RetireConnectionIDFrame:
+		return &retireConnectionIDFrame{FrameType: "retire_connection_id", SequenceNumber: f.SequenceNumber}
+	case *wire.DatagramFrame:
+		return &datagramFrame{FrameType: "datagram", Length: protocol.ByteCount(len(f.Data))}
+	case *wire.StopWaitingFrame:
+		return &stopWaitingFrame{FrameType: "stop_waiting", LeastUnacked: f.LeastUnacked}
+	case *wire.PingFrame:
+		return &simpleFrame{FrameType: "ping"}
+	default:
+		// gQUIC BLOCKED and WINDOW_UPDATE frames are converted to their IETF QUIC equivalents when parsing
+		return &simpleFrame{FrameType: fmt.Sprintf("unknown (%T)", f)}
+	}
+}
+
+func transformFrames(fs []wire.Frame) []interface{} {
+	frames := make([]interface{}, len(fs))
+	for i, f := range fs {
+		frames[i] = transformFrame(f)
+	}
+	return frames
+}
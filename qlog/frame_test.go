@@ -0,0 +1,287 @@
+package qlog
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Frames", func() {
+	check := func(f wire.Frame, expected map[string]interface{}) {
+		data, err := json.Marshal(transformFrame(f))
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		var m map[string]interface{}
+		ExpectWithOffset(1, json.Unmarshal(data, &m)).To(Succeed())
+		ExpectWithOffset(1, m).To(Equal(expected))
+	}
+
+	It("marshals STREAM frames", func() {
+		check(
+			&wire.StreamFrame{StreamID: 42, Offset: 1337, FinBit: true, Data: []byte("foobar")},
+			map[string]interface{}{
+				"frame_type": "stream",
+				"stream_id":  float64(42),
+				"offset":     float64(1337),
+				"length":     float64(6),
+				"fin":        true,
+			},
+		)
+	})
+
+	It("marshals STREAM frames without the FIN bit", func() {
+		check(
+			&wire.StreamFrame{StreamID: 42, Data: []byte("foo")},
+			map[string]interface{}{
+				"frame_type": "stream",
+				"stream_id":  float64(42),
+				"offset":     float64(0),
+				"length":     float64(3),
+			},
+		)
+	})
+
+	It("marshals ACK frames", func() {
+		check(
+			&wire.AckFrame{
+				DelayTime: 1500 * time.Microsecond,
+				AckRanges: []wire.AckRange{{Smallest: 10, Largest: 20}, {Smallest: 1, Largest: 5}},
+			},
+			map[string]interface{}{
+				"frame_type":   "ack",
+				"ack_delay":    1.5,
+				"acked_ranges": []interface{}{[]interface{}{float64(10), float64(20)}, []interface{}{float64(1), float64(5)}},
+			},
+		)
+	})
+
+	It("marshals ACK frames with ECN counts", func() {
+		check(
+			&wire.AckFrame{
+				AckRanges: []wire.AckRange{{Smallest: 1, Largest: 20}},
+				ECT0:      10,
+				ECT1:      1,
+				ECNCE:     3,
+			},
+			map[string]interface{}{
+				"frame_type":   "ack",
+				"acked_ranges": []interface{}{[]interface{}{float64(1), float64(20)}},
+				"ect0":         float64(10),
+				"ect1":         float64(1),
+				"ce":           float64(3),
+			},
+		)
+	})
+
+	It("marshals RST_STREAM frames", func() {
+		check(
+			&wire.RstStreamFrame{StreamID: 5, ErrorCode: 42, ByteOffset: 1234},
+			map[string]interface{}{
+				"frame_type": "reset_stream",
+				"stream_id":  float64(5),
+				"error_code": float64(42),
+				"final_size": float64(1234),
+			},
+		)
+	})
+
+	It("marshals STOP_SENDING frames", func() {
+		check(
+			&wire.StopSendingFrame{StreamID: 5, ErrorCode: 42},
+			map[string]interface{}{
+				"frame_type": "stop_sending",
+				"stream_id":  float64(5),
+				"error_code": float64(42),
+			},
+		)
+	})
+
+	It("marshals MAX_DATA frames", func() {
+		check(
+			&wire.MaxDataFrame{ByteOffset: 1337},
+			map[string]interface{}{
+				"frame_type": "max_data",
+				"maximum":    float64(1337),
+			},
+		)
+	})
+
+	It("marshals MAX_STREAM_DATA frames", func() {
+		check(
+			&wire.MaxStreamDataFrame{StreamID: 5, ByteOffset: 1337},
+			map[string]interface{}{
+				"frame_type": "max_stream_data",
+				"stream_id":  float64(5),
+				"maximum":    float64(1337),
+			},
+		)
+	})
+
+	It("marshals MAX_STREAM_ID frames", func() {
+		check(
+			&wire.MaxStreamIDFrame{StreamID: 42},
+			map[string]interface{}{
+				"frame_type": "max_stream_id",
+				"stream_id":  float64(42),
+			},
+		)
+	})
+
+	It("marshals BLOCKED frames", func() {
+		check(
+			&wire.BlockedFrame{Offset: 1337},
+			map[string]interface{}{
+				"frame_type": "data_blocked",
+				"limit":      float64(1337),
+			},
+		)
+	})
+
+	It("marshals STREAM_BLOCKED frames", func() {
+		check(
+			&wire.StreamBlockedFrame{StreamID: 5, Offset: 1337},
+			map[string]interface{}{
+				"frame_type": "stream_data_blocked",
+				"stream_id":  float64(5),
+				"limit":      float64(1337),
+			},
+		)
+	})
+
+	It("marshals STREAM_ID_BLOCKED frames", func() {
+		check(
+			&wire.StreamIDBlockedFrame{StreamID: 42},
+			map[string]interface{}{
+				"frame_type": "stream_id_blocked",
+				"stream_id":  float64(42),
+			},
+		)
+	})
+
+	It("marshals CONNECTION_CLOSE frames", func() {
+		check(
+			&wire.ConnectionCloseFrame{ErrorCode: qerr.PeerGoingAway, ReasonPhrase: "foobar"},
+			map[string]interface{}{
+				"frame_type": "connection_close",
+				"error_code": float64(qerr.PeerGoingAway),
+				"reason":     "foobar",
+			},
+		)
+	})
+
+	It("marshals APPLICATION_CLOSE frames", func() {
+		check(
+			&wire.ConnectionCloseFrame{IsApplicationError: true, ErrorCode: 0x42, ReasonPhrase: "foobar"},
+			map[string]interface{}{
+				"frame_type": "application_close",
+				"error_code": float64(0x42),
+				"reason":     "foobar",
+			},
+		)
+	})
+
+	It("marshals GOAWAY frames", func() {
+		check(
+			&wire.GoawayFrame{ErrorCode: qerr.PeerGoingAway, ReasonPhrase: "foobar"},
+			map[string]interface{}{
+				"frame_type": "goaway",
+				"error_code": float64(qerr.PeerGoingAway),
+				"reason":     "foobar",
+			},
+		)
+	})
+
+	It("marshals PATH_CHALLENGE frames", func() {
+		check(
+			&wire.PathChallengeFrame{Data: [8]byte{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}},
+			map[string]interface{}{
+				"frame_type": "path_challenge",
+				"data":       "deadbeefcafe1337",
+			},
+		)
+	})
+
+	It("marshals PATH_RESPONSE frames", func() {
+		check(
+			&wire.PathResponseFrame{Data: [8]byte{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}},
+			map[string]interface{}{
+				"frame_type": "path_response",
+				"data":       "deadbeefcafe1337",
+			},
+		)
+	})
+
+	It("marshals NEW_TOKEN frames", func() {
+		check(
+			&wire.NewTokenFrame{Token: []byte{0xde, 0xad, 0xbe, 0xef}},
+			map[string]interface{}{
+				"frame_type": "new_token",
+				"length":     float64(4),
+				"token":      "deadbeef",
+			},
+		)
+	})
+
+	It("marshals NEW_CONNECTION_ID frames", func() {
+		check(
+			&wire.NewConnectionIDFrame{
+				SequenceNumber:      42,
+				ConnectionID:        protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+				StatelessResetToken: protocol.StatelessResetToken{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0xa, 0xb, 0xc, 0xd, 0xe, 0xf},
+			},
+			map[string]interface{}{
+				"frame_type":            "new_connection_id",
+				"sequence_number":       float64(42),
+				"length":                float64(4),
+				"connection_id":         "deadbeef",
+				"stateless_reset_token": "000102030405060708090a0b0c0d0e0f",
+			},
+		)
+	})
+
+	It("marshals RETIRE_CONNECTION_ID frames", func() {
+		check(
+			&wire.RetireConnectionIDFrame{SequenceNumber: 1337},
+			map[string]interface{}{
+				"frame_type":      "retire_connection_id",
+				"sequence_number": float64(1337),
+			},
+		)
+	})
+
+	It("marshals DATAGRAM frames", func() {
+		check(
+			&wire.DatagramFrame{Data: []byte("foobar")},
+			map[string]interface{}{
+				"frame_type": "datagram",
+				"length":     float64(6),
+			},
+		)
+	})
+
+	It("marshals STOP_WAITING frames", func() {
+		check(
+			&wire.StopWaitingFrame{LeastUnacked: 42},
+			map[string]interface{}{
+				"frame_type":    "stop_waiting",
+				"least_unacked": float64(42),
+			},
+		)
+	})
+
+	It("marshals PING frames", func() {
+		check(&wire.PingFrame{}, map[string]interface{}{"frame_type": "ping"})
+	})
+
+	It("transforms multiple frames", func() {
+		frames := transformFrames([]wire.Frame{&wire.PingFrame{}, &wire.MaxDataFrame{ByteOffset: protocol.ByteCount(10)}})
+		Expect(frames).To(HaveLen(2))
+		Expect(frames[0]).To(Equal(&simpleFrame{FrameType: "ping"}))
+		Expect(frames[1]).To(Equal(&maxDataFrame{FrameType: "max_data", Maximum: 10}))
+	})
+})
@@ -0,0 +1,266 @@
+// Package qlog implements structured tracing of QUIC connections.
+// The traces are written in the qlog format (see https://tools.ietf.org/html/draft-marx-qlog-main-schema-01),
+// and can be visualized using tools like qvis.
+package qlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// A Tracer records events that occur on a QUIC connection.
+// It is safe for concurrent use.
+type Tracer interface {
+	// Export writes the trace to the io.WriteCloser, and closes it.
+	// It must be called exactly once, after the connection was closed.
+	Export() error
+	StartedConnection(t time.Time, local, remote net.Addr, version protocol.VersionNumber, srcConnID, destConnID protocol.ConnectionID)
+	ReceivedTransportParameters(time.Time, *handshake.TransportParameters)
+	CompletedHandshake(time.Time)
+	SentPacket(t time.Time, hdr *wire.Header, packetSize protocol.ByteCount, encLevel protocol.EncryptionLevel, frames []wire.Frame)
+	ReceivedPacket(t time.Time, hdr *wire.Header, packetSize protocol.ByteCount, encLevel protocol.EncryptionLevel, frames []wire.Frame)
+	DroppedPacket(t time.Time, hdr *wire.Header, packetSize protocol.ByteCount, reason PacketDropReason)
+	LostPacket(t time.Time, packetType protocol.PacketType, encLevel protocol.EncryptionLevel, pn protocol.PacketNumber)
+	// RetransmittedPacket is called after a packet carrying retransmitted data was sent.
+	RetransmittedPacket(t time.Time, pn protocol.PacketNumber)
+	UpdatedMetrics(t time.Time, rttStats *congestion.RTTStats, cwnd, bytesInFlight protocol.ByteCount)
+	UpdatedStreamState(time.Time, protocol.StreamID, StreamState)
+	ClosedConnection(t time.Time, reason error)
+}
+
+// The tracer writes the events while the connection is running, so they don't have to be kept in memory.
+// The writes are buffered, and the trace is completed by Export.
+type tracer struct {
+	mutex sync.Mutex
+
+	w           io.WriteCloser
+	bw          *bufio.Writer
+	err         error // the first error that occurred when writing the trace
+	perspective protocol.Perspective
+	odcid       protocol.ConnectionID
+
+	referenceTime time.Time
+	wroteEvent    bool
+}
+
+var _ Tracer = &tracer{}
+
+// NewTracer creates a new Tracer.
+// The odcid is the connection ID that identifies the connection in the trace. It is usually passed to the Config.GetLogWriter callback as well.
+func NewTracer(w io.WriteCloser, p protocol.Perspective, odcid protocol.ConnectionID) Tracer {
+	t := &tracer{
+		w:             w,
+		bw:            bufio.NewWriter(w),
+		perspective:   p,
+		odcid:         odcid,
+		referenceTime: time.Now(),
+	}
+	t.writeHeader()
+	return t
+}
+
+type topLevel struct {
+	QlogVersion string  `json:"qlog_version"`
+	Title       string  `json:"title"`
+	Traces      []trace `json:"traces"`
+}
+
+type trace struct {
+	VantagePoint struct {
+		Type string `json:"type"`
+	} `json:"vantage_point"`
+	CommonFields struct {
+		ODCID         connectionID `json:"ODCID"`
+		GroupID       connectionID `json:"group_id"`
+		ReferenceTime float64      `json:"reference_time"` // in ms since the Unix epoch
+	} `json:"common_fields"`
+	EventFields []string `json:"event_fields"`
+	// The events are written separately, as the last field of the trace.
+}
+
+// writeHeader writes the trace up to the start of the events array
+func (t *tracer) writeHeader() {
+	tr := trace{EventFields: []string{"relative_time", "category", "event", "data"}}
+	tr.VantagePoint.Type = vantagePoint(t.perspective).String()
+	tr.CommonFields.ODCID = connectionID(t.odcid)
+	tr.CommonFields.GroupID = connectionID(t.odcid)
+	tr.CommonFields.ReferenceTime = float64(t.referenceTime.UnixNano()) / 1e6
+	header, err := json.Marshal(&topLevel{
+		QlogVersion: "draft-01",
+		Title:       "quic-go qlog",
+		Traces:      []trace{tr},
+	})
+	if err != nil {
+		t.err = err
+		return
+	}
+	// remove the closing brackets of the trace, the traces and the top level object, and open the events array
+	header = header[:len(header)-len("}]}")]
+	t.write(append(header, `,"events":[`...))
+}
+
+// write writes to the buffered writer, unless an error occurred before
+func (t *tracer) write(b []byte) {
+	if t.err != nil {
+		return
+	}
+	_, t.err = t.bw.Write(b)
+}
+
+func (t *tracer) Export() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.write([]byte("]}]}\n"))
+	if t.err == nil {
+		t.err = t.bw.Flush()
+	}
+	if t.err != nil {
+		t.w.Close()
+		return t.err
+	}
+	return t.w.Close()
+}
+
+func (t *tracer) recordEvent(eventTime time.Time, details eventDetails) {
+	data, err := json.Marshal(event{
+		RelativeTime: eventTime.Sub(t.referenceTime),
+		eventDetails: details,
+	})
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err != nil {
+		if t.err == nil {
+			t.err = err
+		}
+		return
+	}
+	if t.wroteEvent {
+		t.write([]byte{','})
+	}
+	t.wroteEvent = true
+	t.write(data)
+}
+
+func (t *tracer) StartedConnection(eventTime time.Time, local, remote net.Addr, version protocol.VersionNumber, srcConnID, destConnID protocol.ConnectionID) {
+	e := eventConnectionStarted{
+		SrcAddr:    local.String(),
+		DestAddr:   remote.String(),
+		Version:    versionNumber(version),
+		SrcConnID:  connectionID(srcConnID),
+		DestConnID: connectionID(destConnID),
+	}
+	if udpAddr, ok := local.(*net.UDPAddr); ok {
+		if udpAddr.IP.To4() != nil {
+			e.IPVersion = "ipv4"
+		} else {
+			e.IPVersion = "ipv6"
+		}
+	}
+	t.recordEvent(eventTime, e)
+}
+
+func (t *tracer) ReceivedTransportParameters(eventTime time.Time, p *handshake.TransportParameters) {
+	t.recordEvent(eventTime, eventTransportParameters{
+		Owner:                       "remote",
+		IdleTimeout:                 milliseconds(p.IdleTimeout),
+		MaxPacketSize:               p.MaxPacketSize,
+		StreamFlowControlWindow:     p.StreamFlowControlWindow,
+		ConnectionFlowControlWindow: p.ConnectionFlowControlWindow,
+		MaxBidiStreams:              p.MaxBidiStreams,
+		MaxUniStreams:               p.MaxUniStreams,
+		MaxStreams:                  p.MaxStreams,
+		OmitConnectionID:            p.OmitConnectionID,
+		MaxDatagramFrameSize:        p.MaxDatagramFrameSize,
+		MaxAckDelay:                 milliseconds(p.MaxAckDelay),
+	})
+}
+
+func (t *tracer) CompletedHandshake(eventTime time.Time) {
+	t.recordEvent(eventTime, eventHandshakeCompleted{})
+}
+
+func (t *tracer) SentPacket(eventTime time.Time, hdr *wire.Header, packetSize protocol.ByteCount, encLevel protocol.EncryptionLevel, frames []wire.Frame) {
+	t.recordEvent(eventTime, newPacketEvent(true, hdr, packetSize, encLevel, frames))
+}
+
+func (t *tracer) ReceivedPacket(eventTime time.Time, hdr *wire.Header, packetSize protocol.ByteCount, encLevel protocol.EncryptionLevel, frames []wire.Frame) {
+	t.recordEvent(eventTime, newPacketEvent(false, hdr, packetSize, encLevel, frames))
+}
+
+func newPacketEvent(sent bool, hdr *wire.Header, packetSize protocol.ByteCount, encLevel protocol.EncryptionLevel, frames []wire.Frame) eventPacket {
+	e := eventPacket{
+		sent:       sent,
+		PacketType: getPacketType(hdr, encLevel).String(),
+		Header: packetHeader{
+			PacketNumber: hdr.PacketNumber,
+			PacketSize:   packetSize,
+			SrcConnID:    connectionID(hdr.SrcConnectionID),
+			DestConnID:   connectionID(hdr.DestConnectionID),
+		},
+		Frames: transformFrames(frames),
+	}
+	if hdr.IsLongHeader || hdr.VersionFlag {
+		e.Header.Version = versionNumber(hdr.Version)
+	}
+	return e
+}
+
+func (t *tracer) DroppedPacket(eventTime time.Time, hdr *wire.Header, packetSize protocol.ByteCount, reason PacketDropReason) {
+	t.recordEvent(eventTime, eventPacketDropped{
+		// the packet wasn't decrypted, so its encryption level is unknown
+		PacketType: getPacketType(hdr, protocol.EncryptionUnspecified).String(),
+		PacketSize: packetSize,
+		Trigger:    reason.String(),
+	})
+}
+
+func (t *tracer) LostPacket(eventTime time.Time, packetType protocol.PacketType, encLevel protocol.EncryptionLevel, pn protocol.PacketNumber) {
+	t.recordEvent(eventTime, eventPacketLost{
+		PacketType:   getPacketTypeFromLongHeaderType(packetType, encLevel).String(),
+		PacketNumber: pn,
+		// quic-go only uses time threshold loss detection
+		Trigger: "time_threshold",
+	})
+}
+
+// RetransmittedPacket doesn't record an event, since qlog doesn't define one for retransmissions.
+// The frames of the packet are already recorded by SentPacket.
+func (t *tracer) RetransmittedPacket(time.Time, protocol.PacketNumber) {}
+
+func (t *tracer) UpdatedMetrics(eventTime time.Time, rttStats *congestion.RTTStats, cwnd, bytesInFlight protocol.ByteCount) {
+	t.recordEvent(eventTime, eventMetricsUpdated{
+		MinRTT:           milliseconds(rttStats.MinRTT()),
+		SmoothedRTT:      milliseconds(rttStats.SmoothedRTT()),
+		LatestRTT:        milliseconds(rttStats.LatestRTT()),
+		RTTVariance:      milliseconds(rttStats.MeanDeviation()),
+		CongestionWindow: cwnd,
+		BytesInFlight:    bytesInFlight,
+	})
+}
+
+func (t *tracer) UpdatedStreamState(eventTime time.Time, id protocol.StreamID, state StreamState) {
+	t.recordEvent(eventTime, eventStreamStateUpdated{
+		StreamID: id,
+		New:      state.String(),
+	})
+}
+
+func (t *tracer) ClosedConnection(eventTime time.Time, reason error) {
+	var e eventConnectionClosed
+	if reason != nil {
+		e.Reason = reason.Error()
+	}
+	t.recordEvent(eventTime, e)
+}
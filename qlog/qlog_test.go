@@ -0,0 +1,323 @@
+package qlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type limitedWriter struct {
+	bytes.Buffer
+	limit  int
+	closed bool
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.limit > 0 && w.Len()+len(p) > w.limit {
+		return 0, errors.New("writer full")
+	}
+	return w.Buffer.Write(p)
+}
+
+func (w *limitedWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+var _ = Describe("Tracer", func() {
+	var (
+		tracer Tracer
+		buf    *limitedWriter
+	)
+
+	BeforeEach(func() {
+		buf = &limitedWriter{}
+		tracer = NewTracer(buf, protocol.PerspectiveServer, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+	})
+
+	exportAndParseTrace := func() map[string]interface{} {
+		ExpectWithOffset(1, tracer.Export()).To(Succeed())
+		ExpectWithOffset(1, buf.closed).To(BeTrue())
+		m := make(map[string]interface{})
+		ExpectWithOffset(1, json.Unmarshal(buf.Bytes(), &m)).To(Succeed())
+		ExpectWithOffset(1, m).To(HaveKey("traces"))
+		traces := m["traces"].([]interface{})
+		ExpectWithOffset(1, traces).To(HaveLen(1))
+		return traces[0].(map[string]interface{})
+	}
+
+	type entry struct {
+		Time     float64
+		Category string
+		Name     string
+		Event    map[string]interface{}
+	}
+
+	exportAndParseEvents := func() []entry {
+		trace := exportAndParseTrace()
+		ExpectWithOffset(1, trace).To(HaveKey("events"))
+		var entries []entry
+		for _, e := range trace["events"].([]interface{}) {
+			ev := e.([]interface{})
+			ExpectWithOffset(1, ev).To(HaveLen(4))
+			entries = append(entries, entry{
+				Time:     ev[0].(float64),
+				Category: ev[1].(string),
+				Name:     ev[2].(string),
+				Event:    ev[3].(map[string]interface{}),
+			})
+		}
+		return entries
+	}
+
+	exportAndParseSingleEvent := func() entry {
+		entries := exportAndParseEvents()
+		ExpectWithOffset(1, entries).To(HaveLen(1))
+		return entries[0]
+	}
+
+	It("exports a trace that has the right metadata", func() {
+		m := make(map[string]interface{})
+		Expect(tracer.Export()).To(Succeed())
+		Expect(json.Unmarshal(buf.Bytes(), &m)).To(Succeed())
+		Expect(m).To(HaveKeyWithValue("qlog_version", "draft-01"))
+		Expect(m).To(HaveKeyWithValue("title", "quic-go qlog"))
+		trace := m["traces"].([]interface{})[0].(map[string]interface{})
+		Expect(trace).To(HaveKeyWithValue("vantage_point", map[string]interface{}{"type": "server"}))
+		Expect(trace).To(HaveKeyWithValue("event_fields", []interface{}{"relative_time", "category", "event", "data"}))
+		commonFields := trace["common_fields"].(map[string]interface{})
+		Expect(commonFields).To(HaveKeyWithValue("ODCID", "deadbeef"))
+		Expect(commonFields).To(HaveKeyWithValue("group_id", "deadbeef"))
+		Expect(commonFields).To(HaveKey("reference_time"))
+		referenceTime := time.Unix(0, int64(commonFields["reference_time"].(float64)*1e6))
+		Expect(referenceTime).To(BeTemporally("~", time.Now(), 100*time.Millisecond))
+		Expect(trace["events"]).To(BeEmpty())
+	})
+
+	It("uses the right vantage point for clients", func() {
+		tracer = NewTracer(buf, protocol.PerspectiveClient, protocol.ConnectionID{1, 2, 3, 4})
+		trace := exportAndParseTrace()
+		Expect(trace).To(HaveKeyWithValue("vantage_point", map[string]interface{}{"type": "client"}))
+	})
+
+	It("returns errors that occur when writing the trace", func() {
+		buf.limit = 10
+		Expect(tracer.Export()).To(MatchError("writer full"))
+		Expect(buf.closed).To(BeTrue())
+	})
+
+	It("writes the events while the connection is running", func() {
+		for i := 0; i < 1000; i++ {
+			tracer.LostPacket(time.Now(), 0, protocol.EncryptionForwardSecure, protocol.PacketNumber(i))
+		}
+		// the trace is incomplete, but some events were already written
+		Expect(buf.Len()).ToNot(BeZero())
+		Expect(json.Valid(buf.Bytes())).To(BeFalse())
+		entries := exportAndParseEvents()
+		Expect(entries).To(HaveLen(1000))
+		for i, entry := range entries {
+			Expect(entry.Event).To(HaveKeyWithValue("packet_number", float64(i)))
+		}
+	})
+
+	It("returns errors that occur when writing events", func() {
+		buf.limit = 1000
+		for i := 0; i < 1000; i++ {
+			tracer.LostPacket(time.Now(), 0, protocol.EncryptionForwardSecure, protocol.PacketNumber(i))
+		}
+		Expect(tracer.Export()).To(MatchError("writer full"))
+		Expect(buf.closed).To(BeTrue())
+	})
+
+	It("records the time relative to the reference time", func() {
+		tracer.CompletedHandshake(time.Now().Add(1337 * time.Millisecond))
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Time).To(BeNumerically("~", 1337, 10))
+	})
+
+	It("records connection starts", func() {
+		tracer.StartedConnection(
+			time.Now(),
+			&net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 42},
+			&net.UDPAddr{IP: net.IPv4(192, 168, 12, 34), Port: 24},
+			protocol.VersionNumber(0xdecafbad),
+			protocol.ConnectionID{1, 2, 3, 4},
+			protocol.ConnectionID{5, 6, 7, 8},
+		)
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("connectivity"))
+		Expect(entry.Name).To(Equal("connection_started"))
+		ev := entry.Event
+		Expect(ev).To(HaveKeyWithValue("ip_version", "ipv4"))
+		Expect(ev).To(HaveKeyWithValue("src_ip", "192.168.13.37:42"))
+		Expect(ev).To(HaveKeyWithValue("dst_ip", "192.168.12.34:24"))
+		Expect(ev).To(HaveKeyWithValue("quic_version", "decafbad"))
+		Expect(ev).To(HaveKeyWithValue("src_cid", "01020304"))
+		Expect(ev).To(HaveKeyWithValue("dst_cid", "05060708"))
+	})
+
+	It("records received transport parameters", func() {
+		tracer.ReceivedTransportParameters(time.Now(), &handshake.TransportParameters{
+			IdleTimeout:                 42 * time.Second,
+			MaxPacketSize:               1234,
+			StreamFlowControlWindow:     0x1000,
+			ConnectionFlowControlWindow: 0x2000,
+			MaxBidiStreams:              10,
+			MaxUniStreams:               20,
+			MaxDatagramFrameSize:        1000,
+			MaxAckDelay:                 30 * time.Millisecond,
+		})
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("transport"))
+		Expect(entry.Name).To(Equal("parameters_set"))
+		ev := entry.Event
+		Expect(ev).To(HaveKeyWithValue("owner", "remote"))
+		Expect(ev).To(HaveKeyWithValue("idle_timeout", float64(42000)))
+		Expect(ev).To(HaveKeyWithValue("max_packet_size", float64(1234)))
+		Expect(ev).To(HaveKeyWithValue("initial_max_stream_data", float64(0x1000)))
+		Expect(ev).To(HaveKeyWithValue("initial_max_data", float64(0x2000)))
+		Expect(ev).To(HaveKeyWithValue("initial_max_streams_bidi", float64(10)))
+		Expect(ev).To(HaveKeyWithValue("initial_max_streams_uni", float64(20)))
+		Expect(ev).To(HaveKeyWithValue("max_datagram_frame_size", float64(1000)))
+		Expect(ev).To(HaveKeyWithValue("max_ack_delay", float64(30)))
+		Expect(ev).ToNot(HaveKey("max_streams"))
+		Expect(ev).ToNot(HaveKey("omit_connection_id"))
+	})
+
+	It("records handshake completion", func() {
+		tracer.CompletedHandshake(time.Now())
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("security"))
+		Expect(entry.Name).To(Equal("handshake_completed"))
+		Expect(entry.Event).To(BeEmpty())
+	})
+
+	It("records sent packets", func() {
+		tracer.SentPacket(
+			time.Now(),
+			&wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				PacketNumber:     1337,
+				Version:          protocol.VersionTLS,
+				SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+				DestConnectionID: protocol.ConnectionID{5, 6, 7, 8},
+			},
+			987,
+			protocol.EncryptionUnencrypted,
+			[]wire.Frame{&wire.MaxStreamDataFrame{StreamID: 42, ByteOffset: 987}},
+		)
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("transport"))
+		Expect(entry.Name).To(Equal("packet_sent"))
+		ev := entry.Event
+		Expect(ev).To(HaveKeyWithValue("packet_type", "handshake"))
+		hdr := ev["header"].(map[string]interface{})
+		Expect(hdr).To(HaveKeyWithValue("packet_number", float64(1337)))
+		Expect(hdr).To(HaveKeyWithValue("packet_size", float64(987)))
+		Expect(hdr).To(HaveKeyWithValue("scid", "01020304"))
+		Expect(hdr).To(HaveKeyWithValue("dcid", "05060708"))
+		Expect(hdr).To(HaveKeyWithValue("version", fmt.Sprintf("%x", uint32(protocol.VersionTLS))))
+		frames := ev["frames"].([]interface{})
+		Expect(frames).To(HaveLen(1))
+		Expect(frames[0]).To(HaveKeyWithValue("frame_type", "max_stream_data"))
+	})
+
+	It("records received packets", func() {
+		tracer.ReceivedPacket(
+			time.Now(),
+			&wire.Header{
+				PacketNumber:     42,
+				DestConnectionID: protocol.ConnectionID{5, 6, 7, 8},
+			},
+			123,
+			protocol.EncryptionForwardSecure,
+			[]wire.Frame{&wire.PingFrame{}, &wire.MaxDataFrame{ByteOffset: 1000}},
+		)
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("transport"))
+		Expect(entry.Name).To(Equal("packet_received"))
+		ev := entry.Event
+		Expect(ev).To(HaveKeyWithValue("packet_type", "1RTT"))
+		hdr := ev["header"].(map[string]interface{})
+		Expect(hdr).To(HaveKeyWithValue("packet_number", float64(42)))
+		Expect(hdr).To(HaveKeyWithValue("packet_size", float64(123)))
+		Expect(hdr).To(HaveKeyWithValue("dcid", "05060708"))
+		Expect(hdr).ToNot(HaveKey("scid"))
+		Expect(hdr).ToNot(HaveKey("version"))
+		Expect(ev["frames"]).To(HaveLen(2))
+	})
+
+	It("records dropped packets", func() {
+		hdr := &wire.Header{IsLongHeader: true, Type: protocol.PacketTypeHandshake, PacketNumber: 1337}
+		tracer.DroppedPacket(time.Now(), hdr, 1234, PacketDropKeyUnavailable)
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("transport"))
+		Expect(entry.Name).To(Equal("packet_dropped"))
+		ev := entry.Event
+		Expect(ev).To(HaveKeyWithValue("packet_type", "handshake"))
+		Expect(ev).To(HaveKeyWithValue("packet_size", float64(1234)))
+		Expect(ev).To(HaveKeyWithValue("trigger", "key_unavailable"))
+	})
+
+	It("records lost packets", func() {
+		tracer.LostPacket(time.Now(), 0, protocol.EncryptionForwardSecure, 42)
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("recovery"))
+		Expect(entry.Name).To(Equal("packet_lost"))
+		ev := entry.Event
+		Expect(ev).To(HaveKeyWithValue("packet_type", "1RTT"))
+		Expect(ev).To(HaveKeyWithValue("packet_number", float64(42)))
+		Expect(ev).To(HaveKeyWithValue("trigger", "time_threshold"))
+	})
+
+	It("records metrics updates", func() {
+		rttStats := &congestion.RTTStats{}
+		rttStats.UpdateRTT(15*time.Millisecond, 0, time.Now())
+		rttStats.UpdateRTT(25*time.Millisecond, 0, time.Now())
+		tracer.UpdatedMetrics(time.Now(), rttStats, 4321, 1234)
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("recovery"))
+		Expect(entry.Name).To(Equal("metrics_updated"))
+		ev := entry.Event
+		Expect(ev).To(HaveKeyWithValue("min_rtt", float64(15)))
+		Expect(ev).To(HaveKeyWithValue("latest_rtt", float64(25)))
+		Expect(ev).To(HaveKey("smoothed_rtt"))
+		Expect(ev["smoothed_rtt"]).To(BeNumerically("~", milliseconds(rttStats.SmoothedRTT()), 0.01))
+		Expect(ev["rtt_variance"]).To(BeNumerically("~", milliseconds(rttStats.MeanDeviation()), 0.01))
+		Expect(ev).To(HaveKeyWithValue("congestion_window", float64(4321)))
+		Expect(ev).To(HaveKeyWithValue("bytes_in_flight", float64(1234)))
+	})
+
+	It("records stream state updates", func() {
+		tracer.UpdatedStreamState(time.Now(), 5, StreamStateOpen)
+		tracer.UpdatedStreamState(time.Now(), 5, StreamStateClosed)
+		entries := exportAndParseEvents()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Category).To(Equal("transport"))
+		Expect(entries[0].Name).To(Equal("stream_state_updated"))
+		Expect(entries[0].Event).To(HaveKeyWithValue("stream_id", float64(5)))
+		Expect(entries[0].Event).To(HaveKeyWithValue("new", "open"))
+		Expect(entries[1].Event).To(HaveKeyWithValue("stream_id", float64(5)))
+		Expect(entries[1].Event).To(HaveKeyWithValue("new", "closed"))
+	})
+
+	It("records connection closes", func() {
+		tracer.ClosedConnection(time.Now(), errors.New("test error"))
+		entry := exportAndParseSingleEvent()
+		Expect(entry.Category).To(Equal("connectivity"))
+		Expect(entry.Name).To(Equal("connection_closed"))
+		Expect(entry.Event).To(HaveKeyWithValue("reason", "test error"))
+	})
+})
@@ -0,0 +1,185 @@
+package qlog
+
+import (
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+type category uint8
+
+const (
+	categoryConnectivity category = iota
+	categoryTransport
+	categorySecurity
+	categoryRecovery
+)
+
+func (c category) String() string {
+	switch c {
+	case categoryConnectivity:
+		return "connectivity"
+	case categoryTransport:
+		return "transport"
+	case categorySecurity:
+		return "security"
+	case categoryRecovery:
+		return "recovery"
+	default:
+		panic("unknown category")
+	}
+}
+
+type vantagePoint protocol.Perspective
+
+func (p vantagePoint) String() string {
+	switch protocol.Perspective(p) {
+	case protocol.PerspectiveServer:
+		return "server"
+	case protocol.PerspectiveClient:
+		return "client"
+	default:
+		panic("unknown perspective")
+	}
+}
+
+type packetType uint8
+
+const (
+	packetTypeInitial packetType = iota
+	packetTypeHandshake
+	packetTypeRetry
+	packetType0RTT
+	packetType1RTT
+	packetTypeVersionNegotiation
+)
+
+func getPacketType(hdr *wire.Header, encLevel protocol.EncryptionLevel) packetType {
+	if hdr.IsVersionNegotiation {
+		return packetTypeVersionNegotiation
+	}
+	var longHeaderType protocol.PacketType
+	if hdr.IsLongHeader {
+		longHeaderType = hdr.Type
+	}
+	return getPacketTypeFromLongHeaderType(longHeaderType, encLevel)
+}
+
+// getPacketTypeFromLongHeaderType determines the qlog packet type.
+// The longHeaderType is 0 for packets sent with a short header.
+// For gQUIC, which doesn't have packet types, the type is derived from the encryption level.
+func getPacketTypeFromLongHeaderType(longHeaderType protocol.PacketType, encLevel protocol.EncryptionLevel) packetType {
+	switch longHeaderType {
+	case protocol.PacketTypeInitial:
+		return packetTypeInitial
+	case protocol.PacketTypeHandshake:
+		return packetTypeHandshake
+	case protocol.PacketTypeRetry:
+		return packetTypeRetry
+	case protocol.PacketType0RTT:
+		return packetType0RTT
+	}
+	switch encLevel {
+	case protocol.EncryptionUnencrypted:
+		return packetTypeInitial
+	case protocol.EncryptionSecure:
+		return packetType0RTT
+	default:
+		return packetType1RTT
+	}
+}
+
+// PacketTypeName returns the name of the packet type, as logged in packet events, e.g. "initial" or "1RTT".
+func PacketTypeName(hdr *wire.Header, encLevel protocol.EncryptionLevel) string {
+	return getPacketType(hdr, encLevel).String()
+}
+
+func (t packetType) String() string {
+	switch t {
+	case packetTypeInitial:
+		return "initial"
+	case packetTypeHandshake:
+		return "handshake"
+	case packetTypeRetry:
+		return "retry"
+	case packetType0RTT:
+		return "0RTT"
+	case packetType1RTT:
+		return "1RTT"
+	case packetTypeVersionNegotiation:
+		return "version_negotiation"
+	default:
+		panic("unknown packet type")
+	}
+}
+
+// A StreamState is the state of a stream, as logged in a stream_state_updated event
+type StreamState uint8
+
+const (
+	// StreamStateOpen means that the stream was opened
+	StreamStateOpen StreamState = iota
+	// StreamStateClosed means that the stream was closed, and all its state was deleted
+	StreamStateClosed
+)
+
+func (s StreamState) String() string {
+	switch s {
+	case StreamStateOpen:
+		return "open"
+	case StreamStateClosed:
+		return "closed"
+	default:
+		panic("unknown stream state")
+	}
+}
+
+// A PacketDropReason is the reason why a packet was dropped, as logged in a packet_dropped event
+type PacketDropReason uint8
+
+const (
+	// PacketDropKeyUnavailable means that the keys to decrypt the packet didn't become available in time
+	PacketDropKeyUnavailable PacketDropReason = iota
+	// PacketDropPayloadDecryptError means that the packet couldn't be decrypted after the handshake completed
+	PacketDropPayloadDecryptError
+	// PacketDropDOSPrevention means that the packet was dropped because a queue was full
+	PacketDropDOSPrevention
+	// PacketDropUnknownConnectionID means that the server received a packet for a connection it doesn't know
+	PacketDropUnknownConnectionID
+	// PacketDropUnexpectedPacket means that the packet was not expected in the current state of the connection
+	PacketDropUnexpectedPacket
+)
+
+func (r PacketDropReason) String() string {
+	switch r {
+	case PacketDropKeyUnavailable:
+		return "key_unavailable"
+	case PacketDropPayloadDecryptError:
+		return "payload_decrypt_error"
+	case PacketDropDOSPrevention:
+		return "dos_prevention"
+	case PacketDropUnknownConnectionID:
+		return "unknown_connection_id"
+	case PacketDropUnexpectedPacket:
+		return "unexpected_packet"
+	default:
+		panic("unknown packet drop reason")
+	}
+}
+
+type connectionID protocol.ConnectionID
+
+func (c connectionID) String() string {
+	return fmt.Sprintf("%x", []byte(c))
+}
+
+func (c connectionID) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + c.String() + `"`), nil
+}
+
+type versionNumber protocol.VersionNumber
+
+func (v versionNumber) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%x"`, uint32(v))), nil
+}
@@ -0,0 +1,73 @@
+package qlog
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Types", func() {
+	It("has a string representation for the category", func() {
+		Expect(categoryConnectivity.String()).To(Equal("connectivity"))
+		Expect(categoryTransport.String()).To(Equal("transport"))
+		Expect(categorySecurity.String()).To(Equal("security"))
+		Expect(categoryRecovery.String()).To(Equal("recovery"))
+	})
+
+	It("has a string representation for the vantage point", func() {
+		Expect(vantagePoint(protocol.PerspectiveServer).String()).To(Equal("server"))
+		Expect(vantagePoint(protocol.PerspectiveClient).String()).To(Equal("client"))
+	})
+
+	Context("packet types", func() {
+		It("determines the packet type of Long Header packets", func() {
+			Expect(getPacketType(&wire.Header{IsLongHeader: true, Type: protocol.PacketTypeInitial}, protocol.EncryptionUnencrypted)).To(Equal(packetTypeInitial))
+			Expect(getPacketType(&wire.Header{IsLongHeader: true, Type: protocol.PacketTypeHandshake}, protocol.EncryptionUnencrypted)).To(Equal(packetTypeHandshake))
+			Expect(getPacketType(&wire.Header{IsLongHeader: true, Type: protocol.PacketTypeRetry}, protocol.EncryptionUnencrypted)).To(Equal(packetTypeRetry))
+			Expect(getPacketType(&wire.Header{IsLongHeader: true, Type: protocol.PacketType0RTT}, protocol.EncryptionSecure)).To(Equal(packetType0RTT))
+		})
+
+		It("determines the packet type of Short Header packets", func() {
+			Expect(getPacketType(&wire.Header{}, protocol.EncryptionForwardSecure)).To(Equal(packetType1RTT))
+		})
+
+		It("determines the packet type of Version Negotiation packets", func() {
+			Expect(getPacketType(&wire.Header{IsVersionNegotiation: true}, protocol.EncryptionUnspecified)).To(Equal(packetTypeVersionNegotiation))
+		})
+
+		It("derives the packet type from the encryption level for gQUIC packets", func() {
+			Expect(getPacketType(&wire.Header{}, protocol.EncryptionUnencrypted)).To(Equal(packetTypeInitial))
+			Expect(getPacketType(&wire.Header{}, protocol.EncryptionSecure)).To(Equal(packetType0RTT))
+			Expect(getPacketType(&wire.Header{}, protocol.EncryptionForwardSecure)).To(Equal(packetType1RTT))
+		})
+
+		It("has a string representation", func() {
+			Expect(packetTypeInitial.String()).To(Equal("initial"))
+			Expect(packetTypeHandshake.String()).To(Equal("handshake"))
+			Expect(packetTypeRetry.String()).To(Equal("retry"))
+			Expect(packetType0RTT.String()).To(Equal("0RTT"))
+			Expect(packetType1RTT.String()).To(Equal("1RTT"))
+			Expect(packetTypeVersionNegotiation.String()).To(Equal("version_negotiation"))
+		})
+
+		It("returns the name of the packet type", func() {
+			Expect(PacketTypeName(&wire.Header{IsLongHeader: true, Type: protocol.PacketTypeHandshake}, protocol.EncryptionUnencrypted)).To(Equal("handshake"))
+			Expect(PacketTypeName(&wire.Header{}, protocol.EncryptionForwardSecure)).To(Equal("1RTT"))
+		})
+	})
+
+	It("has a string representation for the stream state", func() {
+		Expect(StreamStateOpen.String()).To(Equal("open"))
+		Expect(StreamStateClosed.String()).To(Equal("closed"))
+	})
+
+	It("has a string representation for the packet drop reason", func() {
+		Expect(PacketDropKeyUnavailable.String()).To(Equal("key_unavailable"))
+		Expect(PacketDropPayloadDecryptError.String()).To(Equal("payload_decrypt_error"))
+		Expect(PacketDropDOSPrevention.String()).To(Equal("dos_prevention"))
+		Expect(PacketDropUnknownConnectionID.String()).To(Equal("unknown_connection_id"))
+		Expect(PacketDropUnexpectedPacket.String()).To(Equal("unexpected_packet"))
+	})
+})
@@ -19,6 +19,7 @@ type receiveStreamI interface {
 	handleRstStreamFrame(*wire.RstStreamFrame) error
 	closeForShutdown(error)
 	getWindowUpdate() protocol.ByteCount
+	getReceiveWindow() protocol.ByteCount
 }
 
 type receiveStream struct {
@@ -41,6 +42,8 @@ type receiveStream struct {
 	canceledRead      bool // set when CancelRead() is called
 	resetRemotely     bool // set when HandleRstStreamFrame() is called
 
+	terminationReason StreamTerminationReason
+
 	readChan     chan struct{}
 	readDeadline time.Time
 
@@ -160,6 +163,7 @@ func (s *receiveStream) Read(p []byte) (int, error) {
 			s.frameQueue.Pop()
 			s.finRead = frame.FinBit
 			if frame.FinBit {
+				s.setTerminationReason(StreamFinished)
 				s.sender.onStreamCompleted(s.streamID)
 				return bytesRead, io.EOF
 			}
@@ -179,7 +183,11 @@ func (s *receiveStream) CancelRead(errorCode protocol.ApplicationErrorCode) erro
 		return nil
 	}
 	s.canceledRead = true
-	s.cancelReadErr = fmt.Errorf("Read on stream %d canceled with error code %d", s.streamID, errorCode)
+	s.setTerminationReason(StreamCanceledLocally)
+	s.cancelReadErr = streamCanceledError{
+		errorCode: errorCode,
+		error:     fmt.Errorf("Read on stream %d canceled with error code %d", s.streamID, errorCode),
+	}
 	s.signalRead()
 	if s.version.UsesIETFFrameFormat() {
 		s.sender.queueControlFrame(&wire.StopSendingFrame{
@@ -190,6 +198,33 @@ func (s *receiveStream) CancelRead(errorCode protocol.ApplicationErrorCode) erro
 	return nil
 }
 
+func (s *receiveStream) ReleaseCredit(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if n <= 0 {
+		return
+	}
+	s.flowController.ReleaseCredit(protocol.ByteCount(n))
+	if s.flowController.HasWindowUpdate() {
+		s.sender.onHasWindowUpdate(s.streamID)
+	}
+}
+
+func (s *receiveStream) ReadTerminationReason() StreamTerminationReason {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.terminationReason
+}
+
+// setTerminationReason records the reason the stream was terminated.
+// Only the first reason is recorded. It must be called with the mutex held.
+func (s *receiveStream) setTerminationReason(r StreamTerminationReason) {
+	if s.terminationReason == StreamNotTerminated {
+		s.terminationReason = r
+	}
+}
+
 func (s *receiveStream) handleStreamFrame(frame *wire.StreamFrame) error {
 	maxOffset := frame.Offset + frame.DataLen()
 	if err := s.flowController.UpdateHighestReceived(maxOffset, frame.FinBit); err != nil {
@@ -227,6 +262,7 @@ func (s *receiveStream) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 		return nil
 	}
 	s.resetRemotely = true
+	s.setTerminationReason(StreamResetByPeer)
 	s.resetRemotelyErr = streamCanceledError{
 		errorCode: frame.ErrorCode,
 		error:     fmt.Errorf("Stream %d was reset with error code %d", s.streamID, frame.ErrorCode),
@@ -252,13 +288,11 @@ func (s *receiveStream) onClose(offset protocol.ByteCount) {
 
 func (s *receiveStream) SetReadDeadline(t time.Time) error {
 	s.mutex.Lock()
-	oldDeadline := s.readDeadline
 	s.readDeadline = t
 	s.mutex.Unlock()
-	// if the new deadline is before the currently set deadline, wake up Read()
-	if t.Before(oldDeadline) {
-		s.signalRead()
-	}
+	// Always wake up Read(), since it might currently be blocked without any deadline.
+	// If the deadline was extended, Read() will just continue waiting.
+	s.signalRead()
 	return nil
 }
 
@@ -269,6 +303,7 @@ func (s *receiveStream) closeForShutdown(err error) {
 	s.mutex.Lock()
 	s.closedForShutdown = true
 	s.closeForShutdownErr = err
+	s.setTerminationReason(StreamSessionClosed)
 	s.mutex.Unlock()
 	s.signalRead()
 }
@@ -277,6 +312,10 @@ func (s *receiveStream) getWindowUpdate() protocol.ByteCount {
 	return s.flowController.GetWindowUpdate()
 }
 
+func (s *receiveStream) getReceiveWindow() protocol.ByteCount {
+	return s.flowController.GetReceiveWindow()
+}
+
 // signalRead performs a non-blocking send on the readChan
 func (s *receiveStream) signalRead() {
 	select {
@@ -3,6 +3,7 @@ package quic
 import (
 	"errors"
 	"io"
+	"net"
 	"runtime"
 	"time"
 
@@ -311,6 +312,31 @@ var _ = Describe("Receive Stream", func() {
 				Expect(err).To(MatchError(errDeadline))
 				Expect(time.Now()).To(BeTemporally("~", deadline2, scaleDuration(25*time.Millisecond)))
 			})
+
+			It("unblocks when a deadline is set while Read is blocked without a deadline", func() {
+				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
+				go func() {
+					defer GinkgoRecover()
+					time.Sleep(scaleDuration(10 * time.Millisecond))
+					str.SetReadDeadline(deadline)
+				}()
+				b := make([]byte, 10)
+				_, err := strWithTimeout.Read(b)
+				Expect(err).To(MatchError(errDeadline))
+				Expect(err.(net.Error).Timeout()).To(BeTrue())
+				Expect(time.Now()).To(BeTemporally("~", deadline, scaleDuration(25*time.Millisecond)))
+			})
+
+			It("unblocks immediately when a deadline in the past is set", func() {
+				go func() {
+					defer GinkgoRecover()
+					time.Sleep(scaleDuration(10 * time.Millisecond))
+					str.SetReadDeadline(time.Now().Add(-time.Second))
+				}()
+				b := make([]byte, 10)
+				_, err := strWithTimeout.Read(b)
+				Expect(err).To(MatchError(errDeadline))
+			})
 		})
 
 		Context("closing", func() {
@@ -465,6 +491,15 @@ var _ = Describe("Receive Stream", func() {
 				Expect(err).To(MatchError("Read on stream 1337 canceled with error code 1234"))
 			})
 
+			It("returns a StreamError carrying the error code", func() {
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				Expect(str.CancelRead(1234)).To(Succeed())
+				_, err := strWithTimeout.Read([]byte{0})
+				Expect(err).To(BeAssignableToTypeOf(streamCanceledError{}))
+				Expect(err.(StreamError).Canceled()).To(BeTrue())
+				Expect(err.(StreamError).ErrorCode()).To(Equal(protocol.ApplicationErrorCode(1234)))
+			})
+
 			It("does nothing when CancelRead is called twice", func() {
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
 				err := str.CancelRead(1234)
@@ -632,6 +667,75 @@ var _ = Describe("Receive Stream", func() {
 		})
 	})
 
+	Context("termination reason", func() {
+		It("is not terminated initially", func() {
+			Expect(str.ReadTerminationReason()).To(Equal(StreamNotTerminated))
+		})
+
+		It("records that the stream was finished, once the FIN was read", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), true)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(4))
+			mockFC.EXPECT().HasWindowUpdate()
+			err := str.handleStreamFrame(&wire.StreamFrame{
+				Data:   []byte("foob"),
+				FinBit: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.ReadTerminationReason()).To(Equal(StreamNotTerminated))
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			_, err = strWithTimeout.Read(make([]byte, 4))
+			Expect(err).To(MatchError(io.EOF))
+			Expect(str.ReadTerminationReason()).To(Equal(StreamFinished))
+		})
+
+		It("records that the stream was reset by the peer", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			err := str.handleRstStreamFrame(&wire.RstStreamFrame{
+				StreamID:   streamID,
+				ByteOffset: 42,
+				ErrorCode:  1234,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = strWithTimeout.Read([]byte{0})
+			Expect(err).ToNot(Equal(io.EOF))
+			Expect(err).To(BeAssignableToTypeOf(streamCanceledError{}))
+			Expect(err.(StreamError).ErrorCode()).To(Equal(protocol.ApplicationErrorCode(1234)))
+			Expect(str.ReadTerminationReason()).To(Equal(StreamResetByPeer))
+		})
+
+		It("records that reading was canceled", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			Expect(str.CancelRead(1234)).To(Succeed())
+			Expect(str.ReadTerminationReason()).To(Equal(StreamCanceledLocally))
+		})
+
+		It("records that the session was closed", func() {
+			str.closeForShutdown(errors.New("test error"))
+			Expect(str.ReadTerminationReason()).To(Equal(StreamSessionClosed))
+		})
+
+		It("only records the first reason", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			Expect(str.CancelRead(1234)).To(Succeed())
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			err := str.handleRstStreamFrame(&wire.RstStreamFrame{
+				StreamID:   streamID,
+				ByteOffset: 42,
+				ErrorCode:  1234,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			str.closeForShutdown(errors.New("test error"))
+			Expect(str.ReadTerminationReason()).To(Equal(StreamCanceledLocally))
+		})
+
+		It("has a string representation", func() {
+			Expect(StreamResetByPeer.String()).To(Equal("reset by peer"))
+			Expect(StreamTerminationReason(42).String()).To(Equal("unknown termination reason: 42"))
+		})
+	})
+
 	Context("flow control", func() {
 		It("errors when a STREAM frame causes a flow control violation", func() {
 			testErr := errors.New("flow control violation")
@@ -648,5 +752,28 @@ var _ = Describe("Receive Stream", func() {
 			mockFC.EXPECT().GetWindowUpdate().Return(protocol.ByteCount(0x100))
 			Expect(str.getWindowUpdate()).To(Equal(protocol.ByteCount(0x100)))
 		})
+
+		It("gets the receive window", func() {
+			mockFC.EXPECT().GetReceiveWindow().Return(protocol.ByteCount(0x1000))
+			Expect(str.getReceiveWindow()).To(Equal(protocol.ByteCount(0x1000)))
+		})
+
+		It("releases credit", func() {
+			mockFC.EXPECT().ReleaseCredit(protocol.ByteCount(42))
+			mockFC.EXPECT().HasWindowUpdate()
+			str.ReleaseCredit(42)
+		})
+
+		It("queues a window update when releasing credit", func() {
+			mockFC.EXPECT().ReleaseCredit(protocol.ByteCount(42))
+			mockFC.EXPECT().HasWindowUpdate().Return(true)
+			mockSender.EXPECT().onHasWindowUpdate(streamID)
+			str.ReleaseCredit(42)
+		})
+
+		It("ignores non-positive values when releasing credit", func() {
+			str.ReleaseCredit(0)
+			str.ReleaseCredit(-1)
+		})
 	})
 })
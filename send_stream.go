@@ -1,9 +1,14 @@
 package quic
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
@@ -18,6 +23,7 @@ type sendStreamI interface {
 	popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool)
 	closeForShutdown(error)
 	handleMaxStreamDataFrame(*wire.MaxStreamDataFrame)
+	getPriority() uint8
 }
 
 type sendStream struct {
@@ -43,8 +49,18 @@ type sendStream struct {
 	writeChan      chan struct{}
 	writeDeadline  time.Time
 
+	// dataSource is the io.Reader passed to ReadFrom.
+	// Data is read from it directly into the STREAM frames, when they are packed.
+	dataSource          io.Reader
+	dataSourceErr       error // the error returned by the dataSource, if it's not io.EOF
+	bytesReadFromSource int64
+
 	flowController flowcontrol.StreamFlowController
 
+	// priority is the weight set by SetPriority, or 0 if no priority was set.
+	// It is accessed atomically, since the stream framer reads it while the stream might hold its mutex.
+	priority uint32
+
 	version protocol.VersionNumber
 }
 
@@ -130,6 +146,92 @@ func (s *sendStream) Write(p []byte) (int, error) {
 	return bytesWritten, err
 }
 
+// ReadFrom writes the data read from r to the stream, until r returns io.EOF.
+// For regular files, as well as for bytes.Readers and strings.Readers, the data is read
+// directly into the STREAM frames when they are packed, without buffering it in the stream.
+// For all other io.Readers, it behaves like io.Copy.
+func (s *sendStream) ReadFrom(r io.Reader) (int64, error) {
+	if !isNonBlockingReader(r) {
+		// hide the ReadFrom method from io.Copy
+		return io.Copy(struct{ io.Writer }{s}, r)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.finishedWriting {
+		return 0, fmt.Errorf("write on closed stream %d", s.streamID)
+	}
+	if s.canceledWrite {
+		return 0, s.cancelWriteErr
+	}
+	if s.closeForShutdownErr != nil {
+		return 0, s.closeForShutdownErr
+	}
+	if !s.writeDeadline.IsZero() && !time.Now().Before(s.writeDeadline) {
+		return 0, errDeadline
+	}
+
+	s.dataSource = r
+	s.dataSourceErr = nil
+	s.bytesReadFromSource = 0
+	s.sender.onHasStreamData(s.streamID)
+
+	var err error
+	for {
+		deadline := s.writeDeadline
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			err = errDeadline
+			break
+		}
+		if s.dataSource == nil || s.canceledWrite || s.closedForShutdown {
+			break
+		}
+
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.writeChan
+		} else {
+			select {
+			case <-s.writeChan:
+			case <-time.After(time.Until(deadline)):
+			}
+		}
+		s.mutex.Lock()
+	}
+	s.dataSource = nil
+
+	if s.closeForShutdownErr != nil {
+		err = s.closeForShutdownErr
+	} else if s.cancelWriteErr != nil {
+		err = s.cancelWriteErr
+	} else if s.dataSourceErr != nil {
+		err = s.dataSourceErr
+	}
+	return s.bytesReadFromSource, err
+}
+
+// isNonBlockingReader says if reading from r can be done while packing a packet.
+func isNonBlockingReader(r io.Reader) bool {
+	switch r := r.(type) {
+	case *bytes.Reader, *strings.Reader:
+		return true
+	case *io.LimitedReader:
+		return isNonBlockingReader(r.R)
+	case interface{ Stat() (os.FileInfo, error) }:
+		// This is an *os.File, or a type wrapping it.
+		// Note that os.File.WriteTo wraps the file when calling ReadFrom.
+		info, err := r.Stat()
+		return err == nil && info.Mode().IsRegular()
+	default:
+		return false
+	}
+}
+
+func (s *sendStream) hasDataForWriting() bool {
+	return s.dataForWriting != nil || s.dataSource != nil
+}
+
 // popStreamFrame returns the next STREAM frame that is supposed to be sent on this stream
 // maxBytes is the maximum length this frame (including frame header) will have.
 func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool /* has more data to send */) {
@@ -147,7 +249,7 @@ func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFr
 	}
 	maxDataLen := frame.MaxDataLen(maxBytes, s.version)
 	if maxDataLen == 0 { // a STREAM frame must have at least one byte of data
-		return nil, s.dataForWriting != nil
+		return nil, s.hasDataForWriting()
 	}
 	frame.Data, frame.FinBit = s.getDataForWriting(maxDataLen)
 	if len(frame.Data) == 0 && !frame.FinBit {
@@ -155,7 +257,7 @@ func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFr
 		// - popStreamFrame is called but there's no data for writing
 		// - there's data for writing, but the stream is stream-level flow control blocked
 		// - there's data for writing, but the stream is connection-level flow control blocked
-		if s.dataForWriting == nil {
+		if !s.hasDataForWriting() {
 			return nil, false
 		}
 		isBlocked, _ := s.flowController.IsBlocked()
@@ -173,10 +275,13 @@ func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFr
 			return frame, false
 		}
 	}
-	return frame, s.dataForWriting != nil
+	return frame, s.hasDataForWriting()
 }
 
 func (s *sendStream) getDataForWriting(maxBytes protocol.ByteCount) ([]byte, bool /* should send FIN */) {
+	if s.dataSource != nil {
+		return s.readFromDataSource(maxBytes), false
+	}
 	if s.dataForWriting == nil {
 		return nil, s.finishedWriting && !s.finSent
 	}
@@ -203,6 +308,36 @@ func (s *sendStream) getDataForWriting(maxBytes protocol.ByteCount) ([]byte, boo
 	return ret, s.finishedWriting && s.dataForWriting == nil && !s.finSent
 }
 
+// readFromDataSource reads up to maxBytes from the dataSource.
+// The buffer is only allocated for the data that is actually sent,
+// and is retained for retransmissions until the STREAM frame is acknowledged.
+func (s *sendStream) readFromDataSource(maxBytes protocol.ByteCount) []byte {
+	maxBytes = utils.MinByteCount(maxBytes, s.flowController.SendWindowSize())
+	if maxBytes == 0 {
+		return nil
+	}
+	if lr, ok := s.dataSource.(*io.LimitedReader); ok && lr.N > 0 {
+		// don't allocate more than the remaining data
+		maxBytes = utils.MinByteCount(maxBytes, protocol.ByteCount(lr.N))
+	}
+	data := make([]byte, maxBytes)
+	n, err := s.dataSource.Read(data)
+	if err != nil {
+		if err != io.EOF {
+			s.dataSourceErr = err
+		}
+		s.dataSource = nil
+		s.signalWrite()
+	}
+	if n == 0 {
+		return nil
+	}
+	s.writeOffset += protocol.ByteCount(n)
+	s.bytesReadFromSource += int64(n)
+	s.flowController.AddBytesSent(protocol.ByteCount(n))
+	return data[:n]
+}
+
 func (s *sendStream) Close() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -220,7 +355,11 @@ func (s *sendStream) CancelWrite(errorCode protocol.ApplicationErrorCode) error
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	return s.cancelWriteImpl(errorCode, fmt.Errorf("Write on stream %d canceled with error code %d", s.streamID, errorCode))
+	writeErr := streamCanceledError{
+		errorCode: errorCode,
+		error:     fmt.Errorf("Write on stream %d canceled with error code %d", s.streamID, errorCode),
+	}
+	return s.cancelWriteImpl(errorCode, writeErr)
 }
 
 // must be called after locking the mutex
@@ -239,7 +378,7 @@ func (s *sendStream) cancelWriteImpl(errorCode protocol.ApplicationErrorCode, wr
 		ByteOffset: s.writeOffset,
 		ErrorCode:  errorCode,
 	})
-	// TODO(#991): cancel retransmissions for this stream
+	// the packer drops retransmissions of STREAM frames for this stream
 	s.ctxCancel()
 	s.sender.onStreamCompleted(s.streamID)
 	return nil
@@ -254,7 +393,7 @@ func (s *sendStream) handleStopSendingFrame(frame *wire.StopSendingFrame) {
 func (s *sendStream) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) {
 	s.flowController.UpdateSendWindow(frame.ByteOffset)
 	s.mutex.Lock()
-	if s.dataForWriting != nil {
+	if s.hasDataForWriting() {
 		s.sender.onHasStreamData(s.streamID)
 	}
 	s.mutex.Unlock()
@@ -279,15 +418,21 @@ func (s *sendStream) Context() context.Context {
 
 func (s *sendStream) SetWriteDeadline(t time.Time) error {
 	s.mutex.Lock()
-	oldDeadline := s.writeDeadline
 	s.writeDeadline = t
 	s.mutex.Unlock()
-	if t.Before(oldDeadline) {
-		s.signalWrite()
-	}
+	// wake up Write(), so that it picks up the new deadline
+	s.signalWrite()
 	return nil
 }
 
+func (s *sendStream) SetPriority(weight int) {
+	atomic.StoreUint32(&s.priority, uint32(utils.Min(utils.Max(weight, 1), maxStreamWeight)))
+}
+
+func (s *sendStream) getPriority() uint8 {
+	return uint8(atomic.LoadUint32(&s.priority))
+}
+
 // CloseForShutdown closes a stream abruptly.
 // It makes Write unblock (and return the error) immediately.
 // The peer will NOT be informed about this: the stream is closed without sending a FIN or RST.
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"io/ioutil"
+	"net"
+	"os"
 	"runtime"
 	"time"
 
@@ -379,6 +382,24 @@ var _ = Describe("Send Stream", func() {
 				Expect(time.Now()).To(BeTemporally("~", deadline2, scaleDuration(20*time.Millisecond)))
 				Eventually(done).Should(BeClosed())
 			})
+
+			It("unblocks when a deadline is set while Write is blocked without a deadline", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					time.Sleep(scaleDuration(10 * time.Millisecond))
+					str.SetWriteDeadline(deadline)
+					close(done)
+				}()
+				n, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).To(MatchError(errDeadline))
+				Expect(err.(net.Error).Timeout()).To(BeTrue())
+				Expect(n).To(BeZero())
+				Expect(time.Now()).To(BeTemporally("~", deadline, scaleDuration(20*time.Millisecond)))
+				Eventually(done).Should(BeClosed())
+			})
 		})
 
 		Context("closing", func() {
@@ -480,6 +501,206 @@ var _ = Describe("Send Stream", func() {
 		})
 	})
 
+	Context("reading from an io.Reader", func() {
+		waitForReadFrom := func() {
+			EventuallyWithOffset(1, func() bool {
+				str.mutex.Lock()
+				defer str.mutex.Unlock()
+				return str.dataSource != nil
+			}).Should(BeTrue())
+		}
+
+		It("reads the data directly into the STREAM frames", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(2)
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+			mockFC.EXPECT().IsBlocked()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				n, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(6))
+				close(done)
+			}()
+			waitForReadFrom()
+			Expect(str.dataForWriting).To(BeNil())
+			f, hasMoreData := str.popStreamFrame(1000)
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			Expect(f.Offset).To(BeZero())
+			Expect(f.FinBit).To(BeFalse())
+			Expect(hasMoreData).To(BeTrue())
+			Consistently(done).ShouldNot(BeClosed())
+			// the bytes.Reader only returns io.EOF when reading again
+			f, hasMoreData = str.popStreamFrame(1000)
+			Expect(f).To(BeNil())
+			Expect(hasMoreData).To(BeFalse())
+			Eventually(done).Should(BeClosed())
+			Expect(str.writeOffset).To(Equal(protocol.ByteCount(6)))
+		})
+
+		It("only allocates as much memory as fits into the frame", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(2)
+			mockFC.EXPECT().AddBytesSent(gomock.Any()).Times(2)
+			mockFC.EXPECT().IsBlocked().Times(2)
+			go func() {
+				defer GinkgoRecover()
+				str.ReadFrom(bytes.NewReader(make([]byte, 10000)))
+			}()
+			waitForReadFrom()
+			f, hasMoreData := str.popStreamFrame(100)
+			Expect(f.Length(str.version)).To(Equal(protocol.ByteCount(100)))
+			Expect(cap(f.Data)).To(Equal(len(f.Data)))
+			Expect(hasMoreData).To(BeTrue())
+			f, hasMoreData = str.popStreamFrame(200)
+			Expect(f.Offset).ToNot(BeZero())
+			Expect(f.Length(str.version)).To(Equal(protocol.ByteCount(200)))
+			Expect(cap(f.Data)).To(Equal(len(f.Data)))
+			Expect(hasMoreData).To(BeTrue())
+			str.closeForShutdown(nil)
+		})
+
+		It("respects the limit of an io.LimitedReader", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(2)
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(42))
+			mockFC.EXPECT().IsBlocked()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				n, err := str.ReadFrom(&io.LimitedReader{R: bytes.NewReader(make([]byte, 10000)), N: 42})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(42))
+				close(done)
+			}()
+			waitForReadFrom()
+			f, _ := str.popStreamFrame(1000)
+			Expect(f.Data).To(HaveLen(42))
+			Expect(cap(f.Data)).To(Equal(42))
+			f, hasMoreData := str.popStreamFrame(1000)
+			Expect(f).To(BeNil())
+			Expect(hasMoreData).To(BeFalse())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("reads from a file", func() {
+			file, err := ioutil.TempFile("", "quic-go-send-stream")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			defer file.Close()
+			_, err = file.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = file.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(2)
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+			mockFC.EXPECT().IsBlocked()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				n, err := io.Copy(str, file)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(6))
+				close(done)
+			}()
+			waitForReadFrom()
+			f, _ := str.popStreamFrame(1000)
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			f, hasMoreData := str.popStreamFrame(1000)
+			Expect(f).To(BeNil())
+			Expect(hasMoreData).To(BeFalse())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns the error returned by the io.Reader", func() {
+			file, err := ioutil.TempFile("", "quic-go-send-stream")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				n, err := str.ReadFrom(file)
+				Expect(err).To(HaveOccurred())
+				Expect(err).ToNot(Equal(io.EOF))
+				Expect(n).To(BeZero())
+				close(done)
+			}()
+			waitForReadFrom()
+			Expect(file.Close()).To(Succeed())
+			f, hasMoreData := str.popStreamFrame(1000)
+			Expect(f).To(BeNil())
+			Expect(hasMoreData).To(BeFalse())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("copies the data from other io.Readers", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+			mockFC.EXPECT().IsBlocked()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				// hide that this is a bytes.Reader
+				n, err := str.ReadFrom(struct{ io.Reader }{bytes.NewReader([]byte("foobar"))})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(6))
+				close(done)
+			}()
+			waitForWrite()
+			Expect(str.dataSource).To(BeNil())
+			f, _ := str.popStreamFrame(1000)
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns when the deadline has passed", func() {
+			str.SetWriteDeadline(time.Now().Add(-time.Second))
+			n, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+			Expect(err).To(MatchError(errDeadline))
+			Expect(n).To(BeZero())
+		})
+
+		It("times out", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
+			str.SetWriteDeadline(deadline)
+			n, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+			Expect(err).To(MatchError(errDeadline))
+			Expect(n).To(BeZero())
+			Expect(time.Now()).To(BeTemporally("~", deadline, scaleDuration(20*time.Millisecond)))
+			Expect(str.dataSource).To(BeNil())
+		})
+
+		It("is unblocked when the stream is canceled", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+				Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
+				close(done)
+			}()
+			waitForReadFrom()
+			Expect(str.CancelWrite(1234)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't allow reading after the stream was closed", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			Expect(str.Close()).To(Succeed())
+			_, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+			Expect(err).To(MatchError("write on closed stream 1337"))
+		})
+	})
+
 	Context("handling MAX_STREAM_DATA frames", func() {
 		It("informs the flow controller", func() {
 			mockFC.EXPECT().UpdateSendWindow(protocol.ByteCount(0x1337))
@@ -510,6 +731,26 @@ var _ = Describe("Send Stream", func() {
 		})
 	})
 
+	Context("setting the priority", func() {
+		It("doesn't have a priority by default", func() {
+			Expect(str.getPriority()).To(BeZero())
+		})
+
+		It("sets the priority", func() {
+			str.SetPriority(42)
+			Expect(str.getPriority()).To(Equal(uint8(42)))
+		})
+
+		It("clamps the priority", func() {
+			str.SetPriority(0)
+			Expect(str.getPriority()).To(Equal(uint8(1)))
+			str.SetPriority(-10)
+			Expect(str.getPriority()).To(Equal(uint8(1)))
+			str.SetPriority(1000)
+			Expect(str.getPriority()).To(Equal(uint8(255)))
+		})
+	})
+
 	Context("stream cancelations", func() {
 		Context("canceling writing", func() {
 			It("queues a RST_STREAM frame", func() {
@@ -566,6 +807,16 @@ var _ = Describe("Send Stream", func() {
 				Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
 			})
 
+			It("returns a StreamError carrying the error code", func() {
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				Expect(str.CancelWrite(1234)).To(Succeed())
+				_, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).To(BeAssignableToTypeOf(streamCanceledError{}))
+				Expect(err.(StreamError).Canceled()).To(BeTrue())
+				Expect(err.(StreamError).ErrorCode()).To(Equal(protocol.ApplicationErrorCode(1234)))
+			})
+
 			It("only cancels once", func() {
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
 				mockSender.EXPECT().onStreamCompleted(streamID)
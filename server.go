@@ -2,10 +2,12 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
+	"runtime"
 	"sync"
 	"time"
 
@@ -19,13 +21,16 @@ import (
 
 // packetHandler handles packets
 type packetHandler interface {
-	Session
+	EarlySession
 	getCryptoStream() cryptoStreamI
 	handshakeStatus() <-chan error
+	earlySessionReadyStatus() <-chan struct{}
 	handlePacket(*receivedPacket)
 	GetVersion() protocol.VersionNumber
 	run() error
 	closeRemote(error)
+	handleStatelessReset(packet []byte) bool
+	goAway()
 }
 
 // A Listener of QUIC
@@ -37,17 +42,55 @@ type server struct {
 
 	supportsTLS bool
 	serverTLS   *serverTLS
+	// resetTokenGenerator derives the stateless reset tokens. It is only set if the server supports IETF QUIC.
+	resetTokenGenerator *handshake.ResetTokenGenerator
+	// resetLimiter limits the rate of stateless resets and Public Resets sent in response to packets for unknown connections
+	resetLimiter *utils.TokenBucket
 
 	certChain crypto.CertChain
 	scfg      *handshake.ServerConfig
 
+	// sessions maps the connection IDs to the sessions.
+	// It is safe for concurrent use, such that incoming packets are routed without taking the sessionsMutex.
+	sessions *packetHandlerMap
+
 	sessionsMutex sync.RWMutex
-	sessions      map[string] /* string(ConnectionID)*/ packetHandler
-	closed        bool
+	// pendingPackets holds the packets received for connections whose Initial packet is still being processed.
+	// They are passed to the session once it is created.
+	// It is protected by the sessionsMutex.
+	// Sessions for connections with pending packets are only added to the sessions while holding the sessionsMutex.
+	pendingPackets map[string] /* string(ConnectionID)*/ *pendingPacketQueue
+	closed         bool
+	// shuttingDown is set when Shutdown is called, and shutdownChan is closed.
+	// New connections are then rejected.
+	shuttingDown bool
+	shutdownChan chan struct{}
+	// numSessions is the number of sessions that are currently running.
+	// numUnacceptedSessions is the number of sessions that were not returned by Accept yet,
+	// including the sessions that are still performing the handshake.
+	// They are used to refuse new connections when the server is overloaded.
+	numSessions           int
+	numUnacceptedSessions int
+	// numHandshakes is the number of sessions that are still performing the handshake.
+	// When it is too large, new clients are required to validate their address.
+	numHandshakes int
 
 	serverError  error
-	sessionQueue chan Session
+	sessionQueue chan packetHandler
 	errorChan    chan struct{}
+	errorOnce    sync.Once
+
+	// transport is set for servers created by Transport.Listen.
+	// The Transport then reads packets from the connection and passes them to the server.
+	transport *Transport
+
+	// acceptEarlySessions is set for servers created by ListenEarly.
+	// Sessions are then accepted as soon as data can be sent, before the handshake completes.
+	acceptEarlySessions bool
+
+	// eventLoops is set if the SharedEventLoop option is used.
+	// Sessions are then run on these event loops once their handshake completed.
+	eventLoops *eventLoopGroup
 
 	// set as members, so they can be set in the tests
 	newSession                func(conn connection, v protocol.VersionNumber, connectionID protocol.ConnectionID, sCfg *handshake.ServerConfig, tlsConf *tls.Config, config *Config, logger utils.Logger) (packetHandler, error)
@@ -57,6 +100,23 @@ type server struct {
 }
 
 var _ Listener = &server{}
+var _ connIDRunner = &server{}
+
+// errServerShuttingDown is used to reject new connections while the server is being shut down.
+// Sessions that are still open when the context passed to Shutdown expires are closed with this error.
+var errServerShuttingDown = qerr.Error(qerr.PeerGoingAway, "server shutting down")
+
+var errConnectionRefused = qerr.Error(qerr.ConnectionRefused, "server busy")
+
+// An earlyServer is a server that returns sessions before the handshake completes
+type earlyServer struct{ *server }
+
+var _ EarlyListener = &earlyServer{}
+
+// Accept returns newly opened sessions, before their handshake completes
+func (s *earlyServer) Accept() (EarlySession, error) {
+	return s.server.accept()
+}
 
 // ListenAddr creates a QUIC server listening on a given address.
 // The listener is not active until Serve() is called.
@@ -77,6 +137,35 @@ func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, err
 // The listener is not active until Serve() is called.
 // The tls.Config must not be nil, the quic.Config may be nil.
 func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener, error) {
+	return listen(conn, tlsConf, config, false, nil)
+}
+
+// ListenAddrEarly works like ListenAddr, but it returns sessions before the handshake completes.
+func ListenAddrEarly(addr string, tlsConf *tls.Config, config *Config) (EarlyListener, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return ListenEarly(conn, tlsConf, config)
+}
+
+// ListenEarly works like Listen, but it returns sessions before the handshake completes.
+// A session is returned as soon as the server can send data on it (0.5-RTT data),
+// and data sent by the client using 0-RTT can be read from it.
+// Use EarlySession.HandshakeComplete to wait until the handshake completes.
+func ListenEarly(conn net.PacketConn, tlsConf *tls.Config, config *Config) (EarlyListener, error) {
+	s, err := listen(conn, tlsConf, config, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &earlyServer{s}, nil
+}
+
+func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config, acceptEarly bool, transport *Transport) (*server, error) {
 	certChain := crypto.NewCertChain(tlsConf)
 	kex, err := crypto.NewCurve25519KEX()
 	if err != nil {
@@ -86,7 +175,35 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 	if err != nil {
 		return nil, err
 	}
+	if tlsConf != nil {
+		scfg.KeyLogWriter = tlsConf.KeyLogWriter
+	}
+	hasConnIDGenerator := config != nil && config.ConnectionIDGenerator != nil
 	config = populateServerConfig(config)
+	if transport != nil {
+		if err := transport.configureConnectionIDs(config, hasConnIDGenerator); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateConnectionIDLength(config.ConnectionIDLength); err != nil {
+		return nil, err
+	}
+	if config.TicketKeys != nil {
+		scfg.SetTokenProtector(config.TicketKeys.tokens)
+	}
+	scfg.Allow0RTT = config.Allow0RTT
+	if config.SingleUse0RTT {
+		scfg.EnableSingleUse0RTT()
+	}
+	if err := validateStreamScheduler(config.StreamScheduler); err != nil {
+		return nil, err
+	}
+	if err := validateCongestionControl(config.CongestionControl); err != nil {
+		return nil, err
+	}
+	if err := validateTLSStack(config.TLSStack); err != nil {
+		return nil, err
+	}
 
 	var supportsTLS bool
 	for _, v := range config.Versions {
@@ -106,33 +223,60 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 		config:                    config,
 		certChain:                 certChain,
 		scfg:                      scfg,
-		sessions:                  map[string]packetHandler{},
+		sessions:                  newPacketHandlerMap(protocol.PacketHandlerMapShards),
 		newSession:                newSession,
 		deleteClosedSessionsAfter: protocol.ClosedSessionDeleteTimeout,
-		sessionQueue:              make(chan Session, 5),
+		resetLimiter:              utils.NewTokenBucket(protocol.StatelessResetInterval, protocol.MaxStatelessResetBurst),
+		sessionQueue:              make(chan packetHandler, 5),
 		errorChan:                 make(chan struct{}),
+		shutdownChan:              make(chan struct{}),
 		supportsTLS:               supportsTLS,
-		logger:                    utils.DefaultLogger,
+		acceptEarlySessions:       acceptEarly,
+		transport:                 transport,
+		logger:                    newLogger(config, protocol.PerspectiveServer),
 	}
 	if supportsTLS {
 		if err := s.setupTLS(); err != nil {
 			return nil, err
 		}
 	}
-	go s.serve()
+	if config.SharedEventLoop {
+		s.eventLoops = newEventLoopGroup(runtime.GOMAXPROCS(0))
+	}
+	// when using a Transport, the Transport reads from the connection
+	if transport == nil {
+		go s.serve()
+	}
 	s.logger.Debugf("Listening for %s connections on %s", conn.LocalAddr().Network(), conn.LocalAddr().String())
 	return s, nil
 }
 
+// newTokenGenerator creates the TokenGenerator for the tokens sent in Retry and NEW_TOKEN frames.
+// If TicketKeys are configured, the tokens are encrypted using these keys.
+func (s *server) newTokenGenerator() (*handshake.TokenGenerator, error) {
+	if s.config.TicketKeys != nil {
+		return handshake.NewTokenGeneratorWithProtector(time.Now, s.config.TicketKeys.tokens), nil
+	}
+	return handshake.NewTokenGenerator(time.Now)
+}
+
 func (s *server) setupTLS() error {
-	cookieHandler, err := handshake.NewCookieHandler(s.config.AcceptCookie, s.logger)
+	tokenGenerator, err := s.newTokenGenerator()
 	if err != nil {
 		return err
 	}
-	serverTLS, sessionChan, err := newServerTLS(s.conn, s.config, cookieHandler, s.tlsConf, s.logger)
+	s.resetTokenGenerator, err = handshake.NewResetTokenGenerator(s.config.StatelessResetKey)
 	if err != nil {
 		return err
 	}
+	cookieHandler := handshake.NewCookieHandler(s.acceptCookie, tokenGenerator, s.logger)
+	serverTLS, sessionChan, err := newServerTLS(s.conn, s.config, cookieHandler, tokenGenerator, s.resetTokenGenerator, s, s.tlsConf, s.logger)
+	if err != nil {
+		return err
+	}
+	serverTLS.isShuttingDown = s.isShuttingDown
+	serverTLS.isBusy = s.isBusy
+	serverTLS.requireAddressValidation = s.requireAddressValidation
 	s.serverTLS = serverTLS
 	// handle TLS connection establishment statelessly
 	go func() {
@@ -144,11 +288,11 @@ func (s *server) setupTLS() error {
 				connID := tlsSession.connID
 				sess := tlsSession.sess
 				s.sessionsMutex.Lock()
-				if _, ok := s.sessions[string(connID)]; ok { // drop this session if it already exists
+				if !s.sessions.Add(connID, sess) { // drop this session if it already exists
 					s.sessionsMutex.Unlock()
 					continue
 				}
-				s.sessions[string(connID)] = sess
+				s.replayPendingPackets(connID, sess)
 				s.sessionsMutex.Unlock()
 				s.runHandshakeAndSession(sess, connID)
 			}
@@ -157,20 +301,63 @@ func (s *server) setupTLS() error {
 	return nil
 }
 
-var defaultAcceptCookie = func(clientAddr net.Addr, cookie *Cookie) bool {
-	if cookie == nil {
-		return false
+var defaultAcceptToken = newDefaultAcceptToken(time.Now)
+
+// newDefaultAcceptToken creates the default AcceptToken callback.
+// The time source is used to check if the Token has expired.
+// Tokens sent in a Retry are only valid for a short time, since they are only used in the next Initial packet.
+func newDefaultAcceptToken(now func() time.Time) func(net.Addr, *Token) bool {
+	return func(clientAddr net.Addr, token *Token) bool {
+		if token == nil {
+			return false
+		}
+		validity := protocol.TokenValidity
+		if token.IsRetryToken {
+			validity = protocol.RetryTokenValidity
+		}
+		if now().After(token.SentTime.Add(validity)) {
+			return false
+		}
+		var sourceAddr string
+		if udpAddr, ok := clientAddr.(*net.UDPAddr); ok {
+			sourceAddr = udpAddr.IP.String()
+		} else {
+			sourceAddr = clientAddr.String()
+		}
+		return sourceAddr == token.RemoteAddr
 	}
-	if time.Now().After(cookie.SentTime.Add(protocol.CookieExpiryTime)) {
-		return false
+}
+
+// validateConnectionIDLength checks that a connection ID length can be used on IETF QUIC packets
+func validateConnectionIDLength(l int) error {
+	if l < protocol.MinConnectionIDLen || l > protocol.MaxConnectionIDLen {
+		return fmt.Errorf("invalid connection ID length: %d bytes (must be between %d and %d bytes)", l, protocol.MinConnectionIDLen, protocol.MaxConnectionIDLen)
 	}
-	var sourceAddr string
-	if udpAddr, ok := clientAddr.(*net.UDPAddr); ok {
-		sourceAddr = udpAddr.IP.String()
-	} else {
-		sourceAddr = clientAddr.String()
+	return nil
+}
+
+// validateStreamScheduler checks that the stream scheduler is one of the built-in schedulers
+func validateStreamScheduler(s StreamScheduler) error {
+	if s > StreamSchedulerWeightedFair {
+		return fmt.Errorf("invalid stream scheduler: %d", s)
+	}
+	return nil
+}
+
+// validateCongestionControl checks that the congestion control algorithm is one of the built-in algorithms
+func validateCongestionControl(c CongestionControl) error {
+	if c > CongestionBBR {
+		return fmt.Errorf("invalid congestion control algorithm: %d", c)
+	}
+	return nil
+}
+
+// validateTLSStack checks that the TLS stack is one of the supported TLS stacks
+func validateTLSStack(s TLSStack) error {
+	if s > TLSStackStandardLibrary {
+		return fmt.Errorf("invalid TLS stack: %d", s)
 	}
-	return sourceAddr == cookie.RemoteAddr
+	return nil
 }
 
 // populateServerConfig populates fields in the quic.Config with their default values, if none are set
@@ -184,9 +371,9 @@ func populateServerConfig(config *Config) *Config {
 		versions = protocol.SupportedVersions
 	}
 
-	vsa := defaultAcceptCookie
-	if config.AcceptCookie != nil {
-		vsa = config.AcceptCookie
+	vsa := defaultAcceptToken
+	if config.AcceptToken != nil {
+		vsa = config.AcceptToken
 	}
 
 	handshakeTimeout := protocol.DefaultHandshakeTimeout
@@ -197,15 +384,40 @@ func populateServerConfig(config *Config) *Config {
 	if config.IdleTimeout != 0 {
 		idleTimeout = config.IdleTimeout
 	}
+	maxHandshakePackets := protocol.DefaultMaxHandshakePackets
+	if config.MaxHandshakePackets > 0 {
+		maxHandshakePackets = config.MaxHandshakePackets
+	}
+	connIDLen := config.ConnectionIDLength
+	if connIDLen == 0 {
+		connIDLen = protocol.DefaultConnectionIDLength
+	}
+	connIDGenerator := config.ConnectionIDGenerator
+	if connIDGenerator != nil {
+		connIDLen = connIDGenerator.ConnectionIDLen()
+	} else {
+		connIDGenerator = &randomConnIDGenerator{connIDLen: connIDLen}
+	}
 
-	maxReceiveStreamFlowControlWindow := config.MaxReceiveStreamFlowControlWindow
-	if maxReceiveStreamFlowControlWindow == 0 {
-		maxReceiveStreamFlowControlWindow = protocol.DefaultMaxReceiveStreamFlowControlWindowServer
+	initialStreamReceiveWindow := config.InitialStreamReceiveWindow
+	if initialStreamReceiveWindow == 0 {
+		initialStreamReceiveWindow = protocol.ReceiveStreamFlowControlWindow
+	}
+	maxStreamReceiveWindow := config.MaxStreamReceiveWindow
+	if maxStreamReceiveWindow == 0 {
+		maxStreamReceiveWindow = protocol.DefaultMaxReceiveStreamFlowControlWindowServer
 	}
-	maxReceiveConnectionFlowControlWindow := config.MaxReceiveConnectionFlowControlWindow
-	if maxReceiveConnectionFlowControlWindow == 0 {
-		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindowServer
+	// the window can't be auto-tuned below its initial size
+	maxStreamReceiveWindow = utils.MaxUint64(maxStreamReceiveWindow, initialStreamReceiveWindow)
+	initialConnectionReceiveWindow := config.InitialConnectionReceiveWindow
+	if initialConnectionReceiveWindow == 0 {
+		initialConnectionReceiveWindow = protocol.ReceiveConnectionFlowControlWindow
 	}
+	maxConnectionReceiveWindow := config.MaxConnectionReceiveWindow
+	if maxConnectionReceiveWindow == 0 {
+		maxConnectionReceiveWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindowServer
+	}
+	maxConnectionReceiveWindow = utils.MaxUint64(maxConnectionReceiveWindow, initialConnectionReceiveWindow)
 	maxIncomingStreams := config.MaxIncomingStreams
 	if maxIncomingStreams == 0 {
 		maxIncomingStreams = protocol.DefaultMaxIncomingStreams
@@ -218,75 +430,322 @@ func populateServerConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	maxUndecryptablePackets := config.MaxUndecryptablePackets
+	if maxUndecryptablePackets == 0 {
+		maxUndecryptablePackets = protocol.MaxUndecryptablePackets
+	}
+	undecryptablePacketTimeout := config.UndecryptablePacketTimeout
+	if undecryptablePacketTimeout == 0 {
+		undecryptablePacketTimeout = protocol.DefaultUndecryptablePacketTimeout
+	}
+
+	maxPacketSize := config.MaxPacketSize
+	if maxPacketSize == 0 || maxPacketSize > uint64(protocol.MaxReceivePacketSize) {
+		maxPacketSize = uint64(protocol.MaxReceivePacketSize)
+	} else if maxPacketSize < protocol.MinInitialPacketSize {
+		maxPacketSize = protocol.MinInitialPacketSize
+	}
+
+	keyUpdateInterval := config.KeyUpdateInterval
+	if keyUpdateInterval == 0 {
+		keyUpdateInterval = protocol.DefaultKeyUpdateInterval
+	}
+	maxAckDelay := config.MaxAckDelay
+	if maxAckDelay == 0 {
+		maxAckDelay = protocol.DefaultMaxAckDelay
+	} else if maxAckDelay > protocol.MaxMaxAckDelay {
+		maxAckDelay = protocol.MaxMaxAckDelay
+	}
 
 	return &Config{
-		Versions:                              versions,
-		HandshakeTimeout:                      handshakeTimeout,
-		IdleTimeout:                           idleTimeout,
-		AcceptCookie:                          vsa,
-		KeepAlive:                             config.KeepAlive,
-		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
-		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
-		MaxIncomingStreams:                    maxIncomingStreams,
-		MaxIncomingUniStreams:                 maxIncomingUniStreams,
+		Versions:                       versions,
+		HandshakeTimeout:               handshakeTimeout,
+		IdleTimeout:                    idleTimeout,
+		MaxHandshakePackets:            maxHandshakePackets,
+		ConnectionIDLength:             connIDLen,
+		ConnectionIDGenerator:          connIDGenerator,
+		AcceptToken:                    vsa,
+		RequireAddressValidation:       config.RequireAddressValidation,
+		MaxUndecryptablePackets:        maxUndecryptablePackets,
+		UndecryptablePacketTimeout:     undecryptablePacketTimeout,
+		KeepAlive:                      config.KeepAlive,
+		KeepAlivePeriod:                config.KeepAlivePeriod,
+		CloseOnOversizedPackets:        config.CloseOnOversizedPackets,
+		OnCongestionEvent:              config.OnCongestionEvent,
+		StreamScheduler:                config.StreamScheduler,
+		StreamWeight:                   config.StreamWeight,
+		CongestionControl:              config.CongestionControl,
+		CongestionControllerFactory:    config.CongestionControllerFactory,
+		InitialPacingRate:              config.InitialPacingRate,
+		MaxPacingBurst:                 config.MaxPacingBurst,
+		MaxAckDelay:                    maxAckDelay,
+		PacketsPerAck:                  config.PacketsPerAck,
+		ImmediateAckOnReordering:       config.ImmediateAckOnReordering,
+		EnableDatagrams:                config.EnableDatagrams,
+		DisableECN:                     config.DisableECN,
+		MaxPacketSize:                  maxPacketSize,
+		DisablePathMTUDiscovery:        config.DisablePathMTUDiscovery,
+		KeyUpdateInterval:              keyUpdateInterval,
+		TLSStack:                       config.TLSStack,
+		GetLogWriter:                   config.GetLogWriter,
+		Tracer:                         config.Tracer,
+		Logger:                         config.Logger,
+		StatelessResetKey:              config.StatelessResetKey,
+		TicketKeys:                     config.TicketKeys,
+		Allow0RTT:                      config.Allow0RTT,
+		SingleUse0RTT:                  config.SingleUse0RTT,
+		SharedEventLoop:                config.SharedEventLoop,
+		GetConfigForClient:             config.GetConfigForClient,
+		SessionContext:                 config.SessionContext,
+		MaxIncomingConnections:         config.MaxIncomingConnections,
+		InitialStreamReceiveWindow:     initialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         maxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: initialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     maxConnectionReceiveWindow,
+		ManualFlowControlCreditRelease: config.ManualFlowControlCreditRelease,
+		MaxIncomingStreams:             maxIncomingStreams,
+		MaxIncomingUniStreams:          maxIncomingUniStreams,
 	}
 }
 
+// sendStatelessReset sends an IETF QUIC stateless reset in response to a packet for an unknown connection
+func (s *server) sendStatelessReset(pconn net.PacketConn, remoteAddr net.Addr, hdr *wire.Header, packetLen int) error {
+	// Only respond to packets larger than the stateless reset.
+	// Otherwise two endpoints could keep on sending stateless resets to each other.
+	if packetLen <= protocol.MinStatelessResetSize {
+		return fmt.Errorf("not sending a stateless reset in response to a %d byte packet", packetLen)
+	}
+	if !s.resetLimiter.Allow(time.Now()) {
+		s.logger.Debugf("Not sending a stateless reset for connection %s to %s (rate limited)", hdr.DestConnectionID, remoteAddr)
+		return nil
+	}
+	data, err := wire.WriteStatelessReset(s.resetTokenGenerator.GetResetToken(hdr.DestConnectionID))
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf("Sending a stateless reset for connection %s to %s", hdr.DestConnectionID, remoteAddr)
+	if s.config.Tracer != nil {
+		s.config.Tracer.SentStatelessReset(hdr.DestConnectionID)
+	}
+	_, err = pconn.WriteTo(data, remoteAddr)
+	return err
+}
+
 // serve listens on an existing PacketConn
 func (s *server) serve() {
+	r := newPacketReader(s.conn)
 	for {
-		data := *getPacketBuffer()
-		data = data[:protocol.MaxReceivePacketSize]
-		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
-		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, remoteAddr, err := s.conn.ReadFrom(data)
+		data, remoteAddr, ecn, err := r.ReadPacket()
 		if err != nil {
-			s.serverError = err
-			close(s.errorChan)
-			_ = s.Close()
+			s.closeWithError(err)
 			return
 		}
-		data = data[:n]
-		if err := s.handlePacket(s.conn, remoteAddr, data); err != nil {
+		passedOn, err := s.handlePacket(s.conn, remoteAddr, data, ecn)
+		if err != nil {
 			s.logger.Errorf("error handling packet: %s", err.Error())
 		}
+		if !passedOn {
+			putPacketBuffer(&data)
+		}
 	}
 }
 
+// closeWithError closes the server after reading from the connection failed.
+// Accept then returns the error.
+func (s *server) closeWithError(e error) {
+	s.setError(e)
+	_ = s.Close()
+}
+
+func (s *server) setError(e error) {
+	s.errorOnce.Do(func() {
+		s.serverError = e
+		close(s.errorChan)
+	})
+}
+
 // Accept returns newly openend sessions
 func (s *server) Accept() (Session, error) {
-	var sess Session
+	return s.accept()
+}
+
+func (s *server) accept() (packetHandler, error) {
+	var sess packetHandler
 	select {
 	case sess = <-s.sessionQueue:
+		s.sessionsMutex.Lock()
+		s.numUnacceptedSessions--
+		s.sessionsMutex.Unlock()
 		return sess, nil
 	case <-s.errorChan:
 		return nil, s.serverError
+	case <-s.shutdownChan:
+		return nil, errServerShuttingDown
 	}
 }
 
-// Close the server
-func (s *server) Close() error {
+// ImportSession continues a session that was exported by Session.ExportState
+func (s *server) ImportSession(data []byte) (Session, []Stream, error) {
+	if !s.supportsTLS {
+		return nil, nil, errors.New("importing sessions is only supported for IETF QUIC")
+	}
+	state, err := parseSessionState(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !protocol.IsSupportedVersion(s.config.Versions, protocol.VersionNumber(state.Version)) {
+		return nil, nil, fmt.Errorf("can't import a session with unsupported version %s", protocol.VersionNumber(state.Version))
+	}
+	remoteAddr, err := net.ResolveUDPAddr("udp", state.RemoteAddr)
+	if err != nil {
+		return nil, nil, err
+	}
 	s.sessionsMutex.Lock()
-	if s.closed {
+	defer s.sessionsMutex.Unlock()
+	if s.closed || s.shuttingDown {
+		return nil, nil, errServerShuttingDown
+	}
+	sess, streams, err := newImportedSession(
+		&conn{pconn: s.conn, currentAddr: remoteAddr},
+		state,
+		s.config,
+		s,
+		s.logger,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.numSessions++
+	s.runSession(sess, protocol.ConnectionID(state.SrcConnectionID))
+	return sess, streams, nil
+}
+
+// Shutdown shuts down the server gracefully.
+// It stops accepting new sessions, and tells the peers of all sessions that the server is going away.
+// The peers can't open new streams after that, but the streams that were already opened can still be used.
+// Shutdown then waits until all sessions are closed, or the context expires.
+// Finally, the remaining sessions are closed with a PeerGoingAway error, and the server is closed.
+// If the context expired, the context's error is returned.
+func (s *server) Shutdown(ctx context.Context) error {
+	s.sessionsMutex.Lock()
+	if s.closed || s.shuttingDown {
 		s.sessionsMutex.Unlock()
 		return nil
 	}
-	s.closed = true
+	s.shuttingDown = true
+	close(s.shutdownChan)
+	s.sessionsMutex.Unlock()
+	sessions := s.sessions.Handlers()
 
-	var wg sync.WaitGroup
-	for _, session := range s.sessions {
-		if session != nil {
+	for _, sess := range sessions {
+		sess.goAway()
+	}
+	var err error
+waitLoop:
+	for _, sess := range sessions {
+		done := sess.Context().Done()
+		for done != nil {
+			select {
+			case <-done:
+				done = nil
+			case queued := <-s.sessionQueue:
+				// sessions that were not accepted yet won't be used by the application
+				go queued.Close(errServerShuttingDown)
+			case <-ctx.Done():
+				err = ctx.Err()
+				break waitLoop
+			}
+		}
+	}
+	if err != nil {
+		var wg sync.WaitGroup
+		for _, sess := range sessions {
 			wg.Add(1)
 			go func(sess packetHandler) {
-				// session.Close() blocks until the CONNECTION_CLOSE has been sent and the run-loop has stopped
-				_ = sess.Close(nil)
+				_ = sess.Close(errServerShuttingDown)
 				wg.Done()
-			}(session)
+			}(sess)
 		}
+		wg.Wait()
+	}
+	if cerr := s.Close(); err == nil {
+		err = cerr
 	}
+	return err
+}
+
+func (s *server) isShuttingDown() bool {
+	s.sessionsMutex.RLock()
+	defer s.sessionsMutex.RUnlock()
+	return s.shuttingDown
+}
+
+// isBusy says if new connections are refused, because the server already runs Config.MaxIncomingConnections sessions,
+// or because too many sessions are waiting to be accepted by the application.
+func (s *server) isBusy() bool {
+	s.sessionsMutex.RLock()
+	defer s.sessionsMutex.RUnlock()
+	if s.config.MaxIncomingConnections > 0 && s.numSessions >= s.config.MaxIncomingConnections {
+		return true
+	}
+	return s.numUnacceptedSessions >= protocol.MaxAcceptQueueSize
+}
+
+// acceptCookie is the callback used by the CookieHandler.
+// It is called with a nil token to determine if a Stateless Retry is performed.
+func (s *server) acceptCookie(remoteAddr net.Addr, token *Token) bool {
+	if token == nil {
+		return !s.requireAddressValidation(remoteAddr)
+	}
+	return s.config.AcceptToken(remoteAddr, token)
+}
+
+// requireAddressValidation says if a client that didn't present a valid token has to validate its address.
+func (s *server) requireAddressValidation(remoteAddr net.Addr) bool {
+	s.sessionsMutex.RLock()
+	numHandshakes := s.numHandshakes
+	s.sessionsMutex.RUnlock()
+	if numHandshakes >= protocol.MaxHalfOpenHandshakes {
+		return true
+	}
+	if s.config.RequireAddressValidation != nil {
+		return s.config.RequireAddressValidation(remoteAddr)
+	}
+	return !s.config.AcceptToken(remoteAddr, nil)
+}
+
+// Close the server
+func (s *server) Close() error {
+	s.sessionsMutex.Lock()
+	if s.closed {
+		s.sessionsMutex.Unlock()
+		return nil
+	}
+	s.closed = true
 	s.sessionsMutex.Unlock()
+
+	// IETF QUIC sessions are registered for all the connection IDs they issued,
+	// Handlers only returns every session once
+	var wg sync.WaitGroup
+	for _, session := range s.sessions.Handlers() {
+		wg.Add(1)
+		go func(sess packetHandler) {
+			// session.Close() blocks until the CONNECTION_CLOSE has been sent and the run-loop has stopped
+			_ = sess.Close(nil)
+			wg.Done()
+		}(session)
+	}
 	wg.Wait()
+	if s.eventLoops != nil {
+		s.eventLoops.close()
+	}
 
+	// The connection of a Transport is shared with the sessions dialed on that Transport, so it is not closed.
+	if s.transport != nil {
+		s.transport.removeListener(s)
+		s.setError(errTransportListenerClosed)
+		return nil
+	}
 	err := s.conn.Close()
 	<-s.errorChan // wait for serve() to return
 	return err
@@ -297,39 +756,183 @@ func (s *server) Addr() net.Addr {
 	return s.conn.LocalAddr()
 }
 
-func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet []byte) error {
+// handleCoalescedPacket handles a packet that was coalesced with the preceding packets into a single UDP datagram.
+func (s *server) handleCoalescedPacket(pconn net.PacketConn, remoteAddr net.Addr, data []byte, ecn protocol.ECN) {
+	passedOn, err := s.handlePacket(pconn, remoteAddr, data, ecn)
+	if err != nil {
+		s.logger.Debugf("error handling coalesced packet: %s", err.Error())
+	}
+	if !passedOn {
+		putPacketBuffer(&data)
+	}
+}
+
+// A pendingPacketQueue holds the packets received for a connection before its session was created.
+type pendingPacketQueue struct {
+	packets []pendingPacket
+}
+
+// A pendingPacket is a packet in a pendingPacketQueue.
+type pendingPacket struct {
+	packet *receivedPacket
+	// buffer is the buffer from the buffer pool that the packet was received in.
+	// It is returned to the pool if the packet is dropped.
+	buffer []byte
+}
+
+// startPendingPacketQueue is called when an Initial packet for a new connection is received.
+// Until the session is created, packets for this connection are queued.
+// If no session is created within config.UndecryptablePacketTimeout, the queued packets are dropped.
+// At most protocol.MaxPendingPacketQueues connections can have queued packets at the same time.
+func (s *server) startPendingPacketQueue(connID protocol.ConnectionID) {
+	s.sessionsMutex.Lock()
+	defer s.sessionsMutex.Unlock()
+	if _, ok := s.pendingPackets[string(connID)]; ok {
+		return
+	}
+	if len(s.pendingPackets) >= protocol.MaxPendingPacketQueues {
+		s.logger.Debugf("Not queueing packets for connection %s (too many pending packet queues)", connID)
+		return
+	}
+	if s.pendingPackets == nil {
+		s.pendingPackets = make(map[string]*pendingPacketQueue)
+	}
+	queue := &pendingPacketQueue{}
+	s.pendingPackets[string(connID)] = queue
+	time.AfterFunc(s.config.UndecryptablePacketTimeout, func() {
+		s.sessionsMutex.Lock()
+		defer s.sessionsMutex.Unlock()
+		if s.pendingPackets[string(connID)] != queue {
+			return
+		}
+		delete(s.pendingPackets, string(connID))
+		if len(queue.packets) > 0 {
+			s.logger.Debugf("Dropping %d packets for connection %s (session wasn't created in time)", len(queue.packets), connID)
+		}
+		for _, p := range queue.packets {
+			if s.config.Tracer != nil {
+				s.config.Tracer.DroppedPacket(connID, PacketDropKeyUnavailable)
+			}
+			putPacketBuffer(&p.buffer)
+		}
+	})
+}
+
+// queuePendingPacket queues a packet for a connection whose Initial packet is still being processed.
+// The second return value is false if no Initial packet is being processed for this connection.
+// The first return value says if the packet was queued (or passed on to the session, if it was created in the meantime).
+// If the queue is full, the packet is dropped.
+// The buffer is the buffer from the buffer pool that the packet was received in.
+func (s *server) queuePendingPacket(p *receivedPacket, buffer []byte) (bool /* passed on */, bool /* pending */) {
+	connID := p.header.DestConnectionID
+	s.sessionsMutex.Lock()
+	defer s.sessionsMutex.Unlock()
+	if sess, _ := s.sessions.Get(connID); sess != nil {
+		sess.handlePacket(p)
+		return true, true
+	}
+	queue, ok := s.pendingPackets[string(connID)]
+	if !ok {
+		return false, false
+	}
+	if len(queue.packets) >= s.config.MaxUndecryptablePackets {
+		s.logger.Debugf("Dropping packet 0x%x for connection %s (pending packet queue full)", p.header.PacketNumber, connID)
+		if s.config.Tracer != nil {
+			s.config.Tracer.DroppedPacket(connID, PacketDropDOSPrevention)
+		}
+		return false, true
+	}
+	s.logger.Debugf("Queueing packet 0x%x for connection %s until the session is created", p.header.PacketNumber, connID)
+	queue.packets = append(queue.packets, pendingPacket{packet: p, buffer: buffer})
+	return true, true
+}
+
+// replayPendingPackets passes the packets that were queued for a connection to its session.
+// The sessionsMutex must be held when calling this function.
+func (s *server) replayPendingPackets(connID protocol.ConnectionID, sess packetHandler) {
+	queue, ok := s.pendingPackets[string(connID)]
+	if !ok {
+		return
+	}
+	delete(s.pendingPackets, string(connID))
+	for _, p := range queue.packets {
+		sess.handlePacket(p.packet)
+	}
+}
+
+// handleOversizedPacket handles a packet larger than the maximum packet size we advertised.
+// The packet is dropped. If configured, the session it belongs to is closed.
+func (s *server) handleOversizedPacket(hdr *wire.Header) error {
+	err := qerr.Error(qerr.PacketTooLarge, fmt.Sprintf("received a packet larger than %d bytes", protocol.MaxReceivePacketSize))
+	if !s.config.CloseOnOversizedPackets {
+		return err
+	}
+	if session, _ := s.sessions.Get(hdr.DestConnectionID); session != nil {
+		session.Close(err)
+	}
+	return err
+}
+
+// handlePacket handles a packet received from a client.
+// If the packet was passed on to a session, the session takes over the packet buffer.
+// Otherwise, the caller is responsible for returning it to the buffer pool.
+func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet []byte, ecn protocol.ECN) (bool /* passed on to a session */, error) {
 	rcvTime := time.Now()
 
 	r := bytes.NewReader(packet)
-	hdr, err := wire.ParseHeaderSentByClient(r)
+	hdr, err := wire.ParseHeaderSentByClient(r, s.config.ConnectionIDLength)
 	if err != nil {
-		return qerr.Error(qerr.InvalidPacketHeader, err.Error())
+		return false, qerr.Error(qerr.InvalidPacketHeader, err.Error())
 	}
 	hdr.Raw = packet[:len(packet)-r.Len()]
 	packetData := packet[len(packet)-r.Len():]
 
+	if protocol.ByteCount(len(packet)) > protocol.MaxReceivePacketSize {
+		return false, s.handleOversizedPacket(hdr)
+	}
+
 	if hdr.IsLongHeader {
 		if protocol.ByteCount(len(packetData)) < hdr.PayloadLen {
-			return fmt.Errorf("packet payload (%d bytes) is smaller than the expected payload length (%d bytes)", len(packetData), hdr.PayloadLen)
+			return false, fmt.Errorf("packet payload (%d bytes) is smaller than the expected payload length (%d bytes)", len(packetData), hdr.PayloadLen)
+		}
+		// The UDP datagram might contain more packets after this one.
+		// They are handled after this packet.
+		if coalesced := packetData[hdr.PayloadLen:]; len(coalesced) > 0 {
+			data := copyToPacketBuffer(coalesced)
+			defer s.handleCoalescedPacket(pconn, remoteAddr, data, ecn)
 		}
 		packetData = packetData[:int(hdr.PayloadLen)]
-		// TODO(#1312): implement parsing of compound packets
 	}
 
+	session, sessionKnown := s.sessions.Get(hdr.DestConnectionID)
+
 	if hdr.Type == protocol.PacketTypeInitial {
-		if s.supportsTLS {
-			go s.serverTLS.HandleInitial(remoteAddr, hdr, packetData)
+		if !s.supportsTLS {
+			return false, nil
 		}
-		return nil
+		// Initial packets for an existing session are retransmissions of the ClientHello.
+		// They are passed to the session, since they count towards its anti-amplification limit.
+		if session != nil {
+			session.handlePacket(&receivedPacket{
+				remoteAddr: remoteAddr,
+				header:     hdr,
+				data:       packetData,
+				rcvTime:    rcvTime,
+				ecn:        ecn,
+			})
+			return true, nil
+		}
+		if !sessionKnown {
+			s.startPendingPacketQueue(hdr.DestConnectionID)
+		}
+		// the packet data is still used after this function returns
+		go s.serverTLS.HandleInitial(remoteAddr, hdr, packetData)
+		return true, nil
 	}
 
-	s.sessionsMutex.RLock()
-	session, sessionKnown := s.sessions[string(hdr.DestConnectionID)]
-	s.sessionsMutex.RUnlock()
-
 	if sessionKnown && session == nil {
 		// Late packet for closed session
-		return nil
+		return false, nil
 	}
 
 	// ignore all Public Reset packets
@@ -345,22 +948,50 @@ func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet
 		} else {
 			s.logger.Infof("Received Public Reset for unknown connection %s.", hdr.DestConnectionID)
 		}
-		return nil
+		return false, nil
+	}
+
+	// Packets with a Long Header might arrive while the client's Initial packet is still being processed.
+	if !sessionKnown && hdr.IsLongHeader {
+		if queued, ok := s.queuePendingPacket(&receivedPacket{
+			remoteAddr: remoteAddr,
+			header:     hdr,
+			data:       packetData,
+			rcvTime:    rcvTime,
+			ecn:        ecn,
+		}, packet); ok {
+			return queued, nil
+		}
 	}
 
 	// If we don't have a session for this connection, and this packet cannot open a new connection, send a Public Reset
 	// This should only happen after a server restart, when we still receive packets for connections that we lost the state for.
-	// TODO(#943): implement sending of IETF draft style stateless resets
+	if !sessionKnown && s.supportsTLS && !hdr.IsPublicHeader() {
+		if s.config.Tracer != nil {
+			s.config.Tracer.DroppedPacket(hdr.DestConnectionID, PacketDropUnknownConnectionID)
+		}
+		if hdr.IsLongHeader {
+			return false, fmt.Errorf("received a %s packet for an unknown connection %s", hdr.Type, hdr.DestConnectionID)
+		}
+		return false, s.sendStatelessReset(pconn, remoteAddr, hdr, len(packet))
+	}
 	if !sessionKnown && (!hdr.VersionFlag && hdr.Type != protocol.PacketTypeInitial) {
+		if !s.resetLimiter.Allow(time.Now()) {
+			s.logger.Debugf("Not sending a Public Reset for connection %s to %s (rate limited)", hdr.DestConnectionID, remoteAddr)
+			return false, nil
+		}
+		if s.config.Tracer != nil {
+			s.config.Tracer.SentStatelessReset(hdr.DestConnectionID)
+		}
 		_, err = pconn.WriteTo(wire.WritePublicReset(hdr.DestConnectionID, 0, 0), remoteAddr)
-		return err
+		return false, err
 	}
 
 	// a session is only created once the client sent a supported version
 	// if we receive a packet for a connection that already has session, it's probably an old packet that was sent by the client before the version was negotiated
 	// it is safe to drop it
 	if sessionKnown && hdr.VersionFlag && !protocol.IsSupportedVersion(s.config.Versions, hdr.Version) {
-		return nil
+		return false, nil
 	}
 
 	// send a Version Negotiation Packet if the client is speaking a different protocol version
@@ -368,23 +999,59 @@ func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet
 	if hdr.VersionFlag && !protocol.IsSupportedVersion(s.config.Versions, hdr.Version) {
 		// drop packets that are too small to be valid first packets
 		if len(packet) < protocol.MinClientHelloSize+len(hdr.Raw) {
-			return errors.New("dropping small packet with unknown version")
+			return false, errors.New("dropping small packet with unknown version")
 		}
 		s.logger.Infof("Client offered version %s, sending Version Negotiation Packet", hdr.Version)
+		if s.config.Tracer != nil {
+			s.config.Tracer.SentVersionNegotiation(hdr.DestConnectionID)
+		}
 		_, err := pconn.WriteTo(wire.ComposeGQUICVersionNegotiation(hdr.SrcConnectionID, s.config.Versions), remoteAddr)
-		return err
+		return false, err
 	}
 
 	// This is (potentially) a Client Hello.
 	// Make sure it has the minimum required size before spending any more ressources on it.
 	if !sessionKnown && len(packet) < protocol.MinClientHelloSize+len(hdr.Raw) {
-		return errors.New("dropping small packet for unknown connection")
+		return false, errors.New("dropping small packet for unknown connection")
 	}
 
 	if !sessionKnown {
 		version := hdr.Version
 		if !protocol.IsSupportedVersion(s.config.Versions, version) {
-			return errors.New("Server BUG: negotiated version not supported")
+			return false, errors.New("Server BUG: negotiated version not supported")
+		}
+		if s.isShuttingDown() {
+			_, err := pconn.WriteTo(wire.WritePublicReset(hdr.DestConnectionID, 0, 0), remoteAddr)
+			if err != nil {
+				s.logger.Debugf("Error sending Public Reset: %s", err)
+			}
+			return false, fmt.Errorf("rejecting connection %s: %s", hdr.DestConnectionID, errServerShuttingDown)
+		}
+		if s.isBusy() {
+			_, err := pconn.WriteTo(wire.WritePublicReset(hdr.DestConnectionID, 0, 0), remoteAddr)
+			if err != nil {
+				s.logger.Debugf("Error sending Public Reset: %s", err)
+			}
+			return false, fmt.Errorf("rejecting connection %s: %s", hdr.DestConnectionID, errConnectionRefused)
+		}
+
+		scfg, tlsConf, config := s.scfg, s.tlsConf, s.config
+		if s.config.GetConfigForClient != nil {
+			info := &ClientHelloInfo{
+				ServerName: getGQUICServerName(hdr, packetData, version),
+				RemoteAddr: remoteAddr,
+			}
+			tlsConf, config, err = getConfigForClient(s.tlsConf, s.config, info)
+			if err != nil {
+				if _, werr := pconn.WriteTo(wire.WritePublicReset(hdr.DestConnectionID, 0, 0), remoteAddr); werr != nil {
+					s.logger.Debugf("Error sending Public Reset: %s", werr)
+				}
+				return false, fmt.Errorf("rejecting connection %s: %s", hdr.DestConnectionID, err)
+			}
+			if tlsConf != s.tlsConf {
+				scfg = s.scfg.WithCertChain(crypto.NewCertChain(tlsConf))
+				scfg.KeyLogWriter = tlsConf.KeyLogWriter
+			}
 		}
 
 		s.logger.Infof("Serving new connection: %s, version %s from %v", hdr.DestConnectionID, version, remoteAddr)
@@ -392,17 +1059,15 @@ func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet
 			&conn{pconn: pconn, currentAddr: remoteAddr},
 			version,
 			hdr.DestConnectionID,
-			s.scfg,
-			s.tlsConf,
-			s.config,
+			scfg,
+			tlsConf,
+			config,
 			s.logger,
 		)
 		if err != nil {
-			return err
+			return false, err
 		}
-		s.sessionsMutex.Lock()
-		s.sessions[string(hdr.DestConnectionID)] = session
-		s.sessionsMutex.Unlock()
+		s.sessions.Set(hdr.DestConnectionID, session)
 
 		s.runHandshakeAndSession(session, hdr.DestConnectionID)
 	}
@@ -411,33 +1076,164 @@ func (s *server) handlePacket(pconn net.PacketConn, remoteAddr net.Addr, packet
 		header:     hdr,
 		data:       packetData,
 		rcvTime:    rcvTime,
+		ecn:        ecn,
 	})
-	return nil
+	return true, nil
+}
+
+// getGQUICServerName gets the server name from the CHLO sent in the first packet of a gQUIC connection.
+// It returns an empty string if the packet doesn't contain a (complete) CHLO.
+func getGQUICServerName(hdr *wire.Header, data []byte, version protocol.VersionNumber) string {
+	aead, err := crypto.NewNullAEAD(protocol.PerspectiveServer, hdr.DestConnectionID, version)
+	if err != nil {
+		return ""
+	}
+	// the packet is passed on to the session, so it must not be decrypted in place
+	decrypted, err := aead.Open(nil, data, hdr.PacketNumber, hdr.Raw)
+	if err != nil {
+		return ""
+	}
+	r := bytes.NewReader(decrypted)
+	for r.Len() > 0 {
+		frame, err := wire.ParseNextFrame(r, hdr, version)
+		if err != nil || frame == nil {
+			return ""
+		}
+		f, ok := frame.(*wire.StreamFrame)
+		if !ok || f.StreamID != version.CryptoStreamID() || f.Offset != 0 {
+			continue
+		}
+		msg, err := handshake.ParseHandshakeMessage(bytes.NewReader(f.Data))
+		if err != nil || msg.Tag != handshake.TagCHLO {
+			return ""
+		}
+		return string(msg.Data[handshake.TagSNI])
+	}
+	return ""
+}
+
+// getConfigForClient returns the tls.Config and the Config used for a new session.
+// If the application didn't set a Config.GetConfigForClient, those are the configs passed to Listen.
+func getConfigForClient(tlsConf *tls.Config, config *Config, info *ClientHelloInfo) (*tls.Config, *Config, error) {
+	if config.GetConfigForClient == nil {
+		return tlsConf, config, nil
+	}
+	sessTLSConf, sessConf, err := config.GetConfigForClient(info)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sessTLSConf == nil {
+		sessTLSConf = tlsConf
+	}
+	if sessConf == nil {
+		return sessTLSConf, config, nil
+	}
+	sessConf = populateServerConfig(sessConf)
+	if err := validateStreamScheduler(sessConf.StreamScheduler); err != nil {
+		return nil, nil, err
+	}
+	if err := validateCongestionControl(sessConf.CongestionControl); err != nil {
+		return nil, nil, err
+	}
+	// these options apply to all sessions of the server
+	sessConf.Versions = config.Versions
+	sessConf.ConnectionIDLength = config.ConnectionIDLength
+	sessConf.ConnectionIDGenerator = config.ConnectionIDGenerator
+	sessConf.AcceptToken = config.AcceptToken
+	sessConf.RequireAddressValidation = config.RequireAddressValidation
+	sessConf.StatelessResetKey = config.StatelessResetKey
+	sessConf.TicketKeys = config.TicketKeys
+	sessConf.Allow0RTT = config.Allow0RTT
+	sessConf.SingleUse0RTT = config.SingleUse0RTT
+	sessConf.SharedEventLoop = config.SharedEventLoop
+	sessConf.TLSStack = config.TLSStack
+	sessConf.CloseOnOversizedPackets = config.CloseOnOversizedPackets
+	sessConf.GetConfigForClient = config.GetConfigForClient
+	sessConf.MaxIncomingConnections = config.MaxIncomingConnections
+	return sessTLSConf, sessConf, nil
 }
 
 func (s *server) runHandshakeAndSession(session packetHandler, connID protocol.ConnectionID) {
+	s.sessionsMutex.Lock()
+	s.numSessions++
+	s.numUnacceptedSessions++
+	s.numHandshakes++
+	s.sessionsMutex.Unlock()
+
+	s.runSession(session, connID)
+
 	go func() {
-		_ = session.run()
-		// session.run() returns as soon as the session is closed
-		s.removeConnection(connID)
+		ok := s.waitForHandshake(session)
+		s.sessionsMutex.Lock()
+		s.numHandshakes--
+		if !ok {
+			s.numUnacceptedSessions--
+		}
+		s.sessionsMutex.Unlock()
+		if !ok {
+			return
+		}
+		select {
+		case <-s.shutdownChan:
+			// the session won't be accepted by the application any more
+			_ = session.Close(errServerShuttingDown)
+		case s.sessionQueue <- session:
+		}
 	}()
+}
 
+// runSession runs a session until it is closed.
+// The caller must already have counted the session in numSessions.
+func (s *server) runSession(session packetHandler, connID protocol.ConnectionID) {
+	onClose := func() {
+		s.removeConnection(connID)
+		s.sessionsMutex.Lock()
+		s.numSessions--
+		s.sessionsMutex.Unlock()
+	}
 	go func() {
-		if err := <-session.handshakeStatus(); err != nil {
-			return
+		if s.eventLoops != nil {
+			if sess, ok := session.(eventLoopSession); ok {
+				sess.runOnEventLoop(s.eventLoops.get(), onClose)
+				return
+			}
 		}
-		s.sessionQueue <- session
+		_ = session.run()
+		// session.run() returns as soon as the session is closed
+		onClose()
 	}()
 }
 
+// waitForHandshake waits until a session can be returned by Accept.
+// It returns false if the handshake failed.
+func (s *server) waitForHandshake(session packetHandler) bool {
+	if s.acceptEarlySessions {
+		select {
+		case <-session.earlySessionReadyStatus():
+			return true
+		case err := <-session.handshakeStatus():
+			return err == nil
+		}
+	}
+	return <-session.handshakeStatus() == nil
+}
+
+func (s *server) addConnectionID(id protocol.ConnectionID, sess packetHandler) {
+	s.sessions.Set(id, sess)
+}
+
+func (s *server) retireConnectionID(id protocol.ConnectionID) {
+	s.removeConnection(id)
+}
+
+func (s *server) getStatelessResetToken(id protocol.ConnectionID) protocol.StatelessResetToken {
+	return s.resetTokenGenerator.GetResetToken(id)
+}
+
 func (s *server) removeConnection(id protocol.ConnectionID) {
-	s.sessionsMutex.Lock()
-	s.sessions[string(id)] = nil
-	s.sessionsMutex.Unlock()
+	s.sessions.Set(id, nil)
 
 	time.AfterFunc(s.deleteClosedSessionsAfter, func() {
-		s.sessionsMutex.Lock()
-		delete(s.sessions, string(id))
-		s.sessionsMutex.Unlock()
+		s.sessions.Remove(id)
 	})
 }
@@ -5,6 +5,8 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
 	"net"
 	"reflect"
 	"time"
@@ -29,6 +31,10 @@ type mockSession struct {
 	closedRemote   bool
 	stopRunLoop    chan struct{} // run returns as soon as this channel receives a value
 	handshakeChan  chan error
+	earlyReadyChan chan struct{}
+	// set to make handleStatelessReset report a stateless reset
+	isStatelessReset bool
+	wentAway         bool
 }
 
 func (s *mockSession) handlePacket(p *receivedPacket) {
@@ -48,30 +54,91 @@ func (s *mockSession) Close(e error) error {
 	close(s.stopRunLoop)
 	return nil
 }
+func (s *mockSession) CloseWithError(code ErrorCode, reason string) error {
+	return s.Close(qerr.NewApplicationError(qerr.ErrorCode(code), reason))
+}
 func (s *mockSession) closeRemote(e error) {
 	s.closeReason = e
 	s.closed = true
 	s.closedRemote = true
 	close(s.stopRunLoop)
 }
+func (s *mockSession) goAway() { s.wentAway = true }
+
+// Context returns a context that is cancelled when the run loop stops
+func (s *mockSession) Context() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.stopRunLoop
+		cancel()
+	}()
+	return ctx
+}
+func (s *mockSession) handleStatelessReset([]byte) bool {
+	if s.isStatelessReset {
+		s.closeRemote(StatelessResetError{})
+	}
+	return s.isStatelessReset
+}
 func (s *mockSession) OpenStream() (Stream, error) {
 	return &stream{}, nil
 }
-func (s *mockSession) AcceptStream() (Stream, error)           { panic("not implemented") }
-func (s *mockSession) AcceptUniStream() (ReceiveStream, error) { panic("not implemented") }
-func (s *mockSession) OpenStreamSync() (Stream, error)         { panic("not implemented") }
-func (s *mockSession) OpenUniStream() (SendStream, error)      { panic("not implemented") }
-func (s *mockSession) OpenUniStreamSync() (SendStream, error)  { panic("not implemented") }
-func (s *mockSession) LocalAddr() net.Addr                     { panic("not implemented") }
-func (s *mockSession) RemoteAddr() net.Addr                    { panic("not implemented") }
-func (*mockSession) Context() context.Context                  { panic("not implemented") }
-func (*mockSession) ConnectionState() ConnectionState          { panic("not implemented") }
-func (*mockSession) GetVersion() protocol.VersionNumber        { return protocol.VersionWhatever }
-func (s *mockSession) handshakeStatus() <-chan error           { return s.handshakeChan }
-func (*mockSession) getCryptoStream() cryptoStreamI            { panic("not implemented") }
+func (s *mockSession) AcceptStream() (Stream, error)            { panic("not implemented") }
+func (s *mockSession) AcceptUniStream() (ReceiveStream, error)  { panic("not implemented") }
+func (s *mockSession) OpenStreamSync() (Stream, error)          { panic("not implemented") }
+func (s *mockSession) OpenUniStream() (SendStream, error)       { panic("not implemented") }
+func (s *mockSession) OpenUniStreamSync() (SendStream, error)   { panic("not implemented") }
+func (s *mockSession) LocalAddr() net.Addr                      { panic("not implemented") }
+func (s *mockSession) RemoteAddr() net.Addr                     { panic("not implemented") }
+func (*mockSession) ConnectionState() ConnectionState           { panic("not implemented") }
+func (*mockSession) Stats() SessionStats                        { panic("not implemented") }
+func (*mockSession) NextSendTime() time.Time                    { panic("not implemented") }
+func (*mockSession) BandwidthEstimate() uint64                  { panic("not implemented") }
+func (*mockSession) GetVersion() protocol.VersionNumber         { return protocol.VersionWhatever }
+func (s *mockSession) handshakeStatus() <-chan error            { return s.handshakeChan }
+func (*mockSession) getCryptoStream() cryptoStreamI             { panic("not implemented") }
+func (*mockSession) SendMessage([]byte) error                   { panic("not implemented") }
+func (*mockSession) ReceiveMessage() ([]byte, error)            { panic("not implemented") }
+func (*mockSession) Migrate(net.PacketConn) error               { panic("not implemented") }
+func (*mockSession) UpdateKeys() error                          { panic("not implemented") }
+func (*mockSession) HandshakeComplete() context.Context         { panic("not implemented") }
+func (s *mockSession) earlySessionReadyStatus() <-chan struct{} { return s.earlyReadyChan }
+func (s *mockSession) AcceptStreamContext(context.Context) (Stream, error) {
+	panic("not implemented")
+}
+func (*mockSession) ExportKeyingMaterial(string, []byte, int) ([]byte, error) {
+	panic("not implemented")
+}
+func (*mockSession) ExportState() ([]byte, error) { panic("not implemented") }
+func (s *mockSession) AcceptUniStreamContext(context.Context) (ReceiveStream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenStreamSyncContext(context.Context) (Stream, error) {
+	panic("not implemented")
+}
+func (s *mockSession) OpenUniStreamSyncContext(context.Context) (SendStream, error) {
+	panic("not implemented")
+}
+func (*mockSession) RTT() (time.Duration, time.Duration, time.Duration) {
+	panic("not implemented")
+}
 
 var _ Session = &mockSession{}
 
+// a mockEventLoopSession is a mockSession that can be handed over to an event loop
+type mockEventLoopSession struct {
+	*mockSession
+	onClose   func()
+	eventLoop chan *eventLoop // receives the event loop when runOnEventLoop is called
+}
+
+func (s *mockEventLoopSession) runOnEventLoop(l *eventLoop, onClose func()) {
+	s.onClose = onClose
+	s.eventLoop <- l
+}
+
+var _ eventLoopSession = &mockEventLoopSession{}
+
 func newMockSession(
 	_ connection,
 	_ protocol.VersionNumber,
@@ -82,13 +149,20 @@ func newMockSession(
 	_ utils.Logger,
 ) (packetHandler, error) {
 	s := mockSession{
-		connectionID:  connectionID,
-		handshakeChan: make(chan error),
-		stopRunLoop:   make(chan struct{}),
+		connectionID:   connectionID,
+		handshakeChan:  make(chan error),
+		earlyReadyChan: make(chan struct{}),
+		stopRunLoop:    make(chan struct{}),
 	}
 	return &s, nil
 }
 
+// getSession returns the session that the server maps the connection ID to
+func getSession(serv *server, connID protocol.ConnectionID) packetHandler {
+	sess, _ := serv.sessions.Get(connID)
+	return sess
+}
+
 var _ = Describe("Server", func() {
 	var (
 		conn    *mockPacketConn
@@ -111,12 +185,14 @@ var _ = Describe("Server", func() {
 
 		BeforeEach(func() {
 			serv = &server{
-				sessions:     make(map[string]packetHandler),
+				sessions:     newPacketHandlerMap(protocol.PacketHandlerMapShards),
 				newSession:   newMockSession,
 				conn:         conn,
 				config:       config,
-				sessionQueue: make(chan Session, 5),
+				resetLimiter: utils.NewTokenBucket(protocol.StatelessResetInterval, protocol.MaxStatelessResetBurst),
+				sessionQueue: make(chan packetHandler, 5),
 				errorChan:    make(chan struct{}),
+				shutdownChan: make(chan struct{}),
 				logger:       utils.DefaultLogger,
 			}
 			b := &bytes.Buffer{}
@@ -126,6 +202,15 @@ var _ = Describe("Server", func() {
 			firstPacket = append(firstPacket, bytes.Repeat([]byte{0}, protocol.MinClientHelloSize)...) // add padding
 		})
 
+		// getFirstPacket returns a valid first packet for a new connection,
+		// using a connection ID that differs from connID in the last byte
+		getFirstPacket := func(id byte) []byte {
+			p := make([]byte, len(firstPacket))
+			copy(p, firstPacket)
+			p[8] = id
+			return p
+		}
+
 		It("setups with the right values", func() {
 			config := &Config{
 				HandshakeTimeout:            1337 * time.Minute,
@@ -133,6 +218,12 @@ var _ = Describe("Server", func() {
 				RequestConnectionIDOmission: true,
 				MaxIncomingStreams:          1234,
 				MaxIncomingUniStreams:       4321,
+				MaxIncomingConnections:      42,
+				RequireAddressValidation:    func(net.Addr) bool { return true },
+				TicketKeys:                  &TicketKeys{},
+				Allow0RTT:                   func(net.Addr, time.Duration) bool { return true },
+				SingleUse0RTT:               true,
+				SharedEventLoop:             true,
 			}
 			c := populateServerConfig(config)
 			Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -140,6 +231,12 @@ var _ = Describe("Server", func() {
 			Expect(c.RequestConnectionIDOmission).To(BeFalse())
 			Expect(c.MaxIncomingStreams).To(Equal(1234))
 			Expect(c.MaxIncomingUniStreams).To(Equal(4321))
+			Expect(c.MaxIncomingConnections).To(Equal(42))
+			Expect(c.RequireAddressValidation).ToNot(BeNil())
+			Expect(c.TicketKeys).To(Equal(config.TicketKeys))
+			Expect(c.Allow0RTT).ToNot(BeNil())
+			Expect(c.SingleUse0RTT).To(BeTrue())
+			Expect(c.SharedEventLoop).To(BeTrue())
 		})
 
 		It("disables bidirectional streams", func() {
@@ -162,6 +259,36 @@ var _ = Describe("Server", func() {
 			Expect(c.MaxIncomingUniStreams).To(BeZero())
 		})
 
+		It("uses the default flow control windows", func() {
+			c := populateServerConfig(&Config{})
+			Expect(c.InitialStreamReceiveWindow).To(BeEquivalentTo(protocol.ReceiveStreamFlowControlWindow))
+			Expect(c.MaxStreamReceiveWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveStreamFlowControlWindowServer))
+			Expect(c.InitialConnectionReceiveWindow).To(BeEquivalentTo(protocol.ReceiveConnectionFlowControlWindow))
+			Expect(c.MaxConnectionReceiveWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveConnectionFlowControlWindowServer))
+		})
+
+		It("uses the configured flow control windows", func() {
+			c := populateServerConfig(&Config{
+				InitialStreamReceiveWindow:     1000,
+				MaxStreamReceiveWindow:         2000,
+				InitialConnectionReceiveWindow: 3000,
+				MaxConnectionReceiveWindow:     4000,
+			})
+			Expect(c.InitialStreamReceiveWindow).To(BeEquivalentTo(1000))
+			Expect(c.MaxStreamReceiveWindow).To(BeEquivalentTo(2000))
+			Expect(c.InitialConnectionReceiveWindow).To(BeEquivalentTo(3000))
+			Expect(c.MaxConnectionReceiveWindow).To(BeEquivalentTo(4000))
+		})
+
+		It("doesn't use maximum flow control windows smaller than the initial windows", func() {
+			c := populateServerConfig(&Config{
+				InitialStreamReceiveWindow:     10 * (1 << 20),
+				InitialConnectionReceiveWindow: 20 * (1 << 20),
+			})
+			Expect(c.MaxStreamReceiveWindow).To(BeEquivalentTo(10 * (1 << 20)))
+			Expect(c.MaxConnectionReceiveWindow).To(BeEquivalentTo(20 * (1 << 20)))
+		})
+
 		It("returns the address", func() {
 			conn.addr = &net.UDPAddr{
 				IP:   net.IPv4(192, 168, 13, 37),
@@ -171,14 +298,118 @@ var _ = Describe("Server", func() {
 		})
 
 		It("creates new sessions", func() {
-			err := serv.handlePacket(nil, nil, firstPacket)
+			passedOn, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			sess := serv.sessions[string(connID)].(*mockSession)
+			Expect(passedOn).To(BeTrue())
+			Expect(serv.sessions.Len()).To(Equal(1))
+			sess := getSession(serv, connID).(*mockSession)
 			Expect(sess.connectionID).To(Equal(connID))
 			Expect(sess.handledPackets).To(HaveLen(1))
 		})
 
+		Context("getting the config for a client", func() {
+			var (
+				sessSCFG    *handshake.ServerConfig
+				sessTLSConf *tls.Config
+				sessConf    *Config
+			)
+
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+
+			// getCHLOPacket returns a first packet that contains a CHLO with the SNI
+			getCHLOPacket := func(sni string) []byte {
+				version := protocol.SupportedVersions[0]
+				hdr := make([]byte, 14)
+				copy(hdr, firstPacket)
+				chlo := &bytes.Buffer{}
+				handshake.HandshakeMessage{
+					Tag:  handshake.TagCHLO,
+					Data: map[handshake.Tag][]byte{handshake.TagSNI: []byte(sni)},
+				}.Write(chlo)
+				payload := &bytes.Buffer{}
+				f := &wire.StreamFrame{StreamID: version.CryptoStreamID(), Data: chlo.Bytes(), DataLenPresent: true}
+				Expect(f.Write(payload, version)).To(Succeed())
+				payload.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize)) // add padding
+				aead, err := crypto.NewNullAEAD(protocol.PerspectiveClient, connID, version)
+				Expect(err).ToNot(HaveOccurred())
+				return append(hdr, aead.Seal(nil, payload.Bytes(), 1, hdr)...)
+			}
+
+			BeforeEach(func() {
+				kex, err := crypto.NewCurve25519KEX()
+				Expect(err).ToNot(HaveOccurred())
+				serv.scfg, err = handshake.NewServerConfig(kex, nil)
+				Expect(err).ToNot(HaveOccurred())
+				serv.tlsConf = testdata.GetTLSConfig()
+				serv.config = populateServerConfig(config)
+				sessSCFG, sessTLSConf, sessConf = nil, nil, nil
+				serv.newSession = func(conn connection, v protocol.VersionNumber, connID protocol.ConnectionID, scfg *handshake.ServerConfig, tlsConf *tls.Config, config *Config, logger utils.Logger) (packetHandler, error) {
+					sessSCFG = scfg
+					sessTLSConf = tlsConf
+					sessConf = config
+					return newMockSession(conn, v, connID, scfg, tlsConf, config, logger)
+				}
+			})
+
+			It("gets the server name from the CHLO", func() {
+				packet := getCHLOPacket("quic.clemente.io")
+				hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(packet), protocol.DefaultConnectionIDLength)
+				Expect(err).ToNot(HaveOccurred())
+				hdr.Raw = packet[:14]
+				Expect(getGQUICServerName(hdr, packet[14:], protocol.SupportedVersions[0])).To(Equal("quic.clemente.io"))
+			})
+
+			It("doesn't get a server name, if the packet doesn't contain a CHLO", func() {
+				hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(firstPacket), protocol.DefaultConnectionIDLength)
+				Expect(err).ToNot(HaveOccurred())
+				hdr.Raw = firstPacket[:14]
+				Expect(getGQUICServerName(hdr, firstPacket[14:], protocol.SupportedVersions[0])).To(BeEmpty())
+			})
+
+			It("uses the configs passed to Listen, if no GetConfigForClient is set", func() {
+				_, err := serv.handlePacket(conn, remoteAddr, getCHLOPacket("quic.clemente.io"), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sessSCFG).To(Equal(serv.scfg))
+				Expect(sessTLSConf).To(Equal(serv.tlsConf))
+				Expect(sessConf).To(Equal(serv.config))
+			})
+
+			It("passes the ClientHelloInfo and uses the configs returned", func() {
+				var info *ClientHelloInfo
+				tlsConf := testdata.GetTLSConfig()
+				serv.config.GetConfigForClient = func(i *ClientHelloInfo) (*tls.Config, *Config, error) {
+					info = i
+					return tlsConf, &Config{IdleTimeout: 42 * time.Second, Versions: []protocol.VersionNumber{protocol.VersionTLS}}, nil
+				}
+				_, err := serv.handlePacket(conn, remoteAddr, getCHLOPacket("quic.clemente.io"), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.ServerName).To(Equal("quic.clemente.io"))
+				Expect(info.RemoteAddr).To(Equal(remoteAddr))
+				Expect(sessTLSConf).To(Equal(tlsConf))
+				Expect(sessConf.IdleTimeout).To(Equal(42 * time.Second))
+				Expect(sessConf.Versions).To(Equal(serv.config.Versions))
+				// the server config uses the certificate chain of the tls.Config
+				Expect(sessSCFG).ToNot(Equal(serv.scfg))
+				Expect(sessSCFG.ID).To(Equal(serv.scfg.ID))
+			})
+
+			It("rejects the connection, if GetConfigForClient returns an error", func() {
+				serv.config.GetConfigForClient = func(*ClientHelloInfo) (*tls.Config, *Config, error) {
+					return nil, nil, errors.New("unknown host")
+				}
+				passedOn, err := serv.handlePacket(conn, remoteAddr, getCHLOPacket("foo.example"), protocol.ECNNon)
+				Expect(err).To(MatchError("rejecting connection 0x4cfa9f9b668619f6: unknown host"))
+				Expect(passedOn).To(BeFalse())
+				Expect(serv.sessions.Len()).To(BeZero())
+				Expect(sessConf).To(BeNil())
+				// a Public Reset was sent
+				Expect(conn.dataWritten.Len()).ToNot(BeZero())
+				hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.VersionUnknown, 8)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.ResetFlag).To(BeTrue())
+			})
+		})
+
 		It("accepts new TLS sessions", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 			sess, err := newMockSession(nil, protocol.VersionTLS, connID, nil, nil, nil, nil)
@@ -190,9 +421,7 @@ var _ = Describe("Server", func() {
 				sess:   sess,
 			}
 			Eventually(func() packetHandler {
-				serv.sessionsMutex.Lock()
-				defer serv.sessionsMutex.Unlock()
-				return serv.sessions[string(connID)]
+				return getSession(serv, connID)
 			}).Should(Equal(sess))
 		})
 
@@ -209,18 +438,14 @@ var _ = Describe("Server", func() {
 				sess:   sess1,
 			}
 			Eventually(func() packetHandler {
-				serv.sessionsMutex.Lock()
-				defer serv.sessionsMutex.Unlock()
-				return serv.sessions[string(connID)]
+				return getSession(serv, connID)
 			}).Should(Equal(sess1))
 			serv.serverTLS.sessionChan <- tlsSession{
 				connID: connID,
 				sess:   sess2,
 			}
 			Eventually(func() packetHandler {
-				serv.sessionsMutex.Lock()
-				defer serv.sessionsMutex.Unlock()
-				return serv.sessions[string(connID)]
+				return getSession(serv, connID)
 			}).Should(Equal(sess1))
 		})
 
@@ -232,10 +457,10 @@ var _ = Describe("Server", func() {
 				acceptedSess, err = serv.Accept()
 				Expect(err).ToNot(HaveOccurred())
 			}()
-			err := serv.handlePacket(nil, nil, firstPacket)
+			_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			sess := serv.sessions[string(connID)].(*mockSession)
+			Expect(serv.sessions.Len()).To(Equal(1))
+			sess := getSession(serv, connID).(*mockSession)
 			Consistently(func() Session { return acceptedSess }).Should(BeNil())
 			close(sess.handshakeChan)
 			Eventually(func() Session { return acceptedSess }).Should(Equal(sess))
@@ -249,74 +474,643 @@ var _ = Describe("Server", func() {
 				serv.Accept()
 				accepted = true
 			}()
-			err := serv.handlePacket(nil, nil, firstPacket)
+			_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			sess := serv.sessions[string(connID)].(*mockSession)
+			Expect(serv.sessions.Len()).To(Equal(1))
+			sess := getSession(serv, connID).(*mockSession)
 			sess.handshakeChan <- errors.New("handshake failed")
 			Consistently(func() bool { return accepted }).Should(BeFalse())
 			close(done)
 		})
 
+		Context("accepting early sessions", func() {
+			BeforeEach(func() {
+				serv.acceptEarlySessions = true
+			})
+
+			It("accepts a session as soon as data can be sent", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					acceptedSess, err := (&earlyServer{serv}).Accept()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(acceptedSess.(*mockSession).connectionID).To(Equal(connID))
+					close(done)
+				}()
+				_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions.Len()).To(Equal(1))
+				sess := getSession(serv, connID).(*mockSession)
+				Consistently(done).ShouldNot(BeClosed())
+				close(sess.earlyReadyChan)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("accepts a session when the handshake completes", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := serv.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					close(done)
+				}()
+				_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				sess := getSession(serv, connID).(*mockSession)
+				close(sess.handshakeChan)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("doesn't accept sessions that error before data can be sent", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					serv.Accept()
+					close(done)
+				}()
+				_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				sess := getSession(serv, connID).(*mockSession)
+				sess.handshakeChan <- errors.New("handshake failed")
+				Consistently(done).ShouldNot(BeClosed())
+				// make the go routine return
+				close(serv.errorChan)
+				Eventually(done).Should(BeClosed())
+			})
+		})
+
 		It("assigns packets to existing sessions", func() {
-			err := serv.handlePacket(nil, nil, firstPacket)
+			_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			err = serv.handlePacket(nil, nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01})
+			_, err = serv.handlePacket(nil, nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[string(connID)].(*mockSession).connectionID).To(Equal(connID))
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets).To(HaveLen(2))
+			Expect(serv.sessions.Len()).To(Equal(1))
+			Expect(getSession(serv, connID).(*mockSession).connectionID).To(Equal(connID))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets).To(HaveLen(2))
+		})
+
+		It("assigns packets with a Short Header to existing sessions, using the configured connection ID length", func() {
+			serv.config.ConnectionIDLength = 5
+			shortConnID := protocol.ConnectionID{1, 2, 3, 4, 5}
+			sess := &mockSession{connectionID: shortConnID}
+			serv.sessions.Set(shortConnID, sess)
+			b := &bytes.Buffer{}
+			hdr := &wire.Header{
+				DestConnectionID: shortConnID,
+				PacketNumber:     1,
+				PacketNumberLen:  protocol.PacketNumberLen1,
+			}
+			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+			_, err := serv.handlePacket(nil, nil, append(b.Bytes(), []byte("foobar")...), protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.handledPackets).To(HaveLen(1))
+			Expect(sess.handledPackets[0].header.DestConnectionID).To(Equal(shortConnID))
+			Expect(sess.handledPackets[0].data).To(Equal([]byte("foobar")))
+		})
+
+		It("passes Initial packets for existing sessions to the session", func() {
+			serv.supportsTLS = true
+			sess := &mockSession{connectionID: connID}
+			serv.sessions.Set(connID, sess)
+			b := &bytes.Buffer{}
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				DestConnectionID: connID,
+				SrcConnectionID:  connID,
+				PacketNumber:     1,
+				PayloadLen:       protocol.MinInitialPacketSize,
+				Version:          versionIETFFrames,
+			}
+			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+			_, err := serv.handlePacket(nil, udpAddr, append(b.Bytes(), make([]byte, protocol.MinInitialPacketSize)...), protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.handledPackets).To(HaveLen(1))
+			Expect(sess.handledPackets[0].header.Type).To(Equal(protocol.PacketTypeInitial))
+		})
+
+		It("limits the rate of Public Resets sent for unknown connections", func() {
+			packet := []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}
+			resetLen := len(wire.WritePublicReset(connID, 0, 0))
+			for i := 0; i < protocol.MaxStatelessResetBurst; i++ {
+				_, err := serv.handlePacket(conn, udpAddr, packet, protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(conn.dataWritten.Len()).To(Equal(protocol.MaxStatelessResetBurst * resetLen))
+			_, err := serv.handlePacket(conn, udpAddr, packet, protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(conn.dataWritten.Len()).To(Equal(protocol.MaxStatelessResetBurst * resetLen))
+		})
+
+		Context("stateless resets", func() {
+			var resetTokenGen *handshake.ResetTokenGenerator
+
+			getShortHeaderPacket := func(connID protocol.ConnectionID, payloadLen int) []byte {
+				b := &bytes.Buffer{}
+				hdr := &wire.Header{
+					DestConnectionID: connID,
+					PacketNumber:     1,
+					PacketNumberLen:  protocol.PacketNumberLen1,
+				}
+				Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+				return append(b.Bytes(), make([]byte, payloadLen)...)
+			}
+
+			BeforeEach(func() {
+				var err error
+				resetTokenGen, err = handshake.NewResetTokenGenerator([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				serv.supportsTLS = true
+				serv.resetTokenGenerator = resetTokenGen
+				serv.config.ConnectionIDLength = connID.Len()
+			})
+
+			It("sends a stateless reset for packets with a Short Header for unknown connections", func() {
+				_, err := serv.handlePacket(conn, udpAddr, getShortHeaderPacket(connID, 100), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(conn.dataWrittenTo).To(Equal(udpAddr))
+				data := conn.dataWritten.Bytes()
+				Expect(data).To(HaveLen(protocol.MinStatelessResetSize))
+				token := resetTokenGen.GetResetToken(connID)
+				Expect(data[len(data)-16:]).To(Equal(token[:]))
+				Expect(serv.sessions.Len()).To(BeZero())
+			})
+
+			It("traces packets for unknown connections, and the stateless reset sent", func() {
+				tracer := &recordingTracer{}
+				serv.config.Tracer = tracer
+				_, err := serv.handlePacket(conn, udpAddr, getShortHeaderPacket(connID, 100), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tracer.getDropped()).To(Equal([]tracedDrop{{connID: connID, reason: PacketDropUnknownConnectionID}}))
+				Expect(tracer.resetsSent).To(Equal([]ConnectionID{connID}))
+			})
+
+			It("limits the rate of stateless resets", func() {
+				for i := 0; i < protocol.MaxStatelessResetBurst; i++ {
+					_, err := serv.handlePacket(conn, udpAddr, getShortHeaderPacket(connID, 100), protocol.ECNNon)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(conn.dataWritten.Len()).To(Equal(protocol.MaxStatelessResetBurst * protocol.MinStatelessResetSize))
+				_, err := serv.handlePacket(conn, udpAddr, getShortHeaderPacket(connID, 100), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(conn.dataWritten.Len()).To(Equal(protocol.MaxStatelessResetBurst * protocol.MinStatelessResetSize))
+				// the budget is regained over time
+				time.Sleep(protocol.StatelessResetInterval)
+				_, err = serv.handlePacket(conn, udpAddr, getShortHeaderPacket(connID, 100), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(conn.dataWritten.Len()).To(Equal((protocol.MaxStatelessResetBurst + 1) * protocol.MinStatelessResetSize))
+			})
+
+			It("doesn't send stateless resets in response to small packets", func() {
+				packet := getShortHeaderPacket(connID, 0)
+				packet = append(packet, make([]byte, protocol.MinStatelessResetSize-len(packet))...)
+				_, err := serv.handlePacket(conn, udpAddr, packet, protocol.ECNNon)
+				Expect(err).To(MatchError(fmt.Sprintf("not sending a stateless reset in response to a %d byte packet", protocol.MinStatelessResetSize)))
+				Expect(conn.dataWritten.Len()).To(BeZero())
+			})
+
+			It("doesn't send stateless resets for known connections", func() {
+				sess := &mockSession{connectionID: connID}
+				serv.sessions.Set(connID, sess)
+				_, err := serv.handlePacket(conn, udpAddr, getShortHeaderPacket(connID, 100), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess.handledPackets).To(HaveLen(1))
+				Expect(conn.dataWritten.Len()).To(BeZero())
+			})
+
+			It("drops packets with a Long Header for unknown connections", func() {
+				b := &bytes.Buffer{}
+				hdr := &wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: connID,
+					SrcConnectionID:  connID,
+					PacketNumber:     1,
+					PayloadLen:       100,
+					Version:          versionIETFFrames,
+				}
+				Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+				_, err := serv.handlePacket(conn, udpAddr, append(b.Bytes(), make([]byte, 100)...), protocol.ECNNon)
+				Expect(err).To(MatchError(fmt.Sprintf("received a Handshake packet for an unknown connection %s", connID)))
+				Expect(conn.dataWritten.Len()).To(BeZero())
+			})
+
+			Context("packets arriving before the session is created", func() {
+				getHandshakePacket := func(pn protocol.PacketNumber) []byte {
+					b := &bytes.Buffer{}
+					hdr := &wire.Header{
+						IsLongHeader:     true,
+						Type:             protocol.PacketTypeHandshake,
+						DestConnectionID: connID,
+						SrcConnectionID:  connID,
+						PacketNumber:     pn,
+						PayloadLen:       100,
+						Version:          versionIETFFrames,
+					}
+					Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+					// queued packets are returned to the buffer pool when they are dropped
+					return copyToPacketBuffer(append(b.Bytes(), make([]byte, 100)...))
+				}
+
+				BeforeEach(func() {
+					serv.config.MaxUndecryptablePackets = 2
+					serv.config.UndecryptablePacketTimeout = time.Hour
+				})
+
+				It("queues packets while the Initial packet is processed, and passes them to the session", func() {
+					Expect(serv.setupTLS()).To(Succeed())
+					serv.startPendingPacketQueue(connID)
+					passedOn, err := serv.handlePacket(conn, udpAddr, getHandshakePacket(1), protocol.ECNNon)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(passedOn).To(BeTrue())
+					passedOn, err = serv.handlePacket(conn, udpAddr, getHandshakePacket(2), protocol.ECNNon)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(passedOn).To(BeTrue())
+					sess, err := newMockSession(nil, versionIETFFrames, connID, nil, nil, nil, nil)
+					Expect(err).ToNot(HaveOccurred())
+					serv.serverTLS.sessionChan <- tlsSession{
+						connID: connID,
+						sess:   sess,
+					}
+					Eventually(func() []protocol.PacketNumber {
+						serv.sessionsMutex.Lock()
+						defer serv.sessionsMutex.Unlock()
+						var pns []protocol.PacketNumber
+						for _, p := range sess.(*mockSession).handledPackets {
+							pns = append(pns, p.header.PacketNumber)
+						}
+						return pns
+					}).Should(Equal([]protocol.PacketNumber{1, 2}))
+					serv.sessionsMutex.Lock()
+					Expect(serv.pendingPackets).To(BeEmpty())
+					serv.sessionsMutex.Unlock()
+				})
+
+				It("drops packets when the queue is full", func() {
+					tracer := &recordingTracer{}
+					serv.config.Tracer = tracer
+					serv.startPendingPacketQueue(connID)
+					for i := 1; i <= 2; i++ {
+						passedOn, err := serv.handlePacket(conn, udpAddr, getHandshakePacket(protocol.PacketNumber(i)), protocol.ECNNon)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(passedOn).To(BeTrue())
+					}
+					passedOn, err := serv.handlePacket(conn, udpAddr, getHandshakePacket(3), protocol.ECNNon)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(passedOn).To(BeFalse())
+					Expect(serv.pendingPackets[string(connID)].packets).To(HaveLen(2))
+					Expect(tracer.getDropped()).To(Equal([]tracedDrop{{connID: connID, reason: PacketDropDOSPrevention}}))
+				})
+
+				It("drops the queued packets if the session isn't created in time", func() {
+					tracer := &recordingTracer{}
+					serv.config.Tracer = tracer
+					serv.config.UndecryptablePacketTimeout = 50 * time.Millisecond
+					serv.startPendingPacketQueue(connID)
+					passedOn, err := serv.handlePacket(conn, udpAddr, getHandshakePacket(1), protocol.ECNNon)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(passedOn).To(BeTrue())
+					Eventually(tracer.getDropped).Should(Equal([]tracedDrop{{connID: connID, reason: PacketDropKeyUnavailable}}))
+					serv.sessionsMutex.Lock()
+					Expect(serv.pendingPackets).To(BeEmpty())
+					serv.sessionsMutex.Unlock()
+					// now the connection is unknown
+					_, err = serv.handlePacket(conn, udpAddr, getHandshakePacket(2), protocol.ECNNon)
+					Expect(err).To(MatchError(fmt.Sprintf("received a Handshake packet for an unknown connection %s", connID)))
+				})
+
+				It("limits the number of pending packet queues", func() {
+					for i := 0; i < protocol.MaxPendingPacketQueues; i++ {
+						serv.startPendingPacketQueue(protocol.ConnectionID{0, 0, byte(i >> 8), byte(i), 1, 2, 3, 4})
+					}
+					Expect(serv.pendingPackets).To(HaveLen(protocol.MaxPendingPacketQueues))
+					serv.startPendingPacketQueue(connID)
+					Expect(serv.pendingPackets).To(HaveLen(protocol.MaxPendingPacketQueues))
+					// packets for this connection are not queued
+					_, err := serv.handlePacket(conn, udpAddr, getHandshakePacket(1), protocol.ECNNon)
+					Expect(err).To(MatchError(fmt.Sprintf("received a Handshake packet for an unknown connection %s", connID)))
+				})
+			})
+		})
+
+		Context("oversized packets", func() {
+			var (
+				sess   *mockSession
+				packet []byte
+			)
+
+			BeforeEach(func() {
+				serv.config.ConnectionIDLength = connID.Len()
+				sess = &mockSession{connectionID: connID, stopRunLoop: make(chan struct{})}
+				serv.sessions.Set(connID, sess)
+				b := &bytes.Buffer{}
+				hdr := &wire.Header{
+					DestConnectionID: connID,
+					PacketNumber:     1,
+					PacketNumberLen:  protocol.PacketNumberLen1,
+				}
+				Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+				packet = append(b.Bytes(), make([]byte, int(protocol.MaxReceiveBufferSize)-b.Len())...)
+			})
+
+			It("drops packets larger than the maximum packet size", func() {
+				_, err := serv.handlePacket(nil, nil, packet, protocol.ECNNon)
+				Expect(err).To(MatchError("PacketTooLarge: received a packet larger than 1452 bytes"))
+				Expect(sess.handledPackets).To(BeEmpty())
+				Expect(sess.closed).To(BeFalse())
+			})
+
+			It("closes the session, if configured", func() {
+				serv.config.CloseOnOversizedPackets = true
+				_, err := serv.handlePacket(nil, nil, packet, protocol.ECNNon)
+				Expect(err).To(MatchError("PacketTooLarge: received a packet larger than 1452 bytes"))
+				Expect(sess.handledPackets).To(BeEmpty())
+				Expect(sess.closed).To(BeTrue())
+				Expect(sess.closeReason).To(MatchError(err))
+			})
+
+			It("accepts packets that have the maximum packet size", func() {
+				serv.config.CloseOnOversizedPackets = true
+				_, err := serv.handlePacket(nil, nil, packet[:protocol.MaxReceivePacketSize], protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess.handledPackets).To(HaveLen(1))
+				Expect(sess.closed).To(BeFalse())
+			})
 		})
 
 		It("closes and deletes sessions", func() {
 			serv.deleteClosedSessionsAfter = time.Second // make sure that the nil value for the closed session doesn't get deleted in this test
 			nullAEAD, err := crypto.NewNullAEAD(protocol.PerspectiveServer, connID, protocol.VersionWhatever)
 			Expect(err).ToNot(HaveOccurred())
-			err = serv.handlePacket(nil, nil, append(firstPacket, nullAEAD.Seal(nil, nil, 0, firstPacket)...))
+			_, err = serv.handlePacket(nil, nil, append(firstPacket, nullAEAD.Seal(nil, nil, 0, firstPacket)...), protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[string(connID)]).ToNot(BeNil())
+			Expect(serv.sessions.Len()).To(Equal(1))
+			Expect(getSession(serv, connID)).ToNot(BeNil())
 			// make session.run() return
-			serv.sessions[string(connID)].(*mockSession).stopRunLoop <- struct{}{}
+			getSession(serv, connID).(*mockSession).stopRunLoop <- struct{}{}
 			// The server should now have closed the session, leaving a nil value in the sessions map
-			Consistently(func() map[string]packetHandler { return serv.sessions }).Should(HaveLen(1))
-			Expect(serv.sessions[string(connID)]).To(BeNil())
+			Consistently(serv.sessions.Len).Should(Equal(1))
+			Expect(getSession(serv, connID)).To(BeNil())
 		})
 
 		It("deletes nil session entries after a wait time", func() {
 			serv.deleteClosedSessionsAfter = 25 * time.Millisecond
 			nullAEAD, err := crypto.NewNullAEAD(protocol.PerspectiveServer, connID, protocol.VersionWhatever)
 			Expect(err).ToNot(HaveOccurred())
-			err = serv.handlePacket(nil, nil, append(firstPacket, nullAEAD.Seal(nil, nil, 0, firstPacket)...))
+			_, err = serv.handlePacket(nil, nil, append(firstPacket, nullAEAD.Seal(nil, nil, 0, firstPacket)...), protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions).To(HaveKey(string(connID)))
+			Expect(serv.sessions.Len()).To(Equal(1))
+			_, ok := serv.sessions.Get(connID)
+			Expect(ok).To(BeTrue())
 			// make session.run() return
-			serv.sessions[string(connID)].(*mockSession).stopRunLoop <- struct{}{}
+			getSession(serv, connID).(*mockSession).stopRunLoop <- struct{}{}
 			Eventually(func() bool {
-				serv.sessionsMutex.Lock()
-				_, ok := serv.sessions[string(connID)]
-				serv.sessionsMutex.Unlock()
+				_, ok := serv.sessions.Get(connID)
 				return ok
 			}).Should(BeFalse())
 		})
 
+		It("hands sessions over to an event loop, if configured", func() {
+			serv.eventLoops = newEventLoopGroup(1)
+			defer serv.eventLoops.close()
+			sessChan := make(chan *mockEventLoopSession, 1)
+			serv.newSession = func(conn connection, v protocol.VersionNumber, connID protocol.ConnectionID, scfg *handshake.ServerConfig, tlsConf *tls.Config, conf *Config, logger utils.Logger) (packetHandler, error) {
+				sess, _ := newMockSession(conn, v, connID, scfg, tlsConf, conf, logger)
+				s := &mockEventLoopSession{
+					mockSession: sess.(*mockSession),
+					eventLoop:   make(chan *eventLoop, 1),
+				}
+				sessChan <- s
+				return s, nil
+			}
+			nullAEAD, err := crypto.NewNullAEAD(protocol.PerspectiveServer, connID, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = serv.handlePacket(nil, nil, append(firstPacket, nullAEAD.Seal(nil, nil, 0, firstPacket)...), protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			var sess *mockEventLoopSession
+			Expect(sessChan).To(Receive(&sess))
+			Eventually(sess.eventLoop).Should(Receive(Equal(serv.eventLoops.loops[0])))
+			Expect(getSession(serv, connID)).To(Equal(sess))
+			// the server removes the session once its run loop stopped on the event loop
+			sess.onClose()
+			Expect(getSession(serv, connID)).To(BeNil())
+		})
+
 		It("closes sessions and the connection when Close is called", func() {
 			go serv.serve()
 			session, _ := newMockSession(nil, 0, connID, nil, nil, nil, nil)
-			serv.sessions[string(connID)] = session
+			serv.sessions.Set(connID, session)
 			err := serv.Close()
 			Expect(err).NotTo(HaveOccurred())
 			Expect(session.(*mockSession).closed).To(BeTrue())
 			Expect(conn.closed).To(BeTrue())
 		})
 
+		Context("refusing connections", func() {
+			It("refuses new connections when MaxIncomingConnections sessions are running", func() {
+				serv.config.MaxIncomingConnections = 2
+				_, err := serv.handlePacket(conn, udpAddr, getFirstPacket(1), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = serv.handlePacket(conn, udpAddr, getFirstPacket(2), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.sessions.Len()).To(Equal(2))
+				_, err = serv.handlePacket(conn, udpAddr, getFirstPacket(3), protocol.ECNNon)
+				Expect(err).To(MatchError(ContainSubstring(errConnectionRefused.Error())))
+				Expect(serv.sessions.Len()).To(Equal(2))
+				Expect(conn.dataWrittenTo).To(Equal(udpAddr))
+				Expect(conn.dataWritten.Bytes()[0] & 0x02).ToNot(BeZero()) // check that the ResetFlag is set
+				// new connections are accepted once a session is closed
+				sess := getSession(serv, protocol.ConnectionID{0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 1})
+				Expect(sess).ToNot(BeNil())
+				Expect(sess.Close(nil)).To(Succeed())
+				Eventually(serv.isBusy).Should(BeFalse())
+				_, err = serv.handlePacket(conn, udpAddr, getFirstPacket(3), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("refuses new connections when too many sessions are waiting to be accepted", func() {
+				var sessions []*mockSession
+				for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+					_, err := serv.handlePacket(conn, udpAddr, getFirstPacket(byte(i)), protocol.ECNNon)
+					Expect(err).ToNot(HaveOccurred())
+					sessions = append(sessions, getSession(serv, append(connID[:7:7], byte(i))).(*mockSession))
+				}
+				_, err := serv.handlePacket(conn, udpAddr, getFirstPacket(0xff), protocol.ECNNon)
+				Expect(err).To(MatchError(ContainSubstring(errConnectionRefused.Error())))
+				// a session that completed the handshake is waiting to be accepted
+				sessions[0].handshakeChan <- nil
+				Consistently(serv.isBusy).Should(BeTrue())
+				sess, err := serv.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).To(Equal(sessions[0]))
+				Expect(serv.isBusy()).To(BeFalse())
+				_, err = serv.handlePacket(conn, udpAddr, getFirstPacket(0xff), protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				// a session that fails the handshake won't be accepted
+				Expect(serv.isBusy()).To(BeTrue())
+				sessions[1].handshakeChan <- errors.New("handshake failed")
+				Eventually(serv.isBusy).Should(BeFalse())
+			})
+		})
+
+		Context("requiring address validation", func() {
+			It("uses AcceptToken, if RequireAddressValidation is not set", func() {
+				var acceptToken bool
+				serv.config.AcceptToken = func(_ net.Addr, token *Token) bool {
+					Expect(token).To(BeNil())
+					return acceptToken
+				}
+				Expect(serv.requireAddressValidation(udpAddr)).To(BeTrue())
+				acceptToken = true
+				Expect(serv.requireAddressValidation(udpAddr)).To(BeFalse())
+			})
+
+			It("uses RequireAddressValidation", func() {
+				var addr net.Addr
+				serv.config.AcceptToken = func(net.Addr, *Token) bool {
+					Fail("AcceptToken should not have been called")
+					return false
+				}
+				serv.config.RequireAddressValidation = func(a net.Addr) bool {
+					addr = a
+					return false
+				}
+				Expect(serv.requireAddressValidation(udpAddr)).To(BeFalse())
+				Expect(addr).To(Equal(udpAddr))
+			})
+
+			It("requires address validation when too many handshakes are in progress", func() {
+				serv.config.RequireAddressValidation = func(net.Addr) bool { return false }
+				var sessions []*mockSession
+				for i := 0; i < protocol.MaxHalfOpenHandshakes; i++ {
+					_, err := serv.handlePacket(conn, udpAddr, getFirstPacket(byte(i)), protocol.ECNNon)
+					Expect(err).ToNot(HaveOccurred())
+					sessions = append(sessions, getSession(serv, append(connID[:7:7], byte(i))).(*mockSession))
+				}
+				Expect(serv.requireAddressValidation(udpAddr)).To(BeTrue())
+				// the handshake of one session completes
+				sessions[0].handshakeChan <- nil
+				Eventually(func() bool { return serv.requireAddressValidation(udpAddr) }).Should(BeFalse())
+				// the handshake of another session fails
+				_, err := serv.handlePacket(conn, udpAddr, firstPacket, protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.requireAddressValidation(udpAddr)).To(BeTrue())
+				sessions[1].handshakeChan <- errors.New("handshake failed")
+				Eventually(func() bool { return serv.requireAddressValidation(udpAddr) }).Should(BeFalse())
+			})
+
+			It("uses AcceptToken to validate tokens", func() {
+				token := &Token{RemoteAddr: "192.168.100.200"}
+				var acceptedToken *Token
+				serv.config.AcceptToken = func(_ net.Addr, t *Token) bool {
+					acceptedToken = t
+					return true
+				}
+				serv.config.RequireAddressValidation = func(net.Addr) bool { return true }
+				Expect(serv.acceptCookie(udpAddr, token)).To(BeTrue())
+				Expect(acceptedToken).To(Equal(token))
+				Expect(serv.acceptCookie(udpAddr, nil)).To(BeFalse())
+			})
+		})
+
+		Context("shutting down", func() {
+			It("tells the sessions that the server is going away, and waits for them to close", func() {
+				go serv.serve()
+				session, _ := newMockSession(nil, 0, connID, nil, nil, nil, nil)
+				serv.sessions.Set(connID, session)
+				done := make(chan error, 1)
+				go func() {
+					defer GinkgoRecover()
+					done <- serv.Shutdown(context.Background())
+				}()
+				Consistently(done).ShouldNot(Receive())
+				Expect(conn.closed).To(BeFalse())
+				// the application closes the session
+				session.Close(nil)
+				Eventually(done).Should(Receive(BeNil()))
+				Expect(session.(*mockSession).wentAway).To(BeTrue())
+				Expect(conn.closed).To(BeTrue())
+			})
+
+			It("closes the sessions when the context expires", func() {
+				go serv.serve()
+				session, _ := newMockSession(nil, 0, connID, nil, nil, nil, nil)
+				serv.sessions.Set(connID, session)
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				Expect(serv.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+				Expect(session.(*mockSession).closed).To(BeTrue())
+				Expect(session.(*mockSession).closeReason).To(Equal(errServerShuttingDown))
+				Expect(conn.closed).To(BeTrue())
+			})
+
+			It("makes Accept return", func() {
+				go serv.serve()
+				errChan := make(chan error, 1)
+				go func() {
+					defer GinkgoRecover()
+					_, err := serv.Accept()
+					errChan <- err
+				}()
+				Consistently(errChan).ShouldNot(Receive())
+				Expect(serv.Shutdown(context.Background())).To(Succeed())
+				Eventually(errChan).Should(Receive(Equal(errServerShuttingDown)))
+			})
+
+			It("closes sessions that complete the handshake after the server started shutting down", func() {
+				_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
+				Expect(err).ToNot(HaveOccurred())
+				session := getSession(serv, connID).(*mockSession)
+				go serv.serve()
+				done := make(chan error, 1)
+				go func() {
+					defer GinkgoRecover()
+					done <- serv.Shutdown(context.Background())
+				}()
+				Consistently(done).ShouldNot(Receive())
+				session.handshakeChan <- nil
+				Eventually(done).Should(Receive(BeNil()))
+				Expect(session.closeReason).To(Equal(errServerShuttingDown))
+			})
+
+			It("rejects new connections", func() {
+				serv.shuttingDown = true
+				_, err := serv.handlePacket(conn, udpAddr, firstPacket, protocol.ECNNon)
+				Expect(err).To(MatchError(fmt.Sprintf("rejecting connection %s: %s", connID, errServerShuttingDown)))
+				Expect(serv.sessions.Len()).To(BeZero())
+				Expect(conn.dataWrittenTo).To(Equal(udpAddr))
+				Expect(conn.dataWritten.Bytes()[0] & 0x02).ToNot(BeZero()) // check that the ResetFlag is set
+			})
+
+			It("does nothing when called multiple times", func() {
+				go serv.serve()
+				Expect(serv.Shutdown(context.Background())).To(Succeed())
+				Expect(serv.Shutdown(context.Background())).To(Succeed())
+			})
+		})
+
+		It("registers sessions for the connection IDs they issued", func() {
+			resetTokenGen, err := handshake.NewResetTokenGenerator([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			serv.resetTokenGenerator = resetTokenGen
+			session, _ := newMockSession(nil, 0, connID, nil, nil, nil, nil)
+			serv.sessions.Set(connID, session)
+			newConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}
+			serv.addConnectionID(newConnID, session)
+			Expect(getSession(serv, newConnID)).To(Equal(session))
+			Expect(serv.getStatelessResetToken(newConnID)).To(Equal(resetTokenGen.GetResetToken(newConnID)))
+			serv.retireConnectionID(newConnID)
+			Expect(getSession(serv, newConnID)).To(BeNil())
+			Expect(getSession(serv, connID)).To(Equal(session))
+		})
+
 		It("ignores packets for closed sessions", func() {
-			serv.sessions[string(connID)] = nil
-			err := serv.handlePacket(nil, nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01})
+			serv.sessions.Set(connID, nil)
+			passedOn, err := serv.handlePacket(nil, nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[string(connID)]).To(BeNil())
+			Expect(passedOn).To(BeFalse())
+			Expect(serv.sessions.Len()).To(Equal(1))
+			Expect(getSession(serv, connID)).To(BeNil())
 		})
 
 		It("works if no quic.Config is given", func(done Done) {
@@ -354,8 +1148,8 @@ var _ = Describe("Server", func() {
 
 		It("closes all sessions when encountering a connection error", func() {
 			session, _ := newMockSession(nil, 0, connID, nil, nil, nil, nil)
-			serv.sessions[string(connID)] = session
-			Expect(serv.sessions[string(connID)].(*mockSession).closed).To(BeFalse())
+			serv.sessions.Set(connID, session)
+			Expect(getSession(serv, connID).(*mockSession).closed).To(BeFalse())
 			testErr := errors.New("connection error")
 			conn.readErr = testErr
 			go serv.serve()
@@ -364,24 +1158,24 @@ var _ = Describe("Server", func() {
 		})
 
 		It("ignores delayed packets with mismatching versions", func() {
-			err := serv.handlePacket(nil, nil, firstPacket)
+			_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets).To(HaveLen(1))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets).To(HaveLen(1))
 			b := &bytes.Buffer{}
 			// add an unsupported version
 			data := []byte{0x09, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6}
 			utils.BigEndian.WriteUint32(b, uint32(protocol.SupportedVersions[0]+1))
 			data = append(append(data, b.Bytes()...), 0x01)
-			err = serv.handlePacket(nil, nil, data)
+			_, err = serv.handlePacket(nil, nil, data, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
 			// if we didn't ignore the packet, the server would try to send a version negotiation packet, which would make the test panic because it doesn't have a udpConn
 			Expect(conn.dataWritten.Bytes()).To(BeEmpty())
 			// make sure the packet was *not* passed to session.handlePacket()
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets).To(HaveLen(1))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets).To(HaveLen(1))
 		})
 
 		It("errors on invalid public header", func() {
-			err := serv.handlePacket(nil, nil, nil)
+			_, err := serv.handlePacket(nil, nil, nil, protocol.ECNNon)
 			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidPacketHeader))
 		})
 
@@ -396,12 +1190,12 @@ var _ = Describe("Server", func() {
 				Version:          versionIETFFrames,
 			}
 			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-			err := serv.handlePacket(nil, nil, append(b.Bytes(), make([]byte, 456)...))
+			_, err := serv.handlePacket(nil, nil, append(b.Bytes(), make([]byte, 456)...), protocol.ECNNon)
 			Expect(err).To(MatchError("packet payload (456 bytes) is smaller than the expected payload length (1000 bytes)"))
 		})
 
 		It("cuts packets at the payload length", func() {
-			err := serv.handlePacket(nil, nil, firstPacket)
+			_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
 			b := &bytes.Buffer{}
 			hdr := &wire.Header{
@@ -413,39 +1207,66 @@ var _ = Describe("Server", func() {
 				Version:          versionIETFFrames,
 			}
 			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-			err = serv.handlePacket(nil, nil, append(b.Bytes(), make([]byte, 456)...))
+			_, err = serv.handlePacket(nil, nil, append(b.Bytes(), make([]byte, 456)...), protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets).To(HaveLen(2))
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets[1].data).To(HaveLen(123))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets).To(HaveLen(2))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets[1].data).To(HaveLen(123))
+		})
+
+		It("handles packets coalesced into a single datagram", func() {
+			_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			b := &bytes.Buffer{}
+			for _, pn := range []protocol.PacketNumber{1, 2} {
+				hdr := &wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					PacketNumber:     pn,
+					PayloadLen:       100,
+					SrcConnectionID:  connID,
+					DestConnectionID: connID,
+					Version:          versionIETFFrames,
+				}
+				Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+				b.Write(make([]byte, 100))
+			}
+			passedOn, err := serv.handlePacket(nil, nil, b.Bytes(), protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(passedOn).To(BeTrue())
+			handledPackets := getSession(serv, connID).(*mockSession).handledPackets
+			Expect(handledPackets).To(HaveLen(3))
+			Expect(handledPackets[1].header.PacketNumber).To(Equal(protocol.PacketNumber(1)))
+			Expect(handledPackets[2].header.PacketNumber).To(Equal(protocol.PacketNumber(2)))
+			Expect(handledPackets[2].data).To(HaveLen(100))
 		})
 
 		It("ignores public resets for unknown connections", func() {
-			err := serv.handlePacket(nil, nil, wire.WritePublicReset([]byte{9, 9, 9, 9, 9, 9, 9, 9}, 1, 1337))
+			_, err := serv.handlePacket(nil, nil, wire.WritePublicReset([]byte{9, 9, 9, 9, 9, 9, 9, 9}, 1, 1337), protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(BeEmpty())
+			Expect(serv.sessions.Len()).To(BeZero())
 		})
 
 		It("ignores public resets for known connections", func() {
-			err := serv.handlePacket(nil, nil, firstPacket)
+			_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets).To(HaveLen(1))
-			err = serv.handlePacket(nil, nil, wire.WritePublicReset(connID, 1, 1337))
+			Expect(serv.sessions.Len()).To(Equal(1))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets).To(HaveLen(1))
+			_, err = serv.handlePacket(nil, nil, wire.WritePublicReset(connID, 1, 1337), protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets).To(HaveLen(1))
+			Expect(serv.sessions.Len()).To(Equal(1))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets).To(HaveLen(1))
 		})
 
 		It("ignores invalid public resets for known connections", func() {
-			err := serv.handlePacket(nil, nil, firstPacket)
+			_, err := serv.handlePacket(nil, nil, firstPacket, protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets).To(HaveLen(1))
+			Expect(serv.sessions.Len()).To(Equal(1))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets).To(HaveLen(1))
 			data := wire.WritePublicReset(connID, 1, 1337)
-			err = serv.handlePacket(nil, nil, data[:len(data)-2])
+			_, err = serv.handlePacket(nil, nil, data[:len(data)-2], protocol.ECNNon)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(serv.sessions).To(HaveLen(1))
-			Expect(serv.sessions[string(connID)].(*mockSession).handledPackets).To(HaveLen(1))
+			Expect(serv.sessions.Len()).To(Equal(1))
+			Expect(getSession(serv, connID).(*mockSession).handledPackets).To(HaveLen(1))
 		})
 
 		It("doesn't try to process a packet after sending a gQUIC Version Negotiation Packet", func() {
@@ -460,11 +1281,30 @@ var _ = Describe("Server", func() {
 			}
 			hdr.Write(b, protocol.PerspectiveClient, 13 /* not a valid QUIC version */)
 			b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize)) // add a fake CHLO
-			err := serv.handlePacket(conn, nil, b.Bytes())
+			_, err := serv.handlePacket(conn, nil, b.Bytes(), protocol.ECNNon)
 			Expect(conn.dataWritten.Bytes()).ToNot(BeEmpty())
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("traces sent gQUIC Version Negotiation Packets", func() {
+			tracer := &recordingTracer{}
+			serv.config.Tracer = tracer
+			config.Versions = []protocol.VersionNumber{99}
+			b := &bytes.Buffer{}
+			hdr := wire.Header{
+				VersionFlag:      true,
+				DestConnectionID: connID,
+				SrcConnectionID:  connID,
+				PacketNumber:     1,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+			}
+			hdr.Write(b, protocol.PerspectiveClient, 13 /* not a valid QUIC version */)
+			b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize)) // add a fake CHLO
+			_, err := serv.handlePacket(conn, nil, b.Bytes(), protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tracer.vnSent).To(Equal([]ConnectionID{connID}))
+		})
+
 		It("doesn't respond with a version negotiation packet if the first packet is too small", func() {
 			b := &bytes.Buffer{}
 			hdr := wire.Header{
@@ -476,7 +1316,7 @@ var _ = Describe("Server", func() {
 			}
 			hdr.Write(b, protocol.PerspectiveClient, 13 /* not a valid QUIC version */)
 			b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize-1)) // this packet is 1 byte too small
-			err := serv.handlePacket(conn, udpAddr, b.Bytes())
+			_, err := serv.handlePacket(conn, udpAddr, b.Bytes(), protocol.ECNNon)
 			Expect(err).To(MatchError("dropping small packet with unknown version"))
 			Expect(conn.dataWritten.Len()).Should(BeZero())
 		})
@@ -484,13 +1324,36 @@ var _ = Describe("Server", func() {
 
 	It("setups with the right values", func() {
 		supportedVersions := []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}
-		acceptCookie := func(_ net.Addr, _ *Cookie) bool { return true }
+		acceptToken := func(_ net.Addr, _ *Token) bool { return true }
+		getLogWriter := func([]byte) io.WriteCloser { return nil }
 		config := Config{
-			Versions:         supportedVersions,
-			AcceptCookie:     acceptCookie,
-			HandshakeTimeout: 1337 * time.Hour,
-			IdleTimeout:      42 * time.Minute,
-			KeepAlive:        true,
+			Versions:                       supportedVersions,
+			AcceptToken:                    acceptToken,
+			HandshakeTimeout:               1337 * time.Hour,
+			IdleTimeout:                    42 * time.Minute,
+			MaxHandshakePackets:            1234,
+			ConnectionIDLength:             13,
+			ManualFlowControlCreditRelease: true,
+			MaxUndecryptablePackets:        42,
+			UndecryptablePacketTimeout:     1337 * time.Millisecond,
+			KeepAlive:                      true,
+			KeepAlivePeriod:                5 * time.Second,
+			StreamScheduler:                StreamSchedulerFIFO,
+			CongestionControl:              CongestionBBR,
+			EnableDatagrams:                true,
+			DisableECN:                     true,
+			MaxPacketSize:                  1300,
+			DisablePathMTUDiscovery:        true,
+			KeyUpdateInterval:              1000,
+			TLSStack:                       TLSStackStandardLibrary,
+			GetLogWriter:                   getLogWriter,
+			Tracer:                         &recordingTracer{},
+			Logger:                         &recordingLogger{},
+			InitialPacingRate:              1 << 20,
+			MaxPacingBurst:                 5,
+			MaxAckDelay:                    50 * time.Millisecond,
+			PacketsPerAck:                  4,
+			ImmediateAckOnReordering:       true,
 		}
 		ln, err := Listen(conn, &tls.Config{}, &config)
 		Expect(err).ToNot(HaveOccurred())
@@ -501,8 +1364,30 @@ var _ = Describe("Server", func() {
 		Expect(server.config.Versions).To(Equal(supportedVersions))
 		Expect(server.config.HandshakeTimeout).To(Equal(1337 * time.Hour))
 		Expect(server.config.IdleTimeout).To(Equal(42 * time.Minute))
-		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(acceptCookie)))
+		Expect(server.config.MaxHandshakePackets).To(Equal(1234))
+		Expect(server.config.ConnectionIDLength).To(Equal(13))
+		Expect(reflect.ValueOf(server.config.AcceptToken)).To(Equal(reflect.ValueOf(acceptToken)))
+		Expect(server.config.ManualFlowControlCreditRelease).To(BeTrue())
+		Expect(server.config.MaxUndecryptablePackets).To(Equal(42))
+		Expect(server.config.UndecryptablePacketTimeout).To(Equal(1337 * time.Millisecond))
 		Expect(server.config.KeepAlive).To(BeTrue())
+		Expect(server.config.KeepAlivePeriod).To(Equal(5 * time.Second))
+		Expect(server.config.StreamScheduler).To(Equal(StreamSchedulerFIFO))
+		Expect(server.config.CongestionControl).To(Equal(CongestionBBR))
+		Expect(server.config.EnableDatagrams).To(BeTrue())
+		Expect(server.config.DisableECN).To(BeTrue())
+		Expect(server.config.MaxPacketSize).To(Equal(uint64(1300)))
+		Expect(server.config.DisablePathMTUDiscovery).To(BeTrue())
+		Expect(server.config.KeyUpdateInterval).To(Equal(uint64(1000)))
+		Expect(server.config.TLSStack).To(Equal(TLSStackStandardLibrary))
+		Expect(reflect.ValueOf(server.config.GetLogWriter)).To(Equal(reflect.ValueOf(getLogWriter)))
+		Expect(server.config.Tracer).To(Equal(config.Tracer))
+		Expect(server.config.Logger).To(Equal(config.Logger))
+		Expect(server.config.InitialPacingRate).To(Equal(uint64(1 << 20)))
+		Expect(server.config.MaxPacingBurst).To(Equal(5))
+		Expect(server.config.MaxAckDelay).To(Equal(50 * time.Millisecond))
+		Expect(server.config.PacketsPerAck).To(Equal(4))
+		Expect(server.config.ImmediateAckOnReordering).To(BeTrue())
 	})
 
 	It("errors when the Config contains an invalid version", func() {
@@ -511,6 +1396,26 @@ var _ = Describe("Server", func() {
 		Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 	})
 
+	It("errors when the Config contains an invalid connection ID length", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{ConnectionIDLength: 19})
+		Expect(err).To(MatchError("invalid connection ID length: 19 bytes (must be between 4 and 18 bytes)"))
+	})
+
+	It("errors when the Config contains an invalid stream scheduler", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{StreamScheduler: 42})
+		Expect(err).To(MatchError("invalid stream scheduler: 42"))
+	})
+
+	It("errors when the Config contains an invalid congestion control algorithm", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{CongestionControl: 42})
+		Expect(err).To(MatchError("invalid congestion control algorithm: 42"))
+	})
+
+	It("errors when the Config contains an invalid TLS stack", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{TLSStack: 42})
+		Expect(err).To(MatchError("invalid TLS stack: 42"))
+	})
+
 	It("fills in default values if options are not set in the Config", func() {
 		ln, err := Listen(conn, &tls.Config{}, &Config{})
 		Expect(err).ToNot(HaveOccurred())
@@ -518,8 +1423,31 @@ var _ = Describe("Server", func() {
 		Expect(server.config.Versions).To(Equal(protocol.SupportedVersions))
 		Expect(server.config.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 		Expect(server.config.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
-		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(defaultAcceptCookie)))
+		Expect(server.config.MaxHandshakePackets).To(Equal(protocol.DefaultMaxHandshakePackets))
+		Expect(server.config.ConnectionIDLength).To(Equal(protocol.DefaultConnectionIDLength))
+		Expect(reflect.ValueOf(server.config.AcceptToken)).To(Equal(reflect.ValueOf(defaultAcceptToken)))
+		Expect(server.config.MaxUndecryptablePackets).To(Equal(protocol.MaxUndecryptablePackets))
+		Expect(server.config.UndecryptablePacketTimeout).To(Equal(protocol.DefaultUndecryptablePacketTimeout))
 		Expect(server.config.KeepAlive).To(BeFalse())
+		Expect(server.config.MaxPacketSize).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+		Expect(server.config.KeyUpdateInterval).To(BeEquivalentTo(protocol.DefaultKeyUpdateInterval))
+		Expect(server.config.TLSStack).To(Equal(TLSStackMint))
+		Expect(server.config.ConnectionIDGenerator).To(Equal(&randomConnIDGenerator{connIDLen: protocol.DefaultConnectionIDLength}))
+		Expect(server.config.MaxAckDelay).To(Equal(protocol.DefaultMaxAckDelay))
+	})
+
+	It("uses the connection ID length of the ConnectionIDGenerator", func() {
+		generator := &mockConnIDGenerator{prefix: []byte{1, 2, 3, 4, 5}, connIDLen: 6}
+		ln, err := Listen(conn, &tls.Config{}, &Config{ConnectionIDLength: 13, ConnectionIDGenerator: generator})
+		Expect(err).ToNot(HaveOccurred())
+		server := ln.(*server)
+		Expect(server.config.ConnectionIDLength).To(Equal(6))
+		Expect(server.config.ConnectionIDGenerator).To(Equal(generator))
+	})
+
+	It("doesn't allow zero-length connection IDs", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{ConnectionIDGenerator: &randomConnIDGenerator{}})
+		Expect(err).To(MatchError("invalid connection ID length: 0 bytes (must be between 4 and 18 bytes)"))
 	})
 
 	It("listens on a given address", func() {
@@ -569,7 +1497,7 @@ var _ = Describe("Server", func() {
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		packet, err := wire.ParseHeaderSentByServer(r, protocol.VersionUnknown)
+		packet, err := wire.ParseHeaderSentByServer(r, protocol.VersionUnknown, 8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.VersionFlag).To(BeTrue())
 		Expect(packet.DestConnectionID).To(Equal(connID))
@@ -581,6 +1509,33 @@ var _ = Describe("Server", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("lists the versions in the order of preference in gQUIC Version Negotiation Packets", func() {
+		config.Versions = []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}
+		connID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+		b := &bytes.Buffer{}
+		hdr := wire.Header{
+			VersionFlag:      true,
+			DestConnectionID: connID,
+			SrcConnectionID:  connID,
+			PacketNumber:     1,
+			PacketNumberLen:  protocol.PacketNumberLen2,
+		}
+		hdr.Write(b, protocol.PerspectiveClient, 13 /* not a valid QUIC version */)
+		b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize)) // add a fake CHLO
+		conn.dataToRead <- b.Bytes()
+		conn.dataReadFrom = udpAddr
+		ln, err := Listen(conn, nil, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go ln.Accept()
+
+		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
+		packet, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.VersionUnknown, 8)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packet.IsVersionNegotiation).To(BeTrue())
+		Expect(packet.SupportedVersions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}))
+	})
+
 	It("sends an IETF draft style Version Negotaion Packet, if the client sent a IETF draft style header", func() {
 		connID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
 		config.Versions = append(config.Versions, protocol.VersionTLS)
@@ -612,7 +1567,7 @@ var _ = Describe("Server", func() {
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		packet, err := wire.ParseHeaderSentByServer(r, protocol.VersionUnknown)
+		packet, err := wire.ParseHeaderSentByServer(r, protocol.VersionUnknown, 8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.IsVersionNegotiation).To(BeTrue())
 		Expect(packet.DestConnectionID).To(Equal(connID))
@@ -646,6 +1601,21 @@ var _ = Describe("Server", func() {
 		Consistently(func() int { return conn.dataWritten.Len() }).Should(BeZero())
 	})
 
+	It("creates an early listener", func() {
+		ln, err := ListenEarly(conn, nil, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		Expect(ln.(*earlyServer).acceptEarlySessions).To(BeTrue())
+		Expect(ln.Addr()).To(Equal(conn.addr))
+	})
+
+	It("doesn't accept early sessions on a regular listener", func() {
+		ln, err := Listen(conn, nil, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		Expect(ln.(*server).acceptEarlySessions).To(BeFalse())
+	})
+
 	It("sends a PublicReset for new connections that don't have the VersionFlag set", func() {
 		conn.dataReadFrom = udpAddr
 		conn.dataToRead <- []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}
@@ -660,58 +1630,89 @@ var _ = Describe("Server", func() {
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		Expect(conn.dataWritten.Bytes()[0] & 0x02).ToNot(BeZero()) // check that the ResetFlag is set
-		Expect(ln.(*server).sessions).To(BeEmpty())
+		Expect(ln.(*server).sessions.Len()).To(BeZero())
 	})
 })
 
 var _ = Describe("default source address verification", func() {
 	It("accepts a token", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
-		cookie := &Cookie{
+		cookie := &Token{
 			RemoteAddr: "192.168.0.1",
-			SentTime:   time.Now().Add(-protocol.CookieExpiryTime).Add(time.Second), // will expire in 1 second
+			SentTime:   time.Now().Add(-protocol.TokenValidity).Add(time.Second), // will expire in 1 second
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeTrue())
+		Expect(defaultAcceptToken(remoteAddr, cookie)).To(BeTrue())
 	})
 
 	It("requests verification if no token is provided", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
-		Expect(defaultAcceptCookie(remoteAddr, nil)).To(BeFalse())
+		Expect(defaultAcceptToken(remoteAddr, nil)).To(BeFalse())
 	})
 
 	It("rejects a token if the address doesn't match", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
-		cookie := &Cookie{
+		cookie := &Token{
 			RemoteAddr: "127.0.0.1",
 			SentTime:   time.Now(),
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeFalse())
+		Expect(defaultAcceptToken(remoteAddr, cookie)).To(BeFalse())
 	})
 
 	It("accepts a token for a remote address is not a UDP address", func() {
 		remoteAddr := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
-		cookie := &Cookie{
+		cookie := &Token{
 			RemoteAddr: "192.168.0.1:1337",
 			SentTime:   time.Now(),
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeTrue())
+		Expect(defaultAcceptToken(remoteAddr, cookie)).To(BeTrue())
 	})
 
 	It("rejects an invalid token for a remote address is not a UDP address", func() {
 		remoteAddr := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
-		cookie := &Cookie{
+		cookie := &Token{
 			RemoteAddr: "192.168.0.1:7331", // mismatching port
 			SentTime:   time.Now(),
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeFalse())
+		Expect(defaultAcceptToken(remoteAddr, cookie)).To(BeFalse())
 	})
 
 	It("rejects an expired token", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
-		cookie := &Cookie{
+		cookie := &Token{
 			RemoteAddr: "192.168.0.1",
-			SentTime:   time.Now().Add(-protocol.CookieExpiryTime).Add(-time.Second), // expired 1 second ago
+			SentTime:   time.Now().Add(-protocol.TokenValidity).Add(-time.Second), // expired 1 second ago
+		}
+		Expect(defaultAcceptToken(remoteAddr, cookie)).To(BeFalse())
+	})
+
+	It("expires a token exactly at the expiry time, using the time source", func() {
+		issueTime := time.Unix(1500000000, 0)
+		var now time.Time
+		tokenGen, err := handshake.NewTokenGenerator(func() time.Time { return now })
+		Expect(err).ToNot(HaveOccurred())
+		acceptToken := newDefaultAcceptToken(func() time.Time { return now })
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+		now = issueTime
+		token, err := tokenGen.NewToken(remoteAddr)
+		Expect(err).ToNot(HaveOccurred())
+		cookie, err := tokenGen.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cookie.SentTime).To(Equal(issueTime))
+		now = issueTime.Add(protocol.TokenValidity)
+		Expect(acceptToken(remoteAddr, cookie)).To(BeTrue())
+		now = issueTime.Add(protocol.TokenValidity).Add(time.Nanosecond)
+		Expect(acceptToken(remoteAddr, cookie)).To(BeFalse())
+	})
+
+	It("only accepts retry tokens for a short time", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+		token := &Token{
+			IsRetryToken: true,
+			RemoteAddr:   "192.168.0.1",
+			SentTime:     time.Now().Add(-protocol.RetryTokenValidity).Add(time.Second), // will expire in 1 second
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeFalse())
+		Expect(defaultAcceptToken(remoteAddr, token)).To(BeTrue())
+		token.SentTime = time.Now().Add(-protocol.RetryTokenValidity).Add(-time.Second) // expired 1 second ago
+		Expect(defaultAcceptToken(remoteAddr, token)).To(BeFalse())
 	})
 })
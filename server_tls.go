@@ -25,7 +25,7 @@ func (n *nullAEAD) OpenHandshake(dst, src []byte, packetNumber protocol.PacketNu
 	return n.aead.Open(dst, src, packetNumber, associatedData)
 }
 
-func (n *nullAEAD) Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error) {
+func (n *nullAEAD) Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, keyPhase int, associatedData []byte) ([]byte, error) {
 	return nil, errors.New("no 1-RTT keys")
 }
 
@@ -35,12 +35,24 @@ type tlsSession struct {
 }
 
 type serverTLS struct {
-	conn              net.PacketConn
-	config            *Config
-	supportedVersions []protocol.VersionNumber
-	mintConf          *mint.Config
-	params            *handshake.TransportParameters
-	newMintConn       func(*handshake.CryptoStreamConn, protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error)
+	conn                net.PacketConn
+	config              *Config
+	supportedVersions   []protocol.VersionNumber
+	tlsConf             *tls.Config
+	mintConf            *mint.Config
+	params              *handshake.TransportParameters
+	tokenGenerator      *handshake.TokenGenerator
+	resetTokenGenerator *handshake.ResetTokenGenerator
+	connIDRunner        connIDRunner
+	// isShuttingDown is used to reject new connections once the server is shut down
+	isShuttingDown func() bool
+	// isBusy is used to refuse new connections when the server is overloaded
+	isBusy func() bool
+	// requireAddressValidation says if a client that didn't present a valid token is required to perform a Retry.
+	// If not set, a Retry is required if the Config.AcceptToken returns false for a nil token.
+	requireAddressValidation func(net.Addr) bool
+
+	newMintConn func(bc *handshake.CryptoStreamConn, v protocol.VersionNumber, connID protocol.ConnectionID, addrValidated bool, tlsConf *tls.Config, config *Config) (handshake.MintTLS, <-chan handshake.TransportParameters, error)
 
 	sessionChan chan<- tlsSession
 
@@ -51,41 +63,65 @@ func newServerTLS(
 	conn net.PacketConn,
 	config *Config,
 	cookieHandler *handshake.CookieHandler,
+	tokenGenerator *handshake.TokenGenerator,
+	resetTokenGenerator *handshake.ResetTokenGenerator,
+	connIDRunner connIDRunner,
 	tlsConf *tls.Config,
 	logger utils.Logger,
 ) (*serverTLS, <-chan tlsSession, error) {
-	mconf, err := tlsToMintConfig(tlsConf, protocol.PerspectiveServer)
-	if err != nil {
-		return nil, nil, err
-	}
-	mconf.RequireCookie = true
-	cs, err := mint.NewDefaultCookieProtector()
-	if err != nil {
-		return nil, nil, err
+	var mconf *mint.Config
+	if config.TLSStack != TLSStackStandardLibrary {
+		var err error
+		mconf, err = tlsToMintConfig(tlsConf, protocol.PerspectiveServer)
+		if err != nil {
+			return nil, nil, err
+		}
+		mconf.RequireCookie = true
+		if config.TicketKeys != nil {
+			mconf.CookieProtector = config.TicketKeys.cookies
+		} else {
+			cs, err := mint.NewDefaultCookieProtector()
+			if err != nil {
+				return nil, nil, err
+			}
+			mconf.CookieProtector = cs
+		}
+		mconf.CookieHandler = cookieHandler
 	}
-	mconf.CookieProtector = cs
-	mconf.CookieHandler = cookieHandler
 
 	sessionChan := make(chan tlsSession)
 	s := &serverTLS{
-		conn:              conn,
-		config:            config,
-		supportedVersions: config.Versions,
-		mintConf:          mconf,
-		sessionChan:       sessionChan,
-		params: &handshake.TransportParameters{
-			StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-			ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
-			IdleTimeout:                 config.IdleTimeout,
-			MaxBidiStreams:              uint16(config.MaxIncomingStreams),
-			MaxUniStreams:               uint16(config.MaxIncomingUniStreams),
-		},
-		logger: logger,
+		conn:                conn,
+		config:              config,
+		supportedVersions:   config.Versions,
+		tlsConf:             tlsConf,
+		mintConf:            mconf,
+		tokenGenerator:      tokenGenerator,
+		resetTokenGenerator: resetTokenGenerator,
+		connIDRunner:        connIDRunner,
+		sessionChan:         sessionChan,
+		params:              newServerTransportParameters(config),
+		logger:              logger,
 	}
 	s.newMintConn = s.newMintConnImpl
 	return s, sessionChan, nil
 }
 
+func newServerTransportParameters(config *Config) *handshake.TransportParameters {
+	params := &handshake.TransportParameters{
+		StreamFlowControlWindow:     protocol.ByteCount(config.InitialStreamReceiveWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(config.InitialConnectionReceiveWindow),
+		IdleTimeout:                 config.IdleTimeout,
+		MaxBidiStreams:              uint16(config.MaxIncomingStreams),
+		MaxUniStreams:               uint16(config.MaxIncomingUniStreams),
+		MaxAckDelay:                 config.MaxAckDelay,
+	}
+	if config.EnableDatagrams {
+		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+	}
+	return params
+}
+
 func (s *serverTLS) HandleInitial(remoteAddr net.Addr, hdr *wire.Header, data []byte) {
 	// TODO: add a check that DestConnID == SrcConnID
 	s.logger.Debugf("Received a Packet. Handling it statelessly.")
@@ -104,11 +140,40 @@ func (s *serverTLS) HandleInitial(remoteAddr net.Addr, hdr *wire.Header, data []
 }
 
 // will be set to s.newMintConn by the constructor
-func (s *serverTLS) newMintConnImpl(bc *handshake.CryptoStreamConn, v protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
-	extHandler := handshake.NewExtensionHandlerServer(s.params, s.config.Versions, v, s.logger)
-	conf := s.mintConf.Clone()
+func (s *serverTLS) newMintConnImpl(bc *handshake.CryptoStreamConn, v protocol.VersionNumber, connID protocol.ConnectionID, addrValidated bool, tlsConf *tls.Config, config *Config) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
+	params := *s.params
+	if config != s.config {
+		params = *newServerTransportParameters(config)
+	}
+	token := s.resetTokenGenerator.GetResetToken(connID)
+	params.StatelessResetToken = &token
+	extHandler := handshake.NewExtensionHandlerServer(&params, s.config.Versions, v, s.logger)
+	if s.config.TLSStack == TLSStackStandardLibrary {
+		if s.config.TicketKeys != nil {
+			tlsConf = s.config.TicketKeys.configureTLS(tlsConf)
+		}
+		return newStdlibTLSController(bc, tlsConf, extHandler, protocol.PerspectiveServer, s.logger), extHandler.GetPeerParams(), nil
+	}
+	var conf *mint.Config
+	if tlsConf == s.tlsConf {
+		conf = s.mintConf.Clone()
+	} else {
+		var err error
+		conf, err = tlsToMintConfig(tlsConf, protocol.PerspectiveServer)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the cookies must be accepted by all sessions of the server
+		conf.RequireCookie = s.mintConf.RequireCookie
+		conf.CookieProtector = s.mintConf.CookieProtector
+		conf.CookieHandler = s.mintConf.CookieHandler
+	}
 	conf.ExtensionHandler = extHandler
-	return newMintController(bc, conf, protocol.PerspectiveServer), extHandler.GetPeerParams(), nil
+	// the client presented a valid token, so there's no need to perform a Stateless Retry
+	if addrValidated {
+		conf.RequireCookie = false
+	}
+	return newMintController(bc, conf, tlsConf, protocol.PerspectiveServer), extHandler.GetPeerParams(), nil
 }
 
 func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Header, aead crypto.AEAD, closeErr error) error {
@@ -116,11 +181,16 @@ func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Hea
 		ErrorCode:    qerr.HandshakeFailed,
 		ReasonPhrase: closeErr.Error(),
 	}
+	if qErr, ok := closeErr.(*qerr.QuicError); ok {
+		ccf.ErrorCode = qErr.ErrorCode
+		ccf.ReasonPhrase = qErr.ErrorMessage
+	}
 	replyHdr := &wire.Header{
 		IsLongHeader:     true,
 		Type:             protocol.PacketTypeHandshake,
 		SrcConnectionID:  clientHdr.DestConnectionID,
 		DestConnectionID: clientHdr.SrcConnectionID,
+		PayloadLen:       ccf.Length(clientHdr.Version) + protocol.ByteCount(aead.Overhead()),
 		PacketNumber:     1, // random packet number
 		Version:          clientHdr.Version,
 	}
@@ -143,10 +213,19 @@ func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, hdr *wire.Header, dat
 		if err != nil {
 			return nil, err
 		}
+		if s.config.Tracer != nil {
+			s.config.Tracer.SentVersionNegotiation(hdr.DestConnectionID)
+		}
 		_, err = s.conn.WriteTo(vnp, remoteAddr)
 		return nil, err
 	}
 
+	// The client's Destination Connection ID is used as the connection ID for this session.
+	// Since the length is not encoded in the Short Header, it must match the configured length.
+	if hdr.DestConnectionID.Len() != s.config.ConnectionIDLength {
+		return nil, fmt.Errorf("dropping Initial packet with a %d byte destination connection ID (expected %d bytes)", hdr.DestConnectionID.Len(), s.config.ConnectionIDLength)
+	}
+
 	// unpack packet and check stream frame contents
 	aead, err := crypto.NewNullAEAD(protocol.PerspectiveServer, hdr.DestConnectionID, protocol.VersionTLS)
 	if err != nil {
@@ -167,11 +246,81 @@ func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, hdr *wire.Header, dat
 	return sess, nil
 }
 
+// validateToken checks the token sent in the header of the client's Initial packet.
+// Only tokens issued in a NEW_TOKEN frame are accepted here.
+// Retry tokens are carried in the TLS cookie extension and validated by the CookieHandler.
+func (s *serverTLS) validateToken(remoteAddr net.Addr, data []byte) bool {
+	if len(data) == 0 || len(data) > protocol.MaxTokenLen {
+		return false
+	}
+	token, err := s.tokenGenerator.DecodeToken(data)
+	if err != nil {
+		s.logger.Debugf("Error decoding token: %s", err)
+		return false
+	}
+	if token.IsRetryToken {
+		return false
+	}
+	return s.config.AcceptToken(remoteAddr, token)
+}
+
+// requiresRetry says if a Stateless Retry would be performed for a client.
+// The Retry is performed by mint, unless the client presents a valid token, or clients without a token are accepted.
+func (s *serverTLS) requiresRetry(remoteAddr net.Addr, token []byte) bool {
+	if s.config.TLSStack == TLSStackStandardLibrary || s.validateToken(remoteAddr, token) {
+		return false
+	}
+	if s.requireAddressValidation != nil {
+		return s.requireAddressValidation(remoteAddr)
+	}
+	return !s.config.AcceptToken(remoteAddr, nil)
+}
+
+// getConfigForClient calls the Config.GetConfigForClient with the information from the ClientHello.
+func (s *serverTLS) getConfigForClient(remoteAddr net.Addr, data []byte) (*tls.Config, *Config, error) {
+	if s.config.GetConfigForClient == nil {
+		return s.tlsConf, s.config, nil
+	}
+	// mint sends the ClientHello in a TLS record, crypto/tls sends the handshake message
+	if s.config.TLSStack != TLSStackStandardLibrary {
+		if len(data) < recordHeaderLen {
+			return nil, nil, errors.New("ClientHello too short")
+		}
+		data = data[recordHeaderLen:]
+	}
+	info, err := parseClientHelloInfo(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	info.RemoteAddr = remoteAddr
+	return getConfigForClient(s.tlsConf, s.config, info)
+}
+
 func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header, frame *wire.StreamFrame, aead crypto.AEAD) (packetHandler, error) {
 	version := hdr.Version
+	if s.isShuttingDown != nil && s.isShuttingDown() {
+		return nil, errServerShuttingDown
+	}
+	if s.isBusy != nil && s.isBusy() {
+		// If the client's address needs to be validated, we'd send a Retry when not overloaded.
+		// Don't spend any resources on such clients, and just drop the packet.
+		if s.requiresRetry(remoteAddr, hdr.Token) {
+			s.logger.Debugf("Server busy. Dropping Initial packet from %s.", remoteAddr)
+			return nil, nil
+		}
+		return nil, errConnectionRefused
+	}
+	tlsConf, config, err := s.getConfigForClient(remoteAddr, frame.Data)
+	if err != nil {
+		return nil, err
+	}
 	bc := handshake.NewCryptoStreamConn(remoteAddr)
 	bc.AddDataForReading(frame.Data)
-	tls, paramsChan, err := s.newMintConn(bc, version)
+	addrValidated := s.validateToken(remoteAddr, hdr.Token)
+	// If a Retry is required, mint only continues the handshake if the client presented a valid cookie.
+	// This validates the client's address as well.
+	retryRequired := !addrValidated && s.requiresRetry(remoteAddr, hdr.Token)
+	tls, paramsChan, err := s.newMintConn(bc, version, hdr.DestConnectionID, addrValidated, tlsConf, config)
 	if err != nil {
 		return nil, err
 	}
@@ -202,11 +351,12 @@ func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header,
 	if alert != mint.AlertNoAlert {
 		return nil, alert
 	}
-	if tls.State() != mint.StateServerNegotiated {
-		return nil, fmt.Errorf("Expected mint state to be %s, got %s", mint.StateServerNegotiated, tls.State())
-	}
-	if alert := tls.Handshake(); alert != mint.AlertNoAlert {
-		return nil, alert
+	// mint sends the server's flight when Handshake is called after negotiating the parameters.
+	// crypto/tls sends it right away.
+	if tls.State() == mint.StateServerNegotiated {
+		if alert := tls.Handshake(); alert != mint.AlertNoAlert {
+			return nil, alert
+		}
 	}
 	if tls.State() != mint.StateServerWaitFlight2 {
 		return nil, fmt.Errorf("Expected mint state to be %s, got %s", mint.StateServerWaitFlight2, tls.State())
@@ -217,11 +367,15 @@ func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header,
 		hdr.SrcConnectionID,
 		hdr.DestConnectionID,     // TODO(#1003): we can use a server-chosen connection ID here
 		protocol.PacketNumber(1), // TODO: use a random packet number here
-		s.config,
+		config,
 		tls,
 		bc,
 		aead,
 		&params,
+		s.tokenGenerator,
+		s.connIDRunner,
+		addrValidated || retryRequired,
+		protocol.ByteCount(len(hdr.Raw))+hdr.PayloadLen,
 		version,
 		s.logger,
 	)
@@ -2,7 +2,11 @@ package quic
 
 import (
 	"bytes"
+	"crypto/tls"
+	"errors"
 	"io"
+	"net"
+	"time"
 
 	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
@@ -27,6 +31,13 @@ var _ = Describe("Stateless TLS handling", func() {
 		mintTLS     *mockhandshake.MockMintTLS
 		extHandler  *mocks.MockTLSExtensionHandler
 		mintReply   io.Writer
+		tokenGen    *handshake.TokenGenerator
+		// connID and addrValidated are the values passed to newMintConn
+		connID        protocol.ConnectionID
+		addrValidated bool
+		// tlsConf and config are the configs passed to newMintConn
+		sessTLSConf *tls.Config
+		sessConf    *Config
 	)
 
 	BeforeEach(func() {
@@ -34,13 +45,27 @@ var _ = Describe("Stateless TLS handling", func() {
 		extHandler = mocks.NewMockTLSExtensionHandler(mockCtrl)
 		conn = newMockPacketConn()
 		config := &Config{
-			Versions: []protocol.VersionNumber{protocol.VersionTLS},
+			Versions:           []protocol.VersionNumber{protocol.VersionTLS},
+			ConnectionIDLength: protocol.DefaultConnectionIDLength,
+			AcceptToken:        defaultAcceptToken,
 		}
 		var err error
-		server, sessionChan, err = newServerTLS(conn, config, nil, testdata.GetTLSConfig(), utils.DefaultLogger)
+		tokenGen, err = handshake.NewTokenGenerator(time.Now)
 		Expect(err).ToNot(HaveOccurred())
-		server.newMintConn = func(bc *handshake.CryptoStreamConn, v protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
+		resetTokenGen, err := handshake.NewResetTokenGenerator(nil)
+		Expect(err).ToNot(HaveOccurred())
+		server, sessionChan, err = newServerTLS(conn, config, nil, tokenGen, resetTokenGen, &mockConnIDRunner{}, testdata.GetTLSConfig(), utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		connID = nil
+		addrValidated = false
+		sessTLSConf = nil
+		sessConf = nil
+		server.newMintConn = func(bc *handshake.CryptoStreamConn, v protocol.VersionNumber, c protocol.ConnectionID, validated bool, tlsConf *tls.Config, config *Config) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
 			mintReply = bc
+			connID = c
+			addrValidated = validated
+			sessTLSConf = tlsConf
+			sessConf = config
 			return mintTLS, extHandler.GetPeerParams(), nil
 		}
 	})
@@ -71,7 +96,7 @@ var _ = Describe("Stateless TLS handling", func() {
 
 	unpackPacket := func(data []byte) (*wire.Header, []byte) {
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		hdr, err := wire.ParseHeaderSentByServer(r, protocol.VersionTLS)
+		hdr, err := wire.ParseHeaderSentByServer(r, protocol.VersionTLS, 8)
 		Expect(err).ToNot(HaveOccurred())
 		hdr.Raw = data[:len(data)-r.Len()]
 		aead, err := crypto.NewNullAEAD(protocol.PerspectiveClient, hdr.SrcConnectionID, protocol.VersionTLS)
@@ -89,7 +114,7 @@ var _ = Describe("Stateless TLS handling", func() {
 		}
 		server.HandleInitial(nil, hdr, bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize))
 		Expect(conn.dataWritten.Len()).ToNot(BeZero())
-		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.VersionUnknown)
+		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.VersionUnknown, 8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.IsVersionNegotiation).To(BeTrue())
 		Expect(sessionChan).ToNot(Receive())
@@ -102,6 +127,14 @@ var _ = Describe("Stateless TLS handling", func() {
 		Expect(conn.dataWritten.Len()).To(BeZero())
 	})
 
+	It("drops packets with a destination connection ID of a different length", func() {
+		server.config.ConnectionIDLength = 5
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		server.HandleInitial(nil, hdr, data)
+		Expect(conn.dataWritten.Len()).To(BeZero())
+		Expect(sessionChan).ToNot(Receive())
+	})
+
 	It("ignores packets with invalid contents", func() {
 		hdr, data := getPacket(&wire.StreamFrame{StreamID: 10, Offset: 11, Data: []byte("foobar")})
 		server.HandleInitial(nil, hdr, data)
@@ -118,7 +151,7 @@ var _ = Describe("Stateless TLS handling", func() {
 		server.HandleInitial(nil, hdr, data)
 		Expect(conn.dataWritten.Len()).ToNot(BeZero())
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		replyHdr, err := wire.ParseHeaderSentByServer(r, protocol.VersionTLS)
+		replyHdr, err := wire.ParseHeaderSentByServer(r, protocol.VersionTLS, 8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
 		Expect(replyHdr.SrcConnectionID).To(Equal(hdr.DestConnectionID))
@@ -127,6 +160,14 @@ var _ = Describe("Stateless TLS handling", func() {
 		Expect(sessionChan).ToNot(Receive())
 	})
 
+	It("uses the destination connection ID to derive the stateless reset token", func() {
+		extHandler.EXPECT().GetPeerParams()
+		mintTLS.EXPECT().Handshake().Return(mint.AlertStatelessRetry)
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		server.HandleInitial(nil, hdr, data)
+		Expect(connID).To(Equal(hdr.DestConnectionID))
+	})
+
 	It("replies with a Handshake packet and creates a session, if no Cookie is required", func() {
 		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert).Do(func() {
 			mintReply.Write([]byte("Server Hello"))
@@ -150,6 +191,189 @@ var _ = Describe("Stateless TLS handling", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	Context("validating tokens", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+
+		var acceptedToken *handshake.Token
+
+		BeforeEach(func() {
+			acceptedToken = nil
+			server.config.AcceptToken = func(_ net.Addr, token *handshake.Token) bool {
+				acceptedToken = token
+				return true
+			}
+			extHandler.EXPECT().GetPeerParams()
+			mintTLS.EXPECT().Handshake().Return(mint.AlertStatelessRetry)
+		})
+
+		It("doesn't require a Retry if the client presents a token from a NEW_TOKEN frame", func() {
+			token, err := tokenGen.NewToken(remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			hdr.Token = token
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(addrValidated).To(BeTrue())
+			Expect(acceptedToken).ToNot(BeNil())
+			Expect(acceptedToken.IsRetryToken).To(BeFalse())
+			Expect(acceptedToken.RemoteAddr).To(Equal("192.168.13.37"))
+		})
+
+		It("requires a Retry if the client doesn't present a token", func() {
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(addrValidated).To(BeFalse())
+			Expect(acceptedToken).To(BeNil())
+		})
+
+		It("requires a Retry if the client presents a retry token", func() {
+			token, err := tokenGen.NewRetryToken(remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			hdr.Token = token
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(addrValidated).To(BeFalse())
+			Expect(acceptedToken).To(BeNil())
+		})
+
+		It("requires a Retry if the token is invalid", func() {
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			hdr.Token = []byte("foobar")
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(addrValidated).To(BeFalse())
+			Expect(acceptedToken).To(BeNil())
+		})
+
+		It("requires a Retry if the token is rejected", func() {
+			server.config.AcceptToken = func(net.Addr, *handshake.Token) bool { return false }
+			token, err := tokenGen.NewToken(remoteAddr)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			hdr.Token = token
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(addrValidated).To(BeFalse())
+		})
+	})
+
+	Context("getting the config for a client", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+
+		// getClientHello returns the TLS record containing a ClientHello generated by mint
+		getClientHello := func(serverName string, nextProtos []string) []byte {
+			conf, err := tlsToMintConfig(&tls.Config{ServerName: serverName}, protocol.PerspectiveClient)
+			Expect(err).ToNot(HaveOccurred())
+			conf.NextProtos = nextProtos
+			csc := handshake.NewCryptoStreamConn(nil)
+			Expect(newMintController(csc, conf, nil, protocol.PerspectiveClient).Handshake()).To(Equal(mint.AlertNoAlert))
+			return csc.GetDataForWriting()
+		}
+
+		It("uses the configs passed to Listen, if no GetConfigForClient is set", func() {
+			extHandler.EXPECT().GetPeerParams()
+			mintTLS.EXPECT().Handshake().Return(mint.AlertStatelessRetry)
+			hdr, data := getPacket(&wire.StreamFrame{Data: getClientHello("quic.clemente.io", nil)})
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(sessTLSConf).To(Equal(server.tlsConf))
+			Expect(sessConf).To(Equal(server.config))
+		})
+
+		It("passes the ClientHelloInfo and uses the configs returned", func() {
+			var info *ClientHelloInfo
+			tlsConf := testdata.GetTLSConfig()
+			server.config.GetConfigForClient = func(i *ClientHelloInfo) (*tls.Config, *Config, error) {
+				info = i
+				return tlsConf, &Config{IdleTimeout: 42 * time.Second, ConnectionIDLength: 5}, nil
+			}
+			extHandler.EXPECT().GetPeerParams()
+			mintTLS.EXPECT().Handshake().Return(mint.AlertStatelessRetry)
+			hdr, data := getPacket(&wire.StreamFrame{Data: getClientHello("quic.clemente.io", []string{"h3", "hq"})})
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(info).ToNot(BeNil())
+			Expect(info.ServerName).To(Equal("quic.clemente.io"))
+			Expect(info.SupportedProtos).To(Equal([]string{"h3", "hq"}))
+			Expect(info.RemoteAddr).To(Equal(remoteAddr))
+			Expect(sessTLSConf).To(Equal(tlsConf))
+			Expect(sessConf.IdleTimeout).To(Equal(42 * time.Second))
+			// the connection ID length applies to all sessions of the server
+			Expect(sessConf.ConnectionIDLength).To(Equal(server.config.ConnectionIDLength))
+			Expect(sessConf.Versions).To(Equal(server.config.Versions))
+		})
+
+		It("uses the configs passed to Listen, if GetConfigForClient returns nil", func() {
+			server.config.GetConfigForClient = func(*ClientHelloInfo) (*tls.Config, *Config, error) {
+				return nil, nil, nil
+			}
+			extHandler.EXPECT().GetPeerParams()
+			mintTLS.EXPECT().Handshake().Return(mint.AlertStatelessRetry)
+			hdr, data := getPacket(&wire.StreamFrame{Data: getClientHello("quic.clemente.io", nil)})
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(sessTLSConf).To(Equal(server.tlsConf))
+			Expect(sessConf).To(Equal(server.config))
+		})
+
+		It("rejects the connection, if GetConfigForClient returns an error", func() {
+			server.config.GetConfigForClient = func(*ClientHelloInfo) (*tls.Config, *Config, error) {
+				return nil, nil, errors.New("unknown host")
+			}
+			hdr, data := getPacket(&wire.StreamFrame{Data: getClientHello("foo.example", nil)})
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(sessConf).To(BeNil())
+			Expect(sessionChan).ToNot(Receive())
+			replyHdr, data := unpackPacket(conn.dataWritten.Bytes())
+			Expect(replyHdr.Type).To(Equal(protocol.PacketTypeHandshake))
+			frame, err := wire.ParseNextFrame(bytes.NewReader(data), nil, protocol.VersionTLS)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&wire.ConnectionCloseFrame{}))
+			Expect(frame.(*wire.ConnectionCloseFrame).ReasonPhrase).To(Equal("unknown host"))
+		})
+
+		It("rejects the connection, if the ClientHello can't be parsed", func() {
+			server.config.GetConfigForClient = func(*ClientHelloInfo) (*tls.Config, *Config, error) {
+				Fail("GetConfigForClient should not have been called")
+				return nil, nil, nil
+			}
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			server.HandleInitial(remoteAddr, hdr, data)
+			Expect(sessConf).To(BeNil())
+			Expect(conn.dataWritten.Len()).ToNot(BeZero())
+		})
+	})
+
+	Context("when the server is busy", func() {
+		BeforeEach(func() {
+			server.isBusy = func() bool { return true }
+		})
+
+		It("refuses the connection", func() {
+			server.config.AcceptToken = func(net.Addr, *handshake.Token) bool { return true }
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			server.HandleInitial(nil, hdr, data)
+			Expect(sessionChan).ToNot(Receive())
+			replyHdr, data := unpackPacket(conn.dataWritten.Bytes())
+			Expect(replyHdr.Type).To(Equal(protocol.PacketTypeHandshake))
+			frame, err := wire.ParseNextFrame(bytes.NewReader(data), nil, protocol.VersionTLS)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&wire.ConnectionCloseFrame{}))
+			Expect(frame.(*wire.ConnectionCloseFrame).ErrorCode).To(Equal(qerr.ConnectionRefused))
+		})
+
+		It("drops the packet, if a Retry would be required", func() {
+			server.config.AcceptToken = func(net.Addr, *handshake.Token) bool { return false }
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			server.HandleInitial(nil, hdr, data)
+			Expect(sessionChan).ToNot(Receive())
+			Expect(conn.dataWritten.Len()).To(BeZero())
+		})
+
+		It("drops the packet, if address validation is required", func() {
+			server.config.AcceptToken = func(net.Addr, *handshake.Token) bool { return true }
+			server.requireAddressValidation = func(net.Addr) bool { return true }
+			hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+			server.HandleInitial(nil, hdr, data)
+			Expect(sessionChan).ToNot(Receive())
+			Expect(conn.dataWritten.Len()).To(BeZero())
+		})
+	})
+
 	It("sends a CONNECTION_CLOSE, if mint returns an error", func() {
 		mintTLS.EXPECT().Handshake().Return(mint.AlertAccessDenied)
 		extHandler.EXPECT().GetPeerParams()
@@ -158,6 +382,10 @@ var _ = Describe("Stateless TLS handling", func() {
 		// the Handshake packet is written by the session
 		Expect(conn.dataWritten.Bytes()).ToNot(BeEmpty())
 		// unpack the packet to check that it actually contains a CONNECTION_CLOSE
+		r := bytes.NewReader(conn.dataWritten.Bytes())
+		parsedHdr, err := wire.ParseHeaderSentByServer(r, protocol.VersionTLS, 8)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsedHdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 		replyHdr, data := unpackPacket(conn.dataWritten.Bytes())
 		Expect(replyHdr.Type).To(Equal(protocol.PacketTypeHandshake))
 		Expect(replyHdr.SrcConnectionID).To(Equal(hdr.DestConnectionID))
@@ -3,11 +3,13 @@ package quic
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
@@ -19,6 +21,7 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 	"github.com/lucas-clemente/quic-go/qerr"
+	"github.com/lucas-clemente/quic-go/qlog"
 )
 
 type unpacker interface {
@@ -35,30 +38,65 @@ type streamManager interface {
 	GetOrOpenReceiveStream(protocol.StreamID) (receiveStreamI, error)
 	OpenStream() (Stream, error)
 	OpenUniStream() (SendStream, error)
-	OpenStreamSync() (Stream, error)
-	OpenUniStreamSync() (SendStream, error)
-	AcceptStream() (Stream, error)
-	AcceptUniStream() (ReceiveStream, error)
+	OpenStreamSync(context.Context) (Stream, error)
+	OpenUniStreamSync(context.Context) (SendStream, error)
+	AcceptStream(context.Context) (Stream, error)
+	AcceptUniStream(context.Context) (ReceiveStream, error)
 	DeleteStream(protocol.StreamID) error
 	UpdateLimits(*handshake.TransportParameters)
-	HandleMaxStreamIDFrame(*wire.MaxStreamIDFrame) error
+	// HandleMaxStreamIDFrame returns true if the frame raised the stream limit
+	HandleMaxStreamIDFrame(*wire.MaxStreamIDFrame) (bool, error)
+	// StreamLimits returns the maximum stream IDs of bidirectional and unidirectional streams that we're allowed to open
+	StreamLimits() (protocol.StreamID, protocol.StreamID)
 	CloseWithError(error)
+	// for continuing the session in another process
+	exportState() (*streamsMapState, error)
+	importState(*streamsMapState) []Stream
 }
 
 type cryptoStreamHandler interface {
 	HandleCryptoStream() error
 	ConnectionState() handshake.ConnectionState
+	GetSealer() (protocol.EncryptionLevel, handshake.Sealer)
 }
 
 type divNonceSetter interface {
 	SetDiversificationNonce([]byte) error
 }
 
+type keyUpdater interface {
+	UpdateKeys() error
+}
+
+type keyingMaterialExporter interface {
+	ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error)
+}
+
+type cryptoStateExporter interface {
+	ExportState() (*handshake.CryptoSetupTLSState, error)
+}
+
+// A sessionTimer is the timer of the run loop.
+// It is a utils.Timer, unless the session runs on an event loop.
+type sessionTimer interface {
+	Chan() <-chan time.Time
+	Reset(time.Time)
+	SetRead()
+}
+
+// A connIDRunner passes packets sent to the connection IDs that an IETF QUIC session issued to that session
+type connIDRunner interface {
+	addConnectionID(protocol.ConnectionID, packetHandler)
+	retireConnectionID(protocol.ConnectionID)
+	getStatelessResetToken(protocol.ConnectionID) protocol.StatelessResetToken
+}
+
 type receivedPacket struct {
 	remoteAddr net.Addr
 	header     *wire.Header
 	data       []byte
 	rcvTime    time.Time
+	ecn        protocol.ECN
 }
 
 var (
@@ -71,6 +109,45 @@ type closeError struct {
 	remote bool
 }
 
+// A pathProbe is a new path that is validated before the session migrates to it.
+// Clients migrate to a new net.PacketConn, servers migrate to a new remote address of the client.
+type pathProbe struct {
+	remoteAddr net.Addr
+	pconn      net.PacketConn // only set for clients
+	conn       connection     // only set for clients
+	data       [8]byte        // the data sent in the PATH_CHALLENGE frames
+	// connID is the connection ID used on the new path, such that the paths can't be linked by an observer.
+	// It is nil if the peer didn't issue any unused connection IDs.
+	connID *newConnID
+
+	numChallenges int       // the number of PATH_CHALLENGE frames sent so far
+	deadline      time.Time // the time when the next PATH_CHALLENGE is sent, or the path validation fails
+
+	result chan error // receives nil when the path was validated
+}
+
+// newPathProbe creates a new pathProbe.
+// pconn is nil when the path is validated by the server.
+func newPathProbe(pconn net.PacketConn, remoteAddr net.Addr) (*pathProbe, error) {
+	p := &pathProbe{
+		remoteAddr: remoteAddr,
+		result:     make(chan error, 1),
+	}
+	if pconn != nil {
+		p.pconn = pconn
+		p.conn = &conn{pconn: pconn, currentAddr: remoteAddr}
+	}
+	if _, err := rand.Read(p.data[:]); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+var (
+	errPathValidationTimeout = errors.New("path validation timed out")
+	errSessionClosed         = errors.New("session closed")
+)
+
 // A Session is a QUIC session
 type session struct {
 	destConnID protocol.ConnectionID
@@ -91,24 +168,104 @@ type session struct {
 	receivedPacketHandler ackhandler.ReceivedPacketHandler
 	streamFramer          *streamFramer
 	windowUpdateQueue     *windowUpdateQueue
-	connFlowController    flowcontrol.ConnectionFlowController
+	datagramQueue         *datagramQueue
+	// mtuDiscoverer is only set after the handshake completes, and if path MTU discovery is enabled
+	mtuDiscoverer      *mtuDiscoverer
+	tracer             qlog.Tracer // nil if neither qlog nor a Tracer is used
+	connFlowController flowcontrol.ConnectionFlowController
 
 	unpacker unpacker
 	packer   *packetPacker
+	// When batchWrites is set, sendPackedPacket queues the packets in packetsToSend.
+	// They are then written to the connection using a single WriteBatch call.
+	batchWrites   bool
+	packetsToSend [][]byte
+	// coalescePackets is set if the last datagram in packetsToSend ends with a packet with a Long Header.
+	// Packets with a Long Header can then be coalesced into the same datagram.
+	coalescePackets bool
+
+	// tokenGenerator is used by IETF QUIC servers to issue tokens in NEW_TOKEN frames
+	tokenGenerator *handshake.TokenGenerator
+	// tokenStoreKey is the key used to save tokens received in NEW_TOKEN frames in the config.TokenStore.
+	// It is only set for IETF QUIC clients.
+	tokenStoreKey string
+
+	// statelessResetToken is the stateless reset token sent by the server.
+	// It is only used by IETF QUIC clients. It is set by the run loop, and read when the client receives a packet.
+	statelessResetTokenMutex sync.Mutex
+	statelessResetToken      *protocol.StatelessResetToken
+
+	// peerTransportParams are the transport parameters sent by the peer, as exposed by ConnectionState.
+	// They are set by the run loop when the transport parameters are processed.
+	peerTransportParamsMutex sync.Mutex
+	peerTransportParams      *handshake.PeerTransportParameters
+
+	// connIDGenerator issues connection IDs to the peer, and connIDManager manages the connection IDs issued by the peer.
+	// They are only set for IETF QUIC.
+	connIDGenerator *connIDGenerator
+	connIDManager   *connIDManager
 
 	cryptoStreamHandler cryptoStreamHandler
 
 	receivedPackets  chan *receivedPacket
 	sendingScheduled chan struct{}
-	// closeChan is used to notify the run loop that it should terminate.
-	closeChan chan closeError
-	closeOnce sync.Once
 
-	ctx       context.Context
-	ctxCancel context.CancelFunc
+	// listen starts reading packets from a connection, and passing them to the session, until the connection is closed.
+	// It is only set for IETF QUIC clients, and used for connection migration.
+	listen func(connection)
+	// probeChan passes new paths from Migrate to the run loop
+	probeChan chan *pathProbe
+	// exportChan passes the requests of ExportState to the run loop
+	exportChan chan *exportRequest
+
+	// goAwayChan is closed by goAway, to tell the run loop that the session is going away.
+	goAwayChan chan struct{}
+	goAwayOnce sync.Once
+	// runLoopGoAwayChan is the goAwayChan, until the run loop handled it.
+	runLoopGoAwayChan <-chan struct{}
+	// After going away, streams opened by the peer are refused.
+	// Only the streams with IDs up to largestPeerStreamIDs (for each stream type) are still used.
+	goingAway            bool
+	largestPeerStreamIDs [4]protocol.StreamID
+	refusedStreams       map[protocol.StreamID]*refusedStream
+	// probe is the path that is currently being validated. It is only accessed by the run loop.
+	probe             *pathProbe
+	sentPathChallenge bool
+	// lastPathValidation is the time when the server last started validating a new address of the client.
+	// It is used to limit the rate of path validations, which could otherwise be triggered by an attacker.
+	lastPathValidation time.Time
+	// probingAddr is the remote address of the packet that is currently being processed,
+	// if it differs from the current remote address. It is only set for servers.
+	probingAddr net.Addr
+
+	statsMutex sync.Mutex
+	stats      SessionStats
+
+	// nextSendTime is the time when the run loop next wants to send a packet.
+	// It is updated every time the timer is reset, and read by NextSendTime.
+	nextSendTimeMutex sync.Mutex
+	nextSendTime      time.Time
+
+	// closeChan is used to notify the run loop that it should terminate.
+	// The error that the session is closed with is saved in closeErr.
+	closeChan     chan struct{}
+	closeMutex    sync.Mutex
+	closeErr      *closeError
+	closeErrFinal bool // set as soon as the run loop picked up the closeErr
+	// runLoopErr is set when the run loop stops, to the error that the session was closed with.
+	runLoopErr *closeError
+	// eventLoopEntry is set to the *eventLoopEntry when the session is handed over to an event loop.
+	eventLoopEntry atomic.Value
+
+	// ctx is cancelled when the run loop terminates.
+	// Before that, the error that the session was closed with is saved in ctxCloseErr.
+	ctx         context.Context
+	ctxCancel   context.CancelFunc
+	ctxCloseErr *sessionCloseError
 
 	// when we receive too many undecryptable packets during the handshake, we send a Public reset
 	// but only after a time of protocol.PublicResetTimeout has passed
+	// undecryptable packets are dropped after config.UndecryptablePacketTimeout
 	undecryptablePackets                   []*receivedPacket
 	receivedTooManyUndecrytablePacketsTime time.Time
 
@@ -122,6 +279,12 @@ type session struct {
 	// It is closed when the handshake is complete.
 	handshakeChan     chan error
 	handshakeComplete bool
+	// handshakeCtx is cancelled when the handshake completes, or when the session is closed before that.
+	handshakeCtx       context.Context
+	handshakeCtxCancel context.CancelFunc
+	// earlySessionReadyChan is closed as soon as we can send data, either using 0-RTT, or after the handshake completed.
+	earlySessionReadyChan chan struct{}
+	earlySessionReady     bool
 
 	receivedFirstPacket              bool // since packet numbers start at 0, we can't use largestRcvdPacketNumber != 0 for this
 	receivedFirstForwardSecurePacket bool
@@ -129,6 +292,8 @@ type session struct {
 	// Used to calculate the next packet number from the truncated wire
 	// representation, and sent back in public reset packets
 	largestRcvdPacketNumber protocol.PacketNumber
+	// the number of packets received before the handshake completed
+	numHandshakePackets int
 
 	sessionCreationTime     time.Time
 	lastNetworkActivityTime time.Time
@@ -137,7 +302,7 @@ type session struct {
 
 	peerParams *handshake.TransportParameters
 
-	timer *utils.Timer
+	timer sessionTimer
 	// keepAlivePingSent stores whether a Ping frame was sent to the peer or not
 	// it is reset as soon as we receive a packet from the peer
 	keepAlivePingSent bool
@@ -145,7 +310,7 @@ type session struct {
 	logger utils.Logger
 }
 
-var _ Session = &session{}
+var _ EarlySession = &session{}
 var _ streamSender = &session{}
 
 // newSession makes a new session
@@ -173,8 +338,8 @@ func newSession(
 	}
 	s.preSetup()
 	transportParams := &handshake.TransportParameters{
-		StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
+		StreamFlowControlWindow:     protocol.ByteCount(s.config.InitialStreamReceiveWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(s.config.InitialConnectionReceiveWindow),
 		MaxStreams:                  uint32(s.config.MaxIncomingStreams),
 		IdleTimeout:                 s.config.IdleTimeout,
 	}
@@ -191,7 +356,7 @@ func newSession(
 		scfg,
 		transportParams,
 		s.config.Versions,
-		s.config.AcceptCookie,
+		s.config.AcceptToken,
 		paramsChan,
 		handshakeEvent,
 		s.logger,
@@ -202,7 +367,7 @@ func newSession(
 	s.cryptoStreamHandler = cs
 	s.unpacker = newPacketUnpackerGQUIC(cs, s.version)
 	s.streamsMap = newStreamsMapLegacy(s.newStream, s.config.MaxIncomingStreams, s.perspective)
-	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, newStreamScheduler(s.config.StreamScheduler, s.config.StreamWeight), s.version)
 	s.packer = newPacketPacker(
 		connectionID,
 		connectionID,
@@ -245,18 +410,23 @@ var newClientSession = func(
 	}
 	s.preSetup()
 	transportParams := &handshake.TransportParameters{
-		StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
+		StreamFlowControlWindow:     protocol.ByteCount(s.config.InitialStreamReceiveWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(s.config.InitialConnectionReceiveWindow),
 		MaxStreams:                  uint32(s.config.MaxIncomingStreams),
 		IdleTimeout:                 s.config.IdleTimeout,
 		OmitConnectionID:            s.config.RequestConnectionIDOmission,
 	}
+	var sessionCache handshake.ClientSessionCache
+	if s.config.ClientSessionCache != nil {
+		sessionCache = newServerSessionCache(s.config.ClientSessionCache, conn.RemoteAddr())
+	}
 	cs, err := newCryptoSetupClient(
 		s.cryptoStream,
 		hostname,
 		connectionID,
 		s.version,
 		tlsConf,
+		sessionCache,
 		transportParams,
 		paramsChan,
 		handshakeEvent,
@@ -270,7 +440,7 @@ var newClientSession = func(
 	s.cryptoStreamHandler = cs
 	s.unpacker = newPacketUnpackerGQUIC(cs, s.version)
 	s.streamsMap = newStreamsMapLegacy(s.newStream, s.config.MaxIncomingStreams, s.perspective)
-	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, newStreamScheduler(s.config.StreamScheduler, s.config.StreamWeight), s.version)
 	s.packer = newPacketPacker(
 		connectionID,
 		connectionID,
@@ -296,6 +466,10 @@ func newTLSServerSession(
 	cryptoStreamConn *handshake.CryptoStreamConn,
 	nullAEAD crypto.AEAD,
 	peerParams *handshake.TransportParameters,
+	tokenGenerator *handshake.TokenGenerator,
+	runner connIDRunner,
+	addrValidated bool,
+	initialPacketSize protocol.ByteCount,
 	v protocol.VersionNumber,
 	logger utils.Logger,
 ) (packetHandler, error) {
@@ -308,19 +482,27 @@ func newTLSServerSession(
 		perspective:    protocol.PerspectiveServer,
 		version:        v,
 		handshakeEvent: handshakeEvent,
+		tokenGenerator: tokenGenerator,
 		logger:         logger,
 	}
 	s.preSetup()
+	// Until the handshake completes, the server can't send more than 3 times the data it received from an unvalidated address.
+	if !addrValidated {
+		s.sentPacketHandler.LimitAmplification()
+	}
+	// the client's Initial packet was handled by the server before the session was created
+	s.sentPacketHandler.ReceivedBytes(initialPacketSize)
 	cs := handshake.NewCryptoSetupTLSServer(
 		tls,
 		cryptoStreamConn,
 		nullAEAD,
 		handshakeEvent,
+		s.config.KeyUpdateInterval,
 		v,
 	)
 	s.cryptoStreamHandler = cs
 	s.streamsMap = newStreamsMap(s, s.newFlowController, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
-	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, newStreamScheduler(s.config.StreamScheduler, s.config.StreamWeight), s.version)
 	s.packer = newPacketPacker(
 		s.destConnID,
 		s.srcConnID,
@@ -336,6 +518,7 @@ func newTLSServerSession(
 	if err := s.postSetup(); err != nil {
 		return nil, err
 	}
+	s.setupConnIDs(runner)
 	s.peerParams = peerParams
 	s.processTransportParameters(peerParams)
 	s.unpacker = newPacketUnpacker(cs, s.version)
@@ -353,6 +536,8 @@ var newTLSClientSession = func(
 	tls handshake.MintTLS,
 	paramsChan <-chan handshake.TransportParameters,
 	initialPacketNumber protocol.PacketNumber,
+	listen func(connection),
+	runner connIDRunner,
 	logger utils.Logger,
 ) (packetHandler, error) {
 	handshakeEvent := make(chan struct{}, 1)
@@ -365,6 +550,7 @@ var newTLSClientSession = func(
 		version:        v,
 		handshakeEvent: handshakeEvent,
 		paramsChan:     paramsChan,
+		listen:         listen,
 		logger:         logger,
 	}
 	s.preSetup()
@@ -375,6 +561,7 @@ var newTLSClientSession = func(
 		hostname,
 		handshakeEvent,
 		tls,
+		s.config.KeyUpdateInterval,
 		v,
 	)
 	if err != nil {
@@ -383,7 +570,7 @@ var newTLSClientSession = func(
 	s.cryptoStreamHandler = cs
 	s.unpacker = newPacketUnpacker(cs, s.version)
 	s.streamsMap = newStreamsMap(s, s.newFlowController, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
-	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, newStreamScheduler(s.config.StreamScheduler, s.config.StreamWeight), s.version)
 	s.packer = newPacketPacker(
 		s.destConnID,
 		s.srcConnID,
@@ -396,42 +583,145 @@ var newTLSClientSession = func(
 		s.perspective,
 		s.version,
 	)
-	return s, s.postSetup()
+	if s.config.TokenStore != nil {
+		s.tokenStoreKey = hostname
+		s.packer.SetToken(s.config.TokenStore.Pop(s.tokenStoreKey))
+	}
+	if err := s.postSetup(); err != nil {
+		return nil, err
+	}
+	s.setupConnIDs(runner)
+	return s, nil
+}
+
+// setupConnIDs sets up issuing connection IDs to the peer, and using the connection IDs issued by the peer
+func (s *session) setupConnIDs(runner connIDRunner) {
+	s.connIDGenerator = newConnIDGenerator(
+		s.srcConnID,
+		s.config.ConnectionIDGenerator,
+		func(c protocol.ConnectionID) { runner.addConnectionID(c, s) },
+		runner.retireConnectionID,
+		runner.getStatelessResetToken,
+		s.queueControlFrame,
+	)
+	s.connIDManager = newConnIDManager(s.destConnID, s.queueControlFrame)
 }
 
 func (s *session) preSetup() {
+	// use the connection ID that both endpoints use to identify the connection after the handshake
+	connID := s.destConnID
+	if s.perspective == protocol.PerspectiveServer {
+		connID = s.srcConnID
+	}
+	s.logger = s.logger.WithFields(utils.Field{Key: utils.FieldConnectionID, Value: connID})
+	var qlogTracer qlog.Tracer
+	if s.config.GetLogWriter != nil {
+		if w := s.config.GetLogWriter(connID); w != nil {
+			qlogTracer = qlog.NewTracer(w, s.perspective, connID)
+		}
+	}
+	s.tracer = newConnectionTracer(qlogTracer, s.config.Tracer, connID)
 	s.rttStats = &congestion.RTTStats{}
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats, s.logger)
+	var onCongestionEvent congestion.EventHandler
+	if s.config.OnCongestionEvent != nil {
+		onCongestionEvent = func(state congestion.State, cwnd protocol.ByteCount) {
+			s.config.OnCongestionEvent(CongestionEvent{State: state, CongestionWindow: uint64(cwnd)})
+		}
+	}
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(
+		s.rttStats,
+		s.newCongestionController(),
+		congestion.NewPacer(congestion.Bandwidth(s.config.InitialPacingRate)*congestion.BytesPerSecond, s.config.MaxPacingBurst),
+		onCongestionEvent,
+		s.tracer,
+		s.logger,
+	)
 	s.connFlowController = flowcontrol.NewConnectionFlowController(
-		protocol.ReceiveConnectionFlowControlWindow,
-		protocol.ByteCount(s.config.MaxReceiveConnectionFlowControlWindow),
+		protocol.ByteCount(s.config.InitialConnectionReceiveWindow),
+		protocol.ByteCount(s.config.MaxConnectionReceiveWindow),
 		s.rttStats,
 		s.logger,
 	)
 	s.cryptoStream = s.newCryptoStream()
 }
 
+// newCongestionController creates the congestion controller selected by the config.
+// It returns nil for the Cubic congestion controller, which is created by the sentPacketHandler.
+func (s *session) newCongestionController() congestion.Controller {
+	if s.config.CongestionControllerFactory != nil {
+		return s.config.CongestionControllerFactory(s.rttStats)
+	}
+	if s.config.CongestionControl == CongestionBBR {
+		return congestion.NewBBRSender(
+			congestion.DefaultClock{},
+			s.rttStats,
+			protocol.InitialCongestionWindow,
+			protocol.DefaultMaxCongestionWindow,
+		)
+	}
+	return nil
+}
+
 func (s *session) postSetup() error {
 	s.handshakeChan = make(chan error, 1)
+	s.handshakeCtx, s.handshakeCtxCancel = context.WithCancel(context.Background())
+	s.earlySessionReadyChan = make(chan struct{})
 	s.receivedPackets = make(chan *receivedPacket, protocol.MaxSessionUnprocessedPackets)
-	s.closeChan = make(chan closeError, 1)
+	s.closeChan = make(chan struct{}, 1)
 	s.sendingScheduled = make(chan struct{}, 1)
-	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
-	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	s.probeChan = make(chan *pathProbe)
+	s.exportChan = make(chan *exportRequest, 1)
+	s.goAwayChan = make(chan struct{})
+	s.undecryptablePackets = make([]*receivedPacket, 0, s.config.MaxUndecryptablePackets)
+	var baseCtx context.Context
+	if s.config.SessionContext != nil {
+		baseCtx = s.config.SessionContext(s.conn.RemoteAddr())
+	}
+	s.ctx, s.ctxCancel, s.ctxCloseErr = newSessionContext(baseCtx)
 
 	s.timer = utils.NewTimer()
 	now := time.Now()
 	s.lastNetworkActivityTime = now
 	s.sessionCreationTime = now
 
-	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.version)
+	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(
+		s.rttStats,
+		&ackhandler.AckPolicy{
+			MaxAckDelay:              s.config.MaxAckDelay,
+			PacketsPerAck:            s.config.PacketsPerAck,
+			ImmediateAckOnReordering: s.config.ImmediateAckOnReordering,
+		},
+		s.version,
+	)
+	s.packer.SetMaxPacketSize(protocol.ByteCount(s.config.MaxPacketSize))
+	// gQUIC ACK frames can't carry ECN counts, so we wouldn't learn about CE marks
+	if s.version.UsesIETFFrameFormat() && !s.config.DisableECN {
+		s.conn.SetECN(protocol.ECT0)
+	}
 	s.windowUpdateQueue = newWindowUpdateQueue(s.streamsMap, s.cryptoStream, s.packer.QueueControlFrame)
+	s.datagramQueue = newDatagramQueue(s.scheduleSending, s.version, s.logger)
+	if s.config.EnableDatagrams {
+		s.packer.SetDatagramQueue(s.datagramQueue)
+	}
+	s.stats.NextPacketNumber = uint64(s.packer.packetNumberGenerator.Peek())
 	return nil
 }
 
 // run the session main loop
 func (s *session) run() error {
-	defer s.ctxCancel()
+	s.startRunLoop()
+	for s.runLoopErr == nil {
+		s.runOnce(true)
+	}
+	return s.finishRunLoop()
+}
+
+// startRunLoop is called before the run loop handles the first event.
+func (s *session) startRunLoop() {
+	// The connection is only traced once the session runs, so that every traced connection is also traced as closed.
+	if s.tracer != nil {
+		s.tracer.StartedConnection(time.Now(), s.conn.LocalAddr(), s.conn.RemoteAddr(), s.version, s.srcConnID, s.destConnID)
+	}
 
 	go func() {
 		if err := s.cryptoStreamHandler.HandleCryptoStream(); err != nil {
@@ -439,28 +729,34 @@ func (s *session) run() error {
 		}
 	}()
 
-	var closeErr closeError
-
-runLoop:
-	for {
+	s.runLoopGoAwayChan = s.goAwayChan
+}
 
-		// Close immediately if requested
-		select {
-		case closeErr = <-s.closeChan:
-			break runLoop
-		case _, ok := <-s.handshakeEvent:
-			// when the handshake is completed, the channel will be closed
-			s.handleHandshakeEvent(!ok)
-		// case p := <-s.paramsChan:
-		// 	s.processTransportParameters(&p)
-		default:
-		}
+// runOnce handles the next event of the run loop, and then sends the packets resulting from it.
+// If block is false, it doesn't wait for the next event, but returns false if no event is pending.
+// This is only used for sessions running on an event loop, which already completed the handshake.
+// Once the session is closed, runLoopErr is set.
+func (s *session) runOnce(block bool) bool {
+	// Close immediately if requested
+	select {
+	case <-s.closeChan:
+		s.stopRunLoop()
+		return true
+	case _, ok := <-s.handshakeEvent:
+		// when the handshake is completed, the channel will be closed
+		s.handleHandshakeEvent(!ok)
+	// case p := <-s.paramsChan:
+	// 	s.processTransportParameters(&p)
+	default:
+	}
 
-		s.maybeResetTimer()
+	s.maybeResetTimer()
 
+	if block {
 		select {
-		case closeErr = <-s.closeChan:
-			break runLoop
+		case <-s.closeChan:
+			s.stopRunLoop()
+			return true
 		case <-s.timer.Chan():
 			s.timer.SetRead()
 			// We do all the interesting stuff after the switch statement, so
@@ -469,72 +765,200 @@ runLoop:
 			// We do all the interesting stuff after the switch statement, so
 			// nothing to see here.
 		case p := <-s.receivedPackets:
-			err := s.handlePacketImpl(p)
-			if err != nil {
-				if qErr, ok := err.(*qerr.QuicError); ok && qErr.ErrorCode == qerr.DecryptionFailure {
-					s.tryQueueingUndecryptablePacket(p)
-					continue
-				}
-				s.closeLocal(err)
-				continue
+			if !s.handleReceivedPacket(p) {
+				return true
 			}
-			// This is a bit unclean, but works properly, since the packet always
-			// begins with the public header and we never copy it.
-			putPacketBuffer(&p.header.Raw)
 		case p := <-s.paramsChan:
 			s.processTransportParameters(&p)
+		case <-s.runLoopGoAwayChan:
+			s.runLoopGoAwayChan = nil
+			s.handleGoAway()
 		case _, ok := <-s.handshakeEvent:
 			// when the handshake is completed, the channel will be closed
 			s.handleHandshakeEvent(!ok)
-		}
-
-		now := time.Now()
-		if timeout := s.sentPacketHandler.GetAlarmTimeout(); !timeout.IsZero() && timeout.Before(now) {
-			// This could cause packets to be retransmitted.
-			// Check it before trying to send packets.
-			if err := s.sentPacketHandler.OnAlarm(); err != nil {
+		case probe := <-s.probeChan:
+			if err := s.startPathValidation(probe); err != nil {
 				s.closeLocal(err)
 			}
+		case req := <-s.exportChan:
+			if s.handleExportRequest(req) {
+				return true
+			}
 		}
-
-		var pacingDeadline time.Time
-		if s.pacingDeadline.IsZero() { // the timer didn't have a pacing deadline set
-			pacingDeadline = s.sentPacketHandler.TimeUntilSend()
+	} else {
+		// After the handshake, the transport parameters and handshake events were already handled,
+		// and sessions run by a server don't migrate to new paths.
+		select {
+		case <-s.closeChan:
+			s.stopRunLoop()
+			return true
+		case <-s.timer.Chan():
+			s.timer.SetRead()
+		case <-s.sendingScheduled:
+		case p := <-s.receivedPackets:
+			if !s.handleReceivedPacket(p) {
+				return true
+			}
+		case <-s.runLoopGoAwayChan:
+			s.runLoopGoAwayChan = nil
+			s.handleGoAway()
+		case req := <-s.exportChan:
+			if s.handleExportRequest(req) {
+				return true
+			}
+		default:
+			return false
 		}
-		if s.config.KeepAlive && !s.keepAlivePingSent && s.handshakeComplete && time.Since(s.lastNetworkActivityTime) >= s.peerParams.IdleTimeout/2 {
-			// send the PING frame since there is no activity in the session
-			s.packer.QueueControlFrame(&wire.PingFrame{})
-			s.keepAlivePingSent = true
-		} else if !pacingDeadline.IsZero() && now.Before(pacingDeadline) {
-			// If we get to this point before the pacing deadline, we should wait until that deadline.
-			// This can happen when scheduleSending is called, or a packet is received.
-			// Set the timer and restart the run loop.
-			s.pacingDeadline = pacingDeadline
-			continue
+	}
+
+	now := time.Now()
+	if timeout := s.sentPacketHandler.GetAlarmTimeout(); !timeout.IsZero() && timeout.Before(now) {
+		// This could cause packets to be retransmitted.
+		// Check it before trying to send packets.
+		if err := s.sentPacketHandler.OnAlarm(); err != nil {
+			s.closeLocal(err)
 		}
+	}
 
-		if err := s.sendPackets(); err != nil {
+	if s.probe != nil && !now.Before(s.probe.deadline) {
+		if s.probe.numChallenges >= protocol.MaxPathChallenges {
+			s.abandonPath(errPathValidationTimeout)
+		} else if err := s.sendPathChallenge(now); err != nil {
 			s.closeLocal(err)
 		}
+	}
+
+	var pacingDeadline time.Time
+	if s.pacingDeadline.IsZero() { // the timer didn't have a pacing deadline set
+		pacingDeadline = s.sentPacketHandler.TimeUntilSend()
+	}
+	if s.config.KeepAlive && !s.keepAlivePingSent && s.handshakeComplete && time.Since(s.lastNetworkActivityTime) >= s.keepAlivePeriod() {
+		// send the PING frame since there is no activity in the session
+		s.packer.QueueControlFrame(&wire.PingFrame{})
+		s.keepAlivePingSent = true
+	} else if !pacingDeadline.IsZero() && now.Before(pacingDeadline) {
+		// If we get to this point before the pacing deadline, we should wait until that deadline.
+		// This can happen when scheduleSending is called, or a packet is received.
+		// Set the timer and restart the run loop.
+		s.pacingDeadline = pacingDeadline
+		return true
+	}
+
+	if err := s.sendPackets(); err != nil {
+		s.closeLocal(err)
+	}
+
+	s.dropExpiredUndecryptablePackets(now)
+	if !s.receivedTooManyUndecrytablePacketsTime.IsZero() && s.receivedTooManyUndecrytablePacketsTime.Add(protocol.PublicResetTimeout).Before(now) && len(s.undecryptablePackets) != 0 {
+		s.closeLocal(qerr.Error(qerr.DecryptionFailure, "too many undecryptable packets received"))
+	}
+	if !s.handshakeComplete && now.Sub(s.sessionCreationTime) >= s.config.HandshakeTimeout {
+		s.closeLocal(qerr.Error(qerr.HandshakeTimeout, "Crypto handshake did not complete in time."))
+	}
+	if s.handshakeComplete && now.Sub(s.lastNetworkActivityTime) >= s.config.IdleTimeout {
+		s.closeLocal(qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity."))
+	}
+	return true
+}
 
-		if !s.receivedTooManyUndecrytablePacketsTime.IsZero() && s.receivedTooManyUndecrytablePacketsTime.Add(protocol.PublicResetTimeout).Before(now) && len(s.undecryptablePackets) != 0 {
-			s.closeLocal(qerr.Error(qerr.DecryptionFailure, "too many undecryptable packets received"))
+// runOnEventLoop runs the session until the handshake completes, and then hands it over to the event loop.
+// It returns as soon as the session was handed over, or when it was closed before completing the handshake.
+// onClose is called after the run loop stopped.
+func (s *session) runOnEventLoop(l *eventLoop, onClose func()) {
+	s.startRunLoop()
+	for s.runLoopErr == nil && !s.handshakeComplete {
+		s.runOnce(true)
+	}
+	if s.runLoopErr != nil {
+		_ = s.finishRunLoop()
+		onClose()
+		return
+	}
+	e := l.newEntry(s, onClose)
+	s.timer = e.timer
+	// The entry must be stored before the session is scheduled for the first time,
+	// such that events that occur later schedule the session again.
+	s.eventLoopEntry.Store(e)
+	e.schedule()
+}
+
+// handleEvents handles up to maxEvents pending events, for sessions running on an event loop.
+func (s *session) handleEvents(maxEvents int) (pending, stopped bool) {
+	for i := 0; i < maxEvents; i++ {
+		if !s.runOnce(false) {
+			return false, false
+		}
+		if s.runLoopErr != nil {
+			return false, true
 		}
-		if !s.handshakeComplete && now.Sub(s.sessionCreationTime) >= s.config.HandshakeTimeout {
-			s.closeLocal(qerr.Error(qerr.HandshakeTimeout, "Crypto handshake did not complete in time."))
+	}
+	return true, false
+}
+
+// notifyEventLoop tells the event loop that an event is pending, if the session runs on an event loop.
+func (s *session) notifyEventLoop() {
+	if e, ok := s.eventLoopEntry.Load().(*eventLoopEntry); ok {
+		e.schedule()
+	}
+}
+
+// handleReceivedPacket handles a packet received by the run loop.
+// It returns false if the packet couldn't be processed.
+func (s *session) handleReceivedPacket(p *receivedPacket) bool {
+	s.sentPacketHandler.ReceivedBytes(protocol.ByteCount(len(p.header.Raw) + len(p.data)))
+	if !s.handshakeComplete {
+		s.numHandshakePackets++
+		if s.numHandshakePackets > s.config.MaxHandshakePackets {
+			s.closeLocal(qerr.Error(qerr.HandshakeFailed, "Too many packets received before completing the handshake."))
+			return false
 		}
-		if s.handshakeComplete && now.Sub(s.lastNetworkActivityTime) >= s.config.IdleTimeout {
-			s.closeLocal(qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity."))
+	}
+	if err := s.handlePacketImpl(p); err != nil {
+		if qErr, ok := err.(*qerr.QuicError); ok && qErr.ErrorCode == qerr.DecryptionFailure {
+			s.tryQueueingUndecryptablePacket(p)
+			return false
 		}
+		s.closeLocal(err)
+		return false
 	}
+	// This is a bit unclean, but works properly, since the packet always
+	// begins with the public header and we never copy it.
+	putPacketBuffer(&p.header.Raw)
+	return true
+}
+
+// stopRunLoop is called when the run loop picks up the error that the session is closed with.
+func (s *session) stopRunLoop() {
+	closeErr := s.getCloseError()
+	s.runLoopErr = &closeErr
+}
 
+// finishRunLoop is called after the run loop stopped.
+// It sends the CONNECTION_CLOSE (if necessary), and cancels the session's context.
+func (s *session) finishRunLoop() error {
+	defer s.ctxCancel()
+
+	closeErr := *s.runLoopErr
 	// only send the error the handshakeChan when the handshake is not completed yet
 	// otherwise this chan will already be closed
 	if !s.handshakeComplete {
-		s.handshakeChan <- closeErr.err
+		s.handshakeChan <- qerr.ToPublicError(closeErr.err, closeErr.remote)
+		s.handshakeCtxCancel()
 	}
 	s.handleCloseError(closeErr)
-	return closeErr.err
+	if s.probe != nil {
+		s.abandonPath(errSessionClosed)
+	}
+	if s.connIDGenerator != nil {
+		s.connIDGenerator.RemoveAll()
+	}
+	if s.tracer != nil {
+		s.tracer.ClosedConnection(time.Now(), closeErr.err)
+		if err := s.tracer.Export(); err != nil {
+			s.logger.Errorf("Exporting qlog failed: %s", err)
+		}
+	}
+	return qerr.ToPublicError(closeErr.err, closeErr.remote)
 }
 
 func (s *session) Context() context.Context {
@@ -542,22 +966,112 @@ func (s *session) Context() context.Context {
 }
 
 func (s *session) ConnectionState() ConnectionState {
-	return s.cryptoStreamHandler.ConnectionState()
+	state := s.cryptoStreamHandler.ConnectionState()
+	s.peerTransportParamsMutex.Lock()
+	if s.peerTransportParams != nil {
+		params := *s.peerTransportParams
+		state.PeerTransportParameters = &params
+	}
+	s.peerTransportParamsMutex.Unlock()
+	return state
+}
+
+func (s *session) Stats() SessionStats {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+	stats := s.stats
+	stats.QueuedPackets = len(s.receivedPackets)
+	stats.FramesSent = copyFrameCounts(s.stats.FramesSent)
+	stats.FramesReceived = copyFrameCounts(s.stats.FramesReceived)
+	stats.MaxOutgoingStreamID, stats.MaxOutgoingUniStreamID = s.streamsMap.StreamLimits()
+	stats.Goodput = uint64(s.sentPacketHandler.GetGoodput(time.Now()) / congestion.BytesPerSecond)
+	sphStats := s.sentPacketHandler.GetStats()
+	stats.SmoothedRTT = sphStats.SmoothedRTT
+	stats.RTTVariance = sphStats.RTTVariance
+	stats.CongestionWindow = sphStats.CongestionWindow
+	stats.BytesInFlight = sphStats.BytesInFlight
+	stats.PacketsLost = sphStats.PacketsLost
+	stats.PacketsRetransmitted = sphStats.PacketsRetransmitted
+	stats.AmplificationLimited = sphStats.AmplificationLimited
+	stats.AmplificationBudget = sphStats.AmplificationBudget
+	return stats
+}
+
+func (s *session) RTT() (latest, smoothed, min time.Duration) {
+	stats := s.sentPacketHandler.GetStats()
+	return stats.LatestRTT, stats.SmoothedRTT, stats.MinRTT
+}
+
+func (s *session) BandwidthEstimate() uint64 {
+	return uint64(s.sentPacketHandler.GetStats().BandwidthEstimate / congestion.BytesPerSecond)
+}
+
+func copyFrameCounts(counts map[string]uint64) map[string]uint64 {
+	c := make(map[string]uint64, len(counts))
+	for name, n := range counts {
+		c[name] = n
+	}
+	return c
+}
+
+// countFrames counts the frames sent or received, for the session stats
+func (s *session) countFrames(frames []wire.Frame, sent bool) {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	counts := &s.stats.FramesReceived
+	if sent {
+		counts = &s.stats.FramesSent
+	}
+	if *counts == nil {
+		*counts = make(map[string]uint64)
+	}
+	for _, f := range frames {
+		(*counts)[wire.FrameName(f)]++
+	}
+}
+
+// countSentPacket counts a packet sent, and the frames it contains, for the session stats
+func (s *session) countSentPacket(packet *packedPacket) {
+	s.countFrames(packet.frames, true)
+	s.statsMutex.Lock()
+	s.stats.PacketsSent++
+	s.stats.BytesSent += uint64(len(packet.raw))
+	s.statsMutex.Unlock()
+}
+
+func (s *session) updateNextPacketNumber() {
+	s.statsMutex.Lock()
+	s.stats.NextPacketNumber = uint64(s.packer.packetNumberGenerator.Peek())
+	s.statsMutex.Unlock()
+}
+
+// keepAlivePeriod returns the time after which a PING frame is sent, if no packets were received.
+// It is at most half the negotiated idle timeout.
+func (s *session) keepAlivePeriod() time.Duration {
+	period := utils.MinDuration(s.config.IdleTimeout, s.peerParams.IdleTimeout) / 2
+	if s.config.KeepAlivePeriod > 0 {
+		period = utils.MinDuration(period, s.config.KeepAlivePeriod)
+	}
+	return period
 }
 
 func (s *session) maybeResetTimer() {
-	var deadline time.Time
+	var deadline, nextSendTime time.Time
 	if s.config.KeepAlive && s.handshakeComplete && !s.keepAlivePingSent {
-		deadline = s.lastNetworkActivityTime.Add(s.peerParams.IdleTimeout / 2)
+		deadline = s.lastNetworkActivityTime.Add(s.keepAlivePeriod())
+		nextSendTime = deadline
 	} else {
 		deadline = s.lastNetworkActivityTime.Add(s.config.IdleTimeout)
 	}
 
 	if ackAlarm := s.receivedPacketHandler.GetAlarmTimeout(); !ackAlarm.IsZero() {
 		deadline = utils.MinTime(deadline, ackAlarm)
+		nextSendTime = utils.MinNonZeroTime(nextSendTime, ackAlarm)
 	}
 	if lossTime := s.sentPacketHandler.GetAlarmTimeout(); !lossTime.IsZero() {
 		deadline = utils.MinTime(deadline, lossTime)
+		nextSendTime = utils.MinNonZeroTime(nextSendTime, lossTime)
 	}
 	if !s.handshakeComplete {
 		handshakeDeadline := s.sessionCreationTime.Add(s.config.HandshakeTimeout)
@@ -566,20 +1080,288 @@ func (s *session) maybeResetTimer() {
 	if !s.receivedTooManyUndecrytablePacketsTime.IsZero() {
 		deadline = utils.MinTime(deadline, s.receivedTooManyUndecrytablePacketsTime.Add(protocol.PublicResetTimeout))
 	}
+	if len(s.undecryptablePackets) > 0 {
+		deadline = utils.MinTime(deadline, s.undecryptablePackets[0].rcvTime.Add(s.config.UndecryptablePacketTimeout))
+	}
 	if !s.pacingDeadline.IsZero() {
 		deadline = utils.MinTime(deadline, s.pacingDeadline)
+		nextSendTime = utils.MinNonZeroTime(nextSendTime, s.pacingDeadline)
+	}
+	if s.probe != nil {
+		deadline = utils.MinTime(deadline, s.probe.deadline)
+	}
+	if s.mtuDiscoverer != nil {
+		if probeTime := s.mtuDiscoverer.NextProbeTime(); !probeTime.IsZero() {
+			deadline = utils.MinTime(deadline, probeTime)
+			nextSendTime = utils.MinNonZeroTime(nextSendTime, probeTime)
+		}
 	}
 
 	s.timer.Reset(deadline)
+	s.nextSendTimeMutex.Lock()
+	s.nextSendTime = nextSendTime
+	s.nextSendTimeMutex.Unlock()
+}
+
+func (s *session) NextSendTime() time.Time {
+	s.nextSendTimeMutex.Lock()
+	defer s.nextSendTimeMutex.Unlock()
+	return s.nextSendTime
+}
+
+func (s *session) Migrate(pconn net.PacketConn) error {
+	if s.listen == nil {
+		return errors.New("connection migration is only supported by IETF QUIC clients")
+	}
+	probe, err := newPathProbe(pconn, s.conn.RemoteAddr())
+	if err != nil {
+		return err
+	}
+	select {
+	case s.probeChan <- probe:
+	case <-s.ctx.Done():
+		return errSessionClosed
+	}
+	return <-probe.result
+}
+
+func (s *session) UpdateKeys() error {
+	ku, ok := s.cryptoStreamHandler.(keyUpdater)
+	if !ok {
+		return errors.New("key updates are only supported for IETF QUIC")
+	}
+	return ku.UpdateKeys()
+}
+
+func (s *session) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	e, ok := s.cryptoStreamHandler.(keyingMaterialExporter)
+	if !ok {
+		return nil, errors.New("exporting keying material is only supported for IETF QUIC")
+	}
+	return e.ExportKeyingMaterial(label, context, length)
+}
+
+// startPathValidation starts validating a new path, by sending a PATH_CHALLENGE on that path
+func (s *session) startPathValidation(probe *pathProbe) error {
+	if !s.handshakeComplete {
+		probe.result <- errors.New("can't migrate before the handshake completed")
+		return nil
+	}
+	if s.peerParams != nil && s.peerParams.DisableMigration {
+		probe.result <- errors.New("the server disabled connection migration")
+		return nil
+	}
+	if s.probe != nil {
+		probe.result <- errors.New("path validation already in progress")
+		return nil
+	}
+	s.logger.Infof("Validating new path: %s -> %s", probe.conn.LocalAddr(), probe.remoteAddr)
+	s.useNewConnIDForProbe(probe)
+	s.probe = probe
+	go s.listen(probe.conn)
+	return s.sendPathChallenge(time.Now())
+}
+
+// maybeValidatePeerAddress is called by the server when it receives a packet from a new remote address.
+// This can happen when the client migrated, or when a NAT rebinding occurred.
+func (s *session) maybeValidatePeerAddress(addr net.Addr, now time.Time) error {
+	if s.probe != nil {
+		// we're already validating a new address
+		return nil
+	}
+	if !s.lastPathValidation.IsZero() && now.Sub(s.lastPathValidation) < protocol.MinPathValidationInterval {
+		s.logger.Debugf("Not validating new remote address %s. The client's address changed too often.", addr)
+		return nil
+	}
+	s.lastPathValidation = now
+	probe, err := newPathProbe(nil, addr)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("Validating new remote address: %s", addr)
+	// A NAT rebinding doesn't change the path, so there's no need to use a new connection ID.
+	if !isNATRebinding(s.conn.RemoteAddr(), addr) {
+		s.useNewConnIDForProbe(probe)
+	}
+	s.probe = probe
+	return s.sendPathChallenge(now)
+}
+
+func (s *session) sendPathChallenge(now time.Time) error {
+	s.probe.numChallenges++
+	s.probe.deadline = now.Add(utils.MaxDuration(3*s.rttStats.SmoothedRTT(), protocol.MinPathChallengeInterval))
+	s.sentPathChallenge = true
+	packet, err := s.packProbePacket(&wire.PathChallengeFrame{Data: s.probe.data})
+	if err != nil {
+		return err
+	}
+	defer putPacketBuffer(&packet.raw)
+	if s.perspective == protocol.PerspectiveServer {
+		err = s.conn.WriteTo(packet.raw, s.probe.remoteAddr)
+	} else {
+		err = s.probe.conn.Write(packet.raw)
+	}
+	// The new path might not be usable at all. Writing to it shouldn't close the session.
+	if err != nil {
+		s.abandonPath(err)
+	}
+	return nil
+}
+
+// useNewConnIDForProbe selects the connection ID that is used on a new path.
+// If the peer didn't issue any unused connection IDs, the current connection ID is used.
+func (s *session) useNewConnIDForProbe(probe *pathProbe) {
+	if s.connIDManager == nil {
+		return
+	}
+	if c, ok := s.connIDManager.Next(); ok {
+		probe.connID = &c
+	}
+}
+
+// packProbePacket packs a packet that is sent on a path other than the current one
+func (s *session) packProbePacket(frame wire.Frame) (*packedPacket, error) {
+	destConnID := s.packer.destConnID
+	if s.probe != nil && s.probe.connID != nil {
+		destConnID = s.probe.connID.ConnectionID
+	}
+	packet, err := s.packer.PackPathProbe(frame, destConnID)
+	if err != nil {
+		return nil, err
+	}
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	s.logPacket(packet)
+	s.tracePacket(packet)
+	s.countSentPacket(packet)
+	s.updateNextPacketNumber()
+	return packet, nil
+}
+
+// migrate switches to the path that was just validated
+func (s *session) migrate() {
+	probe := s.probe
+	s.probe = nil
+	if s.perspective == protocol.PerspectiveServer {
+		s.logger.Infof("Migrating to new remote address: %s", probe.remoteAddr)
+		oldAddr := s.conn.RemoteAddr()
+		s.conn.SetCurrentRemoteAddr(probe.remoteAddr)
+		// A NAT rebinding usually only changes the port.
+		// The path is still the same, so there's no need to reset the congestion controller.
+		if isNATRebinding(oldAddr, probe.remoteAddr) {
+			probe.result <- nil
+			return
+		}
+	} else {
+		s.logger.Infof("Migrating to new path: %s -> %s", probe.conn.LocalAddr(), probe.remoteAddr)
+		// Packets are now read from the new connection.
+		// Closing the old connection stops reading from it.
+		s.conn.SetPacketConn(probe.pconn).Close()
+	}
+	if probe.connID != nil {
+		s.switchConnectionID(*probe.connID)
+	}
+	s.sentPacketHandler.OnConnectionMigration(s.newCongestionController())
+	// The new path might not support the packet size discovered on the old path.
+	s.packer.SetMaxPacketSize(getMaxPacketSize(s.conn.RemoteAddr()))
+	if s.mtuDiscoverer != nil {
+		s.startMTUDiscovery()
+	}
+	probe.result <- nil
+}
+
+// switchConnectionID switches to a new connection ID issued by the peer, and retires the old one
+func (s *session) switchConnectionID(c newConnID) {
+	s.logger.Debugf("Switching to connection ID %s", c.ConnectionID)
+	s.connIDManager.Use(c)
+	s.destConnID = c.ConnectionID
+	s.packer.SetDestConnectionID(c.ConnectionID)
+	if s.perspective == protocol.PerspectiveClient {
+		s.statelessResetTokenMutex.Lock()
+		s.statelessResetToken = &c.StatelessResetToken
+		s.statelessResetTokenMutex.Unlock()
+	}
+}
+
+// startMTUDiscovery starts path MTU discovery, beginning at the current max packet size
+func (s *session) startMTUDiscovery() {
+	maxSize := protocol.ByteCount(s.config.MaxPacketSize)
+	if s.peerParams != nil && s.peerParams.MaxPacketSize != 0 {
+		maxSize = utils.MinByteCount(maxSize, s.peerParams.MaxPacketSize)
+	}
+	s.mtuDiscoverer = newMTUDiscoverer(s.rttStats, s.packer.maxPacketSize, maxSize, s.packer.IncreaseMaxPacketSize, time.Now())
+}
+
+// abandonPath stops validating a new path.
+// For clients, the connection to the new path is closed.
+func (s *session) abandonPath(err error) {
+	probe := s.probe
+	s.probe = nil
+	s.logger.Infof("Abandoning path to %s: %s", probe.remoteAddr, err)
+	if probe.conn != nil {
+		probe.conn.Close()
+	}
+	if probe.connID != nil {
+		s.connIDManager.Retire(*probe.connID)
+	}
+	probe.result <- err
+}
+
+// isNATRebinding says if the address change was (probably) caused by a NAT rebinding
+func isNATRebinding(oldAddr, newAddr net.Addr) bool {
+	oldUDPAddr, ok := oldAddr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	newUDPAddr, ok := newAddr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	return oldUDPAddr.IP.Equal(newUDPAddr.IP)
+}
+
+// isProbingPacket says if a packet only contains frames used for path validation
+func isProbingPacket(frames []wire.Frame) bool {
+	for _, f := range frames {
+		switch f.(type) {
+		case *wire.PathChallengeFrame, *wire.PathResponseFrame:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (s *session) SendMessage(p []byte) error {
+	if !s.config.EnableDatagrams {
+		return errDatagramsNotEnabled
+	}
+	return s.datagramQueue.AddAndWait(p)
+}
+
+func (s *session) ReceiveMessage() ([]byte, error) {
+	if !s.config.EnableDatagrams {
+		return nil, errDatagramsNotEnabled
+	}
+	return s.datagramQueue.Receive()
 }
 
 func (s *session) handleHandshakeEvent(completed bool) {
 	if !completed {
 		s.tryDecryptingQueuedPackets()
+		if encLevel, _ := s.cryptoStreamHandler.GetSealer(); encLevel >= protocol.EncryptionSecure {
+			s.signalEarlySessionReady()
+		}
 		return
 	}
+	s.signalEarlySessionReady()
 	s.handshakeComplete = true
 	s.handshakeEvent = nil // prevent this case from ever being selected again
+	s.statsMutex.Lock()
+	s.stats.HandshakeDuration = time.Since(s.sessionCreationTime)
+	s.statsMutex.Unlock()
+	if s.tracer != nil {
+		s.tracer.CompletedHandshake(time.Now())
+	}
 	if !s.version.UsesTLS() && s.perspective == protocol.PerspectiveClient {
 		// In gQUIC, there's no equivalent to the Finished message in TLS
 		// The server knows that the handshake is complete when it receives the first forward-secure packet sent by the client.
@@ -587,7 +1369,42 @@ func (s *session) handleHandshakeEvent(completed bool) {
 		s.packer.QueueControlFrame(&wire.PingFrame{})
 		s.scheduleSending()
 	}
+	if s.perspective == protocol.PerspectiveServer && s.tokenGenerator != nil {
+		s.queueNewToken()
+	}
+	if s.connIDGenerator != nil {
+		if err := s.connIDGenerator.IssueConnectionIDs(); err != nil {
+			s.closeLocal(err)
+		}
+	}
+	if !s.config.DisablePathMTUDiscovery {
+		s.startMTUDiscovery()
+	}
 	close(s.handshakeChan)
+	s.handshakeCtxCancel()
+}
+
+// queueNewToken sends the client a token that it can use to skip the Stateless Retry on its next connection
+func (s *session) queueNewToken() {
+	token, err := s.tokenGenerator.NewToken(s.conn.RemoteAddr())
+	if err != nil {
+		s.logger.Errorf("Error generating a token: %s", err)
+		return
+	}
+	s.packer.QueueControlFrame(&wire.NewTokenFrame{Token: token})
+	s.scheduleSending()
+}
+
+func (s *session) signalEarlySessionReady() {
+	if s.earlySessionReady {
+		return
+	}
+	s.earlySessionReady = true
+	close(s.earlySessionReadyChan)
+}
+
+func (s *session) HandshakeComplete() context.Context {
+	return s.handshakeCtx
 }
 
 func (s *session) handlePacketImpl(p *receivedPacket) error {
@@ -619,17 +1436,25 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 
 	packet, err := s.unpacker.Unpack(hdr.Raw, hdr, data)
 	if s.logger.Debug() {
+		logger := s.logger.WithFields(utils.Field{Key: utils.FieldPacketNumber, Value: hdr.PacketNumber})
 		if err != nil {
-			s.logger.Debugf("<- Reading packet 0x%x (%d bytes) for connection %s", hdr.PacketNumber, len(data)+len(hdr.Raw), hdr.DestConnectionID)
+			logger.Debugf("<- Reading packet 0x%x (%d bytes) for connection %s", hdr.PacketNumber, len(data)+len(hdr.Raw), hdr.DestConnectionID)
 		} else {
-			s.logger.Debugf("<- Reading packet 0x%x (%d bytes) for connection %s, %s", hdr.PacketNumber, len(data)+len(hdr.Raw), hdr.DestConnectionID, packet.encryptionLevel)
+			logger.Debugf("<- Reading packet 0x%x (%d bytes) for connection %s, %s", hdr.PacketNumber, len(data)+len(hdr.Raw), hdr.DestConnectionID, packet.encryptionLevel)
 		}
-		hdr.Log(s.logger)
+		hdr.Log(logger)
 	}
 	// if the decryption failed, this might be a packet sent by an attacker
 	if err != nil {
 		return err
 	}
+	if s.tracer != nil {
+		s.tracer.ReceivedPacket(p.rcvTime, hdr, protocol.ByteCount(len(data)+len(hdr.Raw)), packet.encryptionLevel, packet.frames)
+	}
+	s.statsMutex.Lock()
+	s.stats.PacketsReceived++
+	s.stats.BytesReceived += uint64(len(data) + len(hdr.Raw))
+	s.statsMutex.Unlock()
 
 	// In TLS 1.3, the client considers the handshake complete as soon as
 	// it received the server's Finished message and sent its Finished.
@@ -641,6 +1466,7 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	}
 
 	s.lastRcvdPacketNumber = hdr.PacketNumber
+	isLargestRcvd := hdr.PacketNumber > s.largestRcvdPacketNumber
 	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
 	s.largestRcvdPacketNumber = utils.MaxPacketNumber(s.largestRcvdPacketNumber, hdr.PacketNumber)
 
@@ -648,15 +1474,30 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	// The session will be closed and recreated as soon as the crypto setup processed the HRR.
 	if hdr.Type != protocol.PacketTypeRetry {
 		isRetransmittable := ackhandler.HasRetransmittableFrames(packet.frames)
-		if err := s.receivedPacketHandler.ReceivedPacket(hdr.PacketNumber, p.rcvTime, isRetransmittable); err != nil {
+		if err := s.receivedPacketHandler.ReceivedPacket(hdr.PacketNumber, p.ecn, p.rcvTime, isRetransmittable); err != nil {
 			return err
 		}
 	}
 
-	return s.handleFrames(packet.frames, packet.encryptionLevel)
+	// The client's address might have changed, either because it migrated, or because of a NAT rebinding.
+	if s.perspective == protocol.PerspectiveServer && s.version.UsesIETFFrameFormat() && s.handshakeComplete &&
+		p.remoteAddr != nil && p.remoteAddr.String() != s.conn.RemoteAddr().String() {
+		s.probingAddr = p.remoteAddr
+		defer func() { s.probingAddr = nil }()
+	}
+	if err := s.handleFrames(packet.frames, packet.encryptionLevel); err != nil {
+		return err
+	}
+	// Reordered packets might still arrive from the old address, so only the packet with the highest packet number is considered.
+	// Probing packets are sent by the client to validate a new path. They don't mean that the client already migrated.
+	if s.probingAddr != nil && isLargestRcvd && !isProbingPacket(packet.frames) {
+		return s.maybeValidatePeerAddress(s.probingAddr, p.rcvTime)
+	}
+	return nil
 }
 
 func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLevel) error {
+	s.countFrames(fs, false)
 	for _, ff := range fs {
 		var err error
 		wire.LogFrame(s.logger, ff, false)
@@ -666,10 +1507,11 @@ func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLeve
 		case *wire.AckFrame:
 			err = s.handleAckFrame(frame, encLevel)
 		case *wire.ConnectionCloseFrame:
-			s.closeRemote(qerr.Error(frame.ErrorCode, frame.ReasonPhrase))
+			s.handleConnectionCloseFrame(frame)
 		case *wire.GoawayFrame:
-			err = errors.New("unimplemented: handling GOAWAY frames")
-		case *wire.StopWaitingFrame: // ignore STOP_WAITINGs
+			s.handleGoawayFrame(frame)
+		case *wire.StopWaitingFrame:
+			s.handleStopWaitingFrame(frame)
 		case *wire.RstStreamFrame:
 			err = s.handleRstStreamFrame(frame)
 		case *wire.MaxDataFrame:
@@ -680,15 +1522,23 @@ func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLeve
 			err = s.handleMaxStreamIDFrame(frame)
 		case *wire.BlockedFrame:
 		case *wire.StreamBlockedFrame:
+			s.handleStreamBlockedFrame(frame)
 		case *wire.StreamIDBlockedFrame:
 		case *wire.StopSendingFrame:
 			err = s.handleStopSendingFrame(frame)
 		case *wire.PingFrame:
 		case *wire.PathChallengeFrame:
-			s.handlePathChallengeFrame(frame)
+			err = s.handlePathChallengeFrame(frame)
 		case *wire.PathResponseFrame:
-			// since we don't send PATH_CHALLENGEs, we don't expect PATH_RESPONSEs
-			err = errors.New("unexpected PATH_RESPONSE frame")
+			err = s.handlePathResponseFrame(frame)
+		case *wire.DatagramFrame:
+			err = s.handleDatagramFrame(frame)
+		case *wire.NewTokenFrame:
+			err = s.handleNewTokenFrame(frame)
+		case *wire.NewConnectionIDFrame:
+			err = s.connIDManager.Add(frame)
+		case *wire.RetireConnectionIDFrame:
+			err = s.connIDGenerator.Retire(frame.SequenceNumber)
 		default:
 			return errors.New("Session BUG: unexpected frame type")
 		}
@@ -706,7 +1556,15 @@ func (s *session) handlePacket(p *receivedPacket) {
 	// the channel size, protocol.MaxSessionUnprocessedPackets
 	select {
 	case s.receivedPackets <- p:
+		s.statsMutex.Lock()
+		s.stats.MaxQueuedPackets = utils.Max(s.stats.MaxQueuedPackets, len(s.receivedPackets))
+		s.statsMutex.Unlock()
+		s.notifyEventLoop()
 	default:
+		s.statsMutex.Lock()
+		s.stats.DroppedPackets++
+		s.statsMutex.Unlock()
+		s.traceDroppedPacket(p, qlog.PacketDropDOSPrevention)
 	}
 }
 
@@ -719,6 +1577,9 @@ func (s *session) handleStreamFrame(frame *wire.StreamFrame, encLevel protocol.E
 	} else if encLevel <= protocol.EncryptionUnencrypted {
 		return qerr.Error(qerr.UnencryptedStreamData, fmt.Sprintf("received unencrypted stream data on stream %d", frame.StreamID))
 	}
+	if s.isRefusedStream(frame.StreamID) {
+		return s.refusedStreams[frame.StreamID].handleData(frame.Offset+frame.DataLen(), frame.FinBit)
+	}
 	str, err := s.streamsMap.GetOrOpenReceiveStream(frame.StreamID)
 	if err != nil {
 		return err
@@ -731,6 +1592,20 @@ func (s *session) handleStreamFrame(frame *wire.StreamFrame, encLevel protocol.E
 	return str.handleStreamFrame(frame)
 }
 
+// handleGoawayFrame handles a GOAWAY frame sent by a server that is shutting down.
+// The server refuses streams that are opened after sending it.
+func (s *session) handleGoawayFrame(frame *wire.GoawayFrame) {
+	s.logger.Infof("Peer is going away (last good stream: %d): %s", frame.LastGoodStream, frame.ReasonPhrase)
+}
+
+func (s *session) handleConnectionCloseFrame(frame *wire.ConnectionCloseFrame) {
+	if frame.IsApplicationError {
+		s.closeRemote(qerr.NewApplicationError(frame.ErrorCode, frame.ReasonPhrase))
+		return
+	}
+	s.closeRemote(qerr.Error(frame.ErrorCode, frame.ReasonPhrase))
+}
+
 func (s *session) handleMaxDataFrame(frame *wire.MaxDataFrame) {
 	s.connFlowController.UpdateSendWindow(frame.ByteOffset)
 }
@@ -740,6 +1615,9 @@ func (s *session) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) error
 		s.cryptoStream.handleMaxStreamDataFrame(frame)
 		return nil
 	}
+	if s.isRefusedStream(frame.StreamID) {
+		return nil
+	}
 	str, err := s.streamsMap.GetOrOpenSendStream(frame.StreamID)
 	if err != nil {
 		return err
@@ -753,13 +1631,23 @@ func (s *session) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) error
 }
 
 func (s *session) handleMaxStreamIDFrame(frame *wire.MaxStreamIDFrame) error {
-	return s.streamsMap.HandleMaxStreamIDFrame(frame)
+	raised, err := s.streamsMap.HandleMaxStreamIDFrame(frame)
+	if err != nil || !raised {
+		return err
+	}
+	s.statsMutex.Lock()
+	s.stats.LastMaxStreamIDUpdate = time.Now()
+	s.statsMutex.Unlock()
+	return nil
 }
 
 func (s *session) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 	if frame.StreamID == s.version.CryptoStreamID() {
 		return errors.New("Received RST_STREAM frame for the crypto stream")
 	}
+	if s.isRefusedStream(frame.StreamID) {
+		return s.refusedStreams[frame.StreamID].handleData(frame.ByteOffset, true)
+	}
 	str, err := s.streamsMap.GetOrOpenReceiveStream(frame.StreamID)
 	if err != nil {
 		return err
@@ -771,10 +1659,20 @@ func (s *session) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 	return str.handleRstStreamFrame(frame)
 }
 
+func (s *session) handleStreamBlockedFrame(frame *wire.StreamBlockedFrame) {
+	// STREAM_BLOCKED frames don't require any action, but they might open a new stream
+	if frame.StreamID != s.version.CryptoStreamID() {
+		s.isRefusedStream(frame.StreamID)
+	}
+}
+
 func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 	if frame.StreamID == s.version.CryptoStreamID() {
 		return errors.New("Received a STOP_SENDING frame for the crypto stream")
 	}
+	if s.isRefusedStream(frame.StreamID) {
+		return nil
+	}
 	str, err := s.streamsMap.GetOrOpenSendStream(frame.StreamID)
 	if err != nil {
 		return err
@@ -787,8 +1685,61 @@ func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 	return nil
 }
 
-func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) {
-	s.queueControlFrame(&wire.PathResponseFrame{Data: frame.Data})
+func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) error {
+	if s.probingAddr == nil {
+		s.queueControlFrame(&wire.PathResponseFrame{Data: frame.Data})
+		return nil
+	}
+	// The PATH_RESPONSE has to be sent on the path that the PATH_CHALLENGE was received on.
+	packet, err := s.packProbePacket(&wire.PathResponseFrame{Data: frame.Data})
+	if err != nil {
+		return err
+	}
+	defer putPacketBuffer(&packet.raw)
+	return s.conn.WriteTo(packet.raw, s.probingAddr)
+}
+
+func (s *session) handlePathResponseFrame(frame *wire.PathResponseFrame) error {
+	if !s.sentPathChallenge {
+		return errors.New("unexpected PATH_RESPONSE frame")
+	}
+	// Ignore PATH_RESPONSEs that don't belong to the path that is currently being validated.
+	// They might be delayed responses to a path validation that already timed out.
+	if s.probe == nil || frame.Data != s.probe.data {
+		return nil
+	}
+	s.migrate()
+	return nil
+}
+
+func (s *session) handleDatagramFrame(frame *wire.DatagramFrame) error {
+	// we only advertise support for DATAGRAM frames if they are enabled
+	if !s.config.EnableDatagrams {
+		return qerr.Error(qerr.InvalidFrameData, "received a DATAGRAM frame, but DATAGRAM frames are not enabled")
+	}
+	// we advertise protocol.MaxDatagramFrameSize as our max_datagram_frame_size
+	if frame.Length(s.version) > protocol.MaxDatagramFrameSize {
+		return qerr.Error(qerr.InvalidFrameData, "received a DATAGRAM frame that's larger than the advertised max_datagram_frame_size")
+	}
+	s.datagramQueue.HandleDatagramFrame(frame)
+	return nil
+}
+
+func (s *session) handleNewTokenFrame(frame *wire.NewTokenFrame) error {
+	if s.perspective == protocol.PerspectiveServer {
+		return qerr.Error(qerr.InvalidFrameData, "received a NEW_TOKEN frame from the client")
+	}
+	if s.config.TokenStore != nil {
+		s.config.TokenStore.Put(s.tokenStoreKey, frame.Token)
+	}
+	return nil
+}
+
+// handleStopWaitingFrame handles a STOP_WAITING frame (for gQUIC).
+// The peer won't retransmit packets below LeastUnacked, so there's no need to ack them any more.
+// In addition to that, the lower boundary for packets included in ACKs is derived when receiving ACKs.
+func (s *session) handleStopWaitingFrame(frame *wire.StopWaitingFrame) {
+	s.receivedPacketHandler.IgnoreBelow(frame.LeastUnacked)
 }
 
 func (s *session) handleAckFrame(frame *wire.AckFrame, encLevel protocol.EncryptionLevel) error {
@@ -796,19 +1747,56 @@ func (s *session) handleAckFrame(frame *wire.AckFrame, encLevel protocol.Encrypt
 		return err
 	}
 	s.receivedPacketHandler.IgnoreBelow(s.sentPacketHandler.GetLowestPacketNotConfirmedAcked())
+	if s.mtuDiscoverer != nil && encLevel == protocol.EncryptionForwardSecure {
+		s.mtuDiscoverer.ReceivedAck(frame)
+	}
 	return nil
 }
 
 func (s *session) closeLocal(e error) {
-	s.closeOnce.Do(func() {
-		s.closeChan <- closeError{err: e, remote: false}
-	})
+	s.setCloseError(closeError{err: e, remote: false})
 }
 
 func (s *session) closeRemote(e error) {
-	s.closeOnce.Do(func() {
-		s.closeChan <- closeError{err: e, remote: true}
-	})
+	s.setCloseError(closeError{err: e, remote: true})
+}
+
+// setCloseError sets the error that the session is closed with.
+// If multiple errors occur before the run loop terminates, the one with the higher priority wins.
+// For errors with the same priority, the first one wins.
+func (s *session) setCloseError(e closeError) {
+	s.closeMutex.Lock()
+	defer s.closeMutex.Unlock()
+
+	if s.closeErr == nil {
+		s.closeErr = &e
+		s.closeChan <- struct{}{}
+		s.notifyEventLoop()
+		return
+	}
+	if !s.closeErrFinal && closeErrorPriority(e.err) > closeErrorPriority(s.closeErr.err) {
+		s.closeErr = &e
+	}
+}
+
+// getCloseError returns the error that the session is closed with.
+// After calling it, the error can't be changed any more.
+func (s *session) getCloseError() closeError {
+	s.closeMutex.Lock()
+	defer s.closeMutex.Unlock()
+
+	s.closeErrFinal = true
+	return *s.closeErr
+}
+
+// closeErrorPriority returns the priority of an error that the session is closed with.
+// Timeouts have a lower priority than all other errors,
+// since they are usually just a consequence of another error that occurred at the same time.
+func closeErrorPriority(err error) int {
+	if qErr, ok := err.(*qerr.QuicError); ok && qErr.Timeout() {
+		return 0
+	}
+	return 1
 }
 
 // Close the connection. If err is nil it will be set to qerr.PeerGoingAway.
@@ -819,6 +1807,113 @@ func (s *session) Close(e error) error {
 	return nil
 }
 
+// CloseWithError closes the connection with an application error.
+// It waits until the run loop has stopped before returning
+func (s *session) CloseWithError(code protocol.ApplicationErrorCode, reason string) error {
+	return s.Close(qerr.NewApplicationError(qerr.ErrorCode(code), reason))
+}
+
+// goAway tells the peer that the session is going away, when the server is shut down.
+// Afterwards, new streams opened by the peer are refused.
+// The streams that were already opened can still be used.
+func (s *session) goAway() {
+	s.goAwayOnce.Do(func() {
+		close(s.goAwayChan)
+		s.notifyEventLoop()
+	})
+}
+
+func (s *session) handleGoAway() {
+	s.goingAway = true
+	s.refusedStreams = make(map[protocol.StreamID]*refusedStream)
+	// IETF QUIC doesn't have a GOAWAY frame, the application protocol has to signal it
+	if !s.version.UsesIETFFrameFormat() {
+		s.queueControlFrame(&wire.GoawayFrame{
+			ErrorCode:      qerr.PeerGoingAway,
+			LastGoodStream: s.largestPeerStreamIDs[0],
+			ReasonPhrase:   "server shutting down",
+		})
+	}
+}
+
+func (s *session) isPeerInitiatedStream(id protocol.StreamID) bool {
+	// in IETF QUIC, the least significant bit is 0 for client-initiated streams
+	// in gQUIC, client-initiated streams have odd stream IDs
+	clientInitiated := id%2 == 0
+	if !s.version.UsesTLS() {
+		clientInitiated = id%2 == 1
+	}
+	return clientInitiated == (s.perspective == protocol.PerspectiveServer)
+}
+
+// peerStreamType returns the index into largestPeerStreamIDs.
+// In IETF QUIC, streams are numbered separately for bidirectional and unidirectional streams.
+func (s *session) peerStreamType(id protocol.StreamID) int {
+	if !s.version.UsesTLS() {
+		return 0
+	}
+	return int(id % 4)
+}
+
+// isRefusedStream is called for every frame that belongs to a stream, except for the crypto stream.
+// After the session started going away, it refuses the streams that the peer opens, and returns true.
+// The frames of refused streams are dropped.
+func (s *session) isRefusedStream(id protocol.StreamID) bool {
+	if !s.isPeerInitiatedStream(id) {
+		return false
+	}
+	if _, ok := s.refusedStreams[id]; ok {
+		return true
+	}
+	largest := &s.largestPeerStreamIDs[s.peerStreamType(id)]
+	if id <= *largest {
+		return false
+	}
+	if !s.goingAway {
+		*largest = id
+		return false
+	}
+	s.refuseStream(id)
+	return true
+}
+
+// refuseStream resets a stream that the peer opened after the session started going away.
+func (s *session) refuseStream(id protocol.StreamID) {
+	s.refusedStreams[id] = &refusedStream{flowController: s.newFlowController(id)}
+	s.logger.Debugf("Refusing stream %d, since the session is going away", id)
+	if !s.version.UsesTLS() {
+		s.queueControlFrame(&wire.RstStreamFrame{StreamID: id, ErrorCode: errorCodeRefusedGQUIC})
+		return
+	}
+	s.queueControlFrame(&wire.StopSendingFrame{StreamID: id, ErrorCode: errorCodeRefused})
+	// for bidirectional streams, we also need to reset our side of the stream
+	if id%4 < 2 {
+		s.queueControlFrame(&wire.RstStreamFrame{StreamID: id, ErrorCode: errorCodeRefused})
+	}
+}
+
+// A refusedStream is a stream that the peer opened after the session started going away.
+// Its data is dropped, but it is still counted against connection-level flow control, like the data of a canceled stream.
+type refusedStream struct {
+	flowController flowcontrol.StreamFlowController
+	bytesRead      protocol.ByteCount
+}
+
+// handleData handles the data received on the stream, up to offset.
+// The data is immediately marked as read, so that the peer is granted connection-level flow control credit for it.
+func (s *refusedStream) handleData(offset protocol.ByteCount, final bool) error {
+	if err := s.flowController.UpdateHighestReceived(offset, final); err != nil {
+		return err
+	}
+	if offset > s.bytesRead {
+		n := offset - s.bytesRead
+		s.bytesRead = offset
+		s.flowController.AddBytesRead(n)
+		s.flowController.ReleaseCredit(n)
+	}
+	return nil
+}
+
 func (s *session) handleCloseError(closeErr closeError) error {
 	if closeErr.err == nil {
 		closeErr.err = qerr.PeerGoingAway
@@ -829,17 +1924,26 @@ func (s *session) handleCloseError(closeErr closeError) error {
 	if quicErr, ok = closeErr.err.(*qerr.QuicError); !ok {
 		quicErr = qerr.ToQuicError(closeErr.err)
 	}
+	// Pending and future calls on the streams return the reason the session was closed with:
+	// a TransportError, an ApplicationError, or one of the timeout errors.
+	// Other errors (e.g. an error passed to Close) are converted to a TransportError with an InternalError, which wraps the original error.
+	publicErr := qerr.ToPublicError(closeErr.err, closeErr.remote)
+	if _, ok := publicErr.(net.Error); !ok {
+		publicErr = qerr.NewInternalError(closeErr.err)
+	}
+	s.ctxCloseErr.set(publicErr)
 	// Don't log 'normal' reasons
-	if quicErr.ErrorCode == qerr.PeerGoingAway || quicErr.ErrorCode == qerr.NetworkIdleTimeout {
+	if !quicErr.IsApplicationError() && (quicErr.ErrorCode == qerr.PeerGoingAway || quicErr.ErrorCode == qerr.NetworkIdleTimeout) {
 		s.logger.Infof("Closing connection %s", s.srcConnID)
 	} else {
 		s.logger.Errorf("Closing session with error: %s", closeErr.err.Error())
 	}
 
-	s.cryptoStream.closeForShutdown(quicErr)
-	s.streamsMap.CloseWithError(quicErr)
+	s.cryptoStream.closeForShutdown(publicErr)
+	s.streamsMap.CloseWithError(publicErr)
+	s.datagramQueue.CloseWithError(publicErr)
 
-	if closeErr.err == errCloseSessionForNewVersion || closeErr.err == handshake.ErrCloseSessionForRetry {
+	if closeErr.err == errCloseSessionForNewVersion || closeErr.err == handshake.ErrCloseSessionForRetry || closeErr.err == errSessionExported {
 		return nil
 	}
 
@@ -848,7 +1952,7 @@ func (s *session) handleCloseError(closeErr closeError) error {
 		return nil
 	}
 
-	if quicErr.ErrorCode == qerr.DecryptionFailure ||
+	if (quicErr.ErrorCode == qerr.DecryptionFailure && !quicErr.IsApplicationError()) ||
 		quicErr == handshake.ErrHOLExperiment ||
 		quicErr == handshake.ErrNSTPExperiment {
 		return s.sendPublicReset(s.lastRcvdPacketNumber)
@@ -857,7 +1961,13 @@ func (s *session) handleCloseError(closeErr closeError) error {
 }
 
 func (s *session) processTransportParameters(params *handshake.TransportParameters) {
+	if s.tracer != nil {
+		s.tracer.ReceivedTransportParameters(time.Now(), params)
+	}
 	s.peerParams = params
+	s.peerTransportParamsMutex.Lock()
+	s.peerTransportParams = params.PeerTransportParameters()
+	s.peerTransportParamsMutex.Unlock()
 	s.streamsMap.UpdateLimits(params)
 	if params.OmitConnectionID {
 		s.packer.SetOmitConnectionID()
@@ -865,12 +1975,40 @@ func (s *session) processTransportParameters(params *handshake.TransportParamete
 	if params.MaxPacketSize != 0 {
 		s.packer.SetMaxPacketSize(params.MaxPacketSize)
 	}
+	if s.config.EnableDatagrams && params.MaxDatagramFrameSize != 0 {
+		s.datagramQueue.SetMaxFrameSize(params.MaxDatagramFrameSize)
+	}
+	// gQUIC peers don't send a max_ack_delay
+	if params.MaxAckDelay != 0 {
+		s.sentPacketHandler.SetMaxAckDelay(params.MaxAckDelay)
+	}
+	if s.perspective == protocol.PerspectiveClient && params.StatelessResetToken != nil {
+		s.statelessResetTokenMutex.Lock()
+		s.statelessResetToken = params.StatelessResetToken
+		s.statelessResetTokenMutex.Unlock()
+	}
 	s.connFlowController.UpdateSendWindow(params.ConnectionFlowControlWindow)
 	// the crypto stream is the only open stream at this moment
 	// so we don't need to update stream flow control windows
 }
 
-func (s *session) sendPackets() error {
+// handleStatelessReset checks if a packet is a stateless reset sent by the server.
+// If it is, the session is closed. It is only used by IETF QUIC clients.
+func (s *session) handleStatelessReset(packet []byte) bool {
+	s.statelessResetTokenMutex.Lock()
+	token := s.statelessResetToken
+	s.statelessResetTokenMutex.Unlock()
+	if token == nil || len(packet) < protocol.MinStatelessResetSize {
+		return false
+	}
+	if subtle.ConstantTimeCompare(packet[len(packet)-len(token):], token[:]) != 1 {
+		return false
+	}
+	s.closeRemote(StatelessResetError{Token: *token})
+	return true
+}
+
+func (s *session) sendPackets() (err error) {
 	s.pacingDeadline = time.Time{}
 
 	sendMode := s.sentPacketHandler.SendMode()
@@ -878,6 +2016,15 @@ func (s *session) sendPackets() error {
 		return nil
 	}
 
+	// the packets are written to the connection in a single batch when sendPackets returns
+	s.batchWrites = true
+	defer func() {
+		s.batchWrites = false
+		if flushErr := s.flushPackets(); err == nil {
+			err = flushErr
+		}
+	}()
+
 	numPackets := s.sentPacketHandler.ShouldSendNumPackets()
 	var numPacketsSent int
 sendLoop:
@@ -932,6 +2079,13 @@ sendLoop:
 				// e.g. when an Initial is queued, but we already received a packet from the server.
 			}
 		case ackhandler.SendAny:
+			if s.mtuDiscoverer != nil && s.mtuDiscoverer.ShouldSendProbe(time.Now()) {
+				if err := s.sendMTUProbePacket(); err != nil {
+					return err
+				}
+				numPacketsSent++
+				break
+			}
 			sentPacket, err := s.sendPacket()
 			if err != nil {
 				return err
@@ -976,14 +2130,15 @@ func (s *session) maybeSendAckOnlyPacket() error {
 	return s.sendPackedPacket(packet)
 }
 
-// maybeSendRetransmission sends retransmissions for at most one packet.
+// maybeSendRetransmission sends retransmissions.
+// Handshake packets are retransmitted as a whole, one packet at a time.
+// The frames of lost forward-secure packets are queued in the packer, which bundles them into new packets.
 // It takes care that Initials aren't retransmitted, if a packet from the server was already received.
 func (s *session) maybeSendRetransmission() (bool, error) {
-	var retransmitPacket *ackhandler.Packet
-	for {
-		retransmitPacket = s.sentPacketHandler.DequeuePacketForRetransmission()
+	for s.packer.RetransmissionQueueLength() < s.packer.maxPacketSize {
+		retransmitPacket := s.sentPacketHandler.DequeuePacketForRetransmission()
 		if retransmitPacket == nil {
-			return false, nil
+			break
 		}
 
 		// Don't retransmit Initial packets if we already received a response.
@@ -993,33 +2148,74 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 			s.logger.Debugf("Skipping retransmission of packet %d. Already received a response to an Initial.", retransmitPacket.PacketNumber)
 			continue
 		}
-		break
+
+		if retransmitPacket.EncryptionLevel != protocol.EncryptionForwardSecure {
+			return true, s.sendHandshakeRetransmission(retransmitPacket)
+		}
+		s.logger.Debugf("\tQueueing frames of packet 0x%x for retransmission", retransmitPacket.PacketNumber)
+		s.queueFramesForRetransmission(retransmitPacket)
 	}
 
-	if retransmitPacket.EncryptionLevel != protocol.EncryptionForwardSecure {
-		s.logger.Debugf("\tDequeueing handshake retransmission for packet 0x%x", retransmitPacket.PacketNumber)
-	} else {
-		s.logger.Debugf("\tDequeueing retransmission for packet 0x%x", retransmitPacket.PacketNumber)
+	if s.packer.RetransmissionQueueLength() == 0 {
+		return false, nil
+	}
+	if s.version.UsesStopWaitingFrames() {
+		s.packer.QueueControlFrame(s.sentPacketHandler.GetStopWaitingFrame(true))
 	}
+	return s.sendPacket()
+}
 
+func (s *session) sendHandshakeRetransmission(retransmitPacket *ackhandler.Packet) error {
+	s.logger.Debugf("\tDequeueing handshake retransmission for packet 0x%x", retransmitPacket.PacketNumber)
+	// the packer coalesces the ACK with the retransmission, if possible
+	if ack := s.receivedPacketHandler.GetAckFrame(); ack != nil {
+		s.packer.QueueControlFrame(ack)
+	}
 	if s.version.UsesStopWaitingFrames() {
 		s.packer.QueueControlFrame(s.sentPacketHandler.GetStopWaitingFrame(true))
 	}
-	packets, err := s.packer.PackRetransmission(retransmitPacket)
+	packet, err := s.packer.PackRetransmission(retransmitPacket)
 	if err != nil {
-		return false, err
+		return err
+	}
+	s.sentPacketHandler.SentPacketsAsRetransmission([]*ackhandler.Packet{packet.ToAckHandlerPacket()}, retransmitPacket.PacketNumber)
+	if err := s.sendPackedPacket(packet); err != nil {
+		return err
 	}
-	ackhandlerPackets := make([]*ackhandler.Packet, len(packets))
-	for i, packet := range packets {
-		ackhandlerPackets[i] = packet.ToAckHandlerPacket()
+	if s.tracer != nil {
+		s.tracer.RetransmittedPacket(time.Now(), packet.header.PacketNumber)
 	}
-	s.sentPacketHandler.SentPacketsAsRetransmission(ackhandlerPackets, retransmitPacket.PacketNumber)
-	for _, packet := range packets {
-		if err := s.sendPackedPacket(packet); err != nil {
-			return false, err
+	return nil
+}
+
+// queueFramesForRetransmission queues the frames of a lost forward-secure packet in the packer.
+// Frames that don't need to be retransmitted are dropped.
+func (s *session) queueFramesForRetransmission(p *ackhandler.Packet) {
+	for _, f := range p.Frames {
+		switch f := f.(type) {
+		case *wire.DatagramFrame:
+			// DATAGRAM frames are never retransmitted
+			continue
+		case *wire.PathChallengeFrame:
+			// PATH_CHALLENGE frames are never retransmitted, since they have to be sent on the path that is being validated.
+			// A new PATH_CHALLENGE is sent if the path validation doesn't succeed in time.
+			continue
+		case *wire.PathResponseFrame:
+			// PATH_RESPONSE frames are never retransmitted.
+			// The peer sends a new PATH_CHALLENGE if the PATH_RESPONSE is lost.
+			continue
+		case *wire.MaxDataFrame:
+			// a window update is obsolete if a window update with a higher offset was sent since
+			if f.ByteOffset < s.connFlowController.GetReceiveWindow() {
+				continue
+			}
+		case *wire.MaxStreamDataFrame:
+			if s.windowUpdateQueue.IsSuperseded(f) {
+				continue
+			}
 		}
+		s.packer.QueueRetransmission(f)
 	}
-	return true, nil
 }
 
 func (s *session) sendPacket() (bool, error) {
@@ -1048,36 +2244,96 @@ func (s *session) sendPacket() (bool, error) {
 	if err := s.sendPackedPacket(packet); err != nil {
 		return false, err
 	}
+	if s.tracer != nil && packet.containsRetransmission {
+		s.tracer.RetransmittedPacket(time.Now(), packet.header.PacketNumber)
+	}
 	return true, nil
 }
 
+// sendMTUProbePacket sends a packet padded to the next probe size of the mtuDiscoverer
+func (s *session) sendMTUProbePacket() error {
+	size := s.mtuDiscoverer.ProbeSize()
+	packet, err := s.packer.PackMTUProbePacket(size)
+	if err != nil {
+		return err
+	}
+	p := packet.ToAckHandlerPacket()
+	p.IsPathMTUProbePacket = true
+	s.sentPacketHandler.SentPacket(p)
+	s.mtuDiscoverer.SentProbe(p.PacketNumber, size, p.SendTime)
+	return s.sendPackedPacket(packet)
+}
+
 func (s *session) sendPackedPacket(packet *packedPacket) error {
-	defer putPacketBuffer(&packet.raw)
 	s.logPacket(packet)
+	s.tracePacket(packet)
+	s.countSentPacket(packet)
+	s.updateNextPacketNumber()
+	if s.batchWrites {
+		// Coalescing handshake packets saves round trips when the peer limits the number of datagrams it sends before the handshake completes.
+		if n := len(s.packetsToSend); n > 0 && s.coalescePackets && packet.header.IsLongHeader &&
+			protocol.ByteCount(len(s.packetsToSend[n-1])+len(packet.raw)) <= s.packer.maxPacketSize {
+			s.packetsToSend[n-1] = append(s.packetsToSend[n-1], packet.raw...)
+			putPacketBuffer(&packet.raw)
+			return nil
+		}
+		s.packetsToSend = append(s.packetsToSend, packet.raw)
+		s.coalescePackets = packet.header.IsLongHeader
+		return nil
+	}
+	defer putPacketBuffer(&packet.raw)
 	return s.conn.Write(packet.raw)
 }
 
+// flushPackets writes the packets queued by sendPackedPacket to the connection
+func (s *session) flushPackets() error {
+	if len(s.packetsToSend) == 0 {
+		return nil
+	}
+	err := s.conn.WriteBatch(s.packetsToSend)
+	for i, raw := range s.packetsToSend {
+		raw := raw
+		putPacketBuffer(&raw)
+		s.packetsToSend[i] = nil
+	}
+	s.packetsToSend = s.packetsToSend[:0]
+	s.coalescePackets = false
+	return err
+}
+
 func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
 	packet, err := s.packer.PackConnectionClose(&wire.ConnectionCloseFrame{
-		ErrorCode:    quicErr.ErrorCode,
-		ReasonPhrase: quicErr.ErrorMessage,
+		IsApplicationError: quicErr.IsApplicationError(),
+		ErrorCode:          quicErr.ErrorCode,
+		ReasonPhrase:       quicErr.ErrorMessage,
 	})
 	if err != nil {
 		return err
 	}
 	s.logPacket(packet)
+	s.tracePacket(packet)
+	s.countSentPacket(packet)
+	s.updateNextPacketNumber()
 	return s.conn.Write(packet.raw)
 }
 
+func (s *session) tracePacket(packet *packedPacket) {
+	if s.tracer == nil {
+		return
+	}
+	s.tracer.SentPacket(time.Now(), packet.header, protocol.ByteCount(len(packet.raw)), packet.encryptionLevel, packet.frames)
+}
+
 func (s *session) logPacket(packet *packedPacket) {
 	if !s.logger.Debug() {
 		// We don't need to allocate the slices for calling the format functions
 		return
 	}
-	s.logger.Debugf("-> Sending packet 0x%x (%d bytes) for connection %s, %s", packet.header.PacketNumber, len(packet.raw), s.srcConnID, packet.encryptionLevel)
-	packet.header.Log(s.logger)
+	logger := s.logger.WithFields(utils.Field{Key: utils.FieldPacketNumber, Value: packet.header.PacketNumber})
+	logger.Debugf("-> Sending packet 0x%x (%d bytes) for connection %s, %s", packet.header.PacketNumber, len(packet.raw), s.srcConnID, packet.encryptionLevel)
+	packet.header.Log(logger)
 	for _, frame := range packet.frames {
-		wire.LogFrame(s.logger, frame, true)
+		wire.LogFrame(logger, frame, true)
 	}
 }
 
@@ -1098,11 +2354,19 @@ func (s *session) GetOrOpenStream(id protocol.StreamID) (Stream, error) {
 
 // AcceptStream returns the next stream openend by the peer
 func (s *session) AcceptStream() (Stream, error) {
-	return s.streamsMap.AcceptStream()
+	return s.streamsMap.AcceptStream(context.Background())
+}
+
+func (s *session) AcceptStreamContext(ctx context.Context) (Stream, error) {
+	return s.streamsMap.AcceptStream(ctx)
 }
 
 func (s *session) AcceptUniStream() (ReceiveStream, error) {
-	return s.streamsMap.AcceptUniStream()
+	return s.streamsMap.AcceptUniStream(context.Background())
+}
+
+func (s *session) AcceptUniStreamContext(ctx context.Context) (ReceiveStream, error) {
+	return s.streamsMap.AcceptUniStream(ctx)
 }
 
 // OpenStream opens a stream
@@ -1111,7 +2375,11 @@ func (s *session) OpenStream() (Stream, error) {
 }
 
 func (s *session) OpenStreamSync() (Stream, error) {
-	return s.streamsMap.OpenStreamSync()
+	return s.streamsMap.OpenStreamSync(context.Background())
+}
+
+func (s *session) OpenStreamSyncContext(ctx context.Context) (Stream, error) {
+	return s.streamsMap.OpenStreamSync(ctx)
 }
 
 func (s *session) OpenUniStream() (SendStream, error) {
@@ -1119,11 +2387,18 @@ func (s *session) OpenUniStream() (SendStream, error) {
 }
 
 func (s *session) OpenUniStreamSync() (SendStream, error) {
-	return s.streamsMap.OpenUniStreamSync()
+	return s.streamsMap.OpenUniStreamSync(context.Background())
+}
+
+func (s *session) OpenUniStreamSyncContext(ctx context.Context) (SendStream, error) {
+	return s.streamsMap.OpenUniStreamSync(ctx)
 }
 
 func (s *session) newStream(id protocol.StreamID) streamI {
 	flowController := s.newFlowController(id)
+	if s.tracer != nil {
+		s.tracer.UpdatedStreamState(time.Now(), id, qlog.StreamStateOpen)
+	}
 	return newStream(id, s, flowController, s.version)
 }
 
@@ -1136,9 +2411,10 @@ func (s *session) newFlowController(id protocol.StreamID) flowcontrol.StreamFlow
 		id,
 		s.version.StreamContributesToConnectionFlowControl(id),
 		s.connFlowController,
-		protocol.ReceiveStreamFlowControlWindow,
-		protocol.ByteCount(s.config.MaxReceiveStreamFlowControlWindow),
+		protocol.ByteCount(s.config.InitialStreamReceiveWindow),
+		protocol.ByteCount(s.config.MaxStreamReceiveWindow),
 		initialSendWindow,
+		s.config.ManualFlowControlCreditRelease,
 		s.rttStats,
 		s.logger,
 	)
@@ -1151,8 +2427,9 @@ func (s *session) newCryptoStream() cryptoStreamI {
 		s.version.StreamContributesToConnectionFlowControl(id),
 		s.connFlowController,
 		protocol.ReceiveStreamFlowControlWindow,
-		protocol.ByteCount(s.config.MaxReceiveStreamFlowControlWindow),
+		protocol.ByteCount(s.config.MaxStreamReceiveWindow),
 		0,
+		false,
 		s.rttStats,
 		s.logger,
 	)
@@ -1168,6 +2445,7 @@ func (s *session) sendPublicReset(rejectedPacketNumber protocol.PacketNumber) er
 func (s *session) scheduleSending() {
 	select {
 	case s.sendingScheduled <- struct{}{}:
+		s.notifyEventLoop()
 	default:
 	}
 }
@@ -1175,21 +2453,52 @@ func (s *session) scheduleSending() {
 func (s *session) tryQueueingUndecryptablePacket(p *receivedPacket) {
 	if s.handshakeComplete {
 		s.logger.Debugf("Received undecryptable packet from %s after the handshake: %#v, %d bytes data", p.remoteAddr.String(), p.header, len(p.data))
+		s.traceDroppedPacket(p, qlog.PacketDropPayloadDecryptError)
 		return
 	}
-	if len(s.undecryptablePackets)+1 > protocol.MaxUndecryptablePackets {
+	if len(s.undecryptablePackets)+1 > s.config.MaxUndecryptablePackets {
 		// if this is the first time the undecryptablePackets runs full, start the timer to send a Public Reset
 		if s.receivedTooManyUndecrytablePacketsTime.IsZero() {
 			s.receivedTooManyUndecrytablePacketsTime = time.Now()
 			s.maybeResetTimer()
 		}
 		s.logger.Infof("Dropping undecrytable packet 0x%x (undecryptable packet queue full)", p.header.PacketNumber)
+		s.countDroppedUndecryptablePackets(1)
+		s.traceDroppedPacket(p, qlog.PacketDropDOSPrevention)
 		return
 	}
 	s.logger.Infof("Queueing packet 0x%x for later decryption", p.header.PacketNumber)
 	s.undecryptablePackets = append(s.undecryptablePackets, p)
 }
 
+// dropExpiredUndecryptablePackets drops the queued undecryptable packets that were received more than config.UndecryptablePacketTimeout ago
+func (s *session) dropExpiredUndecryptablePackets(now time.Time) {
+	var n int
+	for n < len(s.undecryptablePackets) && !now.Before(s.undecryptablePackets[n].rcvTime.Add(s.config.UndecryptablePacketTimeout)) {
+		s.logger.Debugf("Dropping undecryptable packet 0x%x (keys didn't become available in time)", s.undecryptablePackets[n].header.PacketNumber)
+		s.traceDroppedPacket(s.undecryptablePackets[n], qlog.PacketDropKeyUnavailable)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	s.undecryptablePackets = s.undecryptablePackets[:copy(s.undecryptablePackets, s.undecryptablePackets[n:])]
+	s.countDroppedUndecryptablePackets(n)
+}
+
+func (s *session) countDroppedUndecryptablePackets(n int) {
+	s.statsMutex.Lock()
+	s.stats.DroppedUndecryptablePackets += uint64(n)
+	s.statsMutex.Unlock()
+}
+
+func (s *session) traceDroppedPacket(p *receivedPacket, reason qlog.PacketDropReason) {
+	if s.tracer == nil {
+		return
+	}
+	s.tracer.DroppedPacket(time.Now(), p.header, protocol.ByteCount(len(p.header.Raw)+len(p.data)), reason)
+}
+
 func (s *session) tryDecryptingQueuedPackets() {
 	for _, p := range s.undecryptablePackets {
 		s.handlePacket(p)
@@ -1215,6 +2524,11 @@ func (s *session) onHasStreamData(id protocol.StreamID) {
 func (s *session) onStreamCompleted(id protocol.StreamID) {
 	if err := s.streamsMap.DeleteStream(id); err != nil {
 		s.Close(err)
+		return
+	}
+	s.packer.StreamCompleted(id)
+	if s.tracer != nil {
+		s.tracer.UpdatedStreamState(time.Now(), id, qlog.StreamStateClosed)
 	}
 }
 
@@ -1230,6 +2544,10 @@ func (s *session) handshakeStatus() <-chan error {
 	return s.handshakeChan
 }
 
+func (s *session) earlySessionReadyStatus() <-chan struct{} {
+	return s.earlySessionReadyChan
+}
+
 func (s *session) getCryptoStream() cryptoStreamI {
 	return s.cryptoStream
 }
@@ -0,0 +1,62 @@
+package quic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type sessionCloseErrorKey struct{}
+
+// The sessionCloseError saves the error that a session was closed with.
+// It is stored in the session's context, see SessionCloseError.
+type sessionCloseError struct {
+	mutex sync.Mutex
+	err   error
+}
+
+func (e *sessionCloseError) set(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.err = err
+}
+
+func (e *sessionCloseError) get() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.err
+}
+
+// SessionCloseError returns the error that a session was closed with.
+// The context must be the context returned by Session.Context, or a context derived from it.
+// It returns nil if the session is not closed yet, or if the context doesn't belong to a session.
+func SessionCloseError(ctx context.Context) error {
+	e, ok := ctx.Value(sessionCloseErrorKey{}).(*sessionCloseError)
+	if !ok {
+		return nil
+	}
+	return e.get()
+}
+
+// A valueOnlyContext provides the values of a context, but never expires.
+// It is used to pass the values of the context returned by Config.SessionContext to the session's context.
+type valueOnlyContext struct {
+	context.Context
+}
+
+func (valueOnlyContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valueOnlyContext) Done() <-chan struct{}       { return nil }
+func (valueOnlyContext) Err() error                  { return nil }
+
+// newSessionContext creates the context of a session.
+// The cancel function must be called after the error that the session was closed with was saved.
+func newSessionContext(base context.Context) (context.Context, context.CancelFunc, *sessionCloseError) {
+	if base == nil {
+		base = context.Background()
+	} else {
+		base = valueOnlyContext{base}
+	}
+	closeErr := &sessionCloseError{}
+	ctx, cancel := context.WithCancel(context.WithValue(base, sessionCloseErrorKey{}, closeErr))
+	return ctx, cancel, closeErr
+}
@@ -0,0 +1,42 @@
+package quic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session Context", func() {
+	It("doesn't return a close error for contexts that don't belong to a session", func() {
+		Expect(SessionCloseError(context.Background())).To(BeNil())
+	})
+
+	It("returns the close error", func() {
+		ctx, cancel, closeErr := newSessionContext(nil)
+		Expect(SessionCloseError(ctx)).To(BeNil())
+		testErr := errors.New("test error")
+		closeErr.set(testErr)
+		cancel()
+		Expect(ctx.Done()).To(BeClosed())
+		Expect(SessionCloseError(ctx)).To(MatchError(testErr))
+	})
+
+	It("inherits the values, but not the deadline of the base context", func() {
+		type ctxKey struct{}
+		base, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "foobar"), time.Hour)
+		defer cancel()
+		ctx, cancelSessCtx, _ := newSessionContext(base)
+		defer cancelSessCtx()
+		Expect(ctx.Value(ctxKey{})).To(Equal("foobar"))
+		_, ok := ctx.Deadline()
+		Expect(ok).To(BeFalse())
+		cancel()
+		Expect(ctx.Err()).ToNot(HaveOccurred())
+		Consistently(ctx.Done()).ShouldNot(BeClosed())
+		cancelSessCtx()
+		Expect(ctx.Done()).To(BeClosed())
+	})
+})
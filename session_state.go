@@ -0,0 +1,512 @@
+package quic
+
+import (
+	gocrypto "crypto"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// errSessionExported is the error that a session is closed with after its state was exported.
+// No CONNECTION_CLOSE is sent, since the connection is continued by the process that imports the state.
+var errSessionExported = errors.New("session exported")
+
+// An exportRequest is passed from ExportState to the run loop
+type exportRequest struct {
+	result chan exportResult
+}
+
+type exportResult struct {
+	state []byte
+	err   error
+}
+
+// The following structs are used for ASN1 serialization and deserialization of the state of a session.
+// encoding/asn1 doesn't support unsigned integers, so they are serialized as int64.
+type exportedSession struct {
+	Version                 int64
+	SrcConnectionID         []byte
+	DestConnectionID        []byte
+	RemoteAddr              string
+	CryptoSetup             exportedCryptoSetup
+	NextPacketNumber        int64
+	SentPacketHandler       exportedSentPacketHandler
+	LargestRcvdPacketNumber int64
+	LastRcvdPacketNumber    int64
+	MaxPacketSize           int64
+	ConnectionFlowControl   exportedFlowController
+	StreamsMap              exportedStreamsMap
+	Streams                 []exportedStream
+	HighestIssuedConnIDSeq  int64
+	IssuedConnIDs           []exportedConnID
+	PeerConnIDs             []exportedConnID
+	HighestUsedPeerConnID   int64
+	ActivePeerConnIDSeq     int64
+	PeerParams              exportedTransportParameters
+}
+
+type exportedCryptoSetup struct {
+	CipherSuite              int64
+	Hash                     int64
+	KeyLen                   int64
+	IvLen                    int64
+	MySecret                 []byte
+	OtherSecret              []byte
+	KeyPhase                 int64
+	FirstRcvdWithCurrentKeys int64
+	RcvdWithCurrentKeys      bool
+	ServerName               string
+	NegotiatedProtocol       string
+}
+
+type exportedSentPacketHandler struct {
+	LastSentPacketNumber          int64
+	LargestAcked                  int64
+	LargestReceivedPacketWithAck  int64
+	LowestPacketNotConfirmedAcked int64
+}
+
+type exportedFlowController struct {
+	BytesSent         int64
+	SendWindow        int64
+	BytesRead         int64
+	HighestReceived   int64
+	ReceiveWindow     int64
+	ReceiveWindowSize int64
+}
+
+type exportedStreamsMap struct {
+	NextOutgoingBidi    int64
+	MaxOutgoingBidi     int64
+	NextIncomingBidi    int64
+	HighestIncomingBidi int64
+	MaxIncomingBidi     int64
+	NextOutgoingUni     int64
+	MaxOutgoingUni      int64
+	NextIncomingUni     int64
+	HighestIncomingUni  int64
+	MaxIncomingUni      int64
+}
+
+type exportedStream struct {
+	StreamID    int64
+	WriteOffset int64
+	FinSent     bool
+	ReadOffset  int64
+	FinRead     bool
+	FlowControl exportedFlowController
+}
+
+type exportedConnID struct {
+	SequenceNumber      int64
+	ConnectionID        []byte
+	StatelessResetToken []byte // not set for the connection IDs issued to the peer
+}
+
+type exportedTransportParameters struct {
+	StreamFlowControlWindow     int64
+	ConnectionFlowControlWindow int64
+	MaxPacketSize               int64
+	MaxUniStreams               int64
+	MaxBidiStreams              int64
+	IdleTimeout                 int64
+	MaxDatagramFrameSize        int64
+	DisableMigration            bool
+	MaxAckDelay                 int64
+	StatelessResetToken         []byte // empty if the peer didn't send a stateless reset token
+}
+
+func (s *session) ExportState() ([]byte, error) {
+	req := &exportRequest{result: make(chan exportResult, 1)}
+	select {
+	case s.exportChan <- req:
+	case <-s.ctx.Done():
+		return nil, errSessionClosed
+	}
+	s.notifyEventLoop()
+	select {
+	case res := <-req.result:
+		return res.state, res.err
+	case <-s.ctx.Done():
+		// the run loop might have handled the request right before it stopped
+		select {
+		case res := <-req.result:
+			return res.state, res.err
+		default:
+			return nil, errSessionClosed
+		}
+	}
+}
+
+// handleExportRequest is called by the run loop.
+// If the state was exported, it stops the run loop and returns true.
+// Nothing is sent after that, since the connection is now continued by the importing process.
+func (s *session) handleExportRequest(req *exportRequest) bool {
+	s.closeMutex.Lock()
+	if s.closeErr != nil {
+		s.closeMutex.Unlock()
+		req.result <- exportResult{err: errSessionClosed}
+		return false
+	}
+	state, err := s.exportState()
+	if err == nil {
+		s.closeErr = &closeError{err: errSessionExported}
+	}
+	s.closeMutex.Unlock()
+	req.result <- exportResult{state: state, err: err}
+	if err != nil {
+		return false
+	}
+	s.stopRunLoop()
+	return true
+}
+
+func (s *session) exportState() ([]byte, error) {
+	if s.perspective != protocol.PerspectiveServer || !s.version.UsesTLS() {
+		return nil, errors.New("exporting the state is only supported for IETF QUIC servers")
+	}
+	if !s.handshakeComplete {
+		return nil, errors.New("can't export the state before the handshake completes")
+	}
+	if s.probe != nil {
+		return nil, errors.New("can't export the state while a path is validated")
+	}
+	if s.goingAway {
+		return nil, errors.New("can't export the state of a session that is going away")
+	}
+	if s.hasPendingFrames() {
+		return nil, errors.New("can't export the state while frames are waiting to be sent")
+	}
+	e, ok := s.cryptoStreamHandler.(cryptoStateExporter)
+	if !ok {
+		return nil, errors.New("the state of the crypto setup can't be exported")
+	}
+	sphState, err := s.sentPacketHandler.ExportState()
+	if err != nil {
+		return nil, err
+	}
+	csState, err := e.ExportState()
+	if err != nil {
+		return nil, err
+	}
+	streamsState, err := s.streamsMap.exportState()
+	if err != nil {
+		return nil, err
+	}
+	state := exportedSession{
+		Version:          int64(s.version),
+		SrcConnectionID:  s.srcConnID.Bytes(),
+		DestConnectionID: s.destConnID.Bytes(),
+		RemoteAddr:       s.conn.RemoteAddr().String(),
+		CryptoSetup: exportedCryptoSetup{
+			CipherSuite:              int64(csState.Secrets.CipherSuite.Suite),
+			Hash:                     int64(csState.Secrets.CipherSuite.Hash),
+			KeyLen:                   int64(csState.Secrets.CipherSuite.KeyLen),
+			IvLen:                    int64(csState.Secrets.CipherSuite.IvLen),
+			MySecret:                 csState.Secrets.MySecret,
+			OtherSecret:              csState.Secrets.OtherSecret,
+			KeyPhase:                 int64(csState.KeyPhase),
+			FirstRcvdWithCurrentKeys: int64(csState.FirstRcvdWithCurrentKeys),
+			RcvdWithCurrentKeys:      csState.RcvdWithCurrentKeys,
+			ServerName:               csState.ServerName,
+			NegotiatedProtocol:       csState.NegotiatedProtocol,
+		},
+		NextPacketNumber: int64(s.packer.packetNumberGenerator.Peek()),
+		SentPacketHandler: exportedSentPacketHandler{
+			LastSentPacketNumber:          int64(sphState.LastSentPacketNumber),
+			LargestAcked:                  int64(sphState.LargestAcked),
+			LargestReceivedPacketWithAck:  int64(sphState.LargestReceivedPacketWithAck),
+			LowestPacketNotConfirmedAcked: int64(sphState.LowestPacketNotConfirmedAcked),
+		},
+		LargestRcvdPacketNumber: int64(s.largestRcvdPacketNumber),
+		LastRcvdPacketNumber:    int64(s.lastRcvdPacketNumber),
+		MaxPacketSize:           int64(s.packer.maxPacketSize),
+		ConnectionFlowControl:   exportFlowController(s.connFlowController.GetState()),
+		StreamsMap: exportedStreamsMap{
+			NextOutgoingBidi:    int64(streamsState.nextOutgoingBidi),
+			MaxOutgoingBidi:     int64(streamsState.maxOutgoingBidi),
+			NextIncomingBidi:    int64(streamsState.nextIncomingBidi),
+			HighestIncomingBidi: int64(streamsState.highestIncomingBidi),
+			MaxIncomingBidi:     int64(streamsState.maxIncomingBidi),
+			NextOutgoingUni:     int64(streamsState.nextOutgoingUni),
+			MaxOutgoingUni:      int64(streamsState.maxOutgoingUni),
+			NextIncomingUni:     int64(streamsState.nextIncomingUni),
+			HighestIncomingUni:  int64(streamsState.highestIncomingUni),
+			MaxIncomingUni:      int64(streamsState.maxIncomingUni),
+		},
+		HighestIssuedConnIDSeq: int64(s.connIDGenerator.highestSeq),
+		HighestUsedPeerConnID:  int64(s.connIDManager.highestUsed),
+		ActivePeerConnIDSeq:    int64(s.connIDManager.activeSequenceNumber),
+		PeerParams:             exportTransportParameters(s.peerParams),
+	}
+	for _, str := range streamsState.streams {
+		state.Streams = append(state.Streams, exportedStream{
+			StreamID:    int64(str.streamID),
+			WriteOffset: int64(str.writeOffset),
+			FinSent:     str.finSent,
+			ReadOffset:  int64(str.readOffset),
+			FinRead:     str.finRead,
+			FlowControl: exportFlowController(str.flowControl),
+		})
+	}
+	for seq, connID := range s.connIDGenerator.activeConns {
+		state.IssuedConnIDs = append(state.IssuedConnIDs, exportedConnID{
+			SequenceNumber: int64(seq),
+			ConnectionID:   connID.Bytes(),
+		})
+	}
+	sort.Slice(state.IssuedConnIDs, func(i, j int) bool {
+		return state.IssuedConnIDs[i].SequenceNumber < state.IssuedConnIDs[j].SequenceNumber
+	})
+	for _, c := range s.connIDManager.queue {
+		state.PeerConnIDs = append(state.PeerConnIDs, exportedConnID{
+			SequenceNumber:      int64(c.SequenceNumber),
+			ConnectionID:        c.ConnectionID.Bytes(),
+			StatelessResetToken: c.StatelessResetToken[:],
+		})
+	}
+	return asn1.Marshal(state)
+}
+
+// hasPendingFrames says if any frames are waiting to be sent
+func (s *session) hasPendingFrames() bool {
+	if s.streamFramer.HasCryptoStreamData() || s.datagramQueue.Peek() != nil {
+		return true
+	}
+	s.windowUpdateQueue.mutex.Lock()
+	hasWindowUpdates := len(s.windowUpdateQueue.queue) > 0
+	s.windowUpdateQueue.mutex.Unlock()
+	s.packer.controlFrameMutex.Lock()
+	hasControlFrames := len(s.packer.controlFrames) > 0
+	s.packer.controlFrameMutex.Unlock()
+	return hasWindowUpdates || hasControlFrames || len(s.packer.retransmissionQueue) > 0
+}
+
+func (e *exportedCryptoSetup) cipherSuite() mint.CipherSuiteParams {
+	return mint.CipherSuiteParams{
+		Suite:  mint.CipherSuite(e.CipherSuite),
+		Hash:   gocrypto.Hash(e.Hash),
+		KeyLen: int(e.KeyLen),
+		IvLen:  int(e.IvLen),
+	}
+}
+
+func exportFlowController(state flowcontrol.State) exportedFlowController {
+	return exportedFlowController{
+		BytesSent:         int64(state.BytesSent),
+		SendWindow:        int64(state.SendWindow),
+		BytesRead:         int64(state.BytesRead),
+		HighestReceived:   int64(state.HighestReceived),
+		ReceiveWindow:     int64(state.ReceiveWindow),
+		ReceiveWindowSize: int64(state.ReceiveWindowSize),
+	}
+}
+
+func (e *exportedFlowController) state() flowcontrol.State {
+	return flowcontrol.State{
+		BytesSent:         protocol.ByteCount(e.BytesSent),
+		SendWindow:        protocol.ByteCount(e.SendWindow),
+		BytesRead:         protocol.ByteCount(e.BytesRead),
+		HighestReceived:   protocol.ByteCount(e.HighestReceived),
+		ReceiveWindow:     protocol.ByteCount(e.ReceiveWindow),
+		ReceiveWindowSize: protocol.ByteCount(e.ReceiveWindowSize),
+	}
+}
+
+func exportTransportParameters(params *handshake.TransportParameters) exportedTransportParameters {
+	e := exportedTransportParameters{
+		StreamFlowControlWindow:     int64(params.StreamFlowControlWindow),
+		ConnectionFlowControlWindow: int64(params.ConnectionFlowControlWindow),
+		MaxPacketSize:               int64(params.MaxPacketSize),
+		MaxUniStreams:               int64(params.MaxUniStreams),
+		MaxBidiStreams:              int64(params.MaxBidiStreams),
+		IdleTimeout:                 int64(params.IdleTimeout),
+		MaxDatagramFrameSize:        int64(params.MaxDatagramFrameSize),
+		DisableMigration:            params.DisableMigration,
+		MaxAckDelay:                 int64(params.MaxAckDelay),
+	}
+	if params.StatelessResetToken != nil {
+		e.StatelessResetToken = params.StatelessResetToken[:]
+	}
+	return e
+}
+
+func (e *exportedTransportParameters) params() (*handshake.TransportParameters, error) {
+	params := &handshake.TransportParameters{
+		StreamFlowControlWindow:     protocol.ByteCount(e.StreamFlowControlWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(e.ConnectionFlowControlWindow),
+		MaxPacketSize:               protocol.ByteCount(e.MaxPacketSize),
+		MaxUniStreams:               uint16(e.MaxUniStreams),
+		MaxBidiStreams:              uint16(e.MaxBidiStreams),
+		IdleTimeout:                 time.Duration(e.IdleTimeout),
+		MaxDatagramFrameSize:        protocol.ByteCount(e.MaxDatagramFrameSize),
+		DisableMigration:            e.DisableMigration,
+		MaxAckDelay:                 time.Duration(e.MaxAckDelay),
+	}
+	if len(e.StatelessResetToken) > 0 {
+		var token protocol.StatelessResetToken
+		if len(e.StatelessResetToken) != len(token) {
+			return nil, errors.New("invalid stateless reset token")
+		}
+		copy(token[:], e.StatelessResetToken)
+		params.StatelessResetToken = &token
+	}
+	return params, nil
+}
+
+// parseSessionState parses the state exported by ExportState
+func parseSessionState(data []byte) (*exportedSession, error) {
+	state := &exportedSession{}
+	rest, err := asn1.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("invalid session state: %d bytes remaining", len(rest))
+	}
+	return state, nil
+}
+
+// newImportedSession creates a server session from the state exported by another process.
+// It returns the session, and the streams that were opened or accepted by the application before the export.
+func newImportedSession(
+	conn connection,
+	state *exportedSession,
+	config *Config,
+	runner connIDRunner,
+	logger utils.Logger,
+) (packetHandler, []Stream, error) {
+	s := &session{
+		conn:        conn,
+		config:      config,
+		srcConnID:   protocol.ConnectionID(state.SrcConnectionID),
+		destConnID:  protocol.ConnectionID(state.DestConnectionID),
+		perspective: protocol.PerspectiveServer,
+		version:     protocol.VersionNumber(state.Version),
+		logger:      logger,
+	}
+	peerParams, err := state.PeerParams.params()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.preSetup()
+	cs, err := handshake.NewCryptoSetupTLSFromState(
+		&handshake.CryptoSetupTLSState{
+			Secrets: crypto.OneRTTSecrets{
+				CipherSuite: state.CryptoSetup.cipherSuite(),
+				MySecret:    state.CryptoSetup.MySecret,
+				OtherSecret: state.CryptoSetup.OtherSecret,
+			},
+			KeyPhase:                 int(state.CryptoSetup.KeyPhase),
+			FirstRcvdWithCurrentKeys: protocol.PacketNumber(state.CryptoSetup.FirstRcvdWithCurrentKeys),
+			RcvdWithCurrentKeys:      state.CryptoSetup.RcvdWithCurrentKeys,
+			ServerName:               state.CryptoSetup.ServerName,
+			NegotiatedProtocol:       state.CryptoSetup.NegotiatedProtocol,
+		},
+		s.perspective,
+		s.config.KeyUpdateInterval,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.cryptoStreamHandler = cs
+	s.streamsMap = newStreamsMap(s, s.newFlowController, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, newStreamScheduler(s.config.StreamScheduler, s.config.StreamWeight), s.version)
+	s.packer = newPacketPacker(
+		s.destConnID,
+		s.srcConnID,
+		protocol.PacketNumber(state.NextPacketNumber),
+		s.sentPacketHandler.GetPacketNumberLen,
+		s.RemoteAddr(),
+		nil, // no diversification nonce
+		cs,
+		s.streamFramer,
+		s.perspective,
+		s.version,
+	)
+	if err := s.postSetup(); err != nil {
+		return nil, nil, err
+	}
+	s.setupConnIDs(runner)
+	s.processTransportParameters(peerParams)
+	s.unpacker = newPacketUnpacker(cs, s.version)
+
+	// restore the state that was changed after the handshake
+	s.packer.hasSentPacket = true
+	s.packer.maxPacketSize = protocol.ByteCount(state.MaxPacketSize)
+	s.sentPacketHandler.SetHandshakeComplete()
+	s.sentPacketHandler.ImportState(ackhandler.SentPacketHandlerState{
+		LastSentPacketNumber:          protocol.PacketNumber(state.SentPacketHandler.LastSentPacketNumber),
+		LargestAcked:                  protocol.PacketNumber(state.SentPacketHandler.LargestAcked),
+		LargestReceivedPacketWithAck:  protocol.PacketNumber(state.SentPacketHandler.LargestReceivedPacketWithAck),
+		LowestPacketNotConfirmedAcked: protocol.PacketNumber(state.SentPacketHandler.LowestPacketNotConfirmedAcked),
+	})
+	s.receivedFirstPacket = true
+	s.receivedFirstForwardSecurePacket = true
+	s.largestRcvdPacketNumber = protocol.PacketNumber(state.LargestRcvdPacketNumber)
+	s.lastRcvdPacketNumber = protocol.PacketNumber(state.LastRcvdPacketNumber)
+	s.connFlowController.SetState(state.ConnectionFlowControl.state())
+
+	s.connIDGenerator.highestSeq = uint64(state.HighestIssuedConnIDSeq)
+	s.connIDGenerator.activeConns = make(map[uint64]protocol.ConnectionID, len(state.IssuedConnIDs))
+	for _, c := range state.IssuedConnIDs {
+		connID := protocol.ConnectionID(c.ConnectionID)
+		s.connIDGenerator.activeConns[uint64(c.SequenceNumber)] = connID
+		s.connIDGenerator.addConnectionID(connID)
+	}
+	for _, c := range state.PeerConnIDs {
+		var token protocol.StatelessResetToken
+		if len(c.StatelessResetToken) != len(token) {
+			return nil, nil, errors.New("invalid stateless reset token")
+		}
+		copy(token[:], c.StatelessResetToken)
+		s.connIDManager.queue = append(s.connIDManager.queue, newConnID{
+			SequenceNumber:      uint64(c.SequenceNumber),
+			ConnectionID:        protocol.ConnectionID(c.ConnectionID),
+			StatelessResetToken: token,
+		})
+	}
+	s.connIDManager.highestUsed = uint64(state.HighestUsedPeerConnID)
+	s.connIDManager.activeSequenceNumber = uint64(state.ActivePeerConnIDSeq)
+
+	streamsState := &streamsMapState{
+		nextOutgoingBidi:    protocol.StreamID(state.StreamsMap.NextOutgoingBidi),
+		maxOutgoingBidi:     protocol.StreamID(state.StreamsMap.MaxOutgoingBidi),
+		nextIncomingBidi:    protocol.StreamID(state.StreamsMap.NextIncomingBidi),
+		highestIncomingBidi: protocol.StreamID(state.StreamsMap.HighestIncomingBidi),
+		maxIncomingBidi:     protocol.StreamID(state.StreamsMap.MaxIncomingBidi),
+		nextOutgoingUni:     protocol.StreamID(state.StreamsMap.NextOutgoingUni),
+		maxOutgoingUni:      protocol.StreamID(state.StreamsMap.MaxOutgoingUni),
+		nextIncomingUni:     protocol.StreamID(state.StreamsMap.NextIncomingUni),
+		highestIncomingUni:  protocol.StreamID(state.StreamsMap.HighestIncomingUni),
+		maxIncomingUni:      protocol.StreamID(state.StreamsMap.MaxIncomingUni),
+	}
+	for _, str := range state.Streams {
+		streamsState.streams = append(streamsState.streams, &streamState{
+			streamID:    protocol.StreamID(str.StreamID),
+			writeOffset: protocol.ByteCount(str.WriteOffset),
+			finSent:     str.FinSent,
+			readOffset:  protocol.ByteCount(str.ReadOffset),
+			finRead:     str.FinRead,
+			flowControl: str.FlowControl.state(),
+		})
+	}
+	streams := s.streamsMap.importState(streamsState)
+
+	// the handshake was completed by the exporting process
+	s.signalEarlySessionReady()
+	s.handshakeComplete = true
+	close(s.handshakeChan)
+	s.handshakeCtxCancel()
+	return s, streams, nil
+}
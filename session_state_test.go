@@ -0,0 +1,221 @@
+package quic
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session State", func() {
+	var (
+		serverConnID = protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		clientConnID = protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+		serverSecret = bytes.Repeat([]byte{'s'}, 32)
+		clientSecret = bytes.Repeat([]byte{'c'}, 32)
+		clientAEAD   crypto.AEAD
+		mconn        *mockConnection
+		runner       *mockConnIDRunner
+		// the largest packet number received from the server
+		largestRcvd protocol.PacketNumber
+	)
+
+	// initialState is the state of a session that just completed the handshake
+	initialState := func() *exportedSession {
+		return &exportedSession{
+			Version:          int64(protocol.VersionTLS),
+			SrcConnectionID:  serverConnID,
+			DestConnectionID: clientConnID,
+			RemoteAddr:       "192.168.13.37:1337",
+			CryptoSetup: exportedCryptoSetup{
+				Hash:        int64(gocrypto.SHA256),
+				KeyLen:      16,
+				IvLen:       12,
+				MySecret:    serverSecret,
+				OtherSecret: clientSecret,
+			},
+			NextPacketNumber: 1,
+			MaxPacketSize:    int64(protocol.MinInitialPacketSize),
+			ConnectionFlowControl: exportedFlowController{
+				SendWindow:        0x10000,
+				ReceiveWindow:     0x10000,
+				ReceiveWindowSize: 0x10000,
+			},
+			StreamsMap: exportedStreamsMap{
+				NextOutgoingBidi: 1,
+				MaxOutgoingBidi:  37,
+				NextIncomingBidi: 4,
+				MaxIncomingBidi:  40,
+				NextOutgoingUni:  3,
+				NextIncomingUni:  2,
+				MaxIncomingUni:   2,
+			},
+			IssuedConnIDs: []exportedConnID{{ConnectionID: serverConnID}},
+			PeerParams: exportedTransportParameters{
+				StreamFlowControlWindow:     0x10000,
+				ConnectionFlowControlWindow: 0x10000,
+				MaxBidiStreams:              10,
+				IdleTimeout:                 int64(time.Minute),
+				MaxAckDelay:                 int64(protocol.DefaultMaxAckDelay),
+			},
+		}
+	}
+
+	// readPacket reads the next packet sent by the server, and returns its frames
+	readPacket := func() []wire.Frame {
+		var data []byte
+		Eventually(mconn.written).Should(Receive(&data))
+		r := bytes.NewReader(data)
+		hdr, err := wire.ParseHeaderSentByServer(r, protocol.VersionTLS, clientConnID.Len())
+		Expect(err).ToNot(HaveOccurred())
+		raw := data[:len(data)-r.Len()]
+		largestRcvd = protocol.InferPacketNumber(hdr.PacketNumberLen, largestRcvd, hdr.PacketNumber)
+		decrypted, err := clientAEAD.Open(nil, data[len(raw):], largestRcvd, raw)
+		Expect(err).ToNot(HaveOccurred())
+		var frames []wire.Frame
+		r = bytes.NewReader(decrypted)
+		for r.Len() > 0 {
+			frame, err := wire.ParseNextFrame(r, hdr, protocol.VersionTLS)
+			Expect(err).ToNot(HaveOccurred())
+			frames = append(frames, frame)
+		}
+		return frames
+	}
+
+	// readStreamFrame reads packets sent by the server until it finds a STREAM frame.
+	// It returns the packet number of that packet, and the STREAM frame.
+	readStreamFrame := func() (protocol.PacketNumber, *wire.StreamFrame) {
+		for {
+			for _, frame := range readPacket() {
+				if f, ok := frame.(*wire.StreamFrame); ok {
+					return largestRcvd, f
+				}
+			}
+		}
+	}
+
+	// sendPacket sends a packet from the client to the server
+	sendPacket := func(sess packetHandler, pn protocol.PacketNumber, frames ...wire.Frame) {
+		hdr := &wire.Header{
+			DestConnectionID: serverConnID,
+			PacketNumber:     pn,
+			PacketNumberLen:  protocol.PacketNumberLen2,
+		}
+		buf := &bytes.Buffer{}
+		Expect(hdr.Write(buf, protocol.PerspectiveClient, protocol.VersionTLS)).To(Succeed())
+		raw := *getPacketBuffer()
+		hdr.Raw = append(raw[:0], buf.Bytes()...)
+		payload := &bytes.Buffer{}
+		for _, f := range frames {
+			Expect(f.Write(payload, protocol.VersionTLS)).To(Succeed())
+		}
+		sess.handlePacket(&receivedPacket{
+			remoteAddr: mconn.RemoteAddr(),
+			header:     hdr,
+			data:       clientAEAD.Seal(nil, payload.Bytes(), pn, hdr.Raw),
+		})
+	}
+
+	BeforeEach(func() {
+		Eventually(areSessionsRunning).Should(BeFalse())
+		var err error
+		clientAEAD, _, err = crypto.DeriveAESKeysFromSecrets(crypto.OneRTTSecrets{
+			CipherSuite: initialState().CryptoSetup.cipherSuite(),
+			MySecret:    clientSecret,
+			OtherSecret: serverSecret,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		mconn = newMockConnection()
+		runner = &mockConnIDRunner{}
+		largestRcvd = 0
+	})
+
+	AfterEach(func() {
+		Eventually(areSessionsRunning).Should(BeFalse())
+	})
+
+	It("rejects invalid states", func() {
+		_, err := parseSessionState([]byte("foobar"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("registers the connection IDs of an imported session", func() {
+		state := initialState()
+		state.IssuedConnIDs = append(state.IssuedConnIDs, exportedConnID{SequenceNumber: 1, ConnectionID: []byte{0xde, 0xad, 0xbe, 0xef}})
+		state.HighestIssuedConnIDSeq = 1
+		_, _, err := newImportedSession(mconn, state, populateServerConfig(&Config{}), runner, utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(runner.added).To(ConsistOf(serverConnID, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
+	})
+
+	It("doesn't export the state while packets are outstanding", func() {
+		sess, _, err := newImportedSession(mconn, initialState(), populateServerConfig(&Config{}), runner, utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		go sess.run()
+		str, err := sess.OpenStream()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		readStreamFrame()
+		_, err = sess.ExportState()
+		Expect(err).To(MatchError("SentPacketHandler: can't export the state while packets are outstanding"))
+		// the session continues
+		Expect(sess.Context().Done()).ToNot(BeClosed())
+		Expect(sess.Close(nil)).To(Succeed())
+	})
+
+	It("an exported-then-imported session can continue sending on an existing stream", func() {
+		sess, _, err := newImportedSession(mconn, initialState(), populateServerConfig(&Config{}), runner, utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		go sess.run()
+		str, err := sess.OpenStream()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		pn, frame := readStreamFrame()
+		Expect(frame.StreamID).To(Equal(str.StreamID()))
+		Expect(frame.Data).To(Equal([]byte("foobar")))
+		// acknowledge the packet, so that the session becomes quiescent
+		sendPacket(sess, 1, &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: pn, Largest: pn}}})
+		var data []byte
+		Eventually(func() error {
+			data, err = sess.ExportState()
+			return err
+		}).Should(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+		// no CONNECTION_CLOSE is sent
+		for len(mconn.written) > 0 {
+			for _, f := range readPacket() {
+				Expect(f).ToNot(BeAssignableToTypeOf(&wire.ConnectionCloseFrame{}))
+			}
+		}
+
+		// continue the session
+		state, err := parseSessionState(data)
+		Expect(err).ToNot(HaveOccurred())
+		imported, streams, err := newImportedSession(mconn, state, populateServerConfig(&Config{}), runner, utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		go imported.run()
+		Expect(streams).To(HaveLen(1))
+		Expect(streams[0].StreamID()).To(Equal(str.StreamID()))
+		_, err = streams[0].Write([]byte("raboof"))
+		Expect(err).ToNot(HaveOccurred())
+		newPN, frame := readStreamFrame()
+		Expect(newPN).To(BeNumerically(">", pn))
+		Expect(frame.StreamID).To(Equal(str.StreamID()))
+		Expect(frame.Offset).To(Equal(protocol.ByteCount(6)))
+		Expect(frame.Data).To(Equal([]byte("raboof")))
+		// the imported session accepts packets from the client
+		sendPacket(imported, 2, &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: newPN, Largest: newPN}}})
+		Eventually(func() error {
+			_, err := imported.ExportState()
+			return err
+		}).Should(Succeed())
+	})
+})
@@ -9,6 +9,7 @@ import (
 	"net"
 	"runtime/pprof"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -16,6 +17,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
@@ -25,12 +27,17 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 	"github.com/lucas-clemente/quic-go/qerr"
+	"github.com/lucas-clemente/quic-go/qlog"
 )
 
 type mockConnection struct {
 	remoteAddr net.Addr
 	localAddr  net.Addr
+	pconn      net.PacketConn
 	written    chan []byte
+	writtenTo  net.Addr // the address of the last packet written using WriteTo
+	numBatches int      // the number of WriteBatch calls
+	ecn        protocol.ECN
 }
 
 func newMockConnection() *mockConnection {
@@ -50,15 +57,102 @@ func (m *mockConnection) Write(p []byte) error {
 	}
 	return nil
 }
+func (m *mockConnection) WriteTo(p []byte, addr net.Addr) error {
+	m.writtenTo = addr
+	return m.Write(p)
+}
+func (m *mockConnection) WriteBatch(packets [][]byte) error {
+	m.numBatches++
+	for _, p := range packets {
+		if err := m.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 func (m *mockConnection) Read([]byte) (int, net.Addr, error) { panic("not implemented") }
 
 func (m *mockConnection) SetCurrentRemoteAddr(addr net.Addr) {
 	m.remoteAddr = addr
 }
+func (m *mockConnection) SetPacketConn(pconn net.PacketConn) net.PacketConn {
+	oldPconn := m.pconn
+	m.pconn = pconn
+	return oldPconn
+}
+func (m *mockConnection) PacketConn() net.PacketConn {
+	return m.pconn
+}
+func (m *mockConnection) SetECN(ecn protocol.ECN) {
+	m.ecn = ecn
+}
 func (m *mockConnection) LocalAddr() net.Addr  { return m.localAddr }
 func (m *mockConnection) RemoteAddr() net.Addr { return m.remoteAddr }
 func (*mockConnection) Close() error           { panic("not implemented") }
 
+type writeCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *writeCloser) Close() error {
+	w.closed = true
+	return nil
+}
+
+// mockKeyUpdater is a crypto setup that supports key updates
+type mockKeyUpdater struct {
+	*mockCryptoSetup
+	keysUpdated bool
+	updateErr   error
+}
+
+var _ keyUpdater = &mockKeyUpdater{}
+
+func (m *mockKeyUpdater) UpdateKeys() error {
+	m.keysUpdated = true
+	return m.updateErr
+}
+
+// mockKeyingMaterialExporter is a crypto setup that exports keying material
+type mockKeyingMaterialExporter struct {
+	*mockCryptoSetup
+	label   string
+	context []byte
+	length  int
+	key     []byte
+	err     error
+}
+
+var _ keyingMaterialExporter = &mockKeyingMaterialExporter{}
+
+func (m *mockKeyingMaterialExporter) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	m.label = label
+	m.context = context
+	m.length = length
+	return m.key, m.err
+}
+
+// mockConnIDRunner records the connection IDs issued by a session
+type mockConnIDRunner struct {
+	added   []protocol.ConnectionID
+	retired []protocol.ConnectionID
+}
+
+var _ connIDRunner = &mockConnIDRunner{}
+
+func (r *mockConnIDRunner) addConnectionID(c protocol.ConnectionID, _ packetHandler) {
+	r.added = append(r.added, c)
+}
+func (r *mockConnIDRunner) retireConnectionID(c protocol.ConnectionID) {
+	r.retired = append(r.retired, c)
+}
+func (r *mockConnIDRunner) getStatelessResetToken(c protocol.ConnectionID) protocol.StatelessResetToken {
+	var token protocol.StatelessResetToken
+	copy(token[:], c)
+	return token
+}
+
 func areSessionsRunning() bool {
 	var b bytes.Buffer
 	pprof.Lookup("goroutine").WriteTo(&b, 1)
@@ -88,7 +182,7 @@ var _ = Describe("Session", func() {
 			_ *handshake.ServerConfig,
 			_ *handshake.TransportParameters,
 			_ []protocol.VersionNumber,
-			_ func(net.Addr, *Cookie) bool,
+			_ func(net.Addr, *Token) bool,
 			_ chan<- handshake.TransportParameters,
 			handshakeChanP chan<- struct{},
 			_ utils.Logger,
@@ -124,11 +218,75 @@ var _ = Describe("Session", func() {
 		Eventually(areSessionsRunning).Should(BeFalse())
 	})
 
+	It("uses the values of the context returned by Config.SessionContext", func() {
+		type ctxKey struct{}
+		var remoteAddr net.Addr
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "foobar"))
+		cancel()
+		s, err := newSession(
+			mconn,
+			protocol.Version39,
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			scfg,
+			nil,
+			populateServerConfig(&Config{
+				SessionContext: func(addr net.Addr) context.Context {
+					remoteAddr = addr
+					return ctx
+				},
+			}),
+			utils.DefaultLogger,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(remoteAddr).To(Equal(mconn.RemoteAddr()))
+		sessCtx := s.(*session).Context()
+		Expect(sessCtx.Value(ctxKey{})).To(Equal("foobar"))
+		// the cancellation of the context is ignored
+		Expect(sessCtx.Err()).ToNot(HaveOccurred())
+		Expect(sessCtx.Done()).ToNot(BeClosed())
+	})
+
+	It("sends the configured initial flow control windows in the transport parameters", func() {
+		var params *handshake.TransportParameters
+		newCryptoSetup = func(
+			_ io.ReadWriter,
+			_ protocol.ConnectionID,
+			_ net.Addr,
+			_ protocol.VersionNumber,
+			_ []byte,
+			_ *handshake.ServerConfig,
+			p *handshake.TransportParameters,
+			_ []protocol.VersionNumber,
+			_ func(net.Addr, *Token) bool,
+			_ chan<- handshake.TransportParameters,
+			_ chan<- struct{},
+			_ utils.Logger,
+		) (handshake.CryptoSetup, error) {
+			params = p
+			return cryptoSetup, nil
+		}
+		_, err := newSession(
+			mconn,
+			protocol.Version39,
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			scfg,
+			nil,
+			populateServerConfig(&Config{
+				InitialStreamReceiveWindow:     0x1234,
+				InitialConnectionReceiveWindow: 0x4321,
+			}),
+			utils.DefaultLogger,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(params.StreamFlowControlWindow).To(Equal(protocol.ByteCount(0x1234)))
+		Expect(params.ConnectionFlowControlWindow).To(Equal(protocol.ByteCount(0x4321)))
+	})
+
 	Context("source address validation", func() {
 		var (
-			cookieVerify    func(net.Addr, *Cookie) bool
+			cookieVerify    func(net.Addr, *Token) bool
 			paramClientAddr net.Addr
-			paramCookie     *Cookie
+			paramCookie     *Token
 		)
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1000}
 
@@ -142,7 +300,7 @@ var _ = Describe("Session", func() {
 				_ *handshake.ServerConfig,
 				_ *handshake.TransportParameters,
 				_ []protocol.VersionNumber,
-				cookieFunc func(net.Addr, *Cookie) bool,
+				cookieFunc func(net.Addr, *Token) bool,
 				_ chan<- handshake.TransportParameters,
 				_ chan<- struct{},
 				_ utils.Logger,
@@ -152,7 +310,7 @@ var _ = Describe("Session", func() {
 			}
 
 			conf := populateServerConfig(&Config{})
-			conf.AcceptCookie = func(clientAddr net.Addr, cookie *Cookie) bool {
+			conf.AcceptToken = func(clientAddr net.Addr, cookie *Token) bool {
 				paramClientAddr = clientAddr
 				paramCookie = cookie
 				return false
@@ -179,7 +337,7 @@ var _ = Describe("Session", func() {
 		It("calls the callback with the STK when the client sent an STK", func() {
 			cookieAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
 			sentTime := time.Now().Add(-time.Hour)
-			cookieVerify(remoteAddr, &Cookie{SentTime: sentTime, RemoteAddr: cookieAddr.String()})
+			cookieVerify(remoteAddr, &Token{SentTime: sentTime, RemoteAddr: cookieAddr.String()})
 			Expect(paramClientAddr).To(Equal(remoteAddr))
 			Expect(paramCookie).ToNot(BeNil())
 			Expect(paramCookie.RemoteAddr).To(Equal(cookieAddr.String()))
@@ -187,6 +345,98 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	Context("ECN", func() {
+		It("doesn't mark packets for gQUIC", func() {
+			Expect(mconn.ecn).To(Equal(protocol.ECNNon))
+		})
+
+		It("marks packets ECT(0) for IETF QUIC", func() {
+			sess.version = versionIETFFrames
+			Expect(sess.postSetup()).To(Succeed())
+			Expect(mconn.ecn).To(Equal(protocol.ECT0))
+		})
+
+		It("doesn't mark packets if ECN is disabled", func() {
+			sess.version = versionIETFFrames
+			sess.config.DisableECN = true
+			Expect(sess.postSetup()).To(Succeed())
+			Expect(mconn.ecn).To(Equal(protocol.ECNNon))
+		})
+	})
+
+	Context("path MTU discovery", func() {
+		It("limits the packet size to the configured max packet size", func() {
+			sess.config.MaxPacketSize = protocol.MinInitialPacketSize
+			Expect(sess.postSetup()).To(Succeed())
+			Expect(sess.packer.maxPacketSize).To(BeEquivalentTo(protocol.MinInitialPacketSize))
+		})
+
+		It("starts path MTU discovery when the handshake completes", func() {
+			Expect(sess.mtuDiscoverer).To(BeNil())
+			sess.handleHandshakeEvent(true)
+			Expect(sess.mtuDiscoverer).ToNot(BeNil())
+			Expect(sess.mtuDiscoverer.current).To(Equal(sess.packer.maxPacketSize))
+			Expect(sess.mtuDiscoverer.max).To(Equal(protocol.MaxReceivePacketSize))
+		})
+
+		It("doesn't probe packet sizes larger than the peer's max packet size", func() {
+			sess.peerParams = &handshake.TransportParameters{MaxPacketSize: 1300}
+			sess.handleHandshakeEvent(true)
+			Expect(sess.mtuDiscoverer.max).To(Equal(protocol.ByteCount(1300)))
+		})
+
+		It("doesn't start path MTU discovery if disabled", func() {
+			sess.config.DisablePathMTUDiscovery = true
+			sess.handleHandshakeEvent(true)
+			Expect(sess.mtuDiscoverer).To(BeNil())
+		})
+
+		It("sends MTU probe packets", func() {
+			cryptoSetup.encLevelSeal = protocol.EncryptionForwardSecure
+			sess.packer.maxPacketSize = 1200
+			sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats, 1200, 1400, sess.packer.IncreaseMaxPacketSize, time.Now().Add(-time.Hour))
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().SendMode().Return(ackhandler.SendAny)
+			sph.EXPECT().ShouldSendNumPackets().Return(1)
+			sph.EXPECT().TimeUntilSend()
+			sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+				Expect(p.IsPathMTUProbePacket).To(BeTrue())
+				Expect(p.Frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+				Expect(p.Length).To(Equal(protocol.ByteCount(1300)))
+			})
+			sess.sentPacketHandler = sph
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(mconn.written).To(Receive(HaveLen(1300)))
+			Expect(sess.mtuDiscoverer.probeSize).To(Equal(protocol.ByteCount(1300)))
+			// the probe wasn't acknowledged yet
+			Expect(sess.packer.maxPacketSize).To(Equal(protocol.ByteCount(1200)))
+		})
+
+		It("increases the packet size when a probe is acknowledged", func() {
+			sess.packer.maxPacketSize = 1200
+			sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats, 1200, 1400, sess.packer.IncreaseMaxPacketSize, time.Now())
+			sess.mtuDiscoverer.SentProbe(10, 1300, time.Now())
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+			sph.EXPECT().GetLowestPacketNotConfirmedAcked()
+			sess.sentPacketHandler = sph
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 9, Largest: 11}}}
+			Expect(sess.handleAckFrame(ack, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.packer.maxPacketSize).To(Equal(protocol.ByteCount(1300)))
+		})
+
+		It("resets the packet size when migrating to a new path", func() {
+			sess.packer.maxPacketSize = 1400
+			sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats, 1400, 1452, sess.packer.IncreaseMaxPacketSize, time.Now())
+			sess.perspective = protocol.PerspectiveServer
+			sess.probe = &pathProbe{remoteAddr: &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234}, result: make(chan error, 1)}
+			sess.migrate()
+			Expect(sess.packer.maxPacketSize).To(BeEquivalentTo(protocol.MaxPacketSizeIPv6))
+			Expect(sess.mtuDiscoverer.current).To(BeEquivalentTo(protocol.MaxPacketSizeIPv6))
+		})
+	})
+
 	Context("frame handling", func() {
 		Context("handling STREAM frames", func() {
 			It("passes STREAM frames to the stream", func() {
@@ -380,17 +630,45 @@ var _ = Describe("Session", func() {
 		Context("handling MAX_STREAM_ID frames", func() {
 			It("passes the frame to the streamsMap", func() {
 				f := &wire.MaxStreamIDFrame{StreamID: 10}
-				streamManager.EXPECT().HandleMaxStreamIDFrame(f)
+				streamManager.EXPECT().HandleMaxStreamIDFrame(f).Return(true, nil)
 				err := sess.handleMaxStreamIDFrame(f)
 				Expect(err).ToNot(HaveOccurred())
 			})
 
+			It("records the time when the stream limit was raised", func() {
+				f := &wire.MaxStreamIDFrame{StreamID: 10}
+				streamManager.EXPECT().HandleMaxStreamIDFrame(f).Return(true, nil)
+				streamManager.EXPECT().StreamLimits().Return(protocol.StreamID(10), protocol.StreamID(3))
+				Expect(sess.handleMaxStreamIDFrame(f)).To(Succeed())
+				stats := sess.Stats()
+				Expect(stats.LastMaxStreamIDUpdate).To(BeTemporally("~", time.Now(), scaleDuration(10*time.Millisecond)))
+				Expect(stats.MaxOutgoingStreamID).To(Equal(protocol.StreamID(10)))
+				Expect(stats.MaxOutgoingUniStreamID).To(Equal(protocol.StreamID(3)))
+			})
+
+			It("doesn't update the time for frames that don't raise the stream limit", func() {
+				sess.streamsMap = newStreamsMap(sess, sess.newFlowController, 1, 1, protocol.PerspectiveServer, versionIETFFrames)
+				f := &wire.MaxStreamIDFrame{StreamID: 5}
+				Expect(sess.handleMaxStreamIDFrame(f)).To(Succeed())
+				lastUpdate := sess.Stats().LastMaxStreamIDUpdate
+				Expect(lastUpdate).ToNot(BeZero())
+				time.Sleep(scaleDuration(5 * time.Millisecond))
+				// a duplicate frame
+				Expect(sess.handleMaxStreamIDFrame(f)).To(Succeed())
+				Expect(sess.Stats().LastMaxStreamIDUpdate).To(Equal(lastUpdate))
+				// a reordered frame with a lower limit
+				lower := &wire.MaxStreamIDFrame{StreamID: 1}
+				Expect(sess.handleMaxStreamIDFrame(lower)).To(Succeed())
+				Expect(sess.Stats().LastMaxStreamIDUpdate).To(Equal(lastUpdate))
+			})
+
 			It("returns errors", func() {
 				f := &wire.MaxStreamIDFrame{StreamID: 10}
 				testErr := errors.New("test error")
-				streamManager.EXPECT().HandleMaxStreamIDFrame(f).Return(testErr)
+				streamManager.EXPECT().HandleMaxStreamIDFrame(f).Return(false, testErr)
 				err := sess.handleMaxStreamIDFrame(f)
 				Expect(err).To(MatchError(testErr))
+				Expect(sess.stats.LastMaxStreamIDUpdate).To(BeZero())
 			})
 		})
 
@@ -458,19 +736,34 @@ var _ = Describe("Session", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("errors on GOAWAY frames", func() {
-			err := sess.handleFrames([]wire.Frame{&wire.GoawayFrame{}}, protocol.EncryptionUnspecified)
-			Expect(err).To(MatchError("unimplemented: handling GOAWAY frames"))
+		It("handles GOAWAY frames", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.GoawayFrame{ErrorCode: qerr.PeerGoingAway}}, protocol.EncryptionUnspecified)
+			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("handles STOP_WAITING frames", func() {
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().IgnoreBelow(protocol.PacketNumber(10))
+			sess.receivedPacketHandler = rph
+			err := sess.handleFrames([]wire.Frame{&wire.StopWaitingFrame{LeastUnacked: 10}}, protocol.EncryptionUnspecified)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("doesn't ack packets below the LeastUnacked of a STOP_WAITING frame", func() {
+			for pn := protocol.PacketNumber(1); pn <= 12; pn++ {
+				Expect(sess.receivedPacketHandler.ReceivedPacket(pn, protocol.ECNNon, time.Now(), true)).To(Succeed())
+			}
 			err := sess.handleFrames([]wire.Frame{&wire.StopWaitingFrame{LeastUnacked: 10}}, protocol.EncryptionUnspecified)
 			Expect(err).NotTo(HaveOccurred())
+			ack := sess.receivedPacketHandler.GetAckFrame()
+			Expect(ack).ToNot(BeNil())
+			Expect(ack.LowestAcked()).To(Equal(protocol.PacketNumber(10)))
+			Expect(ack.LargestAcked()).To(Equal(protocol.PacketNumber(12)))
 		})
 
 		It("handles CONNECTION_CLOSE frames", func() {
 			testErr := qerr.Error(qerr.ProofInvalid, "foobar")
-			streamManager.EXPECT().CloseWithError(testErr)
+			streamManager.EXPECT().CloseWithError(&qerr.TransportError{Remote: true, ErrorCode: qerr.ProofInvalid, ErrorMessage: "foobar"})
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
@@ -483,6 +776,29 @@ var _ = Describe("Session", func() {
 			Eventually(sess.Context().Done()).Should(BeClosed())
 			Eventually(done).Should(BeClosed())
 		})
+
+		It("handles APPLICATION_CLOSE frames", func() {
+			streamManager.EXPECT().CloseWithError(&qerr.ApplicationError{Remote: true, ErrorCode: 0x1337, ErrorMessage: "foobar"})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := sess.run()
+				var appErr *qerr.ApplicationError
+				Expect(errors.As(err, &appErr)).To(BeTrue())
+				Expect(appErr.Remote).To(BeTrue())
+				Expect(appErr.ErrorCode).To(BeEquivalentTo(0x1337))
+				Expect(appErr.ErrorMessage).To(Equal("foobar"))
+				close(done)
+			}()
+			err := sess.handleFrames([]wire.Frame{&wire.ConnectionCloseFrame{
+				IsApplicationError: true,
+				ErrorCode:          0x1337,
+				ReasonPhrase:       "foobar",
+			}}, protocol.EncryptionUnspecified)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+			Eventually(done).Should(BeClosed())
+		})
 	})
 
 	It("tells its versions", func() {
@@ -492,7 +808,7 @@ var _ = Describe("Session", func() {
 
 	It("accepts new streams", func() {
 		mstr := NewMockStreamI(mockCtrl)
-		streamManager.EXPECT().AcceptStream().Return(mstr, nil)
+		streamManager.EXPECT().AcceptStream(context.Background()).Return(mstr, nil)
 		str, err := sess.AcceptStream()
 		Expect(err).ToNot(HaveOccurred())
 		Expect(str).To(Equal(mstr))
@@ -509,7 +825,7 @@ var _ = Describe("Session", func() {
 		})
 
 		It("shuts down without error", func() {
-			streamManager.EXPECT().CloseWithError(qerr.Error(qerr.PeerGoingAway, ""))
+			streamManager.EXPECT().CloseWithError(&qerr.TransportError{ErrorCode: qerr.PeerGoingAway})
 			sess.Close(nil)
 			Eventually(areSessionsRunning).Should(BeFalse())
 			Expect(mconn.written).To(HaveLen(1))
@@ -520,8 +836,24 @@ var _ = Describe("Session", func() {
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("closes with an application error", func() {
+			streamManager.EXPECT().CloseWithError(&qerr.ApplicationError{ErrorCode: 0x1337, ErrorMessage: "foobar"})
+			sess.CloseWithError(0x1337, "foobar")
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(mconn.written).To(HaveLen(1))
+			buf := &bytes.Buffer{}
+			err := (&wire.ConnectionCloseFrame{
+				IsApplicationError: true,
+				ErrorCode:          0x1337,
+				ReasonPhrase:       "foobar",
+			}).Write(buf, sess.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.written).To(Receive(ContainSubstring(buf.String())))
+			Expect(sess.Context().Done()).To(BeClosed())
+		})
+
 		It("only closes once", func() {
-			streamManager.EXPECT().CloseWithError(qerr.Error(qerr.PeerGoingAway, ""))
+			streamManager.EXPECT().CloseWithError(&qerr.TransportError{ErrorCode: qerr.PeerGoingAway})
 			sess.Close(nil)
 			sess.Close(nil)
 			Eventually(areSessionsRunning).Should(BeFalse())
@@ -531,12 +863,23 @@ var _ = Describe("Session", func() {
 
 		It("closes streams with proper error", func() {
 			testErr := errors.New("test error")
-			streamManager.EXPECT().CloseWithError(qerr.Error(qerr.InternalError, testErr.Error()))
+			streamManager.EXPECT().CloseWithError(qerr.NewInternalError(testErr))
 			sess.Close(testErr)
 			Eventually(areSessionsRunning).Should(BeFalse())
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("closes streams with a timeout error when the idle timeout expires", func() {
+			streamManager.EXPECT().CloseWithError(gomock.Any()).Do(func(err error) {
+				Expect(err).To(BeAssignableToTypeOf(&qerr.IdleTimeoutError{}))
+				var netErr net.Error
+				Expect(errors.As(err, &netErr)).To(BeTrue())
+				Expect(netErr.Timeout()).To(BeTrue())
+			})
+			sess.closeLocal(qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity."))
+			Eventually(areSessionsRunning).Should(BeFalse())
+		})
+
 		It("closes the session in order to replace it with another QUIC version", func() {
 			streamManager.EXPECT().CloseWithError(gomock.Any())
 			sess.Close(errCloseSessionForNewVersion)
@@ -560,6 +903,26 @@ var _ = Describe("Session", func() {
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("saves the close error in the context", func() {
+			testErr := errors.New("test error")
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			type ctxKey struct{}
+			ctx := context.WithValue(sess.Context(), ctxKey{}, "foobar")
+			Expect(SessionCloseError(ctx)).To(BeNil())
+			sess.Close(testErr)
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(ctx.Done()).To(BeClosed())
+			Expect(SessionCloseError(ctx)).To(Equal(qerr.NewInternalError(testErr)))
+			Expect(errors.Is(SessionCloseError(ctx), testErr)).To(BeTrue())
+		})
+
+		It("saves the close error in the context, when closing without an error", func() {
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sess.Close(nil)
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(SessionCloseError(sess.Context())).To(Equal(&qerr.TransportError{ErrorCode: qerr.PeerGoingAway}))
+		})
+
 		It("cancels the context when the run loop exists", func() {
 			streamManager.EXPECT().CloseWithError(gomock.Any())
 			returned := make(chan struct{})
@@ -576,6 +939,193 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	Context("going away", func() {
+		openStream := func(id protocol.StreamID) {
+			f := &wire.StreamFrame{StreamID: id, Data: []byte("foobar")}
+			str := NewMockReceiveStreamI(mockCtrl)
+			str.EXPECT().handleStreamFrame(f)
+			streamManager.EXPECT().GetOrOpenReceiveStream(id).Return(str, nil)
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+		}
+
+		It("sends a GOAWAY frame, when the run loop picks it up", func() {
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+			openStream(5)
+			openStream(3)
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			sess.goAway()
+			sess.goAway() // calling it multiple times is fine
+			var packet []byte
+			Eventually(mconn.written).Should(Receive(&packet))
+			goaway := &bytes.Buffer{}
+			Expect((&wire.GoawayFrame{
+				ErrorCode:      qerr.PeerGoingAway,
+				LastGoodStream: 5,
+				ReasonPhrase:   "server shutting down",
+			}).Write(goaway, sess.version)).To(Succeed())
+			Expect(packet).To(ContainSubstring(goaway.String()))
+			sess.Close(nil)
+			Eventually(areSessionsRunning).Should(BeFalse())
+		})
+
+		It("still accepts STREAM frames for the streams that were already opened", func() {
+			openStream(5)
+			sess.handleGoAway()
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+			Expect(sess.packer.controlFrames[0]).To(BeAssignableToTypeOf(&wire.GoawayFrame{}))
+			openStream(3)
+			openStream(5)
+			// server-initiated streams can still be used
+			openStream(6)
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+		})
+
+		It("refuses new streams opened by the peer (gQUIC)", func() {
+			openStream(3)
+			sess.handleGoAway()
+			sess.packer.controlFrames = nil
+			f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{
+				&wire.RstStreamFrame{StreamID: 5, ErrorCode: errorCodeRefusedGQUIC},
+			}))
+			// only reset the stream once
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+		})
+
+		It("refuses new streams opened by the peer using other frames than STREAM frames", func() {
+			openStream(3)
+			sess.handleGoAway()
+			sess.packer.controlFrames = nil
+			Expect(sess.handleFrames([]wire.Frame{
+				&wire.RstStreamFrame{StreamID: 5, ByteOffset: 6},
+				&wire.MaxStreamDataFrame{StreamID: 7, ByteOffset: 0x1000},
+				&wire.StreamBlockedFrame{StreamID: 9, Offset: 0x1000},
+				&wire.StopSendingFrame{StreamID: 11, ErrorCode: 1},
+			}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{
+				&wire.RstStreamFrame{StreamID: 5, ErrorCode: errorCodeRefusedGQUIC},
+				&wire.RstStreamFrame{StreamID: 7, ErrorCode: errorCodeRefusedGQUIC},
+				&wire.RstStreamFrame{StreamID: 9, ErrorCode: errorCodeRefusedGQUIC},
+				&wire.RstStreamFrame{StreamID: 11, ErrorCode: errorCodeRefusedGQUIC},
+			}))
+			// STREAM frames for these streams are dropped as well
+			Expect(sess.handleStreamFrame(&wire.StreamFrame{StreamID: 7, Data: []byte("foobar")}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.packer.controlFrames).To(HaveLen(4))
+		})
+
+		It("counts the data of refused streams against connection-level flow control", func() {
+			openStream(3)
+			sess.handleGoAway()
+			Expect(sess.connFlowController.GetWindowUpdate()).To(BeZero())
+			window := sess.connFlowController.GetReceiveWindow()
+			f := &wire.StreamFrame{StreamID: 5, Data: make([]byte, window/2)}
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+			// the dropped data is treated as read, so the peer is granted more credit
+			Expect(sess.connFlowController.GetWindowUpdate()).To(BeNumerically(">", window))
+			// retransmissions aren't counted twice
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.connFlowController.GetWindowUpdate()).To(BeZero())
+			// the final offset of the stream is checked
+			err := sess.handleRstStreamFrame(&wire.RstStreamFrame{StreamID: 5, ByteOffset: window})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FlowControlReceivedTooMuchData))
+		})
+
+		It("refuses new streams opened by the peer (IETF QUIC)", func() {
+			sess.version = protocol.VersionTLS
+			openStream(4)
+			openStream(2)
+			sess.handleGoAway()
+			// IETF QUIC doesn't have a GOAWAY frame
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+			// bidirectional streams
+			openStream(4)
+			Expect(sess.handleStreamFrame(&wire.StreamFrame{StreamID: 8}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{
+				&wire.StopSendingFrame{StreamID: 8, ErrorCode: errorCodeRefused},
+				&wire.RstStreamFrame{StreamID: 8, ErrorCode: errorCodeRefused},
+			}))
+			sess.packer.controlFrames = nil
+			// unidirectional streams
+			openStream(2)
+			Expect(sess.handleStreamFrame(&wire.StreamFrame{StreamID: 6}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{
+				&wire.StopSendingFrame{StreamID: 6, ErrorCode: errorCodeRefused},
+			}))
+		})
+	})
+
+	Context("choosing the close reason", func() {
+		timeoutErr := qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity.")
+		flowControlErr := qerr.Error(qerr.FlowControlReceivedTooMuchData, "flow control violation")
+
+		It("prefers a transport error over a timeout", func() {
+			sess.closeLocal(timeoutErr)
+			sess.closeLocal(flowControlErr)
+			Expect(sess.getCloseError()).To(Equal(closeError{err: flowControlErr}))
+		})
+
+		It("doesn't replace a transport error with a timeout", func() {
+			sess.closeLocal(flowControlErr)
+			sess.closeLocal(timeoutErr)
+			Expect(sess.getCloseError()).To(Equal(closeError{err: flowControlErr}))
+		})
+
+		It("uses the first error, if two errors have the same priority", func() {
+			testErr := errors.New("test error")
+			sess.closeRemote(flowControlErr)
+			sess.closeLocal(testErr)
+			Expect(sess.getCloseError()).To(Equal(closeError{err: flowControlErr, remote: true}))
+		})
+
+		It("doesn't change the error after the run loop picked it up", func() {
+			sess.closeLocal(timeoutErr)
+			Expect(sess.getCloseError().err).To(Equal(timeoutErr))
+			sess.closeLocal(flowControlErr)
+			Expect(sess.getCloseError().err).To(Equal(timeoutErr))
+		})
+
+		It("consistently uses the transport error, if it occurs concurrently with a timeout", func() {
+			for i := 0; i < 100; i++ {
+				sess.closeErr = nil
+				sess.closeErrFinal = false
+				sess.closeChan = make(chan struct{}, 1)
+				var wg sync.WaitGroup
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					sess.closeLocal(timeoutErr)
+				}()
+				go func() {
+					defer wg.Done()
+					sess.closeLocal(flowControlErr)
+				}()
+				wg.Wait()
+				Expect(sess.closeChan).To(HaveLen(1))
+				Expect(sess.getCloseError().err).To(Equal(flowControlErr))
+			}
+		})
+
+		It("closes the session with the transport error", func() {
+			sess.closeLocal(timeoutErr)
+			sess.closeLocal(flowControlErr)
+			streamManager.EXPECT().CloseWithError(qerr.ToPublicError(flowControlErr, false))
+			Expect(sess.run()).To(MatchError(flowControlErr))
+			Expect(mconn.written).To(HaveLen(1))
+			buf := &bytes.Buffer{}
+			err := (&wire.ConnectionCloseFrame{ErrorCode: qerr.FlowControlReceivedTooMuchData, ReasonPhrase: "flow control violation"}).Write(buf, sess.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.written).To(Receive(ContainSubstring(buf.String())))
+		})
+	})
+
 	Context("receiving packets", func() {
 		var hdr *wire.Header
 		var unpacker *MockUnpacker
@@ -600,13 +1150,23 @@ var _ = Describe("Session", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
 			now := time.Now().Add(time.Hour)
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
-			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(5), now, false)
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(5), protocol.ECNNon, now, false)
 			sess.receivedPacketHandler = rph
 			hdr.PacketNumber = 5
 			err := sess.handlePacketImpl(&receivedPacket{header: hdr, rcvTime: now})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("passes the ECN codepoint to the ReceivedPacketHandler", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(5), protocol.ECNCE, gomock.Any(), false)
+			sess.receivedPacketHandler = rph
+			hdr.PacketNumber = 5
+			err := sess.handlePacketImpl(&receivedPacket{header: hdr, rcvTime: time.Now(), ecn: protocol.ECNCE})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
 		It("doesn't inform the ReceivedPacketHandler about Retry packets", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
 			now := time.Now().Add(time.Hour)
@@ -682,7 +1242,7 @@ var _ = Describe("Session", func() {
 
 		It("sends ACK frames", func() {
 			packetNumber := protocol.PacketNumber(0x035e)
-			err := sess.receivedPacketHandler.ReceivedPacket(packetNumber, time.Now(), true)
+			err := sess.receivedPacketHandler.ReceivedPacket(packetNumber, protocol.ECNNon, time.Now(), true)
 			Expect(err).ToNot(HaveOccurred())
 			sent, err := sess.sendPacket()
 			Expect(err).NotTo(HaveOccurred())
@@ -760,7 +1320,7 @@ var _ = Describe("Session", func() {
 			})
 			sph.EXPECT().DequeuePacketForRetransmission()
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
-			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any())
+			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
 			sess.receivedPacketHandler = rph
 			sess.sentPacketHandler = sph
 			err := sess.handlePacketImpl(&receivedPacket{
@@ -864,6 +1424,49 @@ var _ = Describe("Session", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("writes the packets in a single batch", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().TimeUntilSend()
+			sph.EXPECT().ShouldSendNumPackets().Return(3)
+			sph.EXPECT().SendMode().Return(ackhandler.SendAny).Do(func() {
+				// make sure there's something to send
+				sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1})
+			}).Times(3)
+			sph.EXPECT().SentPacket(gomock.Any()).Times(3)
+			sess.sentPacketHandler = sph
+			err := sess.sendPackets()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.written).To(HaveLen(3))
+			Expect(mconn.numBatches).To(Equal(1))
+			Expect(sess.packetsToSend).To(BeEmpty())
+		})
+
+		It("coalesces packets with a Long Header into a single datagram", func() {
+			getPacket := func(longHeader bool, size int) *packedPacket {
+				raw := *getPacketBuffer()
+				return &packedPacket{
+					header: &wire.Header{IsLongHeader: longHeader},
+					raw:    append(raw[:0], bytes.Repeat([]byte{0x42}, size)...),
+				}
+			}
+			sess.packer.maxPacketSize = 1000
+			sess.batchWrites = true
+			Expect(sess.sendPackedPacket(getPacket(true, 300))).To(Succeed())
+			Expect(sess.sendPackedPacket(getPacket(true, 400))).To(Succeed())
+			// this packet doesn't fit into the first datagram any more
+			Expect(sess.sendPackedPacket(getPacket(true, 400))).To(Succeed())
+			// packets with a Short Header are sent in their own datagram
+			Expect(sess.sendPackedPacket(getPacket(false, 100))).To(Succeed())
+			Expect(sess.sendPackedPacket(getPacket(true, 100))).To(Succeed())
+			Expect(sess.flushPackets()).To(Succeed())
+			var sizes []int
+			for len(mconn.written) > 0 {
+				sizes = append(sizes, len(<-mconn.written))
+			}
+			Expect(sizes).To(Equal([]int{700, 400, 100, 100}))
+		})
+
 		It("doesn't send when the SentPacketHandler doesn't allow it", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().SendMode().Return(ackhandler.SendNone)
@@ -959,6 +1562,29 @@ var _ = Describe("Session", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("reports the pacing deadline as the next send time", func() {
+			pacingDeadline := time.Now().Add(time.Hour)
+			sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1})
+			sph.EXPECT().SentPacket(gomock.Any())
+			sph.EXPECT().TimeUntilSend().Return(time.Now().Add(-time.Minute)) // send one packet immediately
+			sph.EXPECT().TimeUntilSend().Return(pacingDeadline)
+			sph.EXPECT().ShouldSendNumPackets().Return(1)
+			sph.EXPECT().SendMode().Return(ackhandler.SendAny)
+			Expect(sess.NextSendTime()).To(BeZero())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			sess.scheduleSending()
+			Eventually(mconn.written).Should(HaveLen(1))
+			Eventually(sess.NextSendTime).Should(Equal(pacingDeadline))
+			// make the go routine return
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("sends multiple packets at once", func() {
 			sph.EXPECT().SentPacket(gomock.Any()).Times(3)
 			sph.EXPECT().ShouldSendNumPackets().Return(3)
@@ -1028,7 +1654,7 @@ var _ = Describe("Session", func() {
 			})
 			sess.sentPacketHandler = sph
 			sess.packer.packetNumberGenerator.next = 0x1338
-			sess.receivedPacketHandler.ReceivedPacket(1, time.Now(), true)
+			sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
@@ -1059,7 +1685,7 @@ var _ = Describe("Session", func() {
 			})
 			sess.sentPacketHandler = sph
 			sess.packer.packetNumberGenerator.next = 0x1338
-			sess.receivedPacketHandler.ReceivedPacket(1, time.Now(), true)
+			sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)
 			go func() {
 				defer GinkgoRecover()
 				sess.run()
@@ -1130,6 +1756,30 @@ var _ = Describe("Session", func() {
 				Expect(sent).To(BeTrue())
 				Expect(mconn.written).To(HaveLen(1))
 			})
+
+			It("coalesces an ACK with the retransmission", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionUnencrypted}
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 3}}}
+				rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+				rph.EXPECT().GetAckFrame().Return(ack)
+				sess.receivedPacketHandler = rph
+				sf := &wire.StreamFrame{StreamID: 1, Data: []byte("foobar")}
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    1337,
+					Frames:          []wire.Frame{sf},
+					EncryptionLevel: protocol.EncryptionUnencrypted,
+				})
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(1337)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
+					Expect(packets).To(HaveLen(1))
+					Expect(packets[0].Frames).To(Equal([]wire.Frame{ack, sf}))
+				})
+				sent, err := sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Expect(mconn.written).To(HaveLen(1))
+			})
 		})
 
 		Context("for packets after the handshake", func() {
@@ -1145,13 +1795,11 @@ var _ = Describe("Session", func() {
 					Frames:          []wire.Frame{f},
 					EncryptionLevel: protocol.EncryptionForwardSecure,
 				})
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(0x1337)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
-					Expect(packets).To(HaveLen(1))
-					p := packets[0]
-					Expect(p.Frames).To(HaveLen(2))
-					Expect(p.Frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-					Expect(p.Frames[1]).To(Equal(f))
+				sph.EXPECT().DequeuePacketForRetransmission()
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.Frames).To(Equal([]wire.Frame{swf, f}))
 					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+					Expect(p.ContainsRetransmission).To(BeTrue())
 				})
 				sent, err := sess.maybeSendRetransmission()
 				Expect(err).NotTo(HaveOccurred())
@@ -1171,11 +1819,10 @@ var _ = Describe("Session", func() {
 					Frames:          []wire.Frame{f},
 					EncryptionLevel: protocol.EncryptionForwardSecure,
 				})
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(42)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
-					Expect(packets).To(HaveLen(1))
-					p := packets[0]
+				sph.EXPECT().DequeuePacketForRetransmission()
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
 					Expect(p.Frames).To(Equal([]wire.Frame{f}))
-					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+					Expect(p.ContainsRetransmission).To(BeTrue())
 				})
 				sent, err := sess.maybeSendRetransmission()
 				Expect(err).NotTo(HaveOccurred())
@@ -1183,11 +1830,36 @@ var _ = Describe("Session", func() {
 				Expect(mconn.written).To(HaveLen(1))
 			})
 
-			It("sends multiple packets, if the retransmission is split", func() {
+			It("bundles the frames of multiple lost packets into one packet", func() {
 				sess.version = versionIETFFrames
 				sess.packer.version = versionIETFFrames
-				f := &wire.StreamFrame{
-					StreamID: 0x5,
+				f1 := &wire.StreamFrame{StreamID: 0x5, Data: []byte("foo")}
+				f2 := &wire.StreamFrame{StreamID: 0x7, Data: []byte("bar")}
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    42,
+					Frames:          []wire.Frame{f1},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    43,
+					Frames:          []wire.Frame{f2},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.Frames).To(Equal([]wire.Frame{f1, f2}))
+				})
+				sent, err := sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Expect(mconn.written).To(HaveLen(1))
+			})
+
+			It("sends the rest of a split STREAM frame in the next packet", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				f := &wire.StreamFrame{
+					StreamID: 0x5,
 					Data:     bytes.Repeat([]byte{'b'}, int(protocol.MaxPacketSizeIPv4)*3/2),
 				}
 				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
@@ -1195,18 +1867,80 @@ var _ = Describe("Session", func() {
 					Frames:          []wire.Frame{f},
 					EncryptionLevel: protocol.EncryptionForwardSecure,
 				})
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(42)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
-					Expect(packets).To(HaveLen(2))
-					for _, p := range packets {
-						Expect(p.Frames).To(HaveLen(1))
-						Expect(p.Frames[0]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
-						Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
-					}
-				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				totalLen := f.DataLen()
+				var dataLen protocol.ByteCount
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.Frames).To(HaveLen(1))
+					Expect(p.Frames[0]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
+					dataLen += p.Frames[0].(*wire.StreamFrame).DataLen()
+				}).Times(2)
 				sent, err := sess.maybeSendRetransmission()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
+				Expect(mconn.written).To(HaveLen(1))
+				// the rest of the STREAM frame is still queued in the packer
+				sent, err = sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
 				Expect(mconn.written).To(HaveLen(2))
+				Expect(dataLen).To(Equal(totalLen))
+			})
+
+			It("doesn't retransmit DATAGRAM frames and superseded window updates", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				receiveWindow := sess.connFlowController.GetReceiveWindow()
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber: 42,
+					Frames: []wire.Frame{
+						&wire.MaxDataFrame{ByteOffset: receiveWindow - 1},
+						&wire.DatagramFrame{Data: []byte("foobar")},
+						&wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}},
+					},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				sent, err := sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeFalse())
+				Expect(mconn.written).To(BeEmpty())
+			})
+
+			It("retransmits window updates that weren't superseded", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				mdf := &wire.MaxDataFrame{ByteOffset: sess.connFlowController.GetReceiveWindow()}
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    42,
+					Frames:          []wire.Frame{mdf},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.Frames).To(Equal([]wire.Frame{mdf}))
+				})
+				sent, err := sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
+			})
+
+			It("traces packets containing retransmissions", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				tracer := &recordingTracer{}
+				sess.tracer = newConnectionTracer(nil, tracer, sess.srcConnID)
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    42,
+					Frames:          []wire.Frame{&wire.PingFrame{}},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				sph.EXPECT().SentPacket(gomock.Any())
+				sent, err := sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Expect(tracer.retransmitted).To(Equal([]PacketNumber{0x1337 + 10}))
 			})
 		})
 	})
@@ -1278,7 +2012,7 @@ var _ = Describe("Session", func() {
 
 	It("closes when crypto stream errors", func() {
 		testErr := errors.New("crypto setup error")
-		streamManager.EXPECT().CloseWithError(qerr.Error(qerr.InternalError, testErr.Error()))
+		streamManager.EXPECT().CloseWithError(qerr.NewInternalError(testErr))
 		cryptoSetup.handleErr = testErr
 		done := make(chan struct{})
 		go func() {
@@ -1302,6 +2036,7 @@ var _ = Describe("Session", func() {
 					header:     hdr,
 					remoteAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
 					data:       []byte("foobar"),
+					rcvTime:    time.Now(),
 				})
 			}
 		}
@@ -1312,6 +2047,7 @@ var _ = Describe("Session", func() {
 			sess.unpacker = unpacker
 			sess.cryptoStreamHandler = &mockCryptoSetup{}
 			streamManager.EXPECT().CloseWithError(gomock.Any()).MaxTimes(1)
+			streamManager.EXPECT().StreamLimits().AnyTimes()
 		})
 
 		It("doesn't immediately send a Public Reset after receiving too many undecryptable packets", func() {
@@ -1346,10 +2082,49 @@ var _ = Describe("Session", func() {
 			Eventually(func() []*receivedPacket { return sess.undecryptablePackets }).Should(HaveLen(protocol.MaxUndecryptablePackets))
 			// check that old packets are kept, and the new packets are dropped
 			Expect(sess.undecryptablePackets[0].header.PacketNumber).To(Equal(protocol.PacketNumber(1)))
+			Expect(sess.Stats().DroppedUndecryptablePackets).To(BeEquivalentTo(1))
 			Expect(sess.Close(nil)).To(Succeed())
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
 
+		It("uses the configured size of the undecryptable packet queue", func() {
+			sess.config.MaxUndecryptablePackets = 3
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			sendUndecryptablePackets()
+			Eventually(func() uint64 { return sess.Stats().DroppedUndecryptablePackets }).Should(BeEquivalentTo(protocol.MaxUndecryptablePackets + 1 - 3))
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			// the run loop stopped, so the queue can be inspected
+			Expect(sess.undecryptablePackets).To(HaveLen(3))
+		})
+
+		It("drops undecryptable packets after the timeout", func() {
+			sess.config.UndecryptablePacketTimeout = scaleDuration(50 * time.Millisecond)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			for i := 1; i <= 3; i++ {
+				sess.handlePacket(&receivedPacket{
+					header:     &wire.Header{PacketNumber: protocol.PacketNumber(i)},
+					remoteAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+					data:       []byte("foobar"),
+					rcvTime:    time.Now(),
+				})
+			}
+			Eventually(func() uint64 { return sess.Stats().DroppedUndecryptablePackets }).Should(BeEquivalentTo(3))
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Expect(sess.undecryptablePackets).To(BeEmpty())
+		})
+
 		It("sends a Public Reset after a timeout", func() {
 			Expect(sess.receivedTooManyUndecrytablePacketsTime).To(BeZero())
 			go func() {
@@ -1452,6 +2227,33 @@ var _ = Describe("Session", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("exposes the peer's transport parameters in the ConnectionState", func() {
+		sess.cryptoStreamHandler = &mockCryptoSetup{connectionState: ConnectionState{ServerName: "quic.clemente.io"}}
+		Expect(sess.ConnectionState().PeerTransportParameters).To(BeNil())
+		streamManager.EXPECT().UpdateLimits(gomock.Any())
+		sess.processTransportParameters(&handshake.TransportParameters{
+			IdleTimeout:                 90 * time.Second,
+			ConnectionFlowControlWindow: 0x5000,
+			MaxBidiStreams:              42,
+			DisableMigration:            true,
+		})
+		state := sess.ConnectionState()
+		Expect(state.ServerName).To(Equal("quic.clemente.io"))
+		Expect(state.PeerTransportParameters).ToNot(BeNil())
+		Expect(state.PeerTransportParameters.IdleTimeout).To(Equal(90 * time.Second))
+		Expect(state.PeerTransportParameters.InitialMaxData).To(BeEquivalentTo(0x5000))
+		Expect(state.PeerTransportParameters.MaxBidiStreams).To(BeEquivalentTo(42))
+		Expect(state.PeerTransportParameters.DisableMigration).To(BeTrue())
+	})
+
+	It("passes the peer's max_ack_delay to the sent packet handler", func() {
+		sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+		sess.sentPacketHandler = sph
+		streamManager.EXPECT().UpdateLimits(gomock.Any())
+		sph.EXPECT().SetMaxAckDelay(42 * time.Millisecond)
+		sess.processTransportParameters(&handshake.TransportParameters{MaxAckDelay: 42 * time.Millisecond})
+	})
+
 	It("process transport parameters received from the peer", func() {
 		paramsChan := make(chan handshake.TransportParameters)
 		sess.paramsChan = paramsChan
@@ -1480,170 +2282,1228 @@ var _ = Describe("Session", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
-	Context("keep-alives", func() {
-		// should be shorter than the local timeout for these tests
-		// otherwise we'd send a CONNECTION_CLOSE in the tests where we're testing that no PING is sent
-		remoteIdleTimeout := 20 * time.Second
+	Context("NEW_TOKEN frames", func() {
+		It("sends a NEW_TOKEN frame when the handshake completes", func() {
+			tokenGen, err := handshake.NewTokenGenerator(time.Now)
+			Expect(err).ToNot(HaveOccurred())
+			sess.tokenGenerator = tokenGen
+			mconn.remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+			sess.handleHandshakeEvent(true)
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+			Expect(sess.packer.controlFrames[0]).To(BeAssignableToTypeOf(&wire.NewTokenFrame{}))
+			token, err := tokenGen.DecodeToken(sess.packer.controlFrames[0].(*wire.NewTokenFrame).Token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(token.IsRetryToken).To(BeFalse())
+			Expect(token.RemoteAddr).To(Equal("192.168.13.37"))
+		})
 
-		BeforeEach(func() {
-			sess.peerParams = &handshake.TransportParameters{IdleTimeout: remoteIdleTimeout}
+		It("doesn't send a NEW_TOKEN frame for gQUIC", func() {
+			sess.handleHandshakeEvent(true)
+			Expect(sess.packer.controlFrames).To(BeEmpty())
 		})
 
-		It("sends a PING", func() {
-			sess.handshakeComplete = true
-			sess.config.KeepAlive = true
-			sess.lastNetworkActivityTime = time.Now().Add(-remoteIdleTimeout / 2)
-			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+		It("rejects NEW_TOKEN frames sent by the client", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.NewTokenFrame{Token: []byte("foobar")}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received a NEW_TOKEN frame from the client")))
+		})
+	})
+
+	Context("DATAGRAM frames", func() {
+		It("errors when sending or receiving messages, if DATAGRAM frames are not enabled", func() {
+			Expect(sess.SendMessage([]byte("foobar"))).To(MatchError(errDatagramsNotEnabled))
+			_, err := sess.ReceiveMessage()
+			Expect(err).To(MatchError(errDatagramsNotEnabled))
+		})
+
+		It("rejects DATAGRAM frames, if DATAGRAM frames are not enabled", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received a DATAGRAM frame, but DATAGRAM frames are not enabled")))
+		})
+
+		It("receives messages", func() {
+			sess.config.EnableDatagrams = true
+			err := sess.handleFrames([]wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := sess.ReceiveMessage()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+		})
+
+		It("rejects DATAGRAM frames that are larger than the advertised maximum size", func() {
+			sess.config.EnableDatagrams = true
+			f := &wire.DatagramFrame{Data: make([]byte, protocol.MaxDatagramFrameSize)}
+			Expect(f.Length(sess.version)).To(BeNumerically(">", protocol.MaxDatagramFrameSize))
+			err := sess.handleFrames([]wire.Frame{f}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received a DATAGRAM frame that's larger than the advertised max_datagram_frame_size")))
+		})
+
+		It("errors when sending a message, if the peer doesn't support DATAGRAM frames", func() {
+			sess.config.EnableDatagrams = true
+			streamManager.EXPECT().UpdateLimits(gomock.Any())
+			sess.processTransportParameters(&handshake.TransportParameters{})
+			Expect(sess.SendMessage([]byte("foobar"))).To(MatchError(errDatagramsNotSupported))
+		})
+
+		It("sends messages", func() {
+			sess.config.EnableDatagrams = true
+			sess.packer.SetDatagramQueue(sess.datagramQueue)
+			streamManager.EXPECT().UpdateLimits(gomock.Any())
+			sess.processTransportParameters(&handshake.TransportParameters{MaxDatagramFrameSize: 500})
+			Expect(sess.datagramQueue.maxFrameSize).To(Equal(protocol.ByteCount(500)))
+			Expect(sess.SendMessage([]byte("foobar"))).To(Succeed())
+			Expect(sess.packer.datagramQueue.Peek()).To(Equal(&wire.DatagramFrame{DataLenPresent: true, Data: []byte("foobar")}))
+		})
+
+		It("unblocks ReceiveMessage when the session is closed", func() {
+			sess.config.EnableDatagrams = true
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				sess.run()
+				_, err := sess.ReceiveMessage()
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(MatchError(qerr.PeerGoingAway))
 				close(done)
 			}()
-			var data []byte
-			Eventually(mconn.written).Should(Receive(&data))
-			// -12 because of the crypto tag. This should be 7 (the frame id for a ping frame).
-			Expect(data[len(data)-12-1 : len(data)-12]).To(Equal([]byte{0x07}))
-			// make the go routine return
-			streamManager.EXPECT().CloseWithError(gomock.Any())
-			sess.Close(nil)
-			Eventually(done).Should(BeClosed())
-		})
-
-		It("doesn't send a PING packet if keep-alive is disabled", func() {
-			sess.handshakeComplete = true
-			sess.config.KeepAlive = false
-			sess.lastNetworkActivityTime = time.Now().Add(-remoteIdleTimeout / 2)
-			done := make(chan struct{})
+			Consistently(done).ShouldNot(BeClosed())
 			go func() {
 				defer GinkgoRecover()
 				sess.run()
-				close(done)
 			}()
-			Consistently(mconn.written).ShouldNot(Receive())
-			// make the go routine return
 			streamManager.EXPECT().CloseWithError(gomock.Any())
-			sess.Close(nil)
+			Expect(sess.Close(nil)).To(Succeed())
 			Eventually(done).Should(BeClosed())
 		})
+	})
 
-		It("doesn't send a PING if the handshake isn't completed yet", func() {
-			sess.handshakeComplete = false
-			sess.config.KeepAlive = true
-			sess.lastNetworkActivityTime = time.Now().Add(-remoteIdleTimeout / 2)
+	It("attaches the connection ID to log messages", func() {
+		l := &recordingLogger{level: LogLevelDebug}
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		pSess, err := newSession(mconn, protocol.Version39, connID, scfg, nil, populateServerConfig(&Config{}), newLogger(&Config{Logger: l}, protocol.PerspectiveServer))
+		Expect(err).ToNot(HaveOccurred())
+		pSess.(*session).logger.Infof("foobar")
+		var fields []LogField
+		for _, m := range l.getMessages() {
+			if m.msg == "foobar" {
+				fields = m.fields
+			}
+		}
+		Expect(fields).To(Equal([]LogField{
+			{Key: LogFieldPerspective, Value: "Server"},
+			{Key: LogFieldConnectionID, Value: connID},
+		}))
+	})
+
+	Context("qlog", func() {
+		var tracer *mocks.MockTracer
+
+		BeforeEach(func() {
+			tracer = mocks.NewMockTracer(mockCtrl)
+			sess.tracer = tracer
+		})
+
+		It("creates a tracer using the GetLogWriter callback, and exports the trace when the session is closed", func() {
+			var connID []byte
+			w := &writeCloser{}
+			mconn.localAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+			conf := populateServerConfig(&Config{
+				GetLogWriter: func(c []byte) io.WriteCloser {
+					connID = c
+					return w
+				},
+			})
+			pSess, err := newSession(mconn, protocol.Version39, protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, scfg, nil, conf, utils.DefaultLogger)
+			Expect(err).ToNot(HaveOccurred())
+			sess = pSess.(*session)
+			Expect(connID).To(Equal([]byte{1, 2, 3, 4, 5, 6, 7, 8}))
+			Expect(sess.tracer).ToNot(BeNil())
+			sess.streamsMap = streamManager
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
 				sess.run()
 				close(done)
 			}()
-			Consistently(mconn.written).ShouldNot(Receive())
-			// make the go routine return
 			streamManager.EXPECT().CloseWithError(gomock.Any())
-			sess.Close(nil)
+			Expect(sess.Close(nil)).To(Succeed())
 			Eventually(done).Should(BeClosed())
+			Expect(w.closed).To(BeTrue())
+			Expect(w.String()).To(ContainSubstring("connection_started"))
+			Expect(w.String()).To(ContainSubstring("connection_closed"))
 		})
-	})
 
-	Context("timeouts", func() {
-		BeforeEach(func() {
-			streamManager.EXPECT().CloseWithError(gomock.Any())
+		It("doesn't create a tracer if GetLogWriter returns nil", func() {
+			conf := populateServerConfig(&Config{
+				GetLogWriter: func([]byte) io.WriteCloser { return nil },
+			})
+			pSess, err := newSession(mconn, protocol.Version39, protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, scfg, nil, conf, utils.DefaultLogger)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pSess.(*session).tracer).To(BeNil())
 		})
 
-		It("times out due to no network activity", func(done Done) {
-			sess.handshakeComplete = true
-			sess.lastNetworkActivityTime = time.Now().Add(-time.Hour)
-			err := sess.run() // Would normally not return
-			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
-			Expect(mconn.written).To(Receive(ContainSubstring("No recent network activity.")))
-			Expect(sess.Context().Done()).To(BeClosed())
-			close(done)
+		It("passes events to the Tracer set in the config", func() {
+			t := &recordingTracer{}
+			conf := populateServerConfig(&Config{Tracer: t})
+			pSess, err := newSession(mconn, protocol.Version39, protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, scfg, nil, conf, utils.DefaultLogger)
+			Expect(err).ToNot(HaveOccurred())
+			sess = pSess.(*session)
+			Expect(sess.tracer).To(BeAssignableToTypeOf(&connectionTracer{}))
+			Expect(sess.tracer.(*connectionTracer).connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+			Expect(sess.tracer.(*connectionTracer).qlog).To(BeNil())
 		})
 
-		It("times out due to non-completed handshake", func(done Done) {
-			sess.sessionCreationTime = time.Now().Add(-protocol.DefaultHandshakeTimeout).Add(-time.Second)
-			err := sess.run() // Would normally not return
-			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.HandshakeTimeout))
-			Expect(mconn.written).To(Receive(ContainSubstring("Crypto handshake did not complete in time.")))
-			Expect(sess.Context().Done()).To(BeClosed())
-			close(done)
+		It("traces packets dropped because the queue is full", func() {
+			for i := 0; i < protocol.MaxSessionUnprocessedPackets; i++ {
+				sess.handlePacket(&receivedPacket{header: &wire.Header{}})
+			}
+			hdr := &wire.Header{PacketNumber: 42, Raw: []byte("raw header")}
+			tracer.EXPECT().DroppedPacket(gomock.Any(), hdr, protocol.ByteCount(16), qlog.PacketDropDOSPrevention)
+			sess.handlePacket(&receivedPacket{header: hdr, data: []byte("foobar")})
 		})
 
-		It("does not use the idle timeout before the handshake complete", func() {
-			sess.config.IdleTimeout = 9999 * time.Second
-			defer sess.Close(nil)
-			sess.lastNetworkActivityTime = time.Now().Add(-time.Minute)
-			// the handshake timeout is irrelevant here, since it depends on the time the session was created,
-			// and not on the last network activity
-			done := make(chan struct{})
-			go func() {
-				defer GinkgoRecover()
-				_ = sess.run()
-				close(done)
-			}()
-			Consistently(done).ShouldNot(BeClosed())
+		It("traces undecryptable packets received after the handshake", func() {
+			sess.handshakeComplete = true
+			hdr := &wire.Header{PacketNumber: 42}
+			tracer.EXPECT().DroppedPacket(gomock.Any(), hdr, protocol.ByteCount(6), qlog.PacketDropPayloadDecryptError)
+			sess.tryQueueingUndecryptablePacket(&receivedPacket{
+				header:     hdr,
+				remoteAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+				data:       []byte("foobar"),
+			})
 		})
 
-		It("closes the session due to the idle timeout after handshake", func() {
-			sess.config.IdleTimeout = 0
-			close(handshakeChan)
-			errChan := make(chan error)
-			go func() {
-				defer GinkgoRecover()
-				errChan <- sess.run() // Would normally not return
-			}()
-			var err error
-			Eventually(errChan).Should(Receive(&err))
-			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
-			Expect(mconn.written).To(Receive(ContainSubstring("No recent network activity.")))
-			Expect(sess.Context().Done()).To(BeClosed())
+		It("traces undecryptable packets dropped after the timeout", func() {
+			hdr := &wire.Header{PacketNumber: 42}
+			sess.undecryptablePackets = []*receivedPacket{{header: hdr, rcvTime: time.Now().Add(-time.Hour)}}
+			tracer.EXPECT().DroppedPacket(gomock.Any(), hdr, protocol.ByteCount(0), qlog.PacketDropKeyUnavailable)
+			sess.dropExpiredUndecryptablePackets(time.Now())
+			Expect(sess.undecryptablePackets).To(BeEmpty())
 		})
-	})
-
-	It("stores up to MaxSessionUnprocessedPackets packets", func(done Done) {
-		// Nothing here should block
-		for i := protocol.PacketNumber(0); i < protocol.MaxSessionUnprocessedPackets+10; i++ {
-			sess.handlePacket(&receivedPacket{})
-		}
-		close(done)
-	}, 0.5)
 
-	Context("getting streams", func() {
-		It("returns a new stream", func() {
-			mstr := NewMockStreamI(mockCtrl)
-			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(11)).Return(mstr, nil)
-			str, err := sess.GetOrOpenStream(11)
+		It("traces received packets", func() {
+			unpacker := NewMockUnpacker(mockCtrl)
+			sess.unpacker = unpacker
+			hdr := &wire.Header{PacketNumber: 5, PacketNumberLen: protocol.PacketNumberLen6, Raw: []byte("raw header")}
+			frames := []wire.Frame{&wire.PingFrame{}}
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				encryptionLevel: protocol.EncryptionForwardSecure,
+				frames:          frames,
+			}, nil)
+			now := time.Now()
+			tracer.EXPECT().ReceivedPacket(now, hdr, protocol.ByteCount(16), protocol.EncryptionForwardSecure, frames)
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, data: []byte("foobar"), rcvTime: now})).To(Succeed())
+		})
+
+		It("traces sent packets", func() {
+			sess.packer.hasSentPacket = true
+			sess.queueControlFrame(&wire.MaxDataFrame{ByteOffset: 0x1337})
+			tracer.EXPECT().SentPacket(gomock.Any(), gomock.Any(), gomock.Any(), protocol.EncryptionUnspecified, gomock.Any()).Do(func(_ time.Time, _ *wire.Header, size protocol.ByteCount, _ protocol.EncryptionLevel, frames []wire.Frame) {
+				Expect(frames).To(Equal([]wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1337}}))
+				Expect(size).ToNot(BeZero())
+			})
+			sent, err := sess.sendPacket()
 			Expect(err).ToNot(HaveOccurred())
-			Expect(str).To(Equal(mstr))
+			Expect(sent).To(BeTrue())
 		})
 
-		It("returns a nil-value (not an interface with value nil) for closed streams", func() {
-			strI := Stream(nil)
-			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(1337)).Return(strI, nil)
-			str, err := sess.GetOrOpenStream(1337)
-			Expect(err).ToNot(HaveOccurred())
-			// make sure that the returned value is a plain nil, not an Stream with value nil
-			_, ok := str.(Stream)
-			Expect(ok).To(BeFalse())
+		It("traces received transport parameters", func() {
+			params := &handshake.TransportParameters{IdleTimeout: time.Minute}
+			streamManager.EXPECT().UpdateLimits(params)
+			tracer.EXPECT().ReceivedTransportParameters(gomock.Any(), params)
+			sess.processTransportParameters(params)
 		})
 
-		It("errors when trying to get a unidirectional stream", func() {
-			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(100)).Return(&sendStream{}, nil)
-			_, err := sess.GetOrOpenStream(100)
-			Expect(err).To(MatchError("Stream 100 is not a bidirectional stream"))
+		It("traces the handshake completion", func() {
+			tracer.EXPECT().CompletedHandshake(gomock.Any())
+			sess.handleHandshakeEvent(true)
 		})
 
-		It("opens streams", func() {
-			mstr := NewMockStreamI(mockCtrl)
-			streamManager.EXPECT().OpenStream().Return(mstr, nil)
-			str, err := sess.OpenStream()
-			Expect(err).ToNot(HaveOccurred())
-			Expect(str).To(Equal(mstr))
+		It("traces opened and closed streams", func() {
+			tracer.EXPECT().UpdatedStreamState(gomock.Any(), protocol.StreamID(5), qlog.StreamStateOpen)
+			sess.newStream(5)
+			streamManager.EXPECT().DeleteStream(protocol.StreamID(5))
+			tracer.EXPECT().UpdatedStreamState(gomock.Any(), protocol.StreamID(5), qlog.StreamStateClosed)
+			sess.onStreamCompleted(5)
 		})
+	})
 
-		It("opens streams synchronously", func() {
+	Context("peer address changes", func() {
+		var (
+			unpacker *MockUnpacker
+			oldAddr  *net.UDPAddr
+		)
+
+		BeforeEach(func() {
+			unpacker = NewMockUnpacker(mockCtrl)
+			sess.unpacker = unpacker
+			sess.version = versionIETFFrames
+			sess.packer.version = versionIETFFrames
+			sess.handshakeComplete = true
+			oldAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1000}
+			mconn.remoteAddr = oldAddr
+		})
+
+		receivePacket := func(pn protocol.PacketNumber, addr net.Addr, frames ...wire.Frame) error {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				encryptionLevel: protocol.EncryptionForwardSecure,
+				frames:          frames,
+			}, nil)
+			return sess.handlePacketImpl(&receivedPacket{
+				remoteAddr: addr,
+				header:     &wire.Header{PacketNumber: pn, PacketNumberLen: protocol.PacketNumberLen6},
+			})
+		}
+
+		It("validates the new address after a NAT rebinding", func() {
+			sess.rttStats.UpdateRTT(time.Second, 0, time.Now())
+			newAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 2000}
+			Expect(receivePacket(10, newAddr, &wire.PingFrame{})).To(Succeed())
+			Expect(mconn.written).To(Receive())
+			Expect(mconn.writtenTo).To(Equal(newAddr))
+			Expect(sess.probe).ToNot(BeNil())
+			Expect(sess.RemoteAddr()).To(Equal(oldAddr))
+			Expect(sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: sess.probe.data}}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.probe).To(BeNil())
+			Expect(sess.RemoteAddr()).To(Equal(newAddr))
+			// only the port changed, so the RTT measurements are still valid
+			Expect(sess.rttStats.SmoothedRTT()).To(Equal(time.Second))
+		})
+
+		It("resets the RTT measurements if the IP address changes", func() {
+			sess.rttStats.UpdateRTT(time.Second, 0, time.Now())
+			newAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+			Expect(receivePacket(10, newAddr, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).ToNot(BeNil())
+			Expect(sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: sess.probe.data}}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.RemoteAddr()).To(Equal(newAddr))
+			Expect(sess.rttStats.SmoothedRTT()).To(BeZero())
+		})
+
+		It("sends PATH_RESPONSEs on the path that the PATH_CHALLENGE was received on, without migrating", func() {
+			newAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+			Expect(receivePacket(10, newAddr, &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})).To(Succeed())
+			Expect(mconn.written).To(Receive())
+			Expect(mconn.writtenTo).To(Equal(newAddr))
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+			Expect(sess.probe).To(BeNil())
+		})
+
+		It("sends PATH_RESPONSEs on the current path, if the PATH_CHALLENGE was received on it", func() {
+			Expect(receivePacket(10, oldAddr, &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})).To(Succeed())
+			Expect(mconn.written).ToNot(Receive())
+			Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}}))
+		})
+
+		It("doesn't validate the address of reordered packets", func() {
+			Expect(receivePacket(10, oldAddr, &wire.PingFrame{})).To(Succeed())
+			Expect(receivePacket(9, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).To(BeNil())
+		})
+
+		It("doesn't validate new addresses before the handshake completed", func() {
+			sess.handshakeComplete = false
+			Expect(receivePacket(10, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).To(BeNil())
+		})
+
+		It("uses a new connection ID when validating a new address, unless it's a NAT rebinding", func() {
+			sess.setupConnIDs(&mockConnIDRunner{})
+			for i := 1; i <= 2; i++ {
+				err := sess.handleFrames([]wire.Frame{&wire.NewConnectionIDFrame{
+					SequenceNumber: uint64(i),
+					ConnectionID:   protocol.ConnectionID{0xde, 0xad, 0xbe, byte(i)},
+				}}, protocol.EncryptionForwardSecure)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			// NAT rebinding
+			Expect(receivePacket(10, &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 2000}, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).ToNot(BeNil())
+			Expect(sess.probe.connID).To(BeNil())
+			sess.abandonPath(errPathValidationTimeout)
+			sess.lastPathValidation = time.Time{}
+			// the IP address changed
+			Expect(receivePacket(11, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).ToNot(BeNil())
+			Expect(sess.probe.connID).ToNot(BeNil())
+			Expect(sess.probe.connID.ConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 1}))
+			Expect(sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: sess.probe.data}}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.destConnID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 1}))
+			Expect(sess.statelessResetToken).To(BeNil())
+		})
+
+		It("doesn't validate new addresses for gQUIC", func() {
+			sess.version = versionGQUICFrames
+			sess.packer.version = versionGQUICFrames
+			Expect(receivePacket(10, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).To(BeNil())
+		})
+
+		It("limits the rate of path validations", func() {
+			sess.lastPathValidation = time.Now().Add(-protocol.MinPathValidationInterval / 2)
+			newAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+			Expect(receivePacket(10, newAddr, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).To(BeNil())
+			sess.lastPathValidation = time.Now().Add(-protocol.MinPathValidationInterval)
+			Expect(receivePacket(11, newAddr, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).ToNot(BeNil())
+		})
+
+		It("doesn't start a path validation while another one is in progress", func() {
+			Expect(receivePacket(10, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}, &wire.PingFrame{})).To(Succeed())
+			probe := sess.probe
+			Expect(probe).ToNot(BeNil())
+			sess.lastPathValidation = time.Time{}
+			Expect(receivePacket(11, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1000}, &wire.PingFrame{})).To(Succeed())
+			Expect(sess.probe).To(Equal(probe))
+		})
+	})
+
+	Context("key updates", func() {
+		It("only supports key updates for IETF QUIC", func() {
+			Expect(sess.UpdateKeys()).To(MatchError("key updates are only supported for IETF QUIC"))
+		})
+
+		It("passes the key update on to the crypto setup", func() {
+			cs := &mockKeyUpdater{mockCryptoSetup: cryptoSetup}
+			sess.cryptoStreamHandler = cs
+			Expect(sess.UpdateKeys()).To(Succeed())
+			Expect(cs.keysUpdated).To(BeTrue())
+		})
+
+		It("returns the error of the crypto setup", func() {
+			sess.cryptoStreamHandler = &mockKeyUpdater{mockCryptoSetup: cryptoSetup, updateErr: errors.New("update failed")}
+			Expect(sess.UpdateKeys()).To(MatchError("update failed"))
+		})
+	})
+
+	Context("exporting keying material", func() {
+		It("only exports keying material for IETF QUIC", func() {
+			_, err := sess.ExportKeyingMaterial("label", nil, 32)
+			Expect(err).To(MatchError("exporting keying material is only supported for IETF QUIC"))
+		})
+
+		It("exports keying material using the crypto setup", func() {
+			cs := &mockKeyingMaterialExporter{mockCryptoSetup: cryptoSetup, key: []byte("keying material")}
+			sess.cryptoStreamHandler = cs
+			key, err := sess.ExportKeyingMaterial("label", []byte("context"), 32)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key).To(Equal([]byte("keying material")))
+			Expect(cs.label).To(Equal("label"))
+			Expect(cs.context).To(Equal([]byte("context")))
+			Expect(cs.length).To(Equal(32))
+		})
+
+		It("returns the error of the crypto setup", func() {
+			sess.cryptoStreamHandler = &mockKeyingMaterialExporter{mockCryptoSetup: cryptoSetup, err: errors.New("export failed")}
+			_, err := sess.ExportKeyingMaterial("label", nil, 32)
+			Expect(err).To(MatchError("export failed"))
+		})
+	})
+
+	Context("connection migration", func() {
+		var (
+			oldPacketConn *mockPacketConn
+			newPacketConn *mockPacketConn
+			listenedOn    chan connection
+		)
+
+		BeforeEach(func() {
+			oldPacketConn = newMockPacketConn()
+			newPacketConn = newMockPacketConn()
+			mconn.pconn = oldPacketConn
+			listenChan := make(chan connection, 1)
+			listenedOn = listenChan
+			sess.listen = func(c connection) { listenChan <- c }
+			sess.perspective = protocol.PerspectiveClient
+			sess.handshakeComplete = true
+		})
+
+		It("only allows IETF QUIC clients to migrate", func() {
+			sess.listen = nil
+			Expect(sess.Migrate(newPacketConn)).To(MatchError("connection migration is only supported by IETF QUIC clients"))
+		})
+
+		It("doesn't migrate before the handshake completed", func() {
+			sess.handshakeComplete = false
+			probe, err := newPathProbe(newPacketConn, mconn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.startPathValidation(probe)).To(Succeed())
+			Expect(probe.result).To(Receive(MatchError("can't migrate before the handshake completed")))
+			Expect(sess.probe).To(BeNil())
+		})
+
+		It("doesn't migrate if the server disabled migration", func() {
+			sess.peerParams = &handshake.TransportParameters{DisableMigration: true}
+			probe, err := newPathProbe(newPacketConn, mconn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.startPathValidation(probe)).To(Succeed())
+			Expect(probe.result).To(Receive(MatchError("the server disabled connection migration")))
+			Expect(sess.probe).To(BeNil())
+		})
+
+		It("sends a PATH_CHALLENGE on the new path, and migrates when receiving the PATH_RESPONSE", func() {
+			sess.rttStats.UpdateRTT(time.Second, 0, time.Now())
+			probe, err := newPathProbe(newPacketConn, mconn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			start := time.Now()
+			Expect(sess.startPathValidation(probe)).To(Succeed())
+			Eventually(listenedOn).Should(Receive(Equal(probe.conn)))
+			Expect(newPacketConn.dataWritten.Len()).ToNot(BeZero())
+			Expect(newPacketConn.dataWrittenTo).To(Equal(mconn.RemoteAddr()))
+			Expect(mconn.written).To(BeEmpty())
+			Expect(probe.deadline).To(BeTemporally("~", start.Add(3*time.Second), scaleDuration(10*time.Millisecond)))
+			// a PATH_RESPONSE with the wrong data is ignored
+			err = sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(probe.result).ToNot(Receive())
+			err = sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: probe.data}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(probe.result).To(Receive(BeNil()))
+			Expect(sess.probe).To(BeNil())
+			Expect(mconn.pconn).To(Equal(newPacketConn))
+			Expect(oldPacketConn.closed).To(BeTrue())
+			Expect(newPacketConn.closed).To(BeFalse())
+			// the RTT of the new path is unknown
+			Expect(sess.rttStats.SmoothedRTT()).To(BeZero())
+		})
+
+		It("doesn't allow multiple path validations at the same time", func() {
+			probe, err := newPathProbe(newPacketConn, mconn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.startPathValidation(probe)).To(Succeed())
+			probe2, err := newPathProbe(newMockPacketConn(), mconn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.startPathValidation(probe2)).To(Succeed())
+			Expect(probe2.result).To(Receive(MatchError("path validation already in progress")))
+			Expect(sess.probe).To(Equal(probe))
+		})
+
+		It("abandons the new path if the validation times out", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			migrated := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				migrated <- sess.Migrate(newPacketConn)
+			}()
+			Eventually(listenedOn).Should(Receive())
+			Eventually(migrated, 2*protocol.MaxPathChallenges*protocol.MinPathChallengeInterval).Should(Receive(Equal(errPathValidationTimeout)))
+			Expect(newPacketConn.closed).To(BeTrue())
+			Expect(oldPacketConn.closed).To(BeFalse())
+			Expect(mconn.pconn).To(Equal(oldPacketConn))
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("abandons the new path when the session is closed", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			migrated := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				migrated <- sess.Migrate(newPacketConn)
+			}()
+			Eventually(listenedOn).Should(Receive())
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Eventually(migrated).Should(Receive(Equal(errSessionClosed)))
+			Expect(newPacketConn.closed).To(BeTrue())
+		})
+
+		It("uses a new connection ID on the new path", func() {
+			sess.version = versionIETFFrames
+			sess.packer.version = versionIETFFrames
+			sess.setupConnIDs(&mockConnIDRunner{})
+			oldConnID := sess.destConnID
+			newConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+			token := protocol.StatelessResetToken{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+			err := sess.handleFrames([]wire.Frame{&wire.NewConnectionIDFrame{
+				SequenceNumber:      1,
+				ConnectionID:        newConnID,
+				StatelessResetToken: token,
+			}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			probe, err := newPathProbe(newPacketConn, mconn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.startPathValidation(probe)).To(Succeed())
+			Eventually(listenedOn).Should(Receive())
+			Expect(probe.connID).ToNot(BeNil())
+			Expect(probe.connID.ConnectionID).To(Equal(newConnID))
+			hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(newPacketConn.dataWritten.Bytes()), newConnID.Len())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.DestConnectionID).To(Equal(newConnID))
+			// the old path still uses the old connection ID
+			Expect(sess.packer.destConnID).To(Equal(oldConnID))
+			err = sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: probe.data}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(probe.result).To(Receive(BeNil()))
+			Expect(sess.destConnID).To(Equal(newConnID))
+			Expect(sess.packer.destConnID).To(Equal(newConnID))
+			Expect(sess.statelessResetToken).To(Equal(&token))
+			Expect(sess.packer.controlFrames).To(ContainElement(&wire.RetireConnectionIDFrame{SequenceNumber: 0}))
+		})
+
+		It("uses the current connection ID on the new path, if the peer didn't issue any unused connection IDs", func() {
+			sess.setupConnIDs(&mockConnIDRunner{})
+			oldConnID := sess.destConnID
+			probe, err := newPathProbe(newPacketConn, mconn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.startPathValidation(probe)).To(Succeed())
+			Expect(probe.connID).To(BeNil())
+			Expect(sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: probe.data}}, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(probe.result).To(Receive(BeNil()))
+			Expect(sess.destConnID).To(Equal(oldConnID))
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+		})
+
+		It("retires the new connection ID if the path is abandoned", func() {
+			sess.setupConnIDs(&mockConnIDRunner{})
+			err := sess.handleFrames([]wire.Frame{&wire.NewConnectionIDFrame{
+				SequenceNumber: 3,
+				ConnectionID:   protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+			}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			probe, err := newPathProbe(newPacketConn, mconn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			sess.useNewConnIDForProbe(probe)
+			sess.probe = probe
+			sess.abandonPath(errPathValidationTimeout)
+			Expect(probe.result).To(Receive(Equal(errPathValidationTimeout)))
+			Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 3}}))
+		})
+	})
+
+	Context("connection IDs", func() {
+		var runner *mockConnIDRunner
+
+		BeforeEach(func() {
+			runner = &mockConnIDRunner{}
+			sess.setupConnIDs(runner)
+		})
+
+		It("issues connection IDs when the handshake completes", func() {
+			sess.handleHandshakeEvent(true)
+			Expect(runner.added).To(HaveLen(protocol.NumIssuedConnectionIDs))
+			Expect(sess.packer.controlFrames).To(HaveLen(protocol.NumIssuedConnectionIDs))
+			for i, f := range sess.packer.controlFrames {
+				Expect(f).To(BeAssignableToTypeOf(&wire.NewConnectionIDFrame{}))
+				frame := f.(*wire.NewConnectionIDFrame)
+				Expect(frame.SequenceNumber).To(Equal(uint64(i + 1)))
+				Expect(frame.ConnectionID).To(Equal(runner.added[i]))
+				Expect(frame.ConnectionID.Len()).To(Equal(sess.srcConnID.Len()))
+			}
+		})
+
+		It("retires connection IDs, and issues new ones", func() {
+			sess.handleHandshakeEvent(true)
+			sess.packer.controlFrames = nil
+			err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 2}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(runner.retired).To(Equal([]protocol.ConnectionID{runner.added[1]}))
+			Expect(runner.added).To(HaveLen(protocol.NumIssuedConnectionIDs + 1))
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+			Expect(sess.packer.controlFrames[0].(*wire.NewConnectionIDFrame).SequenceNumber).To(Equal(uint64(protocol.NumIssuedConnectionIDs + 1)))
+		})
+
+		It("errors when the peer retires a connection ID that wasn't issued", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "tried to retire connection ID 1, highest issued: 0")))
+		})
+
+		It("saves connection IDs issued by the peer", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.NewConnectionIDFrame{
+				SequenceNumber: 1,
+				ConnectionID:   protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+			}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			c, ok := sess.connIDManager.Next()
+			Expect(ok).To(BeTrue())
+			Expect(c.ConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
+		})
+
+		It("removes all connection IDs when the session is closed", func() {
+			sess.handleHandshakeEvent(true)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Expect(runner.retired).To(HaveLen(protocol.NumIssuedConnectionIDs + 1))
+			Expect(runner.retired).To(ContainElement(sess.srcConnID))
+		})
+	})
+
+	Context("keep-alives", func() {
+		// should be shorter than the local timeout for these tests
+		// otherwise we'd send a CONNECTION_CLOSE in the tests where we're testing that no PING is sent
+		remoteIdleTimeout := 20 * time.Second
+
+		BeforeEach(func() {
+			sess.peerParams = &handshake.TransportParameters{IdleTimeout: remoteIdleTimeout}
+		})
+
+		It("sends a PING", func() {
+			sess.handshakeComplete = true
+			sess.config.KeepAlive = true
+			sess.lastNetworkActivityTime = time.Now().Add(-remoteIdleTimeout / 2)
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			var data []byte
+			Eventually(mconn.written).Should(Receive(&data))
+			// -12 because of the crypto tag. This should be 7 (the frame id for a ping frame).
+			Expect(data[len(data)-12-1 : len(data)-12]).To(Equal([]byte{0x07}))
+			// make the go routine return
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("sends a PING after the KeepAlivePeriod", func() {
+			sess.handshakeComplete = true
+			sess.config.KeepAlive = true
+			sess.config.KeepAlivePeriod = time.Second
+			sess.lastNetworkActivityTime = time.Now().Add(-time.Second)
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			var data []byte
+			Eventually(mconn.written).Should(Receive(&data))
+			// -12 because of the crypto tag. This should be 7 (the frame id for a ping frame).
+			Expect(data[len(data)-12-1 : len(data)-12]).To(Equal([]byte{0x07}))
+			// make the go routine return
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("uses half the negotiated idle timeout as the keep-alive period", func() {
+			sess.config.IdleTimeout = time.Hour
+			Expect(sess.keepAlivePeriod()).To(Equal(remoteIdleTimeout / 2))
+			sess.config.IdleTimeout = 10 * time.Second
+			Expect(sess.keepAlivePeriod()).To(Equal(5 * time.Second))
+		})
+
+		It("caps the KeepAlivePeriod at half the negotiated idle timeout", func() {
+			sess.config.IdleTimeout = time.Hour
+			sess.config.KeepAlivePeriod = 3 * time.Second
+			Expect(sess.keepAlivePeriod()).To(Equal(3 * time.Second))
+			sess.config.KeepAlivePeriod = time.Hour
+			Expect(sess.keepAlivePeriod()).To(Equal(remoteIdleTimeout / 2))
+		})
+
+		It("doesn't send a PING packet if keep-alive is disabled", func() {
+			sess.handshakeComplete = true
+			sess.config.KeepAlive = false
+			sess.lastNetworkActivityTime = time.Now().Add(-remoteIdleTimeout / 2)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			Consistently(mconn.written).ShouldNot(Receive())
+			// make the go routine return
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't send a PING if the handshake isn't completed yet", func() {
+			sess.handshakeComplete = false
+			sess.config.KeepAlive = true
+			sess.lastNetworkActivityTime = time.Now().Add(-remoteIdleTimeout / 2)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			Consistently(mconn.written).ShouldNot(Receive())
+			// make the go routine return
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("timeouts", func() {
+		BeforeEach(func() {
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+		})
+
+		It("times out due to no network activity", func(done Done) {
+			sess.handshakeComplete = true
+			sess.lastNetworkActivityTime = time.Now().Add(-time.Hour)
+			err := sess.run() // Would normally not return
+			Expect(err).To(BeAssignableToTypeOf(&qerr.IdleTimeoutError{}))
+			Expect(mconn.written).To(Receive(ContainSubstring("No recent network activity.")))
+			Expect(sess.Context().Done()).To(BeClosed())
+			close(done)
+		})
+
+		It("times out due to non-completed handshake", func(done Done) {
+			sess.sessionCreationTime = time.Now().Add(-protocol.DefaultHandshakeTimeout).Add(-time.Second)
+			err := sess.run() // Would normally not return
+			Expect(err).To(BeAssignableToTypeOf(&qerr.HandshakeTimeoutError{}))
+			Expect(mconn.written).To(Receive(ContainSubstring("Crypto handshake did not complete in time.")))
+			Expect(sess.Context().Done()).To(BeClosed())
+			close(done)
+		})
+
+		It("closes the session when too many packets are received before the handshake completes", func(done Done) {
+			unpacker := NewMockUnpacker(mockCtrl)
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, qerr.Error(qerr.DecryptionFailure, "")).Times(3)
+			sess.unpacker = unpacker
+			sess.config.MaxHandshakePackets = 3
+			for i := 1; i <= 4; i++ {
+				sess.handlePacket(&receivedPacket{
+					header:     &wire.Header{PacketNumber: protocol.PacketNumber(i)},
+					remoteAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+					data:       []byte("foobar"),
+				})
+			}
+			err := sess.run() // Would normally not return
+			Expect(err).To(MatchError(qerr.HandshakeFailed))
+			Expect(mconn.written).To(Receive(ContainSubstring("Too many packets received before completing the handshake.")))
+			Expect(sess.Context().Done()).To(BeClosed())
+			close(done)
+		})
+
+		It("doesn't count packets received after the handshake completed", func() {
+			sess.config.MaxHandshakePackets = 1
+			sess.handshakeComplete = true
+			unpacker := NewMockUnpacker(mockCtrl)
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil).Times(3)
+			sess.unpacker = unpacker
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
+			rph.EXPECT().GetAlarmTimeout().AnyTimes()
+			rph.EXPECT().GetAckFrame().AnyTimes()
+			sess.receivedPacketHandler = rph
+			for i := 1; i <= 3; i++ {
+				sess.handlePacket(&receivedPacket{header: &wire.Header{
+					PacketNumber: protocol.PacketNumber(i),
+					Raw:          *getPacketBuffer(),
+				}})
+			}
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_ = sess.run()
+				close(done)
+			}()
+			Eventually(sess.receivedPackets).Should(BeEmpty())
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("does not use the idle timeout before the handshake complete", func() {
+			sess.config.IdleTimeout = 9999 * time.Second
+			defer sess.Close(nil)
+			sess.lastNetworkActivityTime = time.Now().Add(-time.Minute)
+			// the handshake timeout is irrelevant here, since it depends on the time the session was created,
+			// and not on the last network activity
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_ = sess.run()
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+		})
+
+		It("closes the session due to the idle timeout after handshake", func() {
+			sess.config.IdleTimeout = 0
+			close(handshakeChan)
+			errChan := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				errChan <- sess.run() // Would normally not return
+			}()
+			var err error
+			Eventually(errChan).Should(Receive(&err))
+			Expect(err).To(BeAssignableToTypeOf(&qerr.IdleTimeoutError{}))
+			Expect(mconn.written).To(Receive(ContainSubstring("No recent network activity.")))
+			Expect(sess.Context().Done()).To(BeClosed())
+		})
+	})
+
+	Context("running on an event loop", func() {
+		var loop *eventLoop
+
+		BeforeEach(func() {
+			loop = newEventLoop()
+		})
+
+		AfterEach(func() {
+			loop.close()
+		})
+
+		It("runs on the event loop once the handshake completed", func() {
+			sess.handshakeComplete = true
+			sess.peerParams = &handshake.TransportParameters{IdleTimeout: 20 * time.Second}
+			sess.config.KeepAlive = true
+			sess.lastNetworkActivityTime = time.Now().Add(-10 * time.Second)
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			closed := make(chan struct{})
+			sess.runOnEventLoop(loop, func() { close(closed) })
+			Expect(sess.timer).To(BeAssignableToTypeOf(&wheelTimer{}))
+			var data []byte
+			Eventually(mconn.written).Should(Receive(&data))
+			// -12 because of the crypto tag. This should be 7 (the frame id for a ping frame).
+			Expect(data[len(data)-12-1 : len(data)-12]).To(Equal([]byte{0x07}))
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(closed).Should(BeClosed())
+			Expect(sess.Context().Done()).To(BeClosed())
+		})
+
+		It("times out on the event loop", func() {
+			sess.handshakeComplete = true
+			sess.config.IdleTimeout = 50 * time.Millisecond
+			sess.lastNetworkActivityTime = time.Now()
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			closed := make(chan struct{})
+			sess.runOnEventLoop(loop, func() { close(closed) })
+			Eventually(closed).Should(BeClosed())
+			Expect(time.Since(sess.lastNetworkActivityTime)).To(BeNumerically(">=", 50*time.Millisecond))
+			Expect(sess.Context().Err()).To(MatchError(context.Canceled))
+			Expect(sess.closeErr.err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
+		})
+
+		It("doesn't run on the event loop if the session is closed during the handshake", func() {
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			closed := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.runOnEventLoop(loop, func() { close(closed) })
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Expect(closed).To(BeClosed())
+			Expect(sess.eventLoopEntry.Load()).To(BeNil())
+		})
+	})
+
+	It("stores up to MaxSessionUnprocessedPackets packets", func(done Done) {
+		// Nothing here should block
+		for i := protocol.PacketNumber(0); i < protocol.MaxSessionUnprocessedPackets+10; i++ {
+			sess.handlePacket(&receivedPacket{})
+		}
+		close(done)
+	}, 0.5)
+
+	Context("queue statistics", func() {
+		BeforeEach(func() {
+			streamManager.EXPECT().StreamLimits().AnyTimes()
+		})
+
+		It("reports the number of queued packets and the high-water mark", func() {
+			for i := 0; i < 10; i++ {
+				sess.handlePacket(&receivedPacket{})
+			}
+			stats := sess.Stats()
+			Expect(stats.QueuedPackets).To(Equal(10))
+			Expect(stats.MaxQueuedPackets).To(Equal(10))
+			Expect(stats.DroppedPackets).To(BeZero())
+		})
+
+		It("counts packets dropped because the queue was full", func() {
+			for i := 0; i < protocol.MaxSessionUnprocessedPackets+3; i++ {
+				sess.handlePacket(&receivedPacket{})
+			}
+			stats := sess.Stats()
+			Expect(stats.QueuedPackets).To(Equal(protocol.MaxSessionUnprocessedPackets))
+			Expect(stats.MaxQueuedPackets).To(Equal(protocol.MaxSessionUnprocessedPackets))
+			Expect(stats.DroppedPackets).To(BeEquivalentTo(3))
+		})
+
+		It("keeps the high-water mark when the queue is drained", func() {
+			for i := 0; i < 5; i++ {
+				sess.handlePacket(&receivedPacket{})
+			}
+			// drain the queue, as the run loop would
+			for i := 0; i < 5; i++ {
+				<-sess.receivedPackets
+			}
+			stats := sess.Stats()
+			Expect(stats.QueuedPackets).To(BeZero())
+			Expect(stats.MaxQueuedPackets).To(Equal(5))
+		})
+
+		It("reports the goodput", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetGoodput(gomock.Any()).Return(1337 * congestion.BytesPerSecond)
+			sph.EXPECT().GetStats()
+			sess.sentPacketHandler = sph
+			Expect(sess.Stats().Goodput).To(BeEquivalentTo(1337))
+		})
+
+		It("reports the RTT, the congestion control state, and the lost and retransmitted packets", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetGoodput(gomock.Any())
+			sph.EXPECT().GetStats().Return(ackhandler.Stats{
+				SmoothedRTT:          100 * time.Millisecond,
+				RTTVariance:          10 * time.Millisecond,
+				CongestionWindow:     12345,
+				BytesInFlight:        1234,
+				PacketsLost:          5,
+				PacketsRetransmitted: 4,
+			})
+			sess.sentPacketHandler = sph
+			stats := sess.Stats()
+			Expect(stats.SmoothedRTT).To(Equal(100 * time.Millisecond))
+			Expect(stats.RTTVariance).To(Equal(10 * time.Millisecond))
+			Expect(stats.CongestionWindow).To(Equal(protocol.ByteCount(12345)))
+			Expect(stats.BytesInFlight).To(Equal(protocol.ByteCount(1234)))
+			Expect(stats.PacketsLost).To(BeEquivalentTo(5))
+			Expect(stats.PacketsRetransmitted).To(BeEquivalentTo(4))
+		})
+
+		It("reports the anti-amplification budget", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetGoodput(gomock.Any())
+			sph.EXPECT().GetStats().Return(ackhandler.Stats{
+				AmplificationLimited: true,
+				AmplificationBudget:  2345,
+			})
+			sess.sentPacketHandler = sph
+			stats := sess.Stats()
+			Expect(stats.AmplificationLimited).To(BeTrue())
+			Expect(stats.AmplificationBudget).To(Equal(protocol.ByteCount(2345)))
+		})
+
+		It("reports the RTT and the bandwidth estimate", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetStats().Return(ackhandler.Stats{
+				LatestRTT:         90 * time.Millisecond,
+				SmoothedRTT:       100 * time.Millisecond,
+				MinRTT:            80 * time.Millisecond,
+				BandwidthEstimate: 1000 * congestion.BytesPerSecond,
+			}).Times(2)
+			sess.sentPacketHandler = sph
+			latest, smoothed, min := sess.RTT()
+			Expect(latest).To(Equal(90 * time.Millisecond))
+			Expect(smoothed).To(Equal(100 * time.Millisecond))
+			Expect(min).To(Equal(80 * time.Millisecond))
+			Expect(sess.BandwidthEstimate()).To(BeEquivalentTo(1000))
+		})
+
+		It("counts the packets and bytes sent", func() {
+			sess.packer.hasSentPacket = true
+			for i := 0; i < 2; i++ {
+				sess.queueControlFrame(&wire.MaxDataFrame{ByteOffset: protocol.ByteCount(i + 1)})
+				sent, err := sess.sendPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sent).To(BeTrue())
+			}
+			Expect(mconn.written).To(HaveLen(2))
+			var size int
+			for i := 0; i < 2; i++ {
+				size += len(<-mconn.written)
+			}
+			stats := sess.Stats()
+			Expect(stats.PacketsSent).To(BeEquivalentTo(2))
+			Expect(stats.BytesSent).To(BeEquivalentTo(size))
+			Expect(stats.PacketsReceived).To(BeZero())
+		})
+
+		It("counts the packets and bytes received, if they can be decrypted", func() {
+			unpacker := NewMockUnpacker(mockCtrl)
+			sess.unpacker = unpacker
+			hdr := &wire.Header{PacketNumberLen: protocol.PacketNumberLen6, PacketNumber: 5, Raw: []byte("raw header")}
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, data: []byte("foobar")})).To(Succeed())
+			testErr := errors.New("decryption failed")
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, testErr)
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, data: []byte("foobar")})).To(MatchError(testErr))
+			stats := sess.Stats()
+			Expect(stats.PacketsReceived).To(BeEquivalentTo(1))
+			Expect(stats.BytesReceived).To(BeEquivalentTo(len("raw header") + len("foobar")))
+		})
+
+		It("reports the handshake duration", func() {
+			Expect(sess.Stats().HandshakeDuration).To(BeZero())
+			sess.sessionCreationTime = time.Now().Add(-time.Second)
+			sess.handleHandshakeEvent(true)
+			Expect(sess.Stats().HandshakeDuration).To(BeNumerically("~", time.Second, 100*time.Millisecond))
+		})
+
+		It("counts the frames received", func() {
+			str := NewMockReceiveStreamI(mockCtrl)
+			streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(5)).Return(str, nil).Times(3)
+			str.EXPECT().handleStreamFrame(gomock.Any()).Times(2)
+			str.EXPECT().handleRstStreamFrame(gomock.Any())
+			err := sess.handleFrames([]wire.Frame{
+				&wire.StreamFrame{StreamID: 5, Data: []byte("foo")},
+				&wire.StreamFrame{StreamID: 5, Data: []byte("bar"), Offset: 3},
+				&wire.RstStreamFrame{StreamID: 5, ByteOffset: 6},
+				&wire.PingFrame{},
+			}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			stats := sess.Stats()
+			Expect(stats.FramesReceived).To(Equal(map[string]uint64{
+				"STREAM":     2,
+				"RST_STREAM": 1,
+				"PING":       1,
+			}))
+			Expect(stats.FramesSent).To(BeEmpty())
+		})
+
+		It("counts the frames sent", func() {
+			sess.packer.hasSentPacket = true
+			err := sess.receivedPacketHandler.ReceivedPacket(0x1337, protocol.ECNNon, time.Now(), true)
+			Expect(err).ToNot(HaveOccurred())
+			sess.queueControlFrame(&wire.RstStreamFrame{StreamID: 5, ByteOffset: 6})
+			sent, err := sess.sendPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sent).To(BeTrue())
+			Expect(mconn.written).To(HaveLen(1))
+			stats := sess.Stats()
+			Expect(stats.FramesSent).To(HaveKeyWithValue("ACK", uint64(1)))
+			Expect(stats.FramesSent).To(HaveKeyWithValue("RST_STREAM", uint64(1)))
+		})
+
+		It("reports the next packet number", func() {
+			sess.packer.hasSentPacket = true
+			next := sess.Stats().NextPacketNumber
+			Expect(next).To(BeEquivalentTo(sess.packer.packetNumberGenerator.Peek()))
+			for i := 0; i < 3; i++ {
+				sess.queueControlFrame(&wire.MaxDataFrame{ByteOffset: protocol.ByteCount(i + 1)})
+				sent, err := sess.sendPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Expect(sess.Stats().NextPacketNumber).To(BeNumerically(">", next))
+				next = sess.Stats().NextPacketNumber
+				Expect(next).To(BeEquivalentTo(sess.packer.packetNumberGenerator.Peek()))
+			}
+			Expect(mconn.written).To(HaveLen(3))
+		})
+
+		It("doesn't modify the frame counters when the stats are modified", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.PingFrame{}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			sess.Stats().FramesReceived["PING"] = 42
+			Expect(sess.Stats().FramesReceived).To(HaveKeyWithValue("PING", uint64(1)))
+		})
+	})
+
+	It("reports congestion events", func() {
+		var events []CongestionEvent
+		conf := populateServerConfig(&Config{
+			OnCongestionEvent: func(e CongestionEvent) { events = append(events, e) },
+		})
+		pSess, err := newSession(mconn, protocol.Version39, protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}, scfg, nil, conf, utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		sph := pSess.(*session).sentPacketHandler
+		for i := 1; i <= 5; i++ {
+			sph.SentPacket(&ackhandler.Packet{
+				PacketNumber:    protocol.PacketNumber(i),
+				Frames:          []wire.Frame{&wire.PingFrame{}},
+				Length:          1000,
+				EncryptionLevel: protocol.EncryptionForwardSecure,
+				SendTime:        time.Now(),
+			})
+		}
+		// ack packet 5, so that packet 1 is declared lost
+		err = sph.ReceivedAck(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 5}}}, 1, protocol.EncryptionForwardSecure, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].State).To(Equal(CongestionStateRecovery))
+		Expect(events[0].CongestionWindow).To(BeNumerically("<", protocol.InitialCongestionWindow*protocol.DefaultTCPMSS))
+	})
+
+	It("uses the congestion controller returned by the CongestionControllerFactory", func() {
+		cong := mocks.NewMockSendAlgorithm(mockCtrl)
+		var rttStats RTTStats
+		conf := populateServerConfig(&Config{
+			CongestionControllerFactory: func(r RTTStats) CongestionController {
+				rttStats = r
+				return cong
+			},
+		})
+		pSess, err := newSession(mconn, protocol.Version39, protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}, scfg, nil, conf, utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rttStats).To(Equal(pSess.(*session).rttStats))
+		cong.EXPECT().OnPacketSent(gomock.Any(), protocol.ByteCount(1000), protocol.PacketNumber(1), protocol.ByteCount(1000), true)
+		cong.EXPECT().TimeUntilSend(protocol.ByteCount(1000))
+		pSess.(*session).sentPacketHandler.SentPacket(&ackhandler.Packet{
+			PacketNumber:    1,
+			Frames:          []wire.Frame{&wire.PingFrame{}},
+			Length:          1000,
+			EncryptionLevel: protocol.EncryptionForwardSecure,
+			SendTime:        time.Now(),
+		})
+	})
+
+	It("uses the BBR congestion controller", func() {
+		Expect(sess.newCongestionController()).To(BeNil())
+		sess.config.CongestionControl = CongestionBBR
+		Expect(sess.newCongestionController()).To(BeAssignableToTypeOf(congestion.NewBBRSender(nil, nil, 0, 0)))
+	})
+
+	Context("getting streams", func() {
+		It("returns a new stream", func() {
+			mstr := NewMockStreamI(mockCtrl)
+			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(11)).Return(mstr, nil)
+			str, err := sess.GetOrOpenStream(11)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str).To(Equal(mstr))
+		})
+
+		It("returns a nil-value (not an interface with value nil) for closed streams", func() {
+			strI := Stream(nil)
+			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(1337)).Return(strI, nil)
+			str, err := sess.GetOrOpenStream(1337)
+			Expect(err).ToNot(HaveOccurred())
+			// make sure that the returned value is a plain nil, not an Stream with value nil
+			_, ok := str.(Stream)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("errors when trying to get a unidirectional stream", func() {
+			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(100)).Return(&sendStream{}, nil)
+			_, err := sess.GetOrOpenStream(100)
+			Expect(err).To(MatchError("Stream 100 is not a bidirectional stream"))
+		})
+
+		It("opens streams", func() {
+			mstr := NewMockStreamI(mockCtrl)
+			streamManager.EXPECT().OpenStream().Return(mstr, nil)
+			str, err := sess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str).To(Equal(mstr))
+		})
+
+		It("opens streams synchronously", func() {
 			mstr := NewMockStreamI(mockCtrl)
-			streamManager.EXPECT().OpenStreamSync().Return(mstr, nil)
+			streamManager.EXPECT().OpenStreamSync(context.Background()).Return(mstr, nil)
 			str, err := sess.OpenStreamSync()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
@@ -1659,7 +3519,7 @@ var _ = Describe("Session", func() {
 
 		It("opens unidirectional streams synchronously", func() {
 			mstr := NewMockSendStreamI(mockCtrl)
-			streamManager.EXPECT().OpenUniStreamSync().Return(mstr, nil)
+			streamManager.EXPECT().OpenUniStreamSync(context.Background()).Return(mstr, nil)
 			str, err := sess.OpenUniStreamSync()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
@@ -1667,7 +3527,7 @@ var _ = Describe("Session", func() {
 
 		It("accepts streams", func() {
 			mstr := NewMockStreamI(mockCtrl)
-			streamManager.EXPECT().AcceptStream().Return(mstr, nil)
+			streamManager.EXPECT().AcceptStream(context.Background()).Return(mstr, nil)
 			str, err := sess.AcceptStream()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
@@ -1675,11 +3535,35 @@ var _ = Describe("Session", func() {
 
 		It("accepts unidirectional streams", func() {
 			mstr := NewMockReceiveStreamI(mockCtrl)
-			streamManager.EXPECT().AcceptUniStream().Return(mstr, nil)
+			streamManager.EXPECT().AcceptUniStream(context.Background()).Return(mstr, nil)
 			str, err := sess.AcceptUniStream()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
 		})
+
+		It("passes the context to the stream manager", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mstr := NewMockStreamI(mockCtrl)
+			msendStr := NewMockSendStreamI(mockCtrl)
+			mreceiveStr := NewMockReceiveStreamI(mockCtrl)
+			streamManager.EXPECT().OpenStreamSync(ctx).Return(mstr, nil)
+			streamManager.EXPECT().OpenUniStreamSync(ctx).Return(msendStr, nil)
+			streamManager.EXPECT().AcceptStream(ctx).Return(mstr, nil)
+			streamManager.EXPECT().AcceptUniStream(ctx).Return(mreceiveStr, nil)
+			str, err := sess.OpenStreamSyncContext(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str).To(Equal(mstr))
+			sendStr, err := sess.OpenUniStreamSyncContext(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sendStr).To(Equal(msendStr))
+			str, err = sess.AcceptStreamContext(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str).To(Equal(mstr))
+			receiveStr, err := sess.AcceptUniStreamContext(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(receiveStr).To(Equal(mreceiveStr))
+		})
 	})
 
 	It("returns the local address", func() {
@@ -1714,6 +3598,7 @@ var _ = Describe("Client Session", func() {
 			_ protocol.ConnectionID,
 			_ protocol.VersionNumber,
 			_ *tls.Config,
+			_ handshake.ClientSessionCache,
 			_ *handshake.TransportParameters,
 			_ chan<- handshake.TransportParameters,
 			handshakeChanP chan<- struct{},
@@ -1745,6 +3630,19 @@ var _ = Describe("Client Session", func() {
 		newCryptoSetupClient = handshake.NewCryptoSetupClient
 	})
 
+	It("saves tokens received in NEW_TOKEN frames", func() {
+		sess.config.TokenStore = NewLRUTokenStore(1)
+		sess.tokenStoreKey = "hostname"
+		err := sess.handleFrames([]wire.Frame{&wire.NewTokenFrame{Token: []byte("foobar")}}, protocol.EncryptionForwardSecure)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess.config.TokenStore.Pop("hostname")).To(Equal([]byte("foobar")))
+	})
+
+	It("ignores NEW_TOKEN frames if no TokenStore is configured", func() {
+		err := sess.handleFrames([]wire.Frame{&wire.NewTokenFrame{Token: []byte("foobar")}}, protocol.EncryptionForwardSecure)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
 	It("sends a forward-secure packet when the handshake completes", func() {
 		sess.packer.hasSentPacket = true
 		done := make(chan struct{})
@@ -1761,6 +3659,93 @@ var _ = Describe("Client Session", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	Context("early sessions", func() {
+		var done chan struct{}
+
+		runSession := func() {
+			done = make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+		}
+
+		AfterEach(func() {
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("is ready as soon as data can be sent using 0-RTT", func() {
+			cryptoSetup.encLevelSeal = protocol.EncryptionSecure
+			runSession()
+			handshakeChan <- struct{}{}
+			Eventually(sess.earlySessionReadyStatus()).Should(BeClosed())
+		})
+
+		It("isn't ready before the keys for sending data are available", func() {
+			cryptoSetup.encLevelSeal = protocol.EncryptionUnencrypted
+			runSession()
+			handshakeChan <- struct{}{}
+			Consistently(sess.earlySessionReadyStatus()).ShouldNot(BeClosed())
+		})
+
+		It("is ready when the handshake completes", func() {
+			runSession()
+			Consistently(sess.HandshakeComplete().Done()).ShouldNot(BeClosed())
+			close(handshakeChan)
+			Eventually(sess.HandshakeComplete().Done()).Should(BeClosed())
+			Expect(sess.earlySessionReadyStatus()).To(BeClosed())
+			Expect(sess.Context().Done()).ToNot(BeClosed())
+		})
+
+		It("cancels the HandshakeComplete context, if the session is closed before the handshake completes", func() {
+			runSession()
+			sess.closeLocal(errors.New("handshake failed"))
+			Eventually(sess.HandshakeComplete().Done()).Should(BeClosed())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+	})
+
+	Context("stateless resets", func() {
+		token := protocol.StatelessResetToken{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}
+
+		getStatelessReset := func(token protocol.StatelessResetToken) []byte {
+			b, err := wire.WriteStatelessReset(token)
+			Expect(err).ToNot(HaveOccurred())
+			return b
+		}
+
+		It("closes the session when it receives a stateless reset", func() {
+			sess.processTransportParameters(&handshake.TransportParameters{StatelessResetToken: &token})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := sess.run()
+				Expect(err).To(MatchError(StatelessResetError{Token: token}))
+				close(done)
+			}()
+			Expect(sess.handleStatelessReset(getStatelessReset(token))).To(BeTrue())
+			Eventually(done).Should(BeClosed())
+			Expect(mconn.written).ToNot(Receive()) // no CONNECTION_CLOSE is sent
+		})
+
+		It("ignores packets that don't end with the stateless reset token", func() {
+			sess.processTransportParameters(&handshake.TransportParameters{StatelessResetToken: &token})
+			Expect(sess.handleStatelessReset(getStatelessReset(protocol.StatelessResetToken{1, 2, 3, 4}))).To(BeFalse())
+			Expect(sess.Context().Done()).ToNot(BeClosed())
+		})
+
+		It("ignores packets that are too small to be a stateless reset", func() {
+			sess.processTransportParameters(&handshake.TransportParameters{StatelessResetToken: &token})
+			Expect(sess.handleStatelessReset(token[:])).To(BeFalse())
+		})
+
+		It("ignores stateless resets before the server sent the token", func() {
+			Expect(sess.handleStatelessReset(getStatelessReset(token))).To(BeFalse())
+		})
+	})
+
 	Context("receiving packets", func() {
 		var hdr *wire.Header
 
@@ -0,0 +1,9 @@
+//go:build go1.26
+// +build go1.26
+
+package quic
+
+import "crypto/tls"
+
+// quicErrorEvent is the event crypto/tls uses to report errors
+const quicErrorEvent = tls.QUICErrorEvent
@@ -0,0 +1,10 @@
+//go:build !go1.26
+// +build !go1.26
+
+package quic
+
+import "crypto/tls"
+
+// Before Go 1.26, crypto/tls only returns errors from the QUICConn's methods.
+// This value is never used for an event.
+const quicErrorEvent tls.QUICEventKind = -1
@@ -0,0 +1,16 @@
+//go:build go1.27
+// +build go1.27
+
+package quic
+
+import (
+	"crypto/tls"
+
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+)
+
+// newQUICConfig creates the configuration for the QUIC connection of crypto/tls.
+// The crypto stream is passed to the tls.Config's callbacks as the ClientHelloInfo.Conn.
+func newQUICConfig(tlsConf *tls.Config, csc *handshake.CryptoStreamConn) *tls.QUICConfig {
+	return &tls.QUICConfig{TLSConfig: tlsConf, ClientHelloInfoConn: csc}
+}
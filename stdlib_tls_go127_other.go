@@ -0,0 +1,16 @@
+//go:build !go1.27
+// +build !go1.27
+
+package quic
+
+import (
+	"crypto/tls"
+
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+)
+
+// newQUICConfig creates the configuration for the QUIC connection of crypto/tls.
+// Before Go 1.27, the ClientHelloInfo.Conn can't be set for QUIC connections.
+func newQUICConfig(tlsConf *tls.Config, _ *handshake.CryptoStreamConn) *tls.QUICConfig {
+	return &tls.QUICConfig{TLSConfig: tlsConf}
+}
@@ -0,0 +1,311 @@
+package quic
+
+import (
+	"context"
+	gocrypto "crypto"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// the maximum length of a handshake message we accept from the peer
+const maxHandshakeMessageLen = 1 << 18
+
+// The 1-RTT keys are always derived for AES-GCM (see crypto.DeriveAESKeys),
+// using the hash function of the negotiated cipher suite.
+var stdlibCipherSuites = map[uint16]mint.CipherSuiteParams{
+	tls.TLS_AES_128_GCM_SHA256: {
+		Suite:  mint.TLS_AES_128_GCM_SHA256,
+		Hash:   gocrypto.SHA256,
+		KeyLen: 16,
+		IvLen:  12,
+	},
+	tls.TLS_AES_256_GCM_SHA384: {
+		Suite:  mint.TLS_AES_256_GCM_SHA384,
+		Hash:   gocrypto.SHA384,
+		KeyLen: 32,
+		IvLen:  12,
+	},
+	tls.TLS_CHACHA20_POLY1305_SHA256: {
+		Suite:  mint.TLS_CHACHA20_POLY1305_SHA256,
+		Hash:   gocrypto.SHA256,
+		KeyLen: 32,
+		IvLen:  12,
+	},
+}
+
+// The stdlibTLSController runs the handshake using the TLS 1.3 implementation of crypto/tls.
+// All handshake messages are sent on the crypto stream, independent of the encryption level crypto/tls assigns to them.
+// Messages from the peer are passed to crypto/tls using the level of the most recently installed read keys.
+type stdlibTLSController struct {
+	csc         *handshake.CryptoStreamConn
+	conn        *tls.QUICConn
+	extHandler  handshake.TLSExtensionHandler
+	perspective protocol.Perspective
+
+	keyLog       io.Writer
+	clientRandom []byte
+
+	started                       bool
+	readLevel                     tls.QUICEncryptionLevel
+	handlingPostHandshakeMessages bool
+
+	mutex             sync.Mutex
+	handshakeComplete bool
+
+	logger utils.Logger
+}
+
+var _ handshake.MintTLS = &stdlibTLSController{}
+var _ crypto.KeyLogger = &stdlibTLSController{}
+
+func newStdlibTLSController(
+	csc *handshake.CryptoStreamConn,
+	tlsConf *tls.Config,
+	extHandler handshake.TLSExtensionHandler,
+	pers protocol.Perspective,
+	logger utils.Logger,
+) handshake.MintTLS {
+	conf := newQUICConfig(tlsConf, csc)
+	var conn *tls.QUICConn
+	if pers == protocol.PerspectiveClient {
+		conn = tls.QUICClient(conf)
+	} else {
+		conn = tls.QUICServer(conf)
+	}
+	c := &stdlibTLSController{
+		csc:         csc,
+		conn:        conn,
+		extHandler:  extHandler,
+		perspective: pers,
+		logger:      logger,
+	}
+	if tlsConf != nil {
+		c.keyLog = tlsConf.KeyLogWriter
+	}
+	return c
+}
+
+func (c *stdlibTLSController) GetCipherSuite() mint.CipherSuiteParams {
+	return stdlibCipherSuites[c.conn.ConnectionState().CipherSuite]
+}
+
+func (c *stdlibTLSController) ComputeExporter(label string, context []byte, keyLength int) ([]byte, error) {
+	state := c.conn.ConnectionState()
+	return state.ExportKeyingMaterial(label, context, keyLength)
+}
+
+// Handshake processes the next handshake message received from the peer.
+// The first call starts the handshake.
+func (c *stdlibTLSController) Handshake() mint.Alert {
+	if err := c.handshake(); err != nil {
+		c.logger.Debugf("TLS handshake failed: %s", err)
+		// stop the handshake go routine of crypto/tls
+		c.conn.Close()
+		var alert tls.AlertError
+		if errors.As(err, &alert) {
+			return mint.Alert(alert)
+		}
+		return mint.AlertInternalError
+	}
+	// The handshake loop of the crypto setup returns once the handshake completes.
+	// Session tickets sent by the server are handled in a separate go routine.
+	if c.perspective == protocol.PerspectiveClient && c.State() == mint.StateClientConnected && !c.handlingPostHandshakeMessages {
+		c.handlingPostHandshakeMessages = true
+		go c.handlePostHandshakeMessages()
+	}
+	return mint.AlertNoAlert
+}
+
+func (c *stdlibTLSController) handshake() error {
+	if !c.started {
+		c.started = true
+		if c.perspective == protocol.PerspectiveClient {
+			params, err := c.getTransportParameters(mint.HandshakeTypeClientHello)
+			if err != nil {
+				return err
+			}
+			c.conn.SetTransportParameters(params)
+		}
+		if err := c.conn.Start(context.Background()); err != nil {
+			return err
+		}
+		if c.perspective == protocol.PerspectiveClient {
+			// send the ClientHello
+			return c.handleEvents()
+		}
+	}
+	msg, err := c.readHandshakeMessage()
+	if err != nil {
+		return err
+	}
+	if c.perspective == protocol.PerspectiveServer && c.clientRandom == nil {
+		c.clientRandom = getClientRandom(msg)
+	}
+	if err := c.conn.HandleData(c.readLevel, msg); err != nil {
+		return err
+	}
+	return c.handleEvents()
+}
+
+func (c *stdlibTLSController) handleEvents() error {
+	for {
+		ev := c.conn.NextEvent()
+		switch ev.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case quicErrorEvent:
+			return ev.Err
+		case tls.QUICSetReadSecret:
+			c.readLevel = ev.Level
+		case tls.QUICWriteData:
+			// The data is only valid until the next call to NextEvent,
+			// but the crypto stream keeps a reference to it until it is acknowledged.
+			data := make([]byte, len(ev.Data))
+			copy(data, ev.Data)
+			if c.perspective == protocol.PerspectiveClient && c.clientRandom == nil {
+				c.clientRandom = getClientRandom(data)
+			}
+			if _, err := c.csc.Write(data); err != nil {
+				return err
+			}
+		case tls.QUICTransportParameters:
+			hType := mint.HandshakeTypeEncryptedExtensions
+			if c.perspective == protocol.PerspectiveServer {
+				hType = mint.HandshakeTypeClientHello
+			}
+			if err := c.extHandler.Receive(hType, handshake.NewExtensionListWithBody(ev.Data)); err != nil {
+				return err
+			}
+		case tls.QUICTransportParametersRequired:
+			params, err := c.getTransportParameters(mint.HandshakeTypeEncryptedExtensions)
+			if err != nil {
+				return err
+			}
+			c.conn.SetTransportParameters(params)
+		case tls.QUICHandshakeDone:
+			c.mutex.Lock()
+			c.handshakeComplete = true
+			c.mutex.Unlock()
+			if c.perspective == protocol.PerspectiveServer {
+				if err := c.conn.SendSessionTicket(tls.QUICSessionTicketOptions{}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// handlePostHandshakeMessages handles the messages the server sends after the handshake, i.e. session tickets.
+// crypto/tls stores the session tickets in the tls.Config's ClientSessionCache.
+// It returns when reading from the crypto stream fails, which happens when the session is closed.
+func (c *stdlibTLSController) handlePostHandshakeMessages() {
+	for {
+		msg, err := c.readHandshakeMessage()
+		if err != nil {
+			return
+		}
+		if err := c.conn.HandleData(tls.QUICEncryptionLevelApplication, msg); err != nil {
+			c.logger.Debugf("Error handling post-handshake message: %s", err)
+			return
+		}
+		for c.conn.NextEvent().Kind != tls.QUICNoEvent {
+		}
+	}
+}
+
+func (c *stdlibTLSController) getTransportParameters(hType mint.HandshakeType) ([]byte, error) {
+	el := &mint.ExtensionList{}
+	if err := c.extHandler.Send(hType, el); err != nil {
+		return nil, err
+	}
+	return handshake.GetExtensionBody(el), nil
+}
+
+func (c *stdlibTLSController) readHandshakeMessage() ([]byte, error) {
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(c.csc, hdr); err != nil {
+		return nil, err
+	}
+	length := int(hdr[1])<<16 | int(hdr[2])<<8 | int(hdr[3])
+	if length > maxHandshakeMessageLen {
+		return nil, fmt.Errorf("handshake message too large: %d bytes", length)
+	}
+	msg := make([]byte, 4+length)
+	copy(msg, hdr)
+	if _, err := io.ReadFull(c.csc, msg[4:]); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// State returns the mint state corresponding to the progress of the handshake.
+// After the server processed the ClientHello, it immediately sends its whole flight.
+func (c *stdlibTLSController) State() mint.State {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.perspective == protocol.PerspectiveClient {
+		switch {
+		case c.handshakeComplete:
+			return mint.StateClientConnected
+		case c.started:
+			return mint.StateClientWaitSH
+		default:
+			return mint.StateClientStart
+		}
+	}
+	switch {
+	case c.handshakeComplete:
+		return mint.StateServerConnected
+	case c.started:
+		return mint.StateServerWaitFlight2
+	default:
+		return mint.StateServerStart
+	}
+}
+
+func (c *stdlibTLSController) ConnectionState() mint.ConnectionState {
+	state := mint.ConnectionState{HandshakeState: c.State()}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// crypto/tls holds a lock for the duration of the handshake, so the connection state is only available once it completed
+	if !c.handshakeComplete {
+		return state
+	}
+	tlsState := c.conn.ConnectionState()
+	state.CipherSuite = stdlibCipherSuites[tlsState.CipherSuite]
+	state.PeerCertificates = tlsState.PeerCertificates
+	state.VerifiedChains = tlsState.VerifiedChains
+	state.NextProto = tlsState.NegotiatedProtocol
+	return state
+}
+
+// ServerName returns the server name sent by the client.
+// As the rest of the connection state, it is only available once the handshake completed.
+func (c *stdlibTLSController) ServerName() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.handshakeComplete {
+		return ""
+	}
+	return c.conn.ConnectionState().ServerName
+}
+
+// GetKeyLog returns the tls.Config's KeyLogWriter.
+// crypto/tls only logs the secrets of the TLS handshake, the 1-RTT secrets are logged when the keys are derived.
+func (c *stdlibTLSController) GetKeyLog() (io.Writer, []byte) {
+	return c.keyLog, c.clientRandom
+}
+
+func (c *stdlibTLSController) SetCryptoStream(stream io.ReadWriter) {
+	c.csc.SetStream(stream)
+}
@@ -0,0 +1,132 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("crypto/tls controller", func() {
+	var (
+		clientConn, serverConn net.Conn
+		clientExtHandler       handshake.TLSExtensionHandler
+		serverExtHandler       handshake.TLSExtensionHandler
+	)
+
+	BeforeEach(func() {
+		clientConn, serverConn = net.Pipe()
+		clientExtHandler = handshake.NewExtensionHandlerClient(
+			&handshake.TransportParameters{IdleTimeout: protocol.DefaultIdleTimeout},
+			protocol.VersionTLS,
+			[]protocol.VersionNumber{protocol.VersionTLS},
+			protocol.VersionTLS,
+			utils.DefaultLogger,
+		)
+		token := protocol.StatelessResetToken{1, 2, 3, 4}
+		serverExtHandler = handshake.NewExtensionHandlerServer(
+			&handshake.TransportParameters{IdleTimeout: protocol.DefaultIdleTimeout, StatelessResetToken: &token},
+			[]protocol.VersionNumber{protocol.VersionTLS},
+			protocol.VersionTLS,
+			utils.DefaultLogger,
+		)
+	})
+
+	AfterEach(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+
+	newController := func(conn net.Conn, tlsConf *tls.Config, extHandler handshake.TLSExtensionHandler, pers protocol.Perspective) handshake.MintTLS {
+		csc := handshake.NewCryptoStreamConn(nil)
+		c := newStdlibTLSController(csc, tlsConf, extHandler, pers, utils.DefaultLogger)
+		c.SetCryptoStream(conn)
+		return c
+	}
+
+	// runHandshake calls Handshake until the handshake completes, and returns the first alert
+	runHandshake := func(c handshake.MintTLS, connectedState mint.State) <-chan mint.Alert {
+		alertChan := make(chan mint.Alert, 1)
+		go func() {
+			defer GinkgoRecover()
+			for {
+				if alert := c.Handshake(); alert != mint.AlertNoAlert || c.State() == connectedState {
+					alertChan <- alert
+					return
+				}
+			}
+		}()
+		return alertChan
+	}
+
+	It("performs a handshake", func() {
+		client := newController(clientConn, &tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true}, clientExtHandler, protocol.PerspectiveClient)
+		server := newController(serverConn, testdata.GetTLSConfig(), serverExtHandler, protocol.PerspectiveServer)
+		Expect(client.State()).To(Equal(mint.StateClientStart))
+		Expect(server.State()).To(Equal(mint.StateServerStart))
+		clientAlertChan := runHandshake(client, mint.StateClientConnected)
+		serverAlertChan := runHandshake(server, mint.StateServerConnected)
+		var serverParams handshake.TransportParameters
+		Eventually(clientExtHandler.GetPeerParams()).Should(Receive(&serverParams))
+		Expect(serverParams.StatelessResetToken).To(Equal(&protocol.StatelessResetToken{1, 2, 3, 4}))
+		Eventually(serverExtHandler.GetPeerParams()).Should(Receive())
+		Eventually(clientAlertChan).Should(Receive(Equal(mint.AlertNoAlert)))
+		Eventually(serverAlertChan).Should(Receive(Equal(mint.AlertNoAlert)))
+		Expect(client.State()).To(Equal(mint.StateClientConnected))
+		Expect(server.State()).To(Equal(mint.StateServerConnected))
+		Expect(client.ConnectionState().PeerCertificates).ToNot(BeEmpty())
+		Expect(client.ConnectionState().PeerCertificates[0].DNSNames).To(ContainElement("quic.clemente.io"))
+		Expect(server.ServerName()).To(Equal("quic.clemente.io"))
+		// both sides derive the same keys
+		Expect(client.GetCipherSuite()).To(Equal(server.GetCipherSuite()))
+		Expect(client.GetCipherSuite().KeyLen).ToNot(BeZero())
+		clientSecret, err := client.ComputeExporter("foobar", nil, 32)
+		Expect(err).ToNot(HaveOccurred())
+		serverSecret, err := server.ComputeExporter("foobar", nil, 32)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clientSecret).To(Equal(serverSecret))
+	})
+
+	It("returns the KeyLogWriter and the client random", func() {
+		keyLog := &bytes.Buffer{}
+		client := newController(clientConn, &tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true, KeyLogWriter: keyLog}, clientExtHandler, protocol.PerspectiveClient)
+		server := newController(serverConn, testdata.GetTLSConfig(), serverExtHandler, protocol.PerspectiveServer)
+		clientAlertChan := runHandshake(client, mint.StateClientConnected)
+		serverAlertChan := runHandshake(server, mint.StateServerConnected)
+		Eventually(clientExtHandler.GetPeerParams()).Should(Receive())
+		Eventually(serverExtHandler.GetPeerParams()).Should(Receive())
+		Eventually(clientAlertChan).Should(Receive(Equal(mint.AlertNoAlert)))
+		Eventually(serverAlertChan).Should(Receive(Equal(mint.AlertNoAlert)))
+		w, clientRandom := client.(crypto.KeyLogger).GetKeyLog()
+		Expect(w).To(Equal(keyLog))
+		Expect(clientRandom).To(HaveLen(32))
+		// crypto/tls logs the handshake secrets using the same client random
+		Expect(keyLog.String()).To(ContainSubstring(fmt.Sprintf("CLIENT_HANDSHAKE_TRAFFIC_SECRET %x ", clientRandom)))
+		w, serverClientRandom := server.(crypto.KeyLogger).GetKeyLog()
+		Expect(w).To(BeNil())
+		Expect(serverClientRandom).To(Equal(clientRandom))
+	})
+
+	It("returns the alert if the handshake fails", func() {
+		// the client doesn't trust the certificate
+		client := newController(clientConn, &tls.Config{ServerName: "quic.clemente.io", RootCAs: x509.NewCertPool()}, clientExtHandler, protocol.PerspectiveClient)
+		server := newController(serverConn, testdata.GetTLSConfig(), serverExtHandler, protocol.PerspectiveServer)
+		clientAlertChan := runHandshake(client, mint.StateClientConnected)
+		runHandshake(server, mint.StateServerConnected)
+		Eventually(clientExtHandler.GetPeerParams()).Should(Receive())
+		Eventually(clientAlertChan).Should(Receive(Equal(mint.AlertBadCertificate)))
+		Expect(client.State()).To(Equal(mint.StateClientWaitSH))
+		Expect(client.ConnectionState().PeerCertificates).To(BeEmpty())
+	})
+})
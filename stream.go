@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"fmt"
 	"net"
 	"sync"
 	"time"
@@ -13,6 +14,9 @@ import (
 const (
 	errorCodeStopping      protocol.ApplicationErrorCode = 0
 	errorCodeStoppingGQUIC protocol.ApplicationErrorCode = 7
+	// used to reset streams that the peer opens after the session started going away
+	errorCodeRefused      protocol.ApplicationErrorCode = 0
+	errorCodeRefusedGQUIC protocol.ApplicationErrorCode = 8
 )
 
 // The streamSender is notified by the stream about various events.
@@ -55,10 +59,15 @@ type streamI interface {
 	handleStreamFrame(*wire.StreamFrame) error
 	handleRstStreamFrame(*wire.RstStreamFrame) error
 	getWindowUpdate() protocol.ByteCount
+	getReceiveWindow() protocol.ByteCount
 	// for sending
 	handleStopSendingFrame(*wire.StopSendingFrame)
 	popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool)
 	handleMaxStreamDataFrame(*wire.MaxStreamDataFrame)
+	getPriority() uint8
+	// for continuing the session in another process
+	exportState() (*streamState, error)
+	importState(*streamState)
 }
 
 var _ receiveStreamI = (streamI)(nil)
@@ -81,6 +90,16 @@ type stream struct {
 
 var _ Stream = &stream{}
 
+// A streamState is the state of a stream, exported to continue the session in another process.
+type streamState struct {
+	streamID    protocol.StreamID
+	writeOffset protocol.ByteCount
+	finSent     bool
+	readOffset  protocol.ByteCount
+	finRead     bool
+	flowControl flowcontrol.State
+}
+
 type deadlineError struct{}
 
 func (deadlineError) Error() string   { return "deadline exceeded" }
@@ -178,3 +197,53 @@ func (s *stream) checkIfCompleted() {
 		s.sender.onStreamCompleted(s.StreamID())
 	}
 }
+
+// exportState exports the state of the stream.
+// This is only possible if all data written to the stream was sent, all data received on the stream was read,
+// and the stream wasn't reset.
+func (s *stream) exportState() (*streamState, error) {
+	s.sendStream.mutex.Lock()
+	defer s.sendStream.mutex.Unlock()
+	s.receiveStream.mutex.Lock()
+	defer s.receiveStream.mutex.Unlock()
+
+	if s.sendStream.canceledWrite || s.sendStream.closedForShutdown || s.receiveStream.canceledRead || s.receiveStream.resetRemotely || s.receiveStream.closedForShutdown {
+		return nil, fmt.Errorf("stream %d was reset", s.StreamID())
+	}
+	if s.sendStream.hasDataForWriting() || (s.sendStream.finishedWriting && !s.sendStream.finSent) {
+		return nil, fmt.Errorf("stream %d has data to send", s.StreamID())
+	}
+	fcState := s.sendStream.flowController.GetState()
+	if fcState.HighestReceived > s.receiveStream.readOffset || (!s.receiveStream.finRead && s.receiveStream.frameQueue.Head() != nil) {
+		return nil, fmt.Errorf("stream %d has unread data", s.StreamID())
+	}
+	return &streamState{
+		streamID:    s.StreamID(),
+		writeOffset: s.sendStream.writeOffset,
+		finSent:     s.sendStream.finSent,
+		readOffset:  s.receiveStream.readOffset,
+		finRead:     s.receiveStream.finRead,
+		flowControl: fcState,
+	}, nil
+}
+
+// importState restores the state of a stream that was exported by another process.
+// It must be called before the stream is used.
+func (s *stream) importState(state *streamState) {
+	s.sendStream.writeOffset = state.writeOffset
+	s.receiveStream.readOffset = state.readOffset
+	s.receiveStream.frameQueue.skipTo(state.readOffset)
+	s.sendStream.flowController.SetState(state.flowControl)
+	// The completed half of a half-closed stream doesn't call onStreamCompleted again.
+	if state.finSent {
+		s.sendStream.finishedWriting = true
+		s.sendStream.finSent = true
+		s.sendStream.ctxCancel()
+		s.sendStreamCompleted = true
+	}
+	if state.finRead {
+		s.receiveStream.finRead = true
+		s.receiveStream.setTerminationReason(StreamFinished)
+		s.receiveStreamCompleted = true
+	}
+}
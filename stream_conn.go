@@ -0,0 +1,63 @@
+package quic
+
+import (
+	"net"
+)
+
+// A StreamAddr is the address of one end of a stream.
+// It behaves like the UDP address of the session, and additionally carries the stream ID.
+type StreamAddr struct {
+	Addr     net.Addr
+	StreamID StreamID
+}
+
+var _ net.Addr = &StreamAddr{}
+
+// Network returns the network of the session's address, e.g. "udp".
+func (a *StreamAddr) Network() string {
+	return a.Addr.Network()
+}
+
+// String returns the session's address.
+// It doesn't include the stream ID, such that it can be parsed like any other UDP address.
+func (a *StreamAddr) String() string {
+	return a.Addr.String()
+}
+
+type streamConn struct {
+	Stream
+
+	localAddr  *StreamAddr
+	remoteAddr *StreamAddr
+}
+
+var _ net.Conn = &streamConn{}
+
+// NewStreamConn returns a net.Conn for a stream of a session.
+// LocalAddr and RemoteAddr return the session's addresses, as a *StreamAddr.
+// Close closes the stream for writing, and cancels reading from the stream.
+// Data already written is still delivered to the peer.
+func NewStreamConn(sess Session, str Stream) net.Conn {
+	return &streamConn{
+		Stream:     str,
+		localAddr:  &StreamAddr{Addr: sess.LocalAddr(), StreamID: str.StreamID()},
+		remoteAddr: &StreamAddr{Addr: sess.RemoteAddr(), StreamID: str.StreamID()},
+	}
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *streamConn) Close() error {
+	// In gQUIC, the RST_STREAM for a canceled read is sent when the stream is closed.
+	// CancelRead therefore has to be called first.
+	if err := c.Stream.CancelRead(0); err != nil {
+		return err
+	}
+	return c.Stream.Close()
+}
@@ -0,0 +1,80 @@
+package quic
+
+import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/mocks"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type addrSession struct {
+	Session
+	localAddr, remoteAddr net.Addr
+}
+
+func (s *addrSession) LocalAddr() net.Addr  { return s.localAddr }
+func (s *addrSession) RemoteAddr() net.Addr { return s.remoteAddr }
+
+var _ = Describe("Stream Conn", func() {
+	const streamID protocol.StreamID = 1337
+
+	var (
+		conn       net.Conn
+		str        *stream
+		mockSender *MockStreamSender
+		localAddr  = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+		remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 4321}
+	)
+
+	BeforeEach(func() {
+		mockSender = NewMockStreamSender(mockCtrl)
+		str = newStream(streamID, mockSender, mocks.NewMockStreamFlowController(mockCtrl), versionGQUICFrames)
+		conn = NewStreamConn(&addrSession{localAddr: localAddr, remoteAddr: remoteAddr}, str)
+	})
+
+	It("returns the local address", func() {
+		addr := conn.LocalAddr()
+		Expect(addr.Network()).To(Equal("udp"))
+		Expect(addr.String()).To(Equal("192.168.0.1:1234"))
+		Expect(addr).To(BeAssignableToTypeOf(&StreamAddr{}))
+		Expect(addr.(*StreamAddr).Addr).To(Equal(localAddr))
+		Expect(addr.(*StreamAddr).StreamID).To(Equal(streamID))
+	})
+
+	It("returns the remote address", func() {
+		addr := conn.RemoteAddr()
+		Expect(addr.Network()).To(Equal("udp"))
+		Expect(addr.String()).To(Equal("192.168.0.2:4321"))
+		Expect(addr).To(BeAssignableToTypeOf(&StreamAddr{}))
+		Expect(addr.(*StreamAddr).Addr).To(Equal(remoteAddr))
+		Expect(addr.(*StreamAddr).StreamID).To(Equal(streamID))
+	})
+
+	It("closes the stream, and cancels reading, for gQUIC", func() {
+		mockSender.EXPECT().onHasStreamData(streamID)
+		mockSender.EXPECT().queueControlFrame(&wire.RstStreamFrame{
+			StreamID:   streamID,
+			ByteOffset: 0,
+			ErrorCode:  0,
+		})
+		Expect(conn.Close()).To(Succeed())
+		_, err := conn.Read([]byte{0})
+		Expect(err).To(MatchError("Read on stream 1337 canceled with error code 0"))
+		_, err = conn.Write([]byte("foobar"))
+		Expect(err).To(MatchError("write on closed stream 1337"))
+	})
+
+	It("closes the stream, and cancels reading, for IETF QUIC", func() {
+		str = newStream(streamID, mockSender, mocks.NewMockStreamFlowController(mockCtrl), versionIETFFrames)
+		conn = NewStreamConn(&addrSession{localAddr: localAddr, remoteAddr: remoteAddr}, str)
+		mockSender.EXPECT().queueControlFrame(&wire.StopSendingFrame{StreamID: streamID})
+		mockSender.EXPECT().onHasStreamData(streamID)
+		Expect(conn.Close()).To(Succeed())
+		_, err := conn.Read([]byte{0})
+		Expect(err).To(MatchError("Read on stream 1337 canceled with error code 0"))
+	})
+})
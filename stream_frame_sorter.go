@@ -159,3 +159,10 @@ func (s *streamFrameSorter) Head() *wire.StreamFrame {
 	}
 	return nil
 }
+
+// skipTo moves the read position of a streamFrameSorter that doesn't hold any frames.
+// Data before the new read position is treated as duplicate data.
+func (s *streamFrameSorter) skipTo(offset protocol.ByteCount) {
+	s.readPosition = offset
+	s.gaps.Front().Value.Start = offset
+}
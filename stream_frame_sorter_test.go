@@ -30,6 +30,16 @@ var _ = Describe("StreamFrame sorter", func() {
 		Expect(s.Head()).To(BeNil())
 	})
 
+	It("skips to a read position", func() {
+		s.skipTo(10)
+		checkGaps([]utils.ByteInterval{{Start: 10, End: protocol.MaxByteCount}})
+		Expect(s.Push(&wire.StreamFrame{Offset: 5, Data: []byte("foobar")})).To(Succeed())
+		Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foo")})).To(MatchError(errDuplicateStreamData))
+		frame := s.Pop()
+		Expect(frame.Offset).To(Equal(protocol.ByteCount(10)))
+		Expect(frame.Data).To(Equal([]byte("r")))
+	})
+
 	Context("Push", func() {
 		It("inserts and pops a single frame", func() {
 			f := &wire.StreamFrame{
@@ -14,19 +14,21 @@ type streamFramer struct {
 
 	streamQueueMutex    sync.Mutex
 	activeStreams       map[protocol.StreamID]struct{}
-	streamQueue         []protocol.StreamID
+	scheduler           streamScheduler
 	hasCryptoStreamData bool
 }
 
 func newStreamFramer(
 	cryptoStream cryptoStreamI,
 	streamGetter streamGetter,
+	scheduler streamScheduler,
 	v protocol.VersionNumber,
 ) *streamFramer {
 	return &streamFramer{
 		streamGetter:  streamGetter,
 		cryptoStream:  cryptoStream,
 		activeStreams: make(map[protocol.StreamID]struct{}),
+		scheduler:     scheduler,
 		version:       v,
 	}
 }
@@ -40,7 +42,7 @@ func (f *streamFramer) AddActiveStream(id protocol.StreamID) {
 	}
 	f.streamQueueMutex.Lock()
 	if _, ok := f.activeStreams[id]; !ok {
-		f.streamQueue = append(f.streamQueue, id)
+		f.scheduler.AddStream(id)
 		f.activeStreams[id] = struct{}{}
 	}
 	f.streamQueueMutex.Unlock()
@@ -66,25 +68,33 @@ func (f *streamFramer) PopStreamFrames(maxTotalLen protocol.ByteCount) []*wire.S
 	var frames []*wire.StreamFrame
 	f.streamQueueMutex.Lock()
 	// pop STREAM frames, until less than MinStreamFrameSize bytes are left in the packet
-	numActiveStreams := len(f.streamQueue)
+	numActiveStreams := f.scheduler.Len()
 	for i := 0; i < numActiveStreams; i++ {
-		if maxTotalLen-currentLen < protocol.MinStreamFrameSize {
+		if maxTotalLen-currentLen < protocol.MinStreamFrameSize || f.scheduler.Len() == 0 {
 			break
 		}
-		id := f.streamQueue[0]
-		f.streamQueue = f.streamQueue[1:]
+		id := f.scheduler.NextStream()
 		// This should never return an error. Better check it anyway.
-		// The stream will only be in the streamQueue, if it enqueued itself there.
+		// The stream will only be in the scheduler, if it enqueued itself there.
 		str, err := f.streamGetter.GetOrOpenSendStream(id)
 		// The stream can be nil if it completed after it said it had data.
 		if str == nil || err != nil {
+			f.scheduler.RemoveStream(id)
 			delete(f.activeStreams, id)
 			continue
 		}
+		if weight := str.getPriority(); weight != 0 {
+			f.scheduler.UpdateWeight(id, weight)
+		}
 		frame, hasMoreData := str.popStreamFrame(maxTotalLen - currentLen)
-		if hasMoreData { // put the stream back in the queue (at the end)
-			f.streamQueue = append(f.streamQueue, id)
+		if hasMoreData { // let the scheduler decide when the stream is allowed to send again
+			var n protocol.ByteCount
+			if frame != nil {
+				n = frame.DataLen()
+			}
+			f.scheduler.SentData(id, n)
 		} else { // no more data to send. Stream is not active any more
+			f.scheduler.RemoveStream(id)
 			delete(f.activeStreams, id)
 		}
 		if frame == nil { // can happen if the receiveStream was canceled after it said it had data
@@ -28,10 +28,12 @@ var _ = Describe("Stream Framer", func() {
 		streamGetter = NewMockStreamGetter(mockCtrl)
 		stream1 = NewMockSendStreamI(mockCtrl)
 		stream1.EXPECT().StreamID().Return(protocol.StreamID(5)).AnyTimes()
+		stream1.EXPECT().getPriority().AnyTimes()
 		stream2 = NewMockSendStreamI(mockCtrl)
 		stream2.EXPECT().StreamID().Return(protocol.StreamID(6)).AnyTimes()
+		stream2.EXPECT().getPriority().AnyTimes()
 		cryptoStream = NewMockCryptoStream(mockCtrl)
-		framer = newStreamFramer(cryptoStream, streamGetter, versionGQUICFrames)
+		framer = newStreamFramer(cryptoStream, streamGetter, &roundRobinScheduler{}, versionGQUICFrames)
 	})
 
 	Context("handling the crypto stream", func() {
@@ -204,4 +206,93 @@ var _ = Describe("Stream Framer", func() {
 			Expect(fs).To(Equal([]*wire.StreamFrame{f}))
 		})
 	})
+
+	Context("scheduling streams", func() {
+		const id3 = protocol.StreamID(12)
+
+		var stream3 *MockSendStreamI
+
+		BeforeEach(func() {
+			stream3 = NewMockSendStreamI(mockCtrl)
+			stream3.EXPECT().getPriority().AnyTimes()
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil).AnyTimes()
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil).AnyTimes()
+			streamGetter.EXPECT().GetOrOpenSendStream(id3).Return(stream3, nil).AnyTimes()
+		})
+
+		// popStreamIDs pops n packets, each of which only has space for a single STREAM frame
+		popStreamIDs := func(n int) []protocol.StreamID {
+			var ids []protocol.StreamID
+			for i := 0; i < n; i++ {
+				frames := framer.PopStreamFrames(protocol.MinStreamFrameSize)
+				Expect(frames).To(HaveLen(1))
+				ids = append(ids, frames[0].StreamID)
+			}
+			return ids
+		}
+
+		It("uses round-robin scheduling", func() {
+			framer.scheduler = &roundRobinScheduler{}
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}, true).AnyTimes()
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id2, Data: []byte("foobar")}, true).AnyTimes()
+			stream3.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id3, Data: []byte("foobar")}, true).AnyTimes()
+			framer.AddActiveStream(id2)
+			framer.AddActiveStream(id3)
+			framer.AddActiveStream(id1)
+			Expect(popStreamIDs(6)).To(Equal([]protocol.StreamID{id2, id3, id1, id2, id3, id1}))
+		})
+
+		It("uses FIFO scheduling", func() {
+			framer.scheduler = &fifoScheduler{}
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}, true).Times(2)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}, false)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id2, Data: []byte("foobar")}, true)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id2, Data: []byte("foobar")}, false)
+			stream3.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id3, Data: []byte("foobar")}, true).AnyTimes()
+			framer.AddActiveStream(id2)
+			framer.AddActiveStream(id3)
+			framer.AddActiveStream(id1)
+			Expect(popStreamIDs(7)).To(Equal([]protocol.StreamID{id1, id1, id1, id2, id2, id3, id3}))
+		})
+
+		It("uses weighted fair scheduling", func() {
+			weights := map[StreamID]uint8{id1: 1, id2: 2, id3: 3}
+			framer.scheduler = newWeightedFairScheduler(func(id StreamID) uint8 { return weights[id] })
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}, true).AnyTimes()
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id2, Data: []byte("foobar")}, true).AnyTimes()
+			stream3.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id3, Data: []byte("foobar")}, true).AnyTimes()
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.AddActiveStream(id3)
+			Expect(popStreamIDs(6)).To(Equal([]protocol.StreamID{id1, id2, id3, id3, id2, id3}))
+			counts := make(map[protocol.StreamID]int)
+			for _, id := range popStreamIDs(600) {
+				counts[id]++
+			}
+			Expect(counts).To(Equal(map[protocol.StreamID]int{id1: 100, id2: 200, id3: 300}))
+		})
+
+		It("uses the priorities set on the streams for weighted fair scheduling", func() {
+			const (
+				id4 = protocol.StreamID(14)
+				id5 = protocol.StreamID(16)
+			)
+			stream4 := NewMockSendStreamI(mockCtrl)
+			stream5 := NewMockSendStreamI(mockCtrl)
+			streamGetter.EXPECT().GetOrOpenSendStream(id4).Return(stream4, nil).AnyTimes()
+			streamGetter.EXPECT().GetOrOpenSendStream(id5).Return(stream5, nil).AnyTimes()
+			framer.scheduler = newWeightedFairScheduler(func(StreamID) uint8 { return 1 })
+			stream4.EXPECT().getPriority().Return(uint8(3)).AnyTimes()
+			stream5.EXPECT().getPriority().AnyTimes() // no priority set
+			stream4.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id4, Data: []byte("foobar")}, true).AnyTimes()
+			stream5.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: id5, Data: []byte("foobar")}, true).AnyTimes()
+			framer.AddActiveStream(id4)
+			framer.AddActiveStream(id5)
+			counts := make(map[protocol.StreamID]int)
+			for _, id := range popStreamIDs(400) {
+				counts[id]++
+			}
+			Expect(counts).To(Equal(map[protocol.StreamID]int{id4: 300, id5: 100}))
+		})
+	})
 })
@@ -0,0 +1,82 @@
+package quic
+
+import (
+	"net"
+	"sync"
+)
+
+// The streamListener accepts the streams opened by the peers of all sessions accepted by a Listener.
+type streamListener struct {
+	ln Listener
+
+	conns chan net.Conn
+
+	// acceptErr is the error returned by the Listener's Accept.
+	// It is set before done is closed.
+	acceptErr error
+	done      chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ net.Listener = &streamListener{}
+
+// NewStreamListener returns a net.Listener for the streams of the sessions accepted by a Listener.
+// Accept returns the next stream opened by the peer of any of those sessions, as a net.Conn (see NewStreamConn).
+// Closing the net.Listener closes the Listener.
+func NewStreamListener(ln Listener) net.Listener {
+	l := &streamListener{
+		ln:    ln,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	go l.acceptSessions()
+	return l
+}
+
+func (l *streamListener) acceptSessions() {
+	for {
+		sess, err := l.ln.Accept()
+		if err != nil {
+			l.acceptErr = err
+			close(l.done)
+			return
+		}
+		go l.acceptStreams(sess)
+	}
+}
+
+func (l *streamListener) acceptStreams(sess Session) {
+	for {
+		str, err := sess.AcceptStream()
+		if err != nil { // the session was closed
+			return
+		}
+		select {
+		case l.conns <- NewStreamConn(sess, str):
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *streamListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.acceptErr
+	}
+}
+
+func (l *streamListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+func (l *streamListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.closeErr = l.ln.Close()
+	})
+	return l.closeErr
+}
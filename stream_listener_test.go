@@ -0,0 +1,149 @@
+package quic
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type streamAcceptingSession struct {
+	addrSession
+	streams chan Stream
+	closed  chan struct{}
+}
+
+func newStreamAcceptingSession(remoteAddr net.Addr) *streamAcceptingSession {
+	return &streamAcceptingSession{
+		addrSession: addrSession{localAddr: &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 443}, remoteAddr: remoteAddr},
+		streams:     make(chan Stream),
+		closed:      make(chan struct{}),
+	}
+}
+
+func (s *streamAcceptingSession) AcceptStream() (Stream, error) {
+	select {
+	case str := <-s.streams:
+		return str, nil
+	case <-s.closed:
+		return nil, errors.New("session closed")
+	}
+}
+
+type sessionListener struct {
+	sessions chan Session
+	closed   chan struct{}
+	closeErr error
+}
+
+func (l *sessionListener) Accept() (Session, error) {
+	select {
+	case sess := <-l.sessions:
+		return sess, nil
+	case <-l.closed:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *sessionListener) Shutdown(context.Context) error { panic("not implemented") }
+
+func (l *sessionListener) ImportSession([]byte) (Session, []Stream, error) {
+	panic("not implemented")
+}
+
+func (l *sessionListener) Addr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 443}
+}
+
+func (l *sessionListener) Close() error {
+	close(l.closed)
+	return l.closeErr
+}
+
+var _ = Describe("Stream Listener", func() {
+	var (
+		ln  *sessionListener
+		sln net.Listener
+	)
+
+	newMockStream := func(id protocol.StreamID) Stream {
+		str := NewMockStreamI(mockCtrl)
+		str.EXPECT().StreamID().Return(id).AnyTimes()
+		return str
+	}
+
+	BeforeEach(func() {
+		ln = &sessionListener{
+			sessions: make(chan Session),
+			closed:   make(chan struct{}),
+		}
+		sln = NewStreamListener(ln)
+	})
+
+	AfterEach(func() {
+		sln.Close()
+	})
+
+	It("returns the address of the listener", func() {
+		Expect(sln.Addr()).To(Equal(ln.Addr()))
+	})
+
+	It("accepts streams of multiple sessions", func() {
+		sess1 := newStreamAcceptingSession(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234})
+		sess2 := newStreamAcceptingSession(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1234})
+		ln.sessions <- sess1
+		ln.sessions <- sess2
+		sess1.streams <- newMockStream(3)
+		conn, err := sln.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.RemoteAddr().(*StreamAddr).Addr).To(Equal(sess1.remoteAddr))
+		Expect(conn.RemoteAddr().(*StreamAddr).StreamID).To(Equal(protocol.StreamID(3)))
+		sess2.streams <- newMockStream(5)
+		conn, err = sln.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.RemoteAddr().(*StreamAddr).Addr).To(Equal(sess2.remoteAddr))
+		Expect(conn.RemoteAddr().(*StreamAddr).StreamID).To(Equal(protocol.StreamID(5)))
+		sess1.streams <- newMockStream(7)
+		conn, err = sln.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.RemoteAddr().(*StreamAddr).Addr).To(Equal(sess1.remoteAddr))
+		Expect(conn.RemoteAddr().(*StreamAddr).StreamID).To(Equal(protocol.StreamID(7)))
+	})
+
+	It("continues accepting streams when a session is closed", func() {
+		sess1 := newStreamAcceptingSession(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234})
+		sess2 := newStreamAcceptingSession(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1234})
+		ln.sessions <- sess1
+		ln.sessions <- sess2
+		close(sess1.closed)
+		sess2.streams <- newMockStream(3)
+		conn, err := sln.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.RemoteAddr().(*StreamAddr).Addr).To(Equal(sess2.remoteAddr))
+	})
+
+	It("closes the listener", func() {
+		ln.closeErr = errors.New("close error")
+		Expect(sln.Close()).To(MatchError("close error"))
+		// closing again doesn't close the listener again
+		Expect(sln.Close()).To(MatchError("close error"))
+		_, err := sln.Accept()
+		Expect(err).To(MatchError("listener closed"))
+	})
+
+	It("unblocks Accept when the listener is closed", func() {
+		errChan := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			_, err := sln.Accept()
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		Expect(sln.Close()).To(Succeed())
+		Eventually(errChan).Should(Receive(MatchError("listener closed")))
+	})
+})
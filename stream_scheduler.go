@@ -0,0 +1,193 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A streamScheduler decides which of the active streams is allowed to send STREAM data next.
+// It is only accessed by the streamFramer, with the streamQueueMutex held.
+type streamScheduler interface {
+	// AddStream adds a stream that has data to send.
+	// It is never called for a stream that was already added and not removed.
+	AddStream(protocol.StreamID)
+	// RemoveStream removes a stream, when it doesn't have any more data to send.
+	RemoveStream(protocol.StreamID)
+	// NextStream returns the stream that should send next.
+	// It must only be called if there's at least one active stream.
+	NextStream() protocol.StreamID
+	// SentData is called after the stream returned by NextStream was asked for data.
+	SentData(id protocol.StreamID, n protocol.ByteCount)
+	// UpdateWeight is called when a weight was set for an active stream, using Stream.SetPriority.
+	UpdateWeight(id protocol.StreamID, weight uint8)
+	// Len returns the number of active streams
+	Len() int
+}
+
+func newStreamScheduler(scheduler StreamScheduler, getWeight func(StreamID) uint8) streamScheduler {
+	switch scheduler {
+	case StreamSchedulerRoundRobin:
+		return &roundRobinScheduler{}
+	case StreamSchedulerFIFO:
+		return &fifoScheduler{}
+	case StreamSchedulerWeightedFair:
+		return newWeightedFairScheduler(getWeight)
+	default:
+		panic(fmt.Sprintf("unknown stream scheduler: %d", scheduler))
+	}
+}
+
+// The roundRobinScheduler lets every stream send once, in the order they became active.
+type roundRobinScheduler struct {
+	queue []protocol.StreamID
+}
+
+var _ streamScheduler = &roundRobinScheduler{}
+
+func (s *roundRobinScheduler) AddStream(id protocol.StreamID) {
+	s.queue = append(s.queue, id)
+}
+
+func (s *roundRobinScheduler) RemoveStream(id protocol.StreamID) {
+	for i, queuedID := range s.queue {
+		if queuedID == id {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *roundRobinScheduler) NextStream() protocol.StreamID {
+	return s.queue[0]
+}
+
+func (s *roundRobinScheduler) SentData(id protocol.StreamID, _ protocol.ByteCount) {
+	// move the stream to the end of the queue
+	s.RemoveStream(id)
+	s.queue = append(s.queue, id)
+}
+
+func (s *roundRobinScheduler) UpdateWeight(protocol.StreamID, uint8) {}
+
+func (s *roundRobinScheduler) Len() int {
+	return len(s.queue)
+}
+
+// The fifoScheduler always lets the stream with the lowest stream ID send,
+// until it doesn't have any more data to send.
+// Since stream IDs are assigned in increasing order, this is the stream that was opened first.
+type fifoScheduler struct {
+	streams []protocol.StreamID // sorted by stream ID
+}
+
+var _ streamScheduler = &fifoScheduler{}
+
+func (s *fifoScheduler) AddStream(id protocol.StreamID) {
+	i := len(s.streams)
+	for i > 0 && s.streams[i-1] > id {
+		i--
+	}
+	s.streams = append(s.streams, 0)
+	copy(s.streams[i+1:], s.streams[i:])
+	s.streams[i] = id
+}
+
+func (s *fifoScheduler) RemoveStream(id protocol.StreamID) {
+	for i, streamID := range s.streams {
+		if streamID == id {
+			s.streams = append(s.streams[:i], s.streams[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *fifoScheduler) NextStream() protocol.StreamID {
+	return s.streams[0]
+}
+
+func (s *fifoScheduler) SentData(protocol.StreamID, protocol.ByteCount) {}
+
+func (s *fifoScheduler) UpdateWeight(protocol.StreamID, uint8) {}
+
+func (s *fifoScheduler) Len() int {
+	return len(s.streams)
+}
+
+// maxStreamWeight is the weight of a stream that is scheduled most often
+const maxStreamWeight = 255
+
+// The weightedFairScheduler shares the bandwidth between the active streams in proportion to their weights.
+// Every stream keeps track of a virtual time, which advances by the amount of data sent, divided by the weight of the stream.
+// The stream with the lowest virtual time is allowed to send next.
+type weightedFairScheduler struct {
+	getWeight func(StreamID) uint8
+
+	streams map[protocol.StreamID]*weightedStream
+	// virtualTime is the virtual time of the stream that was last scheduled.
+	// Streams that become active start at this virtual time.
+	virtualTime uint64
+}
+
+type weightedStream struct {
+	weight      uint64
+	virtualTime uint64
+}
+
+var _ streamScheduler = &weightedFairScheduler{}
+
+func newWeightedFairScheduler(getWeight func(StreamID) uint8) *weightedFairScheduler {
+	return &weightedFairScheduler{
+		getWeight: getWeight,
+		streams:   make(map[protocol.StreamID]*weightedStream),
+	}
+}
+
+func (s *weightedFairScheduler) AddStream(id protocol.StreamID) {
+	weight := uint64(1)
+	if s.getWeight != nil {
+		// a weight of 0 is treated like a weight of 1
+		weight = utils.MaxUint64(uint64(s.getWeight(id)), 1)
+	}
+	s.streams[id] = &weightedStream{weight: weight, virtualTime: s.virtualTime}
+}
+
+func (s *weightedFairScheduler) RemoveStream(id protocol.StreamID) {
+	delete(s.streams, id)
+}
+
+func (s *weightedFairScheduler) NextStream() protocol.StreamID {
+	var next protocol.StreamID
+	var nextStr *weightedStream
+	for id, str := range s.streams {
+		// if multiple streams have the same virtual time, use the one with the lowest stream ID
+		if nextStr == nil || str.virtualTime < nextStr.virtualTime || (str.virtualTime == nextStr.virtualTime && id < next) {
+			next = id
+			nextStr = str
+		}
+	}
+	s.virtualTime = nextStr.virtualTime
+	return next
+}
+
+func (s *weightedFairScheduler) SentData(id protocol.StreamID, n protocol.ByteCount) {
+	str, ok := s.streams[id]
+	if !ok {
+		return
+	}
+	// advance the virtual time even if no data was sent, so that a stream can't block the other streams
+	str.virtualTime += utils.MaxUint64(uint64(n), 1) * maxStreamWeight / str.weight
+}
+
+func (s *weightedFairScheduler) UpdateWeight(id protocol.StreamID, weight uint8) {
+	str, ok := s.streams[id]
+	if !ok {
+		return
+	}
+	str.weight = utils.MaxUint64(uint64(weight), 1)
+}
+
+func (s *weightedFairScheduler) Len() int {
+	return len(s.streams)
+}
@@ -0,0 +1,120 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream Scheduler", func() {
+	It("creates the schedulers", func() {
+		Expect(newStreamScheduler(StreamSchedulerRoundRobin, nil)).To(BeAssignableToTypeOf(&roundRobinScheduler{}))
+		Expect(newStreamScheduler(StreamSchedulerFIFO, nil)).To(BeAssignableToTypeOf(&fifoScheduler{}))
+		Expect(newStreamScheduler(StreamSchedulerWeightedFair, nil)).To(BeAssignableToTypeOf(&weightedFairScheduler{}))
+	})
+
+	Context("round-robin", func() {
+		var s *roundRobinScheduler
+
+		BeforeEach(func() {
+			s = &roundRobinScheduler{}
+		})
+
+		It("moves a stream to the end of the queue after it sent", func() {
+			s.AddStream(5)
+			s.AddStream(3)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(5)))
+			s.SentData(5, 100)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(3)))
+			s.SentData(3, 100)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(5)))
+		})
+
+		It("removes streams", func() {
+			s.AddStream(5)
+			s.AddStream(3)
+			s.AddStream(7)
+			s.RemoveStream(3)
+			Expect(s.Len()).To(Equal(2))
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(5)))
+			s.RemoveStream(5)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(7)))
+		})
+	})
+
+	Context("FIFO", func() {
+		var s *fifoScheduler
+
+		BeforeEach(func() {
+			s = &fifoScheduler{}
+		})
+
+		It("schedules the stream with the lowest stream ID", func() {
+			s.AddStream(7)
+			s.AddStream(3)
+			s.AddStream(5)
+			Expect(s.streams).To(Equal([]protocol.StreamID{3, 5, 7}))
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(3)))
+			s.SentData(3, 100)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(3)))
+			s.RemoveStream(3)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(5)))
+			Expect(s.Len()).To(Equal(2))
+		})
+	})
+
+	Context("weighted fair", func() {
+		It("treats all streams the same, if no weights are set", func() {
+			s := newWeightedFairScheduler(nil)
+			s.AddStream(5)
+			s.AddStream(3)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(3)))
+			s.SentData(3, 100)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(5)))
+			s.SentData(5, 100)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(3)))
+		})
+
+		It("treats a weight of 0 like a weight of 1", func() {
+			s := newWeightedFairScheduler(func(StreamID) uint8 { return 0 })
+			s.AddStream(3)
+			Expect(s.streams[3].weight).To(BeEquivalentTo(1))
+		})
+
+		It("advances the virtual time, if no data was sent", func() {
+			s := newWeightedFairScheduler(nil)
+			s.AddStream(3)
+			s.AddStream(5)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(3)))
+			s.SentData(3, 0)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(5)))
+		})
+
+		It("starts new streams at the current virtual time", func() {
+			s := newWeightedFairScheduler(nil)
+			s.AddStream(3)
+			for i := 0; i < 10; i++ {
+				Expect(s.NextStream()).To(Equal(protocol.StreamID(3)))
+				s.SentData(3, 100)
+			}
+			// stream 5 doesn't get to send 10 times in a row
+			s.AddStream(5)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(5)))
+			s.SentData(5, 100)
+			Expect(s.NextStream()).To(Equal(protocol.StreamID(3)))
+		})
+
+		It("updates the weight of a stream", func() {
+			s := newWeightedFairScheduler(func(StreamID) uint8 { return 10 })
+			s.AddStream(3)
+			s.UpdateWeight(3, 20)
+			Expect(s.streams[3].weight).To(BeEquivalentTo(20))
+			s.UpdateWeight(3, 0)
+			Expect(s.streams[3].weight).To(BeEquivalentTo(1))
+			// streams that are not active are ignored
+			s.UpdateWeight(5, 20)
+			Expect(s.streams).ToNot(HaveKey(protocol.StreamID(5)))
+		})
+	})
+})
@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/wire"
@@ -206,4 +208,54 @@ var _ = Describe("Stream", func() {
 			str.receiveStream.sender.onStreamCompleted(streamID)
 		})
 	})
+
+	Context("exporting and importing the state", func() {
+		It("exports the state", func() {
+			str.writeOffset = 100
+			str.receiveStream.readOffset = 42
+			mockFC.EXPECT().GetState().Return(flowcontrol.State{BytesSent: 100, HighestReceived: 42})
+			state, err := str.exportState()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.streamID).To(Equal(streamID))
+			Expect(state.writeOffset).To(Equal(protocol.ByteCount(100)))
+			Expect(state.readOffset).To(Equal(protocol.ByteCount(42)))
+			Expect(state.flowControl.BytesSent).To(Equal(protocol.ByteCount(100)))
+		})
+
+		It("doesn't export the state when there's data to send", func() {
+			str.dataForWriting = []byte("foobar")
+			_, err := str.exportState()
+			Expect(err).To(MatchError("stream 1337 has data to send"))
+		})
+
+		It("doesn't export the state when there's unread data", func() {
+			mockFC.EXPECT().GetState().Return(flowcontrol.State{HighestReceived: 6})
+			_, err := str.exportState()
+			Expect(err).To(MatchError("stream 1337 has unread data"))
+		})
+
+		It("continues reading at the imported offset", func() {
+			mockFC.EXPECT().SetState(flowcontrol.State{HighestReceived: 10, BytesRead: 10})
+			str.importState(&streamState{streamID: streamID, readOffset: 10, flowControl: flowcontrol.State{HighestReceived: 10, BytesRead: 10}})
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(16), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(6))
+			mockFC.EXPECT().HasWindowUpdate()
+			Expect(str.handleStreamFrame(&wire.StreamFrame{StreamID: streamID, Offset: 10, Data: []byte("foobar")})).To(Succeed())
+			b := make([]byte, 6)
+			n, err := strWithTimeout.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(6))
+			Expect(b).To(Equal([]byte("foobar")))
+		})
+
+		It("imports a half-closed stream", func() {
+			mockFC.EXPECT().SetState(gomock.Any())
+			str.importState(&streamState{streamID: streamID, writeOffset: 100, finSent: true})
+			_, err := strWithTimeout.Write([]byte("foobar"))
+			Expect(err).To(MatchError("write on closed stream 1337"))
+			// the stream is completed when the receive side completes
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			str.receiveStream.sender.onStreamCompleted(streamID)
+		})
+	})
 })
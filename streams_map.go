@@ -1,7 +1,10 @@
 package quic
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
@@ -32,6 +35,16 @@ type streamsMap struct {
 
 var _ streamManager = &streamsMap{}
 
+// streamsMapState is the state of the streams map.
+// It is used to continue the session in another process.
+type streamsMapState struct {
+	nextOutgoingBidi, maxOutgoingBidi                      protocol.StreamID
+	nextIncomingBidi, highestIncomingBidi, maxIncomingBidi protocol.StreamID
+	nextOutgoingUni, maxOutgoingUni                        protocol.StreamID
+	nextIncomingUni, highestIncomingUni, maxIncomingUni    protocol.StreamID
+	streams                                                []*streamState // sorted by stream ID
+}
+
 func newStreamsMap(
 	sender streamSender,
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController,
@@ -124,24 +137,24 @@ func (m *streamsMap) OpenStream() (Stream, error) {
 	return m.outgoingBidiStreams.OpenStream()
 }
 
-func (m *streamsMap) OpenStreamSync() (Stream, error) {
-	return m.outgoingBidiStreams.OpenStreamSync()
+func (m *streamsMap) OpenStreamSync(ctx context.Context) (Stream, error) {
+	return m.outgoingBidiStreams.OpenStreamSync(ctx)
 }
 
 func (m *streamsMap) OpenUniStream() (SendStream, error) {
 	return m.outgoingUniStreams.OpenStream()
 }
 
-func (m *streamsMap) OpenUniStreamSync() (SendStream, error) {
-	return m.outgoingUniStreams.OpenStreamSync()
+func (m *streamsMap) OpenUniStreamSync(ctx context.Context) (SendStream, error) {
+	return m.outgoingUniStreams.OpenStreamSync(ctx)
 }
 
-func (m *streamsMap) AcceptStream() (Stream, error) {
-	return m.incomingBidiStreams.AcceptStream()
+func (m *streamsMap) AcceptStream(ctx context.Context) (Stream, error) {
+	return m.incomingBidiStreams.AcceptStream(ctx)
 }
 
-func (m *streamsMap) AcceptUniStream() (ReceiveStream, error) {
-	return m.incomingUniStreams.AcceptStream()
+func (m *streamsMap) AcceptUniStream(ctx context.Context) (ReceiveStream, error) {
+	return m.incomingUniStreams.AcceptStream(ctx)
 }
 
 func (m *streamsMap) DeleteStream(id protocol.StreamID) error {
@@ -191,17 +204,15 @@ func (m *streamsMap) GetOrOpenSendStream(id protocol.StreamID) (sendStreamI, err
 	}
 }
 
-func (m *streamsMap) HandleMaxStreamIDFrame(f *wire.MaxStreamIDFrame) error {
+func (m *streamsMap) HandleMaxStreamIDFrame(f *wire.MaxStreamIDFrame) (bool, error) {
 	id := f.StreamID
 	switch m.getStreamType(id) {
 	case streamTypeOutgoingBidi:
-		m.outgoingBidiStreams.SetMaxStream(id)
-		return nil
+		return m.outgoingBidiStreams.SetMaxStream(id), nil
 	case streamTypeOutgoingUni:
-		m.outgoingUniStreams.SetMaxStream(id)
-		return nil
+		return m.outgoingUniStreams.SetMaxStream(id), nil
 	default:
-		return fmt.Errorf("received MAX_STREAM_DATA frame for incoming stream %d", id)
+		return false, fmt.Errorf("received MAX_STREAM_DATA frame for incoming stream %d", id)
 	}
 }
 
@@ -216,9 +227,69 @@ func (m *streamsMap) UpdateLimits(p *handshake.TransportParameters) {
 	m.outgoingUniStreams.SetMaxStream(protocol.MaxUniStreamID(int(p.MaxUniStreams), peerPers))
 }
 
+func (m *streamsMap) StreamLimits() (protocol.StreamID, protocol.StreamID) {
+	return m.outgoingBidiStreams.MaxStreamID(), m.outgoingUniStreams.MaxStreamID()
+}
+
 func (m *streamsMap) CloseWithError(err error) {
 	m.outgoingBidiStreams.CloseWithError(err)
 	m.outgoingUniStreams.CloseWithError(err)
 	m.incomingBidiStreams.CloseWithError(err)
 	m.incomingUniStreams.CloseWithError(err)
 }
+
+func (m *streamsMap) exportState() (*streamsMapState, error) {
+	state := &streamsMapState{}
+	var outgoingBidi, incomingBidi []streamI
+	var outgoingUni []sendStreamI
+	var incomingUni []receiveStreamI
+	state.nextOutgoingBidi, state.maxOutgoingBidi, outgoingBidi = m.outgoingBidiStreams.getState()
+	state.nextIncomingBidi, state.highestIncomingBidi, state.maxIncomingBidi, incomingBidi = m.incomingBidiStreams.getState()
+	state.nextOutgoingUni, state.maxOutgoingUni, outgoingUni = m.outgoingUniStreams.getState()
+	state.nextIncomingUni, state.highestIncomingUni, state.maxIncomingUni, incomingUni = m.incomingUniStreams.getState()
+	if len(outgoingUni) > 0 || len(incomingUni) > 0 {
+		return nil, errors.New("can't export open unidirectional streams")
+	}
+	for _, str := range append(outgoingBidi, incomingBidi...) {
+		strState, err := str.exportState()
+		if err != nil {
+			return nil, err
+		}
+		state.streams = append(state.streams, strState)
+	}
+	sort.Slice(state.streams, func(i, j int) bool { return state.streams[i].streamID < state.streams[j].streamID })
+	return state, nil
+}
+
+// importState restores the state exported by another process.
+// It returns the streams that were opened or accepted by the application.
+// Incoming streams that weren't accepted yet are returned by AcceptStream.
+func (m *streamsMap) importState(state *streamsMapState) []Stream {
+	var outgoingIDs, incomingIDs []protocol.StreamID
+	for _, strState := range state.streams {
+		if m.getStreamType(strState.streamID) == streamTypeOutgoingBidi {
+			outgoingIDs = append(outgoingIDs, strState.streamID)
+		} else {
+			incomingIDs = append(incomingIDs, strState.streamID)
+		}
+	}
+	streams := make(map[protocol.StreamID]streamI, len(state.streams))
+	for _, str := range m.outgoingBidiStreams.setState(state.nextOutgoingBidi, state.maxOutgoingBidi, outgoingIDs) {
+		streams[str.StreamID()] = str
+	}
+	for _, str := range m.incomingBidiStreams.setState(state.nextIncomingBidi, state.highestIncomingBidi, state.maxIncomingBidi, incomingIDs) {
+		streams[str.StreamID()] = str
+	}
+	m.outgoingUniStreams.setState(state.nextOutgoingUni, state.maxOutgoingUni, nil)
+	m.incomingUniStreams.setState(state.nextIncomingUni, state.highestIncomingUni, state.maxIncomingUni, nil)
+
+	var accepted []Stream
+	for _, strState := range state.streams {
+		str := streams[strState.streamID]
+		str.importState(strState)
+		if m.getStreamType(strState.streamID) == streamTypeOutgoingBidi || strState.streamID < state.nextIncomingBidi {
+			accepted = append(accepted, str)
+		}
+	}
+	return accepted
+}
@@ -1,6 +1,11 @@
 package quic
 
-import "github.com/cheekybits/genny/generic"
+import (
+	"context"
+	"sync"
+
+	"github.com/cheekybits/genny/generic"
+)
 
 // In the auto-generated streams maps, we need to be able to close the streams.
 // Therefore, extend the generic.Type with the stream close method.
@@ -9,3 +14,22 @@ type item interface {
 	generic.Type
 	closeForShutdown(error)
 }
+
+// broadcastOnCancel wakes up all goroutines waiting for the cond when the context is canceled.
+// The returned function must be called as soon as the caller stops waiting for the cond.
+func broadcastOnCancel(ctx context.Context, cond *sync.Cond) func() {
+	if ctx.Done() == nil { // this context can never be canceled
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cond.L.Lock()
+			cond.Broadcast()
+			cond.L.Unlock()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
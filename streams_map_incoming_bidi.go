@@ -5,6 +5,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -48,7 +49,8 @@ func newIncomingBidiStreamsMap(
 	return m
 }
 
-func (m *incomingBidiStreamsMap) AcceptStream() (streamI, error) {
+func (m *incomingBidiStreamsMap) AcceptStream(ctx context.Context) (streamI, error) {
+	defer broadcastOnCancel(ctx, &m.cond)()
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -58,6 +60,9 @@ func (m *incomingBidiStreamsMap) AcceptStream() (streamI, error) {
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, ok = m.streams[m.nextStream]
 		if ok {
 			break
@@ -129,3 +134,34 @@ func (m *incomingBidiStreamsMap) CloseWithError(err error) {
 	m.mutex.Unlock()
 	m.cond.Broadcast()
 }
+
+// getState returns the state of the map, and the streams that are currently open.
+// It is used to continue the session in another process.
+func (m *incomingBidiStreamsMap) getState() (nextStream, highestStream, maxStream protocol.StreamID, streams []streamI) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, str := range m.streams {
+		streams = append(streams, str)
+	}
+	return m.nextStream, m.highestStream, m.maxStream, streams
+}
+
+// setState restores the state of the map, and opens the streams with the given IDs.
+// The streams with IDs starting at nextStream are returned by AcceptStream.
+// It must be called before any stream is opened.
+func (m *incomingBidiStreamsMap) setState(nextStream, highestStream, maxStream protocol.StreamID, ids []protocol.StreamID) []streamI {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.nextStream = nextStream
+	m.highestStream = highestStream
+	m.maxStream = maxStream
+	streams := make([]streamI, 0, len(ids))
+	for _, id := range ids {
+		str := m.newStream(id)
+		m.streams[id] = str
+		streams = append(streams, str)
+	}
+	return streams
+}
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -46,7 +47,8 @@ func newIncomingItemsMap(
 	return m
 }
 
-func (m *incomingItemsMap) AcceptStream() (item, error) {
+func (m *incomingItemsMap) AcceptStream(ctx context.Context) (item, error) {
+	defer broadcastOnCancel(ctx, &m.cond)()
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -56,6 +58,9 @@ func (m *incomingItemsMap) AcceptStream() (item, error) {
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, ok = m.streams[m.nextStream]
 		if ok {
 			break
@@ -127,3 +132,34 @@ func (m *incomingItemsMap) CloseWithError(err error) {
 	m.mutex.Unlock()
 	m.cond.Broadcast()
 }
+
+// getState returns the state of the map, and the streams that are currently open.
+// It is used to continue the session in another process.
+func (m *incomingItemsMap) getState() (nextStream, highestStream, maxStream protocol.StreamID, streams []item) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, str := range m.streams {
+		streams = append(streams, str)
+	}
+	return m.nextStream, m.highestStream, m.maxStream, streams
+}
+
+// setState restores the state of the map, and opens the streams with the given IDs.
+// The streams with IDs starting at nextStream are returned by AcceptStream.
+// It must be called before any stream is opened.
+func (m *incomingItemsMap) setState(nextStream, highestStream, maxStream protocol.StreamID, ids []protocol.StreamID) []item {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.nextStream = nextStream
+	m.highestStream = highestStream
+	m.maxStream = maxStream
+	streams := make([]item, 0, len(ids))
+	for _, id := range ids {
+		str := m.newStream(id)
+		m.streams[id] = str
+		streams = append(streams, str)
+	}
+	return streams
+}
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -168,7 +169,8 @@ func (m *streamsMapLegacy) OpenStream() (Stream, error) {
 	return m.openStreamImpl()
 }
 
-func (m *streamsMapLegacy) OpenStreamSync() (Stream, error) {
+func (m *streamsMapLegacy) OpenStreamSync(ctx context.Context) (Stream, error) {
+	defer broadcastOnCancel(ctx, &m.openStreamOrErrCond)()
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -176,6 +178,9 @@ func (m *streamsMapLegacy) OpenStreamSync() (Stream, error) {
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, err := m.openStreamImpl()
 		if err == nil {
 			return str, err
@@ -191,13 +196,14 @@ func (m *streamsMapLegacy) OpenUniStream() (SendStream, error) {
 	return nil, errors.New("gQUIC doesn't support unidirectional streams")
 }
 
-func (m *streamsMapLegacy) OpenUniStreamSync() (SendStream, error) {
+func (m *streamsMapLegacy) OpenUniStreamSync(context.Context) (SendStream, error) {
 	return nil, errors.New("gQUIC doesn't support unidirectional streams")
 }
 
 // AcceptStream returns the next stream opened by the peer
 // it blocks until a new stream is opened
-func (m *streamsMapLegacy) AcceptStream() (Stream, error) {
+func (m *streamsMapLegacy) AcceptStream(ctx context.Context) (Stream, error) {
+	defer broadcastOnCancel(ctx, &m.nextStreamOrErrCond)()
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	var str streamI
@@ -206,6 +212,9 @@ func (m *streamsMapLegacy) AcceptStream() (Stream, error) {
 		if m.closeErr != nil {
 			return nil, m.closeErr
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, ok = m.streams[m.nextStreamToAccept]
 		if ok {
 			break
@@ -216,7 +225,7 @@ func (m *streamsMapLegacy) AcceptStream() (Stream, error) {
 	return str, nil
 }
 
-func (m *streamsMapLegacy) AcceptUniStream() (ReceiveStream, error) {
+func (m *streamsMapLegacy) AcceptUniStream(context.Context) (ReceiveStream, error) {
 	return nil, errors.New("gQUIC doesn't support unidirectional streams")
 }
 
@@ -271,7 +280,22 @@ func (m *streamsMapLegacy) UpdateLimits(params *handshake.TransportParameters) {
 	m.openStreamOrErrCond.Broadcast()
 }
 
+// gQUIC doesn't limit the stream IDs that can be opened
+func (m *streamsMapLegacy) StreamLimits() (protocol.StreamID, protocol.StreamID) {
+	return 0, 0
+}
+
 // should never be called, since MAX_STREAM_ID frames can only be unpacked for IETF QUIC
-func (m *streamsMapLegacy) HandleMaxStreamIDFrame(f *wire.MaxStreamIDFrame) error {
-	return errors.New("gQUIC doesn't have MAX_STREAM_ID frames")
+func (m *streamsMapLegacy) HandleMaxStreamIDFrame(f *wire.MaxStreamIDFrame) (bool, error) {
+	return false, errors.New("gQUIC doesn't have MAX_STREAM_ID frames")
+}
+
+// gQUIC sessions can't be continued in another process
+func (m *streamsMapLegacy) exportState() (*streamsMapState, error) {
+	return nil, errors.New("gQUIC sessions can't be exported")
+}
+
+// should never be called, since exportState never returns a state
+func (m *streamsMapLegacy) importState(*streamsMapState) []Stream {
+	panic("gQUIC sessions can't be imported")
 }
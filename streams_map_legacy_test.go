@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 
 	"github.com/golang/mock/gomock"
@@ -226,7 +227,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 						go func() {
 							defer GinkgoRecover()
 							var err error
-							str, err = m.OpenStreamSync()
+							str, err = m.OpenStreamSync(context.Background())
 							Expect(err).ToNot(HaveOccurred())
 							close(done)
 						}()
@@ -246,7 +247,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 						done := make(chan struct{})
 						go func() {
 							defer GinkgoRecover()
-							_, err := m.OpenStreamSync()
+							_, err := m.OpenStreamSync(context.Background())
 							Expect(err).To(MatchError(testErr))
 							close(done)
 						}()
@@ -256,10 +257,26 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 						Eventually(done).Should(BeClosed())
 					})
 
+					It("stops waiting when the context is canceled", func() {
+						openMaxNumStreams()
+						ctx, cancel := context.WithCancel(context.Background())
+						done := make(chan struct{})
+						go func() {
+							defer GinkgoRecover()
+							_, err := m.OpenStreamSync(ctx)
+							Expect(err).To(MatchError(context.Canceled))
+							close(done)
+						}()
+
+						Consistently(done).ShouldNot(BeClosed())
+						cancel()
+						Eventually(done).Should(BeClosed())
+					})
+
 					It("immediately returns when OpenStreamSync is called after an error was registered", func() {
 						testErr := errors.New("test error")
 						m.CloseWithError(testErr)
-						_, err := m.OpenStreamSync()
+						_, err := m.OpenStreamSync(context.Background())
 						Expect(err).To(MatchError(testErr))
 					})
 				})
@@ -269,7 +286,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 				It("does nothing if no stream is opened", func() {
 					var accepted bool
 					go func() {
-						_, _ = m.AcceptStream()
+						_, _ = m.AcceptStream(context.Background())
 						accepted = true
 					}()
 					Consistently(func() bool { return accepted }).Should(BeFalse())
@@ -281,7 +298,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					go func() {
 						defer GinkgoRecover()
 						var err error
-						str, err = m.AcceptStream()
+						str, err = m.AcceptStream(context.Background())
 						Expect(err).ToNot(HaveOccurred())
 						close(done)
 					}()
@@ -297,7 +314,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					go func() {
 						defer GinkgoRecover()
 						var err error
-						str, err = m.AcceptStream()
+						str, err = m.AcceptStream(context.Background())
 						Expect(err).ToNot(HaveOccurred())
 						close(done)
 					}()
@@ -314,14 +331,14 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					go func() {
 						defer GinkgoRecover()
 						var err error
-						str1, err = m.AcceptStream()
+						str1, err = m.AcceptStream(context.Background())
 						Expect(err).ToNot(HaveOccurred())
 						close(done1)
 					}()
 					go func() {
 						defer GinkgoRecover()
 						var err error
-						str2, err = m.AcceptStream()
+						str2, err = m.AcceptStream(context.Background())
 						Expect(err).ToNot(HaveOccurred())
 						close(done2)
 					}()
@@ -339,7 +356,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					go func() {
 						defer GinkgoRecover()
 						var err error
-						str, err = m.AcceptStream()
+						str, err = m.AcceptStream(context.Background())
 						Expect(err).ToNot(HaveOccurred())
 						close(done)
 					}()
@@ -356,7 +373,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					go func() {
 						defer GinkgoRecover()
 						var err error
-						str, err = m.AcceptStream()
+						str, err = m.AcceptStream(context.Background())
 						Expect(err).ToNot(HaveOccurred())
 						close(done)
 					}()
@@ -364,7 +381,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Eventually(done).Should(BeClosed())
 					Expect(str.StreamID()).To(Equal(protocol.StreamID(3)))
-					str, err = m.AcceptStream()
+					str, err = m.AcceptStream(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str.StreamID()).To(Equal(protocol.StreamID(5)))
 				})
@@ -372,13 +389,13 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 				It("blocks after accepting a stream", func() {
 					_, err := m.getOrOpenStream(3)
 					Expect(err).ToNot(HaveOccurred())
-					str, err := m.AcceptStream()
+					str, err := m.AcceptStream(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str.StreamID()).To(Equal(protocol.StreamID(3)))
 					done := make(chan struct{})
 					go func() {
 						defer GinkgoRecover()
-						_, _ = m.AcceptStream()
+						_, _ = m.AcceptStream(context.Background())
 						close(done)
 					}()
 					Consistently(done).ShouldNot(BeClosed())
@@ -393,7 +410,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					done := make(chan struct{})
 					go func() {
 						defer GinkgoRecover()
-						_, err := m.AcceptStream()
+						_, err := m.AcceptStream(context.Background())
 						Expect(err).To(MatchError(testErr))
 						close(done)
 					}()
@@ -401,10 +418,24 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					m.CloseWithError(testErr)
 					Eventually(done).Should(BeClosed())
 				})
+				It("stops waiting when the context is canceled", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					done := make(chan struct{})
+					go func() {
+						defer GinkgoRecover()
+						_, err := m.AcceptStream(ctx)
+						Expect(err).To(MatchError(context.Canceled))
+						close(done)
+					}()
+					Consistently(done).ShouldNot(BeClosed())
+					cancel()
+					Eventually(done).Should(BeClosed())
+				})
+
 				It("immediately returns when Accept is called after an error was registered", func() {
 					testErr := errors.New("testErr")
 					m.CloseWithError(testErr)
-					_, err := m.AcceptStream()
+					_, err := m.AcceptStream(context.Background())
 					Expect(err).To(MatchError(testErr))
 				})
 			})
@@ -496,7 +527,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 					go func() {
 						defer GinkgoRecover()
 						var err error
-						str, err = m.AcceptStream()
+						str, err = m.AcceptStream(context.Background())
 						Expect(err).ToNot(HaveOccurred())
 						close(done)
 					}()
@@ -559,6 +590,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 	})
 
 	It("doesn't accept MAX_STREAM_ID frames", func() {
-		Expect(m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{})).ToNot(Succeed())
+		_, err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{})
+		Expect(err).To(HaveOccurred())
 	})
 })
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -49,11 +50,18 @@ func (m *outgoingItemsMap) OpenStream() (item, error) {
 	return m.openStreamImpl()
 }
 
-func (m *outgoingItemsMap) OpenStreamSync() (item, error) {
+func (m *outgoingItemsMap) OpenStreamSync(ctx context.Context) (item, error) {
+	defer broadcastOnCancel(ctx, &m.cond)()
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	for {
+		if m.closeErr != nil {
+			return nil, m.closeErr
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		str, err := m.openStreamImpl()
 		if err == nil {
 			return str, err
@@ -104,13 +112,24 @@ func (m *outgoingItemsMap) DeleteStream(id protocol.StreamID) error {
 	return nil
 }
 
-func (m *outgoingItemsMap) SetMaxStream(id protocol.StreamID) {
+// SetMaxStream raises the maximum stream ID we're allowed to open.
+// It returns false if the limit wasn't raised, e.g. for a reordered MAX_STREAM_ID frame.
+func (m *outgoingItemsMap) SetMaxStream(id protocol.StreamID) bool {
 	m.mutex.Lock()
-	if id > m.maxStream {
-		m.maxStream = id
-		m.cond.Broadcast()
+	defer m.mutex.Unlock()
+	if id <= m.maxStream {
+		return false
 	}
-	m.mutex.Unlock()
+	m.maxStream = id
+	m.cond.Broadcast()
+	return true
+}
+
+// MaxStreamID returns the maximum stream ID we're allowed to open
+func (m *outgoingItemsMap) MaxStreamID() protocol.StreamID {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.maxStream
 }
 
 func (m *outgoingItemsMap) CloseWithError(err error) {
@@ -122,3 +141,32 @@ func (m *outgoingItemsMap) CloseWithError(err error) {
 	m.cond.Broadcast()
 	m.mutex.Unlock()
 }
+
+// getState returns the state of the map, and the streams that are currently open.
+// It is used to continue the session in another process.
+func (m *outgoingItemsMap) getState() (nextStream, maxStream protocol.StreamID, streams []item) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, str := range m.streams {
+		streams = append(streams, str)
+	}
+	return m.nextStream, m.maxStream, streams
+}
+
+// setState restores the state of the map, and opens the streams with the given IDs.
+// It must be called before any stream is opened.
+func (m *outgoingItemsMap) setState(nextStream, maxStream protocol.StreamID, ids []protocol.StreamID) []item {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.nextStream = nextStream
+	m.maxStream = maxStream
+	streams := make([]item, 0, len(ids))
+	for _, id := range ids {
+		str := m.newStream(id)
+		m.streams[id] = str
+		streams = append(streams, str)
+	}
+	return streams
+}
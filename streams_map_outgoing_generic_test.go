@@ -1,7 +1,9 @@
 package quic
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -111,7 +113,7 @@ var _ = Describe("Streams Map (outgoing)", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				str, err := m.OpenStreamSync()
+				str, err := m.OpenStreamSync(context.Background())
 				Expect(err).ToNot(HaveOccurred())
 				Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream))
 				close(done)
@@ -122,13 +124,34 @@ var _ = Describe("Streams Map (outgoing)", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("stops opening synchronously when the context is canceled", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := m.OpenStreamSync(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			// the stream ID was not used
+			m.SetMaxStream(firstNewStream)
+			str, err := m.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream))
+		})
+
+		It("doesn't open a stream, if the context is already canceled", func() {
+			m.SetMaxStream(firstNewStream)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := m.OpenStreamSync(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
 		It("stops opening synchronously when it is closed", func() {
 			mockSender.EXPECT().queueControlFrame(gomock.Any())
 			testErr := errors.New("test error")
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				_, err := m.OpenStreamSync()
+				_, err := m.OpenStreamSync(context.Background())
 				Expect(err).To(MatchError(testErr))
 				close(done)
 			}()
@@ -139,8 +162,9 @@ var _ = Describe("Streams Map (outgoing)", func() {
 		})
 
 		It("doesn't reduce the stream limit", func() {
-			m.SetMaxStream(firstNewStream)
-			m.SetMaxStream(firstNewStream - 4)
+			Expect(m.SetMaxStream(firstNewStream)).To(BeTrue())
+			Expect(m.SetMaxStream(firstNewStream - 4)).To(BeFalse())
+			Expect(m.SetMaxStream(firstNewStream)).To(BeFalse())
 			str, err := m.OpenStream()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream))
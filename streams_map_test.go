@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -104,7 +105,7 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 				It("accepts bidirectional streams", func() {
 					_, err := m.GetOrOpenReceiveStream(ids.firstIncomingBidiStream)
 					Expect(err).ToNot(HaveOccurred())
-					str, err := m.AcceptStream()
+					str, err := m.AcceptStream(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str).To(BeAssignableToTypeOf(&stream{}))
 					Expect(str.StreamID()).To(Equal(ids.firstIncomingBidiStream))
@@ -113,7 +114,7 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 				It("accepts unidirectional streams", func() {
 					_, err := m.GetOrOpenReceiveStream(ids.firstIncomingUniStream)
 					Expect(err).ToNot(HaveOccurred())
-					str, err := m.AcceptUniStream()
+					str, err := m.AcceptUniStream(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str).To(BeAssignableToTypeOf(&receiveStream{}))
 					Expect(str.StreamID()).To(Equal(ids.firstIncomingUniStream))
@@ -300,8 +301,9 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 				It("processes IDs for outgoing bidirectional streams", func() {
 					_, err := m.OpenStream()
 					Expect(err).To(MatchError(qerr.TooManyOpenStreams))
-					err = m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingBidiStream})
+					raised, err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingBidiStream})
 					Expect(err).ToNot(HaveOccurred())
+					Expect(raised).To(BeTrue())
 					str, err := m.OpenStream()
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str.StreamID()).To(Equal(ids.firstOutgoingBidiStream))
@@ -310,22 +312,52 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 				It("processes IDs for outgoing bidirectional streams", func() {
 					_, err := m.OpenUniStream()
 					Expect(err).To(MatchError(qerr.TooManyOpenStreams))
-					err = m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingUniStream})
+					raised, err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingUniStream})
 					Expect(err).ToNot(HaveOccurred())
+					Expect(raised).To(BeTrue())
 					str, err := m.OpenUniStream()
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str.StreamID()).To(Equal(ids.firstOutgoingUniStream))
 				})
 
 				It("rejects IDs for incoming bidirectional streams", func() {
-					err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstIncomingBidiStream})
+					_, err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstIncomingBidiStream})
 					Expect(err).To(MatchError(fmt.Sprintf("received MAX_STREAM_DATA frame for incoming stream %d", ids.firstIncomingBidiStream)))
 				})
 
 				It("rejects IDs for incoming unidirectional streams", func() {
-					err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstIncomingUniStream})
+					_, err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstIncomingUniStream})
 					Expect(err).To(MatchError(fmt.Sprintf("received MAX_STREAM_DATA frame for incoming stream %d", ids.firstIncomingUniStream)))
 				})
+
+				It("reports the stream limits", func() {
+					bidiLimit, uniLimit := m.StreamLimits()
+					Expect(bidiLimit).To(BeZero())
+					Expect(uniLimit).To(BeZero())
+					_, err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingBidiStream + 4})
+					Expect(err).ToNot(HaveOccurred())
+					_, err = m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingUniStream + 8})
+					Expect(err).ToNot(HaveOccurred())
+					bidiLimit, uniLimit = m.StreamLimits()
+					Expect(bidiLimit).To(Equal(ids.firstOutgoingBidiStream + 4))
+					Expect(uniLimit).To(Equal(ids.firstOutgoingUniStream + 8))
+				})
+
+				It("reports if the stream limit was raised", func() {
+					raised, err := m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingBidiStream + 4})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(raised).To(BeTrue())
+					// duplicate frame
+					raised, err = m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingBidiStream + 4})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(raised).To(BeFalse())
+					// reordered frame
+					raised, err = m.HandleMaxStreamIDFrame(&wire.MaxStreamIDFrame{StreamID: ids.firstOutgoingBidiStream})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(raised).To(BeFalse())
+					bidiLimit, _ := m.StreamLimits()
+					Expect(bidiLimit).To(Equal(ids.firstOutgoingBidiStream + 4))
+				})
 			})
 
 			Context("sending MAX_STREAM_ID frames", func() {
@@ -348,6 +380,66 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 				})
 			})
 
+			Context("exporting and importing the state", func() {
+				newFlowController := func(protocol.StreamID) flowcontrol.StreamFlowController {
+					fc := mocks.NewMockStreamFlowController(mockCtrl)
+					fc.EXPECT().GetState().AnyTimes()
+					fc.EXPECT().SetState(gomock.Any()).AnyTimes()
+					return fc
+				}
+
+				BeforeEach(func() {
+					m = newStreamsMap(mockSender, newFlowController, maxBidiStreams, maxUniStreams, perspective, versionIETFFrames).(*streamsMap)
+					allowUnlimitedStreams()
+				})
+
+				It("exports the bidirectional streams", func() {
+					_, err := m.OpenStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = m.GetOrOpenReceiveStream(ids.firstIncomingBidiStream)
+					Expect(err).ToNot(HaveOccurred())
+					state, err := m.exportState()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(state.streams).To(HaveLen(2))
+					Expect(state.streams[0].streamID).To(BeNumerically("<", state.streams[1].streamID))
+					Expect(state.nextOutgoingBidi).To(Equal(ids.firstOutgoingBidiStream + 4))
+					Expect(state.highestIncomingBidi).To(Equal(ids.firstIncomingBidiStream))
+				})
+
+				It("doesn't export open unidirectional streams", func() {
+					_, err := m.OpenUniStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = m.exportState()
+					Expect(err).To(MatchError("can't export open unidirectional streams"))
+				})
+
+				It("imports the state", func() {
+					outgoing, err := m.OpenStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = m.GetOrOpenReceiveStream(ids.firstIncomingBidiStream + 4)
+					Expect(err).ToNot(HaveOccurred())
+					accepted, err := m.AcceptStream(context.Background())
+					Expect(err).ToNot(HaveOccurred())
+					state, err := m.exportState()
+					Expect(err).ToNot(HaveOccurred())
+
+					imported := newStreamsMap(mockSender, newFlowController, maxBidiStreams, maxUniStreams, perspective, versionIETFFrames).(*streamsMap)
+					streams := imported.importState(state)
+					Expect(streams).To(HaveLen(2))
+					Expect([]protocol.StreamID{streams[0].StreamID(), streams[1].StreamID()}).To(ConsistOf(outgoing.StreamID(), accepted.StreamID()))
+					// the stream that wasn't accepted yet is returned by AcceptStream
+					str, err := imported.AcceptStream(context.Background())
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.StreamID()).To(Equal(ids.firstIncomingBidiStream + 4))
+					str, err = imported.OpenStream()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.StreamID()).To(Equal(ids.firstOutgoingBidiStream + 4))
+					uniStr, err := imported.OpenUniStream()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(uniStr.StreamID()).To(Equal(ids.firstOutgoingUniStream))
+				})
+			})
+
 			It("closes", func() {
 				testErr := errors.New("test error")
 				m.CloseWithError(testErr)
@@ -355,9 +447,9 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 				Expect(err).To(MatchError(testErr))
 				_, err = m.OpenUniStream()
 				Expect(err).To(MatchError(testErr))
-				_, err = m.AcceptStream()
+				_, err = m.AcceptStream(context.Background())
 				Expect(err).To(MatchError(testErr))
-				_, err = m.AcceptUniStream()
+				_, err = m.AcceptUniStream(context.Background())
 				Expect(err).To(MatchError(testErr))
 			})
 		})
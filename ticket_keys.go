@@ -0,0 +1,84 @@
+package quic
+
+import (
+	"crypto/tls"
+
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+)
+
+// TicketKeyLen is the length of the keys used by TicketKeys.
+const TicketKeyLen = handshake.TokenProtectorKeyLen
+
+// TicketKeys are the keys that a server uses to encrypt the tokens it issues (the STKs for gQUIC, and the tokens
+// sent in Retry and NEW_TOKEN frames for IETF QUIC), and the TLS session tickets if the crypto/tls stack is used.
+// New tokens and tickets are encrypted with the first key, and the ones encrypted with any of the keys are accepted.
+// By sharing the keys, a fleet of servers accepts each other's tokens and tickets,
+// and can rotate the keys periodically without breaking resumption:
+// a new key is added at the front, and the oldest key is removed once the tokens and tickets it encrypted expired.
+// TicketKeys are safe for concurrent use. The keys can be rotated while a server is using them.
+type TicketKeys struct {
+	tokens  *handshake.TokenProtector
+	cookies *handshake.TokenProtector
+	tickets *handshake.TokenProtector
+}
+
+// NewTicketKeys creates new TicketKeys. At least one key is required.
+// The keys must be kept secret, and should be randomly generated.
+func NewTicketKeys(keys [][TicketKeyLen]byte) (*TicketKeys, error) {
+	tokens, err := handshake.NewTokenProtector("quic-go token", keys)
+	if err != nil {
+		return nil, err
+	}
+	cookies, err := handshake.NewTokenProtector("quic-go cookie", keys)
+	if err != nil {
+		return nil, err
+	}
+	tickets, err := handshake.NewTokenProtector("quic-go session ticket", keys)
+	if err != nil {
+		return nil, err
+	}
+	return &TicketKeys{tokens: tokens, cookies: cookies, tickets: tickets}, nil
+}
+
+// SetKeys replaces the keys. At least one key is required.
+func (k *TicketKeys) SetKeys(keys [][TicketKeyLen]byte) error {
+	if err := k.tokens.SetKeys(keys); err != nil {
+		return err
+	}
+	if err := k.cookies.SetKeys(keys); err != nil {
+		return err
+	}
+	return k.tickets.SetKeys(keys)
+}
+
+// configureTLS returns a copy of the tls.Config that encrypts the session tickets using the keys.
+// If the tls.Config already wraps the session tickets itself, it is returned unchanged.
+func (k *TicketKeys) configureTLS(tlsConf *tls.Config) *tls.Config {
+	if tlsConf == nil {
+		tlsConf = &tls.Config{}
+	}
+	if tlsConf.WrapSession != nil || tlsConf.UnwrapSession != nil {
+		return tlsConf
+	}
+	conf := tlsConf.Clone()
+	conf.WrapSession = func(_ tls.ConnectionState, state *tls.SessionState) ([]byte, error) {
+		data, err := state.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		return k.tickets.NewToken(data)
+	}
+	conf.UnwrapSession = func(identity []byte, _ tls.ConnectionState) (*tls.SessionState, error) {
+		data, err := k.tickets.DecodeToken(identity)
+		if err != nil {
+			// a ticket that can't be decrypted is ignored, and a full handshake is performed
+			return nil, nil
+		}
+		state, err := tls.ParseSessionState(data)
+		if err != nil {
+			return nil, nil
+		}
+		return state, nil
+	}
+	return conf
+}
@@ -0,0 +1,104 @@
+package quic
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ticket Keys", func() {
+	var key1, key2 [TicketKeyLen]byte
+
+	BeforeEach(func() {
+		copy(key1[:], "foobar")
+		copy(key2[:], "raboof")
+	})
+
+	// handshake performs a TLS handshake, and says if the session was resumed
+	handshake := func(serverConf, clientConf *tls.Config) bool {
+		cconn, sconn := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			server := tls.Server(sconn, serverConf)
+			Expect(server.Handshake()).To(Succeed())
+			_, err := server.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		client := tls.Client(cconn, clientConf)
+		Expect(client.Handshake()).To(Succeed())
+		// reading processes the session ticket, which is sent before the data
+		_, err := client.Read(make([]byte, 6))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(done).Should(BeClosed())
+		cconn.Close()
+		sconn.Close()
+		return client.ConnectionState().DidResume
+	}
+
+	newClientConf := func() *tls.Config {
+		return &tls.Config{
+			ServerName:         "quic.clemente.io",
+			InsecureSkipVerify: true,
+			ClientSessionCache: tls.NewLRUClientSessionCache(1),
+			// crypto/tls doesn't resume sessions if the certificate expired, which the test certificate did
+			Time: func() time.Time { return time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC) },
+		}
+	}
+
+	It("requires at least one key", func() {
+		_, err := NewTicketKeys(nil)
+		Expect(err).To(HaveOccurred())
+		keys, err := NewTicketKeys([][TicketKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(keys.SetKeys(nil)).ToNot(Succeed())
+	})
+
+	It("resumes sessions on servers that share the keys", func() {
+		keys1, err := NewTicketKeys([][TicketKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		keys2, err := NewTicketKeys([][TicketKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		clientConf := newClientConf()
+		Expect(handshake(keys1.configureTLS(testdata.GetTLSConfig()), clientConf)).To(BeFalse())
+		Expect(handshake(keys2.configureTLS(testdata.GetTLSConfig()), clientConf)).To(BeTrue())
+	})
+
+	It("doesn't resume sessions on servers using other keys", func() {
+		keys1, err := NewTicketKeys([][TicketKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		keys2, err := NewTicketKeys([][TicketKeyLen]byte{key2})
+		Expect(err).ToNot(HaveOccurred())
+		clientConf := newClientConf()
+		Expect(handshake(keys1.configureTLS(testdata.GetTLSConfig()), clientConf)).To(BeFalse())
+		Expect(handshake(keys2.configureTLS(testdata.GetTLSConfig()), clientConf)).To(BeFalse())
+	})
+
+	It("accepts tickets encrypted with old keys after a rotation", func() {
+		keys, err := NewTicketKeys([][TicketKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		serverConf := keys.configureTLS(testdata.GetTLSConfig())
+		clientConf := newClientConf()
+		Expect(handshake(serverConf, clientConf)).To(BeFalse())
+		Expect(keys.SetKeys([][TicketKeyLen]byte{key2, key1})).To(Succeed())
+		Expect(handshake(serverConf, clientConf)).To(BeTrue())
+		// the ticket issued now was encrypted with the new key
+		Expect(keys.SetKeys([][TicketKeyLen]byte{key2})).To(Succeed())
+		Expect(handshake(serverConf, clientConf)).To(BeTrue())
+	})
+
+	It("doesn't change tls.Configs that wrap session tickets themselves", func() {
+		keys, err := NewTicketKeys([][TicketKeyLen]byte{key1})
+		Expect(err).ToNot(HaveOccurred())
+		conf := &tls.Config{WrapSession: func(tls.ConnectionState, *tls.SessionState) ([]byte, error) { return nil, nil }}
+		Expect(keys.configureTLS(conf)).To(BeIdenticalTo(conf))
+		conf = &tls.Config{}
+		Expect(keys.configureTLS(conf)).ToNot(BeIdenticalTo(conf))
+		Expect(conf.WrapSession).To(BeNil())
+	})
+})
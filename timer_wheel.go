@@ -0,0 +1,227 @@
+package quic
+
+import (
+	"math/bits"
+	"time"
+)
+
+// A timerWheel is a hashed timer wheel.
+// Timers are put into the slot of the tick they expire at, so setting and stopping a timer takes constant time,
+// no matter how many timers are set.
+// The wheel doesn't run a goroutine. Advance has to be called to fire the expired timers.
+// It is not safe for concurrent use.
+type timerWheel struct {
+	start       time.Time
+	granularity time.Duration
+
+	// tick is the last tick that was processed by Advance
+	tick     uint64
+	slots    []*wheelTimer
+	occupied []uint64 // a bitmap of the slots that contain timers
+}
+
+func newTimerWheel(now time.Time, granularity time.Duration, numSlots int) *timerWheel {
+	if numSlots%64 != 0 {
+		panic("timer wheel: number of slots must be a multiple of 64")
+	}
+	return &timerWheel{
+		start:       now,
+		granularity: granularity,
+		slots:       make([]*wheelTimer, numSlots),
+		occupied:    make([]uint64, numSlots/64),
+	}
+}
+
+// tickFor returns the first tick at or after t
+func (w *timerWheel) tickFor(t time.Time) uint64 {
+	d := t.Sub(w.start)
+	if d <= 0 {
+		return 0
+	}
+	return uint64((d + w.granularity - 1) / w.granularity)
+}
+
+func (w *timerWheel) add(t *wheelTimer) {
+	if t.tick <= w.tick {
+		t.expire()
+		return
+	}
+	slot := int(t.tick % uint64(len(w.slots)))
+	t.slot = slot
+	t.prev = nil
+	t.next = w.slots[slot]
+	if t.next != nil {
+		t.next.prev = t
+	}
+	w.slots[slot] = t
+	w.occupied[slot/64] |= 1 << uint(slot%64)
+}
+
+func (w *timerWheel) remove(t *wheelTimer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.slots[t.slot] = t.next
+		if t.next == nil {
+			w.occupied[t.slot/64] &^= 1 << uint(t.slot%64)
+		}
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev = nil
+	t.next = nil
+}
+
+// nextOccupied returns the first slot at or after slot that contains timers.
+// It wraps around at the end of the wheel.
+func (w *timerWheel) nextOccupied(slot int) (int, bool) {
+	numWords := len(w.occupied)
+	word := slot / 64
+	bitmap := w.occupied[word] &^ (1<<uint(slot%64) - 1)
+	for i := 0; i <= numWords; i++ {
+		if bitmap != 0 {
+			return word*64 + bits.TrailingZeros64(bitmap), true
+		}
+		word = (word + 1) % numWords
+		bitmap = w.occupied[word]
+	}
+	return 0, false
+}
+
+// Advance fires all timers that expired at now.
+func (w *timerWheel) Advance(now time.Time) {
+	// only the ticks that fully passed are processed, so timers never fire early
+	var nowTick uint64
+	if d := now.Sub(w.start); d > 0 {
+		nowTick = uint64(d / w.granularity)
+	}
+	if nowTick <= w.tick {
+		return
+	}
+	numSlots := uint64(len(w.slots))
+	// Every slot only needs to be processed once, even if the wheel wrapped around multiple times since the last call.
+	fromTick := w.tick + 1
+	toTick := nowTick
+	if toTick-fromTick >= numSlots {
+		fromTick = toTick - numSlots + 1
+	}
+	w.tick = nowTick
+	for tick := fromTick; tick <= toTick; {
+		slot, ok := w.nextOccupied(int(tick % numSlots))
+		if !ok {
+			return
+		}
+		// skip the empty slots
+		if s := uint64(slot); s >= tick%numSlots {
+			tick += s - tick%numSlots
+		} else {
+			tick += numSlots - tick%numSlots + s
+		}
+		if tick > toTick {
+			return
+		}
+		for t := w.slots[slot]; t != nil; {
+			next := t.next
+			if t.tick <= nowTick {
+				w.remove(t)
+				t.expire()
+			}
+			t = next
+		}
+		tick++
+	}
+}
+
+// NextExpiry returns the time of the next slot that contains timers.
+// This might be earlier than the time the first timer expires,
+// if the slot contains timers that expire after the wheel wrapped around.
+func (w *timerWheel) NextExpiry() (time.Time, bool) {
+	numSlots := uint64(len(w.slots))
+	next := w.tick + 1
+	slot, ok := w.nextOccupied(int(next % numSlots))
+	if !ok {
+		return time.Time{}, false
+	}
+	if s := uint64(slot); s >= next%numSlots {
+		next += s - next%numSlots
+	} else {
+		next += numSlots - next%numSlots + s
+	}
+	return w.start.Add(time.Duration(next) * w.granularity), true
+}
+
+// A wheelTimer is a timer that is set on a timerWheel.
+// It behaves like the utils.Timer, but it must only be used from the goroutine that advances the wheel.
+type wheelTimer struct {
+	wheel    *timerWheel
+	onExpire func()
+
+	c        chan time.Time
+	read     bool
+	deadline time.Time
+
+	set        bool
+	tick       uint64
+	slot       int
+	prev, next *wheelTimer
+}
+
+var _ sessionTimer = &wheelTimer{}
+
+// newWheelTimer creates a new timer that is not set.
+// onExpire is called every time it fires.
+func newWheelTimer(w *timerWheel, onExpire func()) *wheelTimer {
+	return &wheelTimer{
+		wheel:    w,
+		onExpire: onExpire,
+		c:        make(chan time.Time, 1),
+	}
+}
+
+// Chan returns the channel that the expiry time is sent on when the timer fires
+func (t *wheelTimer) Chan() <-chan time.Time {
+	return t.c
+}
+
+// Reset the timer, no matter whether the value was read or not
+func (t *wheelTimer) Reset(deadline time.Time) {
+	if deadline.Equal(t.deadline) && !t.read {
+		// No need to reset the timer
+		return
+	}
+	t.Stop()
+	t.read = false
+	t.deadline = deadline
+	t.tick = t.wheel.tickFor(deadline)
+	t.set = true
+	t.wheel.add(t)
+}
+
+// SetRead should be called after the value from the chan was read
+func (t *wheelTimer) SetRead() {
+	t.read = true
+}
+
+// Stop stops the timer, and drains its channel
+func (t *wheelTimer) Stop() {
+	if t.set {
+		t.wheel.remove(t)
+		t.set = false
+	}
+	select {
+	case <-t.c:
+	default:
+	}
+}
+
+func (t *wheelTimer) expire() {
+	t.set = false
+	select {
+	case t.c <- t.deadline:
+	default:
+	}
+	if t.onExpire != nil {
+		t.onExpire()
+	}
+}
@@ -0,0 +1,158 @@
+package quic
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Timer Wheel", func() {
+	const numSlots = 128
+
+	var (
+		wheel *timerWheel
+		start time.Time
+	)
+
+	BeforeEach(func() {
+		start = time.Now()
+		wheel = newTimerWheel(start, time.Millisecond, numSlots)
+	})
+
+	It("fires timers when they expire", func() {
+		var fired int
+		t := newWheelTimer(wheel, func() { fired++ })
+		deadline := start.Add(10 * time.Millisecond)
+		t.Reset(deadline)
+		wheel.Advance(start.Add(9 * time.Millisecond))
+		Expect(t.Chan()).ToNot(Receive())
+		Expect(fired).To(BeZero())
+		wheel.Advance(deadline)
+		Expect(t.Chan()).To(Receive(Equal(deadline)))
+		Expect(fired).To(Equal(1))
+	})
+
+	It("doesn't fire timers early", func() {
+		t := newWheelTimer(wheel, nil)
+		t.Reset(start.Add(10*time.Millisecond + time.Microsecond))
+		wheel.Advance(start.Add(10*time.Millisecond + 500*time.Microsecond))
+		Expect(t.Chan()).ToNot(Receive())
+		wheel.Advance(start.Add(11 * time.Millisecond))
+		Expect(t.Chan()).To(Receive())
+	})
+
+	It("fires timers set in the past immediately", func() {
+		var fired bool
+		wheel.Advance(start.Add(10 * time.Millisecond))
+		t := newWheelTimer(wheel, func() { fired = true })
+		t.Reset(start.Add(5 * time.Millisecond))
+		Expect(fired).To(BeTrue())
+		Expect(t.Chan()).To(Receive())
+	})
+
+	It("fires multiple timers in the same slot", func() {
+		t1 := newWheelTimer(wheel, nil)
+		t2 := newWheelTimer(wheel, nil)
+		t3 := newWheelTimer(wheel, nil)
+		t1.Reset(start.Add(5 * time.Millisecond))
+		t2.Reset(start.Add(5 * time.Millisecond))
+		t3.Reset(start.Add(6 * time.Millisecond))
+		wheel.Advance(start.Add(5 * time.Millisecond))
+		Expect(t1.Chan()).To(Receive())
+		Expect(t2.Chan()).To(Receive())
+		Expect(t3.Chan()).ToNot(Receive())
+	})
+
+	It("resets timers", func() {
+		t := newWheelTimer(wheel, nil)
+		t.Reset(start.Add(5 * time.Millisecond))
+		t.Reset(start.Add(20 * time.Millisecond))
+		wheel.Advance(start.Add(10 * time.Millisecond))
+		Expect(t.Chan()).ToNot(Receive())
+		wheel.Advance(start.Add(20 * time.Millisecond))
+		Expect(t.Chan()).To(Receive())
+	})
+
+	It("drains the channel when the timer is reset before the value was read", func() {
+		t := newWheelTimer(wheel, nil)
+		t.Reset(start.Add(5 * time.Millisecond))
+		wheel.Advance(start.Add(5 * time.Millisecond))
+		t.Reset(start.Add(10 * time.Millisecond))
+		Expect(t.Chan()).ToNot(Receive())
+		wheel.Advance(start.Add(10 * time.Millisecond))
+		Expect(t.Chan()).To(Receive())
+	})
+
+	It("fires the timer again when reset to the same deadline after the value was read", func() {
+		deadline := start.Add(5 * time.Millisecond)
+		t := newWheelTimer(wheel, nil)
+		t.Reset(deadline)
+		wheel.Advance(deadline)
+		Expect(t.Chan()).To(Receive())
+		t.SetRead()
+		t.Reset(deadline)
+		Expect(t.Chan()).To(Receive())
+	})
+
+	It("stops timers", func() {
+		t1 := newWheelTimer(wheel, nil)
+		t2 := newWheelTimer(wheel, nil)
+		t1.Reset(start.Add(5 * time.Millisecond))
+		t2.Reset(start.Add(5 * time.Millisecond))
+		t2.Stop()
+		t1.Stop()
+		_, ok := wheel.NextExpiry()
+		Expect(ok).To(BeFalse())
+		wheel.Advance(start.Add(10 * time.Millisecond))
+		Expect(t1.Chan()).ToNot(Receive())
+		Expect(t2.Chan()).ToNot(Receive())
+	})
+
+	It("fires timers that expire after the wheel wrapped around", func() {
+		t := newWheelTimer(wheel, nil)
+		deadline := start.Add((numSlots + 10) * time.Millisecond)
+		t.Reset(deadline)
+		// this processes the slot of the timer, but the timer doesn't expire yet
+		wheel.Advance(start.Add(20 * time.Millisecond))
+		Expect(t.Chan()).ToNot(Receive())
+		wheel.Advance(deadline)
+		Expect(t.Chan()).To(Receive())
+	})
+
+	It("fires all expired timers when the wheel wrapped around multiple times since the last call", func() {
+		t1 := newWheelTimer(wheel, nil)
+		t2 := newWheelTimer(wheel, nil)
+		t1.Reset(start.Add(10 * time.Millisecond))
+		t2.Reset(start.Add(2 * numSlots * time.Millisecond))
+		wheel.Advance(start.Add(5 * numSlots * time.Millisecond))
+		Expect(t1.Chan()).To(Receive())
+		Expect(t2.Chan()).To(Receive())
+	})
+
+	It("returns the next expiry", func() {
+		_, ok := wheel.NextExpiry()
+		Expect(ok).To(BeFalse())
+		t1 := newWheelTimer(wheel, nil)
+		t2 := newWheelTimer(wheel, nil)
+		t1.Reset(start.Add(20*time.Millisecond - time.Microsecond))
+		t2.Reset(start.Add(70 * time.Millisecond))
+		next, ok := wheel.NextExpiry()
+		Expect(ok).To(BeTrue())
+		Expect(next).To(Equal(start.Add(20 * time.Millisecond)))
+		wheel.Advance(next)
+		Expect(t1.Chan()).To(Receive())
+		next, ok = wheel.NextExpiry()
+		Expect(ok).To(BeTrue())
+		Expect(next).To(Equal(start.Add(70 * time.Millisecond)))
+	})
+
+	It("returns the next expiry, when the next timer is in a slot before the current slot", func() {
+		wheel.Advance(start.Add(100 * time.Millisecond))
+		t := newWheelTimer(wheel, nil)
+		t.Reset(start.Add(150 * time.Millisecond))
+		next, ok := wheel.NextExpiry()
+		Expect(ok).To(BeTrue())
+		Expect(next).To(Equal(start.Add(150 * time.Millisecond)))
+	})
+})
@@ -0,0 +1,25 @@
+package quic
+
+// defaultTokenStoreCapacity is the capacity of a store created by NewLRUTokenStore with a capacity < 1
+const defaultTokenStoreCapacity = 64
+
+// lruTokenStore is a TokenStore that evicts the least recently used token when it runs full.
+type lruTokenStore struct {
+	*lruCache
+}
+
+var _ TokenStore = &lruTokenStore{}
+
+// NewLRUTokenStore returns a TokenStore with the given capacity, that uses an LRU strategy.
+// If capacity is < 1, a default capacity is used instead.
+func NewLRUTokenStore(capacity int) TokenStore {
+	if capacity < 1 {
+		capacity = defaultTokenStoreCapacity
+	}
+	return &lruTokenStore{lruCache: newLRUCache(capacity)}
+}
+
+func (s *lruTokenStore) Pop(key string) []byte {
+	token, _ := s.Remove(key)
+	return token
+}
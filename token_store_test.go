@@ -0,0 +1,42 @@
+package quic
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token Store", func() {
+	var store TokenStore
+
+	BeforeEach(func() {
+		store = NewLRUTokenStore(2)
+	})
+
+	It("returns and removes tokens", func() {
+		Expect(store.Pop("foo")).To(BeNil())
+		store.Put("foo", []byte("foobar"))
+		Expect(store.Pop("foo")).To(Equal([]byte("foobar")))
+		Expect(store.Pop("foo")).To(BeNil())
+	})
+
+	It("replaces tokens", func() {
+		store.Put("foo", []byte("foo"))
+		store.Put("foo", []byte("bar"))
+		Expect(store.Pop("foo")).To(Equal([]byte("bar")))
+	})
+
+	It("evicts the least recently used token", func() {
+		store.Put("foo", []byte("foo"))
+		store.Put("bar", []byte("bar"))
+		store.Put("foo", []byte("foo"))
+		store.Put("baz", []byte("baz"))
+		Expect(store.Pop("bar")).To(BeNil())
+		Expect(store.Pop("foo")).To(Equal([]byte("foo")))
+		Expect(store.Pop("baz")).To(Equal([]byte("baz")))
+	})
+
+	It("uses a default capacity", func() {
+		store = NewLRUTokenStore(0)
+		Expect(store.(*lruTokenStore).capacity).To(Equal(defaultTokenStoreCapacity))
+	})
+})
@@ -0,0 +1,284 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+var (
+	errTransportClosed         = errors.New("transport closed")
+	errTransportListenerClosed = errors.New("listener closed")
+)
+
+// A Transport multiplexes QUIC connections on a single net.PacketConn.
+// It can dial any number of QUIC connections, and listen for incoming QUIC connections on the same port.
+// This is useful for peer-to-peer applications, which need to dial out and accept connections on the same port.
+// Incoming packets are passed on to the sessions by their connection ID.
+// All sessions use connection IDs of the same length,
+// so Config.ConnectionIDLength is ignored and Config.RequestConnectionIDOmission can't be used.
+// A Config.ConnectionIDGenerator must generate connection IDs of the Transport's length.
+// Connection migration is not supported for sessions dialed on a Transport.
+type Transport struct {
+	conn      net.PacketConn
+	connIDLen int
+
+	mutex   sync.RWMutex
+	clients map[string] /* string(ConnectionID)*/ *client
+	server  *server
+	closed  bool
+
+	readLoopDone chan struct{}
+}
+
+// NewTransport creates a new Transport on a net.PacketConn, and starts reading packets from it.
+// Errors that occur while handling the packets read are logged to the Config.Logger of the listener.
+// The connection IDs used by the sessions are connIDLen bytes long. If connIDLen is 0, a default value is used.
+func NewTransport(conn net.PacketConn, connIDLen int) (*Transport, error) {
+	if connIDLen == 0 {
+		connIDLen = protocol.DefaultConnectionIDLength
+	}
+	if err := validateConnectionIDLength(connIDLen); err != nil {
+		return nil, err
+	}
+	t := &Transport{
+		conn:         conn,
+		connIDLen:    connIDLen,
+		clients:      make(map[string]*client),
+		readLoopDone: make(chan struct{}),
+	}
+	go t.listen()
+	return t, nil
+}
+
+// Dial establishes a new QUIC connection to a server.
+// The host parameter is used for SNI.
+func (t *Transport) Dial(remoteAddr net.Addr, host string, tlsConf *tls.Config, config *Config) (Session, error) {
+	return t.DialContext(context.Background(), remoteAddr, host, tlsConf, config)
+}
+
+// DialContext establishes a new QUIC connection to a server using the provided context.
+// See DialContext for details.
+func (t *Transport) DialContext(ctx context.Context, remoteAddr net.Addr, host string, tlsConf *tls.Config, config *Config) (Session, error) {
+	if t.isClosed() {
+		return nil, errTransportClosed
+	}
+	return dialContext(ctx, t.conn, remoteAddr, host, tlsConf, config, false, t)
+}
+
+// DialEarly establishes a new QUIC connection to a server, which can be used to send data using 0-RTT.
+// See DialEarly for details.
+func (t *Transport) DialEarly(remoteAddr net.Addr, host string, tlsConf *tls.Config, config *Config) (EarlySession, error) {
+	if t.isClosed() {
+		return nil, errTransportClosed
+	}
+	return dialContext(context.Background(), t.conn, remoteAddr, host, tlsConf, config, true, t)
+}
+
+// Listen listens for incoming QUIC connections.
+// There can only be one listener per Transport at a time.
+// Closing the listener doesn't close the Transport.
+func (t *Transport) Listen(tlsConf *tls.Config, config *Config) (Listener, error) {
+	return t.listenImpl(tlsConf, config, false)
+}
+
+// ListenEarly works like Listen, but it returns sessions before the handshake completes.
+// See ListenEarly for details.
+func (t *Transport) ListenEarly(tlsConf *tls.Config, config *Config) (EarlyListener, error) {
+	s, err := t.listenImpl(tlsConf, config, true)
+	if err != nil {
+		return nil, err
+	}
+	return &earlyServer{s}, nil
+}
+
+func (t *Transport) listenImpl(tlsConf *tls.Config, config *Config, acceptEarly bool) (*server, error) {
+	s, err := listen(t.conn, tlsConf, config, acceptEarly, t)
+	if err != nil {
+		return nil, err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		s.setError(errTransportClosed)
+		return nil, errTransportClosed
+	}
+	if t.server != nil {
+		s.setError(errTransportListenerClosed)
+		return nil, errors.New("transport already has a listener")
+	}
+	t.server = s
+	return s, nil
+}
+
+// LocalAddr returns the local network address.
+func (t *Transport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+// Close closes the listener and all sessions, and then closes the underlying net.PacketConn.
+func (t *Transport) Close() error {
+	t.mutex.Lock()
+	if t.closed {
+		t.mutex.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.mutex.Unlock()
+
+	t.closeListenerAndClients(nil)
+	err := t.conn.Close()
+	<-t.readLoopDone // wait for listen() to return
+	return err
+}
+
+func (t *Transport) isClosed() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.closed
+}
+
+// closeListenerAndClients closes the listener and all sessions dialed on this Transport.
+// It blocks until all sessions are closed.
+func (t *Transport) closeListenerAndClients(e error) {
+	t.mutex.RLock()
+	s := t.server
+	clients := make([]*client, 0, len(t.clients))
+	for _, c := range t.clients {
+		clients = append(clients, c)
+	}
+	t.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	if s != nil {
+		wg.Add(1)
+		go func() {
+			if e != nil {
+				s.closeWithError(e)
+			} else {
+				_ = s.Close()
+			}
+			wg.Done()
+		}()
+	}
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *client) {
+			// session.Close() blocks until the CONNECTION_CLOSE has been sent and the run-loop has stopped
+			c.closeSession(e)
+			wg.Done()
+		}(c)
+	}
+	wg.Wait()
+}
+
+// configureConnectionIDs makes a session dialed or accepted on this Transport use connection IDs of the Transport's length.
+// If the application configured a ConnectionIDGenerator, it must generate connection IDs of that length.
+func (t *Transport) configureConnectionIDs(config *Config, hasGenerator bool) error {
+	if hasGenerator {
+		if l := config.ConnectionIDGenerator.ConnectionIDLen(); l != t.connIDLen {
+			return fmt.Errorf("the ConnectionIDGenerator generates %d byte connection IDs, but the Transport uses %d byte connection IDs", l, t.connIDLen)
+		}
+	} else {
+		config.ConnectionIDGenerator = &randomConnIDGenerator{connIDLen: t.connIDLen}
+	}
+	config.ConnectionIDLength = t.connIDLen
+	return nil
+}
+
+func (t *Transport) addClient(connID protocol.ConnectionID, c *client) {
+	t.mutex.Lock()
+	t.clients[string(connID)] = c
+	t.mutex.Unlock()
+}
+
+func (t *Transport) removeClient(connID protocol.ConnectionID) {
+	t.mutex.Lock()
+	delete(t.clients, string(connID))
+	t.mutex.Unlock()
+}
+
+// getLogger returns the logger of the listener, which uses the logger configured by its Config.Logger.
+// If there's no listener, the DefaultLogger is used.
+func (t *Transport) getLogger() utils.Logger {
+	t.mutex.RLock()
+	s := t.server
+	t.mutex.RUnlock()
+	if s != nil {
+		return s.logger
+	}
+	return utils.DefaultLogger
+}
+
+func (t *Transport) removeListener(s *server) {
+	t.mutex.Lock()
+	if t.server == s {
+		t.server = nil
+	}
+	t.mutex.Unlock()
+}
+
+// listen reads packets from the connection and passes them on for handling.
+// It returns when reading from the connection fails.
+func (t *Transport) listen() {
+	defer close(t.readLoopDone)
+
+	r := newPacketReader(t.conn)
+	for {
+		data, remoteAddr, ecn, err := r.ReadPacket()
+		if err != nil {
+			// when the Transport is closed, the listener and the sessions were already closed
+			if !t.isClosed() {
+				t.closeListenerAndClients(err)
+			}
+			return
+		}
+		passedOn, err := t.handlePacket(remoteAddr, data, ecn)
+		if err != nil {
+			t.getLogger().Errorf("error handling packet: %s", err.Error())
+		}
+		if !passedOn {
+			putPacketBuffer(&data)
+		}
+	}
+}
+
+func (t *Transport) handlePacket(remoteAddr net.Addr, packet []byte, ecn protocol.ECN) (bool /* passed on to a session */, error) {
+	connID, err := wire.ParseConnectionID(packet, t.connIDLen)
+	if err != nil {
+		return false, fmt.Errorf("error parsing connection ID of packet from %s: %s", remoteAddr, err)
+	}
+
+	t.mutex.RLock()
+	c, isClient := t.clients[string(connID)]
+	s := t.server
+	var clients []*client
+	// Stateless resets use a random connection ID, and look like packets with an IETF QUIC Short Header.
+	if !isClient && packet[0]&0x88 == 0 {
+		clients = make([]*client, 0, len(t.clients))
+		for _, c := range t.clients {
+			clients = append(clients, c)
+		}
+	}
+	t.mutex.RUnlock()
+
+	if isClient {
+		return c.handlePacket(remoteAddr, packet, ecn)
+	}
+	for _, c := range clients {
+		if c.handleStatelessReset(packet) {
+			return false, nil
+		}
+	}
+	if s != nil {
+		return s.handlePacket(t.conn, remoteAddr, packet, ecn)
+	}
+	return false, fmt.Errorf("received a packet for an unknown connection %s", connID)
+}
@@ -0,0 +1,256 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transport", func() {
+	var (
+		tr         *Transport
+		packetConn *mockPacketConn
+	)
+
+	newClient := func(connID protocol.ConnectionID, version protocol.VersionNumber) (*client, *mockSession) {
+		msess, _ := newMockSession(nil, 0, connID, nil, nil, nil, nil)
+		sess := msess.(*mockSession)
+		c := &client{
+			srcConnID:              connID,
+			destConnID:             connID,
+			session:                sess,
+			version:                version,
+			config:                 populateClientConfig(nil),
+			conn:                   &conn{pconn: packetConn, currentAddr: packetConn.dataReadFrom},
+			versionNegotiationChan: make(chan struct{}),
+			transport:              tr,
+			logger:                 utils.DefaultLogger,
+		}
+		tr.addClient(connID, c)
+		return c, sess
+	}
+
+	getShortHeaderPacket := func(connID protocol.ConnectionID) []byte {
+		b := &bytes.Buffer{}
+		Expect((&wire.Header{
+			DestConnectionID: connID,
+			PacketNumber:     1,
+			PacketNumberLen:  protocol.PacketNumberLen2,
+		}).Write(b, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+		return append(b.Bytes(), bytes.Repeat([]byte{0}, 50)...)
+	}
+
+	BeforeEach(func() {
+		packetConn = newMockPacketConn()
+		packetConn.addr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(192, 168, 100, 200), Port: 1337}
+		var err error
+		tr, err = NewTransport(packetConn, 6)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(tr.Close()).To(Succeed())
+	})
+
+	It("uses the default connection ID length", func() {
+		t, err := NewTransport(newMockPacketConn(), 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.connIDLen).To(Equal(protocol.DefaultConnectionIDLength))
+		Expect(t.Close()).To(Succeed())
+	})
+
+	It("errors when the connection ID length is invalid", func() {
+		_, err := NewTransport(newMockPacketConn(), 19)
+		Expect(err).To(MatchError("invalid connection ID length: 19 bytes (must be between 4 and 18 bytes)"))
+	})
+
+	It("returns the local address", func() {
+		Expect(tr.LocalAddr()).To(Equal(packetConn.addr))
+	})
+
+	Context("passing packets to clients", func() {
+		It("passes packets to the client with the connection ID", func() {
+			_, sess1 := newClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, protocol.Version39)
+			_, sess2 := newClient(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}, protocol.Version39)
+			b := &bytes.Buffer{}
+			Expect((&wire.Header{
+				DestConnectionID: protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				PacketNumber:     1,
+				PacketNumberLen:  protocol.PacketNumberLen1,
+			}).Write(b, protocol.PerspectiveServer, protocol.Version39)).To(Succeed())
+			Expect(tr.handlePacket(packetConn.dataReadFrom, b.Bytes(), protocol.ECNNon)).To(BeTrue())
+			Expect(sess1.handledPackets).To(BeEmpty())
+			Expect(sess2.handledPackets).To(HaveLen(1))
+		})
+
+		It("uses the connection ID length of the Transport for IETF QUIC Short Headers", func() {
+			_, sess := newClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6}, protocol.VersionTLS)
+			Expect(tr.handlePacket(packetConn.dataReadFrom, getShortHeaderPacket(protocol.ConnectionID{1, 2, 3, 4, 5, 6}), protocol.ECNNon)).To(BeTrue())
+			Expect(sess.handledPackets).To(HaveLen(1))
+		})
+
+		It("detects stateless resets for clients", func() {
+			_, sess1 := newClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6}, protocol.VersionTLS)
+			_, sess2 := newClient(protocol.ConnectionID{6, 5, 4, 3, 2, 1}, protocol.VersionTLS)
+			sess2.isStatelessReset = true
+			// stateless resets use a random connection ID
+			Expect(tr.handlePacket(packetConn.dataReadFrom, getShortHeaderPacket(protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0, 0}), protocol.ECNNon)).To(BeFalse())
+			Expect(sess1.closed).To(BeFalse())
+			Expect(sess2.closedRemote).To(BeTrue())
+			Expect(sess2.closeReason).To(BeAssignableToTypeOf(StatelessResetError{}))
+		})
+
+		It("removes clients", func() {
+			_, sess := newClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6}, protocol.VersionTLS)
+			tr.removeClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6})
+			_, err := tr.handlePacket(packetConn.dataReadFrom, getShortHeaderPacket(protocol.ConnectionID{1, 2, 3, 4, 5, 6}), protocol.ECNNon)
+			Expect(err).To(MatchError("received a packet for an unknown connection 0x010203040506"))
+			Expect(sess.handledPackets).To(BeEmpty())
+		})
+
+		It("reads packets from the connection", func() {
+			_, sess := newClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6}, protocol.VersionTLS)
+			packetConn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{1, 2, 3, 4, 5, 6})
+			Eventually(func() []*receivedPacket { return sess.handledPackets }).Should(HaveLen(1))
+		})
+
+		It("errors on packets that are too short to contain a connection ID", func() {
+			_, err := tr.handlePacket(packetConn.dataReadFrom, []byte{0x30, 1, 2}, protocol.ECNNon)
+			Expect(err).To(MatchError("error parsing connection ID of packet from 192.168.100.200:1337: EOF"))
+		})
+
+		It("registers clients when they start listening, and removes them when the session is closed", func() {
+			c := &client{srcConnID: protocol.ConnectionID{1, 2, 3, 4, 5, 6}, transport: tr}
+			c.startListening()
+			Expect(tr.clients).To(HaveKey(string(protocol.ConnectionID{1, 2, 3, 4, 5, 6})))
+			c.closeConn()
+			Expect(tr.clients).To(BeEmpty())
+			Expect(packetConn.closed).To(BeFalse())
+		})
+
+		It("only checks IETF QUIC sessions for stateless resets", func() {
+			c, sess := newClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6}, protocol.Version39)
+			sess.isStatelessReset = true
+			Expect(c.handleStatelessReset(getShortHeaderPacket(protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0, 0}))).To(BeFalse())
+			Expect(sess.closed).To(BeFalse())
+		})
+
+		It("rejects dialing when requesting connection ID omission", func() {
+			_, err := tr.Dial(packetConn.dataReadFrom, "localhost:1337", nil, &Config{RequestConnectionIDOmission: true})
+			Expect(err).To(MatchError("connection ID omission can't be requested when using a Transport"))
+		})
+	})
+
+	Context("listening", func() {
+		It("passes packets for unknown connections to the listener", func() {
+			_, err := tr.Listen(&tls.Config{}, &Config{Versions: []protocol.VersionNumber{protocol.Version39}})
+			Expect(err).ToNot(HaveOccurred())
+			// a gQUIC packet for an unknown connection
+			_, err = tr.handlePacket(packetConn.dataReadFrom, []byte{0x08, 1, 2, 3, 4, 5, 6, 7, 8, 0x01}, protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			// the listener sent a Public Reset
+			Expect(packetConn.dataWritten.Len()).ToNot(BeZero())
+			Expect(packetConn.dataWrittenTo).To(Equal(packetConn.dataReadFrom))
+		})
+
+		It("logs errors using the logger configured for the listener", func() {
+			l := &recordingLogger{level: LogLevelError}
+			_, err := tr.Listen(&tls.Config{}, &Config{Logger: l})
+			Expect(err).ToNot(HaveOccurred())
+			// too short to contain a connection ID
+			packetConn.dataToRead <- []byte{0x30, 1, 2}
+			Eventually(l.getMessages).Should(HaveLen(1))
+			Expect(l.getMessages()[0].msg).To(ContainSubstring("error handling packet"))
+		})
+
+		It("uses the connection ID length of the Transport", func() {
+			ln, err := tr.Listen(&tls.Config{}, &Config{ConnectionIDLength: 12})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.(*server).config.ConnectionIDLength).To(Equal(6))
+			Expect(ln.(*server).config.ConnectionIDGenerator.ConnectionIDLen()).To(Equal(6))
+		})
+
+		It("accepts a ConnectionIDGenerator that generates connection IDs of the Transport's length", func() {
+			generator := &mockConnIDGenerator{prefix: []byte{1, 2, 3, 4, 5}, connIDLen: 6}
+			ln, err := tr.Listen(&tls.Config{}, &Config{ConnectionIDGenerator: generator})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.(*server).config.ConnectionIDGenerator).To(Equal(generator))
+		})
+
+		It("rejects a ConnectionIDGenerator that generates connection IDs of a different length", func() {
+			_, err := tr.Listen(&tls.Config{}, &Config{ConnectionIDGenerator: &randomConnIDGenerator{connIDLen: 8}})
+			Expect(err).To(MatchError("the ConnectionIDGenerator generates 8 byte connection IDs, but the Transport uses 6 byte connection IDs"))
+			_, err = tr.Dial(packetConn.dataReadFrom, "localhost:1337", nil, &Config{ConnectionIDGenerator: &randomConnIDGenerator{}})
+			Expect(err).To(MatchError("the ConnectionIDGenerator generates 0 byte connection IDs, but the Transport uses 6 byte connection IDs"))
+		})
+
+		It("only allows one listener at a time", func() {
+			ln, err := tr.Listen(&tls.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tr.ListenEarly(&tls.Config{}, nil)
+			Expect(err).To(MatchError("transport already has a listener"))
+			Expect(ln.Close()).To(Succeed())
+			eln, err := tr.ListenEarly(&tls.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eln).To(BeAssignableToTypeOf(&earlyServer{}))
+		})
+
+		It("doesn't close the connection when the listener is closed", func() {
+			ln, err := tr.Listen(&tls.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.Addr()).To(Equal(packetConn.addr))
+			Expect(ln.Close()).To(Succeed())
+			_, err = ln.Accept()
+			Expect(err).To(MatchError(errTransportListenerClosed))
+			Expect(packetConn.closed).To(BeFalse())
+			_, err = tr.handlePacket(packetConn.dataReadFrom, []byte{0x08, 1, 2, 3, 4, 5, 6, 7, 8, 0x01}, protocol.ECNNon)
+			Expect(err).To(MatchError("received a packet for an unknown connection 0x0102030405060708"))
+		})
+	})
+
+	Context("closing", func() {
+		It("closes the listener, the sessions and the connection", func() {
+			ln, err := tr.Listen(&tls.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, sess := newClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6}, protocol.VersionTLS)
+			Expect(tr.Close()).To(Succeed())
+			Expect(sess.closed).To(BeTrue())
+			Expect(sess.closeReason).ToNot(HaveOccurred())
+			_, err = ln.Accept()
+			Expect(err).To(MatchError(errTransportListenerClosed))
+			Expect(packetConn.closed).To(BeTrue())
+		})
+
+		It("errors when dialing or listening after closing", func() {
+			Expect(tr.Close()).To(Succeed())
+			_, err := tr.Dial(packetConn.dataReadFrom, "localhost:1337", nil, nil)
+			Expect(err).To(MatchError(errTransportClosed))
+			_, err = tr.DialEarly(packetConn.dataReadFrom, "localhost:1337", nil, nil)
+			Expect(err).To(MatchError(errTransportClosed))
+			_, err = tr.Listen(&tls.Config{}, nil)
+			Expect(err).To(MatchError(errTransportClosed))
+		})
+
+		It("closes the listener and the sessions when reading from the connection fails", func() {
+			ln, err := tr.Listen(&tls.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, sess := newClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6}, protocol.VersionTLS)
+			// closing the mockPacketConn makes ReadFrom return an error
+			packetConn.Close()
+			Eventually(tr.readLoopDone).Should(BeClosed())
+			Expect(sess.closed).To(BeTrue())
+			Expect(sess.closeReason).To(MatchError("connection closed"))
+			_, err = ln.Accept()
+			Expect(err).To(MatchError("connection closed"))
+		})
+	})
+})
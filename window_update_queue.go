@@ -55,3 +55,19 @@ func (q *windowUpdateQueue) QueueAll() {
 	}
 	q.mutex.Unlock()
 }
+
+// IsSuperseded says if a lost MAX_STREAM_DATA frame doesn't need to be retransmitted.
+// This is the case if a MAX_STREAM_DATA with a higher offset was sent since, or if the stream was already closed.
+func (q *windowUpdateQueue) IsSuperseded(f *wire.MaxStreamDataFrame) bool {
+	var receiveWindow protocol.ByteCount
+	if f.StreamID == q.cryptoStream.StreamID() {
+		receiveWindow = q.cryptoStream.getReceiveWindow()
+	} else {
+		str, err := q.streamGetter.GetOrOpenReceiveStream(f.StreamID)
+		if err != nil || str == nil {
+			return true
+		}
+		receiveWindow = str.getReceiveWindow()
+	}
+	return f.ByteOffset < receiveWindow
+}
@@ -87,4 +87,26 @@ var _ = Describe("Window Update Queue", func() {
 			&wire.MaxStreamDataFrame{StreamID: 10, ByteOffset: 200},
 		}))
 	})
+
+	Context("retransmissions", func() {
+		It("says that a MAX_STREAM_DATA is superseded, if a higher offset was sent", func() {
+			stream7 := NewMockStreamI(mockCtrl)
+			stream7.EXPECT().getReceiveWindow().Return(protocol.ByteCount(1000)).Times(3)
+			streamGetter.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(7)).Return(stream7, nil).Times(3)
+			Expect(q.IsSuperseded(&wire.MaxStreamDataFrame{StreamID: 7, ByteOffset: 900})).To(BeTrue())
+			Expect(q.IsSuperseded(&wire.MaxStreamDataFrame{StreamID: 7, ByteOffset: 1000})).To(BeFalse())
+			Expect(q.IsSuperseded(&wire.MaxStreamDataFrame{StreamID: 7, ByteOffset: 1100})).To(BeFalse())
+		})
+
+		It("says that a MAX_STREAM_DATA for a closed stream is superseded", func() {
+			streamGetter.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(12)).Return(nil, nil)
+			Expect(q.IsSuperseded(&wire.MaxStreamDataFrame{StreamID: 12, ByteOffset: 100})).To(BeTrue())
+		})
+
+		It("checks MAX_STREAM_DATA frames for the crypto stream", func() {
+			cryptoStream.EXPECT().getReceiveWindow().Return(protocol.ByteCount(42)).Times(2)
+			Expect(q.IsSuperseded(&wire.MaxStreamDataFrame{StreamID: 0, ByteOffset: 41})).To(BeTrue())
+			Expect(q.IsSuperseded(&wire.MaxStreamDataFrame{StreamID: 0, ByteOffset: 42})).To(BeFalse())
+		})
+	})
 })